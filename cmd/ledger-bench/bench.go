@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// operation types
+const (
+	opDeposit  = "deposit"
+	opWithdraw = "withdraw"
+	opBalance  = "balance"
+	opHistory  = "history"
+)
+
+var operations = []string{opDeposit, opWithdraw, opBalance, opHistory}
+
+// mix is the weight of every operation type, an operation is picked with the probability of its share
+type mix map[string]int
+
+const defaultMix = "deposit=40,withdraw=20,balance=30,history=10"
+
+// parseMix reads op=weight pairs, the types left out have no weight
+func parseMix(raw string) (mix, error) {
+	m := make(mix)
+	total := 0
+	for _, pair := range strings.Split(raw, ",") {
+		op, weight, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || !slices.Contains(operations, op) {
+			return nil, fmt.Errorf("invalid mix %q, expected op=weight pairs of %s", raw, strings.Join(operations, ", "))
+		}
+		n, err := strconv.Atoi(weight)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid weight %q of %s", weight, op)
+		}
+		m[op] = n
+		total += n
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("invalid mix %q, no operation has a weight", raw)
+	}
+	return m, nil
+}
+
+func (m mix) pick(r *rand.Rand) string {
+	total := 0
+	for _, op := range operations {
+		total += m[op]
+	}
+	n := r.IntN(total)
+	for _, op := range operations {
+		if n < m[op] {
+			return op
+		}
+		n -= m[op]
+	}
+	panic("unreachable")
+}
+
+type benchConfig struct {
+	workers   int
+	duration  time.Duration
+	ops       int64 // operations in all, instead of the duration when set
+	users     []string
+	mix       mix
+	maxAmount float64
+}
+
+// tally is what a worker saw, merged once the workers are done
+type tally struct {
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	rejected  map[string]int
+	samples   map[string]string  // the first error of every operation type, to tell what went wrong
+	expected  map[string]float64 // the balance every user should have from the writes that succeeded
+	unknown   map[string]bool    // the users with a write of unknown outcome
+}
+
+func newTally() *tally {
+	return &tally{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+		rejected:  make(map[string]int),
+		samples:   make(map[string]string),
+		expected:  make(map[string]float64),
+		unknown:   make(map[string]bool),
+	}
+}
+
+func (t *tally) merge(other *tally) {
+	for op, latencies := range other.latencies {
+		t.latencies[op] = append(t.latencies[op], latencies...)
+	}
+	for op, n := range other.errors {
+		t.errors[op] += n
+	}
+	for op, n := range other.rejected {
+		t.rejected[op] += n
+	}
+	for op, sample := range other.samples {
+		if _, found := t.samples[op]; !found {
+			t.samples[op] = sample
+		}
+	}
+	for user, amount := range other.expected {
+		t.expected[user] += amount
+	}
+	for user := range other.unknown {
+		t.unknown[user] = true
+	}
+}
+
+// runBench runs the workers until the duration or the operations are done, or stop is cancelled, and returns what
+// they saw with how long it took. operations in flight when it ends are finished, not cancelled
+func runBench(stop context.Context, t target, cfg benchConfig) (*tally, time.Duration) {
+	deadline := time.Now().Add(cfg.duration)
+	var started atomic.Int64
+	more := func() bool {
+		if stop.Err() != nil {
+			return false
+		}
+		if cfg.ops > 0 {
+			return started.Add(1) <= cfg.ops
+		}
+		return time.Now().Before(deadline)
+	}
+
+	results := make([]*tally, cfg.workers)
+	var wg sync.WaitGroup
+	begin := time.Now()
+	for w := range cfg.workers {
+		results[w] = newTally()
+		wg.Add(1)
+		go func(worker int, result *tally) {
+			defer wg.Done()
+			r := rand.New(rand.NewPCG(uint64(worker), uint64(begin.UnixNano())))
+			for n := 0; more(); n++ {
+				op := cfg.mix.pick(r)
+				user := cfg.users[r.IntN(len(cfg.users))]
+				runOperation(t, op, user, fmt.Sprintf("bench %d-%d", worker, n), cfg.maxAmount, r, result)
+			}
+		}(w, results[w])
+	}
+	wg.Wait()
+	elapsed := time.Since(begin)
+
+	total := newTally()
+	for _, result := range results {
+		total.merge(result)
+	}
+	return total, elapsed
+}
+
+// runOperation runs one operation and counts it in result. the amounts are whole cents so the expected balances add
+// up exactly
+func runOperation(t target, op, user, description string, maxAmount float64, r *rand.Rand, result *tally) {
+	ctx := context.Background()
+	amount := float64(r.IntN(int(maxAmount*100))+1) / 100
+
+	var moved float64
+	var err error
+	start := time.Now()
+	switch op {
+	case opDeposit:
+		moved, err = t.deposit(ctx, user, amount, description)
+	case opWithdraw:
+		moved, err = t.withdraw(ctx, user, amount, description)
+	case opBalance:
+		_, err = t.balance(ctx, user)
+	case opHistory:
+		err = t.history(ctx, user)
+	}
+	result.latencies[op] = append(result.latencies[op], time.Since(start))
+
+	switch {
+	case err == nil:
+		result.expected[user] += moved
+	case errors.Is(err, errRejected):
+		result.rejected[op]++
+	default:
+		result.errors[op]++
+		if _, found := result.samples[op]; !found {
+			result.samples[op] = err.Error()
+		}
+		if errors.Is(err, errUnknownOutcome) && (op == opDeposit || op == opWithdraw) {
+			result.unknown[user] = true
+		}
+	}
+}
+
+// mismatch is a user whose balance isn't the sum of its successful writes
+type mismatch struct {
+	User     string  `json:"user"`
+	Expected float64 `json:"expected"`
+	Actual   float64 `json:"actual"`
+	Error    string  `json:"error,omitempty"` // the balance couldn't be read
+}
+
+type consistency struct {
+	Checked    int        `json:"checked"`
+	Unverified int        `json:"unverified"` // users with a write of unknown outcome
+	Mismatches []mismatch `json:"mismatches"`
+}
+
+// checkConsistency compares the balance of every user with the sum of the writes that succeeded, to the cent
+func checkConsistency(t target, users []string, result *tally) consistency {
+	c := consistency{Mismatches: []mismatch{}}
+	for _, user := range users {
+		if result.unknown[user] {
+			c.Unverified++
+			continue
+		}
+		c.Checked++
+		expected := math.Round(result.expected[user]*100) / 100
+		actual, err := t.balance(context.Background(), user)
+		if err != nil {
+			c.Mismatches = append(c.Mismatches, mismatch{User: user, Expected: expected, Error: err.Error()})
+			continue
+		}
+		if math.Abs(actual-expected) >= 0.005 {
+			c.Mismatches = append(c.Mismatches, mismatch{User: user, Expected: expected, Actual: actual})
+		}
+	}
+	return c
+}
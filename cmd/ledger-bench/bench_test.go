@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"math/rand/v2"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMix(t *testing.T) {
+	m, err := parseMix(defaultMix)
+	if err != nil || !reflect.DeepEqual(m, mix{opDeposit: 40, opWithdraw: 20, opBalance: 30, opHistory: 10}) {
+		t.Errorf("unexpected mix %v %v", m, err)
+	}
+	for _, raw := range []string{"", "deposit", "deposit=x", "deposit=-1", "refund=10", "deposit=0,balance=0"} {
+		if _, err := parseMix(raw); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+
+	// an operation without weight is never picked
+	m, _ = parseMix("deposit=1,history=3")
+	r := rand.New(rand.NewPCG(1, 2))
+	picked := make(map[string]int)
+	for range 1000 {
+		picked[m.pick(r)]++
+	}
+	if picked[opBalance] != 0 || picked[opWithdraw] != 0 || picked[opHistory] < 650 || picked[opDeposit] < 150 {
+		t.Errorf("unexpected picks %v", picked)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 200; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	for p, expected := range map[int]float64{50: 100, 95: 190, 99: 198} {
+		if got := percentile(latencies, p); got != expected {
+			t.Errorf("expected p%d to be %vms, got %v", p, expected, got)
+		}
+	}
+	if percentile([]time.Duration{3 * time.Millisecond}, 99) != 3 || percentile(nil, 50) != 0 {
+		t.Errorf("unexpected percentile of a single or no latency")
+	}
+}
+
+// brokenTarget is a store that loses a cent on every deposit of bob and times out on the writes of carol
+type brokenTarget struct {
+	storeTarget
+}
+
+func (t brokenTarget) deposit(ctx context.Context, userID string, amount float64, description string) (float64, error) {
+	switch userID {
+	case "carol":
+		return 0, errUnknownOutcome
+	case "bob":
+		t.storeTarget.deposit(ctx, userID, amount-0.01, description)
+		return amount, nil
+	}
+	return t.storeTarget.deposit(ctx, userID, amount, description)
+}
+
+func TestConsistencyCheck(t *testing.T) {
+	users := []string{"alice", "bob", "carol"}
+	target := brokenTarget{newStoreTarget()}
+	m, _ := parseMix("deposit=1")
+	result, _ := runBench(context.Background(), target, benchConfig{workers: 2, ops: 30, users: users, mix: m, maxAmount: 10})
+
+	check := checkConsistency(target, users, result)
+	if check.Checked != 2 || check.Unverified != 1 || len(check.Mismatches) != 1 || check.Mismatches[0].User != "bob" {
+		t.Fatalf("expected bob to mismatch and carol to be unverified, got %+v", check)
+	}
+	if m := check.Mismatches[0]; m.Expected-m.Actual < 0.005 {
+		t.Errorf("expected bob to be short, got %+v", m)
+	}
+	if result.errors[opDeposit] == 0 || result.samples[opDeposit] != "unknown outcome" {
+		t.Errorf("expected the deposits of carol to be errors, got %v %v", result.errors, result.samples)
+	}
+}
+
+func TestStopEndsTheRun(t *testing.T) {
+	m, _ := parseMix(defaultMix)
+	stop, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, _ := runBench(stop, newStoreTarget(), benchConfig{workers: 4, duration: time.Hour, users: []string{"alice"}, mix: m, maxAmount: 10})
+	if len(result.latencies) != 0 {
+		t.Errorf("expected no operation, got %v", result.latencies)
+	}
+}
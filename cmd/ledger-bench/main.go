@@ -0,0 +1,245 @@
+// Command ledger-bench is a load generator for the ledger, run before deploying changes to the store:
+//
+//	ledger-bench [--url URL | --in-process] [--workers 8] [--duration 10s | --ops 100000] [--users 50]
+//		[--mix deposit=40,withdraw=20,balance=30,history=10] [--json report.json]
+//
+// the workers run a random mix of deposits, withdrawals, balance reads and history reads on a pool of users of the
+// run, against the server at LEDGER_URL (or --url) with the bearer token LEDGER_API_KEY, or against a store of its
+// own with --in-process to leave the network and the HTTP stack out. it reports the throughput, the p50/p95/p99
+// latency and the errors of every operation type, then checks that the balance of every user is the sum of its
+// successful writes. a mismatch exits 1
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"tiny-ledger/pkg/client"
+)
+
+const defaultURL = "http://localhost:8080"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdout, os.Stderr))
+}
+
+// errUsage is a flag the flag package already reported
+var errUsage = errors.New("usage")
+
+type options struct {
+	baseURL   string
+	inProcess bool
+	timeout   time.Duration
+	jsonPath  string
+	users     int
+	bench     benchConfig
+}
+
+func parseFlags(args []string, getenv func(string) string, stderr io.Writer) (options, error) {
+	opts := options{baseURL: getenv("LEDGER_URL")}
+	if opts.baseURL == "" {
+		opts.baseURL = defaultURL
+	}
+
+	fs := flag.NewFlagSet("ledger-bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.baseURL, "url", opts.baseURL, "base URL of the ledger server (LEDGER_URL)")
+	fs.BoolVar(&opts.inProcess, "in-process", false, "run against a store in the process instead of a server")
+	fs.DurationVar(&opts.timeout, "timeout", 10*time.Second, "timeout of a request to the server")
+	fs.StringVar(&opts.jsonPath, "json", "", "also write the report as JSON to this file")
+	fs.IntVar(&opts.users, "users", 50, "users the operations are spread over")
+	fs.IntVar(&opts.bench.workers, "workers", 8, "concurrent workers")
+	fs.DurationVar(&opts.bench.duration, "duration", 10*time.Second, "how long to run")
+	fs.Int64Var(&opts.bench.ops, "ops", 0, "operations to run in all, instead of --duration")
+	fs.Float64Var(&opts.bench.maxAmount, "max-amount", 100, "largest amount of a deposit or a withdrawal")
+	mixFlag := fs.String("mix", defaultMix, "weight of every operation type")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return opts, err
+		}
+		return opts, errUsage
+	}
+
+	switch {
+	case fs.NArg() > 0:
+		return opts, fmt.Errorf("unexpected arguments %q", fs.Args())
+	case opts.bench.workers < 1:
+		return opts, errors.New("--workers must be positive")
+	case opts.users < 1:
+		return opts, errors.New("--users must be positive")
+	case opts.bench.duration <= 0 && opts.bench.ops <= 0:
+		return opts, errors.New("--duration or --ops must be positive")
+	case opts.bench.ops < 0:
+		return opts, errors.New("--ops must not be negative")
+	case opts.bench.maxAmount < 0.01:
+		return opts, errors.New("--max-amount must be at least 0.01")
+	}
+	mix, err := parseMix(*mixFlag)
+	if err != nil {
+		return opts, err
+	}
+	opts.bench.mix = mix
+	return opts, nil
+}
+
+func run(args []string, getenv func(string) string, stdout, stderr io.Writer) int {
+	opts, err := parseFlags(args, getenv, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(stderr, "ledger-bench: "+err.Error())
+		}
+		return 2
+	}
+
+	var t target
+	targetName := "in-process"
+	if opts.inProcess {
+		t = newStoreTarget()
+	} else {
+		c, err := client.New(opts.baseURL, client.WithAPIKey(getenv("LEDGER_API_KEY")), client.WithTimeout(opts.timeout))
+		if err != nil {
+			fmt.Fprintln(stderr, "ledger-bench: "+err.Error())
+			return 2
+		}
+		t, targetName = httpTarget{client: c}, opts.baseURL
+	}
+
+	// users of their own, so the check isn't thrown off by an earlier run or other clients of the server
+	runID := make([]byte, 3)
+	rand.Read(runID)
+	for i := range opts.users {
+		opts.bench.users = append(opts.bench.users, fmt.Sprintf("bench-%s-%d", hex.EncodeToString(runID), i))
+	}
+
+	// an interrupt ends the run early, the report is still written
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	result, elapsed := runBench(stop, t, opts.bench)
+	rep := newReport(targetName, opts.bench, result, elapsed, checkConsistency(t, opts.bench.users, result))
+	rep.writeTable(stdout)
+	for _, op := range operations {
+		if sample, found := result.samples[op]; found {
+			fmt.Fprintf(stderr, "ledger-bench: %s errors, e.g. %s\n", op, sample)
+		}
+	}
+	if opts.jsonPath != "" {
+		if err := rep.writeJSON(opts.jsonPath); err != nil {
+			fmt.Fprintln(stderr, "ledger-bench: "+err.Error())
+			return 1
+		}
+	}
+	if len(rep.Consistency.Mismatches) > 0 {
+		fmt.Fprintf(stderr, "ledger-bench: %d users don't have the balance of their writes\n", len(rep.Consistency.Mismatches))
+		return 1
+	}
+	return 0
+}
+
+// report is the outcome of a run, the JSON file is meant for comparing runs in CI
+type report struct {
+	Target      string         `json:"target"`
+	Workers     int            `json:"workers"`
+	Users       int            `json:"users"`
+	Mix         map[string]int `json:"mix"`
+	Elapsed     float64        `json:"elapsedSeconds"`
+	Operations  []opStats      `json:"operations"`
+	Total       opStats        `json:"total"`
+	Consistency consistency    `json:"consistency"`
+}
+
+// opStats are the numbers of an operation type, the latencies in milliseconds. rejected operations (e.g. a
+// withdrawal over the balance) are correct answers and not errors
+type opStats struct {
+	Operation  string  `json:"operation"`
+	Count      int     `json:"count"`
+	Errors     int     `json:"errors"`
+	Rejected   int     `json:"rejected"`
+	Throughput float64 `json:"throughput"` // per second
+	P50        float64 `json:"p50Ms"`
+	P95        float64 `json:"p95Ms"`
+	P99        float64 `json:"p99Ms"`
+}
+
+func newReport(target string, cfg benchConfig, result *tally, elapsed time.Duration, check consistency) report {
+	rep := report{
+		Target: target, Workers: cfg.workers, Users: len(cfg.users), Mix: cfg.mix,
+		Elapsed: elapsed.Seconds(), Operations: []opStats{}, Consistency: check,
+	}
+	var all []time.Duration
+	var errs, rejected int
+	for _, op := range operations {
+		latencies := result.latencies[op]
+		if len(latencies) == 0 {
+			continue
+		}
+		all = append(all, latencies...)
+		errs, rejected = errs+result.errors[op], rejected+result.rejected[op]
+		rep.Operations = append(rep.Operations, newOpStats(op, latencies, result.errors[op], result.rejected[op], elapsed))
+	}
+	rep.Total = newOpStats("total", all, errs, rejected, elapsed)
+	return rep
+}
+
+func newOpStats(op string, latencies []time.Duration, errs, rejected int, elapsed time.Duration) opStats {
+	slices.Sort(latencies)
+	stats := opStats{Operation: op, Count: len(latencies), Errors: errs, Rejected: rejected}
+	if elapsed > 0 {
+		stats.Throughput = float64(len(latencies)) / elapsed.Seconds()
+	}
+	stats.P50, stats.P95, stats.P99 = percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99)
+	return stats
+}
+
+// percentile is the nearest-rank percentile of the sorted latencies in milliseconds
+func percentile(sorted []time.Duration, p int) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := (p*len(sorted) + 99) / 100
+	return float64(sorted[max(rank, 1)-1]) / float64(time.Millisecond)
+}
+
+func (rep report) writeTable(w io.Writer) {
+	fmt.Fprintf(w, "%s, %d workers, %d users, %.1fs\n\n", rep.Target, rep.Workers, rep.Users, rep.Elapsed)
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "OPERATION\tCOUNT\tERRORS\tREJECTED\tOPS/S\tP50\tP95\tP99\t")
+	for _, stats := range append(rep.Operations, rep.Total) {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%d\t%.1f\t%.3fms\t%.3fms\t%.3fms\t\n", stats.Operation, stats.Count, stats.Errors,
+			stats.Rejected, stats.Throughput, stats.P50, stats.P95, stats.P99)
+	}
+	table.Flush()
+
+	c := rep.Consistency
+	fmt.Fprintf(w, "\nconsistency: %d users checked, %d mismatches, %d unverified\n", c.Checked, len(c.Mismatches), c.Unverified)
+	for _, m := range c.Mismatches {
+		if m.Error != "" {
+			fmt.Fprintf(w, "  %s: expected %.2f, %s\n", m.User, m.Expected, m.Error)
+			continue
+		}
+		fmt.Fprintf(w, "  %s: expected %.2f, got %.2f\n", m.User, m.Expected, m.Actual)
+	}
+}
+
+func (rep report) writeJSON(path string) error {
+	encoded, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(encoded, '\n'), 0o644)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+func ledgerBench(env map[string]string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := run(args, func(key string) string { return env[key] }, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func readReport(t *testing.T, path string) report {
+	t.Helper()
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var rep report
+	if err := json.Unmarshal(raw, &rep); err != nil {
+		t.Fatalf("could not parse the report: %v", err)
+	}
+	return rep
+}
+
+func TestBenchInProcess(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	code, stdout, stderr := ledgerBench(nil, "--in-process", "--ops", "400", "--workers", "4", "--users", "5", "--json", path)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	for _, expected := range []string{"in-process, 4 workers, 5 users", "OPERATION", "deposit", "total", "consistency: 5 users checked, 0 mismatches"} {
+		if !strings.Contains(stdout, expected) {
+			t.Errorf("expected %q in:\n%s", expected, stdout)
+		}
+	}
+
+	rep := readReport(t, path)
+	sum := 0
+	for _, stats := range rep.Operations {
+		sum += stats.Count
+	}
+	if rep.Total.Count != 400 || sum != 400 || len(rep.Operations) != 4 || rep.Total.Errors != 0 {
+		t.Errorf("expected 400 operations of the 4 types, got %+v", rep)
+	}
+	if rep.Total.P50 <= 0 || rep.Total.P50 > rep.Total.P99 || rep.Total.Throughput <= 0 {
+		t.Errorf("unexpected latencies %+v", rep.Total)
+	}
+	if rep.Consistency.Checked != 5 || len(rep.Consistency.Mismatches) != 0 {
+		t.Errorf("unexpected consistency %+v", rep.Consistency)
+	}
+}
+
+func TestBenchAgainstAServer(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	router := mux.NewRouter()
+	router.Use(handlers.RequestIDMiddleware)
+	handlers.NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		handlers.WithAuth(verifier)).RegisterRoutes(router, handlers.APIPrefix)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	env := map[string]string{"LEDGER_URL": ts.URL, "LEDGER_API_KEY": authtest.Token(authtest.Secret, "bench", auth.ScopeAdmin)}
+	code, stdout, stderr := ledgerBench(env, "--ops", "200", "--workers", "4", "--users", "3", "--mix", "deposit=2,withdraw=1,history=1", "--json", path)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s\n%s", code, stderr, stdout)
+	}
+	rep := readReport(t, path)
+	if rep.Target != ts.URL || rep.Total.Count != 200 || rep.Total.Errors != 0 || len(rep.Operations) != 3 {
+		t.Errorf("unexpected report %+v", rep)
+	}
+	if rep.Consistency.Checked != 3 || len(rep.Consistency.Mismatches) != 0 {
+		t.Errorf("unexpected consistency %+v", rep.Consistency)
+	}
+
+	// without a token every operation fails, there's nothing to check against
+	code, stdout, stderr = ledgerBench(map[string]string{"LEDGER_URL": ts.URL}, "--ops", "20", "--users", "2")
+	if code != 1 || !strings.Contains(stderr, "deposit errors, e.g. UNAUTHORIZED") || !strings.Contains(stdout, "2 mismatches") {
+		t.Errorf("expected the errors and the mismatches, got %d %q\n%s", code, stderr, stdout)
+	}
+}
+
+func TestBenchArguments(t *testing.T) {
+	tests := []struct {
+		args           []string
+		expectedStderr string
+	}{
+		{[]string{"--workers", "0"}, "--workers must be positive"},
+		{[]string{"--duration", "0"}, "--duration or --ops must be positive"},
+		{[]string{"--mix", "refund=1"}, "invalid mix"},
+		{[]string{"--max-amount", "0"}, "--max-amount must be at least 0.01"},
+		{[]string{"extra"}, "unexpected arguments"},
+		{[]string{"--verbose"}, "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		if code, _, stderr := ledgerBench(nil, tt.args...); code != 2 || !strings.Contains(stderr, tt.expectedStderr) {
+			t.Errorf("expected exit code 2 with %q for %q, got %d %q", tt.expectedStderr, tt.args, code, stderr)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+	"tiny-ledger/pkg/client"
+)
+
+// errRejected is an operation the ledger refused by its rules, e.g. a withdrawal over the balance. it's a correct
+// answer, counted apart from the errors
+var errRejected = errors.New("rejected")
+
+// errUnknownOutcome is a failed write that may have been recorded anyway, e.g. a timeout. its user can't be checked
+var errUnknownOutcome = errors.New("unknown outcome")
+
+// target is what the workers run the operations against. a write returns the amount it moved the balance by,
+// a withdrawal with its fee
+type target interface {
+	deposit(ctx context.Context, userID string, amount float64, description string) (float64, error)
+	withdraw(ctx context.Context, userID string, amount float64, description string) (float64, error)
+	balance(ctx context.Context, userID string) (float64, error)
+	history(ctx context.Context, userID string) error
+}
+
+// httpTarget is a ledger server through the Go client
+type httpTarget struct {
+	client *client.Client
+}
+
+func (t httpTarget) deposit(ctx context.Context, userID string, amount float64, description string) (float64, error) {
+	tx, err := t.client.RecordTransaction(ctx, userID, client.TransactionInput{Type: client.Deposit, Amount: amount, Description: description})
+	return tx.Amount, t.classify(err)
+}
+
+func (t httpTarget) withdraw(ctx context.Context, userID string, amount float64, description string) (float64, error) {
+	tx, err := t.client.RecordTransaction(ctx, userID, client.TransactionInput{Type: client.Withdrawal, Amount: amount, Description: description})
+	return -tx.Amount - tx.Fee, t.classify(err)
+}
+
+func (t httpTarget) balance(ctx context.Context, userID string) (float64, error) {
+	balance, err := t.client.GetBalance(ctx, userID)
+	return balance.Balance, t.classify(err)
+}
+
+func (t httpTarget) history(ctx context.Context, userID string) error {
+	_, err := t.client.ListTransactions(ctx, userID, client.ListOptions{Descending: true, Limit: 20})
+	return t.classify(err)
+}
+
+func (httpTarget) classify(err error) error {
+	var apiErr *client.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, client.ErrInsufficientFunds) || errors.Is(err, client.ErrMinimumBalance):
+		return fmt.Errorf("%w: %v", errRejected, err)
+	case !errors.As(err, &apiErr) || apiErr.Temporary():
+		return fmt.Errorf("%w: %v", errUnknownOutcome, err)
+	}
+	return err
+}
+
+// storeTarget is the service and the store in-process, no network or HTTP stack in the numbers
+type storeTarget struct {
+	svc services.LedgerService
+}
+
+func newStoreTarget() storeTarget {
+	return storeTarget{svc: services.NewLedgerService(store.NewLedgerStore())}
+}
+
+func (t storeTarget) deposit(ctx context.Context, userID string, amount float64, description string) (float64, error) {
+	tx, err := t.svc.WithContext(ctx).RecordTransaction(userID, models.Deposit, amount, description)
+	return tx.Amount, t.classify(err)
+}
+
+func (t storeTarget) withdraw(ctx context.Context, userID string, amount float64, description string) (float64, error) {
+	tx, err := t.svc.WithContext(ctx).RecordTransaction(userID, models.Withdrawal, amount, description)
+	return -tx.Amount - tx.Fee, t.classify(err)
+}
+
+func (t storeTarget) balance(ctx context.Context, userID string) (float64, error) {
+	return t.svc.WithContext(ctx).GetCurrentBalance(userID)
+}
+
+func (t storeTarget) history(ctx context.Context, userID string) error {
+	_, err := t.svc.WithContext(ctx).GetTransactionHistoryAfter(userID, services.HistoryFilter{Descending: true}, nil, 20)
+	return err
+}
+
+func (storeTarget) classify(err error) error {
+	if errors.Is(err, store.ErrInsufficientFunds) || errors.Is(err, store.ErrMinimumBalance) {
+		return fmt.Errorf("%w: %v", errRejected, err)
+	}
+	return err
+}
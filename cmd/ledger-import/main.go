@@ -0,0 +1,241 @@
+// Command ledger-import loads historical transactions from a CSV file into the ledger:
+//
+//	ledger-import --file txns.csv [--user-column 1 --timestamp-column 2 --type-column 3 --amount-column 4
+//		--description-column 5] [--reference-prefix sheet2019] [--skip-invalid] [--dry-run]
+//
+// every row is validated first and the invalid ones are reported with their line. the rows are grouped by user and
+// sent in order of their timestamp through the batch endpoint of the server at LEDGER_URL (or --url), with the
+// bearer token LEDGER_API_KEY. with --reference-prefix every row gets a reference ID derived from its content, so
+// running the import again skips the rows it already loaded. the API has no way to backdate a transaction: the
+// server stamps the time of the import and the timestamps of the file only order the rows of each user
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"tiny-ledger/pkg/client"
+)
+
+const defaultURL = "http://localhost:8080"
+
+// maxPrefixLength leaves room for the hash of the row in the 64 characters of a reference ID
+const maxPrefixLength = 47
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdin, os.Stdout, os.Stderr))
+}
+
+type options struct {
+	file        string
+	baseURL     string
+	cols        columns
+	header      bool
+	prefix      string
+	batchSize   int
+	skipInvalid bool
+	dryRun      bool
+}
+
+// errUsage is a flag the flag package already reported
+var errUsage = errors.New("usage")
+
+func parseFlags(args []string, getenv func(string) string, stderr io.Writer) (options, error) {
+	opts := options{baseURL: getenv("LEDGER_URL")}
+	if opts.baseURL == "" {
+		opts.baseURL = defaultURL
+	}
+
+	fs := flag.NewFlagSet("ledger-import", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.file, "file", "", "CSV file of the transactions, - for stdin")
+	fs.StringVar(&opts.baseURL, "url", opts.baseURL, "base URL of the ledger server (LEDGER_URL)")
+	fs.IntVar(&opts.cols.user, "user-column", 1, "column of the user ID, from 1")
+	fs.IntVar(&opts.cols.timestamp, "timestamp-column", 2, "column of the timestamp")
+	fs.IntVar(&opts.cols.txType, "type-column", 3, "column of the type, deposit or withdrawal")
+	fs.IntVar(&opts.cols.amount, "amount-column", 4, "column of the amount")
+	fs.IntVar(&opts.cols.description, "description-column", 5, "column of the description, 0 when there is none")
+	fs.BoolVar(&opts.header, "header", true, "the first row is a header")
+	fs.StringVar(&opts.prefix, "reference-prefix", "", "prefix of the reference IDs, makes the import restartable")
+	fs.IntVar(&opts.batchSize, "batch-size", 100, "transactions per request, at most the batch size of the server")
+	fs.BoolVar(&opts.skipInvalid, "skip-invalid", false, "import the valid rows even when some are invalid")
+	fs.BoolVar(&opts.dryRun, "dry-run", false, "only validate the file")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return opts, err
+		}
+		return opts, errUsage
+	}
+
+	switch {
+	case fs.NArg() > 0:
+		return opts, fmt.Errorf("unexpected arguments %q", fs.Args())
+	case opts.file == "":
+		return opts, errors.New("--file is required")
+	case opts.batchSize < 1:
+		return opts, errors.New("--batch-size must be positive")
+	case len(opts.prefix) > maxPrefixLength:
+		return opts, fmt.Errorf("--reference-prefix must be at most %d characters", maxPrefixLength)
+	}
+	required := []int{opts.cols.user, opts.cols.timestamp, opts.cols.txType, opts.cols.amount}
+	for _, column := range required {
+		if column < 1 {
+			return opts, errors.New("the columns start at 1")
+		}
+	}
+	if opts.cols.description < 0 {
+		return opts, errors.New("--description-column must be 0 or a column")
+	}
+	if opts.cols.description > 0 {
+		required = append(required, opts.cols.description)
+	}
+	slices.Sort(required)
+	if len(slices.Compact(required)) != len(required) {
+		return opts, errors.New("two fields can't share a column")
+	}
+	return opts, nil
+}
+
+func run(args []string, getenv func(string) string, stdin io.Reader, stdout, stderr io.Writer) int {
+	opts, err := parseFlags(args, getenv, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(stderr, "ledger-import: "+err.Error())
+		}
+		return 2
+	}
+
+	input := stdin
+	if opts.file != "-" {
+		f, err := os.Open(opts.file)
+		if err != nil {
+			fmt.Fprintln(stderr, "ledger-import: "+err.Error())
+			return 1
+		}
+		defer f.Close()
+		input = f
+	}
+	rows, invalid, duplicates, err := readRows(input, opts.cols, opts.header)
+	if err != nil {
+		fmt.Fprintf(stderr, "ledger-import: reading %s: %v\n", opts.file, err)
+		return 1
+	}
+	for _, rowErr := range invalid {
+		fmt.Fprintln(stderr, "ledger-import: "+rowErr.Error())
+	}
+	for _, rowErr := range duplicates {
+		fmt.Fprintf(stderr, "ledger-import: %v, skipped\n", rowErr)
+	}
+	if len(invalid) > 0 && !opts.skipInvalid {
+		fmt.Fprintf(stderr, "ledger-import: %d invalid rows, nothing was imported (--skip-invalid imports the others)\n", len(invalid))
+		return 1
+	}
+
+	users, byUser := groupByUser(rows)
+	if opts.dryRun {
+		fmt.Fprintf(stdout, "%d valid rows of %d users, %d invalid, %d duplicates\n", len(rows), len(users), len(invalid), len(duplicates))
+		return 0
+	}
+	if opts.prefix == "" {
+		fmt.Fprintln(stderr, "ledger-import: no --reference-prefix, running the import again would import the rows twice")
+	}
+
+	c, err := client.New(opts.baseURL, client.WithAPIKey(getenv("LEDGER_API_KEY")))
+	if err != nil {
+		fmt.Fprintln(stderr, "ledger-import: "+err.Error())
+		return 2
+	}
+
+	ctx := context.Background()
+	var imported, skipped, failedUsers int
+	for _, userID := range users {
+		loaded, already, err := importUser(ctx, c, userID, byUser[userID], opts)
+		imported += loaded
+		skipped += already
+		if err != nil {
+			failedUsers++
+			fmt.Fprintf(stderr, "ledger-import: %s: %v, %d of its %d rows are in the ledger\n", userID, err, loaded+already, len(byUser[userID]))
+		}
+	}
+
+	fmt.Fprintf(stdout, "imported %d rows of %d users, %d already imported, %d invalid, %d duplicates\n",
+		imported, len(users), skipped, len(invalid), len(duplicates))
+	if failedUsers > 0 {
+		fmt.Fprintf(stderr, "ledger-import: the import of %d users stopped early\n", failedUsers)
+		return 1
+	}
+	return 0
+}
+
+// groupByUser splits the rows by user in order of the user's first row, each user's rows in order of their timestamp
+// so the balance builds up like it did
+func groupByUser(rows []row) ([]string, map[string][]row) {
+	var users []string
+	byUser := make(map[string][]row)
+	for _, r := range rows {
+		if _, known := byUser[r.userID]; !known {
+			users = append(users, r.userID)
+		}
+		byUser[r.userID] = append(byUser[r.userID], r)
+	}
+	for _, userRows := range byUser {
+		slices.SortStableFunc(userRows, func(a, b row) int {
+			return a.timestamp.Compare(b.timestamp)
+		})
+	}
+	return users, byUser
+}
+
+// importUser sends the rows of the user in batches, skipping the rows a previous run imported when there's a
+// prefix. a rejected batch stops the user there, the rows after it may depend on it
+func importUser(ctx context.Context, c *client.Client, userID string, rows []row, opts options) (imported, skipped int, err error) {
+	if opts.prefix != "" {
+		done := make(map[string]bool)
+		for tx, err := range c.AllTransactions(ctx, userID, client.ListOptions{Limit: 100}) {
+			if err != nil {
+				return 0, 0, err
+			}
+			if strings.HasPrefix(tx.ReferenceID, opts.prefix+"-") {
+				done[tx.ReferenceID] = true
+			}
+		}
+		pending := make([]row, 0, len(rows))
+		for _, r := range rows {
+			if !done[r.reference(opts.prefix)] {
+				pending = append(pending, r)
+			}
+		}
+		skipped, rows = len(rows)-len(pending), pending
+	}
+
+	for start := 0; start < len(rows); start += opts.batchSize {
+		batch := rows[start:min(start+opts.batchSize, len(rows))]
+		inputs := make([]client.TransactionInput, len(batch))
+		for i, r := range batch {
+			inputs[i] = client.TransactionInput{Type: r.txType, Amount: r.amount, Description: r.description}
+			if opts.prefix != "" {
+				inputs[i].ReferenceID = r.reference(opts.prefix)
+			}
+		}
+
+		if _, err := c.RecordBatch(ctx, userID, inputs); err != nil {
+			var apiErr *client.Error
+			if errors.As(err, &apiErr) && len(apiErr.Items) > 0 && apiErr.Items[0].Index < len(batch) {
+				item := apiErr.Items[0]
+				return imported, skipped, fmt.Errorf("line %d: %s: %s", batch[item.Index].line, item.Code, item.Message)
+			}
+			return imported, skipped, err
+		}
+		imported += len(batch)
+	}
+	return imported, skipped, nil
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+	"tiny-ledger/pkg/client"
+
+	"github.com/gorilla/mux"
+)
+
+// newServer serves the real ledger API, the importer and the test act as an admin
+func newServer(t *testing.T) (*httptest.Server, *client.Client) {
+	t.Helper()
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	router := mux.NewRouter()
+	router.Use(handlers.RequestIDMiddleware)
+	handlers.NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		handlers.WithAuth(verifier)).RegisterRoutes(router, handlers.APIPrefix)
+
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	c, err := client.New(ts.URL, client.WithAPIKey(adminToken))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return ts, c
+}
+
+var adminToken = authtest.Token(authtest.Secret, "importer", auth.ScopeAdmin)
+
+func ledgerImport(ts *httptest.Server, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	env := map[string]string{"LEDGER_URL": ts.URL, "LEDGER_API_KEY": adminToken}
+	code := run(args, func(key string) string { return env[key] }, strings.NewReader(""), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func expectBalances(t *testing.T, c *client.Client, expected map[string]float64) {
+	t.Helper()
+	for userID, amount := range expected {
+		balance, err := c.GetBalance(context.Background(), userID)
+		if err != nil || balance.Balance != amount {
+			t.Errorf("expected %s to have %v, got %v %v", userID, amount, balance.Balance, err)
+		}
+	}
+}
+
+func TestImportReportsTheInvalidRows(t *testing.T) {
+	ts, c := newServer(t)
+
+	code, stdout, stderr := ledgerImport(ts, "--file", "testdata/txns.csv")
+	if code != 1 || stdout != "" {
+		t.Errorf("expected exit code 1 and no summary, got %d %q", code, stdout)
+	}
+	for _, expected := range []string{
+		"line 7: duplicate of line 3, skipped",
+		`line 8: invalid user ID "x"`,
+		`line 9: invalid timestamp "yesterday"`,
+		`line 10: invalid type "refund"`,
+		"line 11: the amount must be positive, got -5",
+		"line 12: no amount, the row has 3 columns",
+		`line 13: bare " in non-quoted-field`,
+		"6 invalid rows, nothing was imported",
+	} {
+		if !strings.Contains(stderr, expected) {
+			t.Errorf("expected %q in:\n%s", expected, stderr)
+		}
+	}
+	expectBalances(t, c, map[string]float64{"alice": 0, "bob": 0, "carol": 0})
+
+	code, stdout, _ = ledgerImport(ts, "--file", "testdata/txns.csv", "--skip-invalid", "--dry-run")
+	if code != 0 || stdout != "5 valid rows of 3 users, 6 invalid, 1 duplicates\n" {
+		t.Errorf("unexpected dry run %d %q", code, stdout)
+	}
+}
+
+func TestImportIsRestartable(t *testing.T) {
+	ts, c := newServer(t)
+
+	code, stdout, stderr := ledgerImport(ts, "--file", "testdata/txns.csv", "--skip-invalid", "--reference-prefix", "sheet", "--batch-size", "2")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	if stdout != "imported 5 rows of 3 users, 0 already imported, 6 invalid, 1 duplicates\n" {
+		t.Errorf("unexpected summary %q", stdout)
+	}
+	// the gift of the 4th comes before the opening balance of the 5th
+	page, _ := c.ListTransactions(context.Background(), "alice", client.ListOptions{})
+	if len(page.Transactions) != 3 || page.Transactions[0].Description != "earlier gift" || !strings.HasPrefix(page.Transactions[0].ReferenceID, "sheet-") {
+		t.Errorf("expected alice's rows in order of their timestamp, got %+v", page.Transactions)
+	}
+	expectBalances(t, c, map[string]float64{"alice": 94.5, "bob": 50, "carol": 10})
+
+	code, stdout, _ = ledgerImport(ts, "--file", "testdata/txns.csv", "--skip-invalid", "--reference-prefix", "sheet")
+	if code != 0 || stdout != "imported 0 rows of 3 users, 5 already imported, 6 invalid, 1 duplicates\n" {
+		t.Errorf("expected nothing imported the second time, got %d %q", code, stdout)
+	}
+	expectBalances(t, c, map[string]float64{"alice": 94.5, "bob": 50, "carol": 10})
+}
+
+func TestImportStopsAUserAtARejectedRow(t *testing.T) {
+	ts, c := newServer(t)
+	file := filepath.Join(t.TempDir(), "txns.csv")
+	os.WriteFile(file, []byte("dave,2020-01-01,deposit,10\n"+
+		"erin,2020-01-01,deposit,20\n"+
+		"dave,2020-01-02,withdrawal,15\n"+
+		"dave,2020-01-03,deposit,100\n"), 0o600)
+
+	code, stdout, stderr := ledgerImport(ts, "--file", file, "--header=false", "--description-column", "0", "--batch-size", "1", "--reference-prefix", "q1")
+	if code != 1 {
+		t.Errorf("expected exit code 1, got %d", code)
+	}
+	if !strings.Contains(stderr, "dave: line 3: INSUFFICIENT_FUNDS: insufficient funds, 1 of its 3 rows are in the ledger") {
+		t.Errorf("expected the rejected row of dave, got:\n%s", stderr)
+	}
+	if stdout != "imported 2 rows of 2 users, 0 already imported, 0 invalid, 0 duplicates\n" {
+		t.Errorf("unexpected summary %q", stdout)
+	}
+	expectBalances(t, c, map[string]float64{"dave": 10, "erin": 20})
+}
+
+func TestImportArguments(t *testing.T) {
+	ts, _ := newServer(t)
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{"no file", nil, 2, "--file is required"},
+		{"missing file", []string{"--file", "missing.csv"}, 1, "no such file or directory"},
+		{"shared column", []string{"--file", "testdata/txns.csv", "--amount-column", "1"}, 2, "two fields can't share a column"},
+		{"column 0", []string{"--file", "testdata/txns.csv", "--user-column", "0"}, 2, "the columns start at 1"},
+		{"long prefix", []string{"--file", "testdata/txns.csv", "--reference-prefix", strings.Repeat("p", 48)}, 2, "at most 47 characters"},
+		{"unknown flag", []string{"--file", "testdata/txns.csv", "--verbose"}, 2, "flag provided but not defined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := ledgerImport(ts, tt.args...)
+			if code != tt.expectedCode || !strings.Contains(stderr, tt.expectedStderr) {
+				t.Errorf("expected exit code %d with %q, got %d %q", tt.expectedCode, tt.expectedStderr, code, stderr)
+			}
+		})
+	}
+}
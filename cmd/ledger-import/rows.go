@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"tiny-ledger/pkg/client"
+)
+
+// row is a valid transaction of the file, line is where it starts for the reports
+type row struct {
+	line        int
+	userID      string
+	timestamp   time.Time
+	txType      string
+	amount      float64
+	description string
+}
+
+// columns are the 1-based positions of the fields, description is 0 when the file has none
+type columns struct {
+	user, timestamp, txType, amount, description int
+}
+
+// lineError is a row of the file that can't be imported
+type lineError struct {
+	line int
+	msg  string
+}
+
+func (e *lineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+// the user IDs the server accepts
+var userIDPattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,50}$`)
+
+// timestamp layouts of the spreadsheets, without a zone they're UTC
+var timestampLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"}
+
+// readRows reads every row of the file: the valid ones, the invalid ones as *lineError and the exact repeats of an
+// earlier row, which are left out of rows. err is a failure to read the file at all
+func readRows(r io.Reader, cols columns, header bool) (rows []row, invalid, duplicates []*lineError, err error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	seen := make(map[string]int)
+	for first := true; ; first = false {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return rows, invalid, duplicates, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			invalid = append(invalid, &lineError{line: parseErr.StartLine, msg: parseErr.Err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		if first && header {
+			continue
+		}
+
+		parsed, rowErr := parseRow(line, record, cols)
+		if rowErr != nil {
+			invalid = append(invalid, rowErr)
+			continue
+		}
+		key := parsed.key()
+		if original, repeated := seen[key]; repeated {
+			duplicates = append(duplicates, &lineError{line: line, msg: fmt.Sprintf("duplicate of line %d", original)})
+			continue
+		}
+		seen[key] = line
+		rows = append(rows, parsed)
+	}
+}
+
+// parseRow validates the fields of a record, every problem of the row is in the error
+func parseRow(line int, record []string, cols columns) (row, *lineError) {
+	var problems []string
+	// field is a required field, a missing or an empty one is a problem
+	field := func(name string, column int) string {
+		if column > len(record) {
+			problems = append(problems, fmt.Sprintf("no %s, the row has %d columns", name, len(record)))
+			return ""
+		}
+		value := strings.TrimSpace(record[column-1])
+		if value == "" {
+			problems = append(problems, "the "+name+" is empty")
+		}
+		return value
+	}
+
+	parsed := row{line: line}
+	parsed.userID = field("user", cols.user)
+	if parsed.userID != "" && !userIDPattern.MatchString(parsed.userID) {
+		problems = append(problems, fmt.Sprintf("invalid user ID %q", parsed.userID))
+	}
+
+	if raw := field("timestamp", cols.timestamp); raw != "" {
+		timestamp, err := parseTimestamp(raw)
+		if err != nil {
+			problems = append(problems, err.Error())
+		}
+		parsed.timestamp = timestamp
+	}
+
+	if raw := field("type", cols.txType); raw != "" {
+		parsed.txType = strings.ToLower(raw)
+		if parsed.txType != client.Deposit && parsed.txType != client.Withdrawal {
+			problems = append(problems, fmt.Sprintf("invalid type %q, expected deposit or withdrawal", raw))
+		}
+	}
+
+	if raw := field("amount", cols.amount); raw != "" {
+		amount, err := strconv.ParseFloat(raw, 64)
+		switch {
+		case err != nil || math.IsInf(amount, 0) || math.IsNaN(amount):
+			problems = append(problems, fmt.Sprintf("invalid amount %q", raw))
+		case amount <= 0:
+			problems = append(problems, fmt.Sprintf("the amount must be positive, got %s", raw))
+		}
+		parsed.amount = amount
+	}
+
+	if cols.description > 0 && cols.description <= len(record) {
+		parsed.description = strings.TrimSpace(record[cols.description-1])
+	}
+
+	if len(problems) > 0 {
+		return row{}, &lineError{line: line, msg: strings.Join(problems, "; ")}
+	}
+	return parsed, nil
+}
+
+func parseTimestamp(raw string) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if timestamp, err := time.Parse(layout, raw); err == nil {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339 or 2006-01-02 15:04:05", raw)
+}
+
+// key is what makes two rows the same transaction
+func (r row) key() string {
+	return strings.Join([]string{r.userID, r.timestamp.UTC().Format(time.RFC3339Nano), r.txType,
+		strconv.FormatFloat(r.amount, 'f', -1, 64), r.description}, "\x1f")
+}
+
+// reference is the reference ID of the row under prefix. it's derived from the content of the row rather than its
+// line, so the file can be fixed up and imported again without importing a row twice
+func (r row) reference(prefix string) string {
+	sum := sha256.Sum256([]byte(r.key()))
+	return prefix + "-" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRow(t *testing.T) {
+	cols := columns{user: 1, timestamp: 2, txType: 3, amount: 4, description: 5}
+
+	tests := []struct {
+		name     string
+		record   []string
+		expected row
+		problems string
+	}{
+		{
+			name:     "RFC 3339",
+			record:   []string{"alice", "2019-01-05T09:00:00+02:00", "deposit", "100", "salary"},
+			expected: row{line: 2, userID: "alice", timestamp: time.Date(2019, 1, 5, 7, 0, 0, 0, time.UTC), txType: "deposit", amount: 100, description: "salary"},
+		},
+		{
+			name:     "date and upper case type",
+			record:   []string{" alice ", "2019-01-05", "WITHDRAWAL", "2.50"},
+			expected: row{line: 2, userID: "alice", timestamp: time.Date(2019, 1, 5, 0, 0, 0, 0, time.UTC), txType: "withdrawal", amount: 2.5},
+		},
+		{
+			name:     "every problem at once",
+			record:   []string{"", "05/01/2019", "bonus", "NaN", "x"},
+			problems: `the user is empty; invalid timestamp "05/01/2019", expected RFC 3339 or 2006-01-02 15:04:05; invalid type "bonus", expected deposit or withdrawal; invalid amount "NaN"`,
+		},
+		{
+			name:     "empty fields",
+			record:   []string{"alice", "", "deposit", "0"},
+			problems: "the timestamp is empty; the amount must be positive, got 0",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseRow(2, tt.record, cols)
+			if tt.problems != "" {
+				if err == nil || err.Error() != "line 2: "+tt.problems {
+					t.Errorf("expected %q, got %v", tt.problems, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !parsed.timestamp.Equal(tt.expected.timestamp) {
+				t.Errorf("expected %v, got %v", tt.expected.timestamp, parsed.timestamp)
+			}
+			parsed.timestamp, tt.expected.timestamp = time.Time{}, time.Time{}
+			if parsed != tt.expected {
+				t.Errorf("expected %+v, got %+v", tt.expected, parsed)
+			}
+		})
+	}
+}
+
+func TestReadRowsWithOtherColumns(t *testing.T) {
+	file := "amount;user;type;when\n" +
+		"10;alice;deposit;2019-01-05\n" +
+		"5;bob;deposit;2019-01-06\n"
+	// semicolons aren't the separator, so every record is a single column
+	_, invalid, _, err := readRows(strings.NewReader(file), columns{user: 2, timestamp: 4, txType: 3, amount: 1}, true)
+	if err != nil || len(invalid) != 2 || !strings.Contains(invalid[0].Error(), "line 2: no user, the row has 1 columns") {
+		t.Errorf("expected the rows to be missing columns, got %v %v", invalid, err)
+	}
+
+	file = strings.ReplaceAll(file, ";", ",")
+	rows, invalid, _, err := readRows(strings.NewReader(file), columns{user: 2, timestamp: 4, txType: 3, amount: 1}, true)
+	if err != nil || len(invalid) != 0 || len(rows) != 2 || rows[1].userID != "bob" || rows[1].amount != 5 || rows[1].line != 3 {
+		t.Errorf("unexpected rows %+v %v %v", rows, invalid, err)
+	}
+}
+
+func TestReference(t *testing.T) {
+	r := row{userID: "alice", timestamp: time.Date(2019, 1, 5, 0, 0, 0, 0, time.UTC), txType: "deposit", amount: 10, line: 2}
+	moved := r
+	moved.line = 40
+	other := r
+	other.amount = 11
+
+	if ref := r.reference("sheet"); !strings.HasPrefix(ref, "sheet-") || len(ref) != len("sheet-")+16 {
+		t.Errorf("unexpected reference %q", ref)
+	}
+	if r.reference("sheet") != moved.reference("sheet") {
+		t.Errorf("expected the reference not to depend on the line")
+	}
+	if r.reference("sheet") == other.reference("sheet") {
+		t.Errorf("expected another amount to be another reference")
+	}
+}
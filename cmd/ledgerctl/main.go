@@ -0,0 +1,320 @@
+// Command ledgerctl is the command-line client of the ledger API, for developers and support staff:
+//
+//	ledgerctl deposit <user> <amount> [-d description]
+//	ledgerctl withdraw <user> <amount> [-d description]
+//	ledgerctl balance <user>
+//	ledgerctl history <user> [--since 7d] [--limit 20] [--format table|json|csv]
+//	ledgerctl transfer <from> <to> <amount> [-d description]
+//
+// the server is LEDGER_URL (or --url) and LEDGER_API_KEY its bearer token, kept out of the flags so it doesn't land
+// in the shell history. a failed request exits 1 with the error of the server, a wrong command line exits 2
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"tiny-ledger/pkg/client"
+)
+
+const defaultURL = "http://localhost:8080"
+
+// output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+	formatCSV   = "csv"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdout, os.Stderr))
+}
+
+// errUsage is a wrong command line, its message is already printed with the usage
+var errUsage = errors.New("usage")
+
+// command is one subcommand, args are its positional arguments once the flags are parsed
+type command struct {
+	usage string
+	args  int
+	flags func(fs *flag.FlagSet, opts *options)
+	run   func(ctx context.Context, c *client.Client, args []string, opts *options, stdout io.Writer) error
+}
+
+// options are the flags of the subcommands, each registers the ones it takes
+type options struct {
+	description string
+	since       string
+	limit       int
+	format      string
+}
+
+func descriptionFlag(fs *flag.FlagSet, opts *options) {
+	fs.StringVar(&opts.description, "d", "", "description of the transaction")
+}
+
+var commands = map[string]command{
+	"deposit": {
+		usage: "deposit <user> <amount> [-d description]", args: 2, flags: withFormat(descriptionFlag),
+		run: func(ctx context.Context, c *client.Client, args []string, opts *options, stdout io.Writer) error {
+			return record(ctx, c, client.Deposit, args, opts, stdout)
+		},
+	},
+	"withdraw": {
+		usage: "withdraw <user> <amount> [-d description]", args: 2, flags: withFormat(descriptionFlag),
+		run: func(ctx context.Context, c *client.Client, args []string, opts *options, stdout io.Writer) error {
+			return record(ctx, c, client.Withdrawal, args, opts, stdout)
+		},
+	},
+	"balance": {
+		usage: "balance <user>", args: 1, flags: withFormat(nil),
+		run: func(ctx context.Context, c *client.Client, args []string, opts *options, stdout io.Writer) error {
+			balance, err := c.GetBalance(ctx, args[0])
+			if err != nil || opts.format == formatJSON {
+				return writeJSON(stdout, balance, err)
+			}
+			return writeTable(stdout, []string{"USER", "BALANCE", "AVAILABLE", "CURRENCY", "AS OF"},
+				[][]string{{args[0], amount(balance.Balance), amount(balance.AvailableBalance), balance.Currency, timestamp(balance.AsOf)}})
+		},
+	},
+	"history": {
+		usage: "history <user> [--since 7d] [--limit 20] [--format table|json|csv]", args: 1,
+		flags: withFormat(func(fs *flag.FlagSet, opts *options) {
+			fs.StringVar(&opts.since, "since", "", "only the transactions of this window up to now, e.g. 7d, 36h")
+			fs.IntVar(&opts.limit, "limit", 20, "most recent transactions to show")
+		}),
+		run: history,
+	},
+	"transfer": {
+		usage: "transfer <from> <to> <amount> [-d description]", args: 3, flags: withFormat(descriptionFlag),
+		run: func(ctx context.Context, c *client.Client, args []string, opts *options, stdout io.Writer) error {
+			value, err := parseAmount(args[2])
+			if err != nil {
+				return err
+			}
+			transfer, err := c.Transfer(ctx, args[0], client.TransferInput{ToUserID: args[1], Amount: value, Description: opts.description})
+			if err != nil || opts.format == formatJSON {
+				return writeJSON(stdout, transfer, err)
+			}
+			return writeTable(stdout, []string{"TRANSFER", "FROM", "TO", "AMOUNT", "SENDER BALANCE"},
+				[][]string{{transfer.TransferID.String(), args[0], args[1], amount(transfer.Debit.Amount), amount(transfer.Balance)}})
+		},
+	},
+}
+
+// withFormat adds --format to the flags of a command
+func withFormat(flags func(fs *flag.FlagSet, opts *options)) func(fs *flag.FlagSet, opts *options) {
+	return func(fs *flag.FlagSet, opts *options) {
+		fs.StringVar(&opts.format, "format", formatTable, "output format: table or json (history: csv too)")
+		if flags != nil {
+			flags(fs, opts)
+		}
+	}
+}
+
+func run(args []string, getenv func(string) string, stdout, stderr io.Writer) int {
+	global := flag.NewFlagSet("ledgerctl", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	baseURL := getenv("LEDGER_URL")
+	if baseURL == "" {
+		baseURL = defaultURL
+	}
+	global.StringVar(&baseURL, "url", baseURL, "base URL of the ledger server (LEDGER_URL)")
+	timeout := global.Duration("timeout", 30*time.Second, "timeout of the whole command")
+	global.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ledgerctl [--url URL] [--timeout 30s] <command>")
+		for _, name := range []string{"deposit", "withdraw", "balance", "history", "transfer"} {
+			fmt.Fprintln(stderr, "  ledgerctl "+commands[name].usage)
+		}
+	}
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if global.NArg() == 0 {
+		global.Usage()
+		return 2
+	}
+
+	name := global.Arg(0)
+	cmd, known := commands[name]
+	if !known {
+		fmt.Fprintf(stderr, "ledgerctl: unknown command %q\n", name)
+		global.Usage()
+		return 2
+	}
+
+	opts := &options{}
+	fs := flag.NewFlagSet("ledgerctl "+name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: ledgerctl "+cmd.usage)
+		fs.PrintDefaults()
+	}
+	cmd.flags(fs, opts)
+	positional, err := parseInterspersed(fs, global.Args()[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err == nil && len(positional) != cmd.args {
+		err = fmt.Errorf("%s takes %d arguments, got %d", name, cmd.args, len(positional))
+	}
+	if err == nil && opts.format != formatTable && opts.format != formatJSON && (opts.format != formatCSV || name != "history") {
+		err = fmt.Errorf("unknown format %q", opts.format)
+	}
+	if err == nil && name == "history" && opts.limit < 1 {
+		err = errors.New("--limit must be positive")
+	}
+	if err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(stderr, "ledgerctl: "+err.Error())
+			fs.Usage()
+		}
+		return 2
+	}
+
+	c, err := client.New(baseURL, client.WithAPIKey(getenv("LEDGER_API_KEY")), client.WithTimeout(0))
+	if err != nil {
+		fmt.Fprintln(stderr, "ledgerctl: "+err.Error())
+		return 2
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if err := cmd.run(ctx, c, positional, opts, stdout); err != nil {
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			fmt.Fprintf(stderr, "ledgerctl: %s: %s\n", apiErr.Kind, apiErr.Message)
+			for _, field := range apiErr.Fields {
+				fmt.Fprintf(stderr, "  %s: %s\n", field.Field, field.Message)
+			}
+			return 1
+		}
+		fmt.Fprintln(stderr, "ledgerctl: "+err.Error())
+		if errors.Is(err, errInvalidAmount) {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// parseInterspersed parses the flags wherever they are among the positional arguments, which it returns, so
+// "deposit alice 10 -d rent" works like "deposit -d rent alice 10"
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage // the flag package printed it
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+var errInvalidAmount = errors.New("the amount must be a number")
+
+func parseAmount(raw string) (float64, error) {
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w, got %q", errInvalidAmount, raw)
+	}
+	return value, nil
+}
+
+func record(ctx context.Context, c *client.Client, txType string, args []string, opts *options, stdout io.Writer) error {
+	value, err := parseAmount(args[1])
+	if err != nil {
+		return err
+	}
+	tx, err := c.RecordTransaction(ctx, args[0], client.TransactionInput{Type: txType, Amount: value, Description: opts.description})
+	if err != nil || opts.format == formatJSON {
+		return writeJSON(stdout, tx, err)
+	}
+	return writeTransactions(stdout, []client.Transaction{tx})
+}
+
+// history lists the latest transactions newest first, following the cursor until --limit of them are read
+func history(ctx context.Context, c *client.Client, args []string, opts *options, stdout io.Writer) error {
+	transactions := []client.Transaction{}
+	for tx, err := range c.AllTransactions(ctx, args[0], client.ListOptions{Last: opts.since, Descending: true, Limit: min(opts.limit, 100)}) {
+		if err != nil {
+			return err
+		}
+		transactions = append(transactions, tx)
+		if len(transactions) == opts.limit {
+			break
+		}
+	}
+
+	switch opts.format {
+	case formatJSON:
+		return writeJSON(stdout, transactions, nil)
+	case formatCSV:
+		out := csv.NewWriter(stdout)
+		out.Write([]string{"id", "timestamp", "type", "amount", "description"})
+		for _, tx := range transactions {
+			out.Write([]string{tx.ID.String(), tx.Timestamp.UTC().Format(time.RFC3339Nano), tx.Type, strconv.FormatFloat(tx.Amount, 'f', -1, 64), tx.Description})
+		}
+		out.Flush()
+		return out.Error()
+	}
+	return writeTransactions(stdout, transactions)
+}
+
+func writeTransactions(w io.Writer, transactions []client.Transaction) error {
+	rows := make([][]string, len(transactions))
+	for i, tx := range transactions {
+		rows[i] = []string{tx.ID.String(), timestamp(tx.Timestamp), tx.Type, amount(tx.Amount), tx.Description}
+	}
+	return writeTable(w, []string{"ID", "TIME", "TYPE", "AMOUNT", "DESCRIPTION"}, rows)
+}
+
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		for i, cell := range row {
+			if i > 0 {
+				fmt.Fprint(table, "\t")
+			}
+			fmt.Fprint(table, cell)
+		}
+		fmt.Fprintln(table)
+	}
+	return table.Flush()
+}
+
+// writeJSON writes v indented unless err is set, which is returned
+func writeJSON(w io.Writer, v any, err error) error {
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func amount(value float64) string {
+	return strconv.FormatFloat(value, 'f', 2, 64)
+}
+
+func timestamp(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+	"tiny-ledger/pkg/client"
+
+	"github.com/gorilla/mux"
+)
+
+// newServer serves the real ledger API with bearer token auth
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	router := mux.NewRouter()
+	router.Use(handlers.RequestIDMiddleware)
+	handlers.NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		handlers.WithAuth(verifier)).RegisterRoutes(router, handlers.APIPrefix)
+
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// ledgerctl runs the command line against the server as alice, the result is the exit code and both outputs
+func ledgerctl(ts *httptest.Server, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	env := map[string]string{"LEDGER_URL": ts.URL, "LEDGER_API_KEY": authtest.Token(authtest.Secret, "alice")}
+	code := run(args, func(key string) string { return env[key] }, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCommands(t *testing.T) {
+	ts := newServer(t)
+
+	code, stdout, stderr := ledgerctl(ts, "deposit", "alice", "100", "-d", "salary")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	if !strings.HasPrefix(stdout, "ID ") || !strings.Contains(stdout, "deposit") || !strings.Contains(stdout, "100.00") || !strings.Contains(stdout, "salary") {
+		t.Errorf("unexpected deposit table:\n%s", stdout)
+	}
+
+	// the flags go before or after the arguments
+	if code, _, stderr := ledgerctl(ts, "withdraw", "-d", "groceries", "alice", "30.5"); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+	if code, _, stderr := ledgerctl(ts, "transfer", "alice", "bob", "20", "-d", "lunch"); code != 0 {
+		t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+	}
+
+	code, stdout, _ = ledgerctl(ts, "balance", "alice", "--format", "json")
+	var balance client.Balance
+	if err := json.Unmarshal([]byte(stdout), &balance); code != 0 || err != nil || balance.Balance != 49.5 {
+		t.Errorf("expected a balance of 49.5, got %d %s", code, stdout)
+	}
+	if code, stdout, _ := ledgerctl(ts, "balance", "alice"); code != 0 || !strings.Contains(stdout, "49.50") {
+		t.Errorf("expected the balance table, got %d:\n%s", code, stdout)
+	}
+
+	code, stdout, _ = ledgerctl(ts, "history", "alice", "--since", "7d", "--format", "csv")
+	rows, err := csv.NewReader(strings.NewReader(stdout)).ReadAll()
+	if code != 0 || err != nil {
+		t.Fatalf("expected the history as CSV, got %d %v:\n%s", code, err, stdout)
+	}
+	// newest first
+	if len(rows) != 4 || rows[1][2] != "withdrawal" || rows[1][3] != "20" || rows[2][3] != "30.5" || rows[3][4] != "salary" {
+		t.Errorf("unexpected history %v", rows)
+	}
+}
+
+func TestHistoryFollowsTheCursor(t *testing.T) {
+	ts := newServer(t)
+	for i := 0; i < 5; i++ {
+		if code, _, stderr := ledgerctl(ts, "deposit", "alice", "1", "-d", "tip"); code != 0 {
+			t.Fatalf("expected exit code 0, got %d: %s", code, stderr)
+		}
+	}
+
+	code, stdout, _ := ledgerctl(ts, "history", "alice", "--limit", "4", "--format", "json")
+	var transactions []client.Transaction
+	if err := json.Unmarshal([]byte(stdout), &transactions); code != 0 || err != nil || len(transactions) != 4 {
+		t.Errorf("expected 4 transactions, got %d %s", code, stdout)
+	}
+	code, stdout, _ = ledgerctl(ts, "history", "alice")
+	if lines := strings.Split(strings.TrimSpace(stdout), "\n"); code != 0 || len(lines) != 6 {
+		t.Errorf("expected the header and 5 rows, got %d:\n%s", code, stdout)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ts := newServer(t)
+
+	tests := []struct {
+		name           string
+		args           []string
+		expectedCode   int
+		expectedStderr string
+	}{
+		{"insufficient funds", []string{"withdraw", "alice", "10"}, 1, "ledgerctl: INSUFFICIENT_FUNDS: insufficient funds"},
+		{"invalid amount", []string{"deposit", "alice", "0"}, 1, "VALIDATION_FAILED"},
+		{"other user", []string{"balance", "bob"}, 1, "ledgerctl: FORBIDDEN: token is not allowed to access this user"},
+		{"not a number", []string{"deposit", "alice", "ten"}, 2, `the amount must be a number, got "ten"`},
+		{"missing argument", []string{"deposit", "alice"}, 2, "deposit takes 2 arguments, got 1"},
+		{"unknown command", []string{"refund", "alice"}, 2, `unknown command "refund"`},
+		{"unknown format", []string{"balance", "alice", "--format", "csv"}, 2, `unknown format "csv"`},
+		{"unknown flag", []string{"balance", "alice", "--verbose"}, 2, "flag provided but not defined"},
+		{"no command", nil, 2, "usage: ledgerctl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, stdout, stderr := ledgerctl(ts, tt.args...)
+			if code != tt.expectedCode {
+				t.Errorf("expected exit code %d, got %d", tt.expectedCode, code)
+			}
+			if !strings.Contains(stderr, tt.expectedStderr) {
+				t.Errorf("expected %q in the error, got %q", tt.expectedStderr, stderr)
+			}
+			if stdout != "" {
+				t.Errorf("expected nothing on stdout, got %q", stdout)
+			}
+		})
+	}
+
+	// an unreachable server
+	ts.Close()
+	if code, _, stderr := ledgerctl(ts, "balance", "alice"); code != 1 || !strings.Contains(stderr, "connection refused") {
+		t.Errorf("expected exit code 1 with the connection error, got %d %q", code, stderr)
+	}
+}
@@ -1,25 +1,641 @@
 package main
 
 import (
-	"github.com/gorilla/mux"
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	_ "time/tzdata" // the image has no zoneinfo, the tz of the history filters needs the IANA database
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/buildinfo"
+	"tiny-ledger/internal/config"
+	"tiny-ledger/internal/embedding"
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/eventbus"
+	"tiny-ledger/internal/fixtures"
+	"tiny-ledger/internal/grpcserver"
 	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/metrics"
+	"tiny-ledger/internal/outbox"
+	"tiny-ledger/internal/ratelimit"
 	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/signing"
 	"tiny-ledger/internal/store"
+	"tiny-ledger/internal/tlsconfig"
+	"tiny-ledger/internal/webhook"
+	"tiny-ledger/pkg/ledger"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+	"google.golang.org/grpc"
 )
 
 func main() {
-	ledgerStore := store.NewLedgerStore()
-	ledgerService := services.NewLedgerService(ledgerStore)
-	ledgerHandler := handlers.NewLedgerHandler(ledgerService)
+	os.Exit(run(os.Args[1:], os.Getenv, os.Stdout, os.Stderr))
+}
+
+// run serves until SIGINT or SIGTERM and then drains, the result is the exit code: 0 after a clean shutdown, 1 when
+// a server failed or the drain timed out and 2 for an invalid configuration
+func run(args []string, getenv func(string) string, stdout, stderr io.Writer) int {
+	build := buildinfo.Get()
+	cfg, err := config.Load(args, getenv, stderr)
+	if errors.Is(err, config.ErrVersion) {
+		fmt.Fprintln(stdout, build)
+		return 0
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		slog.New(slog.NewTextHandler(stderr, nil)).Error("invalid configuration", "error", err)
+		return 2
+	}
+
+	// the level is a var so a reload of the config can change it
+	logLevel := new(slog.LevelVar)
+	logLevel.Set(cfg.LogLevel)
+	logger := slog.New(slog.NewJSONHandler(stdout, &slog.HandlerOptions{Level: logLevel}))
+	slog.SetDefault(logger)
+	logger.Info("configuration", "config", cfg)
+
+	tracerProvider, err := newTracerProvider(cfg.OTLPEndpoint, build.Version)
+	if err != nil {
+		logger.Error("invalid tracing config", "endpoint", cfg.OTLPEndpoint, "error", err)
+		return 2
+	}
+
+	healthHandler := handlers.NewHealthHandler(build)
+
+	var metricsOpts []metrics.Option
+	var statsd *metrics.StatsD
+	switch cfg.MetricsSink {
+	case metrics.SinkStatsD:
+		statsd, err = metrics.NewStatsD(metrics.StatsDConfig{Addr: cfg.StatsDAddr, Namespace: cfg.StatsDNamespace, TagFormat: cfg.StatsDTagFormat})
+		if err != nil {
+			logger.Error("invalid statsd config", "error", err)
+			return 2
+		}
+		metricsOpts = append(metricsOpts, metrics.WithSink(statsd))
+	case metrics.SinkNone:
+		metricsOpts = append(metricsOpts, metrics.WithSink(metrics.Noop))
+	}
+
+	reporter := errreport.Noop
+	var sentry *errreport.Sentry
+	if cfg.SentryDSN != "" {
+		sentry, err = errreport.NewSentry(errreport.SentryConfig{DSN: cfg.SentryDSN, Environment: cfg.SentryEnvironment, Release: build.Version, Logger: logger})
+		if err != nil {
+			logger.Error("invalid sentry config", "error", err)
+			return 2
+		}
+		reporter = sentry
+	}
+
+	tenantList := services.ParseTenants(cfg.Tenants)
+	var ledgerStore *store.LedgerStore // of the single ledger, nil in multi-tenant mode
+	var ledgerMetrics *metrics.Metrics
+	if len(tenantList) == 0 {
+		ledgerStore = newStore(cfg)
+		ledgerMetrics = metrics.New(storeStats(ledgerStore), metricsOpts...)
+		// before the service subscribes, the fixture isn't news to the webhooks
+		if cfg.Seed != "" {
+			summary, err := seedStore(ledgerStore, cfg.Seed, cfg.SeedForce)
+			if err != nil {
+				logger.Error("could not seed the store", "file", cfg.Seed, "error", err)
+				return 2
+			}
+			logger.Info("store seeded", "file", cfg.Seed, "users", summary.Users, "transactions", summary.Transactions)
+		}
+	} else {
+		ledgerMetrics = metrics.NewMultiTenant(metricsOpts...)
+	}
+	var dispatcher *webhook.Dispatcher
+	if len(cfg.WebhookURLs) > 0 {
+		dispatcher, err = webhook.New(webhook.Config{
+			URLs:        cfg.WebhookURLs,
+			Secret:      []byte(cfg.WebhookSecret),
+			MaxAttempts: cfg.WebhookMaxAttempts,
+			Logger:      logger,
+			Metrics:     ledgerMetrics,
+		})
+		if err != nil {
+			logger.Error("invalid webhook config", "error", err)
+			return 2
+		}
+	}
+	var publisher *eventbus.Publisher
+	if cfg.EventBus != eventbus.BackendNone {
+		// config.Validate opened it once already
+		broker, _ := eventbus.Open(cfg.EventBus, cfg.EventBusURL)
+		publisher, err = eventbus.New(eventbus.Config{
+			Broker:    broker,
+			Topic:     cfg.EventBusTopic,
+			BatchSize: cfg.EventBusBatchSize,
+			Logger:    logger,
+			Metrics:   ledgerMetrics,
+		})
+		if err != nil {
+			logger.Error("invalid event bus config", "error", err)
+			return 2
+		}
+	}
+	handlerOpts := []handlers.HandlerOption{
+		handlers.WithMaxBodyBytes(cfg.MaxBodyBytes),
+		handlers.WithMaxBatchBodyBytes(cfg.MaxBatchBodyBytes),
+		handlers.WithRequestTimeout(cfg.RequestTimeout),
+		handlers.WithStrictQuery(cfg.StrictQuery, cfg.StrictLegacyQuery),
+		handlers.WithDefaultPageSize(cfg.DefaultPageSize),
+	}
+	grpcOpts := []grpcserver.Option{grpcserver.WithErrorReporter(reporter)}
+	if cfg.JWTSecret != "" || cfg.JWKSURL != "" {
+		verifier, err := auth.NewVerifier(auth.Config{HMACSecret: []byte(cfg.JWTSecret), JWKSURL: cfg.JWKSURL})
+		if err != nil {
+			logger.Error("invalid authentication config", "error", err)
+			return 2
+		}
+		handlerOpts = append(handlerOpts, handlers.WithAuth(verifier))
+		grpcOpts = append(grpcOpts, grpcserver.WithAuth(verifier))
+	} else {
+		logger.Warn("authentication is disabled, set JWT_SECRET or JWKS_URL to enable it")
+	}
+	if cfg.SigningSecrets != "" {
+		secrets, err := signing.ParseSecrets(cfg.SigningSecrets)
+		if err == nil {
+			var verifier *signing.Verifier
+			if verifier, err = signing.NewVerifier(secrets); err == nil {
+				handlerOpts = append(handlerOpts, handlers.WithSignedRequests(verifier))
+			}
+		}
+		if err != nil {
+			logger.Error("invalid signing secrets", "error", err)
+			return 2
+		}
+	}
+	if cfg.AdminAPIKey != "" || cfg.AdminPassword != "" {
+		handlerOpts = append(handlerOpts, handlers.WithAdmin(handlers.AdminCredentials{APIKey: cfg.AdminAPIKey, Username: cfg.AdminUser, Password: cfg.AdminPassword}))
+	} else {
+		logger.Info("admin routes are disabled, set ADMIN_API_KEY or ADMIN_PASSWORD to enable them")
+	}
+	if cfg.TrustForwarded {
+		handlerOpts = append(handlerOpts, handlers.WithForwardedHeaders())
+	}
+	if cfg.ClampPageSize {
+		handlerOpts = append(handlerOpts, handlers.WithPageSizeClamp())
+	}
+	if cfg.Outbox {
+		// config.Validate keeps the outbox out of the multi-tenant mode, there's a single store
+		handlerOpts = append(handlerOpts, handlers.WithOutbox(ledgerStore))
+		ledgerMetrics.RegisterOutbox(func() (int, int) {
+			stats := ledgerStore.OutboxStats()
+			return stats.Pending, stats.DeadLettered
+		})
+	}
+	if cfg.PaymentsWebhookSecret != "" {
+		handlerOpts = append(handlerOpts, handlers.WithPaymentsWebhook([]byte(cfg.PaymentsWebhookSecret)))
+	}
+	reloader := &reloader{
+		load:       func() (config.Config, error) { return config.Load(args, getenv, io.Discard) },
+		logLevel:   logLevel,
+		dispatcher: dispatcher,
+		logger:     logger,
+		cfg:        cfg,
+	}
+	handlerOpts = append(handlerOpts, handlers.WithConfigReload(reloader.Reload))
+	if cfg.RateLimit > 0 {
+		// one limiter so a user's REST and gRPC calls share the same budget
+		limiter := ratelimit.New(cfg.RateLimit, cfg.RateBurst)
+		reloader.limiter = limiter
+		handlerOpts = append(handlerOpts, handlers.WithRateLimit(limiter))
+		grpcOpts = append(grpcOpts, grpcserver.WithRateLimit(limiter))
+	}
+	// the store, the service and the handler are wired by pkg/ledger like for any embedder, the server only adds the
+	// parts that aren't public: metrics, auth and the other handler options. a tenant opened after a reload gets the
+	// reloaded limits
+	newLedger := func(ledgerStore *store.LedgerStore, serviceMetrics *metrics.Metrics, handlerOpts ...handlers.HandlerOption) (embedding.Parts, error) {
+		var parts embedding.Parts
+		current := reloader.current()
+		_, err := ledger.New(ledger.WithMaxAmount(current.MaxAmount), ledger.WithTracerProvider(tracerProvider), ledger.WithLogger(logger),
+			func(s *embedding.Settings) { s.Config.MaxBatchSize = current.MaxBatchSize },
+			embedding.WithStore(ledgerStore), embedding.WithServiceOptions(services.WithMetrics(serviceMetrics), services.WithErrorReporter(reporter)),
+			embedding.WithHandlerOptions(handlerOpts...), embedding.Into(&parts))
+		if err == nil {
+			reloader.add(parts.Service)
+		}
+		return parts, err
+	}
+
+	var ledgerService services.LedgerService
+	var ledgerHandler *handlers.LedgerHandler
+	var outboxDispatcher *outbox.Dispatcher // with -outbox
+	if ledgerStore != nil {
+		parts, err := newLedger(ledgerStore, ledgerMetrics, handlerOpts...)
+		if err != nil {
+			logger.Error("invalid ledger config", "error", err)
+			return 2
+		}
+		ledgerService, ledgerHandler = parts.Service, parts.Handler
+		if cfg.Outbox {
+			// the records reach the webhooks and the bus through the outbox of the store, which keeps them until
+			// they're taken
+			var sinks []outbox.Sink
+			if dispatcher != nil {
+				sinks = append(sinks, outbox.WebhookSink(dispatcher))
+			}
+			if publisher != nil {
+				sinks = append(sinks, outbox.BusSink(publisher))
+			}
+			outboxDispatcher = outbox.New(outbox.Config{Store: ledgerStore, Sinks: sinks, Logger: logger})
+		} else {
+			if dispatcher != nil {
+				ledgerService.Subscribe(dispatcher.Handle)
+			}
+			if publisher != nil {
+				ledgerService.Subscribe(publisher.Handle)
+			}
+		}
+	} else {
+		// every tenant gets a ledger, metrics and webhook payloads of its own on its first request, the handler of
+		// the routes picks the ledger of the tenant of the request
+		tenantRegistry, err := services.NewTenantRegistry(tenantList, func(tenant string) services.LedgerService {
+			tenantStore := newStore(cfg)
+			// ledger.New only rejects a max amount config.Validate already did
+			parts, _ := newLedger(tenantStore, ledgerMetrics.ForTenant(tenant, storeStats(tenantStore)))
+			if dispatcher != nil {
+				parts.Service.Subscribe(dispatcher.HandleTenant(tenant))
+			}
+			if publisher != nil {
+				parts.Service.Subscribe(publisher.HandleTenant(tenant))
+			}
+			return parts.Service
+		})
+		if err != nil {
+			logger.Error("invalid tenants", "tenants", cfg.Tenants, "error", err)
+			return 2
+		}
+		logger.Info("multi-tenant mode", "tenants", tenantRegistry.Tenants())
+		ledgerHandler = handlers.NewLedgerHandler(nil, logger, append(handlerOpts, handlers.WithTenants(tenantRegistry))...)
+	}
+
+	proxies, err := handlers.ParseTrustedProxies(cfg.TrustedProxies)
+	if err != nil {
+		logger.Error("invalid trusted proxies", "error", err)
+		return 2
+	}
+	var certificates *tlsconfig.Reloader // nil serves plain HTTP
+	if cfg.TLSCert != "" {
+		if certificates, err = tlsconfig.New(tlsconfig.Files{Cert: cfg.TLSCert, Key: cfg.TLSKey, ClientCA: cfg.ClientCA}); err != nil {
+			logger.Error("invalid TLS config", "error", err)
+			return 2
+		}
+	}
 
+	// recovery is innermost so the 500 it writes is logged and measured like any other response
+	middleware := []mux.MiddlewareFunc{handlers.RequestIDMiddleware, handlers.ErrorReportMiddleware(reporter), handlers.ClientIPMiddleware(proxies), handlers.ClientCertMiddleware, handlers.TracingMiddleware(tracerProvider), handlers.LoggingMiddleware(logger, cfg.SlowRequestThreshold),
+		ledgerMetrics.Middleware, handlers.RecoveryMiddleware(logger), handlers.CompressMiddleware(handlers.DefaultCompressMinSize)}
 	r := mux.NewRouter()
-	ledgerHandler.RegisterRoutes(r)
+	r.Use(middleware...)
+	// with -ops-addr the health, metrics, debug and admin routes get a listener of their own and the main one only
+	// serves the ledger API
+	ops := r
+	if cfg.OpsAddr != "" {
+		ops = mux.NewRouter()
+		ops.Use(middleware...)
+	}
+	// the gauges of a pushed sink are sent every flush, a scrape reads them otherwise
+	stopGauges := func() {}
+	if statsd != nil {
+		gaugesCtx, cancelGauges := context.WithCancel(context.Background())
+		go ledgerMetrics.PushGauges(gaugesCtx, metrics.DefaultGaugeInterval)
+		stopGauges = cancelGauges
+	}
+	ops.Handle("/metrics", ledgerMetrics.Handler()).Methods("GET")
+	healthHandler.RegisterRoutes(ops)
+	ledgerHandler.RegisterAPIRoutes(r, handlers.APIPrefix)
+	ledgerHandler.RegisterAdminRoutes(ops, handlers.APIPrefix)
+	ledgerHandler.RegisterLegacyRoutes(r, cfg.LegacySunset)
+
+	var debugServer *http.Server // of the separate debug listener
+	if cfg.DebugEndpoints {
+		if debugServer, err = serveDebug(ops, ledgerStore, cfg.DebugAddr, logger); err != nil {
+			logger.Error("could not serve the debug endpoints", "addr", cfg.DebugAddr, "error", err)
+			return 2
+		}
+	}
 
-	log.Println("Server is running on port 8080")
-	err := http.ListenAndServe(":8080", r)
+	// a server that stops on its own ends the process like a signal, with exit code 1
+	failed := make(chan error, 4)
+	var grpcServer *grpc.Server
+	if cfg.GRPCAddr != "" {
+		listener, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			logger.Error("could not listen for gRPC", "addr", cfg.GRPCAddr, "error", err)
+			return 1
+		}
+		// same service, so the same store as the REST API
+		grpcServer = grpcserver.New(ledgerService, logger, grpcOpts...)
+		go func() {
+			logger.Info("gRPC server is running", "addr", listener.Addr().String())
+			if err := grpcServer.Serve(listener); err != nil {
+				failed <- fmt.Errorf("gRPC server: %w", err)
+			}
+		}()
+	}
+
+	var opsServer *http.Server // of the ops listener, nil when the ops routes are on the main one
+	if ops != r {
+		opsListener, err := net.Listen("tcp", cfg.OpsAddr)
+		if err != nil {
+			logger.Error("could not listen for the ops routes", "addr", cfg.OpsAddr, "error", err)
+			return 1
+		}
+		// no read or write timeout, a CPU profile of the debug routes takes as long as its seconds parameter asks
+		opsServer = &http.Server{Handler: ops, ReadHeaderTimeout: cfg.ReadHeaderTimeout, IdleTimeout: cfg.IdleTimeout, MaxHeaderBytes: cfg.MaxHeaderBytes}
+		go func() {
+			logger.Info("ops server is running", "addr", opsListener.Addr().String())
+			if err := opsServer.Serve(opsListener); !errors.Is(err, http.ErrServerClosed) {
+				failed <- fmt.Errorf("ops server: %w", err)
+			}
+		}()
+	}
+
+	listener, err := net.Listen("tcp", cfg.Addr)
 	if err != nil {
-		return
+		logger.Error("could not listen", "addr", cfg.Addr, "error", err)
+		return 1
+	}
+	server := newHTTPServer(cfg, r)
+	// Shutdown doesn't wait for the hijacked websockets, they're told to go away instead of being cut
+	server.RegisterOnShutdown(ledgerHandler.CloseWebSockets)
+	serve := server.Serve
+	if certificates != nil {
+		server.TLSConfig = certificates.Config()
+		serve = func(listener net.Listener) error { return server.ServeTLS(listener, "", "") }
+	}
+
+	var plainServer *http.Server // of the plain HTTP listener of a TLS server
+	if cfg.PlainHTTPAddr != "" {
+		plainListener, err := net.Listen("tcp", cfg.PlainHTTPAddr)
+		if err != nil {
+			logger.Error("could not listen for plain HTTP", "addr", cfg.PlainHTTPAddr, "error", err)
+			return 1
+		}
+		plain := http.Handler(http.HandlerFunc(handlers.RejectPlainHTTP))
+		if cfg.PlainHTTP == config.PlainHTTPRedirect {
+			_, tlsPort, _ := net.SplitHostPort(listener.Addr().String())
+			plain = handlers.RedirectToHTTPS(tlsPort)
+		}
+		plainServer = newHTTPServer(cfg, handlers.RequestIDMiddleware(plain))
+		go func() {
+			logger.Info("plain HTTP listener is running", "addr", plainListener.Addr().String(), "policy", cfg.PlainHTTP)
+			if err := plainServer.Serve(plainListener); !errors.Is(err, http.ErrServerClosed) {
+				failed <- fmt.Errorf("plain HTTP server: %w", err)
+			}
+		}()
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	// SIGHUP reads the certificates again, e.g. after a renewal, and reloads the config
+	reloads := make(chan os.Signal, 1)
+	signal.Notify(reloads, syscall.SIGHUP)
+	defer signal.Stop(reloads)
+
+	go func() {
+		if err := serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	// the store is in memory, nothing to load before serving
+	healthHandler.SetReady(true)
+	logger.Info("server is running", "addr", listener.Addr().String(), "build", build, "tls", certificates != nil, "mutual_tls", cfg.ClientCA != "")
+
+	code := 0
+wait:
+	for {
+		select {
+		case <-reloads:
+			if certificates != nil {
+				if err := certificates.Reload(); err != nil {
+					logger.Error("could not reload the TLS certificates, serving the previous ones", "error", err)
+				} else {
+					logger.Info("TLS certificates reloaded")
+				}
+			}
+			// Reload logs how it went, a failed one keeps the running config
+			_, _ = reloader.Reload()
+		case sig := <-signals:
+			logger.Info("shutting down", "signal", sig.String(), "timeout", cfg.ShutdownTimeout)
+			break wait
+		case err := <-failed:
+			logger.Error("server failed, shutting down", "error", err)
+			code = 1
+			break wait
+		}
+	}
+
+	// the readiness probe fails first so the load balancer stops sending requests while the open ones finish
+	healthHandler.SetReady(false)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := drain(ctx, grpcServer, server, opsServer, plainServer, debugServer); err != nil {
+		logger.Error("requests still running after the shutdown timeout, closing them", "error", err)
+		code = 1
+	}
+
+	// the servers are quiet, nothing publishes anymore. what's left in the outbox of the memory store is lost
+	if outboxDispatcher != nil {
+		outboxDispatcher.Close()
+	}
+	if dispatcher != nil {
+		dispatcher.Close()
+	}
+	// the events still queued get what's left of the shutdown timeout
+	if publisher != nil {
+		if err := publisher.Close(ctx); err != nil {
+			logger.Warn("could not close the event bus", "error", err)
+		}
+	}
+	if provider, ok := tracerProvider.(interface{ Shutdown(context.Context) error }); ok {
+		if err := provider.Shutdown(ctx); err != nil {
+			logger.Warn("could not flush the traces", "error", err)
+		}
+	}
+	// the reports of the panics and 500s of the last requests get what's left of the shutdown timeout
+	if sentry != nil {
+		if err := sentry.Close(ctx); err != nil {
+			logger.Warn("could not send the error reports", "error", err)
+		}
+	}
+	if statsd != nil {
+		stopGauges()
+		statsd.Close()
+	}
+
+	logger.Info("server stopped", "exit_code", code)
+	return code
+}
+
+// drain stops accepting connections and waits for the in-flight requests and calls until ctx is done, what is still
+// running then is closed. the error is the one of server, the others are nil when they aren't running
+func drain(ctx context.Context, grpcServer *grpc.Server, server *http.Server, others ...*http.Server) error {
+	var wg sync.WaitGroup
+	if grpcServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-ctx.Done():
+				grpcServer.Stop()
+			}
+		}()
+	}
+	for _, other := range others {
+		if other == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if other.Shutdown(ctx) != nil {
+				other.Close()
+			}
+		}()
+	}
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		server.Close()
+	}
+	wg.Wait()
+	return err
+}
+
+// newHTTPServer serves handler with the timeouts and the header limit of cfg, a client that trickles its request in
+// or never sends the next one doesn't hold a connection forever. the streaming routes lift the write deadline
+func newHTTPServer(cfg config.Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+		MaxHeaderBytes:    cfg.MaxHeaderBytes,
+	}
+}
+
+// serveDebug mounts the debug routes on a listener of their own at addr, which must be a loopback address so the
+// profiles are never public by accident, and returns its server. without addr they're mounted on the ops router,
+// the main one without -ops-addr, and the server is nil
+func serveDebug(ops *mux.Router, ledgerStore *store.LedgerStore, addr string, logger *slog.Logger) (*http.Server, error) {
+	if addr == "" {
+		logger.Warn("debug endpoints are served without authentication")
+		handlers.RegisterDebugRoutes(ops, ledgerStore)
+		return nil, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("%s is not a loopback address", host)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	debug := mux.NewRouter()
+	handlers.RegisterDebugRoutes(debug, ledgerStore)
+	// no read or write timeout, a CPU profile takes as long as its seconds parameter asks
+	server := &http.Server{Handler: debug, ReadHeaderTimeout: config.DefaultReadHeaderTimeout}
+	go func() {
+		logger.Info("debug server is running", "addr", addr)
+		if err := server.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("debug server stopped", "error", err)
+		}
+	}()
+	return server, nil
+}
+
+// newTracerProvider exports the spans in batches to the OTLP endpoint, the other OTEL_EXPORTER_OTLP_* variables
+// (headers, insecure...) are read by the exporter. without an endpoint tracing is a no-op. the spans still buffered
+// are flushed on shutdown
+func newTracerProvider(endpoint, version string) (trace.TracerProvider, error) {
+	if endpoint == "" {
+		return noop.NewTracerProvider(), nil
+	}
+
+	exporter, err := otlptracegrpc.New(context.Background(), otlptracegrpc.WithEndpointURL(endpoint))
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", "tiny-ledger"),
+			attribute.String("service.version", version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider, nil
+}
+
+// newStore opens the store cfg.Store names, config.Validate only lets the known ones through
+func newStore(cfg config.Config) *store.LedgerStore {
+	var opts []store.Option
+	if cfg.Outbox {
+		opts = append(opts, store.WithOutbox())
+	}
+	switch cfg.Store {
+	case config.StoreMemory:
+		return store.NewLedgerStore(opts...)
+	}
+	panic("unknown store " + cfg.Store)
+}
+
+// seedStore loads the fixture at path into the store, which must have no users yet unless force is set. the memory
+// store is always empty at startup, force is for the stores that keep their records
+func seedStore(ledgerStore *store.LedgerStore, path string, force bool) (fixtures.Summary, error) {
+	if users := ledgerStore.Stats().Users; users > 0 && !force {
+		return fixtures.Summary{}, fmt.Errorf("the store already has %d users, set seed-force to seed it anyway", users)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fixtures.Summary{}, err
+	}
+	defer file.Close()
+	return fixtures.Load(ledgerStore, file)
+}
+
+// storeStats reports the users and the total balance of the store to the metrics
+func storeStats(ledgerStore *store.LedgerStore) metrics.StatsFunc {
+	return func() (int, float64) {
+		totals := ledgerStore.GetSystemTotals()
+		return totals.UserCount, totals.TotalBalance
 	}
 }
@@ -0,0 +1,454 @@
+//go:build unix
+
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+	"tiny-ledger/internal/buildinfo"
+	"tiny-ledger/internal/config"
+	"tiny-ledger/internal/tlsconfig/tlstest"
+)
+
+// logBuffer collects the JSON log lines of run, it's written and read concurrently
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// waitFor returns the first log line with msg, polling until the deadline
+func (b *logBuffer) waitFor(t *testing.T, msg string) map[string]any {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		b.mu.Lock()
+		lines := strings.Split(b.buf.String(), "\n")
+		b.mu.Unlock()
+		for _, line := range lines {
+			var entry map[string]any
+			if json.Unmarshal([]byte(line), &entry) == nil && entry["msg"] == msg {
+				return entry
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("no %q in the log: %s", msg, b.buf.String())
+	return nil
+}
+
+func TestRunDrainsOnSIGTERM(t *testing.T) {
+	logs := &logBuffer{}
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- run([]string{"-addr", "127.0.0.1:0", "-shutdown-timeout", "5s"}, func(string) string { return "" }, logs, io.Discard)
+	}()
+	running := logs.waitFor(t, "server is running")
+	if build, _ := running["build"].(map[string]any); build["version"] != buildinfo.Version {
+		t.Errorf("expected the build in the startup line, got %v", running)
+	}
+	base := "http://" + running["addr"].(string)
+
+	resp, err := http.Get(base + "/readyz")
+	if err != nil {
+		t.Fatalf("could not reach the server: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected the server to be ready, got %d", resp.StatusCode)
+	}
+
+	// a deposit whose body is still being sent when the signal arrives
+	body, writer := io.Pipe()
+	responses := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Post(base+"/v1/users/alice/transactions", "application/json", body)
+		if err != nil {
+			t.Errorf("the in-flight request failed: %v", err)
+			close(responses)
+			return
+		}
+		responses <- resp
+	}()
+	if _, err := writer.Write([]byte(`{"type": "deposit", `)); err != nil {
+		t.Fatalf("could not start the body: %v", err)
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("could not signal: %v", err)
+	}
+	if entry := logs.waitFor(t, "shutting down"); entry["signal"] != "terminated" {
+		t.Errorf("expected the signal to be logged, got %v", entry)
+	}
+
+	// new requests are refused, or told the server isn't ready in the instant before the listener closes
+	if resp, err := http.Get(base + "/readyz"); err == nil {
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected the draining server to refuse or be unready, got %d", resp.StatusCode)
+		}
+	}
+	_, _ = writer.Write([]byte(`"amount": 10}`))
+	writer.Close()
+	resp, ok := <-responses
+	if !ok {
+		t.FailNow()
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected the in-flight deposit to complete with 201, got %d", resp.StatusCode)
+	}
+
+	select {
+	case code := <-exitCode:
+		if code != 0 {
+			t.Errorf("expected exit code 0, got %d: %s", code, logs.buf.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run didn't return after the drain")
+	}
+	logs.waitFor(t, "server stopped")
+}
+
+func TestRunExitCodes(t *testing.T) {
+	logs := &logBuffer{}
+	if code := run([]string{"-addr", "127.0.0.1:0", "-store", "postgres"}, func(string) string { return "" }, logs, io.Discard); code != 2 {
+		t.Errorf("expected exit code 2 for an invalid configuration, got %d", code)
+	}
+
+	// the port is taken
+	first := make(chan int, 1)
+	go func() {
+		first <- run([]string{"-addr", "127.0.0.1:0"}, func(string) string { return "" }, logs, io.Discard)
+	}()
+	addr := logs.waitFor(t, "server is running")["addr"].(string)
+	if code := run([]string{"-addr", addr}, func(string) string { return "" }, &logBuffer{}, io.Discard); code != 1 {
+		t.Errorf("expected exit code 1 when the address is taken, got %d", code)
+	}
+
+	_ = syscall.Kill(syscall.Getpid(), syscall.SIGINT)
+	if code := <-first; code != 0 {
+		t.Errorf("expected exit code 0 after SIGINT, got %d", code)
+	}
+}
+
+func TestRunSeeds(t *testing.T) {
+	logs := &logBuffer{}
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- run([]string{"-addr", "127.0.0.1:0", "-seed", "../../testdata/seed.example.json"}, func(string) string { return "" }, logs, io.Discard)
+	}()
+	if seeded := logs.waitFor(t, "store seeded"); seeded["users"] != 3.0 || seeded["transactions"] != 13.0 {
+		t.Errorf("expected the summary of the fixture, got %v", seeded)
+	}
+	base := "http://" + logs.waitFor(t, "server is running")["addr"].(string)
+
+	resp, err := http.Get(base + "/v1/users/bob/balance")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var balance struct{ Balance float64 }
+	json.NewDecoder(resp.Body).Decode(&balance)
+	resp.Body.Close()
+	if balance.Balance != 1525 {
+		t.Errorf("expected the balance of the fixture, got %v", balance.Balance)
+	}
+
+	_ = syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	if code := <-exitCode; code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+
+	missing := &logBuffer{}
+	if code := run([]string{"-addr", "127.0.0.1:0", "-seed", "missing.json"}, func(string) string { return "" }, missing, io.Discard); code != 2 {
+		t.Errorf("expected exit code 2 for a missing fixture, got %d", code)
+	}
+	missing.waitFor(t, "could not seed the store")
+}
+
+func TestSlowClientHitsTheReadHeaderTimeout(t *testing.T) {
+	cfg := config.Config{ReadHeaderTimeout: 100 * time.Millisecond, MaxHeaderBytes: config.DefaultMaxHeaderBytes}
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config = newHTTPServer(cfg, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	ts.Start()
+	defer ts.Close()
+
+	// the request line and one header, then nothing
+	conn, err := net.Dial("tcp", ts.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET /healthz HTTP/1.1\r\nHost: ledger\r\n")); err != nil {
+		t.Fatalf("could not write: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	start := time.Now()
+	if read, err := io.ReadAll(conn); err != nil {
+		t.Fatalf("expected the server to close the connection, got %v after %q", err, read)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("expected the connection to be closed after the read header timeout, took %s", elapsed)
+	}
+
+	// a client that sends its headers in time is served
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("expected 204, got %d", resp.StatusCode)
+	}
+}
+
+func TestRunServesMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCA, clientCA, strangerCA := tlstest.NewCA("server CA"), tlstest.NewCA("client CA"), tlstest.NewCA("stranger CA")
+	first := serverCA.Server()
+	certFile, keyFile := tlstest.WriteFiles(dir, first)
+	caFile := filepath.Join(dir, "clients.pem")
+	if err := os.WriteFile(caFile, clientCA.PEM(), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logs := &logBuffer{}
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- run([]string{"-addr", "127.0.0.1:0", "-tls-cert", certFile, "-tls-key", keyFile, "-client-ca", caFile, "-plain-http-addr", "127.0.0.1:0"},
+			func(env string) string { return map[string]string{"ADMIN_API_KEY": "admin-key"}[env] }, logs, io.Discard)
+	}()
+	addr := logs.waitFor(t, "server is running")["addr"].(string)
+	plainAddr := logs.waitFor(t, "plain HTTP listener is running")["addr"].(string)
+	base := "https://" + addr
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{
+			Transport:     &http.Transport{TLSClientConfig: &tls.Config{RootCAs: serverCA.Pool(), Certificates: certs}},
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+	}
+	partner := client(clientCA.Client("partner-service"))
+
+	// the trusted client is served and its deposit is attributed to it
+	resp, err := partner.Post(base+"/v1/users/alice/transactions", "application/json", strings.NewReader(`{"type": "deposit", "amount": 10}`))
+	if err != nil {
+		t.Fatalf("expected the trusted client to be served, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", resp.StatusCode)
+	}
+	req, _ := http.NewRequest("GET", base+"/v1/admin/audit?userId=alice", nil)
+	req.Header.Set("X-Admin-Key", "admin-key")
+	resp, err = partner.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var audit struct {
+		Events []struct {
+			ClientCert string `json:"clientCert"`
+		} `json:"events"`
+	}
+	json.NewDecoder(resp.Body).Decode(&audit)
+	resp.Body.Close()
+	if len(audit.Events) != 1 || audit.Events[0].ClientCert != "partner-service" {
+		t.Errorf("expected the deposit attributed to partner-service, got %+v", audit)
+	}
+
+	// a certificate of another CA, or none, doesn't get through the handshake
+	for name, c := range map[string]*http.Client{"untrusted certificate": client(strangerCA.Client("partner-service")), "no certificate": client()} {
+		if resp, err := c.Get(base + "/v1/users/alice/balance"); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s: expected the handshake to fail, got %d", name, resp.StatusCode)
+		}
+	}
+
+	// plain HTTP is sent to the TLS port
+	resp, err = client().Get("http://" + plainAddr + "/v1/users/alice/balance")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	_, tlsPort, _ := net.SplitHostPort(addr)
+	if expected := "https://127.0.0.1:" + tlsPort + "/v1/users/alice/balance"; resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Location") != expected {
+		t.Errorf("expected a 308 to %s, got %d %s", expected, resp.StatusCode, resp.Header.Get("Location"))
+	}
+
+	// SIGHUP picks up a renewed certificate
+	renewed := serverCA.Server()
+	tlstest.WriteFiles(dir, renewed)
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("could not signal: %v", err)
+	}
+	logs.waitFor(t, "TLS certificates reloaded")
+	resp, err = client(clientCA.Client("partner-service")).Get(base + "/v1/users/alice/balance")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if !resp.TLS.PeerCertificates[0].Equal(renewed.Leaf) {
+		t.Error("expected the renewed certificate after SIGHUP")
+	}
+
+	_ = syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	if code := <-exitCode; code != 0 {
+		t.Errorf("expected exit code 0, got %d: %s", code, logs.buf.String())
+	}
+}
+
+func TestRunReloadsConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "ledger.env")
+	if err := os.WriteFile(configFile, []byte("MAX_AMOUNT=1000\nADMIN_API_KEY=admin-key\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	logs := &logBuffer{}
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- run([]string{"-addr", "127.0.0.1:0"}, func(env string) string { return map[string]string{"CONFIG_FILE": configFile}[env] }, logs, io.Discard)
+	}()
+	base := "http://" + logs.waitFor(t, "server is running")["addr"].(string)
+	deposit := func() int {
+		t.Helper()
+		resp, err := http.Post(base+"/v1/users/alice/transactions", "application/json", strings.NewReader(`{"type": "deposit", "amount": 500}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if code := deposit(); code != http.StatusCreated {
+		t.Fatalf("expected 201 under the max amount, got %d", code)
+	}
+
+	// SIGHUP applies the new max amount without a restart, the new page size only after one
+	if err := os.WriteFile(configFile, []byte("MAX_AMOUNT=100\nADMIN_API_KEY=admin-key\nDEFAULT_PAGE_SIZE=25\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGHUP); err != nil {
+		t.Fatalf("could not signal: %v", err)
+	}
+	reloaded := logs.waitFor(t, "config reloaded")
+	if applied, restart := fmt.Sprint(reloaded["applied"]), fmt.Sprint(reloaded["requires_restart"]); applied != "[max_amount]" || restart != "[default_page_size]" {
+		t.Errorf("expected max_amount applied and default_page_size requiring a restart, got %s and %s", applied, restart)
+	}
+	if code := deposit(); code != http.StatusBadRequest {
+		t.Errorf("expected 400 over the reloaded max amount, got %d", code)
+	}
+
+	// the admin route reloads too, an invalid config is rejected and the running one kept
+	if err := os.WriteFile(configFile, []byte("MAX_AMOUNT=-1\nADMIN_API_KEY=admin-key\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	req, _ := http.NewRequest("POST", base+"/v1/admin/config/reload", nil)
+	req.Header.Set("X-Admin-Key", "admin-key")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for an invalid config, got %d", resp.StatusCode)
+	}
+	if code := deposit(); code != http.StatusBadRequest {
+		t.Errorf("expected the max amount of the last valid config, got %d", code)
+	}
+
+	_ = syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	if code := <-exitCode; code != 0 {
+		t.Errorf("expected exit code 0, got %d: %s", code, logs.buf.String())
+	}
+}
+
+func TestRunVersion(t *testing.T) {
+	var stdout bytes.Buffer
+	if code := run([]string{"-version"}, func(string) string { return "" }, &stdout, io.Discard); code != 0 {
+		t.Errorf("expected exit code 0, got %d", code)
+	}
+	if expected := buildinfo.Get().String() + "\n"; stdout.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stdout.String())
+	}
+}
+
+func TestRunSplitsTheOpsRoutes(t *testing.T) {
+	logs := &logBuffer{}
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- run([]string{"-addr", "127.0.0.1:0", "-ops-addr", "127.0.0.1:0", "-debug-endpoints"},
+			func(env string) string { return map[string]string{"ADMIN_API_KEY": "admin-key"}[env] }, logs, io.Discard)
+	}()
+	opsBase := "http://" + logs.waitFor(t, "ops server is running")["addr"].(string)
+	base := "http://" + logs.waitFor(t, "server is running")["addr"].(string)
+
+	status := func(method, url string) int {
+		t.Helper()
+		req, _ := http.NewRequest(method, url, strings.NewReader(`{"type": "deposit", "amount": 10}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin-Key", "admin-key")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		method, path   string
+		main, opsRoute int
+	}{
+		{"POST", "/v1/users/alice/transactions", http.StatusCreated, http.StatusNotFound},
+		{"POST", "/users/alice/transactions", http.StatusCreated, http.StatusNotFound},
+		{"GET", "/openapi.json", http.StatusOK, http.StatusNotFound},
+		{"GET", "/healthz", http.StatusNotFound, http.StatusOK},
+		{"GET", "/readyz", http.StatusNotFound, http.StatusOK},
+		{"GET", "/version", http.StatusNotFound, http.StatusOK},
+		{"GET", "/metrics", http.StatusNotFound, http.StatusOK},
+		{"GET", "/debug/stats", http.StatusNotFound, http.StatusOK},
+		{"GET", "/v1/admin/users", http.StatusNotFound, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := status(tt.method, base+tt.path); got != tt.main {
+			t.Errorf("%s %s on the main listener: expected %d, got %d", tt.method, tt.path, tt.main, got)
+		}
+		if got := status(tt.method, opsBase+tt.path); got != tt.opsRoute {
+			t.Errorf("%s %s on the ops listener: expected %d, got %d", tt.method, tt.path, tt.opsRoute, got)
+		}
+	}
+
+	// both listeners are drained
+	_ = syscall.Kill(syscall.Getpid(), syscall.SIGTERM)
+	if code := <-exitCode; code != 0 {
+		t.Errorf("expected exit code 0, got %d: %s", code, logs.buf.String())
+	}
+	for _, url := range []string{base + "/v1/openapi.json", opsBase + "/healthz"} {
+		if resp, err := http.Get(url); err == nil {
+			resp.Body.Close()
+			t.Errorf("expected %s to be closed, got %d", url, resp.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"sync"
+
+	"tiny-ledger/internal/config"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/ratelimit"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/webhook"
+)
+
+// reloader loads the config again on SIGHUP or POST /admin/config/reload and applies the settings of
+// config.Reloadable to the running server, the other changes are only reported
+type reloader struct {
+	load       func() (config.Config, error)
+	logLevel   *slog.LevelVar
+	limiter    *ratelimit.Limiter  // nil without a rate limit
+	dispatcher *webhook.Dispatcher // nil without webhooks
+	logger     *slog.Logger
+
+	mu       sync.Mutex
+	cfg      config.Config // the one in effect
+	services []services.LedgerService
+}
+
+// current is the config in effect, with the reloaded settings
+func (r *reloader) current() config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cfg
+}
+
+// add gets the reloads of the config of service, the ledgers of the tenants are added as they're opened
+func (r *reloader) add(service services.LedgerService) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.services = append(r.services, service)
+}
+
+// Reload loads the config and applies what it can. an invalid config, or webhook URLs the dispatcher rejects, leave
+// everything as it was
+func (r *reloader) Reload() (handlers.ConfigReload, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		r.logger.Error("could not reload the config, keeping the running one", "error", err)
+		return handlers.ConfigReload{}, err
+	}
+
+	result := handlers.ConfigReload{Applied: []string{}, RequiresRestart: []string{}}
+	for _, name := range r.cfg.Changes(next) {
+		if slices.Contains(config.Reloadable, name) && r.canApply(name, next) {
+			result.Applied = append(result.Applied, name)
+		} else {
+			result.RequiresRestart = append(result.RequiresRestart, name)
+		}
+	}
+
+	// the URLs first, they're the only setting that can still be rejected
+	if slices.Contains(result.Applied, "webhook_urls") {
+		if err := r.dispatcher.SetURLs(next.WebhookURLs); err != nil {
+			r.logger.Error("could not reload the config, keeping the running one", "error", err)
+			return handlers.ConfigReload{}, err
+		}
+		r.cfg.WebhookURLs = next.WebhookURLs
+	}
+	for _, name := range result.Applied {
+		switch name {
+		case "log_level":
+			r.cfg.LogLevel = next.LogLevel
+			r.logLevel.Set(next.LogLevel)
+		case "max_amount":
+			r.cfg.MaxAmount = next.MaxAmount
+		case "max_batch_size":
+			r.cfg.MaxBatchSize = next.MaxBatchSize
+		case "rate_limit", "rate_burst":
+			r.cfg.RateLimit, r.cfg.RateBurst = next.RateLimit, next.RateBurst
+			r.limiter.SetLimit(next.RateLimit, next.RateBurst)
+		}
+	}
+	for _, service := range r.services {
+		serviceConfig := service.Config()
+		serviceConfig.MaxDepositAmount, serviceConfig.MaxWithdrawalAmount = r.cfg.MaxAmount, r.cfg.MaxAmount
+		serviceConfig.MaxBatchSize = r.cfg.MaxBatchSize
+		service.SetConfig(serviceConfig)
+	}
+
+	r.logger.Info("config reloaded", "applied", result.Applied, "requires_restart", result.RequiresRestart)
+	return result, nil
+}
+
+// canApply reports whether the running server can take the change of name: a limiter or a dispatcher that wasn't
+// started can't be started now, nor stopped
+func (r *reloader) canApply(name string, next config.Config) bool {
+	switch name {
+	case "rate_limit", "rate_burst":
+		return r.limiter != nil && next.RateLimit > 0
+	case "webhook_urls":
+		return r.dispatcher != nil && len(next.WebhookURLs) > 0
+	}
+	return true
+}
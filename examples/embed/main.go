@@ -0,0 +1,76 @@
+// Command embed is an application that keeps its ledger in process with pkg/ledger: it records through the Go API,
+// follows the new records with Subscribe and serves the ledger's HTTP API under /ledger next to its own routes
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+
+	"tiny-ledger/pkg/ledger"
+)
+
+func main() {
+	l, m, err := setup(os.Stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := run(context.Background(), l, os.Stdout); err != nil {
+		log.Fatal(err)
+	}
+	log.Println("serving on :8081, try GET /ledger/users/alice/balance")
+	log.Fatal(http.ListenAndServe(":8081", m))
+}
+
+// setup builds the ledger and the mux of the application, the ledger prints every new record to out
+func setup(out io.Writer) (*ledger.Ledger, *http.ServeMux, error) {
+	l, err := ledger.New(ledger.WithMaxAmount(10_000), ledger.WithCurrency("EUR"))
+	if err != nil {
+		return nil, nil, err
+	}
+	l.Subscribe(func(event ledger.Event) {
+		tx := event.Transaction
+		fmt.Fprintf(out, "event: %s %s %.2f, balance %.2f\n", tx.UserID, tx.Type, tx.Amount, event.Balance)
+	})
+
+	m := http.NewServeMux()
+	m.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	l.Mount(m, "/ledger")
+	return l, m, nil
+}
+
+// run is what the application does with its ledger
+func run(ctx context.Context, l *ledger.Ledger, out io.Writer) error {
+	if _, err := l.RecordTransaction(ctx, "alice", ledger.TransactionInput{Type: ledger.Deposit, Amount: 120, Description: "top up"}); err != nil {
+		return err
+	}
+	if _, err := l.Transfer(ctx, "alice", "bob", 45, "concert tickets"); err != nil {
+		return err
+	}
+
+	_, err := l.RecordTransaction(ctx, "bob", ledger.TransactionInput{Type: ledger.Withdrawal, Amount: 100})
+	if !errors.Is(err, ledger.ErrInsufficientFunds) {
+		return fmt.Errorf("expected bob to be short, got %v", err)
+	}
+	fmt.Fprintln(out, "bob can't withdraw 100:", err)
+
+	page, err := l.History(ctx, "alice", ledger.HistoryQuery{})
+	if err != nil {
+		return err
+	}
+	for _, tx := range page.Transactions {
+		fmt.Fprintf(out, "alice: %s %.2f %s\n", tx.Type, tx.Amount, tx.Description)
+	}
+	balance, err := l.Balance(ctx, "alice")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "alice: balance %.2f\n", balance)
+	return nil
+}
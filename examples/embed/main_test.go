@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	// the events are printed by a goroutine of the ledger, not into the buffer the test reads
+	l, m, err := setup(io.Discard)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var out bytes.Buffer
+	if err := run(context.Background(), l, &out); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(out.String(), "alice: balance 75.00") {
+		t.Errorf("unexpected output:\n%s", out.String())
+	}
+
+	// the ledger API is served next to the routes of the application
+	for _, path := range []string{"/healthz", "/ledger/users/bob/balance"} {
+		rr := httptest.NewRecorder()
+		m.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("GET %s: unexpected status %d: %s", path, rr.Code, rr.Body)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Package apitest serves the whole HTTP stack of the ledger (store, service, handler and router) in-process for the
+// tests of the API, with typed helpers that build the requests, decode the responses and fail the test on a status
+// the call shouldn't get. the tests of package handlers that go through the API use it as handlers_test
+package apitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+	"tiny-ledger/internal/clock"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// Server is the API of a ledger of its own. it's an http.Handler, httptest.NewServer(s) serves it on a port for the
+// tests of a client
+type Server struct {
+	Store   *store.LedgerStore
+	Service services.LedgerService
+	Handler *handlers.LedgerHandler
+	Router  *mux.Router // more routes or middleware can still be added
+
+	// Prefix is what the routes are mounted under, the paths of the helpers are relative to it
+	Prefix string
+	// Token is the bearer token of every request without an Authorization header, an admin token of authtest.Secret
+	// with WithAuth
+	Token string
+}
+
+type config struct {
+	clock         clock.Clock
+	serviceConfig services.Config
+	serviceOpts   []services.Option
+	handlerOpts   []handlers.HandlerOption
+	middleware    []mux.MiddlewareFunc
+	prefix        string
+	auth          bool
+	legacySunset  *time.Time
+}
+
+type Option func(*config)
+
+// WithClock sets the clock of the store, the service and the handler, e.g. a clocktest.Fake
+func WithClock(c clock.Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
+
+// WithConfig replaces the default config of the service
+func WithConfig(serviceConfig services.Config) Option {
+	return func(cfg *config) {
+		cfg.serviceConfig = serviceConfig
+	}
+}
+
+// WithStrictAccounts requires the users to be created before they transact
+func WithStrictAccounts() Option {
+	return func(cfg *config) {
+		cfg.serviceConfig.StrictAccounts = true
+	}
+}
+
+// WithStrictQuery rejects the unknown query parameters on every path
+func WithStrictQuery() Option {
+	return func(cfg *config) {
+		cfg.handlerOpts = append(cfg.handlerOpts, handlers.WithStrictQuery(true, true))
+	}
+}
+
+// WithAuth requires a bearer token signed with authtest.Secret, the requests carry an admin token unless Token is
+// changed
+func WithAuth() Option {
+	return func(cfg *config) {
+		cfg.auth = true
+	}
+}
+
+// WithPrefix mounts the routes under prefix instead of handlers.APIPrefix, "" for the unprefixed paths
+func WithPrefix(prefix string) Option {
+	return func(cfg *config) {
+		cfg.prefix = prefix
+	}
+}
+
+// WithLegacyRoutes mounts the unprefixed paths of the API too, deprecated until sunset. the helpers stay on Prefix,
+// Serve reaches the legacy paths
+func WithLegacyRoutes(sunset time.Time) Option {
+	return func(cfg *config) {
+		cfg.legacySunset = &sunset
+	}
+}
+
+// WithServiceOptions passes more options to the service, after the config
+func WithServiceOptions(opts ...services.Option) Option {
+	return func(cfg *config) {
+		cfg.serviceOpts = append(cfg.serviceOpts, opts...)
+	}
+}
+
+// WithHandlerOptions passes more options to the handler
+func WithHandlerOptions(opts ...handlers.HandlerOption) Option {
+	return func(cfg *config) {
+		cfg.handlerOpts = append(cfg.handlerOpts, opts...)
+	}
+}
+
+// WithMiddleware wraps the routes in middleware, after the request ID
+func WithMiddleware(middleware ...mux.MiddlewareFunc) Option {
+	return func(cfg *config) {
+		cfg.middleware = append(cfg.middleware, middleware...)
+	}
+}
+
+// NewTestServer wires a store, a service and a handler like the server does, the logs are discarded
+func NewTestServer(opts ...Option) *Server {
+	cfg := config{clock: clock.Real, serviceConfig: services.DefaultConfig(), prefix: handlers.APIPrefix}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	s := &Server{Store: store.NewLedgerStore(store.WithClock(cfg.clock)), Router: mux.NewRouter(), Prefix: cfg.prefix}
+	s.Service = services.NewLedgerService(s.Store, append([]services.Option{services.WithConfig(cfg.serviceConfig)}, cfg.serviceOpts...)...)
+
+	handlerOpts := append([]handlers.HandlerOption{handlers.WithClock(cfg.clock.Now)}, cfg.handlerOpts...)
+	if cfg.auth {
+		verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+		if err != nil {
+			panic(err)
+		}
+		handlerOpts = append(handlerOpts, handlers.WithAuth(verifier))
+		s.Token = authtest.Token(authtest.Secret, "apitest", auth.ScopeAdmin)
+	}
+	s.Handler = handlers.NewLedgerHandler(s.Service, slog.New(slog.NewTextHandler(io.Discard, nil)), handlerOpts...)
+
+	s.Router.Use(handlers.RequestIDMiddleware)
+	s.Router.Use(cfg.middleware...)
+	s.Handler.RegisterRoutes(s.Router, s.Prefix)
+	if cfg.legacySunset != nil {
+		s.Handler.RegisterLegacyRoutes(s.Router, *cfg.legacySunset)
+	}
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Router.ServeHTTP(w, r)
+}
+
+// Response is what the server answered
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Do sends a request to path under Prefix. a body that isn't a string or a []byte is sent as JSON
+func (s *Server) Do(t testing.TB, method, path string, body any) Response {
+	t.Helper()
+
+	var reader io.Reader = http.NoBody
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(body)
+	case []byte:
+		reader = bytes.NewBuffer(body)
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("could not encode the request body: %v", err)
+		}
+		reader = bytes.NewBuffer(encoded)
+	}
+	req := httptest.NewRequest(method, s.Prefix+path, reader)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return s.Serve(t, req)
+}
+
+// GetAccepting sends a GET to path under Prefix that prefers the media type accept, e.g. "text/csv"
+func (s *Server) GetAccepting(t testing.TB, path, accept string) Response {
+	t.Helper()
+	req := httptest.NewRequest("GET", s.Prefix+path, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	return s.Serve(t, req)
+}
+
+// Serve sends a request built by the test, with Token when it has no Authorization header
+func (s *Server) Serve(t testing.TB, req *http.Request) Response {
+	t.Helper()
+
+	if s.Token != "" && req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
+	rr := httptest.NewRecorder()
+	s.Router.ServeHTTP(rr, req)
+	return Response{Status: rr.Code, Header: rr.Header(), Body: rr.Body.Bytes()}
+}
+
+// PostTransaction records a transaction of the user, body is a TransactionRequest or any JSON. the test fails on a
+// server error, the other statuses are the test's to check
+func (s *Server) PostTransaction(t testing.TB, userId string, body any) Response {
+	t.Helper()
+	resp := s.Do(t, "POST", "/users/"+url.PathEscape(userId)+"/transactions", body)
+	if resp.Status >= 500 {
+		t.Fatalf("POST transaction of %s: unexpected status %d: %s", userId, resp.Status, resp.Body)
+	}
+	return resp
+}
+
+// Deposit records a deposit of the user and fails the test unless it's created
+func (s *Server) Deposit(t testing.TB, userId string, amount float64) Transaction {
+	t.Helper()
+	return s.PostTransaction(t, userId, TransactionRequest{Type: "deposit", Amount: amount}).Transaction(t)
+}
+
+// GetHistory reads a page of the history of the user, query is the encoded query string without "?". the test fails
+// unless it's a 200
+func (s *Server) GetHistory(t testing.TB, userId, query string) HistoryResponse {
+	t.Helper()
+	path := "/users/" + url.PathEscape(userId) + "/transactions"
+	if query != "" {
+		path += "?" + query
+	}
+	var history HistoryResponse
+	s.Do(t, "GET", path, nil).Expect(t, http.StatusOK).Decode(t, &history)
+	return history
+}
+
+// GetBalance reads the balance of the user, query as for GetHistory. the test fails unless it's a 200
+func (s *Server) GetBalance(t testing.TB, userId, query string) Balance {
+	t.Helper()
+	path := "/users/" + url.PathEscape(userId) + "/balance"
+	if query != "" {
+		path += "?" + query
+	}
+	var balance Balance
+	s.Do(t, "GET", path, nil).Expect(t, http.StatusOK).Decode(t, &balance)
+	return balance
+}
+
+// Expect fails the test unless the status is status
+func (r Response) Expect(t testing.TB, status int) Response {
+	t.Helper()
+	if r.Status != status {
+		t.Fatalf("expected status %d, got %d: %s", status, r.Status, r.Body)
+	}
+	return r
+}
+
+// Decode unmarshals the JSON body into v, the test fails when it can't
+func (r Response) Decode(t testing.TB, v any) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		t.Fatalf("could not decode the body into %T: %v: %s", v, err, r.Body)
+	}
+}
+
+// Transaction decodes a transaction, the test fails unless the status is a 200 or a 201
+func (r Response) Transaction(t testing.TB) Transaction {
+	t.Helper()
+	if r.Status != http.StatusOK && r.Status != http.StatusCreated {
+		t.Fatalf("expected a transaction, got status %d: %s", r.Status, r.Body)
+	}
+	var tx Transaction
+	r.Decode(t, &tx)
+	return tx
+}
+
+// Error decodes an error body, the test fails unless it has the status and the kind (VALIDATION_FAILED...)
+func (r Response) Error(t testing.TB, status int, kind string) handlers.ErrorResponse {
+	t.Helper()
+	if r.Status != status {
+		t.Fatalf("expected status %d, got %d: %s", status, r.Status, r.Body)
+	}
+	var body handlers.ErrorResponse
+	r.Decode(t, &body)
+	if body.Details.Code != kind {
+		t.Errorf("expected error kind %s, got %q: %s", kind, body.Details.Code, r.Body)
+	}
+	return body
+}
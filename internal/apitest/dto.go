@@ -0,0 +1,74 @@
+package apitest
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+)
+
+// the bodies of the API as a client sees them, the handler's own types are unexported
+
+type TransactionRequest struct {
+	Type           string  `json:"type"`
+	Amount         float64 `json:"amount"`
+	Description    string  `json:"description,omitempty"`
+	ReferenceID    string  `json:"referenceId,omitempty"`
+	AllowDuplicate bool    `json:"allowDuplicate,omitempty"`
+}
+
+type Transaction struct {
+	ID             uuid.UUID                `json:"id"`
+	Amount         float64                  `json:"amount"`
+	Fee            float64                  `json:"fee"`
+	Type           models.TransactionType   `json:"type"`
+	Timestamp      time.Time                `json:"timestamp"`
+	Description    string                   `json:"description"`
+	ReferenceID    string                   `json:"referenceId"`
+	JournalID      *uuid.UUID               `json:"journalId"`
+	ReversalOf     *uuid.UUID               `json:"reversalOf"`
+	ReversedBy     *uuid.UUID               `json:"reversedBy"`
+	ReversalReason string                   `json:"reversalReason"`
+	Edits          []models.DescriptionEdit `json:"edits"`
+	Voided         bool                     `json:"voided"`
+	VoidedAt       *time.Time               `json:"voidedAt"`
+	VoidReason     string                   `json:"voidReason"`
+	BalanceAfter   *float64                 `json:"balanceAfter"`
+}
+
+type Transfer struct {
+	TransferID uuid.UUID   `json:"transferId"`
+	Debit      Transaction `json:"debit"`
+	Credit     Transaction `json:"credit"`
+	Balance    float64     `json:"balance"`
+}
+
+type Balance struct {
+	Balance          float64   `json:"balance"`
+	AvailableBalance float64   `json:"availableBalance"`
+	Currency         string    `json:"currency"`
+	AsOf             time.Time `json:"asOf"`
+	PendingCount     int       `json:"pendingCount"`
+	Exists           bool      `json:"exists"`
+}
+
+// HistoryResponse is a page of the history, Pagination has the fields of the page numbers and of the cursor walk
+type HistoryResponse struct {
+	Transactions []Transaction `json:"transactions"`
+	Pagination   Pagination    `json:"pagination"`
+}
+
+type Pagination struct {
+	Page          int    `json:"page"`
+	PageSize      int    `json:"pageSize"`
+	TotalItems    int    `json:"totalItems"`
+	TotalPages    int    `json:"totalPages"`
+	First         string `json:"first"`
+	Prev          string `json:"prev"`
+	Next          string `json:"next"`
+	Last          string `json:"last"`
+	Limit         int    `json:"limit"`
+	NextCursor    string `json:"nextCursor"`
+	AccountExists *bool  `json:"accountExists"`
+}
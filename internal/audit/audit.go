@@ -0,0 +1,135 @@
+// Package audit keeps the trail of the operations on the ledger: who did what to which user, and whether it went
+// through. events are kept in memory in the order they happened, indexed by user, so a query only walks the time range
+// it asks for
+package audit
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// outcomes of an Event
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Event is one audited operation. ErrorCode is the rule that rejected a failure, empty on success. Actor is the
+// authenticated subject and empty without authentication, ClientCert the client certificate of a mutual TLS caller
+type Event struct {
+	Time       time.Time `json:"time"`
+	UserID     string    `json:"userId"`
+	Actor      string    `json:"actor,omitempty"`
+	Operation  string    `json:"operation"`
+	Outcome    string    `json:"outcome"`
+	ErrorCode  string    `json:"errorCode,omitempty"`
+	RequestID  string    `json:"requestId,omitempty"`
+	ClientCert string    `json:"clientCert,omitempty"`
+}
+
+// Filter narrows a query down, empty fields and nil times don't filter. From and To are inclusive
+type Filter struct {
+	UserID  string
+	From    *time.Time
+	To      *time.Time
+	Outcome string
+}
+
+type Log struct {
+	mu     sync.RWMutex
+	events []Event          // in time order
+	byUser map[string][]int // user -> positions in events
+	now    func() time.Time
+}
+
+type Option func(*Log)
+
+// WithClock replaces time.Now, for tests
+func WithClock(now func() time.Time) Option {
+	return func(l *Log) {
+		l.now = now
+	}
+}
+
+func NewLog(opts ...Option) *Log {
+	l := &Log{byUser: map[string][]int{}, now: time.Now}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Record appends the event stamped with the current time. the time never goes back from one event to the next, so
+// the log stays sorted even when the wall clock is set back
+func (l *Log) Record(event Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	event.Time = l.now()
+	if n := len(l.events); n > 0 && event.Time.Before(l.events[n-1].Time) {
+		event.Time = l.events[n-1].Time
+	}
+	l.byUser[event.UserID] = append(l.byUser[event.UserID], len(l.events))
+	l.events = append(l.events, event)
+}
+
+// Query returns limit events matching the filter from offset on, oldest first, and how many match in total. a user
+// filter only looks at the events of that user and the time range is found by binary search
+func (l *Log) Query(filter Filter, offset, limit int) ([]Event, int) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	n := len(l.events)
+	at := func(i int) *Event { return &l.events[i] }
+	if filter.UserID != "" {
+		positions := l.byUser[filter.UserID]
+		n = len(positions)
+		at = func(i int) *Event { return &l.events[positions[i]] }
+	}
+
+	start, end := 0, n
+	if filter.From != nil {
+		start = sort.Search(n, func(i int) bool { return !at(i).Time.Before(*filter.From) })
+	}
+	if filter.To != nil {
+		end = sort.Search(n, func(i int) bool { return at(i).Time.After(*filter.To) })
+	}
+
+	page := []Event{}
+	total := 0
+	for i := start; i < end; i++ {
+		event := at(i)
+		if filter.Outcome != "" && event.Outcome != filter.Outcome {
+			continue
+		}
+		if total >= offset && len(page) < limit {
+			page = append(page, *event)
+		}
+		total++
+	}
+	return page, total
+}
+
+// Source is who an operation is done for, the transports put it in the context of the service calls
+type Source struct {
+	Actor      string
+	RequestID  string
+	ClientCert string
+}
+
+type sourceKey struct{}
+
+func WithSource(ctx context.Context, source Source) context.Context {
+	return context.WithValue(ctx, sourceKey{}, source)
+}
+
+// SourceFrom returns the source in ctx, the zero Source when there is none
+func SourceFrom(ctx context.Context) Source {
+	if ctx == nil {
+		return Source{}
+	}
+	source, _ := ctx.Value(sourceKey{}).(Source)
+	return source
+}
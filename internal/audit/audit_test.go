@@ -0,0 +1,98 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// setupLog records an event a minute for users alice and bob in turn, every third one a failure
+func setupLog(t *testing.T, count int) (*Log, time.Time) {
+	t.Helper()
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	log := NewLog(WithClock(func() time.Time { return now }))
+	for i := range count {
+		now = base.Add(time.Duration(i) * time.Minute)
+		event := Event{UserID: []string{"alice", "bob"}[i%2], Operation: "transaction.record", Outcome: OutcomeSuccess, RequestID: fmt.Sprint(i)}
+		if i%3 == 0 {
+			event.Outcome, event.ErrorCode = OutcomeFailure, "insufficient_funds"
+		}
+		log.Record(event)
+	}
+	return log, base
+}
+
+func TestLogQuery(t *testing.T) {
+	log, base := setupLog(t, 12)
+	at := func(minute int) *time.Time {
+		t := base.Add(time.Duration(minute) * time.Minute)
+		return &t
+	}
+
+	tests := []struct {
+		name       string
+		filter     Filter
+		expectedID []string
+	}{
+		{"Everything", Filter{}, []string{"0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"}},
+		{"User", Filter{UserID: "alice"}, []string{"0", "2", "4", "6", "8", "10"}},
+		{"Failures", Filter{Outcome: OutcomeFailure}, []string{"0", "3", "6", "9"}},
+		{"Failures of a user", Filter{UserID: "bob", Outcome: OutcomeFailure}, []string{"3", "9"}},
+		{"Time range, both ends inclusive", Filter{From: at(4), To: at(7)}, []string{"4", "5", "6", "7"}},
+		{"Time range of a user", Filter{UserID: "alice", From: at(3), To: at(8)}, []string{"4", "6", "8"}},
+		{"Unknown user", Filter{UserID: "carol"}, []string{}},
+		{"Empty range", Filter{From: at(100)}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, total := log.Query(tt.filter, 0, 100)
+			if total != len(tt.expectedID) || len(events) != len(tt.expectedID) {
+				t.Fatalf("expected %d events, got %d of %d", len(tt.expectedID), len(events), total)
+			}
+			for i, event := range events {
+				if event.RequestID != tt.expectedID[i] {
+					t.Errorf("expected event %s at %d, got %s", tt.expectedID[i], i, event.RequestID)
+				}
+			}
+		})
+	}
+}
+
+func TestLogQueryPages(t *testing.T) {
+	log, _ := setupLog(t, 12)
+
+	events, total := log.Query(Filter{UserID: "alice"}, 2, 3)
+	if total != 6 || len(events) != 3 || events[0].RequestID != "4" || events[2].RequestID != "8" {
+		t.Errorf("expected events 4 to 8 of 6, got %v of %d", events, total)
+	}
+	if events, total := log.Query(Filter{}, 20, 5); len(events) != 0 || total != 12 {
+		t.Errorf("expected an empty page past the end, got %d of %d", len(events), total)
+	}
+}
+
+func TestLogClockGoesBack(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	log := NewLog(WithClock(func() time.Time { return now }))
+	log.Record(Event{UserID: "alice", RequestID: "first"})
+	now = now.Add(-time.Hour)
+	log.Record(Event{UserID: "alice", RequestID: "second"})
+
+	events, _ := log.Query(Filter{}, 0, 10)
+	if !events[1].Time.Equal(events[0].Time) {
+		t.Errorf("expected the second event not to go back in time, got %v after %v", events[1].Time, events[0].Time)
+	}
+}
+
+func TestSource(t *testing.T) {
+	if source := SourceFrom(context.Background()); source != (Source{}) {
+		t.Errorf("expected no source, got %+v", source)
+	}
+	ctx := WithSource(context.Background(), Source{Actor: "ops", RequestID: "req-1"})
+	if source := SourceFrom(ctx); source.Actor != "ops" || source.RequestID != "req-1" {
+		t.Errorf("unexpected source %+v", source)
+	}
+}
@@ -0,0 +1,130 @@
+// Package auth verifies the JWTs of end-user clients, either HS256 with a shared secret or RS256 with the keys
+// published at a JWKS URL
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ScopeAdmin lets a token act on any user, not only its subject
+const ScopeAdmin = "admin"
+
+// DefaultLeeway is the clock skew tolerated on exp and nbf
+const DefaultLeeway = 30 * time.Second
+
+var (
+	ErrMissingToken = errors.New("missing bearer token")
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// Claims are the registered claims plus the space separated OAuth scope
+type Claims struct {
+	Scope string `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Principal is the verified caller
+type Principal struct {
+	Subject string
+	Scopes  []string
+}
+
+func (p Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccess reports whether the caller may act on the user, its own ledger or any ledger with the admin scope
+func (p Principal) CanAccess(userId string) bool {
+	return p.Subject == userId || p.HasScope(ScopeAdmin)
+}
+
+// Config selects the signing method, exactly one of HMACSecret and JWKSURL must be set
+type Config struct {
+	HMACSecret []byte
+	JWKSURL    string
+	Leeway     time.Duration // zero is DefaultLeeway
+	HTTPClient *http.Client  // for the JWKS, nil is a client with a 10s timeout
+}
+
+type Verifier struct {
+	parser  *jwt.Parser
+	keyFunc jwt.Keyfunc
+}
+
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if (len(cfg.HMACSecret) == 0) == (cfg.JWKSURL == "") {
+		return nil, errors.New("auth: set exactly one of the HMAC secret and the JWKS URL")
+	}
+
+	leeway := cfg.Leeway
+	if leeway == 0 {
+		leeway = DefaultLeeway
+	}
+
+	v := &Verifier{}
+	method := jwt.SigningMethodHS256.Alg()
+	if cfg.JWKSURL != "" {
+		method = jwt.SigningMethodRS256.Alg()
+		client := cfg.HTTPClient
+		if client == nil {
+			client = &http.Client{Timeout: 10 * time.Second}
+		}
+		v.keyFunc = newJWKS(cfg.JWKSURL, client).keyFunc
+	} else {
+		secret := append([]byte(nil), cfg.HMACSecret...)
+		v.keyFunc = func(*jwt.Token) (interface{}, error) { return secret, nil }
+	}
+
+	v.parser = jwt.NewParser(
+		jwt.WithValidMethods([]string{method}),
+		jwt.WithLeeway(leeway),
+		jwt.WithExpirationRequired(),
+	)
+	return v, nil
+}
+
+// Verify checks the signature, exp and nbf of the token and returns its subject and scopes
+func (v *Verifier) Verify(token string) (Principal, error) {
+	var claims Claims
+	if _, err := v.parser.ParseWithClaims(token, &claims, v.keyFunc); err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if claims.Subject == "" {
+		return Principal{}, fmt.Errorf("%w: no subject", ErrInvalidToken)
+	}
+
+	return Principal{Subject: claims.Subject, Scopes: strings.Fields(claims.Scope)}, nil
+}
+
+// VerifyRequest verifies the bearer token of the Authorization header
+func (v *Verifier) VerifyRequest(r *http.Request) (Principal, error) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return Principal{}, ErrMissingToken
+	}
+	return v.Verify(strings.TrimSpace(token))
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller verified by the middleware, false when the request wasn't authenticated
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
@@ -0,0 +1,171 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func claims(subject string, expiresIn time.Duration) auth.Claims {
+	return auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiresIn)),
+	}}
+}
+
+func TestVerifyHS256(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret, Leeway: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	notYetValid := claims("user1", time.Hour)
+	notYetValid.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute))
+	slightlyEarly := claims("user1", time.Hour)
+	slightlyEarly.NotBefore = jwt.NewNumericDate(time.Now().Add(2 * time.Second))
+	noExpiry := claims("user1", 0)
+	noExpiry.ExpiresAt = nil
+
+	tests := []struct {
+		name        string
+		token       string
+		expectError bool
+		expectAdmin bool
+	}{
+		{name: "valid token", token: authtest.Token(authtest.Secret, "user1")},
+		{name: "admin scope", token: authtest.Token(authtest.Secret, "ops", "read", auth.ScopeAdmin), expectAdmin: true},
+		{name: "expired", token: authtest.SignHS256(authtest.Secret, claims("user1", -time.Minute)), expectError: true},
+		{name: "expired within the leeway", token: authtest.SignHS256(authtest.Secret, claims("user1", -2*time.Second))},
+		{name: "not valid yet", token: authtest.SignHS256(authtest.Secret, notYetValid), expectError: true},
+		{name: "not valid yet within the leeway", token: authtest.SignHS256(authtest.Secret, slightlyEarly)},
+		{name: "no expiry", token: authtest.SignHS256(authtest.Secret, noExpiry), expectError: true},
+		{name: "no subject", token: authtest.SignHS256(authtest.Secret, claims("", time.Hour)), expectError: true},
+		{name: "wrong secret", token: authtest.Token([]byte("another secret"), "user1"), expectError: true},
+		{name: "garbage", token: "not.a.token", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := verifier.Verify(tt.token)
+			if tt.expectError {
+				if !errors.Is(err, auth.ErrInvalidToken) {
+					t.Errorf("expected ErrInvalidToken, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if principal.HasScope(auth.ScopeAdmin) != tt.expectAdmin {
+				t.Errorf("expected admin %v, got scopes %v", tt.expectAdmin, principal.Scopes)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsOtherAlgorithms(t *testing.T) {
+	verifier, _ := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+
+	unsigned, _ := jwt.NewWithClaims(jwt.SigningMethodNone, claims("user1", time.Hour)).SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if _, err := verifier.Verify(unsigned); err == nil {
+		t.Errorf("expected an unsigned token to be rejected")
+	}
+
+	hs512, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, claims("user1", time.Hour)).SignedString(authtest.Secret)
+	if _, err := verifier.Verify(hs512); err == nil {
+		t.Errorf("expected an HS512 token to be rejected")
+	}
+}
+
+func TestVerifyRS256WithJWKS(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	var fetches atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		_ = json.NewEncoder(w).Encode(authtest.JWKS(&key.PublicKey, "key-1"))
+	}))
+	defer server.Close()
+
+	verifier, err := auth.NewVerifier(auth.Config{JWKSURL: server.URL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	principal, err := verifier.Verify(authtest.SignRS256(key, "key-1", claims("user1", time.Hour)))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal.Subject != "user1" {
+		t.Errorf("expected subject user1, got %s", principal.Subject)
+	}
+
+	if _, err := verifier.Verify(authtest.SignRS256(key, "key-2", claims("user1", time.Hour))); err == nil {
+		t.Errorf("expected an unknown kid to be rejected")
+	}
+	if _, err := verifier.Verify(authtest.Token(authtest.Secret, "user1")); err == nil {
+		t.Errorf("expected an HS256 token to be rejected by an RS256 verifier")
+	}
+
+	// the unknown kid is within the refresh interval of the first fetch, the JWKS is fetched once
+	if got := fetches.Load(); got != 1 {
+		t.Errorf("expected 1 JWKS fetch, got %d", got)
+	}
+}
+
+func TestNewVerifierConfig(t *testing.T) {
+	if _, err := auth.NewVerifier(auth.Config{}); err == nil {
+		t.Errorf("expected an error without a secret or a JWKS URL")
+	}
+	if _, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret, JWKSURL: "http://example.com"}); err == nil {
+		t.Errorf("expected an error with both a secret and a JWKS URL")
+	}
+}
+
+func TestVerifyRequest(t *testing.T) {
+	verifier, _ := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+
+	tests := []struct {
+		name          string
+		authorization string
+		expectedErr   error
+	}{
+		{name: "bearer token", authorization: "Bearer " + authtest.Token(authtest.Secret, "user1")},
+		{name: "lowercase scheme", authorization: "bearer " + authtest.Token(authtest.Secret, "user1")},
+		{name: "missing header", authorization: "", expectedErr: auth.ErrMissingToken},
+		{name: "basic auth", authorization: "Basic dXNlcjpwYXNz", expectedErr: auth.ErrMissingToken},
+		{name: "empty token", authorization: "Bearer ", expectedErr: auth.ErrMissingToken},
+		{name: "invalid token", authorization: "Bearer nope", expectedErr: auth.ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+
+			_, err := verifier.VerifyRequest(req)
+			if tt.expectedErr == nil && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if tt.expectedErr != nil && !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected %v, got %v", tt.expectedErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+// Package authtest signs tokens for tests of code behind the auth middleware
+package authtest
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"strings"
+	"time"
+
+	"tiny-ledger/internal/auth"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Secret is a ready made HS256 secret for tests
+var Secret = []byte("authtest-secret-authtest-secret!")
+
+// Token signs an HS256 token for the subject valid for an hour
+func Token(secret []byte, subject string, scopes ...string) string {
+	now := time.Now()
+	return SignHS256(secret, auth.Claims{
+		Scope: strings.Join(scopes, " "),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   subject,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		},
+	})
+}
+
+// SignHS256 signs arbitrary claims, for expired or not yet valid tokens
+func SignHS256(secret []byte, claims auth.Claims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+	if err != nil {
+		panic(err)
+	}
+	return token
+}
+
+// SignRS256 signs the claims with the key and names it kid in the header
+func SignRS256(key *rsa.PrivateKey, kid string, claims auth.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// JWKS is the JSON Web Key Set publishing the public half of the key under kid
+func JWKS(key *rsa.PublicKey, kid string) map[string]interface{} {
+	return map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": kid,
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+}
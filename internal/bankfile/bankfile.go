@@ -0,0 +1,63 @@
+// Package bankfile reads the transactions of the files banks export for personal-finance software, OFX (and QFX,
+// its Quicken flavour) and QIF. it only parses, the ledger service decides what becomes a record
+package bankfile
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FormatOFX = "ofx"
+	FormatQFX = "qfx" // OFX with the Quicken header fields, read like OFX
+	FormatQIF = "qif"
+)
+
+// Formats are the formats Parse reads
+var Formats = []string{FormatOFX, FormatQFX, FormatQIF}
+
+// Entry is a transaction of the file. Amount is signed like in the file, positive for a credit and negative for a
+// debit. an entry that couldn't be read has Err set and the fields that could be, the rest of the file is still read
+type Entry struct {
+	Line   int // where the entry starts in the file
+	Date   time.Time
+	Amount float64
+	Payee  string // NAME of OFX, P of QIF
+	Memo   string
+	FITID  string // the bank's id of the transaction, never set by QIF
+	Err    error
+}
+
+// Parse reads the entries of a file in format. the error is about the whole file (it isn't of that format, it's
+// truncated), the problems of a single entry are in its Err
+func Parse(r io.Reader, format string) ([]Entry, error) {
+	switch strings.ToLower(format) {
+	case FormatOFX, FormatQFX:
+		return ParseOFX(r)
+	case FormatQIF:
+		return ParseQIF(r)
+	}
+	return nil, fmt.Errorf("unknown format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// parseAmount reads an amount with an optional sign and thousands separators. a lone comma is the decimal
+// separator, as in the exports of the European banks
+func parseAmount(raw string) (float64, error) {
+	value := strings.TrimSpace(raw)
+	if strings.Contains(value, ",") {
+		if strings.Contains(value, ".") {
+			value = strings.ReplaceAll(value, ",", "")
+		} else {
+			value = strings.ReplaceAll(value, ",", ".")
+		}
+	}
+	amount, err := strconv.ParseFloat(strings.TrimPrefix(value, "+"), 64)
+	if err != nil || math.IsNaN(amount) || math.IsInf(amount, 0) {
+		return 0, fmt.Errorf("invalid amount %q", raw)
+	}
+	return amount, nil
+}
@@ -0,0 +1,122 @@
+package bankfile
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func parseFile(t *testing.T, path, format string) []Entry {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer file.Close()
+	entries, err := Parse(file, format)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return entries
+}
+
+func TestParseOFX(t *testing.T) {
+	entries := parseFile(t, "testdata/statement.ofx", FormatOFX)
+	if len(entries) != 6 {
+		t.Fatalf("expected 6 entries, got %d: %+v", len(entries), entries)
+	}
+
+	est := time.FixedZone("", -5*3600)
+	expected := []Entry{
+		{Line: 32, Date: time.Date(2025, 1, 3, 12, 0, 0, 0, est), Amount: 2500, Payee: "ACME PAYROLL", Memo: "January salary", FITID: "20250103-0001"},
+		{Line: 40, Date: time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC), Amount: -84.17, Payee: "CORNER GROCERY & DELI", FITID: "20250105-0002"},
+		{Line: 47, Date: time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC), Amount: -1200, Payee: "RENT", Memo: "no FITID on this one"},
+	}
+	for i, want := range expected {
+		got := entries[i]
+		if got.Err != nil || got.Line != want.Line || !got.Date.Equal(want.Date) || got.Amount != want.Amount ||
+			got.Payee != want.Payee || got.Memo != want.Memo || got.FITID != want.FITID {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	if entries[3].Err == nil || !strings.Contains(entries[3].Err.Error(), `invalid date "2025-01-12"`) || entries[3].FITID != "20250112-0004" {
+		t.Errorf("expected the entry with the ISO date to fail, got %+v", entries[3])
+	}
+	if entries[4].Err != nil || entries[4].Amount != 0 {
+		t.Errorf("a zero amount is for the service to reject, got %+v", entries[4])
+	}
+}
+
+func TestParseOFX2(t *testing.T) {
+	entries := parseFile(t, "testdata/statement-v2.ofx", "QFX")
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d: %+v", len(entries), entries)
+	}
+	if got := entries[0]; got.Err != nil || got.Amount != -12.5 || got.Payee != "Bakery" ||
+		!got.Date.Equal(time.Date(2025, 2, 2, 7, 30, 0, 0, time.UTC)) {
+		t.Errorf("unexpected first entry %+v", got)
+	}
+	if got := entries[1]; got.Err != nil || got.Amount != 12.5 || got.Memo != "Refund <bakery>" || got.FITID != "CC-2" {
+		t.Errorf("unexpected second entry %+v", got)
+	}
+}
+
+func TestParseQIF(t *testing.T) {
+	entries := parseFile(t, "testdata/statement.qif", FormatQIF)
+	if len(entries) != 5 {
+		t.Fatalf("expected 5 entries, got %d: %+v", len(entries), entries)
+	}
+
+	day := func(month time.Month, day int) time.Time { return time.Date(2025, month, day, 0, 0, 0, 0, time.UTC) }
+	expected := []Entry{
+		{Line: 2, Date: day(1, 3), Amount: 2500, Payee: "ACME PAYROLL", Memo: "January salary"},
+		{Line: 7, Date: day(1, 5), Amount: -84.17, Payee: "CORNER GROCERY"},
+		{Line: 12, Date: day(1, 12), Amount: -40, Memo: "check 1042"},
+	}
+	for i, want := range expected {
+		got := entries[i]
+		if got.Err != nil || got.Line != want.Line || !got.Date.Equal(want.Date) || got.Amount != want.Amount ||
+			got.Payee != want.Payee || got.Memo != want.Memo || got.FITID != "" {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+	if entries[3].Err == nil || !strings.Contains(entries[3].Err.Error(), "invalid date") {
+		t.Errorf("expected the 13th month to fail, got %+v", entries[3])
+	}
+	// the splits don't replace the total of the record
+	if got := entries[4]; got.Err != nil || got.Amount != -300 || !got.Date.Equal(day(1, 20)) {
+		t.Errorf("unexpected split entry %+v", got)
+	}
+}
+
+func TestParseRejectsOtherFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name, format, body, expected string
+	}{
+		{"csv as OFX", FormatOFX, "date,amount\n2025-01-01,10\n", "no <OFX> element"},
+		{"truncated OFX", FormatOFX, "<OFX><BANKTRANLIST><STMTTRN><TRNAMT>10", "ends inside the transaction"},
+		{"csv as QIF", FormatQIF, "date,amount\n2025-01-01,10\n", "doesn't start with a !Type header"},
+		{"unclosed QIF record", FormatQIF, "!Type:Bank\nD01/01/2025\nT10\n", "ends inside the record"},
+		{"unknown format", "csv", "", `unknown format "csv"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tc.body), tc.format); err == nil || !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("expected an error containing %q, got %v", tc.expected, err)
+			}
+		})
+	}
+}
+
+func TestParseQIFSkipsTheOtherSections(t *testing.T) {
+	body := "!Type:Cat\nNFood\nE\n^\n!Type:Invst\nD01/02/2025\nNBuy\nT100\n^\n!Type:CCard\nD01/03/2025\nT-5\n^\n"
+	entries, err := ParseQIF(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Amount != -5 {
+		t.Errorf("expected only the credit card record, got %+v", entries)
+	}
+}
@@ -0,0 +1,123 @@
+package bankfile
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParseOFX reads the STMTTRN aggregates of a bank or credit card statement in OFX 1.x (SGML, the elements aren't
+// closed) or 2.x (XML). the header before the <OFX> element is skipped
+func ParseOFX(r io.Reader) ([]Entry, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	doc := string(data)
+	start := strings.Index(strings.ToUpper(doc), "<OFX>")
+	if start < 0 {
+		return nil, errors.New("not an OFX file, there is no <OFX> element")
+	}
+
+	var entries []Entry
+	var current *ofxTransaction
+	line := 1 + strings.Count(doc[:start], "\n")
+	for pos := start; pos < len(doc); {
+		open := strings.IndexByte(doc[pos:], '<')
+		if open < 0 {
+			break
+		}
+		line += strings.Count(doc[pos:pos+open], "\n")
+		pos += open
+		closing := strings.IndexByte(doc[pos:], '>')
+		if closing < 0 {
+			return nil, fmt.Errorf("line %d: unterminated tag", line)
+		}
+		tag := strings.ToUpper(strings.TrimSpace(doc[pos+1 : pos+closing]))
+		pos += closing + 1
+		end := strings.IndexByte(doc[pos:], '<')
+		if end < 0 {
+			end = len(doc) - pos
+		}
+		value := strings.TrimSpace(html.UnescapeString(doc[pos : pos+end]))
+
+		switch {
+		case tag == "STMTTRN":
+			if current != nil {
+				entries = append(entries, current.entry())
+			}
+			current = &ofxTransaction{line: line, fields: make(map[string]string)}
+		case tag == "/STMTTRN" || tag == "/BANKTRANLIST":
+			if current != nil {
+				entries = append(entries, current.entry())
+				current = nil
+			}
+		case current != nil && !strings.HasPrefix(tag, "/"):
+			// the NAME of a PAYEE aggregate is the name of the transaction too
+			current.fields[tag] = value
+		}
+	}
+	if current != nil {
+		return nil, fmt.Errorf("the file ends inside the transaction of line %d", current.line)
+	}
+	return entries, nil
+}
+
+type ofxTransaction struct {
+	line   int
+	fields map[string]string
+}
+
+func (t *ofxTransaction) entry() Entry {
+	entry := Entry{Line: t.line, Payee: t.fields["NAME"], Memo: t.fields["MEMO"], FITID: t.fields["FITID"]}
+
+	var errs []error
+	if raw, found := t.fields["DTPOSTED"]; !found || raw == "" {
+		errs = append(errs, errors.New("missing DTPOSTED"))
+	} else if date, err := parseOFXDate(raw); err != nil {
+		errs = append(errs, err)
+	} else {
+		entry.Date = date
+	}
+	if raw, found := t.fields["TRNAMT"]; !found || raw == "" {
+		errs = append(errs, errors.New("missing TRNAMT"))
+	} else if amount, err := parseAmount(raw); err != nil {
+		errs = append(errs, err)
+	} else {
+		entry.Amount = amount
+	}
+	entry.Err = errors.Join(errs...)
+	return entry
+}
+
+// ofxDateLayouts are the precisions of an OFX date by length, the fraction of a second and the zone are cut first
+var ofxDateLayouts = map[int]string{8: "20060102", 12: "200601021504", 14: "20060102150405"}
+
+// parseOFXDate reads YYYYMMDD[HHMM[SS[.XXX]]][[offset:name]], the offset is in hours and UTC is used without one
+func parseOFXDate(raw string) (time.Time, error) {
+	value, zone, _ := strings.Cut(raw, "[")
+	location := time.UTC
+	if zone != "" {
+		offset, _, _ := strings.Cut(strings.TrimSuffix(zone, "]"), ":")
+		hours, err := strconv.ParseFloat(strings.TrimSpace(offset), 64)
+		if err != nil || hours < -14 || hours > 14 {
+			return time.Time{}, fmt.Errorf("invalid date %q, the offset isn't a number of hours", raw)
+		}
+		location = time.FixedZone("", int(hours*3600))
+	}
+	value, _, _ = strings.Cut(strings.TrimSpace(value), ".")
+
+	layout, found := ofxDateLayouts[len(value)]
+	if !found {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYYMMDD or YYYYMMDDHHMMSS", raw)
+	}
+	date, err := time.ParseInLocation(layout, value, location)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYYMMDD or YYYYMMDDHHMMSS", raw)
+	}
+	return date, nil
+}
@@ -0,0 +1,140 @@
+package bankfile
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// qifTransactionTypes are the !Type sections of QIF that hold the transactions of an account, the other sections
+// (investments, categories, the account list...) are skipped
+var qifTransactionTypes = map[string]bool{"bank": true, "cash": true, "ccard": true, "oth a": true, "oth l": true}
+
+// ParseQIF reads the records of the bank, cash and credit card sections of a QIF file. every record ends with a ^
+// line; D is the date, T (or U) the amount, P the payee and M the memo, the other fields are ignored
+func ParseQIF(r io.Reader) ([]Entry, error) {
+	scanner := bufio.NewScanner(r)
+	var entries []Entry
+	var current *qifRecord
+	inTransactions, sawHeader := false, false
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if line == 1 {
+			text = strings.TrimPrefix(text, "\ufeff") // the byte order mark of the Windows exports
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+
+		if text[0] == '!' {
+			if current != nil {
+				return nil, fmt.Errorf("line %d: the record of line %d isn't closed with ^", line, current.line)
+			}
+			sawHeader = true
+			header := strings.ToLower(strings.TrimSpace(text))
+			inTransactions = strings.HasPrefix(header, "!type:") && qifTransactionTypes[strings.TrimPrefix(header, "!type:")]
+			continue
+		}
+		if !sawHeader {
+			return nil, errors.New("not a QIF file, it doesn't start with a !Type header")
+		}
+		if !inTransactions {
+			continue
+		}
+
+		if text[0] == '^' {
+			if current != nil {
+				entries = append(entries, current.entry())
+				current = nil
+			}
+			continue
+		}
+		if current == nil {
+			current = &qifRecord{line: line, fields: make(map[byte]string)}
+		}
+		// a split (S, E, $) repeats its fields, the first of every code is the one of the record
+		if _, seen := current.fields[text[0]]; !seen {
+			current.fields[text[0]] = strings.TrimSpace(text[1:])
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return nil, fmt.Errorf("the file ends inside the record of line %d", current.line)
+	}
+	return entries, nil
+}
+
+type qifRecord struct {
+	line   int
+	fields map[byte]string
+}
+
+func (r *qifRecord) entry() Entry {
+	entry := Entry{Line: r.line, Payee: r.fields['P'], Memo: r.fields['M']}
+
+	var errs []error
+	if raw := r.fields['D']; raw == "" {
+		errs = append(errs, errors.New("missing date (D)"))
+	} else if date, err := parseQIFDate(raw); err != nil {
+		errs = append(errs, err)
+	} else {
+		entry.Date = date
+	}
+	raw := r.fields['T']
+	if raw == "" {
+		raw = r.fields['U']
+	}
+	if raw == "" {
+		errs = append(errs, errors.New("missing amount (T)"))
+	} else if amount, err := parseAmount(raw); err != nil {
+		errs = append(errs, err)
+	} else {
+		entry.Amount = amount
+	}
+	entry.Err = errors.Join(errs...)
+	return entry
+}
+
+// parseQIFDate reads the US dates of Quicken, M/D/YYYY, M/D/YY or M/D'YY, and YYYY-MM-DD. a two digit year after an
+// apostrophe is in the 2000s, after a slash it's in the 2000s below 70 and in the 1900s otherwise
+func parseQIFDate(raw string) (time.Time, error) {
+	invalid := fmt.Errorf("invalid date %q, expected M/D/YYYY, M/D'YY or YYYY-MM-DD", raw)
+	if date, err := time.Parse(time.DateOnly, raw); err == nil {
+		return date, nil
+	}
+
+	apostrophe := strings.Contains(raw, "'")
+	parts := strings.FieldsFunc(raw, func(r rune) bool { return r == '/' || r == '\'' || r == '-' })
+	if len(parts) != 3 {
+		return time.Time{}, invalid
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return time.Time{}, invalid
+		}
+		numbers[i] = n
+	}
+
+	month, day, year := numbers[0], numbers[1], numbers[2]
+	if len(strings.TrimSpace(parts[2])) <= 2 {
+		switch {
+		case apostrophe || year < 70:
+			year += 2000
+		default:
+			year += 1900
+		}
+	}
+	date := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if date.Month() != time.Month(month) || date.Day() != day {
+		return time.Time{}, invalid
+	}
+	return date, nil
+}
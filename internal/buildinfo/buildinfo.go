@@ -0,0 +1,68 @@
+// Package buildinfo tells which build is running. the release pipeline sets the variables with -ldflags:
+//
+//	go build -ldflags "-X tiny-ledger/internal/buildinfo.Version=1.4.0 \
+//	    -X tiny-ledger/internal/buildinfo.Commit=$(git rev-parse HEAD) \
+//	    -X tiny-ledger/internal/buildinfo.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+//
+// a plain go build from a checkout still gets the commit and its date from the VCS stamp of the toolchain
+package buildinfo
+
+import (
+	"fmt"
+	"log/slog"
+	"runtime"
+	"runtime/debug"
+)
+
+// Unknown is what a field the build didn't set reads
+const Unknown = "unknown"
+
+var (
+	Version = "dev"
+	Commit  = ""
+	Date    = "" // RFC 3339
+)
+
+// Info is the build of the binary, the fields are never empty
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// Get reads the variables, the VCS stamp fills what -ldflags left empty
+func Get() Info {
+	info := Info{Version: Version, Commit: Commit, BuildDate: Date, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+
+	for _, field := range []*string{&info.Version, &info.Commit, &info.BuildDate} {
+		if *field == "" {
+			*field = Unknown
+		}
+	}
+	return info
+}
+
+// String is the line -version prints
+func (i Info) String() string {
+	return fmt.Sprintf("tiny-ledger %s (commit %s, built %s, %s)", i.Version, i.Commit, i.BuildDate, i.GoVersion)
+}
+
+func (i Info) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("version", i.Version),
+		slog.String("commit", i.Commit),
+		slog.String("build_date", i.BuildDate),
+		slog.String("go_version", i.GoVersion),
+	)
+}
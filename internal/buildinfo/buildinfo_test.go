@@ -0,0 +1,25 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	defer func(version, commit, date string) { Version, Commit, Date = version, commit, date }(Version, Commit, Date)
+
+	Version, Commit, Date = "1.4.0", "0123abcd", "2026-10-16T08:00:00Z"
+	expected := Info{Version: "1.4.0", Commit: "0123abcd", BuildDate: "2026-10-16T08:00:00Z", GoVersion: runtime.Version()}
+	if info := Get(); info != expected {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+	if line := Get().String(); line != "tiny-ledger 1.4.0 (commit 0123abcd, built 2026-10-16T08:00:00Z, "+runtime.Version()+")" {
+		t.Errorf("unexpected version line %q", line)
+	}
+
+	// a test binary has no VCS stamp, what -ldflags didn't set is unknown rather than empty
+	Version, Commit, Date = "", "", ""
+	if info := Get(); info.Version != Unknown || info.Commit != Unknown || info.BuildDate != Unknown {
+		t.Errorf("expected the unset fields to be %s, got %+v", Unknown, info)
+	}
+}
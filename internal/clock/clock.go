@@ -0,0 +1,18 @@
+// Package clock is the time source of the ledger. the store and the service take their timestamps from a Clock so
+// tests and time based features (limits per day, expiry...) can control the time, see clocktest.Fake
+package clock
+
+import "time"
+
+type Clock interface {
+	Now() time.Time
+}
+
+// Real is the wall clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
@@ -0,0 +1,30 @@
+package clock
+
+import (
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/clock/clocktest"
+)
+
+func TestReal(t *testing.T) {
+	if since := time.Since(Real.Now()); since < 0 || since > time.Second {
+		t.Errorf("expected the wall clock, %v off", since)
+	}
+}
+
+func TestFake(t *testing.T) {
+	var c Clock = clocktest.NewFake(clocktest.Start)
+	fake := c.(*clocktest.Fake)
+
+	if !c.Now().Equal(clocktest.Start) || !c.Now().Equal(c.Now()) {
+		t.Errorf("expected the fake to stand still at the start")
+	}
+	if now := fake.Advance(36 * time.Hour); !now.Equal(clocktest.Start.Add(36*time.Hour)) || !c.Now().Equal(now) {
+		t.Errorf("expected the fake to move by 36h, got %v", c.Now())
+	}
+	fake.Set(clocktest.Start.Add(-time.Hour))
+	if !c.Now().Equal(clocktest.Start.Add(-time.Hour)) {
+		t.Errorf("expected the fake to be set back, got %v", c.Now())
+	}
+}
@@ -0,0 +1,41 @@
+// Package clocktest is a clock for tests that only moves when told to
+package clocktest
+
+import (
+	"sync"
+	"time"
+)
+
+// Start is a fixed instant tests can start the fake from
+var Start = time.Date(2024, time.March, 15, 10, 30, 0, 0, time.UTC)
+
+// Fake is a clock.Clock standing still at its time until Advance or Set, safe for concurrent use
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the clock forward by d and returns the new time
+func (f *Fake) Advance(d time.Duration) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	return f.now
+}
+
+// Set moves the clock to now, backwards too
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
@@ -0,0 +1,527 @@
+// Package config loads the settings of the server: every setting has a default, an environment variable that
+// replaces it and a flag that replaces both. CONFIG_FILE names a file of the same variables, one KEY=VALUE per line,
+// that the environment overrides; it's what a reload reads again
+package config
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/eventbus"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/metrics"
+	"tiny-ledger/internal/services"
+)
+
+// ErrVersion is returned by Load for -version, the caller prints the build info and exits like after -h
+var ErrVersion = errors.New("version requested")
+
+// StoreMemory is the only store so far, the ledger lives in the process and is gone when it exits
+const StoreMemory = "memory"
+
+// Stores are the values of -store
+var Stores = []string{StoreMemory}
+
+// what the plain HTTP listener of a TLS server does with a request
+const (
+	PlainHTTPRedirect = "redirect" // 308 to the same URL over HTTPS
+	PlainHTTPReject   = "reject"   // 403 https_required
+)
+
+const (
+	// DefaultShutdownTimeout stays under the 30 second grace period Kubernetes gives a pod before SIGKILL
+	DefaultShutdownTimeout = 25 * time.Second
+
+	// the limits of the HTTP server against slow or oversized clients. the write timeout is above the request
+	// timeout so the 503 of a timed out request still goes out, the streaming routes lift it
+	DefaultReadHeaderTimeout = 5 * time.Second
+	DefaultReadTimeout       = 30 * time.Second
+	DefaultWriteTimeout      = 30 * time.Second
+	DefaultIdleTimeout       = 2 * time.Minute
+	DefaultMaxHeaderBytes    = 64 << 10 // 64 KiB, a few bearer tokens
+)
+
+type Config struct {
+	Addr     string
+	Store    string
+	LogLevel slog.Level
+
+	// TLS is served when TLSCert and TLSKey are set, ClientCA requires client certificates on top
+	TLSCert       string
+	TLSKey        string
+	ClientCA      string
+	PlainHTTPAddr string // listener of the plain HTTP requests of a TLS server, empty doesn't listen
+	PlainHTTP     string // PlainHTTPRedirect or PlainHTTPReject
+
+	MaxBodyBytes      int64
+	MaxBatchBodyBytes int64
+	MaxBatchSize      int
+	MaxAmount         float64 // of a deposit and of a withdrawal
+	DefaultPageSize   int
+	ClampPageSize     bool
+	StrictQuery       bool
+	StrictLegacyQuery bool
+
+	JWTSecret      string
+	JWKSURL        string
+	SigningSecrets string // client:secret pairs
+
+	RateLimit      float64 // requests per second, zero disables the limit
+	RateBurst      int
+	TrustedProxies string // comma separated CIDRs
+	TrustForwarded bool
+
+	AdminAPIKey   string
+	AdminUser     string
+	AdminPassword string
+
+	WebhookURLs        []string
+	WebhookSecret      string
+	WebhookMaxAttempts int
+
+	// the transaction events are published to EventBusTopic of the EventBus backend at EventBusURL unless it's none
+	EventBus          string
+	EventBusURL       string
+	EventBusTopic     string
+	EventBusBatchSize int
+
+	// Outbox delivers the events to the webhooks and the event bus from the outbox of the store instead of the
+	// fire-and-forget subscribers
+	Outbox bool
+
+	// MetricsSink is where the metrics go, the /metrics scrapes of Prometheus or the StatsD agent at StatsDAddr
+	MetricsSink     string
+	StatsDAddr      string
+	StatsDNamespace string
+	StatsDTagFormat string
+
+	// PaymentsWebhookSecret mounts POST /integrations/payments/webhook for the payment provider, whose notifications are
+	// signed with it
+	PaymentsWebhookSecret string
+
+	// the panics, the 500s and the failed integrity checks are reported to the Sentry project of SentryDSN when set
+	SentryDSN         string
+	SentryEnvironment string
+
+	// of the HTTP server, zero disables a timeout
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	OpsAddr              string // listener of the health, metrics, debug and admin routes, empty serves them on Addr
+	GRPCAddr             string
+	RequestTimeout       time.Duration
+	ShutdownTimeout      time.Duration // how long the in-flight requests get to finish after SIGTERM
+	SlowRequestThreshold time.Duration
+	OTLPEndpoint         string
+	DebugEndpoints       bool
+	DebugAddr            string
+	Tenants              string
+	LegacySunset         time.Time
+
+	// Seed is a fixture file loaded into the store before the listener starts, see package fixtures. a store that
+	// already has records is only seeded with SeedForce
+	Seed      string
+	SeedForce bool
+
+	ConfigFile string // CONFIG_FILE, empty without a file
+}
+
+// Reloadable are the settings a reload applies to the running server, as named by Changes. a change of the others
+// takes a restart
+var Reloadable = []string{"log_level", "max_amount", "max_batch_size", "rate_limit", "rate_burst", "webhook_urls"}
+
+// Load reads the settings from getenv and the flags in args (without the program name), the usage of -h and of a
+// malformed flag goes to output. a malformed environment variable is an error like a malformed flag, so a typo
+// doesn't silently run the default
+func Load(args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	var cfg Config
+	cfg.ConfigFile = getenv("CONFIG_FILE")
+	if cfg.ConfigFile != "" {
+		file, err := readFile(cfg.ConfigFile)
+		if err != nil {
+			return Config{}, err
+		}
+		environment := getenv
+		getenv = func(key string) string {
+			if value := environment(key); value != "" {
+				return value
+			}
+			return file[key]
+		}
+	}
+	l := &loader{fs: flag.NewFlagSet("tiny-ledger", flag.ContinueOnError), getenv: getenv}
+	l.fs.SetOutput(output)
+
+	var maxBatchSize, rateBurst, webhookMaxAttempts, defaultPageSize, maxHeaderBytes, eventBusBatchSize int64
+	var webhookURLs, legacySunset string
+	var version bool
+	l.fs.BoolVar(&version, "version", false, "print the build info and exit")
+	l.string(&cfg.Addr, "addr", "ADDR", ":8080", "listen address of the HTTP API")
+	l.string(&cfg.TLSCert, "tls-cert", "TLS_CERT", "", "PEM certificate (chain) of the server, serves HTTPS with tls-key")
+	l.string(&cfg.TLSKey, "tls-key", "TLS_KEY", "", "PEM private key of tls-cert")
+	l.string(&cfg.ClientCA, "client-ca", "CLIENT_CA", "", "PEM CAs of the client certificates, every client must then present one (mutual TLS)")
+	l.string(&cfg.PlainHTTPAddr, "plain-http-addr", "PLAIN_HTTP_ADDR", "", "listen address of plain HTTP when TLS is served, e.g. :80, empty doesn't listen")
+	l.string(&cfg.PlainHTTP, "plain-http", "PLAIN_HTTP", PlainHTTPRedirect, "what plain-http-addr answers: redirect to HTTPS or reject")
+	l.duration(&cfg.ReadHeaderTimeout, "read-header-timeout", "READ_HEADER_TIMEOUT", DefaultReadHeaderTimeout, "how long a client has to send the request headers")
+	l.duration(&cfg.ReadTimeout, "read-timeout", "READ_TIMEOUT", DefaultReadTimeout, "how long a client has to send the whole request, body included")
+	l.duration(&cfg.WriteTimeout, "write-timeout", "WRITE_TIMEOUT", DefaultWriteTimeout, "how long a response may take to write, except on the streaming routes")
+	l.duration(&cfg.IdleTimeout, "idle-timeout", "IDLE_TIMEOUT", DefaultIdleTimeout, "how long a keep-alive connection may wait for the next request")
+	l.int64(&maxHeaderBytes, "max-header-bytes", "MAX_HEADER_BYTES", DefaultMaxHeaderBytes, "maximum size of the request headers")
+	l.string(&cfg.Store, "store", "STORE", StoreMemory, "store backend: "+strings.Join(Stores, ", "))
+	l.level(&cfg.LogLevel, "log-level", "LOG_LEVEL", slog.LevelInfo, "log level: debug, info, warn or error")
+	l.int64(&cfg.MaxBodyBytes, "max-body-bytes", "MAX_BODY_BYTES", handlers.DefaultMaxBodyBytes, "maximum size of a request body")
+	l.int64(&cfg.MaxBatchBodyBytes, "max-batch-body-bytes", "MAX_BATCH_BODY_BYTES", handlers.DefaultMaxBatchBodyBytes, "maximum size of a batch request body")
+	l.int64(&maxBatchSize, "max-batch-size", "MAX_BATCH_SIZE", services.DefaultMaxBatchSize, "maximum number of transactions in a batch request")
+	l.float64(&cfg.MaxAmount, "max-amount", "MAX_AMOUNT", services.DefaultConfig().MaxDepositAmount, "maximum amount of a deposit or a withdrawal")
+	l.int64(&defaultPageSize, "default-page-size", "DEFAULT_PAGE_SIZE", handlers.DefaultPageSize, "pageSize of a history page that doesn't name one")
+	l.bool(&cfg.ClampPageSize, "clamp-page-size", "CLAMP_PAGE_SIZE", false, "cap pageSize and limit at the maximum instead of rejecting the request")
+	l.bool(&cfg.StrictQuery, "strict-query", "STRICT_QUERY", true, "reject unknown query parameters under "+handlers.APIPrefix)
+	l.bool(&cfg.StrictLegacyQuery, "strict-query-legacy", "STRICT_QUERY_LEGACY", false, "reject unknown query parameters on the unprefixed paths too")
+	l.string(&cfg.JWTSecret, "jwt-secret", "JWT_SECRET", "", "HS256 secret of the client tokens")
+	l.string(&cfg.JWKSURL, "jwks-url", "JWKS_URL", "", "JWKS URL of the RS256 client tokens")
+	l.string(&cfg.SigningSecrets, "signing-secrets", "SIGNING_SECRETS", "", "comma separated client:secret pairs of the server-to-server callers, every request must then be HMAC signed")
+	l.float64(&cfg.RateLimit, "rate-limit", "RATE_LIMIT_RPS", 0, "requests per second per user or IP, zero disables the limit")
+	l.int64(&rateBurst, "rate-burst", "RATE_LIMIT_BURST", 20, "requests a user or IP may burst above the rate")
+	l.string(&cfg.TrustedProxies, "trusted-proxies", "TRUSTED_PROXIES", "", "comma separated CIDRs of the proxies whose X-Forwarded-For and X-Real-IP name the client")
+	l.bool(&cfg.TrustForwarded, "trust-forwarded-headers", "TRUST_FORWARDED_HEADERS", false, "build links from X-Forwarded-Proto and X-Forwarded-Host")
+	l.string(&cfg.AdminAPIKey, "admin-api-key", "ADMIN_API_KEY", "", "key of the admin routes in the X-Admin-Key header")
+	l.string(&cfg.AdminUser, "admin-user", "ADMIN_USER", "admin", "basic auth username of the admin routes")
+	l.string(&cfg.AdminPassword, "admin-password", "ADMIN_PASSWORD", "", "basic auth password of the admin routes")
+	l.string(&webhookURLs, "webhook-urls", "WEBHOOK_URLS", "", "comma separated URLs the transaction events are POSTed to")
+	l.string(&cfg.WebhookSecret, "webhook-secret", "WEBHOOK_SECRET", "", "shared secret of the webhook signatures")
+	l.int64(&webhookMaxAttempts, "webhook-max-attempts", "WEBHOOK_MAX_ATTEMPTS", 5, "attempts of a webhook delivery, including the first one")
+	l.string(&cfg.EventBus, "event-bus", "EVENT_BUS", eventbus.BackendNone, "message bus the transaction events are published to: "+strings.Join(eventbus.Backends, ", "))
+	l.string(&cfg.EventBusURL, "event-bus-url", "EVENT_BUS_URL", "", "Kafka REST Proxy URL (http://rest-proxy:8082) or NATS URL (nats://nats:4222) of the event bus")
+	l.string(&cfg.EventBusTopic, "event-bus-topic", "EVENT_BUS_TOPIC", "ledger.transactions", "Kafka topic or NATS subject of the transaction events")
+	l.int64(&eventBusBatchSize, "event-bus-batch-size", "EVENT_BUS_BATCH_SIZE", 100, "events per publish to the event bus")
+	l.bool(&cfg.Outbox, "outbox", "OUTBOX", false, "deliver the webhooks and the event bus from the outbox of the store, retried until they're taken")
+	l.string(&cfg.MetricsSink, "metrics-sink", "METRICS_SINK", metrics.SinkPrometheus, "where the metrics go: "+strings.Join(metrics.Sinks, ", "))
+	l.string(&cfg.StatsDAddr, "statsd-addr", "STATSD_ADDR", "127.0.0.1:8125", "UDP address of the StatsD agent of the statsd metrics sink")
+	l.string(&cfg.StatsDNamespace, "statsd-namespace", "STATSD_NAMESPACE", "", "prefix of the StatsD metric names, e.g. tinyledger.")
+	l.string(&cfg.StatsDTagFormat, "statsd-tag-format", "STATSD_TAG_FORMAT", metrics.TagsDatadog, "how the tags are written into the StatsD lines: "+strings.Join(metrics.TagFormats, ", "))
+	l.string(&cfg.PaymentsWebhookSecret, "payments-webhook-secret", "PAYMENTS_WEBHOOK_SECRET", "", "shared secret of the payment provider's notifications, empty leaves POST /integrations/payments/webhook out")
+	l.string(&cfg.SentryDSN, "sentry-dsn", "SENTRY_DSN", "", "DSN of the Sentry project the panics and 500s are reported to, empty disables the reports")
+	l.string(&cfg.SentryEnvironment, "sentry-environment", "SENTRY_ENVIRONMENT", "", "environment of the Sentry reports, e.g. production")
+	l.string(&cfg.OpsAddr, "ops-addr", "OPS_ADDR", "", "listen address of the health, metrics, debug and admin routes, e.g. 127.0.0.1:9090, empty serves them on addr")
+	l.string(&cfg.GRPCAddr, "grpc-addr", "GRPC_ADDR", "", "listen address of the gRPC API, e.g. :9090, empty disables it")
+	l.duration(&cfg.RequestTimeout, "request-timeout", "REQUEST_TIMEOUT", handlers.DefaultRequestTimeout, "requests running longer are cancelled and answered 503, zero disables it")
+	l.duration(&cfg.ShutdownTimeout, "shutdown-timeout", "SHUTDOWN_TIMEOUT", DefaultShutdownTimeout, "how long the in-flight requests get to finish after SIGINT or SIGTERM")
+	l.duration(&cfg.SlowRequestThreshold, "slow-request-threshold", "SLOW_REQUEST_THRESHOLD", handlers.DefaultSlowRequestThreshold, "requests slower than this are logged at warn, zero disables it")
+	l.string(&cfg.OTLPEndpoint, "otlp-endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", "", "OTLP gRPC endpoint the traces are exported to, e.g. http://collector:4317, empty disables tracing")
+	l.bool(&cfg.DebugEndpoints, "debug-endpoints", "DEBUG_ENDPOINTS", false, "serve pprof and the memory statistics under /debug/")
+	l.string(&cfg.DebugAddr, "debug-addr", "DEBUG_ADDR", "", "loopback address of a separate debug listener, e.g. localhost:6060, empty mounts /debug/ on the main listener")
+	l.string(&cfg.Tenants, "tenants", "TENANTS", "", "comma separated tenants of the multi-tenant mode, each request names one in "+handlers.TenantHeader+". empty serves a single ledger")
+	l.string(&cfg.Seed, "seed", "SEED", "", "JSON fixture of users and transactions loaded at startup, e.g. testdata/seed.example.json")
+	l.bool(&cfg.SeedForce, "seed-force", "SEED_FORCE", false, "seed a store that already has records")
+	l.string(&legacySunset, "legacy-sunset", "LEGACY_SUNSET", "2027-04-16", "date (YYYY-MM-DD) the unprefixed API paths stop working, announced in the Sunset header")
+
+	if err := errors.Join(l.errs...); err != nil {
+		return Config{}, err
+	}
+	if err := l.fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if l.fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments %q", l.fs.Args())
+	}
+	if version {
+		return Config{}, ErrVersion
+	}
+
+	cfg.MaxBatchSize, cfg.RateBurst, cfg.WebhookMaxAttempts = int(maxBatchSize), int(rateBurst), int(webhookMaxAttempts)
+	cfg.DefaultPageSize, cfg.MaxHeaderBytes, cfg.EventBusBatchSize = int(defaultPageSize), int(maxHeaderBytes), int(eventBusBatchSize)
+	for _, url := range strings.Split(webhookURLs, ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			cfg.WebhookURLs = append(cfg.WebhookURLs, url)
+		}
+	}
+	sunset, err := time.Parse(time.DateOnly, legacySunset)
+	if err != nil {
+		return Config{}, fmt.Errorf("invalid legacy sunset date %q, use YYYY-MM-DD", legacySunset)
+	}
+	cfg.LegacySunset = sunset
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every invalid setting at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	errs = append(errs, validateAddr("addr", c.Addr))
+	if c.OpsAddr != "" {
+		errs = append(errs, validateAddr("ops-addr", c.OpsAddr))
+	}
+	if c.GRPCAddr != "" {
+		errs = append(errs, validateAddr("grpc-addr", c.GRPCAddr))
+	}
+	if c.PlainHTTPAddr != "" {
+		errs = append(errs, validateAddr("plain-http-addr", c.PlainHTTPAddr))
+	}
+	if c.DebugAddr != "" {
+		errs = append(errs, validateAddr("debug-addr", c.DebugAddr))
+	}
+	check((c.TLSCert == "") == (c.TLSKey == ""), "tls-cert and tls-key go together, set both or neither")
+	check(c.ClientCA == "" || c.TLSCert != "", "client-ca needs TLS, set tls-cert and tls-key")
+	check(c.PlainHTTPAddr == "" || c.TLSCert != "", "plain-http-addr is for a TLS server, set tls-cert and tls-key")
+	check(c.PlainHTTP == PlainHTTPRedirect || c.PlainHTTP == PlainHTTPReject, "unknown plain-http %q, use %s or %s", c.PlainHTTP, PlainHTTPRedirect, PlainHTTPReject)
+	check(c.Store == StoreMemory, "unknown store %q, use one of %s", c.Store, strings.Join(Stores, ", "))
+	check(c.MaxBodyBytes > 0, "max-body-bytes must be positive, got %d", c.MaxBodyBytes)
+	check(c.MaxBatchBodyBytes > 0, "max-batch-body-bytes must be positive, got %d", c.MaxBatchBodyBytes)
+	check(c.MaxBatchSize > 0, "max-batch-size must be positive, got %d", c.MaxBatchSize)
+	check(c.MaxAmount > 0, "max-amount must be positive, got %v", c.MaxAmount)
+	check(c.DefaultPageSize >= 1 && c.DefaultPageSize <= handlers.MaxPageSize,
+		"default-page-size must be between 1 and %d, got %d", handlers.MaxPageSize, c.DefaultPageSize)
+	check(c.RateLimit >= 0, "rate-limit can't be negative, got %v", c.RateLimit)
+	check(c.RateLimit == 0 || c.RateBurst >= 1, "rate-burst must be at least 1, got %d", c.RateBurst)
+	check(c.WebhookMaxAttempts >= 1, "webhook-max-attempts must be at least 1, got %d", c.WebhookMaxAttempts)
+	check(slices.Contains(eventbus.Backends, c.EventBus), "unknown event-bus %q, use one of %s", c.EventBus, strings.Join(eventbus.Backends, ", "))
+	if c.EventBus != eventbus.BackendNone && slices.Contains(eventbus.Backends, c.EventBus) {
+		_, err := eventbus.Open(c.EventBus, c.EventBusURL)
+		check(err == nil, "invalid event-bus-url %q for %s", c.EventBusURL, c.EventBus)
+		check(c.EventBusTopic != "", "event-bus-topic is required with event-bus %s", c.EventBus)
+		check(c.EventBusBatchSize >= 1, "event-bus-batch-size must be at least 1, got %d", c.EventBusBatchSize)
+	}
+	check(slices.Contains(metrics.Sinks, c.MetricsSink), "unknown metrics-sink %q, use one of %s", c.MetricsSink, strings.Join(metrics.Sinks, ", "))
+	if c.MetricsSink == metrics.SinkStatsD {
+		errs = append(errs, validateAddr("statsd-addr", c.StatsDAddr))
+		check(slices.Contains(metrics.TagFormats, c.StatsDTagFormat), "unknown statsd-tag-format %q, use one of %s", c.StatsDTagFormat, strings.Join(metrics.TagFormats, ", "))
+	}
+	if c.SentryDSN != "" {
+		// the error is about the shape, it doesn't carry the key
+		_, _, err := errreport.ParseDSN(c.SentryDSN)
+		check(err == nil, "invalid sentry-dsn: %v", err)
+	}
+	check(c.RequestTimeout >= 0, "request-timeout can't be negative, got %s", c.RequestTimeout)
+	for name, timeout := range map[string]time.Duration{
+		"read-header-timeout": c.ReadHeaderTimeout, "read-timeout": c.ReadTimeout, "write-timeout": c.WriteTimeout, "idle-timeout": c.IdleTimeout,
+	} {
+		check(timeout >= 0, "%s can't be negative, got %s", name, timeout)
+	}
+	check(c.WriteTimeout == 0 || c.RequestTimeout == 0 || c.WriteTimeout > c.RequestTimeout,
+		"write-timeout (%s) must be longer than request-timeout (%s), the 503 of a timed out request couldn't be written", c.WriteTimeout, c.RequestTimeout)
+	check(c.MaxHeaderBytes > 0, "max-header-bytes must be positive, got %d", c.MaxHeaderBytes)
+	check(c.ShutdownTimeout > 0, "shutdown-timeout must be positive, got %s", c.ShutdownTimeout)
+	check(c.SlowRequestThreshold >= 0, "slow-request-threshold can't be negative, got %s", c.SlowRequestThreshold)
+	check(c.Tenants == "" || c.GRPCAddr == "", "the gRPC API doesn't support the multi-tenant mode, unset grpc-addr or tenants")
+	check(c.Tenants == "" || !c.Outbox, "the outbox doesn't support the multi-tenant mode, unset outbox or tenants")
+	check(c.Tenants == "" || c.PaymentsWebhookSecret == "", "the payments webhook doesn't support the multi-tenant mode, unset payments-webhook-secret or tenants")
+	check(c.Tenants == "" || c.Seed == "", "seed doesn't support the multi-tenant mode, unset seed or tenants")
+	return errors.Join(errs...)
+}
+
+// validateAddr accepts host:port with an empty host and a port between 0 and 65535
+func validateAddr(name, addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %w", name, addr, err)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("invalid %s %q: bad port %q", name, addr, port)
+	}
+	return nil
+}
+
+// LogValue is the effective config without the secrets, only whether they're set
+func (c Config) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("addr", c.Addr),
+		slog.String("store", c.Store),
+		slog.String("tls_cert", c.TLSCert),
+		slog.String("client_ca", c.ClientCA),
+		slog.String("plain_http_addr", c.PlainHTTPAddr),
+		slog.String("plain_http", c.PlainHTTP),
+		slog.Duration("read_header_timeout", c.ReadHeaderTimeout),
+		slog.Duration("read_timeout", c.ReadTimeout),
+		slog.Duration("write_timeout", c.WriteTimeout),
+		slog.Duration("idle_timeout", c.IdleTimeout),
+		slog.Int("max_header_bytes", c.MaxHeaderBytes),
+		slog.String("log_level", c.LogLevel.String()),
+		slog.Int64("max_body_bytes", c.MaxBodyBytes),
+		slog.Int64("max_batch_body_bytes", c.MaxBatchBodyBytes),
+		slog.Int("max_batch_size", c.MaxBatchSize),
+		slog.Float64("max_amount", c.MaxAmount),
+		slog.Int("default_page_size", c.DefaultPageSize),
+		slog.Bool("clamp_page_size", c.ClampPageSize),
+		slog.Bool("strict_query", c.StrictQuery),
+		slog.Bool("strict_query_legacy", c.StrictLegacyQuery),
+		slog.Bool("jwt_secret_set", c.JWTSecret != ""),
+		slog.String("jwks_url", c.JWKSURL),
+		slog.Bool("signing_secrets_set", c.SigningSecrets != ""),
+		slog.Float64("rate_limit", c.RateLimit),
+		slog.Int("rate_burst", c.RateBurst),
+		slog.String("trusted_proxies", c.TrustedProxies),
+		slog.Bool("trust_forwarded_headers", c.TrustForwarded),
+		slog.Bool("admin_api_key_set", c.AdminAPIKey != ""),
+		slog.String("admin_user", c.AdminUser),
+		slog.Bool("admin_password_set", c.AdminPassword != ""),
+		// the URLs of chat webhooks carry their token, only the number is logged
+		slog.Int("webhook_urls", len(c.WebhookURLs)),
+		slog.Bool("webhook_secret_set", c.WebhookSecret != ""),
+		slog.Int("webhook_max_attempts", c.WebhookMaxAttempts),
+		slog.String("event_bus", c.EventBus),
+		slog.String("event_bus_url", redactURL(c.EventBusURL)),
+		slog.String("event_bus_topic", c.EventBusTopic),
+		slog.Int("event_bus_batch_size", c.EventBusBatchSize),
+		slog.Bool("outbox", c.Outbox),
+		slog.String("metrics_sink", c.MetricsSink),
+		slog.String("statsd_addr", c.StatsDAddr),
+		slog.String("statsd_namespace", c.StatsDNamespace),
+		slog.String("statsd_tag_format", c.StatsDTagFormat),
+		slog.Bool("payments_webhook_secret_set", c.PaymentsWebhookSecret != ""),
+		// the DSN carries the key of the project
+		slog.Bool("sentry_dsn_set", c.SentryDSN != ""),
+		slog.String("sentry_environment", c.SentryEnvironment),
+		slog.String("ops_addr", c.OpsAddr),
+		slog.String("grpc_addr", c.GRPCAddr),
+		slog.Duration("request_timeout", c.RequestTimeout),
+		slog.Duration("shutdown_timeout", c.ShutdownTimeout),
+		slog.Duration("slow_request_threshold", c.SlowRequestThreshold),
+		slog.String("otlp_endpoint", c.OTLPEndpoint),
+		slog.Bool("debug_endpoints", c.DebugEndpoints),
+		slog.String("debug_addr", c.DebugAddr),
+		slog.String("tenants", c.Tenants),
+		slog.String("legacy_sunset", c.LegacySunset.Format(time.DateOnly)),
+		slog.String("seed", c.Seed),
+		slog.Bool("seed_force", c.SeedForce),
+		slog.String("config_file", c.ConfigFile),
+	)
+}
+
+// Changes names the settings that differ in next, by their key in LogValue without the _set of the secrets
+func (c Config) Changes(next Config) []string {
+	var changes []string
+	current, other := c.LogValue().Group(), next.LogValue().Group()
+	for i, attr := range current {
+		if !attr.Value.Equal(other[i].Value) {
+			changes = append(changes, strings.TrimSuffix(attr.Key, "_set"))
+		}
+	}
+	// only whether a secret is set and the number of webhooks are logged, a new value of the same kind counts too
+	for name, changed := range map[string]bool{
+		"jwt_secret":      c.JWTSecret != next.JWTSecret,
+		"signing_secrets": c.SigningSecrets != next.SigningSecrets,
+		"admin_api_key":   c.AdminAPIKey != next.AdminAPIKey,
+		"admin_password":  c.AdminPassword != next.AdminPassword,
+		"webhook_secret":  c.WebhookSecret != next.WebhookSecret,
+		"webhook_urls":    !slices.Equal(c.WebhookURLs, next.WebhookURLs),
+		"event_bus_url":   c.EventBusURL != next.EventBusURL,
+	} {
+		if changed && !slices.Contains(changes, name) {
+			changes = append(changes, name)
+		}
+	}
+	slices.Sort(changes)
+	return changes
+}
+
+// redactURL hides the password of a URL, e.g. of the NATS credentials
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// readFile reads the KEY=VALUE lines of a config file, blank lines and lines starting with # are skipped
+func readFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CONFIG_FILE: %w", err)
+	}
+	defer file.Close()
+
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if key = strings.TrimSpace(key); !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE, got %q", path, n, line)
+		}
+		values[key] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid CONFIG_FILE: %w", err)
+	}
+	return values, nil
+}
+
+// loader registers the flags with their environment variable as the default
+type loader struct {
+	fs     *flag.FlagSet
+	getenv func(string) string
+	errs   []error // of the malformed environment variables
+}
+
+func (l *loader) string(p *string, name, env, fallback, usage string) {
+	if value := l.getenv(env); value != "" {
+		fallback = value
+	}
+	l.fs.StringVar(p, name, fallback, usage+" ("+env+")")
+}
+
+func (l *loader) int64(p *int64, name, env string, fallback int64, usage string) {
+	l.fs.Int64Var(p, name, parseEnv(l, env, fallback, func(s string) (int64, error) { return strconv.ParseInt(s, 10, 64) }), usage+" ("+env+")")
+}
+
+func (l *loader) float64(p *float64, name, env string, fallback float64, usage string) {
+	l.fs.Float64Var(p, name, parseEnv(l, env, fallback, func(s string) (float64, error) { return strconv.ParseFloat(s, 64) }), usage+" ("+env+")")
+}
+
+func (l *loader) bool(p *bool, name, env string, fallback bool, usage string) {
+	l.fs.BoolVar(p, name, parseEnv(l, env, fallback, strconv.ParseBool), usage+" ("+env+")")
+}
+
+func (l *loader) duration(p *time.Duration, name, env string, fallback time.Duration, usage string) {
+	l.fs.DurationVar(p, name, parseEnv(l, env, fallback, time.ParseDuration), usage+" ("+env+")")
+}
+
+func (l *loader) level(p *slog.Level, name, env string, fallback slog.Level, usage string) {
+	level := parseEnv(l, env, fallback, func(s string) (slog.Level, error) {
+		var level slog.Level
+		return level, level.UnmarshalText([]byte(s))
+	})
+	l.fs.TextVar(p, name, level, usage+" ("+env+")")
+}
+
+// parseEnv is the parsed environment variable, fallback when it's unset or malformed (which is recorded)
+func parseEnv[T any](l *loader, env string, fallback T, parse func(string) (T, error)) T {
+	raw := l.getenv(env)
+	if raw == "" {
+		return fallback
+	}
+	value, err := parse(raw)
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("invalid %s %q: %w", env, raw, err))
+		return fallback
+	}
+	return value
+}
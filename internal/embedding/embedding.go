@@ -0,0 +1,68 @@
+// Package embedding holds the settings of a pkg/ledger Ledger. the options of pkg/ledger are functions of Settings, so
+// only the packages of this module can write their own: cmd/server passes the metrics, the auth and the other
+// internal parts the public options don't expose, and gets the store, the service and the handler back with Into
+package embedding
+
+import (
+	"log/slog"
+
+	"tiny-ledger/internal/clock"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+type Settings struct {
+	Config services.Config
+	Clock  clock.Clock
+	Logger *slog.Logger
+
+	// Store is wrapped instead of a new memory store when set
+	Store          *store.LedgerStore
+	ServiceOptions []services.Option        // after the config and the clock
+	HandlerOptions []handlers.HandlerOption // after the clock
+
+	parts *Parts
+}
+
+// Parts are what a Ledger is built of
+type Parts struct {
+	Store   *store.LedgerStore
+	Service services.LedgerService
+	Handler *handlers.LedgerHandler
+}
+
+// WithStore wraps ledgerStore, e.g. one cmd/server opened and seeded
+func WithStore(ledgerStore *store.LedgerStore) func(*Settings) {
+	return func(s *Settings) {
+		s.Store = ledgerStore
+	}
+}
+
+// WithServiceOptions passes more options to the service
+func WithServiceOptions(opts ...services.Option) func(*Settings) {
+	return func(s *Settings) {
+		s.ServiceOptions = append(s.ServiceOptions, opts...)
+	}
+}
+
+// WithHandlerOptions passes more options to the HTTP handler
+func WithHandlerOptions(opts ...handlers.HandlerOption) func(*Settings) {
+	return func(s *Settings) {
+		s.HandlerOptions = append(s.HandlerOptions, opts...)
+	}
+}
+
+// Into fills parts once the ledger is built
+func Into(parts *Parts) func(*Settings) {
+	return func(s *Settings) {
+		s.parts = parts
+	}
+}
+
+// Built is called by the constructor of the ledger with what it built
+func (s *Settings) Built(parts Parts) {
+	if s.parts != nil {
+		*s.parts = parts
+	}
+}
@@ -0,0 +1,47 @@
+// Package errreport sends the unexpected failures of the server, the panics, the 500s and the failed integrity
+// checks, to an error tracker such as Sentry. the logs keep everything, a report only carries what identifies the
+// failure: the request ID, the route template and the method, never a body, an amount or a description
+package errreport
+
+import "context"
+
+// kinds of a report
+const (
+	KindPanic     = "panic"
+	KindInternal  = "internal_error"
+	KindIntegrity = "integrity"
+)
+
+type Report struct {
+	Kind    string            // one of the Kind constants
+	Message string            // the panic value or the error
+	Tags    map[string]string // request_id, route, method, ... see the package doc for what never goes in
+	Stack   string            // of the goroutine that hit the failure, empty when it doesn't help
+}
+
+// ErrorReporter takes the reports of the failures, Report is called on the failing path so it must not block
+type ErrorReporter interface {
+	Report(ctx context.Context, report Report)
+}
+
+// Noop drops every report, the reporter of a server without an error tracker
+var Noop ErrorReporter = noop{}
+
+type noop struct{}
+
+func (noop) Report(context.Context, Report) {}
+
+type reporterKey struct{}
+
+// NewContext returns ctx carrying the reporter, for the code that reports without holding one
+func NewContext(ctx context.Context, reporter ErrorReporter) context.Context {
+	return context.WithValue(ctx, reporterKey{}, reporter)
+}
+
+// FromContext returns the reporter of NewContext, Noop when there is none
+func FromContext(ctx context.Context) ErrorReporter {
+	if reporter, ok := ctx.Value(reporterKey{}).(ErrorReporter); ok {
+		return reporter
+	}
+	return Noop
+}
@@ -0,0 +1,28 @@
+// Package errreporttest is a reporter that keeps the reports, for the tests of what reports the failures
+package errreporttest
+
+import (
+	"context"
+	"sync"
+
+	"tiny-ledger/internal/errreport"
+)
+
+// Reporter captures the reports, safe for concurrent use
+type Reporter struct {
+	mu      sync.Mutex
+	reports []errreport.Report
+}
+
+func (r *Reporter) Report(_ context.Context, report errreport.Report) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.reports = append(r.reports, report)
+}
+
+// Reports returns a copy of the reports so far, in the order they were made
+func (r *Reporter) Reports() []errreport.Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]errreport.Report(nil), r.reports...)
+}
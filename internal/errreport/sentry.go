@@ -0,0 +1,221 @@
+package errreport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SentryConfig struct {
+	DSN         string // https://<key>@<host>/<project>, the client key of the project settings
+	Environment string // e.g. production, empty leaves it out
+	Release     string // the version of the server
+
+	QueueSize int           // reports waiting for their POST, further ones are dropped. 100 by default
+	Timeout   time.Duration // of a POST, 5s by default
+
+	Client *http.Client // a plain http.Client when nil
+	Logger *slog.Logger // slog.Default() when nil
+}
+
+// Sentry POSTs the reports to the store endpoint of a Sentry project, from a queue so the failing request never
+// waits for Sentry. a report that doesn't fit the queue or that Sentry refuses is logged and dropped
+type Sentry struct {
+	config   SentryConfig
+	endpoint string
+	auth     string // the X-Sentry-Auth header
+
+	queue   chan sentryEvent
+	closing chan struct{}
+	once    sync.Once
+	wg      sync.WaitGroup
+}
+
+// sentryEvent is the body of a POST, the subset of the Sentry event payload the reports fill
+type sentryEvent struct {
+	EventID     string            `json:"event_id"`
+	Timestamp   time.Time         `json:"timestamp"`
+	Platform    string            `json:"platform"`
+	Level       string            `json:"level"`
+	Logger      string            `json:"logger"`
+	Release     string            `json:"release,omitempty"`
+	Environment string            `json:"environment,omitempty"`
+	Message     string            `json:"message"`
+	Exception   sentryExceptions  `json:"exception"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	Extra       map[string]string `json:"extra,omitempty"`
+}
+
+type sentryExceptions struct {
+	Values []sentryException `json:"values"`
+}
+
+type sentryException struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// ParseDSN returns the store endpoint of the project and the public key of the DSN
+func ParseDSN(dsn string) (endpoint, key string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", "", errors.New("errreport: the sentry DSN must be an http or https URL")
+	}
+	key = u.User.Username()
+	if key == "" {
+		return "", "", errors.New("errreport: the sentry DSN has no public key")
+	}
+	// the project is the last segment, a Sentry served under a path keeps what's before it
+	path := strings.TrimSuffix(u.Path, "/")
+	slash := strings.LastIndex(path, "/")
+	if slash < 0 || path[slash+1:] == "" {
+		return "", "", errors.New("errreport: the sentry DSN has no project")
+	}
+	path, project := path[:slash], path[slash+1:]
+	return fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path, project), key, nil
+}
+
+// NewSentry starts the worker of the queue, Close stops it
+func NewSentry(config SentryConfig) (*Sentry, error) {
+	endpoint, key, err := ParseDSN(config.DSN)
+	if err != nil {
+		return nil, err
+	}
+	if config.QueueSize < 1 {
+		config.QueueSize = 100
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{}
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	s := &Sentry{
+		config:   config,
+		endpoint: endpoint,
+		auth:     "Sentry sentry_version=7, sentry_client=tiny-ledger/" + config.Release + ", sentry_key=" + key,
+		queue:    make(chan sentryEvent, config.QueueSize),
+		closing:  make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+// Report queues the report, it's dropped when the queue is full or the reporter is closed
+func (s *Sentry) Report(ctx context.Context, report Report) {
+	level := "error"
+	if report.Kind == KindPanic {
+		level = "fatal"
+	}
+	event := sentryEvent{
+		EventID:     strings.ReplaceAll(uuid.NewString(), "-", ""),
+		Timestamp:   time.Now().UTC(),
+		Platform:    "go",
+		Level:       level,
+		Logger:      "tiny-ledger",
+		Release:     s.config.Release,
+		Environment: s.config.Environment,
+		Message:     report.Message,
+		Exception:   sentryExceptions{Values: []sentryException{{Type: report.Kind, Value: report.Message}}},
+		Tags:        report.Tags,
+	}
+	if report.Stack != "" {
+		event.Extra = map[string]string{"stack": report.Stack}
+	}
+
+	select {
+	case <-s.closing:
+		return
+	default:
+	}
+	select {
+	case s.queue <- event:
+	default:
+		s.config.Logger.WarnContext(ctx, "error report dropped, the queue is full", "kind", report.Kind, "queue_size", s.config.QueueSize)
+	}
+}
+
+// Close sends the queued reports until ctx is done and stops the worker
+func (s *Sentry) Close(ctx context.Context) error {
+	s.once.Do(func() { close(s.closing) })
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("errreport: %d reports not sent: %w", len(s.queue), ctx.Err())
+	}
+}
+
+func (s *Sentry) run() {
+	defer s.wg.Done()
+
+	for {
+		select {
+		case event := <-s.queue:
+			s.send(event)
+		case <-s.closing:
+			// what's queued goes out before the worker stops
+			for {
+				select {
+				case event := <-s.queue:
+					s.send(event)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *Sentry) send(event sentryEvent) {
+	if err := s.post(event); err != nil {
+		s.config.Logger.Warn("could not send an error report to sentry", "event_id", event.EventID, "error", err)
+	}
+}
+
+func (s *Sentry) post(event sentryEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sentry answered %s", resp.Status)
+	}
+	return nil
+}
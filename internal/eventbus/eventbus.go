@@ -0,0 +1,322 @@
+// Package eventbus publishes the transaction events of the ledger to a message bus, a Kafka topic or a NATS subject,
+// for the consumers of the data platform. the events are queued and published in batches by a single worker in the
+// order they were committed, so the events of a user arrive in order. nothing here ever blocks or fails a write
+package eventbus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/clock"
+	"tiny-ledger/internal/metrics"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+)
+
+// SchemaVersion is the schemaVersion of the events, raised on a change consumers must know about
+const SchemaVersion = 1
+
+// the backends of Open
+const (
+	BackendNone  = "none"
+	BackendKafka = "kafka"
+	BackendNATS  = "nats"
+)
+
+// Backends are the values of Open
+var Backends = []string{BackendNone, BackendKafka, BackendNATS}
+
+// Event is the value of every message
+type Event struct {
+	SchemaVersion int                      `json:"schemaVersion"`
+	ID            uuid.UUID                `json:"id"`
+	Type          string                   `json:"type"`             // transaction.deposit or transaction.withdrawal
+	Tenant        string                   `json:"tenant,omitempty"` // in multi-tenant mode
+	UserID        string                   `json:"userId"`
+	Transaction   models.TransactionRecord `json:"transaction"`
+	Balance       float64                  `json:"balance"` // of the user right after the transaction
+	Timestamp     time.Time                `json:"timestamp"`
+}
+
+// Message is an event ready to publish. Key is the user, prefixed by the tenant in multi-tenant mode, so Kafka keeps
+// the events of a user on one partition
+type Message struct {
+	Key   string
+	Value []byte
+}
+
+// Broker is a backend of the publisher. Publish sends the batch to topic in order and fails if any message wasn't
+// taken, the whole batch is then published again: a consumer may see a message twice and drops it by its id. the
+// slice is reused after the call
+type Broker interface {
+	Publish(ctx context.Context, topic string, messages []Message) error
+	Close() error
+}
+
+// Open connects to the backend at url, the connection is made by the first publish
+func Open(backend, url string) (Broker, error) {
+	switch backend {
+	case BackendNone:
+		return Noop{}, nil
+	case BackendKafka:
+		return NewKafka(url)
+	case BackendNATS:
+		return NewNATS(url)
+	}
+	return nil, fmt.Errorf("eventbus: unknown backend %q", backend)
+}
+
+// Noop is the backend of BackendNone, every message is taken and goes nowhere
+type Noop struct{}
+
+func (Noop) Publish(context.Context, string, []Message) error { return nil }
+func (Noop) Close() error                                     { return nil }
+
+type Config struct {
+	Broker Broker
+	Topic  string // the Kafka topic or the NATS subject
+
+	BatchSize      int           // messages per publish, 100 by default
+	FlushInterval  time.Duration // how long a batch waits to fill up, 100ms by default
+	MaxAttempts    int           // of a batch, including the first one. 5 by default
+	InitialBackoff time.Duration // before the first retry, doubled on every retry up to MaxBackoff. 500ms by default
+	MaxBackoff     time.Duration // 30s by default
+	QueueSize      int           // pending events, further events are dropped. 10000 by default
+
+	Logger  *slog.Logger // slog.Default() when nil
+	Metrics *metrics.Metrics
+	Clock   clock.Clock // of the event timestamps, clock.Real when nil
+}
+
+type Publisher struct {
+	config Config
+	queue  chan Message
+
+	ctx       context.Context // of the publishes, cancelled when the context of Close is done
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	closing   chan struct{}
+	closeCtx  context.Context // of the last flush, set before closing is closed
+	done      chan struct{}
+}
+
+// New starts the worker of the publisher, Close stops it
+func New(config Config) (*Publisher, error) {
+	if config.Broker == nil {
+		return nil, errors.New("eventbus: no broker")
+	}
+	if config.Topic == "" {
+		return nil, errors.New("eventbus: no topic")
+	}
+
+	if config.BatchSize < 1 {
+		config.BatchSize = 100
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 100 * time.Millisecond
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 5
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = 500 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 30 * time.Second
+	}
+	if config.QueueSize < 1 {
+		config.QueueSize = 10000
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	p := &Publisher{
+		config:  config,
+		queue:   make(chan Message, config.QueueSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	go p.run()
+	return p, nil
+}
+
+// Handle queues the event, it's meant to be passed to LedgerService.Subscribe: the events come in commit order
+func (p *Publisher) Handle(event services.TransactionEvent) {
+	p.enqueue("", event)
+}
+
+// HandleTenant is Handle for the ledger of a tenant, the events name the tenant
+func (p *Publisher) HandleTenant(tenant string) func(services.TransactionEvent) {
+	return func(event services.TransactionEvent) {
+		p.enqueue(tenant, event)
+	}
+}
+
+// newMessage encodes the event, keyed by its user
+func newMessage(id uuid.UUID, tenant string, event services.TransactionEvent, timestamp time.Time) (Message, error) {
+	value, err := json.Marshal(Event{
+		SchemaVersion: SchemaVersion,
+		ID:            id,
+		Type:          "transaction." + string(event.Transaction.Type),
+		Tenant:        tenant,
+		UserID:        event.UserID,
+		Transaction:   event.Transaction,
+		Balance:       event.Balance,
+		Timestamp:     timestamp.UTC(),
+	})
+	key := event.UserID
+	if tenant != "" {
+		key = tenant + "/" + event.UserID
+	}
+	return Message{Key: key, Value: value}, err
+}
+
+func (p *Publisher) enqueue(tenant string, event services.TransactionEvent) {
+	message, err := newMessage(uuid.New(), tenant, event, p.config.Clock.Now())
+	if err != nil {
+		p.config.Logger.Error("encoding bus event", "user_id", event.UserID, "error", err)
+		p.config.Metrics.ObserveBusEvents(metrics.BusFailed, 1)
+		return
+	}
+
+	select {
+	case <-p.closing:
+		p.config.Metrics.ObserveBusEvents(metrics.BusDropped, 1)
+	case p.queue <- message:
+	default:
+		p.config.Metrics.ObserveBusEvents(metrics.BusDropped, 1)
+		p.config.Logger.Warn("bus queue full, event dropped", "topic", p.config.Topic, "user_id", event.UserID)
+	}
+}
+
+// Pending is an event for Deliver, ID is its id on every attempt
+type Pending struct {
+	ID        uuid.UUID
+	Event     services.TransactionEvent
+	Timestamp time.Time
+}
+
+// Deliver publishes the events in one batch at once, bypassing the queue, for a caller that keeps the events and
+// retries on its own like the outbox
+func (p *Publisher) Deliver(ctx context.Context, events []Pending) error {
+	messages := make([]Message, len(events))
+	for i, pending := range events {
+		message, err := newMessage(pending.ID, "", pending.Event, pending.Timestamp)
+		if err != nil {
+			return err
+		}
+		messages[i] = message
+	}
+	err := p.config.Broker.Publish(ctx, p.config.Topic, messages)
+	if err == nil {
+		p.config.Metrics.ObserveBusEvents(metrics.BusPublished, len(messages))
+	}
+	return err
+}
+
+// Close publishes the events still queued until ctx is done, what's left then is dropped, and closes the broker
+func (p *Publisher) Close(ctx context.Context) error {
+	p.closeOnce.Do(func() {
+		p.closeCtx = ctx
+		close(p.closing)
+	})
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		// a batch still retrying gives up
+		p.cancel()
+		<-p.done
+	}
+	p.cancel()
+	return p.config.Broker.Close()
+}
+
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	batch := make([]Message, 0, p.config.BatchSize)
+	var flush <-chan time.Time // armed by the first message of a batch
+	for {
+		select {
+		case message := <-p.queue:
+			batch = append(batch, message)
+			if len(batch) == 1 {
+				flush = time.After(p.config.FlushInterval)
+			}
+			if len(batch) < p.config.BatchSize {
+				continue
+			}
+		case <-flush:
+		case <-p.closing:
+			p.drain(batch)
+			return
+		}
+		p.publish(p.ctx, batch)
+		batch, flush = batch[:0], nil
+	}
+}
+
+// drain publishes the batch and what's queued behind it with the context of Close
+func (p *Publisher) drain(batch []Message) {
+	for {
+	fill:
+		for len(batch) < p.config.BatchSize {
+			select {
+			case message := <-p.queue:
+				batch = append(batch, message)
+			default:
+				break fill
+			}
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if p.closeCtx.Err() != nil {
+			p.config.Metrics.ObserveBusEvents(metrics.BusDropped, len(batch)+len(p.queue))
+			p.config.Logger.Warn("bus events dropped on close", "topic", p.config.Topic, "events", len(batch)+len(p.queue))
+			return
+		}
+		p.publish(p.closeCtx, batch)
+		batch = batch[:0]
+	}
+}
+
+// publish sends the batch until the broker takes it or MaxAttempts is reached, waiting a doubling backoff in
+// between. the next batch waits, so the events of a user are never reordered
+func (p *Publisher) publish(ctx context.Context, batch []Message) {
+	backoff := p.config.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := p.config.Broker.Publish(ctx, p.config.Topic, batch)
+		if err == nil {
+			p.config.Metrics.ObserveBusEvents(metrics.BusPublished, len(batch))
+			return
+		}
+
+		if attempt >= p.config.MaxAttempts || ctx.Err() != nil {
+			p.config.Logger.Error("bus publish failed", "topic", p.config.Topic, "events", len(batch), "attempts", attempt, "error", err)
+			p.config.Metrics.ObserveBusEvents(metrics.BusFailed, len(batch))
+			return
+		}
+		p.config.Logger.Warn("bus publish failed, retrying", "topic", p.config.Topic, "events", len(batch), "attempt", attempt, "backoff", backoff, "error", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, p.config.MaxBackoff)
+	}
+}
@@ -0,0 +1,286 @@
+package eventbus_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/eventbus"
+	"tiny-ledger/internal/eventbus/eventbustest"
+	"tiny-ledger/internal/metrics"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+const topic = "ledger.transactions"
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+func newTestPublisher(t *testing.T, config eventbus.Config) *eventbus.Publisher {
+	t.Helper()
+
+	config.Topic, config.Logger = topic, discardLogger
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = time.Millisecond
+	}
+	if config.FlushInterval == 0 {
+		config.FlushInterval = 5 * time.Millisecond
+	}
+	p, err := eventbus.New(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { p.Close(context.Background()) })
+	return p
+}
+
+func scrape(m *metrics.Metrics) string {
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	return rr.Body.String()
+}
+
+// waitForMetrics polls the scrape, the counters are updated right after the broker answers
+func waitForMetrics(t *testing.T, m *metrics.Metrics, want ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, w := range want {
+		for !strings.Contains(scrape(m), w) {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %q in the scrape", w)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+}
+
+func TestPublishKeepsTheOrderOfEveryUser(t *testing.T) {
+	broker := eventbustest.NewBroker()
+	m := metrics.New(func() (int, float64) { return 0, 0 })
+	p := newTestPublisher(t, eventbus.Config{Broker: broker, BatchSize: 7, Metrics: m})
+	// the first batches fail and are published again, before the ones behind them
+	broker.Fail(2)
+
+	svc := services.NewLedgerService(store.NewLedgerStore())
+	svc.Subscribe(p.Handle)
+	users := []string{"alice", "bob", "carol", "dave"}
+	var wg sync.WaitGroup
+	for _, user := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= 25; i++ {
+				if _, err := svc.RecordTransaction(user, models.Deposit, float64(i), ""); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	events := broker.WaitFor(t, topic, 100)
+	last := make(map[string]float64)
+	for i, event := range events {
+		if event.SchemaVersion != eventbus.SchemaVersion || event.Type != "transaction.deposit" || broker.Messages(topic)[i].Key != event.UserID {
+			t.Fatalf("unexpected event %+v", event)
+		}
+		if event.Transaction.Amount != last[event.UserID]+1 {
+			t.Fatalf("expected deposit %v of %s, got %v", last[event.UserID]+1, event.UserID, event.Transaction.Amount)
+		}
+		last[event.UserID] = event.Transaction.Amount
+	}
+	if broker.Batches() < 100/7 {
+		t.Errorf("expected the events in batches of at most 7, got %d batches", broker.Batches())
+	}
+	waitForMetrics(t, m, `ledger_bus_events_total{outcome="published"} 100`)
+}
+
+func TestPublishGivesUp(t *testing.T) {
+	broker := eventbustest.NewBroker()
+	m := metrics.New(func() (int, float64) { return 0, 0 })
+	p := newTestPublisher(t, eventbus.Config{Broker: broker, MaxAttempts: 3, Metrics: m})
+	broker.Fail(3)
+
+	svc := services.NewLedgerService(store.NewLedgerStore())
+	svc.Subscribe(p.HandleTenant("staging"))
+	svc.RecordTransaction("alice", models.Deposit, 1, "")
+	waitForMetrics(t, m, `ledger_bus_events_total{outcome="failed"} 1`)
+
+	// the broker is back for the next event
+	svc.RecordTransaction("alice", models.Deposit, 2, "")
+	events := broker.WaitFor(t, topic, 1)
+	if events[0].Transaction.Amount != 2 || events[0].Tenant != "staging" || broker.Messages(topic)[0].Key != "staging/alice" {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
+
+// stuckBroker takes nothing until released
+type stuckBroker struct {
+	release chan struct{}
+}
+
+func (b *stuckBroker) Publish(ctx context.Context, topic string, messages []eventbus.Message) error {
+	select {
+	case <-b.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *stuckBroker) Close() error { return nil }
+
+func TestWritesNeverWaitForTheBroker(t *testing.T) {
+	broker := &stuckBroker{release: make(chan struct{})}
+	defer close(broker.release)
+	m := metrics.New(func() (int, float64) { return 0, 0 })
+	p := newTestPublisher(t, eventbus.Config{Broker: broker, BatchSize: 1, QueueSize: 1, Metrics: m})
+
+	svc := services.NewLedgerService(store.NewLedgerStore())
+	svc.Subscribe(p.Handle)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 20 {
+			if _, err := svc.RecordTransaction("alice", models.Deposit, 1, ""); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the writes waited for the broker")
+	}
+	waitForMetrics(t, m, `ledger_bus_events_total{outcome="dropped"}`)
+}
+
+func TestCloseFlushesTheQueue(t *testing.T) {
+	broker := eventbustest.NewBroker()
+	p, err := eventbus.New(eventbus.Config{Broker: broker, Topic: topic, FlushInterval: time.Hour, Logger: discardLogger})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i := range 3 {
+		p.Handle(services.TransactionEvent{UserID: "alice", Transaction: models.TransactionRecord{Type: models.Deposit, Amount: float64(i)}})
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if messages := broker.Messages(topic); len(messages) != 3 {
+		t.Errorf("expected the 3 queued events published on close, got %d", len(messages))
+	}
+}
+
+func TestKafka(t *testing.T) {
+	var recordErr bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Records []struct {
+				Key   string          `json:"key"`
+				Value json.RawMessage `json:"value"`
+			} `json:"records"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if r.URL.Path != "/topics/"+topic || r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" ||
+			len(body.Records) != 2 || body.Records[1].Key != "bob" || string(body.Records[1].Value) != `{"n":2}` {
+			t.Errorf("unexpected produce request %s %+v", r.URL.Path, body)
+		}
+		if recordErr {
+			fmt.Fprint(w, `{"offsets": [{"partition": 0, "offset": 1}, {"error_code": 50003, "error": "broker not available"}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"offsets": [{"partition": 0, "offset": 1}, {"partition": 1, "offset": 7}]}`)
+	}))
+	defer server.Close()
+
+	broker, err := eventbus.Open(eventbus.BackendKafka, server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	messages := []eventbus.Message{{Key: "alice", Value: []byte(`{"n":1}`)}, {Key: "bob", Value: []byte(`{"n":2}`)}}
+	if err := broker.Publish(context.Background(), topic, messages); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	recordErr = true
+	if err := broker.Publish(context.Background(), topic, messages); err == nil || !strings.Contains(err.Error(), "broker not available") {
+		t.Errorf("expected the error of the record, got %v", err)
+	}
+}
+
+func TestNATS(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer listener.Close()
+	received := make(chan string, 10)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		fmt.Fprint(conn, "INFO {\"server_id\":\"fake\"}\r\n")
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch fields[0] {
+			case "CONNECT":
+				received <- strings.TrimSpace(line)
+			case "PUB":
+				var size int
+				fmt.Sscan(fields[2], &size)
+				payload := make([]byte, size+2)
+				io.ReadFull(reader, payload)
+				received <- fields[1] + " " + string(payload[:size])
+			case "PING":
+				fmt.Fprint(conn, "PONG\r\n")
+			}
+		}
+	}()
+
+	broker, err := eventbus.Open(eventbus.BackendNATS, "nats://ledger:secret@"+listener.Addr().String())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer broker.Close()
+	messages := []eventbus.Message{{Key: "alice", Value: []byte(`{"n":1}`)}, {Key: "bob", Value: []byte(`{"n":2}`)}}
+	if err := broker.Publish(context.Background(), topic, messages); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if connect := <-received; !strings.Contains(connect, `"user":"ledger"`) || !strings.Contains(connect, `"pass":"secret"`) {
+		t.Errorf("expected the credentials in the CONNECT, got %s", connect)
+	}
+	for _, expected := range []string{topic + ` {"n":1}`, topic + ` {"n":2}`} {
+		if got := <-received; got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+}
+
+func TestOpenRejectsInvalidURLs(t *testing.T) {
+	for backend, url := range map[string]string{eventbus.BackendKafka: "kafka:9092", eventbus.BackendNATS: "http://nats:4222", "rabbitmq": "amqp://rabbit"} {
+		if _, err := eventbus.Open(backend, url); err == nil {
+			t.Errorf("expected %s %s to be rejected", backend, url)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+// Package eventbustest is an in-memory broker for the tests of the publisher and of what it's wired into
+package eventbustest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/eventbus"
+)
+
+// ErrUnavailable is the error of a publish Broker.Fail made fail
+var ErrUnavailable = errors.New("broker unavailable")
+
+// Broker keeps the messages it takes by topic, safe for concurrent use
+type Broker struct {
+	mu       sync.Mutex
+	messages map[string][]eventbus.Message
+	batches  int
+	failures int // publishes left to fail
+	arrived  chan struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{messages: make(map[string][]eventbus.Message), arrived: make(chan struct{}, 1)}
+}
+
+// Fail makes the next n publishes fail with ErrUnavailable, nothing of their batch is taken
+func (b *Broker) Fail(n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = n
+}
+
+func (b *Broker) Publish(ctx context.Context, topic string, messages []eventbus.Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures > 0 {
+		b.failures--
+		return ErrUnavailable
+	}
+	b.messages[topic] = append(b.messages[topic], messages...)
+	b.batches++
+	select {
+	case b.arrived <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (b *Broker) Close() error {
+	return nil
+}
+
+// Messages are the messages published to topic, in order
+func (b *Broker) Messages(topic string) []eventbus.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]eventbus.Message(nil), b.messages[topic]...)
+}
+
+// Batches is how many publishes succeeded
+func (b *Broker) Batches() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.batches
+}
+
+// WaitFor waits until topic has n messages and returns their events, in order
+func (b *Broker) WaitFor(t *testing.T, topic string, n int) []eventbus.Event {
+	t.Helper()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		if messages := b.Messages(topic); len(messages) >= n {
+			events := make([]eventbus.Event, len(messages))
+			for i, message := range messages {
+				if err := json.Unmarshal(message.Value, &events[i]); err != nil {
+					t.Fatalf("invalid event %s: %v", message.Value, err)
+				}
+			}
+			return events
+		}
+		select {
+		case <-b.arrived:
+		case <-deadline:
+			t.Fatalf("expected %d messages on %s, got %d", n, topic, len(b.Messages(topic)))
+		}
+	}
+}
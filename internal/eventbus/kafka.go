@@ -0,0 +1,84 @@
+package eventbus
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Kafka publishes through a Kafka REST Proxy (v2 API), e.g. http://rest-proxy:8082: the module has no Kafka client
+// and the proxy keeps the brokers, the partitioning and the acks on its side. the key is the user, so the events of
+// a user go to one partition in order
+type Kafka struct {
+	url    string
+	client *http.Client
+}
+
+func NewKafka(rawURL string) (*Kafka, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("eventbus: invalid Kafka REST Proxy URL %q", rawURL)
+	}
+	return &Kafka{url: strings.TrimSuffix(rawURL, "/"), client: &http.Client{}}, nil
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Publish POSTs the batch as one produce request, a record the proxy couldn't write fails the batch
+func (k *Kafka) Publish(ctx context.Context, topic string, messages []Message) error {
+	records := make([]kafkaRecord, len(messages))
+	for i, message := range messages {
+		records[i] = kafkaRecord{Key: message.Key, Value: message.Value}
+	}
+	body, err := json.Marshal(map[string]any{"records": records})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.url+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return fmt.Errorf("kafka REST proxy answered %d", resp.StatusCode)
+	}
+
+	var produced struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&produced); err != nil {
+		return fmt.Errorf("kafka REST proxy: %w", err)
+	}
+	var errs []error
+	for i, offset := range produced.Offsets {
+		if offset.ErrorCode != nil {
+			errs = append(errs, fmt.Errorf("record %d: %s (%d)", i, offset.Error, *offset.ErrorCode))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (k *Kafka) Close() error {
+	k.client.CloseIdleConnections()
+	return nil
+}
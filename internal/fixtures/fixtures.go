@@ -0,0 +1,185 @@
+// Package fixtures seeds a store with users and transaction histories described in JSON, for local development and
+// tests. the timestamps can be relative to the clock of the store ("-3d", "-2h30m") so the data always looks recent
+package fixtures
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+// File is the JSON document of a fixture
+type File struct {
+	Users []User `json:"users"`
+}
+
+type User struct {
+	ID string `json:"id"`
+	// MinimumBalance is set once the transactions are in, so the history doesn't have to respect it
+	MinimumBalance float64       `json:"minimumBalance,omitempty"`
+	Transactions   []Transaction `json:"transactions,omitempty"`
+}
+
+type Transaction struct {
+	Type        models.TransactionType `json:"type"`
+	Amount      float64                `json:"amount"`
+	Fee         float64                `json:"fee,omitempty"` // of a withdrawal
+	Description string                 `json:"description,omitempty"`
+	ReferenceID string                 `json:"referenceId,omitempty"`
+	// Timestamp is RFC 3339 or relative to the clock of the store, e.g. -3d or -1w2d12h, now when empty
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+// Summary is what Load created
+type Summary struct {
+	Users        int
+	Transactions int
+}
+
+// the limits of the service, a fixture must not create records the API couldn't have
+var userIdRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,50}$`)
+
+const maxReferenceLength = 64
+
+// Load reads a fixture from r and adds its users and transactions to s through the bulk insert of every user, so the
+// balances, the minimum balances and the references are checked like on a batch. the whole file is validated before
+// anything is written, a store rule broken by a later user (e.g. a withdrawal over the balance) leaves the users
+// before it loaded
+func Load(s *store.LedgerStore, r io.Reader) (Summary, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var file File
+	if err := dec.Decode(&file); err != nil {
+		return Summary{}, fmt.Errorf("invalid fixture: %w", err)
+	}
+
+	now := s.Clock().Now()
+	records := make([][]models.TransactionRecord, len(file.Users))
+	seen := make(map[string]bool)
+	for i, user := range file.Users {
+		if !userIdRegex.MatchString(user.ID) {
+			return Summary{}, fmt.Errorf("user %d: invalid user ID %q", i, user.ID)
+		}
+		if seen[user.ID] {
+			return Summary{}, fmt.Errorf("user %s: listed twice", user.ID)
+		}
+		seen[user.ID] = true
+		if user.MinimumBalance < 0 {
+			return Summary{}, fmt.Errorf("user %s: the minimum balance can't be negative", user.ID)
+		}
+		if s.UserExists(user.ID) {
+			return Summary{}, fmt.Errorf("user %s: %w", user.ID, store.ErrUserExists)
+		}
+
+		for j, tx := range user.Transactions {
+			record, err := tx.record(now)
+			if err != nil {
+				return Summary{}, fmt.Errorf("user %s, transaction %d: %w", user.ID, j, err)
+			}
+			records[i] = append(records[i], record)
+		}
+		// the balance checks of the bulk insert go in order, the file doesn't have to
+		slices.SortStableFunc(records[i], func(a, b models.TransactionRecord) int { return a.Timestamp.Compare(b.Timestamp) })
+	}
+
+	var summary Summary
+	for i, user := range file.Users {
+		if err := s.CreateUser(user.ID); err != nil {
+			return summary, fmt.Errorf("user %s: %w", user.ID, err)
+		}
+		if _, err := s.InsertTransactions(user.ID, records[i]); err != nil {
+			return summary, fmt.Errorf("user %s: %w", user.ID, err)
+		}
+		if user.MinimumBalance > 0 {
+			s.SetMinimumBalance(user.ID, user.MinimumBalance)
+		}
+		summary.Users++
+		summary.Transactions += len(records[i])
+	}
+	return summary, nil
+}
+
+func (tx Transaction) record(now time.Time) (models.TransactionRecord, error) {
+	var errs []error
+	if tx.Type != models.Deposit && tx.Type != models.Withdrawal {
+		errs = append(errs, fmt.Errorf("invalid type %q, expected deposit or withdrawal", tx.Type))
+	}
+	if tx.Amount <= 0 {
+		errs = append(errs, fmt.Errorf("the amount must be positive, got %v", tx.Amount))
+	}
+	if tx.Fee < 0 || (tx.Fee > 0 && tx.Type != models.Withdrawal) {
+		errs = append(errs, fmt.Errorf("invalid fee %v, only a withdrawal has one", tx.Fee))
+	}
+	if len(tx.ReferenceID) > maxReferenceLength {
+		errs = append(errs, fmt.Errorf("the reference is longer than %d characters", maxReferenceLength))
+	}
+	timestamp, err := resolveTimestamp(tx.Timestamp, now)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	return models.TransactionRecord{
+		ID:          uuid.New(),
+		Type:        tx.Type,
+		Amount:      tx.Amount,
+		Fee:         tx.Fee,
+		Description: tx.Description,
+		ReferenceID: tx.ReferenceID,
+		Timestamp:   timestamp,
+	}, nil
+}
+
+// relativeUnits are the units of a relative timestamp, Go's durations have no days or weeks
+var relativeUnits = map[string]time.Duration{
+	"w": 7 * 24 * time.Hour,
+	"d": 24 * time.Hour,
+	"h": time.Hour,
+	"m": time.Minute,
+	"s": time.Second,
+}
+
+var relativePart = regexp.MustCompile(`(\d+)([wdhms])`)
+
+// resolveTimestamp reads an RFC 3339 timestamp or one relative to now, which is a minus sign and whole numbers of
+// weeks, days, hours, minutes and seconds in any combination
+func resolveTimestamp(raw string, now time.Time) (time.Time, error) {
+	if raw == "" || raw == "now" {
+		return now, nil
+	}
+	if raw[0] != '-' {
+		timestamp, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339 or relative like -3d", raw)
+		}
+		return timestamp, nil
+	}
+
+	parts := relativePart.FindAllStringSubmatch(raw[1:], -1)
+	consumed := 0
+	var ago time.Duration
+	for _, part := range parts {
+		n, err := strconv.Atoi(part[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid timestamp %q: %w", raw, err)
+		}
+		ago += time.Duration(n) * relativeUnits[part[2]]
+		consumed += len(part[0])
+	}
+	if len(parts) == 0 || consumed != len(raw)-1 {
+		return time.Time{}, fmt.Errorf("invalid timestamp %q, expected RFC 3339 or relative like -3d", raw)
+	}
+	return now.Add(-ago), nil
+}
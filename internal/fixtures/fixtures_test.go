@@ -0,0 +1,114 @@
+package fixtures
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/clock/clocktest"
+	"tiny-ledger/internal/store"
+)
+
+func TestLoadExample(t *testing.T) {
+	file, err := os.Open("../../testdata/seed.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	s := store.NewLedgerStore(store.WithClock(clocktest.NewFake(clocktest.Start)))
+	summary, err := Load(s, file)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if summary != (Summary{Users: 3, Transactions: 13}) {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	if balance, _ := s.GetBalance("alice"); math.Round(balance*100) != 353905 {
+		t.Errorf("unexpected balance of alice %.2f", balance)
+	}
+	if _, minimum, _ := s.GetAvailableBalance("bob"); minimum != 100 {
+		t.Errorf("expected the minimum balance of bob, got %.2f", minimum)
+	}
+	if !s.UserExists("carol") {
+		t.Errorf("expected carol without transactions to exist")
+	}
+
+	// the relative timestamps are resolved against the clock of the store
+	latest := s.GetTransactionsInRange("alice", nil, nil)
+	if last := latest[len(latest)-1]; last.Description != "coffee" || !last.Timestamp.Equal(clocktest.Start.Add(-3*time.Hour)) {
+		t.Errorf("expected the coffee 3 hours before the clock, got %+v", last)
+	}
+	if first := s.GetTransactionsInRange("bob", nil, nil)[0]; !first.Timestamp.Equal(time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the absolute timestamp as is, got %v", first.Timestamp)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		err     string
+	}{
+		{"malformed", `{"users": [`, "invalid fixture"},
+		{"unknown field", `{"users": [{"id": "alice", "balance": 10}]}`, `unknown field "balance"`},
+		{"invalid user", `{"users": [{"id": "a!"}]}`, `user 0: invalid user ID "a!"`},
+		{"listed twice", `{"users": [{"id": "alice"}, {"id": "alice"}]}`, "user alice: listed twice"},
+		{
+			"every problem of a transaction",
+			`{"users": [{"id": "alice", "transactions": [{"type": "bonus", "amount": 0, "fee": 1, "timestamp": "-3x"}]}]}`,
+			`user alice, transaction 0: invalid type "bonus", expected deposit or withdrawal` + "\n" +
+				"the amount must be positive, got 0\ninvalid fee 1, only a withdrawal has one\n" +
+				`invalid timestamp "-3x", expected RFC 3339 or relative like -3d`,
+		},
+		{
+			"over the balance",
+			`{"users": [{"id": "alice", "transactions": [{"type": "withdrawal", "amount": 10}]}]}`,
+			"user alice: transaction 0: insufficient funds",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load(store.NewLedgerStore(), strings.NewReader(tt.fixture))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestLoadIntoExistingUsers(t *testing.T) {
+	s := store.NewLedgerStore()
+	_ = s.CreateUser("bob")
+
+	// nothing is written when a user is already there, alice included
+	_, err := Load(s, strings.NewReader(`{"users": [{"id": "alice"}, {"id": "bob"}]}`))
+	if !errors.Is(err, store.ErrUserExists) || s.UserExists("alice") {
+		t.Errorf("expected bob to be refused before alice is created, got %v", err)
+	}
+}
+
+func TestResolveTimestamp(t *testing.T) {
+	now := clocktest.Start
+	for raw, expected := range map[string]time.Time{
+		"":                     now,
+		"now":                  now,
+		"-3d":                  now.AddDate(0, 0, -3),
+		"-1w2d12h":             now.Add(-9*24*time.Hour - 12*time.Hour),
+		"-90m":                 now.Add(-90 * time.Minute),
+		"2024-01-02T09:00:00Z": time.Date(2024, 1, 2, 9, 0, 0, 0, time.UTC),
+	} {
+		if got, err := resolveTimestamp(raw, now); err != nil || !got.Equal(expected) {
+			t.Errorf("expected %q to be %v, got %v %v", raw, expected, got, err)
+		}
+	}
+	for _, raw := range []string{"-", "-3", "-d", "-3d-", "-3dx2h", "3d", "+3d", "2024-01-02"} {
+		if _, err := resolveTimestamp(raw, now); err == nil {
+			t.Errorf("expected %q to be rejected", raw)
+		}
+	}
+}
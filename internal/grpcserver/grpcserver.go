@@ -0,0 +1,343 @@
+// Package grpcserver serves the ledger over gRPC (proto/ledger.proto). it wraps the same LedgerService as the REST
+// handlers, so both APIs share the store, the validation and the events
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"tiny-ledger/internal/audit"
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/ratelimit"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+	"tiny-ledger/proto/ledgerpb"
+)
+
+// errorDomain is the domain of the ErrorInfo detail on validation errors
+const errorDomain = "tiny-ledger"
+
+type Server struct {
+	ledgerpb.UnimplementedLedgerServer
+
+	service  services.LedgerService
+	logger   *slog.Logger
+	verifier *auth.Verifier
+	limiter  *ratelimit.Limiter
+	reporter errreport.ErrorReporter
+}
+
+type Option func(*Server)
+
+// WithAuth requires a bearer JWT in the authorization metadata, its subject must be the user of the request (the
+// sender of a transfer) unless it carries the admin scope. same rules as handlers.WithAuth
+func WithAuth(verifier *auth.Verifier) Option {
+	return func(s *Server) {
+		s.verifier = verifier
+	}
+}
+
+// WithRateLimit limits the calls per authenticated user, or per user of the request without auth
+func WithRateLimit(limiter *ratelimit.Limiter) Option {
+	return func(s *Server) {
+		s.limiter = limiter
+	}
+}
+
+// WithErrorReporter reports the panics and the Internal errors of the calls, like the REST API does with
+// handlers.ErrorReportMiddleware
+func WithErrorReporter(reporter errreport.ErrorReporter) Option {
+	return func(s *Server) {
+		s.reporter = reporter
+	}
+}
+
+// New returns a grpc.Server with the ledger registered, ready to Serve a listener
+func New(service services.LedgerService, logger *slog.Logger, opts ...Option) *grpc.Server {
+	s := &Server{service: service, logger: logger, reporter: errreport.Noop}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// the recovery goes right after the logging so a panic is logged as the Internal call it became
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(s.logCalls, s.recoverPanics, s.authenticate, s.rateLimit))
+	ledgerpb.RegisterLedgerServer(server, s)
+	return server
+}
+
+func (s *Server) RecordTransaction(ctx context.Context, req *ledgerpb.RecordTransactionRequest) (*ledgerpb.RecordTransactionResponse, error) {
+	tx, err := s.service.WithContext(ctx).RecordTransactionInput(req.GetUserId(), services.TransactionInput{
+		Type:        fromProtoType(req.GetType()),
+		Amount:      req.GetAmount(),
+		Description: req.GetDescription(),
+		ReferenceID: req.GetReferenceId(),
+	})
+	if err != nil {
+		return nil, s.statusError(ctx, err)
+	}
+	return &ledgerpb.RecordTransactionResponse{Transaction: toProtoTransaction(tx)}, nil
+}
+
+func (s *Server) GetBalance(ctx context.Context, req *ledgerpb.GetBalanceRequest) (*ledgerpb.GetBalanceResponse, error) {
+	details, err := s.service.WithContext(ctx).GetBalanceDetails(req.GetUserId())
+	if err != nil {
+		return nil, s.statusError(ctx, err)
+	}
+	return &ledgerpb.GetBalanceResponse{
+		Balance:          details.Balance,
+		MinimumBalance:   details.MinimumBalance,
+		AvailableBalance: details.AvailableBalance,
+		Currency:         details.Currency,
+		AsOf:             timestamppb.New(details.AsOf),
+	}, nil
+}
+
+func (s *Server) GetTransactionHistory(ctx context.Context, req *ledgerpb.GetTransactionHistoryRequest) (*ledgerpb.GetTransactionHistoryResponse, error) {
+	var filter services.HistoryFilter
+	if req.StartTime != nil {
+		start := req.GetStartTime().AsTime()
+		filter.StartTime = &start
+	}
+	if req.EndTime != nil {
+		end := req.GetEndTime().AsTime()
+		filter.EndTime = &end
+	}
+	if req.GetType() != ledgerpb.TransactionType_TRANSACTION_TYPE_UNSPECIFIED {
+		txType := fromProtoType(req.GetType())
+		filter.Type = &txType
+	}
+
+	// the service defaults and caps the page like the REST route
+	result, err := s.service.WithContext(ctx).GetTransactionHistory(req.GetUserId(), filter, int(req.GetPage()), int(req.GetPageSize()))
+	if err != nil {
+		return nil, s.statusError(ctx, err)
+	}
+
+	response := &ledgerpb.GetTransactionHistoryResponse{
+		Transactions: make([]*ledgerpb.Transaction, 0, len(result.Transactions)),
+		TotalCount:   int32(result.TotalCount),
+		Page:         int32(result.Page),
+		PageSize:     int32(result.PageSize),
+		TotalPages:   int32(result.TotalPages),
+	}
+	for _, tx := range result.Transactions {
+		response.Transactions = append(response.Transactions, toProtoTransaction(tx))
+	}
+	return response, nil
+}
+
+func (s *Server) Transfer(ctx context.Context, req *ledgerpb.TransferRequest) (*ledgerpb.TransferResponse, error) {
+	journal, err := s.service.WithContext(ctx).Transfer(req.GetFromUserId(), req.GetToUserId(), req.GetAmount(), req.GetDescription())
+	if err != nil {
+		return nil, s.statusError(ctx, err)
+	}
+
+	response := &ledgerpb.TransferResponse{JournalId: journal.ID.String()}
+	for _, entry := range journal.Entries {
+		pbEntry := &ledgerpb.JournalEntry{UserId: entry.UserID, Transaction: toProtoTransaction(entry.Transaction)}
+		if entry.BalanceAfter != nil {
+			pbEntry.BalanceAfter = *entry.BalanceAfter
+		}
+		response.Entries = append(response.Entries, pbEntry)
+	}
+	return response, nil
+}
+
+// statusCodes maps the errors of the service and the store to a gRPC code, the first match wins
+var statusCodes = []struct {
+	err  error
+	code codes.Code
+}{
+	{store.ErrInsufficientFunds, codes.FailedPrecondition},
+	{store.ErrMinimumBalance, codes.FailedPrecondition},
+	{store.ErrUserNotFound, codes.NotFound},
+	{store.ErrTransactionNotFound, codes.NotFound},
+	{store.ErrJournalNotFound, codes.NotFound},
+	{store.ErrPossibleDuplicate, codes.AlreadyExists},
+	{store.ErrDuplicateReference, codes.AlreadyExists},
+	{store.ErrUserExists, codes.AlreadyExists},
+	{store.ErrIdempotencyKeyTaken, codes.AlreadyExists},
+	{services.ErrIdempotencyKeyReused, codes.FailedPrecondition},
+	{store.ErrAlreadyReversed, codes.FailedPrecondition},
+	{store.ErrReversalOfReversal, codes.FailedPrecondition},
+	{store.ErrAlreadyVoided, codes.FailedPrecondition},
+	{store.ErrReverseJournalLeg, codes.FailedPrecondition},
+	{store.ErrVoidJournalLeg, codes.FailedPrecondition},
+	{store.ErrBalanceNotZero, codes.FailedPrecondition},
+	{store.ErrUserHasJournals, codes.FailedPrecondition},
+	{store.ErrVersionMismatch, codes.Aborted},
+	{context.DeadlineExceeded, codes.DeadlineExceeded}, // the deadline of the call passed mid-call
+	{context.Canceled, codes.Canceled},
+}
+
+// statusError turns a failed service call into a status: validation errors are InvalidArgument with the rule in an
+// ErrorInfo, the known errors get their code from statusCodes and anything else is Internal. the cause of an Internal
+// error is logged and reported, the client only gets a generic message
+func (s *Server) statusError(ctx context.Context, err error) error {
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		st := status.New(codes.InvalidArgument, validationErr.Message)
+		info := &errdetails.ErrorInfo{Reason: validationErr.Code, Domain: errorDomain}
+		if validationErr.Field != "" {
+			info.Metadata = map[string]string{"field": validationErr.Field}
+		}
+		if detailed, detailErr := st.WithDetails(info); detailErr == nil {
+			st = detailed
+		}
+		return st.Err()
+	}
+
+	for _, candidate := range statusCodes {
+		if errors.Is(err, candidate.err) {
+			return status.Error(candidate.code, err.Error())
+		}
+	}
+
+	stack := string(debug.Stack())
+	s.logger.ErrorContext(ctx, "internal error", "error", err, "stack", stack)
+	s.report(ctx, errreport.KindInternal, err.Error(), stack)
+	return status.Error(codes.Internal, "internal server error")
+}
+
+// report sends a failure of the call to the reporter, tagged with the method and never with what the call carries
+func (s *Server) report(ctx context.Context, kind, message, stack string) {
+	method, _ := grpc.Method(ctx)
+	s.reporter.Report(ctx, errreport.Report{
+		Kind:    kind,
+		Message: message,
+		Tags:    map[string]string{"method": method, "code": codes.Internal.String()},
+		Stack:   stack,
+	})
+}
+
+func toProtoTransaction(tx models.TransactionRecord) *ledgerpb.Transaction {
+	pb := &ledgerpb.Transaction{
+		Id:          tx.ID.String(),
+		Amount:      tx.Amount,
+		Fee:         tx.Fee,
+		Type:        toProtoType(tx.Type),
+		Timestamp:   timestamppb.New(tx.Timestamp),
+		Description: tx.Description,
+		ReferenceId: tx.ReferenceID,
+		Voided:      tx.Voided,
+	}
+	if tx.JournalID != nil {
+		pb.JournalId = tx.JournalID.String()
+	}
+	return pb
+}
+
+func toProtoType(txType models.TransactionType) ledgerpb.TransactionType {
+	switch txType {
+	case models.Deposit:
+		return ledgerpb.TransactionType_TRANSACTION_TYPE_DEPOSIT
+	case models.Withdrawal:
+		return ledgerpb.TransactionType_TRANSACTION_TYPE_WITHDRAWAL
+	}
+	return ledgerpb.TransactionType_TRANSACTION_TYPE_UNSPECIFIED
+}
+
+// fromProtoType returns an empty type for UNSPECIFIED, which the service rejects like a missing JSON field
+func fromProtoType(txType ledgerpb.TransactionType) models.TransactionType {
+	switch txType {
+	case ledgerpb.TransactionType_TRANSACTION_TYPE_DEPOSIT:
+		return models.Deposit
+	case ledgerpb.TransactionType_TRANSACTION_TYPE_WITHDRAWAL:
+		return models.Withdrawal
+	}
+	return ""
+}
+
+// requestUser is the user a call acts for, the sender of a transfer
+func requestUser(req any) string {
+	switch req := req.(type) {
+	case *ledgerpb.TransferRequest:
+		return req.GetFromUserId()
+	case interface{ GetUserId() string }:
+		return req.GetUserId()
+	}
+	return ""
+}
+
+func (s *Server) logCalls(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	s.logger.InfoContext(ctx, "grpc call", "method", info.FullMethod, "code", status.Code(err).String(), "duration_ms", time.Since(start).Milliseconds())
+	return resp, err
+}
+
+// recoverPanics turns a panic of a call into Internal, grpc-go doesn't recover them and the process would go down with
+// the REST API
+func (s *Server) recoverPanics(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		stack := string(debug.Stack())
+		s.logger.ErrorContext(ctx, "panic serving grpc call", "method", info.FullMethod, "panic", recovered, "stack", stack)
+		s.report(ctx, errreport.KindPanic, fmt.Sprint(recovered), stack)
+		resp, err = nil, status.Error(codes.Internal, "internal server error")
+	}()
+	return handler(ctx, req)
+}
+
+func (s *Server) authenticate(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.verifier == nil {
+		return handler(ctx, req)
+	}
+
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "authentication required")
+	}
+	principal, err := s.verifier.Verify(token)
+	if err != nil {
+		s.logger.InfoContext(ctx, "authentication failed", "method", info.FullMethod, "error", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid or expired token")
+	}
+	if !principal.CanAccess(requestUser(req)) {
+		return nil, status.Error(codes.PermissionDenied, "token is not allowed to access this user")
+	}
+	ctx = audit.WithSource(auth.WithPrincipal(ctx, principal), audit.Source{Actor: principal.Subject})
+	return handler(ctx, req)
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if token, found := strings.CutPrefix(value, "Bearer "); found && token != "" {
+			return token, true
+		}
+	}
+	return "", false
+}
+
+func (s *Server) rateLimit(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if s.limiter == nil {
+		return handler(ctx, req)
+	}
+
+	key := "user:" + requestUser(req)
+	if principal, ok := auth.PrincipalFrom(ctx); ok {
+		key = "user:" + principal.Subject
+	}
+	if decision := s.limiter.Allow(key); !decision.Allowed {
+		return nil, status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry in %s", decision.RetryAfter.Round(time.Second))
+	}
+	return handler(ctx, req)
+}
@@ -0,0 +1,334 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/errreport/errreporttest"
+	"tiny-ledger/internal/ratelimit"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+	"tiny-ledger/proto/ledgerpb"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// setupClient serves a fresh ledger on an in-process listener and returns a client connected to it
+func setupClient(t *testing.T, opts ...Option) ledgerpb.LedgerClient {
+	t.Helper()
+	return serveService(t, services.NewLedgerService(store.NewLedgerStore()), opts...)
+}
+
+func serveService(t *testing.T, service services.LedgerService, opts ...Option) ledgerpb.LedgerClient {
+	t.Helper()
+
+	listener := bufconn.Listen(1 << 20)
+	server := New(service, discardLogger, opts...)
+	go func() { _ = server.Serve(listener) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ledgerpb.NewLedgerClient(conn)
+}
+
+func deposit(t *testing.T, client ledgerpb.LedgerClient, userId string, amount float64) *ledgerpb.Transaction {
+	t.Helper()
+
+	resp, err := client.RecordTransaction(context.Background(), &ledgerpb.RecordTransactionRequest{
+		UserId: userId,
+		Type:   ledgerpb.TransactionType_TRANSACTION_TYPE_DEPOSIT,
+		Amount: amount,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return resp.GetTransaction()
+}
+
+func assertCode(t *testing.T, err error, expected codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != expected {
+		t.Fatalf("expected code %s, got %s (%v)", expected, got, err)
+	}
+}
+
+func TestRecordTransaction(t *testing.T) {
+	client := setupClient(t)
+	deposit(t, client, "alice", 100)
+
+	tests := []struct {
+		name           string
+		request        *ledgerpb.RecordTransactionRequest
+		expectedCode   codes.Code
+		expectedReason string
+	}{
+		{"Withdrawal", &ledgerpb.RecordTransactionRequest{UserId: "alice", Type: ledgerpb.TransactionType_TRANSACTION_TYPE_WITHDRAWAL, Amount: 30, Description: "rent"}, codes.OK, ""},
+		{"Negative amount", &ledgerpb.RecordTransactionRequest{UserId: "alice", Type: ledgerpb.TransactionType_TRANSACTION_TYPE_DEPOSIT, Amount: -5}, codes.InvalidArgument, "not_positive"},
+		{"Unspecified type", &ledgerpb.RecordTransactionRequest{UserId: "alice", Amount: 5}, codes.InvalidArgument, ""},
+		{"Insufficient funds", &ledgerpb.RecordTransactionRequest{UserId: "alice", Type: ledgerpb.TransactionType_TRANSACTION_TYPE_WITHDRAWAL, Amount: 500}, codes.FailedPrecondition, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.RecordTransaction(context.Background(), tt.request)
+			assertCode(t, err, tt.expectedCode)
+
+			if tt.expectedCode == codes.OK {
+				tx := resp.GetTransaction()
+				if tx.GetId() == "" || tx.GetAmount() != tt.request.Amount || tx.GetType() != tt.request.Type || tx.GetDescription() != tt.request.Description {
+					t.Errorf("unexpected transaction: %v", tx)
+				}
+				return
+			}
+			if tt.expectedReason != "" {
+				details := status.Convert(err).Details()
+				if len(details) != 1 {
+					t.Fatalf("expected an ErrorInfo detail, got %v", details)
+				}
+				if info, ok := details[0].(*errdetails.ErrorInfo); !ok || info.GetReason() != tt.expectedReason || info.GetMetadata()["field"] != "amount" {
+					t.Errorf("expected reason %s on amount, got %v", tt.expectedReason, details[0])
+				}
+			}
+		})
+	}
+}
+
+func TestGetBalance(t *testing.T) {
+	client := setupClient(t)
+	deposit(t, client, "bob", 40)
+	deposit(t, client, "bob", 2.5)
+
+	resp, err := client.GetBalance(context.Background(), &ledgerpb.GetBalanceRequest{UserId: "bob"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.GetBalance() != 42.5 || resp.GetAvailableBalance() != 42.5 || resp.GetAsOf() == nil {
+		t.Errorf("unexpected balance: %v", resp)
+	}
+
+	_, err = client.GetBalance(context.Background(), &ledgerpb.GetBalanceRequest{UserId: ""})
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestGetTransactionHistory(t *testing.T) {
+	client := setupClient(t)
+	for i := range 5 {
+		deposit(t, client, "carol", float64(i+1))
+	}
+	if _, err := client.RecordTransaction(context.Background(), &ledgerpb.RecordTransactionRequest{
+		UserId: "carol", Type: ledgerpb.TransactionType_TRANSACTION_TYPE_WITHDRAWAL, Amount: 1,
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		request         *ledgerpb.GetTransactionHistoryRequest
+		expectedAmounts []float64
+		expectedTotal   int32
+		expectedPages   int32
+	}{
+		{"Defaults", &ledgerpb.GetTransactionHistoryRequest{UserId: "carol"}, []float64{1, 2, 3, 4, 5, 1}, 6, 1},
+		{"Second page", &ledgerpb.GetTransactionHistoryRequest{UserId: "carol", Page: 2, PageSize: 4}, []float64{5, 1}, 6, 2},
+		{"Withdrawals", &ledgerpb.GetTransactionHistoryRequest{UserId: "carol", Type: ledgerpb.TransactionType_TRANSACTION_TYPE_WITHDRAWAL}, []float64{1}, 1, 1},
+		{"Future range", &ledgerpb.GetTransactionHistoryRequest{UserId: "carol", StartTime: timestamppb.New(time.Now().Add(time.Hour))}, nil, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := client.GetTransactionHistory(context.Background(), tt.request)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.GetTotalCount() != tt.expectedTotal || resp.GetTotalPages() != tt.expectedPages {
+				t.Errorf("expected %d transactions on %d pages, got %d on %d", tt.expectedTotal, tt.expectedPages, resp.GetTotalCount(), resp.GetTotalPages())
+			}
+			if len(resp.GetTransactions()) != len(tt.expectedAmounts) {
+				t.Fatalf("expected %d transactions, got %d", len(tt.expectedAmounts), len(resp.GetTransactions()))
+			}
+			for i, tx := range resp.GetTransactions() {
+				if tx.GetAmount() != tt.expectedAmounts[i] {
+					t.Errorf("transaction %d: expected amount %v, got %v", i, tt.expectedAmounts[i], tx.GetAmount())
+				}
+			}
+		})
+	}
+
+	// the history of a bad range is rejected like on REST
+	_, err := client.GetTransactionHistory(context.Background(), &ledgerpb.GetTransactionHistoryRequest{
+		UserId:    "carol",
+		StartTime: timestamppb.New(time.Now()),
+		EndTime:   timestamppb.New(time.Now().Add(-time.Hour)),
+	})
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestTransfer(t *testing.T) {
+	client := setupClient(t)
+	deposit(t, client, "dave", 50)
+
+	resp, err := client.Transfer(context.Background(), &ledgerpb.TransferRequest{FromUserId: "dave", ToUserId: "erin", Amount: 20, Description: "lunch"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.GetJournalId() == "" || len(resp.GetEntries()) != 2 {
+		t.Fatalf("expected a journal with two entries, got %v", resp)
+	}
+	balances := map[string]float64{}
+	for _, entry := range resp.GetEntries() {
+		if entry.GetTransaction().GetJournalId() != resp.GetJournalId() {
+			t.Errorf("expected the legs to carry the journal ID, got %v", entry.GetTransaction())
+		}
+		balances[entry.GetUserId()] = entry.GetBalanceAfter()
+	}
+	if balances["dave"] != 30 || balances["erin"] != 20 {
+		t.Errorf("expected balances 30 and 20 after the transfer, got %v", balances)
+	}
+
+	_, err = client.Transfer(context.Background(), &ledgerpb.TransferRequest{FromUserId: "dave", ToUserId: "erin", Amount: 1000})
+	assertCode(t, err, codes.FailedPrecondition)
+	_, err = client.Transfer(context.Background(), &ledgerpb.TransferRequest{FromUserId: "dave", ToUserId: "dave", Amount: 1})
+	assertCode(t, err, codes.InvalidArgument)
+}
+
+func TestStrictAccountsNotFound(t *testing.T) {
+	client := serveService(t, services.NewLedgerService(store.NewLedgerStore(), services.WithConfig(services.Config{StrictAccounts: true})))
+
+	_, err := client.GetBalance(context.Background(), &ledgerpb.GetBalanceRequest{UserId: "nobody"})
+	assertCode(t, err, codes.NotFound)
+}
+
+func TestAuthentication(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	client := setupClient(t, WithAuth(verifier))
+
+	withToken := func(subject string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+authtest.Token(authtest.Secret, subject))
+	}
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		expectedCode codes.Code
+	}{
+		{"Own user", withToken("frank"), codes.OK},
+		{"Another user", withToken("grace"), codes.PermissionDenied},
+		{"No token", context.Background(), codes.Unauthenticated},
+		{"Invalid token", metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer nope"), codes.Unauthenticated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.GetBalance(tt.ctx, &ledgerpb.GetBalanceRequest{UserId: "frank"})
+			assertCode(t, err, tt.expectedCode)
+		})
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	client := setupClient(t, WithRateLimit(ratelimit.New(0.001, 2)))
+
+	for range 2 {
+		deposit(t, client, "heidi", 1)
+	}
+	_, err := client.GetBalance(context.Background(), &ledgerpb.GetBalanceRequest{UserId: "heidi"})
+	assertCode(t, err, codes.ResourceExhausted)
+
+	// the bucket is per user
+	deposit(t, client, "ivan", 1)
+}
+
+// failingService fails the balance reads with err, or panics without one
+type failingService struct {
+	services.LedgerService
+	err error
+}
+
+func (f failingService) WithContext(context.Context) services.LedgerService { return f }
+
+func (f failingService) GetBalanceDetails(string) (services.BalanceDetails, error) {
+	if f.err == nil {
+		panic("balance exploded")
+	}
+	return services.BalanceDetails{}, f.err
+}
+
+func TestPanicRecovery(t *testing.T) {
+	reporter := &errreporttest.Reporter{}
+	client := serveService(t, failingService{LedgerService: services.NewLedgerService(store.NewLedgerStore())}, WithErrorReporter(reporter))
+
+	_, err := client.GetBalance(context.Background(), &ledgerpb.GetBalanceRequest{UserId: "judy"})
+	assertCode(t, err, codes.Internal)
+	if status.Convert(err).Message() != "internal server error" {
+		t.Errorf("expected a generic message, got %v", err)
+	}
+	// the server survived the panic
+	deposit(t, client, "judy", 1)
+
+	reports := reporter.Reports()
+	if len(reports) != 1 || reports[0].Kind != errreport.KindPanic || reports[0].Message != "balance exploded" ||
+		reports[0].Tags["method"] != ledgerpb.Ledger_GetBalance_FullMethodName || reports[0].Stack == "" {
+		t.Errorf("expected the panic reported, got %+v", reports)
+	}
+}
+
+func TestStatusErrors(t *testing.T) {
+	tests := []struct {
+		err          error
+		expectedCode codes.Code
+	}{
+		{context.DeadlineExceeded, codes.DeadlineExceeded},
+		{context.Canceled, codes.Canceled},
+		{store.ErrIdempotencyKeyTaken, codes.AlreadyExists},
+		{store.ErrAlreadyReversed, codes.FailedPrecondition},
+		{store.ErrVersionMismatch, codes.Aborted},
+		{errors.New("disk on fire at /var/lib/ledger"), codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.err.Error(), func(t *testing.T) {
+			reporter := &errreporttest.Reporter{}
+			client := serveService(t, failingService{LedgerService: services.NewLedgerService(store.NewLedgerStore()), err: tt.err}, WithErrorReporter(reporter))
+
+			_, err := client.GetBalance(context.Background(), &ledgerpb.GetBalanceRequest{UserId: "judy"})
+			assertCode(t, err, tt.expectedCode)
+			if tt.expectedCode != codes.Internal {
+				return
+			}
+			// the cause is reported, never sent to the client
+			if status.Convert(err).Message() != "internal server error" {
+				t.Errorf("expected a generic message, got %v", err)
+			}
+			if reports := reporter.Reports(); len(reports) != 1 || reports[0].Kind != errreport.KindInternal || reports[0].Message != tt.err.Error() {
+				t.Errorf("expected the error reported, got %+v", reports)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+)
+
+// AdminKeyHeader carries the admin API key
+const AdminKeyHeader = "X-Admin-Key"
+
+const (
+	defaultAdminPageSize = 50
+
+	codeBalanceNotZero = "balance_not_zero"
+)
+
+// AdminCredentials protect the admin routes, a request passes with APIKey in AdminKeyHeader or with the basic auth
+// Username and Password. an empty APIKey or Password disables that way in
+type AdminCredentials struct {
+	APIKey   string
+	Username string
+	Password string
+}
+
+// WithAdmin mounts the admin routes under <prefix>/admin, they're left out entirely without this option. they don't
+// accept the bearer tokens of the ledger routes, even with the admin scope
+func WithAdmin(credentials AdminCredentials) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.admin = &credentials
+	}
+}
+
+type adminUserResponse struct {
+	UserID           string     `json:"userId"`
+	Balance          float64    `json:"balance"`
+	TransactionCount int        `json:"transactionCount"`
+	LastActivity     *time.Time `json:"lastActivity,omitempty"`
+}
+
+type adminUsersResponse struct {
+	Users      []adminUserResponse `json:"users"`
+	Pagination pagePagination      `json:"pagination"`
+}
+
+func (h *LedgerHandler) registerAdmin(r *mux.Router, prefix string) {
+	// before the tenant routes, whose subrouter would answer for it first
+	if h.reload != nil {
+		h.registerConfigReload(r, prefix)
+	}
+
+	admin := r.PathPrefix(prefix + "/admin").Subrouter()
+	admin.Use(h.authenticateAdmin)
+	if h.tenants != nil {
+		admin.Use(h.selectTenant)
+	}
+	if h.strictQuery {
+		admin.Use(h.rejectUnknownQuery(prefix))
+	}
+
+	admin.HandleFunc("/users", h.handleListUsers).Methods("GET")
+	admin.HandleFunc("/users/{userId}", h.handleDeleteUser).Methods("DELETE")
+	admin.HandleFunc("/audit", h.handleAuditEvents).Methods("GET")
+	admin.HandleFunc("/integrity", h.handleIntegrity).Methods("GET")
+	if h.outbox != nil {
+		admin.HandleFunc("/outbox", h.handleOutbox).Methods("GET")
+		admin.HandleFunc("/outbox/{id}/requeue", h.handleRequeueOutbox).Methods("POST")
+	}
+	if h.payments != nil {
+		admin.HandleFunc("/integrations/payments/dead-letters", h.handlePaymentDeadLetters).Methods("GET")
+	}
+}
+
+type adminActorKey struct{}
+
+func (h *LedgerHandler) authenticateAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if actor, ok := h.admin.allows(r); ok {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), adminActorKey{}, actor)))
+			return
+		}
+
+		h.audit(r, "admin.authentication_failed", "scheme", adminScheme(r))
+		if h.admin.Password != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="tiny-ledger admin"`)
+		}
+		sendError(w, r, http.StatusUnauthorized, ErrorResponse{Error: "admin credentials required", Code: "unauthorized"})
+	})
+}
+
+// allows checks the credentials of the request and names the actor of the audit events, the basic auth username or
+// "api-key"
+func (c *AdminCredentials) allows(r *http.Request) (actor string, ok bool) {
+	if key := r.Header.Get(AdminKeyHeader); c.APIKey != "" && key != "" {
+		return "api-key", secureEqual(key, c.APIKey)
+	}
+
+	username, password, ok := r.BasicAuth()
+	if !ok || c.Password == "" {
+		return "", false
+	}
+	// both are compared so a wrong username takes as long as a wrong password
+	usernameOK := secureEqual(username, c.Username)
+	return username, secureEqual(password, c.Password) && usernameOK
+}
+
+func secureEqual(given, expected string) bool {
+	// hashed first, ConstantTimeCompare returns right away on a length mismatch and would give the length away
+	givenSum, expectedSum := sha256.Sum256([]byte(given)), sha256.Sum256([]byte(expected))
+	return subtle.ConstantTimeCompare(givenSum[:], expectedSum[:]) == 1
+}
+
+// adminScheme is how a request tried to authenticate, for the audit event of a failure. the credentials themselves
+// are never logged
+func adminScheme(r *http.Request) string {
+	if r.Header.Get(AdminKeyHeader) != "" {
+		return "api-key"
+	}
+	if _, _, ok := r.BasicAuth(); ok {
+		return "basic"
+	}
+	return "none"
+}
+
+// handleListUsers lists every user with its balance and activity, by user ID or by balance with ?sort=balance
+func (h *LedgerHandler) handleListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	page, verr := positiveParam(query, "page", 1, 0, false)
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+	pageSize, verr := positiveParam(query, "pageSize", defaultAdminPageSize, MaxPageSize, h.clampPageSize)
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+	sort, verr := enumParam(query, "sort", string(services.SortUsersByID), string(services.SortUsersByBalance))
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+	minBalance, verr := amountParam(query, "minBalance")
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
+	result, err := h.ledger(r).ListUsers(services.UserFilter{MinBalance: minBalance, Sort: services.UserSort(sort)}, page, pageSize)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	users := make([]adminUserResponse, 0, len(result.Users))
+	for _, user := range result.Users {
+		users = append(users, adminUserResponse(user))
+	}
+	sendJSONResponse(w, r, http.StatusOK, adminUsersResponse{
+		Users:      users,
+		Pagination: h.paginate(w, r, result.Page, result.PageSize, result.TotalCount, result.TotalPages),
+	})
+}
+
+// handleDeleteUser removes a user, or with ?mode=anonymize keeps its transactions under a generated token. a non zero
+// balance is refused with a 409 carrying the balance unless ?force=true
+func (h *LedgerHandler) handleDeleteUser(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["userId"]
+	query := r.URL.Query()
+
+	force := false
+	if value := query.Get("force"); value != "" {
+		var err error
+		if force, err = strconv.ParseBool(value); err != nil {
+			h.sendValidationError(w, r, &services.ValidationError{Field: "force", Code: "invalid_value", Message: "invalid force value, use true or false"})
+			return
+		}
+	}
+	mode, verr := enumParam(query, "mode", "delete", "anonymize")
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
+	var balance float64
+	var err error
+	action := "user.deleted"
+	if mode == "anonymize" {
+		action = "user.anonymized"
+		balance, err = h.ledger(r).AnonymizeUser(userId, force)
+	} else {
+		balance, err = h.ledger(r).DeleteUser(userId, force)
+	}
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	h.audit(r, action, "userId", userId, "balance", balance, "force", force)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// audit logs an admin action with who did it and from where, the token of an anonymized user is deliberately not
+// part of it
+func (h *LedgerHandler) audit(r *http.Request, action string, attrs ...any) {
+	actor, _ := r.Context().Value(adminActorKey{}).(string)
+	h.requestLogger(r).InfoContext(r.Context(), "audit", append([]any{"action", action, "actor", actor, "client_ip", clientIP(r)}, attrs...)...)
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+var testAdminCredentials = AdminCredentials{APIKey: "admin-key", Username: "ops", Password: "s3cret"}
+
+func setupAdminRouter(t *testing.T, opts ...HandlerOption) *mux.Router {
+	t.Helper()
+
+	ledgerStore := store.NewLedgerStore()
+	router := mux.NewRouter()
+	handler := NewLedgerHandler(services.NewLedgerService(ledgerStore), discardLogger, opts...)
+	handler.RegisterRoutes(router, APIPrefix)
+	handler.RegisterLegacyRoutes(router, time.Now().AddDate(0, 6, 0))
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 12 {
+		tx := models.TransactionRecord{ID: uuid.New(), Amount: float64(10 * (i + 1)), Type: models.Deposit, Timestamp: base.Add(time.Duration(i) * time.Hour)}
+		ledgerStore.AddTransactionWithTime(fmt.Sprintf("user%02d", i), tx)
+	}
+	return router
+}
+
+func adminRequest(router *mux.Router, target string, authorize func(*http.Request)) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", target, nil)
+	if authorize != nil {
+		authorize(req)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func withAdminKey(key string) func(*http.Request) {
+	return func(req *http.Request) { req.Header.Set(AdminKeyHeader, key) }
+}
+
+func withBasicAuth(username, password string) func(*http.Request) {
+	return func(req *http.Request) { req.SetBasicAuth(username, password) }
+}
+
+func TestAdminListUsers(t *testing.T) {
+	router := setupAdminRouter(t, WithAdmin(testAdminCredentials))
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedUsers []string
+		expectedPages int
+		hasNext       bool
+	}{
+		{"Default page", "", []string{"user00", "user01", "user02"}, 1, false},
+		{"Second page", "page=2&pageSize=5", []string{"user05", "user06", "user07", "user08", "user09"}, 3, true},
+		{"Last page", "page=3&pageSize=5", []string{"user10", "user11"}, 3, false},
+		{"By balance", "sort=balance&pageSize=3", []string{"user11", "user10", "user09"}, 4, true},
+		{"Minimum balance", "minBalance=100", []string{"user09", "user10", "user11"}, 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := adminRequest(router, APIPrefix+"/admin/users?"+tt.query, withAdminKey("admin-key"))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			var body adminUsersResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("could not parse response: %v", err)
+			}
+			for i, want := range tt.expectedUsers {
+				if i >= len(body.Users) || body.Users[i].UserID != want {
+					t.Fatalf("expected users to start with %v, got %+v", tt.expectedUsers, body.Users)
+				}
+			}
+			if body.Pagination.TotalPages != tt.expectedPages {
+				t.Errorf("expected %d pages, got %d", tt.expectedPages, body.Pagination.TotalPages)
+			}
+			if (body.Pagination.Next != "") != tt.hasNext {
+				t.Errorf("expected next link=%v, got %q", tt.hasNext, body.Pagination.Next)
+			}
+			if rr.Header().Get("Link") == "" {
+				t.Error("expected a Link header")
+			}
+		})
+	}
+
+	rr := adminRequest(router, APIPrefix+"/admin/users?minBalance=120", withAdminKey("admin-key"))
+	var body adminUsersResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not parse response: %v", err)
+	}
+	want := adminUserResponse{UserID: "user11", Balance: 120, TransactionCount: 1}
+	if len(body.Users) != 1 || body.Users[0].LastActivity == nil {
+		t.Fatalf("expected user11 with its last activity, got %+v", body.Users)
+	}
+	got := body.Users[0]
+	got.LastActivity = nil
+	if got != want {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+}
+
+func TestAdminListUsersValidation(t *testing.T) {
+	router := setupAdminRouter(t, WithAdmin(testAdminCredentials))
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"Zero page", "page=0", "not_positive"},
+		{"Page size above the maximum", "pageSize=500", "out_of_range"},
+		{"Unknown sort", "sort=name", "invalid_value"},
+		{"Invalid minimum balance", "minBalance=lots", "invalid_number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := adminRequest(router, APIPrefix+"/admin/users?"+tt.query, withAdminKey("admin-key"))
+			if body := decodeErrorBody(t, rr, http.StatusBadRequest, kindValidationFailed); body.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, body.Code)
+			}
+		})
+	}
+}
+
+func TestAdminAuthentication(t *testing.T) {
+	tests := []struct {
+		name           string
+		credentials    AdminCredentials
+		authorize      func(*http.Request)
+		expectedStatus int
+		basicChallenge bool
+	}{
+		{"No credentials", testAdminCredentials, nil, http.StatusUnauthorized, true},
+		{"API key", testAdminCredentials, withAdminKey("admin-key"), http.StatusOK, false},
+		{"Wrong API key", testAdminCredentials, withAdminKey("guess"), http.StatusUnauthorized, true},
+		{"Basic auth", testAdminCredentials, withBasicAuth("ops", "s3cret"), http.StatusOK, false},
+		{"Wrong password", testAdminCredentials, withBasicAuth("ops", "guess"), http.StatusUnauthorized, true},
+		{"Wrong username", testAdminCredentials, withBasicAuth("root", "s3cret"), http.StatusUnauthorized, true},
+		{"Basic auth not configured", AdminCredentials{APIKey: "admin-key"}, withBasicAuth("", ""), http.StatusUnauthorized, false},
+		{"API key not configured", AdminCredentials{Username: "ops", Password: "s3cret"}, withAdminKey(""), http.StatusUnauthorized, true},
+		{"Ledger bearer token", testAdminCredentials, func(req *http.Request) { req.Header.Set("Authorization", "Bearer admin-key") }, http.StatusUnauthorized, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := setupAdminRouter(t, WithAdmin(tt.credentials))
+			rr := adminRequest(router, APIPrefix+"/admin/users", tt.authorize)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if rr.Code == http.StatusUnauthorized {
+				decodeErrorBody(t, rr, http.StatusUnauthorized, kindUnauthorized)
+			}
+			if challenge := rr.Header().Get("WWW-Authenticate") != ""; challenge != tt.basicChallenge {
+				t.Errorf("expected a basic auth challenge=%v, got %q", tt.basicChallenge, rr.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAdminAuthenticationAudit(t *testing.T) {
+	var logs bytes.Buffer
+	router := mux.NewRouter()
+	logger := slog.New(slog.NewJSONHandler(&logs, nil))
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), logger, WithAdmin(testAdminCredentials)).RegisterRoutes(router, APIPrefix)
+
+	req, _ := http.NewRequest("GET", APIPrefix+"/admin/users", nil)
+	req.RemoteAddr = "203.0.113.7:51234"
+	req.SetBasicAuth("ops", "hunter2")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", rr.Code)
+	}
+
+	var audit map[string]any
+	if err := json.Unmarshal(bytes.TrimSpace(logs.Bytes()), &audit); err != nil || audit["msg"] != "audit" {
+		t.Fatalf("expected one audit event, got %s", logs.String())
+	}
+	if audit["action"] != "admin.authentication_failed" || audit["client_ip"] != "203.0.113.7" || audit["scheme"] != "basic" {
+		t.Errorf("unexpected audit event: %v", audit)
+	}
+	if bytes.Contains(logs.Bytes(), []byte("hunter2")) {
+		t.Error("expected the password to stay out of the logs")
+	}
+}
+
+func TestSecureEqual(t *testing.T) {
+	tests := []struct {
+		given, expected string
+		equal           bool
+	}{
+		{"admin-key", "admin-key", true},
+		{"admin-kez", "admin-key", false},
+		{"admin", "admin-key", false},
+		{"", "admin-key", false},
+	}
+	for _, tt := range tests {
+		if equal := secureEqual(tt.given, tt.expected); equal != tt.equal {
+			t.Errorf("secureEqual(%q, %q) = %v, expected %v", tt.given, tt.expected, equal, tt.equal)
+		}
+	}
+}
+
+func TestAdminDisabled(t *testing.T) {
+	router := setupAdminRouter(t)
+
+	for _, path := range []string{APIPrefix + "/admin/users", "/admin/users"} {
+		if rr := adminRequest(router, path, withAdminKey("admin-key")); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected status 404 without WithAdmin, got %d", path, rr.Code)
+		}
+	}
+
+	doc := fetchOpenAPI(t, router)
+	if _, found := doc.Paths[APIPrefix+"/admin/users"]; found {
+		t.Error("expected the admin routes to be left out of the document")
+	}
+	if _, found := fetchOpenAPI(t, setupAdminRouter(t, WithAdmin(testAdminCredentials))).Paths[APIPrefix+"/admin/users"]["get"]; !found {
+		t.Error("expected the admin routes to be documented once enabled")
+	}
+}
+
+func TestAdminDeleteUser(t *testing.T) {
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedAction string
+	}{
+		{"Funded account", "", http.StatusConflict, ""},
+		{"Funded account anonymized", "mode=anonymize", http.StatusConflict, ""},
+		{"Forced delete", "force=true", http.StatusNoContent, "user.deleted"},
+		{"Forced anonymize", "mode=anonymize&force=true", http.StatusNoContent, "user.anonymized"},
+		{"Invalid force", "force=maybe", http.StatusBadRequest, ""},
+		{"Unknown mode", "mode=archive&force=true", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			router := mux.NewRouter()
+			logger := slog.New(slog.NewJSONHandler(&logs, nil))
+			NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), logger, WithAdmin(testAdminCredentials)).RegisterRoutes(router, APIPrefix)
+
+			postJSON(router, APIPrefix+"/users/leaver/transactions", map[string]interface{}{"amount": 75.0, "type": "deposit", "description": "salary"})
+
+			req, _ := http.NewRequest("DELETE", APIPrefix+"/admin/users/leaver?"+tt.query, nil)
+			req.SetBasicAuth("ops", "s3cret")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if rr.Code == http.StatusConflict {
+				body := decodeErrorBody(t, rr, http.StatusConflict, kindConflict)
+				if body.Code != codeBalanceNotZero || body.Balance == nil || *body.Balance != 75 {
+					t.Errorf("expected %s with the balance 75, got %+v", codeBalanceNotZero, body)
+				}
+			}
+
+			var balance balanceResponse
+			if err := json.Unmarshal(serveRequest(router, "GET", APIPrefix+"/users/leaver/balance").Body.Bytes(), &balance); err != nil {
+				t.Fatalf("could not parse response: %v", err)
+			}
+			var history historyResponse
+			if err := json.Unmarshal(serveRequest(router, "GET", APIPrefix+"/users/leaver/transactions").Body.Bytes(), &history); err != nil {
+				t.Fatalf("could not parse response: %v", err)
+			}
+			if tt.expectedAction == "" {
+				if balance.Balance != 75 {
+					t.Errorf("expected the refused user to keep its balance, got %v", balance.Balance)
+				}
+				return
+			}
+
+			// the ID reads like a user that never transacted
+			if balance.Balance != 0 || history.Pagination.TotalItems != 0 {
+				t.Errorf("expected a fresh user, got balance %v and %d transactions", balance.Balance, history.Pagination.TotalItems)
+			}
+
+			var list adminUsersResponse
+			if err := json.Unmarshal(adminRequest(router, APIPrefix+"/admin/users", withAdminKey("admin-key")).Body.Bytes(), &list); err != nil {
+				t.Fatalf("could not parse response: %v", err)
+			}
+			if tt.expectedAction == "user.anonymized" {
+				if len(list.Users) != 1 || list.Users[0].UserID == "leaver" || list.Users[0].Balance != 75 || list.Users[0].TransactionCount != 1 {
+					t.Errorf("expected the transactions to stay under a token, got %+v", list.Users)
+				}
+			} else if len(list.Users) != 0 {
+				t.Errorf("expected no user left, got %+v", list.Users)
+			}
+
+			var audit map[string]any
+			for _, line := range bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n")) {
+				var record map[string]any
+				if json.Unmarshal(line, &record) == nil && record["msg"] == "audit" {
+					audit = record
+				}
+			}
+			if audit["action"] != tt.expectedAction || audit["actor"] != "ops" || audit["userId"] != "leaver" || audit["balance"] != 75.0 {
+				t.Errorf("unexpected audit event: %v", audit)
+			}
+			if tt.expectedAction == "user.anonymized" && bytes.Contains(logs.Bytes(), []byte(list.Users[0].UserID)) {
+				t.Error("expected the token to stay out of the logs")
+			}
+		})
+	}
+
+	router := setupAdminRouter(t, WithAdmin(testAdminCredentials))
+	req, _ := http.NewRequest("DELETE", APIPrefix+"/admin/users/ghost", nil)
+	req.Header.Set(AdminKeyHeader, "admin-key")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	decodeErrorBody(t, rr, http.StatusNotFound, kindNotFound)
+}
+
+func TestConfigReload(t *testing.T) {
+	var fail error
+	router := setupAdminRouter(t, WithAdmin(testAdminCredentials), WithConfigReload(func() (ConfigReload, error) {
+		return ConfigReload{Applied: []string{"max_amount"}, RequiresRestart: []string{"addr"}}, fail
+	}))
+	reload := func(authorize func(*http.Request)) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", APIPrefix+"/admin/config/reload", nil)
+		authorize(req)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	if rr := reload(withAdminKey("wrong")); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the admin credentials, got %d", rr.Code)
+	}
+
+	rr := reload(withAdminKey(testAdminCredentials.APIKey))
+	var result ConfigReload
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); rr.Code != http.StatusOK || err != nil {
+		t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body)
+	}
+	if !slices.Equal(result.Applied, []string{"max_amount"}) || !slices.Equal(result.RequiresRestart, []string{"addr"}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	fail = errors.New("max-amount must be positive, got 0")
+	var body ErrorResponse
+	rr = reload(withAdminKey(testAdminCredentials.APIKey))
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); rr.Code != http.StatusUnprocessableEntity || err != nil || body.Code != "invalid_config" {
+		t.Errorf("expected the invalid config to be a 422, got %d: %s", rr.Code, rr.Body)
+	}
+}
+
+func TestAdminOutbox(t *testing.T) {
+	outboxStore := store.NewLedgerStore(store.WithOutbox())
+	outboxStore.AddTransaction("alice", models.Deposit, 10, "")
+	outboxStore.AddTransaction("bob", models.Deposit, 20, "")
+	dead := outboxStore.OutboxPending(time.Now(), 1)[0]
+	outboxStore.OutboxFailed(dead.ID, "webhook: target answered 503", time.Now(), true)
+	router := setupAdminRouter(t, WithAdmin(testAdminCredentials), WithOutbox(outboxStore))
+	do := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, APIPrefix+path, nil)
+		req.Header.Set(AdminKeyHeader, testAdminCredentials.APIKey)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	var body outboxResponse
+	rr := do("GET", "/admin/outbox")
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); rr.Code != http.StatusOK || err != nil {
+		t.Fatalf("unexpected response %d: %s", rr.Code, rr.Body)
+	}
+	if body.Pending != 1 || body.DeadLettered != 1 || len(body.DeadLetters) != 1 || body.DeadLetters[0].UserID != "alice" || body.DeadLetters[0].LastError == "" {
+		t.Errorf("unexpected outbox %+v", body)
+	}
+
+	rr = do("POST", fmt.Sprintf("/admin/outbox/%d/requeue", dead.ID))
+	var entry store.OutboxEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &entry); rr.Code != http.StatusOK || err != nil || entry.DeadLettered || entry.Attempts != 0 {
+		t.Errorf("expected the entry requeued, got %d: %s", rr.Code, rr.Body)
+	}
+	if stats := outboxStore.OutboxStats(); stats.Pending != 2 || stats.DeadLettered != 0 {
+		t.Errorf("expected both entries pending, got %+v", stats)
+	}
+
+	for path, expected := range map[string]int{"/admin/outbox/" + fmt.Sprint(dead.ID) + "/requeue": http.StatusNotFound, "/admin/outbox/first/requeue": http.StatusBadRequest} {
+		if rr := do("POST", path); rr.Code != expected {
+			t.Errorf("%s: expected %d, got %d", path, expected, rr.Code)
+		}
+	}
+}
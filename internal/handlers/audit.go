@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"time"
+
+	"tiny-ledger/internal/audit"
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/services"
+)
+
+type auditEventsResponse struct {
+	Events     []audit.Event  `json:"events"`
+	Pagination pagePagination `json:"pagination"`
+}
+
+// auditContext is the context of the request carrying who the audit events are recorded for
+func auditContext(r *http.Request) context.Context {
+	return audit.WithSource(r.Context(), audit.Source{Actor: requestActor(r), RequestID: RequestID(r.Context()), ClientCert: ClientCertificate(r.Context())})
+}
+
+// requestActor is the subject of the bearer token or the admin actor, empty when the request isn't authenticated
+func requestActor(r *http.Request) string {
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		return principal.Subject
+	}
+	actor, _ := r.Context().Value(adminActorKey{}).(string)
+	return actor
+}
+
+// handleAuditEvents lists the audited operations oldest first, filtered by user, time range and outcome. JSON, or CSV
+// for Accept: text/csv
+func (h *LedgerHandler) handleAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var filter audit.Filter
+	var verr *services.ValidationError
+	filter.UserID = query.Get("userId")
+	if filter.From, verr = timeParam(query, "from"); verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+	if filter.To, verr = timeParam(query, "to"); verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+	if filter.Outcome, verr = enumParam(query, "outcome", audit.OutcomeSuccess, audit.OutcomeFailure); verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+	page, verr := positiveParam(query, "page", 1, 0, false)
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+	pageSize, verr := positiveParam(query, "pageSize", defaultAdminPageSize, MaxPageSize, h.clampPageSize)
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
+	result, err := h.ledger(r).ListAuditEvents(filter, page, pageSize)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	pagination := h.paginate(w, r, result.Page, result.PageSize, result.TotalCount, result.TotalPages)
+	if !wantsCSV(r) {
+		sendJSONResponse(w, r, http.StatusOK, auditEventsResponse{Events: result.Events, Pagination: pagination})
+		return
+	}
+
+	// a page is at most MaxPageSize events, rendered before the status goes out so a failure is still a 500
+	var buf bytes.Buffer
+	if err := writeAuditCSV(&buf, result.Events); err != nil {
+		h.sendInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", csvContentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.csv"`)
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
+
+var auditColumns = []string{"time", "userId", "actor", "operation", "outcome", "errorCode", "requestId", "clientCert"}
+
+func writeAuditCSV(w io.Writer, events []audit.Event) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(auditColumns); err != nil {
+		return err
+	}
+	for _, event := range events {
+		row := []string{
+			event.Time.UTC().Format(time.RFC3339Nano),
+			event.UserID,
+			event.Actor,
+			event.Operation,
+			event.Outcome,
+			event.ErrorCode,
+			event.RequestID,
+			event.ClientCert,
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
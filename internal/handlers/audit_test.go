@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/audit"
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+)
+
+// setupAuditRouter records, as alice and with request IDs, a deposit, a withdrawal above the balance and a
+// deposit with an invalid amount, then a deposit for bob
+func setupAuditRouter(t *testing.T) *mux.Router {
+	t.Helper()
+
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+	if err != nil {
+		t.Fatalf("could not create the verifier: %v", err)
+	}
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware)
+	handler := NewLedgerHandler(setupTestHandler().service, discardLogger, WithAuth(verifier), WithAdmin(testAdminCredentials))
+	handler.RegisterRoutes(router, APIPrefix)
+
+	requests := []struct {
+		userId         string
+		requestID      string
+		body           transactionRequest
+		expectedStatus int
+	}{
+		{"alice", "req-1", transactionRequest{TransactionType: "deposit", Amount: 50}, http.StatusCreated},
+		{"alice", "req-2", transactionRequest{TransactionType: "withdrawal", Amount: 80}, http.StatusUnprocessableEntity},
+		{"alice", "req-3", transactionRequest{TransactionType: "deposit", Amount: -5}, http.StatusBadRequest},
+		{"bob", "req-4", transactionRequest{TransactionType: "deposit", Amount: 20}, http.StatusCreated},
+	}
+	for _, tt := range requests {
+		body, _ := json.Marshal(tt.body)
+		req := httptest.NewRequest("POST", APIPrefix+"/users/"+tt.userId+"/transactions", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+authtest.Token(authtest.Secret, tt.userId))
+		req.Header.Set(RequestIDHeader, tt.requestID)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		if rr.Code != tt.expectedStatus {
+			t.Fatalf("expected status %d for %s, got %d: %s", tt.expectedStatus, tt.requestID, rr.Code, rr.Body.String())
+		}
+	}
+	return router
+}
+
+func TestAdminAuditEvents(t *testing.T) {
+	router := setupAuditRouter(t)
+
+	tests := []struct {
+		name       string
+		query      string
+		expectedID []string
+	}{
+		{"Everything", "", []string{"req-1", "req-2", "req-3", "req-4"}},
+		{"User", "?userId=bob", []string{"req-4"}},
+		{"Failures", "?outcome=failure", []string{"req-2", "req-3"}},
+		{"Successes of a user", "?outcome=success&userId=alice", []string{"req-1"}},
+		{"Page", "?pageSize=1&page=2", []string{"req-2"}},
+		{"Future", "?from=2100-01-01T00:00:00Z", []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := adminRequest(router, APIPrefix+"/admin/audit"+tt.query, withAdminKey(testAdminCredentials.APIKey))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			var body auditEventsResponse
+			if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+				t.Fatalf("could not parse the body: %v", err)
+			}
+			if len(body.Events) != len(tt.expectedID) {
+				t.Fatalf("expected %d events, got %d: %s", len(tt.expectedID), len(body.Events), rr.Body.String())
+			}
+			for i, event := range body.Events {
+				if event.RequestID != tt.expectedID[i] {
+					t.Errorf("expected %s at %d, got %s", tt.expectedID[i], i, event.RequestID)
+				}
+			}
+		})
+	}
+}
+
+func TestAdminAuditEventFields(t *testing.T) {
+	router := setupAuditRouter(t)
+
+	rr := adminRequest(router, APIPrefix+"/admin/audit?userId=alice&outcome=failure", withAdminKey(testAdminCredentials.APIKey))
+	var body auditEventsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not parse the body: %v", err)
+	}
+	if len(body.Events) != 2 {
+		t.Fatalf("expected 2 failures, got %s", rr.Body.String())
+	}
+	overdraft := body.Events[0]
+	expected := audit.Event{
+		Time:      overdraft.Time,
+		UserID:    "alice",
+		Actor:     "alice",
+		Operation: "transaction.record",
+		Outcome:   audit.OutcomeFailure,
+		ErrorCode: "insufficient_funds",
+		RequestID: "req-2",
+	}
+	if overdraft != expected || overdraft.Time.IsZero() {
+		t.Errorf("expected %+v, got %+v", expected, overdraft)
+	}
+	if body.Events[1].ErrorCode == "" {
+		t.Errorf("expected the rule that rejected the invalid amount, got %+v", body.Events[1])
+	}
+	if body.Pagination.TotalItems != 2 {
+		t.Errorf("expected 2 items in total, got %+v", body.Pagination)
+	}
+}
+
+func TestAdminAuditEventsCSV(t *testing.T) {
+	router := setupAuditRouter(t)
+
+	rr := adminRequest(router, APIPrefix+"/admin/audit?outcome=failure", func(req *http.Request) {
+		req.Header.Set(AdminKeyHeader, testAdminCredentials.APIKey)
+		req.Header.Set("Accept", "text/csv")
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != csvContentType {
+		t.Errorf("expected %s, got %s", csvContentType, contentType)
+	}
+
+	rows, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("could not parse the CSV: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected the header and 2 rows, got %v", rows)
+	}
+	if rows[0][0] != "time" || rows[1][1] != "alice" || rows[1][2] != "alice" || rows[1][5] != "insufficient_funds" || rows[1][6] != "req-2" {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
+
+func TestAdminAuditEventsValidation(t *testing.T) {
+	router := setupAuditRouter(t)
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedField string
+	}{
+		{"Unknown outcome", "?outcome=maybe", "outcome"},
+		{"Invalid time", "?from=yesterday", "from"},
+		{"Reversed range", "?from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z", "from"},
+		{"Invalid user", "?userId=a%20b", "userId"},
+		{"Invalid page", "?page=0", "page"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := adminRequest(router, APIPrefix+"/admin/audit"+tt.query, withAdminKey(testAdminCredentials.APIKey))
+			body := decodeErrorBody(t, rr, http.StatusBadRequest, kindValidationFailed)
+			if body.Field != tt.expectedField {
+				t.Errorf("expected an error on %s, got %s: %s", tt.expectedField, body.Field, body.Error)
+			}
+		})
+	}
+
+	if rr := adminRequest(router, APIPrefix+"/admin/audit", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 without credentials, got %d", rr.Code)
+	}
+}
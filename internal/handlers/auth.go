@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"tiny-ledger/internal/auth"
+
+	"github.com/gorilla/mux"
+)
+
+// WithAuth requires a bearer JWT on every ledger route, the token's subject must be the {userId} of the path
+// unless it carries the admin scope
+func WithAuth(verifier *auth.Verifier) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.verifier = verifier
+	}
+}
+
+func (h *LedgerHandler) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := h.verifier.VerifyRequest(r)
+		if err != nil {
+			message := "invalid or expired token"
+			if errors.Is(err, auth.ErrMissingToken) {
+				message = "authentication required"
+			}
+			h.requestLogger(r).InfoContext(r.Context(), "authentication failed", "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tiny-ledger"`)
+			sendError(w, r, http.StatusUnauthorized, ErrorResponse{Error: message, Code: "unauthorized"})
+			return
+		}
+
+		if userId := mux.Vars(r)["userId"]; userId != "" && !principal.CanAccess(userId) {
+			sendForbidden(w, r)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// authorizeUser checks a user named in the body rather than the path, it passes when auth is disabled
+func authorizeUser(r *http.Request, userId string) bool {
+	principal, ok := auth.PrincipalFrom(r.Context())
+	return !ok || principal.CanAccess(userId)
+}
+
+func sendForbidden(w http.ResponseWriter, r *http.Request) {
+	sendError(w, r, http.StatusForbidden, ErrorResponse{Error: "token is not allowed to access this user", Code: "forbidden"})
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+	"tiny-ledger/internal/buildinfo"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/gorilla/mux"
+)
+
+func setupAuthRouter(t *testing.T) *mux.Router {
+	t.Helper()
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	router := mux.NewRouter()
+	NewHealthHandler(buildinfo.Info{Version: "test"}).RegisterRoutes(router)
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, WithAuth(verifier)).RegisterRoutes(router, "")
+	return router
+}
+
+func TestAuthentication(t *testing.T) {
+	router := setupAuthRouter(t)
+
+	expired := authtest.SignHS256(authtest.Secret, auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "user1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+	}})
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           interface{}
+		token          string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{name: "own balance", method: "GET", path: "/users/user1/balance", token: authtest.Token(authtest.Secret, "user1"), expectedStatus: http.StatusOK},
+		{name: "own deposit", method: "POST", path: "/users/user1/transactions", body: map[string]interface{}{"type": "deposit", "amount": 10.0}, token: authtest.Token(authtest.Secret, "user1"), expectedStatus: http.StatusCreated},
+		{name: "subject mismatch", method: "GET", path: "/users/user2/balance", token: authtest.Token(authtest.Secret, "user1"), expectedStatus: http.StatusForbidden, expectedCode: "forbidden"},
+		{name: "subject mismatch on a deposit", method: "POST", path: "/users/user2/transactions", body: map[string]interface{}{"type": "deposit", "amount": 10.0}, token: authtest.Token(authtest.Secret, "user1"), expectedStatus: http.StatusForbidden, expectedCode: "forbidden"},
+		{name: "registering another user", method: "POST", path: "/users", body: map[string]string{"userId": "user2"}, token: authtest.Token(authtest.Secret, "user1"), expectedStatus: http.StatusForbidden, expectedCode: "forbidden"},
+		{name: "registering yourself", method: "POST", path: "/users", body: map[string]string{"userId": "user3"}, token: authtest.Token(authtest.Secret, "user3"), expectedStatus: http.StatusCreated},
+		{name: "own export", method: "GET", path: "/users/user1/transactions/export", token: authtest.Token(authtest.Secret, "user1"), expectedStatus: http.StatusOK},
+		{name: "export of another user", method: "GET", path: "/users/user2/transactions/export", token: authtest.Token(authtest.Secret, "user1"), expectedStatus: http.StatusForbidden, expectedCode: "forbidden"},
+		{name: "admin override", method: "GET", path: "/users/user2/balance", token: authtest.Token(authtest.Secret, "ops", auth.ScopeAdmin), expectedStatus: http.StatusOK},
+		{name: "admin registers any user", method: "POST", path: "/users", body: map[string]string{"userId": "user4"}, token: authtest.Token(authtest.Secret, "ops", auth.ScopeAdmin), expectedStatus: http.StatusCreated},
+		{name: "other scope is no override", method: "GET", path: "/users/user2/balance", token: authtest.Token(authtest.Secret, "user1", "read"), expectedStatus: http.StatusForbidden, expectedCode: "forbidden"},
+		{name: "expired token", method: "GET", path: "/users/user1/balance", token: expired, expectedStatus: http.StatusUnauthorized, expectedCode: "unauthorized"},
+		{name: "wrong secret", method: "GET", path: "/users/user1/balance", token: authtest.Token([]byte("wrong"), "user1"), expectedStatus: http.StatusUnauthorized, expectedCode: "unauthorized"},
+		{name: "missing token", method: "GET", path: "/users/user1/balance", expectedStatus: http.StatusUnauthorized, expectedCode: "unauthorized"},
+		{name: "health stays open", method: "GET", path: "/healthz", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body bytes.Buffer
+			if tt.body != nil {
+				_ = json.NewEncoder(&body).Encode(tt.body)
+			}
+			req, _ := http.NewRequest(tt.method, tt.path, &body)
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusUnauthorized && rr.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("expected a WWW-Authenticate header")
+			}
+			if tt.expectedCode != "" {
+				var errResp ErrorResponse
+				_ = json.NewDecoder(rr.Body).Decode(&errResp)
+				if errResp.Code != tt.expectedCode {
+					t.Errorf("expected code %q, got %q", tt.expectedCode, errResp.Code)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+type batchRequest struct {
+	Transactions []transactionRequest `json:"transactions"`
+}
+
+type batchResponse struct {
+	Transactions []transactionResponse `json:"transactions"`
+}
+
+// ItemError is a rejected transaction of a batch. Code is the rule it broke for an invalid item (not_positive...) and
+// the error kind otherwise (INSUFFICIENT_FUNDS...)
+type ItemError struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// handleBatch records up to the service's batch maximum of transactions in one request, all or nothing. the records
+// come back in the order of the request
+func (h *LedgerHandler) handleBatch(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["userId"]
+
+	var req batchRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	inputs := make([]services.TransactionInput, len(req.Transactions))
+	for i, tx := range req.Transactions {
+		inputs[i] = services.TransactionInput{
+			Type:        models.TransactionType(tx.TransactionType),
+			Amount:      tx.Amount,
+			Description: tx.Description,
+			ReferenceID: tx.ReferenceID,
+		}
+	}
+
+	records, err := h.ledger(r).RecordTransactionsBatch(userId, inputs)
+	if err != nil {
+		h.sendBatchError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, r, http.StatusCreated, batchResponse{Transactions: newTransactionResponses(records)})
+}
+
+// sendBatchError lists the rejected items in details.items: invalid items are a 400, an item the ledger refused
+// (e.g. a withdrawal the earlier items can't cover) gets the status of its error. errors of the whole batch are
+// answered like any other service error
+func (h *LedgerHandler) sendBatchError(w http.ResponseWriter, r *http.Request, err error) {
+	var batchErr *services.BatchError
+	if errors.As(err, &batchErr) {
+		items := make([]ItemError, 0, len(batchErr.Items))
+		var fields []FieldError
+		for _, item := range batchErr.Items {
+			itemErr := ItemError{Index: item.Index, Code: kindValidationFailed, Message: item.Err.Error()}
+			path := fmt.Sprintf("/transactions/%d", item.Index)
+			if errs := validationErrors(item.Err); len(errs) > 0 {
+				itemErr.Field, itemErr.Code, itemErr.Message = errs[0].Field, errs[0].Code, errs[0].Message
+				for _, err := range errs {
+					fields = append(fields, newFieldError(path, err))
+				}
+			} else {
+				fields = append(fields, FieldError{Field: path, Code: kindValidationFailed, Message: item.Err.Error()})
+			}
+			items = append(items, itemErr)
+		}
+		h.requestLogger(r).WarnContext(r.Context(), "batch validation failed", "items", len(items), "errors", len(fields))
+		sendError(w, r, http.StatusBadRequest, ErrorResponse{Error: batchErr.Error(), Details: ErrorDetails{Items: items, Fields: fields}})
+		return
+	}
+
+	var itemErr *store.ItemError
+	if errors.As(err, &itemErr) {
+		if status, body, known := knownServiceError(itemErr.Err); known {
+			body.Error = itemErr.Error()
+			body.Details.Items = []ItemError{{Index: itemErr.Index, Code: body.Details.Code, Message: itemErr.Err.Error()}}
+			sendError(w, r, status, body)
+			return
+		}
+	}
+
+	h.sendServiceError(w, r, err)
+}
@@ -0,0 +1,177 @@
+package handlers_test
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"tiny-ledger/internal/apitest"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/services"
+)
+
+// postBatch records the transactions of the user in one batch
+func postBatch(t *testing.T, s *apitest.Server, userId string, transactions []map[string]any) apitest.Response {
+	t.Helper()
+	return s.Do(t, "POST", "/users/"+userId+"/transactions/batch", map[string]any{"transactions": transactions})
+}
+
+func TestHandleBatch(t *testing.T) {
+	s := apitest.NewTestServer()
+
+	var response struct {
+		Transactions []apitest.Transaction `json:"transactions"`
+	}
+	postBatch(t, s, "alice", []map[string]any{
+		{"type": "deposit", "amount": 100, "description": "salary"},
+		{"type": "withdrawal", "amount": 30, "description": "rent"},
+		{"type": "withdrawal", "amount": 20},
+	}).Expect(t, http.StatusCreated).Decode(t, &response)
+	if len(response.Transactions) != 3 || response.Transactions[0].Description != "salary" || response.Transactions[2].Amount != 20 {
+		t.Errorf("expected the 3 records in order, got %+v", response.Transactions)
+	}
+	if balance := s.GetBalance(t, "alice", ""); balance.Balance != 50 {
+		t.Errorf("expected balance 50, got %v", balance.Balance)
+	}
+}
+
+func TestHandleBatchIsAllOrNothing(t *testing.T) {
+	s := apitest.NewTestServer()
+	s.Deposit(t, "alice", 50)
+
+	// item 2 (the third) overdraws once items 0 and 1 are applied
+	body := postBatch(t, s, "alice", []map[string]any{
+		{"type": "deposit", "amount": 10},
+		{"type": "withdrawal", "amount": 40},
+		{"type": "withdrawal", "amount": 25},
+	}).Error(t, http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS")
+	if len(body.Details.Items) != 1 || body.Details.Items[0].Index != 2 || body.Details.Items[0].Code != "INSUFFICIENT_FUNDS" {
+		t.Errorf("expected item 2 to be rejected, got %+v", body.Details.Items)
+	}
+	if balance := s.GetBalance(t, "alice", ""); balance.Balance != 50 {
+		t.Errorf("expected the balance to stay 50, got %v", balance.Balance)
+	}
+	if count, _ := s.Service.CountTransactions("alice", services.HistoryFilter{}); count != 1 {
+		t.Errorf("expected nothing recorded, got %d transactions", count)
+	}
+
+	// invalid items are all listed with their rule
+	body = postBatch(t, s, "alice", []map[string]any{
+		{"type": "deposit", "amount": 5},
+		{"type": "deposit", "amount": -5},
+		{"type": "bonus", "amount": 5},
+		{"type": "bonus", "amount": 0, "description": strings.Repeat("x", 501)},
+	}).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+	expected := []handlers.ItemError{
+		{Index: 1, Field: "amount", Code: "not_positive", Message: "amount must be positive"},
+		{Index: 2, Field: "type", Code: "invalid_value", Message: "invalid transaction type"},
+		{Index: 3, Field: "amount", Code: "not_positive", Message: "amount must be positive"},
+	}
+	if len(body.Details.Items) != len(expected) {
+		t.Fatalf("expected %d rejected items, got %+v", len(expected), body.Details.Items)
+	}
+	for i, item := range body.Details.Items {
+		if item != expected[i] {
+			t.Errorf("expected %+v, got %+v", expected[i], item)
+		}
+	}
+
+	// and every broken rule of every item under its JSON pointer
+	var paths []string
+	for _, field := range body.Details.Fields {
+		paths = append(paths, field.Field+" "+field.Rule)
+	}
+	expectedPaths := []string{
+		"/transactions/1/amount positive",
+		"/transactions/2/type enum",
+		"/transactions/3/amount positive",
+		"/transactions/3/type enum",
+		"/transactions/3/description max_length",
+	}
+	if !reflect.DeepEqual(paths, expectedPaths) {
+		t.Errorf("expected the fields %q, got %q", expectedPaths, paths)
+	}
+	if balance := s.GetBalance(t, "alice", ""); balance.Balance != 50 {
+		t.Errorf("expected the balance to stay 50, got %v", balance.Balance)
+	}
+}
+
+func TestHandleBatchReferences(t *testing.T) {
+	s := apitest.NewTestServer()
+
+	reference := apitest.TransactionRequest{Type: "deposit", Amount: 100, ReferenceID: "import-1"}
+	if tx := s.PostTransaction(t, "alice", reference).Transaction(t); tx.ReferenceID != "import-1" {
+		t.Fatalf("expected the reference on the record, got %+v", tx)
+	}
+
+	// a reference already recorded rejects the batch at its item
+	body := postBatch(t, s, "alice", []map[string]any{
+		{"type": "deposit", "amount": 10, "referenceId": "import-2"},
+		{"type": "deposit", "amount": 100, "referenceId": "import-1"},
+	}).Error(t, http.StatusConflict, "DUPLICATE")
+	if len(body.Details.Items) != 1 || body.Details.Items[0].Index != 1 {
+		t.Errorf("expected item 1 to be rejected, got %+v", body.Details.Items)
+	}
+	if balance := s.GetBalance(t, "alice", ""); balance.Balance != 100 {
+		t.Errorf("expected the balance to stay 100, got %v", balance.Balance)
+	}
+
+	s.PostTransaction(t, "alice", reference).Error(t, http.StatusConflict, "DUPLICATE")
+}
+
+func TestHandleBatchSize(t *testing.T) {
+	s := apitest.NewTestServer()
+
+	deposits := make([]map[string]any, services.DefaultMaxBatchSize+1)
+	for i := range deposits {
+		deposits[i] = map[string]any{"type": "deposit", "amount": 1}
+	}
+
+	tests := []struct {
+		name           string
+		transactions   []map[string]any
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"Empty batch", []map[string]any{}, http.StatusBadRequest, "required"},
+		{"At the maximum", deposits[:services.DefaultMaxBatchSize], http.StatusCreated, ""},
+		{"Over the maximum", deposits, http.StatusBadRequest, "max_items"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postBatch(t, s, "bob", tt.transactions)
+			if tt.expectedStatus == http.StatusCreated {
+				resp.Expect(t, http.StatusCreated)
+				return
+			}
+			body := resp.Error(t, tt.expectedStatus, "VALIDATION_FAILED")
+			if body.Code != tt.expectedCode || body.Field != "transactions" {
+				t.Errorf("expected code %s on transactions, got %+v", tt.expectedCode, body)
+			}
+			if tt.expectedCode == "max_items" && !strings.Contains(body.Error, "at most 100") {
+				t.Errorf("expected the maximum in the message, got %q", body.Error)
+			}
+		})
+	}
+}
+
+func TestHandleBatchBodyLimit(t *testing.T) {
+	// a batch is allowed past the limit of a single transaction
+	s := apitest.NewTestServer(apitest.WithHandlerOptions(handlers.WithMaxBodyBytes(64), handlers.WithMaxBatchBodyBytes(1024)))
+
+	batch := []byte(`{"transactions":[{"type":"deposit","amount":1},{"type":"deposit","amount":2},{"type":"deposit","amount":3}]}`)
+	for _, tt := range []struct {
+		body           []byte
+		expectedStatus int
+	}{
+		{batch, http.StatusCreated},
+		{append(batch, bytes.Repeat([]byte(" "), 1024)...), http.StatusRequestEntityTooLarge},
+	} {
+		if resp := s.Do(t, "POST", "/users/carol/transactions/batch", tt.body); resp.Status != tt.expectedStatus {
+			t.Errorf("expected status %d for %d bytes, got %d", tt.expectedStatus, len(tt.body), resp.Status)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	DefaultMaxBodyBytes      = 1 << 20 // 1 MiB
+	DefaultMaxBatchBodyBytes = 8 << 20 // 8 MiB
+
+	// batchRouteName marks the routes that take many transactions per request and get the larger batch limit, as do
+	// the uploads of importRouteName
+	batchRouteName = "batch"
+)
+
+// WithMaxBodyBytes limits the body of every POST request, zero or less keeps the default
+func WithMaxBodyBytes(limit int64) HandlerOption {
+	return func(h *LedgerHandler) {
+		if limit > 0 {
+			h.maxBodyBytes = limit
+		}
+	}
+}
+
+// WithMaxBatchBodyBytes limits the body of batch requests, zero or less keeps the default
+func WithMaxBatchBodyBytes(limit int64) HandlerOption {
+	return func(h *LedgerHandler) {
+		if limit > 0 {
+			h.maxBatchBodyBytes = limit
+		}
+	}
+}
+
+// limitBody caps POST bodies so a client can't make the decoder buffer an unbounded body. reading past the limit
+// fails the decode, which answers 413, and net/http closes the connection instead of draining the rest
+func (h *LedgerHandler) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			limit := h.maxBodyBytes
+			if route := mux.CurrentRoute(r); route != nil && (route.GetName() == batchRouteName || route.GetName() == importRouteName) {
+				limit = h.maxBatchBodyBytes
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+// paddedBody is a transaction of exactly size bytes, padded with whitespace the decoder skips
+func paddedBody(size int) []byte {
+	body := []byte(`{"type":"deposit","amount":10}`)
+	return append(body, bytes.Repeat([]byte(" "), size-len(body))...)
+}
+
+func TestBodyLimit(t *testing.T) {
+	const limit = 1024
+
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, WithMaxBodyBytes(limit)).RegisterRoutes(router, "")
+
+	tests := []struct {
+		name           string
+		size           int
+		expectedStatus int
+	}{
+		{name: "at the limit", size: limit, expectedStatus: http.StatusCreated},
+		{name: "just above the limit", size: limit + 1, expectedStatus: http.StatusRequestEntityTooLarge},
+		{name: "far above the limit", size: 10 * limit, expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", "/users/user1/transactions", bytes.NewReader(paddedBody(tt.size)))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedStatus == http.StatusRequestEntityTooLarge {
+				var body ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+					t.Fatalf("failed to decode the error body: %v", err)
+				}
+				if body.Code != codeBodyTooLarge || body.Details.Code != kindBodyTooLarge {
+					t.Errorf("unexpected error body: %+v", body)
+				}
+			}
+		})
+	}
+}
+
+func TestBodyLimitDefault(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	req, _ := http.NewRequest("POST", "/users/user1/transactions", bytes.NewReader(paddedBody(DefaultMaxBodyBytes+1)))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", rr.Code)
+	}
+}
+
+func TestBodyLimitDoesNotLeakGoroutines(t *testing.T) {
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, WithMaxBodyBytes(1024)).RegisterRoutes(router, "")
+	server := httptest.NewServer(router)
+	client := server.Client()
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 20; i++ {
+		resp, err := client.Post(server.URL+"/users/user1/transactions", "application/json", bytes.NewReader(paddedBody(64*1024)))
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusRequestEntityTooLarge {
+			t.Fatalf("expected status 413, got %d", resp.StatusCode)
+		}
+	}
+
+	client.CloseIdleConnections()
+	server.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("expected the goroutines to settle at %d, got %d", before, after)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"tiny-ledger/internal/services"
+)
+
+// historyMaxAge is how long a client may reuse a history page of a range that ended in the past without asking again.
+// such a page only changes when one of its records is voided, reversed or edited, revalidating with Last-Modified
+// catches that
+const historyMaxAge = 5 * time.Minute
+
+// cacheHistory sets the caching headers of a history response and answers 304 Not Modified when the ledger didn't
+// change since the If-Modified-Since of the client. it returns false when the response is already sent. the
+// modification time is read before the page, so a write in between can only make Last-Modified older than the body
+func (h *LedgerHandler) cacheHistory(w http.ResponseWriter, r *http.Request, userId string, filter services.HistoryFilter) bool {
+	modified, err := h.ledger(r).GetLastModified(userId)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return false
+	}
+
+	if filter.EndTime != nil && filter.EndTime.Before(h.now()) {
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(historyMaxAge.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "no-store")
+	}
+
+	// a user without records has nothing to revalidate against
+	if modified.IsZero() {
+		return true
+	}
+	// HTTP dates have whole seconds
+	modified = modified.Truncate(time.Second)
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return true
+	}
+	// the headers the page would have had, a cache keys the stored copy on them
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(http.StatusNotModified)
+	return false
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+func getIfModifiedSince(router *mux.Router, target, since string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	if since != "" {
+		req.Header.Set("If-Modified-Since", since)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHistoryCacheControl(t *testing.T) {
+	router := mux.NewRouter()
+	setupTestHandler().RegisterRoutes(router, APIPrefix)
+	postJSON(router, APIPrefix+"/users/alice/transactions", transactionRequest{TransactionType: "deposit", Amount: 10, Description: "salary"})
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"Past range", "?start=2020-01-01T00:00:00Z&end=" + past, "private, max-age=300"},
+		{"Past end only", "?end=" + past, "private, max-age=300"},
+		{"Open range", "", "no-store"},
+		{"Open end", "?start=2020-01-01T00:00:00Z", "no-store"},
+		{"End in the future", "?end=" + future, "no-store"},
+		{"Past range by cursor", "?cursor=&end=" + past, "private, max-age=300"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := serveRequest(router, "GET", APIPrefix+"/users/alice/transactions"+tt.query)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if cacheControl := rr.Header().Get("Cache-Control"); cacheControl != tt.expected {
+				t.Errorf("expected Cache-Control %q, got %q", tt.expected, cacheControl)
+			}
+			if rr.Header().Get("Last-Modified") == "" {
+				t.Errorf("expected a Last-Modified header")
+			}
+		})
+	}
+}
+
+func TestHistoryRevalidation(t *testing.T) {
+	router := mux.NewRouter()
+	setupTestHandler().RegisterRoutes(router, APIPrefix)
+	postJSON(router, APIPrefix+"/users/alice/transactions", transactionRequest{TransactionType: "deposit", Amount: 10, Description: "salary"})
+	path := APIPrefix + "/users/alice/transactions?end=" + time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	lastModified := serveRequest(router, "GET", path).Header().Get("Last-Modified")
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		t.Fatalf("expected an HTTP date in Last-Modified, got %q", lastModified)
+	}
+
+	rr := getIfModifiedSince(router, path, lastModified)
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Fatalf("expected an empty 304 for an unchanged ledger, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Cache-Control") != "private, max-age=300" || rr.Header().Get("Last-Modified") != lastModified {
+		t.Errorf("expected the 304 to carry the caching headers, got %v", rr.Header())
+	}
+
+	earlier := modified.Add(-time.Second).Format(http.TimeFormat)
+	if rr := getIfModifiedSince(router, path, earlier); rr.Code != http.StatusOK {
+		t.Errorf("expected the page for a copy older than the ledger, got %d", rr.Code)
+	}
+	if rr := getIfModifiedSince(router, path, "yesterday"); rr.Code != http.StatusOK {
+		t.Errorf("expected an unparsable If-Modified-Since to be ignored, got %d", rr.Code)
+	}
+}
+
+// brokenHistory fails the history read after the caching headers were set
+type brokenHistory struct {
+	services.LedgerService
+}
+
+func (b brokenHistory) WithContext(context.Context) services.LedgerService {
+	return b
+}
+
+func (b brokenHistory) GetTransactionHistory(string, services.HistoryFilter, int, int) (services.PaginatedTransactions, error) {
+	return services.PaginatedTransactions{}, errors.New("store offline")
+}
+
+func TestHistoryCacheErrors(t *testing.T) {
+	ledgerStore := store.NewLedgerStore()
+	if _, err := ledgerStore.InsertTransaction("alice", models.NewTransactionRecord(models.Deposit, 10, "salary", time.Now())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	router := mux.NewRouter()
+	NewLedgerHandler(brokenHistory{services.NewLedgerService(ledgerStore)}, discardLogger).RegisterRoutes(router, APIPrefix)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	rr := serveRequest(router, "GET", APIPrefix+"/users/alice/transactions?end="+past)
+	if rr.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status 500, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Cache-Control") != "" || rr.Header().Get("Last-Modified") != "" {
+		t.Errorf("expected an error not to be cacheable, got %v", rr.Header())
+	}
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// TrustedProxies are the networks of the load balancers and proxies in front of the server. only a request from one of
+// them gets its X-Forwarded-For and X-Real-IP believed, anybody else could write anything there
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies reads a comma separated list of CIDRs, a bare address is a network of its own
+func ParseTrustedProxies(list string) (TrustedProxies, error) {
+	var trusted TrustedProxies
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+			}
+			trusted = append(trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		trusted = append(trusted, prefix.Masked())
+	}
+	return trusted, nil
+}
+
+func (t TrustedProxies) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range t {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the address of the client behind the proxies. every proxy appends the peer it got the request from to
+// X-Forwarded-For, so the chain is walked from the right past the trusted hops and the first address that isn't one
+// is the client. X-Real-IP is used when a trusted peer sent no X-Forwarded-For. anything else is the direct peer
+func (t TrustedProxies) ClientIP(r *http.Request) string {
+	peer := remoteIP(r)
+	addr, err := netip.ParseAddr(peer)
+	if err != nil || !t.contains(addr) {
+		return peer
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	if len(hops) == 0 {
+		if realIP, err := parseHop(r.Header.Get("X-Real-IP")); err == nil {
+			return realIP.String()
+		}
+		return peer
+	}
+
+	client := addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := parseHop(hops[i])
+		if err != nil {
+			// a trusted proxy wouldn't write this, whatever is left of it can't be believed either
+			break
+		}
+		client = hop
+		if !t.contains(hop) {
+			break
+		}
+	}
+	return client.Unmap().String()
+}
+
+// parseHop reads an X-Forwarded-For entry, some proxies add the port
+func parseHop(hop string) (netip.Addr, error) {
+	if addrPort, err := netip.ParseAddrPort(hop); err == nil {
+		return addrPort.Addr(), nil
+	}
+	return netip.ParseAddr(hop)
+}
+
+type clientIPKey struct{}
+
+// ClientIPMiddleware resolves the client address once for the access log, the rate limiter and the audit events,
+// see TrustedProxies.ClientIP. without trusted proxies it's always the direct peer
+func ClientIPMiddleware(trusted TrustedProxies) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientIPKey{}, trusted.ClientIP(r))))
+		})
+	}
+}
+
+// clientIP is the address ClientIPMiddleware resolved, the direct peer outside of it
+func clientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteIP(r)
+}
+
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
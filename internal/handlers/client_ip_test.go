@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/ratelimit"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.0/8, 192.168.1.1, fd00::/8")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		expectedIP   string
+	}{
+		{"Direct client", "203.0.113.7:51234", nil, "", "203.0.113.7"},
+		{"Forged header from an untrusted peer", "203.0.113.7:51234", []string{"198.51.100.1"}, "198.51.100.2", "203.0.113.7"},
+		{"Behind the load balancer", "10.0.0.5:443", []string{"198.51.100.1"}, "", "198.51.100.1"},
+		{"Chain of trusted proxies", "10.0.0.5:443", []string{"198.51.100.1, 192.168.1.1, 10.1.2.3"}, "", "198.51.100.1"},
+		{"Client spoofing the start of the chain", "10.0.0.5:443", []string{"1.2.3.4, 198.51.100.1, 10.1.2.3"}, "", "198.51.100.1"},
+		{"Chain split over headers", "10.0.0.5:443", []string{"1.2.3.4", "198.51.100.1"}, "", "198.51.100.1"},
+		{"Hop with a port", "10.0.0.5:443", []string{"198.51.100.1:4711"}, "", "198.51.100.1"},
+		{"Only trusted hops", "10.0.0.5:443", []string{"10.9.9.9, 10.1.2.3"}, "", "10.9.9.9"},
+		{"Garbage in the chain", "10.0.0.5:443", []string{"198.51.100.1, not-an-ip, 10.1.2.3"}, "", "10.1.2.3"},
+		{"X-Real-IP from a trusted peer", "192.168.1.1:80", nil, "198.51.100.9", "198.51.100.9"},
+		{"Invalid X-Real-IP", "192.168.1.1:80", nil, "somewhere", "192.168.1.1"},
+		{"IPv6", "[fd00::1]:443", []string{"2001:db8::7"}, "", "2001:db8::7"},
+		{"IPv4 mapped peer", "[::ffff:10.0.0.5]:443", []string{"198.51.100.1"}, "", "198.51.100.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if ip := trusted.ClientIP(req); ip != tt.expectedIP {
+				t.Errorf("expected %s, got %s", tt.expectedIP, ip)
+			}
+		})
+	}
+}
+
+func TestClientIPWithoutTrustedProxies(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.5:443"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	if ip := TrustedProxies(nil).ClientIP(req); ip != "10.0.0.5" {
+		t.Errorf("expected the headers to be ignored without trusted proxies, got %s", ip)
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	for _, list := range []string{"10.0.0.0/33", "10.0.0", "localhost", "10.0.0.0/8,,bad"} {
+		if _, err := ParseTrustedProxies(list); err == nil {
+			t.Errorf("%s: expected an error", list)
+		}
+	}
+	if trusted, err := ParseTrustedProxies(""); err != nil || len(trusted) != 0 {
+		t.Errorf("expected an empty list, got %v, %v", trusted, err)
+	}
+}
+
+// TestClientIPRateLimit checks two clients behind the same load balancer get a limit each, and a forged header from
+// outside doesn't buy a fresh one
+func TestClientIPRateLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := ratelimit.New(1, 1, ratelimit.WithClock(func() time.Time { return now }))
+	trusted, _ := ParseTrustedProxies("10.0.0.0/8")
+
+	router := mux.NewRouter()
+	router.Use(ClientIPMiddleware(trusted))
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, WithRateLimit(limiter)).RegisterRoutes(router, "")
+
+	// the routes without a user are limited by IP
+	post := func(remoteAddr, forwardedFor string) int {
+		req := httptest.NewRequest("POST", "/graphql", nil)
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		if forwardedFor != "" {
+			req.Header.Set("X-Forwarded-For", forwardedFor)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := post("10.0.0.5:443", "198.51.100.1"); code == http.StatusTooManyRequests {
+		t.Fatalf("expected the first client through")
+	}
+	if code := post("10.0.0.5:443", "198.51.100.2"); code == http.StatusTooManyRequests {
+		t.Errorf("expected the second client behind the proxy to have its own limit")
+	}
+	if code := post("10.0.0.5:443", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Errorf("expected the first client to be limited, got %d", code)
+	}
+
+	if code := post("203.0.113.7:5000", ""); code == http.StatusTooManyRequests {
+		t.Fatalf("expected the direct client through")
+	}
+	if code := post("203.0.113.7:5000", "198.51.100.3"); code != http.StatusTooManyRequests {
+		t.Errorf("expected a forged header not to escape the limit, got %d", code)
+	}
+}
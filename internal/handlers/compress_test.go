@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func setupCompressedRouter() *mux.Router {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	router.Use(CompressMiddleware(DefaultCompressMinSize))
+	handler.RegisterRoutes(router, "")
+	return router
+}
+
+func gunzip(t *testing.T, body io.Reader) string {
+	t.Helper()
+	reader, err := gzip.NewReader(body)
+	if err != nil {
+		t.Fatalf("body isn't gzip: %v", err)
+	}
+	decompressed, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to decompress: %v", err)
+	}
+	return string(decompressed)
+}
+
+func TestCompressHistory(t *testing.T) {
+	router := setupCompressedRouter()
+	for i := 0; i < 100; i++ {
+		postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 10.0, "description": "salary"})
+	}
+
+	get := func(acceptEncoding string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/users/user1/transactions?pageSize=100", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	plain := get("")
+	compressed := get("gzip, deflate")
+
+	if plain.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected no encoding without Accept-Encoding")
+	}
+	if compressed.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip encoding, got %q", compressed.Header().Get("Content-Encoding"))
+	}
+	if compressed.Header().Get("Vary") != "Accept-Encoding" || plain.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected Vary: Accept-Encoding on both responses")
+	}
+	if compressed.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d", compressed.Code)
+	}
+
+	plainSize, compressedSize := plain.Body.Len(), compressed.Body.Len()
+	if compressedSize >= plainSize/2 {
+		t.Errorf("expected the compressed body to be well under the %d plain bytes, got %d", plainSize, compressedSize)
+	}
+	if gunzip(t, compressed.Body) != plain.Body.String() {
+		t.Errorf("expected the decompressed body to match the plain one")
+	}
+}
+
+func TestCompressSkipsSmallResponses(t *testing.T) {
+	router := setupCompressedRouter()
+
+	req, _ := http.NewRequest("GET", "/users/user1/balance", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Header().Get("Content-Encoding") != "" {
+		t.Errorf("expected a small response to stay uncompressed")
+	}
+	if rr.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("expected Vary: Accept-Encoding")
+	}
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"balance"`) {
+		t.Errorf("expected the plain balance response, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestCompressPassThrough(t *testing.T) {
+	large := strings.Repeat("x", 4*DefaultCompressMinSize)
+
+	tests := []struct {
+		name             string
+		handler          http.HandlerFunc
+		expectedEncoding string
+		expectedStatus   int
+	}{
+		{
+			name: "already encoded",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Encoding", "br")
+				_, _ = w.Write([]byte(large))
+			},
+			expectedEncoding: "br",
+			expectedStatus:   http.StatusOK,
+		},
+		{
+			name: "no content",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name: "status of a large response is kept",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusCreated)
+				_, _ = w.Write([]byte(large))
+			},
+			expectedEncoding: "gzip",
+			expectedStatus:   http.StatusCreated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			rr := httptest.NewRecorder()
+			CompressMiddleware(DefaultCompressMinSize)(tt.handler).ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, rr.Code)
+			}
+			if got := rr.Header().Get("Content-Encoding"); got != tt.expectedEncoding {
+				t.Errorf("expected encoding %q, got %q", tt.expectedEncoding, got)
+			}
+		})
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	rr := httptest.NewRecorder()
+	var flushedBytes int
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("{\"event\":1}\n"))
+		w.(http.Flusher).Flush()
+		flushedBytes = rr.Body.Len()
+		_, _ = w.Write([]byte("{\"event\":2}\n"))
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	LoggingMiddleware(discardLogger, 0)(CompressMiddleware(DefaultCompressMinSize)(handler)).ServeHTTP(rr, req)
+
+	if flushedBytes == 0 || !rr.Flushed {
+		t.Errorf("expected the first event to reach the client on Flush")
+	}
+	if got := gunzip(t, rr.Body); got != "{\"event\":1}\n{\"event\":2}\n" {
+		t.Errorf("unexpected stream: %q", got)
+	}
+}
+
+func TestAcceptsGzip(t *testing.T) {
+	tests := map[string]bool{
+		"":                    false,
+		"gzip":                true,
+		"deflate, gzip;q=0.5": true,
+		"GZIP":                true,
+		"gzip;q=0":            false,
+		"*":                   true,
+		"br, deflate":         false,
+		"identity":            false,
+	}
+
+	for header, expected := range tests {
+		if got := acceptsGzip(header); got != expected {
+			t.Errorf("acceptsGzip(%q): expected %v, got %v", header, expected, got)
+		}
+	}
+}
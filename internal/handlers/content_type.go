@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// requireJSON rejects POST bodies that aren't declared as application/json (any charset) with 415, the upload routes
+// (importRouteName) take multipart/form-data instead. a POST without a body passes, endpoints with an optional body
+// decide for themselves
+func requireJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.ContentLength == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected := "application/json"
+		if route := mux.CurrentRoute(r); route != nil && route.GetName() == importRouteName {
+			expected = "multipart/form-data"
+		}
+		contentType := r.Header.Get("Content-Type")
+		if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != expected {
+			if contentType == "" {
+				contentType = "none"
+			}
+			sendError(w, r, http.StatusUnsupportedMediaType, ErrorResponse{
+				Error: "Content-Type must be " + expected + ", got " + contentType,
+				Code:  "unsupported_media_type",
+			})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
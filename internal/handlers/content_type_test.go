@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRequireJSON(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	tests := []struct {
+		name           string
+		path           string
+		contentType    string
+		body           string
+		expectedStatus int
+	}{
+		{name: "application/json", path: "/users/user1/transactions", contentType: "application/json", body: `{"type":"deposit","amount":10}`, expectedStatus: http.StatusCreated},
+		{name: "application/json with charset", path: "/users/user1/transactions", contentType: "application/json; charset=utf-8", body: `{"type":"deposit","amount":10}`, expectedStatus: http.StatusCreated},
+		{name: "media type is case insensitive", path: "/users/user1/transactions", contentType: "Application/JSON", body: `{"type":"deposit","amount":10}`, expectedStatus: http.StatusCreated},
+		{name: "text/plain", path: "/users/user1/transactions", contentType: "text/plain", body: `{"type":"deposit","amount":10}`, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "form encoded", path: "/users/user1/transactions", contentType: "application/x-www-form-urlencoded", body: "type=deposit&amount=10", expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "missing header", path: "/users/user1/transactions", body: `{"type":"deposit","amount":10}`, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "missing header on a transfer", path: "/users/user1/transfers", body: `{"toUserId":"user2","amount":1}`, expectedStatus: http.StatusUnsupportedMediaType},
+		{name: "no body and no header", path: "/users/user1/transactions", expectedStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+
+			if tt.expectedStatus == http.StatusUnsupportedMediaType {
+				var body ErrorResponse
+				if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+					t.Fatalf("failed to decode the error body: %v", err)
+				}
+				if body.Code != "unsupported_media_type" || body.Details.Code != kindUnsupportedMediaType {
+					t.Errorf("unexpected error body: %+v", body)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+)
+
+const (
+	TotalCountHeader = "X-Total-Count"
+	TotalPagesHeader = "X-Total-Pages"
+)
+
+type countResponse struct {
+	Count int `json:"count"`
+}
+
+// handleCount answers the number of transactions the history would list with the same filters
+func (h *LedgerHandler) handleCount(w http.ResponseWriter, r *http.Request) {
+	q, verr := h.parseHistoryQuery(r.URL.Query())
+	if verr == nil {
+		verr = unpaginated(r.URL.Query(), q, "the count isn't paginated, leave out page, pageSize, cursor and limit")
+	}
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
+	count, err := h.ledger(r).CountTransactions(mux.Vars(r)["userId"], q.filter)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+	sendJSONResponse(w, r, http.StatusOK, countResponse{Count: count})
+}
+
+// handleHistoryHead answers HEAD on the history with the page metadata in headers and no page of data
+func (h *LedgerHandler) handleHistoryHead(w http.ResponseWriter, r *http.Request) {
+	q, verr := h.parseHistoryQuery(r.URL.Query())
+	if verr == nil && q.byCursor {
+		verr = &services.ValidationError{
+			Field:   "cursor",
+			Code:    "unsupported_parameter",
+			Message: "HEAD reports the page metadata, use page and pageSize",
+		}
+	}
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
+	count, err := h.ledger(r).CountTransactions(mux.Vars(r)["userId"], q.filter)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	totalPages := max((count+q.pageSize-1)/q.pageSize, 1)
+	w.Header().Set(TotalCountHeader, strconv.Itoa(count))
+	w.Header().Set(TotalPagesHeader, strconv.Itoa(totalPages))
+	setLinkHeader(w, h.pageLinks(r, q.page, totalPages))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+// unpaginated rejects the pagination parameters on the endpoints that answer about the whole filtered history
+func unpaginated(query url.Values, q historyQuery, message string) *services.ValidationError {
+	if q.byCursor || query.Has("page") || query.Has("pageSize") {
+		return &services.ValidationError{Field: "cursor", Code: "unsupported_parameter", Message: message}
+	}
+	return nil
+}
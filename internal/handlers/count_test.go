@@ -0,0 +1,104 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/apitest"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/models"
+)
+
+func setupCountServer(t *testing.T) *apitest.Server {
+	t.Helper()
+
+	s := apitest.NewTestServer()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 37 {
+		tx := models.TransactionRecord{ID: uuid.New(), Amount: float64(10 + i), Type: models.Deposit, Timestamp: base.Add(time.Duration(i) * time.Hour)}
+		if i%3 == 0 {
+			tx.Type, tx.Description = models.Withdrawal, "rent"
+		}
+		s.Store.AddTransactionWithTime("counter", tx)
+	}
+	return s
+}
+
+func TestCountMatchesHistory(t *testing.T) {
+	s := setupCountServer(t)
+
+	queries := []string{
+		"",
+		"type=withdrawal",
+		"type=deposit&minAmount=20",
+		"start=2025-01-01T05:00:00Z&end=2025-01-01T20:00:00Z",
+		"start=2025-01-01T05:00:00Z&type=withdrawal&q=RENT",
+		"start=2030-01-01T00:00:00Z",
+	}
+
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			list := s.GetHistory(t, "counter", query)
+
+			var count struct {
+				Count int `json:"count"`
+			}
+			s.Do(t, "GET", "/users/counter/transactions/count?"+query, nil).Expect(t, http.StatusOK).Decode(t, &count)
+			if count.Count != list.Pagination.TotalItems {
+				t.Errorf("expected count %d, got %d", list.Pagination.TotalItems, count.Count)
+			}
+
+			resp := s.Do(t, "HEAD", "/users/counter/transactions?pageSize=5&"+query, nil)
+			if resp.Status != http.StatusOK || len(resp.Body) != 0 {
+				t.Fatalf("expected an empty 200 from HEAD, got %d with %d bytes", resp.Status, len(resp.Body))
+			}
+			if total := resp.Header.Get(handlers.TotalCountHeader); total != strconv.Itoa(list.Pagination.TotalItems) {
+				t.Errorf("expected %s %d, got %q", handlers.TotalCountHeader, list.Pagination.TotalItems, total)
+			}
+			wantPages := strconv.Itoa(max((list.Pagination.TotalItems+4)/5, 1))
+			if pages := resp.Header.Get(handlers.TotalPagesHeader); pages != wantPages {
+				t.Errorf("expected %s %s, got %q", handlers.TotalPagesHeader, wantPages, pages)
+			}
+		})
+	}
+}
+
+func TestCountValidation(t *testing.T) {
+	s := setupCountServer(t)
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"Invalid start", "start=yesterday", "invalid_time"},
+		{"Start after end", "start=2025-02-01T00:00:00Z&end=2025-01-01T00:00:00Z", "invalid_range"},
+		{"Unknown type", "type=refund", "invalid_value"},
+		{"Negative amount", "minAmount=-1", "out_of_range"},
+		{"Paginated count", "page=2", "unsupported_parameter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := s.Do(t, "GET", "/users/counter/transactions/count?"+tt.query, nil).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+			if body.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, body.Code)
+			}
+
+			if tt.query == "page=2" {
+				return
+			}
+			// the list and HEAD reject the same filters
+			if resp := s.Do(t, "GET", "/users/counter/transactions?"+tt.query, nil); resp.Status != http.StatusBadRequest {
+				t.Errorf("expected the list to reject it too, got %d", resp.Status)
+			}
+			if resp := s.Do(t, "HEAD", "/users/counter/transactions?"+tt.query, nil); resp.Status != http.StatusBadRequest {
+				t.Errorf("expected HEAD to reject it too, got %d", resp.Status)
+			}
+		})
+	}
+}
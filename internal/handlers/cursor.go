@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/services"
+)
+
+const (
+	cursorAscending  = "asc"
+	cursorDescending = "desc"
+)
+
+// cursorToken is the JSON behind the opaque cursor, clients are only expected to pass it back as they got it
+type cursorToken struct {
+	Timestamp string `json:"ts"`
+	ID        string `json:"id"`
+	Direction string `json:"dir"`
+}
+
+func encodeCursor(c services.HistoryCursor) string {
+	direction := cursorAscending
+	if c.Descending {
+		direction = cursorDescending
+	}
+	raw, _ := json.Marshal(cursorToken{
+		Timestamp: c.Timestamp.UTC().Format(time.RFC3339Nano),
+		ID:        c.ID.String(),
+		Direction: direction,
+	})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor never trusts the token, anything that isn't a cursor we handed out is a validation error
+func decodeCursor(value string) (services.HistoryCursor, *services.ValidationError) {
+	invalid := &services.ValidationError{Field: "cursor", Code: "invalid_cursor", Message: "invalid cursor"}
+
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return services.HistoryCursor{}, invalid
+	}
+
+	var token cursorToken
+	if err := json.Unmarshal(raw, &token); err != nil {
+		return services.HistoryCursor{}, invalid
+	}
+
+	timestamp, err := time.Parse(time.RFC3339Nano, token.Timestamp)
+	if err != nil {
+		return services.HistoryCursor{}, invalid
+	}
+	id, err := uuid.Parse(token.ID)
+	if err != nil {
+		return services.HistoryCursor{}, invalid
+	}
+	if token.Direction != cursorAscending && token.Direction != cursorDescending {
+		return services.HistoryCursor{}, invalid
+	}
+
+	return services.HistoryCursor{Timestamp: timestamp, ID: id, Descending: token.Direction == cursorDescending}, nil
+}
+
+// handleHistoryByCursor answers the history, in the negotiated media type, with the records after the cursor and the
+// cursor of the next page
+func (h *LedgerHandler) handleHistoryByCursor(w http.ResponseWriter, r *http.Request, userId string, q historyQuery, mediaType string) {
+	result, err := h.ledger(r).GetTransactionHistoryAfter(userId, q.filter, q.cursor, q.limit)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	transactions, err := h.historyTransactions(r, userId, q, result.Transactions)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	pagination := cursorPagination{Limit: result.Limit, AccountExists: result.AccountExists}
+	if result.NextCursor != nil {
+		pagination.NextCursor = encodeCursor(*result.NextCursor)
+		query := r.URL.Query()
+		query.Set("cursor", pagination.NextCursor)
+		query.Set("limit", strconv.Itoa(result.Limit))
+		pagination.Next = h.baseURL(r) + r.URL.EscapedPath() + "?" + query.Encode()
+		setLinkHeader(w, []pageLink{{rel: "next", url: pagination.Next}})
+	}
+
+	body, err := q.fields.projectTransactions(cursorHistoryResponse{
+		Transactions: transactions,
+		Pagination:   pagination,
+	})
+	if err == nil && !q.envelope {
+		body, err = unwrapTransactions(body)
+	}
+	if err != nil {
+		h.sendInternalError(w, r, err)
+		return
+	}
+	sendNegotiatedResponse(w, r, mediaType, http.StatusOK, body)
+}
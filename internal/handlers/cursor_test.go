@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+)
+
+type cursorResponse struct {
+	Transactions []models.TransactionRecord `json:"transactions"`
+	Pagination   struct {
+		Limit      int    `json:"limit"`
+		NextCursor string `json:"nextCursor"`
+		Next       string `json:"next"`
+	} `json:"pagination"`
+}
+
+func getCursorPage(t *testing.T, router *mux.Router, query string) cursorResponse {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", "/users/user1/transactions?"+query, nil)
+	req.Host = "ledger.test"
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var response cursorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode the response: %v", err)
+	}
+	return response
+}
+
+func TestHistoryCursorWalk(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	const seeded = 250
+	for i := 0; i < seeded; i++ {
+		postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 1.0, "description": fmt.Sprintf("seed-%d", i)})
+	}
+
+	// deposits keep landing while the history is walked, they may or may not show up but nothing may repeat or go missing
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+				postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 1.0, "description": fmt.Sprintf("live-%d", i)})
+			}
+		}
+	}()
+	stopWriter := sync.OnceFunc(func() {
+		close(done)
+		wg.Wait()
+	})
+	defer stopWriter()
+
+	seen := make(map[uuid.UUID]bool)
+	var seeds []string
+	var last time.Time
+	query := "limit=50"
+	for pages := 0; ; pages++ {
+		if pages > seeded {
+			t.Fatalf("the walk doesn't terminate")
+		}
+		response := getCursorPage(t, router, query)
+		for _, tx := range response.Transactions {
+			if seen[tx.ID] {
+				t.Fatalf("transaction %s returned twice", tx.ID)
+			}
+			seen[tx.ID] = true
+			if tx.Timestamp.Before(last) {
+				t.Errorf("transaction %s is out of order", tx.ID)
+			}
+			last = tx.Timestamp
+			if len(tx.Description) > 5 && tx.Description[:5] == "seed-" {
+				seeds = append(seeds, tx.Description)
+			}
+		}
+		// stop the writer half way so the walk can catch up with the end
+		if len(seeds) == seeded {
+			stopWriter()
+		}
+		if response.Pagination.NextCursor == "" {
+			break
+		}
+		query = "limit=50&cursor=" + url.QueryEscape(response.Pagination.NextCursor)
+	}
+	stopWriter()
+
+	if len(seeds) != seeded {
+		t.Fatalf("expected %d seeded records, got %d", seeded, len(seeds))
+	}
+	for i, description := range seeds {
+		if expected := fmt.Sprintf("seed-%d", i); description != expected {
+			t.Fatalf("expected %s at position %d, got %s", expected, i, description)
+		}
+	}
+}
+
+func TestHistoryCursorNextLink(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	for i := 0; i < 3; i++ {
+		postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 1.0})
+	}
+
+	first := getCursorPage(t, router, "limit=2&includeVoided=false")
+	if len(first.Transactions) != 2 || first.Pagination.Limit != 2 || first.Pagination.NextCursor == "" {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	expected := "http://ledger.test/users/user1/transactions?cursor=" + url.QueryEscape(first.Pagination.NextCursor) + "&includeVoided=false&limit=2"
+	if first.Pagination.Next != expected {
+		t.Errorf("expected next %q, got %q", expected, first.Pagination.Next)
+	}
+
+	second := getCursorPage(t, router, "limit=2&includeVoided=false&cursor="+url.QueryEscape(first.Pagination.NextCursor))
+	if len(second.Transactions) != 1 || second.Pagination.NextCursor != "" || second.Pagination.Next != "" {
+		t.Errorf("unexpected last page: %+v", second)
+	}
+}
+
+func TestHistoryCursorErrors(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 1.0})
+
+	unknown := encodeCursor(services.HistoryCursor{Timestamp: time.Now(), ID: uuid.New()})
+	badDirection := base64.RawURLEncoding.EncodeToString([]byte(`{"ts":"2024-01-01T00:00:00Z","id":"` + uuid.NewString() + `","dir":"sideways"}`))
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"cursor with page", "cursor=" + unknown + "&page=2", "conflicting_pagination"},
+		{"limit with pageSize", "limit=10&pageSize=10", "conflicting_pagination"},
+		{"not base64", "cursor=%25%25%25", "invalid_cursor"},
+		{"not json", "cursor=" + base64.RawURLEncoding.EncodeToString([]byte("garbage")), "invalid_cursor"},
+		{"bad direction", "cursor=" + badDirection, "invalid_cursor"},
+		{"unknown transaction", "cursor=" + unknown, "invalid_cursor"},
+		{"limit not a number", "limit=ten", "invalid_number"},
+		{"limit over the cap", "limit=101", "out_of_range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/user1/transactions?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", rr.Code)
+			}
+			var response ErrorResponse
+			_ = json.NewDecoder(rr.Body).Decode(&response)
+			if response.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, response.Code)
+			}
+		})
+	}
+}
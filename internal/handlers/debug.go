@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/store"
+)
+
+type debugStatsResponse struct {
+	Goroutines int              `json:"goroutines"`
+	MemStats   runtime.MemStats `json:"memStats"`
+	Store      *store.Stats     `json:"store,omitempty"`
+}
+
+// RegisterDebugRoutes mounts the net/http/pprof profiles under /debug/pprof/ and the memory and store statistics at
+// /debug/stats. they're unauthenticated, main only mounts them behind -debug-endpoints and preferably on a loopback
+// listener of their own. without a store, e.g. in multi-tenant mode, the stats leave the store out
+func RegisterDebugRoutes(r *mux.Router, ledgerStore *store.LedgerStore) {
+	r.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	r.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	r.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	r.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	// the index lists the profiles and serves the named ones, e.g. /debug/pprof/heap
+	r.PathPrefix("/debug/pprof/").HandlerFunc(pprof.Index)
+
+	r.HandleFunc("/debug/stats", func(w http.ResponseWriter, r *http.Request) {
+		response := debugStatsResponse{Goroutines: runtime.NumGoroutine()}
+		if ledgerStore != nil {
+			stats := ledgerStore.Stats()
+			response.Store = &stats
+		}
+		runtime.ReadMemStats(&response.MemStats)
+		sendJSONResponse(w, r, http.StatusOK, response)
+	}).Methods("GET")
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// setupDebugRouter builds the router like main does, the debug routes only with debugEndpoints
+func setupDebugRouter(debugEndpoints bool) *mux.Router {
+	ledgerStore := store.NewLedgerStore()
+	_, _ = ledgerStore.InsertTransaction("alice", models.NewTransactionRecord(models.Deposit, 10, "salary", time.Now()))
+
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(ledgerStore), discardLogger).RegisterRoutes(router, APIPrefix)
+	if debugEndpoints {
+		RegisterDebugRoutes(router, ledgerStore)
+	}
+	return router
+}
+
+func TestDebugRoutesOff(t *testing.T) {
+	router := setupDebugRouter(false)
+
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/stats"} {
+		if rr := serveRequest(router, "GET", path); rr.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for %s without the flag, got %d", path, rr.Code)
+		}
+	}
+}
+
+func TestDebugRoutesOn(t *testing.T) {
+	router := setupDebugRouter(true)
+
+	rr := serveRequest(router, "GET", "/debug/pprof/")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "goroutine") {
+		t.Errorf("expected the profile index, got %d", rr.Code)
+	}
+
+	rr = serveRequest(router, "GET", "/debug/pprof/heap?debug=1")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "heap profile") {
+		t.Errorf("expected the heap profile, got %d %.100s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveRequest(router, "GET", "/debug/stats")
+	var stats debugStatsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected the stats, got %d %v", rr.Code, err)
+	}
+	if stats.MemStats.HeapAlloc == 0 || stats.Goroutines == 0 || stats.Store.Users != 1 || stats.Store.Transactions != 1 {
+		t.Errorf("unexpected stats: goroutines %d heap %d store %+v", stats.Goroutines, stats.MemStats.HeapAlloc, stats.Store)
+	}
+}
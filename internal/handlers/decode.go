@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"tiny-ledger/internal/services"
+)
+
+const (
+	codeEmptyBody     = "empty_body"
+	codeMalformedJSON = "malformed_json"
+	codeUnknownField  = "unknown_field"
+	codeInvalidType   = "invalid_type"
+	codeBodyTooLarge  = "body_too_large"
+)
+
+// decodeJSONBody decodes exactly one JSON object into dst. unknown fields, trailing data and type mismatches are
+// rejected with a message naming the field, an absent body is reported as empty_body so optional bodies can allow it
+func decodeJSONBody(r *http.Request, dst interface{}) *services.ValidationError {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return decodeError(err)
+		}
+		return &services.ValidationError{Code: codeMalformedJSON, Message: "request body must contain a single JSON value"}
+	}
+	return nil
+}
+
+// sendDecodeError answers 413 for a body over the limit and 400 for everything else
+func (h *LedgerHandler) sendDecodeError(w http.ResponseWriter, r *http.Request, err *services.ValidationError) {
+	if err.Code == codeBodyTooLarge {
+		h.requestLogger(r).WarnContext(r.Context(), "request body too large", "content_length", r.ContentLength)
+		sendError(w, r, http.StatusRequestEntityTooLarge, ErrorResponse{Error: err.Message, Code: err.Code})
+		return
+	}
+	h.sendValidationError(w, r, err)
+}
+
+func decodeError(err error) *services.ValidationError {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	var maxBytesErr *http.MaxBytesError
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return &services.ValidationError{
+			Code:    codeBodyTooLarge,
+			Message: fmt.Sprintf("request body exceeds the limit of %d bytes", maxBytesErr.Limit),
+		}
+	case errors.Is(err, io.EOF):
+		return &services.ValidationError{Code: codeEmptyBody, Message: "request body is empty"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &services.ValidationError{Code: codeMalformedJSON, Message: "malformed JSON: unexpected end of body"}
+	case errors.As(err, &syntaxErr):
+		return &services.ValidationError{
+			Code:    codeMalformedJSON,
+			Message: fmt.Sprintf("malformed JSON at byte %d: %s", syntaxErr.Offset, syntaxErr.Error()),
+		}
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return &services.ValidationError{
+				Code:    codeInvalidType,
+				Message: fmt.Sprintf("request body must be a JSON %s, got %s", jsonTypeName(typeErr.Type), typeErr.Value),
+			}
+		}
+		return &services.ValidationError{
+			Field:   typeErr.Field,
+			Code:    codeInvalidType,
+			Message: fmt.Sprintf("%s must be a %s, got %s", typeErr.Field, jsonTypeName(typeErr.Type), typeErr.Value),
+		}
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no typed error for unknown fields
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return &services.ValidationError{Field: field, Code: codeUnknownField, Message: fmt.Sprintf("unknown field %q", field)}
+	default:
+		return &services.ValidationError{Code: codeMalformedJSON, Message: "invalid request format: " + err.Error()}
+	}
+}
+
+// jsonTypeName names the JSON type a Go type is decoded from
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Float32, reflect.Float64, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
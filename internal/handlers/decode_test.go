@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestStrictJSONDecoding(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	tests := []struct {
+		name          string
+		path          string
+		body          string
+		expectedCode  string
+		expectedField string
+	}{
+		{
+			name:         "empty body",
+			path:         "/users/user1/transactions",
+			body:         "",
+			expectedCode: codeEmptyBody,
+		},
+		{
+			name:         "whitespace only body",
+			path:         "/users/user1/transactions",
+			body:         "  \n",
+			expectedCode: codeEmptyBody,
+		},
+		{
+			name:         "truncated body",
+			path:         "/users/user1/transactions",
+			body:         `{"type":"deposit","amount":`,
+			expectedCode: codeMalformedJSON,
+		},
+		{
+			name:         "syntax error",
+			path:         "/users/user1/transactions",
+			body:         `{"type":"deposit",,}`,
+			expectedCode: codeMalformedJSON,
+		},
+		{
+			name:          "unknown field",
+			path:          "/users/user1/transactions",
+			body:          `{"type":"deposit","amout":10}`,
+			expectedCode:  codeUnknownField,
+			expectedField: "amout",
+		},
+		{
+			name:         "multiple documents",
+			path:         "/users/user1/transactions",
+			body:         `{"type":"deposit","amount":10}{"type":"deposit","amount":10}`,
+			expectedCode: codeMalformedJSON,
+		},
+		{
+			name:         "trailing garbage",
+			path:         "/users/user1/transactions",
+			body:         `{"type":"deposit","amount":10} x`,
+			expectedCode: codeMalformedJSON,
+		},
+		{
+			name:          "amount as a string",
+			path:          "/users/user1/transactions",
+			body:          `{"type":"deposit","amount":"10"}`,
+			expectedCode:  codeInvalidType,
+			expectedField: "amount",
+		},
+		{
+			name:          "allowDuplicate as a string",
+			path:          "/users/user1/transactions",
+			body:          `{"type":"deposit","amount":10,"allowDuplicate":"yes"}`,
+			expectedCode:  codeInvalidType,
+			expectedField: "allowDuplicate",
+		},
+		{
+			name:         "array instead of an object",
+			path:         "/users/user1/transactions",
+			body:         `[1,2]`,
+			expectedCode: codeInvalidType,
+		},
+		{
+			name:          "unknown field on a transfer",
+			path:          "/users/user1/transfers",
+			body:          `{"to":"user2","amount":10}`,
+			expectedCode:  codeUnknownField,
+			expectedField: "to",
+		},
+		{
+			name:          "unknown field on a preview",
+			path:          "/users/user1/transactions/preview",
+			body:          `{"type":"deposit","amount":10,"fee":1}`,
+			expectedCode:  codeUnknownField,
+			expectedField: "fee",
+		},
+		{
+			name:          "user ID as a number",
+			path:          "/users",
+			body:          `{"userId":42}`,
+			expectedCode:  codeInvalidType,
+			expectedField: "userId",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("POST", tt.path, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			body := decodeErrorBody(t, rr, http.StatusBadRequest, kindValidationFailed)
+			if body.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, body.Code)
+			}
+			if body.Field != tt.expectedField {
+				t.Errorf("expected field %q, got %q", tt.expectedField, body.Field)
+			}
+			if tt.expectedField != "" && (len(body.Details.Fields) != 1 || body.Details.Fields[0].Code != tt.expectedCode) {
+				t.Errorf("expected %s in the fields, got %+v", tt.expectedField, body.Details.Fields)
+			}
+		})
+	}
+}
+
+func TestReversalAllowsEmptyBody(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	rr := postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 10.0})
+	var tx struct {
+		ID string `json:"id"`
+	}
+	_ = json.NewDecoder(rr.Body).Decode(&tx)
+
+	req, _ := http.NewRequest("POST", "/users/user1/transactions/"+tx.ID+"/reversal", http.NoBody)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected status 201 without a body, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("POST", "/users/user1/transactions/"+tx.ID+"/reversal", strings.NewReader(`{"reson":"typo"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for an unknown field, got %d", rr.Code)
+	}
+}
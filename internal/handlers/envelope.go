@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"tiny-ledger/internal/services"
+)
+
+// PageHeader is the page number of a history answered without the envelope, next to TotalCountHeader and
+// TotalPagesHeader
+const PageHeader = "X-Page"
+
+// parseEnvelope parses ?envelope=, false answers the records of the history as a bare JSON array and leaves the
+// pagination to the headers. it's a JSON shape, other media types reject it
+func parseEnvelope(query url.Values, mediaType string) (bool, *services.ValidationError) {
+	value := query.Get("envelope")
+	if value == "" {
+		return true, nil
+	}
+
+	envelope, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, &services.ValidationError{Field: "envelope", Code: "invalid_value", Message: "invalid envelope value, use true or false"}
+	}
+	if !envelope && mediaType != jsonMediaType {
+		return false, &services.ValidationError{Field: "envelope", Code: "unsupported_parameter", Message: "envelope=false is only supported on JSON responses"}
+	}
+	return envelope, nil
+}
+
+// setPageHeaders carries the pagination of a page of the history without the envelope, the Link header is set by
+// paginate either way
+func setPageHeaders(w http.ResponseWriter, pagination pagePagination) {
+	w.Header().Set(TotalCountHeader, strconv.Itoa(pagination.TotalItems))
+	w.Header().Set(PageHeader, strconv.Itoa(pagination.Page))
+	w.Header().Set(TotalPagesHeader, strconv.Itoa(pagination.TotalPages))
+}
+
+// unwrapTransactions is the transactions array of an enveloped history body, projected or not
+func unwrapTransactions(body any) (json.RawMessage, error) {
+	object, err := jsonObject(body)
+	if err != nil {
+		return nil, err
+	}
+	return object["transactions"], nil
+}
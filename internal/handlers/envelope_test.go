@@ -0,0 +1,60 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"tiny-ledger/internal/handlers"
+)
+
+func TestHistoryWithoutEnvelope(t *testing.T) {
+	s := setupCountServer(t)
+
+	queries := []string{
+		"page=2&pageSize=5",
+		"type=withdrawal&order=desc",
+		"fields=amount&pageSize=3",
+		"limit=4",
+	}
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			enveloped := s.Do(t, "GET", "/users/counter/transactions?"+query, nil)
+			bare := s.Do(t, "GET", "/users/counter/transactions?envelope=false&"+query, nil)
+			if enveloped.Status != http.StatusOK || bare.Status != http.StatusOK {
+				t.Fatalf("expected status 200, got %d and %d: %s", enveloped.Status, bare.Status, bare.Body)
+			}
+
+			var envelope struct {
+				Transactions json.RawMessage `json:"transactions"`
+			}
+			enveloped.Decode(t, &envelope)
+			if strings.TrimSpace(string(bare.Body)) != string(envelope.Transactions) {
+				t.Errorf("expected the bare array to be the enveloped records, got %s and %s", bare.Body, envelope.Transactions)
+			}
+			if bare.Header.Get("Link") == "" {
+				t.Error("expected a Link header without the envelope")
+			}
+		})
+	}
+
+	resp := s.Do(t, "GET", "/users/counter/transactions?envelope=false&page=2&pageSize=5", nil)
+	for header, expected := range map[string]string{handlers.TotalCountHeader: "37", handlers.PageHeader: "2", handlers.TotalPagesHeader: "8"} {
+		if got := resp.Header.Get(header); got != expected {
+			t.Errorf("expected %s %s, got %q", header, expected, got)
+		}
+	}
+	if !strings.Contains(resp.Header.Get("Link"), `page=3&pageSize=5>; rel="next"`) {
+		t.Errorf("expected the next page in the Link header, got %q", resp.Header.Get("Link"))
+	}
+
+	body := s.Do(t, "GET", "/users/counter/transactions?envelope=maybe", nil).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+	if body.Field != "envelope" || body.Code != "invalid_value" {
+		t.Errorf("expected invalid_value on envelope, got %s on %s", body.Code, body.Field)
+	}
+	body = s.GetAccepting(t, "/users/counter/transactions?envelope=false", "application/xml").Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+	if body.Field != "envelope" || body.Code != "unsupported_parameter" {
+		t.Errorf("expected unsupported_parameter on envelope, got %s on %s", body.Code, body.Field)
+	}
+}
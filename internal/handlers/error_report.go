@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/errreport"
+)
+
+// ErrorReportMiddleware hands the reporter to the recovery middleware and to the 500s of the handlers, it goes
+// before them in the chain
+func ErrorReportMiddleware(reporter errreport.ErrorReporter) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(errreport.NewContext(r.Context(), reporter)))
+		})
+	}
+}
+
+// reportError reports a failure of the request. the tags identify the request without what it carries, the route
+// is the template so neither the user nor the query end up in the tracker
+func reportError(r *http.Request, kind string, status int, message, stack string) {
+	route := "unmatched"
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			route = template
+		}
+	}
+	errreport.FromContext(r.Context()).Report(r.Context(), errreport.Report{
+		Kind:    kind,
+		Message: message,
+		Tags: map[string]string{
+			"request_id": RequestID(r.Context()),
+			"route":      route,
+			"method":     r.Method,
+			"status":     strconv.Itoa(status),
+		},
+		Stack: stack,
+	})
+}
@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"runtime/debug"
+
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// ErrorResponse is the body of every error. Details is the structured error, the flat fields are the previous shape
+// and stay for one more release: Error is Details.Message, Code and Field the rule and field of a validation error
+type ErrorResponse struct {
+	Error      string       `json:"error"`
+	Code       string       `json:"code,omitempty"`
+	Field      string       `json:"field,omitempty"`
+	OriginalID string       `json:"originalId,omitempty"`
+	Balance    *float64     `json:"balance,omitempty"` // of a user that can't be removed yet
+	RequestID  string       `json:"requestId,omitempty"`
+	Details    ErrorDetails `json:"details"`
+}
+
+// ErrorDetails is the machine readable error, Code is one of the error kinds below and doesn't change with the wording
+// of Message
+type ErrorDetails struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	Items     []ItemError  `json:"items,omitempty"`     // the rejected transactions of a batch
+	Supported []string     `json:"supported,omitempty"` // the media types the route serves, on a 406
+	Version   *uint64      `json:"version,omitempty"`   // the current version of the ledger, on a 412
+	RequestID string       `json:"requestId,omitempty"`
+}
+
+// FieldError is a rejected field of the request, Code is the rule it broke (not_positive, max_length...). Rule and
+// its parameter are the generic form of Code for the fields of a transaction body: max with max, enum with allowed...
+// Field is a JSON pointer (/transactions/2/amount) for a field nested in the body
+type FieldError struct {
+	Field      string   `json:"field"`
+	Code       string   `json:"code,omitempty"`
+	Message    string   `json:"message"`
+	Rule       string   `json:"rule,omitempty"`
+	Min        *float64 `json:"min,omitempty"`
+	Max        *float64 `json:"max,omitempty"`
+	Allowed    []string `json:"allowed,omitempty"`
+	Suggestion string   `json:"suggestion,omitempty"` // the valid name closest to an unknown query parameter
+}
+
+// newFieldError is err as a FieldError, its field under path when path isn't empty
+func newFieldError(path string, err *services.ValidationError) FieldError {
+	field := err.Field
+	if path != "" {
+		field = path
+		if err.Field != "" {
+			field += "/" + err.Field
+		}
+	}
+	return FieldError{
+		Field: field, Code: err.Code, Message: err.Message,
+		Rule: err.Rule, Min: err.Min, Max: err.Max, Allowed: err.Allowed,
+	}
+}
+
+// validationErrors is every *ValidationError of err: the list of a services.ValidationErrors or the single error
+func validationErrors(err error) []*services.ValidationError {
+	var list services.ValidationErrors
+	if errors.As(err, &list) {
+		return list
+	}
+	var single *services.ValidationError
+	if errors.As(err, &single) {
+		return []*services.ValidationError{single}
+	}
+	return nil
+}
+
+// error kinds of ErrorDetails.Code
+const (
+	kindValidationFailed     = "VALIDATION_FAILED"
+	kindUnauthorized         = "UNAUTHORIZED"
+	kindForbidden            = "FORBIDDEN"
+	kindNotFound             = "NOT_FOUND"
+	kindMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	kindNotAcceptable        = "NOT_ACCEPTABLE"
+	kindConflict             = "CONFLICT"
+	kindPreconditionFailed   = "PRECONDITION_FAILED"
+	kindDuplicate            = "DUPLICATE"
+	kindBodyTooLarge         = "BODY_TOO_LARGE"
+	kindUnsupportedMediaType = "UNSUPPORTED_MEDIA_TYPE"
+	kindInsufficientFunds    = "INSUFFICIENT_FUNDS"
+	kindMinimumBalance       = "MINIMUM_BALANCE"
+	kindIdempotencyKeyReused = "IDEMPOTENCY_KEY_REUSED"
+	kindUnprocessable        = "UNPROCESSABLE"
+	kindRateLimited          = "RATE_LIMITED"
+	kindTimeout              = "TIMEOUT"
+	kindInternal             = "INTERNAL"
+)
+
+// statusKinds is the kind of an error nothing more specific is known about
+var statusKinds = map[int]string{
+	http.StatusBadRequest:            kindValidationFailed,
+	http.StatusUnauthorized:          kindUnauthorized,
+	http.StatusForbidden:             kindForbidden,
+	http.StatusNotFound:              kindNotFound,
+	http.StatusMethodNotAllowed:      kindMethodNotAllowed,
+	http.StatusNotAcceptable:         kindNotAcceptable,
+	http.StatusConflict:              kindConflict,
+	http.StatusPreconditionFailed:    kindPreconditionFailed,
+	http.StatusRequestEntityTooLarge: kindBodyTooLarge,
+	http.StatusUnsupportedMediaType:  kindUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   kindUnprocessable,
+	http.StatusTooManyRequests:       kindRateLimited,
+}
+
+// serviceErrors maps the errors of the service and the store to a status, the first match wins
+var serviceErrors = []struct {
+	err    error
+	status int
+	kind   string
+}{
+	{store.ErrInsufficientFunds, http.StatusUnprocessableEntity, kindInsufficientFunds},
+	{store.ErrMinimumBalance, http.StatusUnprocessableEntity, kindMinimumBalance},
+	{services.ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, kindIdempotencyKeyReused},
+	{store.ErrUserNotFound, http.StatusNotFound, kindNotFound},
+	{store.ErrTransactionNotFound, http.StatusNotFound, kindNotFound},
+	{store.ErrJournalNotFound, http.StatusNotFound, kindNotFound},
+	{store.ErrOutboxEntryNotFound, http.StatusNotFound, kindNotFound},
+	{store.ErrPossibleDuplicate, http.StatusConflict, kindDuplicate},
+	{store.ErrDuplicateReference, http.StatusConflict, kindDuplicate},
+	{store.ErrIdempotencyKeyTaken, http.StatusConflict, kindDuplicate},
+	{store.ErrUserExists, http.StatusConflict, kindConflict},
+	{store.ErrAlreadyReversed, http.StatusConflict, kindConflict},
+	{store.ErrBalanceNotZero, http.StatusConflict, kindConflict},
+	{store.ErrUserHasJournals, http.StatusConflict, kindConflict},
+	{store.ErrReversalOfReversal, http.StatusConflict, kindConflict},
+	{store.ErrAlreadyVoided, http.StatusConflict, kindConflict},
+	{store.ErrReverseJournalLeg, http.StatusConflict, kindConflict},
+	{store.ErrVoidJournalLeg, http.StatusConflict, kindConflict},
+	{store.ErrVersionMismatch, http.StatusPreconditionFailed, kindPreconditionFailed},
+	{context.DeadlineExceeded, http.StatusServiceUnavailable, kindTimeout}, // the request timeout passed mid-call
+}
+
+// sendServiceError answers a failed service call: validation errors are 400, the known errors get their status
+// from serviceErrors and anything else is a 500
+func (h *LedgerHandler) sendServiceError(w http.ResponseWriter, r *http.Request, err error) {
+	var validationErrs services.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		h.sendValidationErrors(w, r, validationErrs)
+		return
+	}
+
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		h.sendValidationError(w, r, validationErr)
+		return
+	}
+
+	if status, body, known := knownServiceError(err); known {
+		sendError(w, r, status, body)
+		return
+	}
+	h.sendInternalError(w, r, err)
+}
+
+// knownServiceError is the status and body of an error listed in serviceErrors, known is false for the others
+func knownServiceError(err error) (status int, body ErrorResponse, known bool) {
+	for _, candidate := range serviceErrors {
+		if !errors.Is(err, candidate.err) {
+			continue
+		}
+
+		body := ErrorResponse{Error: err.Error(), Details: ErrorDetails{Code: candidate.kind}}
+		var duplicateErr *store.DuplicateError
+		var balanceErr *store.BalanceNotZeroError
+		var versionErr *store.VersionMismatchError
+		switch {
+		case errors.As(err, &duplicateErr):
+			body.Error = store.ErrPossibleDuplicate.Error()
+			body.OriginalID = duplicateErr.OriginalID.String()
+		case errors.As(err, &balanceErr):
+			body.Error = store.ErrBalanceNotZero.Error()
+			body.Code = codeBalanceNotZero
+			body.Balance = &balanceErr.Balance
+		case errors.As(err, &versionErr):
+			body.Details.Version = &versionErr.Current
+		case candidate.err == services.ErrIdempotencyKeyReused:
+			body.Code = codeIdempotencyKeyReused
+		}
+		return candidate.status, body, true
+	}
+	return 0, ErrorResponse{}, false
+}
+
+// internalErrorMessage is all a client learns of a 500, the same as the recovery middleware and gRPC answer with
+const internalErrorMessage = "internal server error"
+
+func sendErrorResponse(w http.ResponseWriter, r *http.Request, status int, message string) {
+	sendError(w, r, status, ErrorResponse{Error: message})
+}
+
+// sendValidationError reports the rejected field and the rule that rejected it, the rejected value isn't logged
+func (h *LedgerHandler) sendValidationError(w http.ResponseWriter, r *http.Request, err *services.ValidationError) {
+	h.requestLogger(r).WarnContext(r.Context(), "validation failed", "code", err.Code, "field", err.Field)
+	body := ErrorResponse{Error: err.Message, Code: err.Code, Field: err.Field}
+	if err.Field != "" {
+		body.Details.Fields = []FieldError{newFieldError("", err)}
+	}
+	sendError(w, r, http.StatusBadRequest, body)
+}
+
+// sendValidationErrors reports every rejected field in details.fields, the flat code and field are the first one's
+func (h *LedgerHandler) sendValidationErrors(w http.ResponseWriter, r *http.Request, errs services.ValidationErrors) {
+	fields := make([]FieldError, len(errs))
+	for i, err := range errs {
+		fields[i] = newFieldError("", err)
+	}
+	h.requestLogger(r).WarnContext(r.Context(), "validation failed", "code", errs[0].Code, "field", errs[0].Field, "errors", len(errs))
+	sendError(w, r, http.StatusBadRequest, ErrorResponse{
+		Error: errs.Error(), Code: errs[0].Code, Field: errs[0].Field,
+		Details: ErrorDetails{Fields: fields},
+	})
+}
+
+// sendInternalError logs and reports the store or service failure with the stack of the handler that hit it, the
+// client only gets a generic message: the error may name the internals of the store
+func (h *LedgerHandler) sendInternalError(w http.ResponseWriter, r *http.Request, err error) {
+	stack := string(debug.Stack())
+	h.requestLogger(r).ErrorContext(r.Context(), "internal error", "error", err, "stack", stack)
+	reportError(r, errreport.KindInternal, http.StatusInternalServerError, err.Error(), stack)
+	writeError(w, r, http.StatusInternalServerError, ErrorResponse{Error: internalErrorMessage})
+}
+
+// sendError stamps the request ID on the body so clients can quote it when reporting a failure, and fills the
+// structured details from the flat fields when the caller didn't. a 500 goes to the error reporter too
+func sendError(w http.ResponseWriter, r *http.Request, status int, body ErrorResponse) {
+	if status == http.StatusInternalServerError {
+		reportError(r, errreport.KindInternal, status, body.Error, string(debug.Stack()))
+	}
+	writeError(w, r, status, body)
+}
+
+// writeError is sendError without the report, for the callers that made their own
+func writeError(w http.ResponseWriter, r *http.Request, status int, body ErrorResponse) {
+	// caching headers set ahead of the data are for the data, an error is never reused
+	w.Header().Del("Cache-Control")
+	w.Header().Del("Last-Modified")
+	body.complete(status, RequestID(r.Context()))
+	sendJSONResponse(w, r, status, body)
+}
+
+// complete stamps the request ID and fills the details the caller left empty
+func (body *ErrorResponse) complete(status int, requestID string) {
+	body.RequestID = requestID
+
+	details := &body.Details
+	if details.Code == "" {
+		details.Code = statusKinds[status]
+		if details.Code == "" {
+			details.Code = kindInternal
+		}
+	}
+	if details.Message == "" {
+		details.Message = body.Error
+	}
+	if details.Fields == nil && body.Field != "" {
+		details.Fields = []FieldError{{Field: body.Field, Code: body.Code, Message: body.Error}}
+	}
+	details.RequestID = body.RequestID
+}
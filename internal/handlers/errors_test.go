@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/errreport/errreporttest"
+	"tiny-ledger/internal/metrics"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// decodeErrorBody checks the status and the kind of an error response and returns its body
+func decodeErrorBody(t *testing.T, rr *httptest.ResponseRecorder, status int, kind string) ErrorResponse {
+	t.Helper()
+
+	if rr.Code != status {
+		t.Errorf("expected status %d, got %d: %s", status, rr.Code, rr.Body.String())
+	}
+
+	var body ErrorResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not parse the error body: %v", err)
+	}
+	if body.Details.Code != kind {
+		t.Errorf("expected error kind %s, got %q", kind, body.Details.Code)
+	}
+	return body
+}
+
+func TestSendServiceError(t *testing.T) {
+	handler := setupTestHandler()
+	originalID := uuid.New()
+
+	tests := []struct {
+		name           string
+		err            error
+		expectedStatus int
+		expectedKind   string
+		expectedCode   string
+	}{
+		{"Validation", &services.ValidationError{Field: "amount", Code: "not_positive", Message: "amount must be positive"}, http.StatusBadRequest, kindValidationFailed, "not_positive"},
+		{"Wrapped validation", fmt.Errorf("leg 1: %w", &services.ValidationError{Field: "amount", Code: "max_amount", Message: "amount exceeds maximum allowed"}), http.StatusBadRequest, kindValidationFailed, "max_amount"},
+		{"Insufficient funds", store.ErrInsufficientFunds, http.StatusUnprocessableEntity, kindInsufficientFunds, ""},
+		{"Minimum balance", store.ErrMinimumBalance, http.StatusUnprocessableEntity, kindMinimumBalance, ""},
+		{"Idempotency key reused", services.ErrIdempotencyKeyReused, http.StatusUnprocessableEntity, kindIdempotencyKeyReused, codeIdempotencyKeyReused},
+		{"Unknown user", store.ErrUserNotFound, http.StatusNotFound, kindNotFound, ""},
+		{"Unknown transaction", store.ErrTransactionNotFound, http.StatusNotFound, kindNotFound, ""},
+		{"Possible duplicate", &store.DuplicateError{OriginalID: originalID}, http.StatusConflict, kindDuplicate, ""},
+		{"Duplicate reference", store.ErrDuplicateReference, http.StatusConflict, kindDuplicate, ""},
+		{"User exists", store.ErrUserExists, http.StatusConflict, kindConflict, ""},
+		{"Already reversed", store.ErrAlreadyReversed, http.StatusConflict, kindConflict, ""},
+		{"Balance not zero", &store.BalanceNotZeroError{Balance: 12.5}, http.StatusConflict, kindConflict, codeBalanceNotZero},
+		{"User has journals", store.ErrUserHasJournals, http.StatusConflict, kindConflict, ""},
+		{"Unknown error", errors.New("disk on fire"), http.StatusInternalServerError, kindInternal, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey{}, "req-1"))
+			rr := httptest.NewRecorder()
+			handler.sendServiceError(rr, req, tt.err)
+
+			body := decodeErrorBody(t, rr, tt.expectedStatus, tt.expectedKind)
+			if body.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, body.Code)
+			}
+			if body.Error == "" || body.Error != body.Details.Message {
+				t.Errorf("expected the legacy error to match the message, got %q and %q", body.Error, body.Details.Message)
+			}
+			if body.RequestID != "req-1" || body.Details.RequestID != "req-1" {
+				t.Errorf("expected the request ID in both shapes, got %q and %q", body.RequestID, body.Details.RequestID)
+			}
+
+			var duplicateErr *store.DuplicateError
+			if errors.As(tt.err, &duplicateErr) && body.OriginalID != originalID.String() {
+				t.Errorf("expected originalId %s, got %q", originalID, body.OriginalID)
+			}
+		})
+	}
+}
+
+func TestSendInternalErrorHidesTheCause(t *testing.T) {
+	handler := setupTestHandler()
+	reporter := &errreporttest.Reporter{}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req = req.WithContext(errreport.NewContext(req.Context(), reporter))
+	rr := httptest.NewRecorder()
+	handler.sendServiceError(rr, req, errors.New("open /var/lib/ledger/wal: disk on fire"))
+
+	body := decodeErrorBody(t, rr, http.StatusInternalServerError, kindInternal)
+	if body.Error != "internal server error" || body.Details.Message != "internal server error" {
+		t.Errorf("expected a generic message, got %q and %q", body.Error, body.Details.Message)
+	}
+	// the cause is kept for the tracker
+	reports := reporter.Reports()
+	if len(reports) != 1 || reports[0].Kind != errreport.KindInternal || reports[0].Message != "open /var/lib/ledger/wal: disk on fire" || reports[0].Stack == "" {
+		t.Errorf("expected the cause reported, got %+v", reports)
+	}
+}
+
+// TestTransactionRejections posts transactions the service refuses for different reasons, a malformed request is the
+// only 400 and every business rule has a status of its own
+func TestTransactionRejections(t *testing.T) {
+	ledgerMetrics := metrics.New(func() (int, float64) { return 0, 0 })
+	router := mux.NewRouter()
+	router.Use(ledgerMetrics.Middleware)
+	config := services.DefaultConfig()
+	config.DuplicateWindow = time.Minute
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore(), services.WithConfig(config)), discardLogger).RegisterRoutes(router, APIPrefix)
+
+	post := func(body transactionRequest, key string) *httptest.ResponseRecorder {
+		encoded, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", APIPrefix+"/users/alice/transactions", bytes.NewReader(encoded))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(IdempotencyKeyHeader, key)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	for key, body := range map[string]transactionRequest{
+		"":      {TransactionType: "deposit", Amount: 50, Description: "salary"},
+		"key-1": {TransactionType: "deposit", Amount: 5, Description: "interest"},
+	} {
+		if rr := post(body, key); rr.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+
+	tests := []struct {
+		name           string
+		body           transactionRequest
+		key            string
+		expectedStatus int
+		expectedKind   string
+		expectedCode   string
+	}{
+		{"Invalid amount", transactionRequest{TransactionType: "deposit", Amount: -1}, "", http.StatusBadRequest, kindValidationFailed, "not_positive"},
+		{"Insufficient funds", transactionRequest{TransactionType: "withdrawal", Amount: 80}, "", http.StatusUnprocessableEntity, kindInsufficientFunds, ""},
+		{"Possible duplicate", transactionRequest{TransactionType: "deposit", Amount: 50, Description: "salary"}, "", http.StatusConflict, kindDuplicate, ""},
+		{"Idempotency key of another request", transactionRequest{TransactionType: "deposit", Amount: 60}, "key-1", http.StatusUnprocessableEntity, kindIdempotencyKeyReused, codeIdempotencyKeyReused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := decodeErrorBody(t, post(tt.body, tt.key), tt.expectedStatus, tt.expectedKind)
+			if body.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, body.Code)
+			}
+		})
+	}
+
+	rr := httptest.NewRecorder()
+	ledgerMetrics.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	for _, want := range []string{
+		`ledger_http_errors_total{class="business",route="/v1/users/{userId}/transactions"} 3`,
+		`ledger_http_errors_total{class="client",route="/v1/users/{userId}/transactions"} 1`,
+	} {
+		if !strings.Contains(rr.Body.String(), want) {
+			t.Errorf("expected %q in the scrape", want)
+		}
+	}
+}
+
+func TestValidationErrorFields(t *testing.T) {
+	router := mux.NewRouter()
+	setupTestHandler().RegisterRoutes(router, "")
+
+	rr := postJSON(router, "/users/fields_user/transactions", map[string]interface{}{"amount": -5.0, "type": "deposit"})
+	body := decodeErrorBody(t, rr, http.StatusBadRequest, kindValidationFailed)
+
+	want := FieldError{Field: "amount", Code: "not_positive", Message: "amount must be positive", Rule: "positive"}
+	if len(body.Details.Fields) != 1 || !reflect.DeepEqual(body.Details.Fields[0], want) {
+		t.Errorf("expected fields [%+v], got %+v", want, body.Details.Fields)
+	}
+	if body.Code != want.Code || body.Field != want.Field {
+		t.Errorf("expected the legacy code and field to stay, got %q and %q", body.Code, body.Field)
+	}
+}
+
+func TestValidationErrorFieldsAggregated(t *testing.T) {
+	router := mux.NewRouter()
+	setupTestHandler().RegisterRoutes(router, "")
+
+	rr := postJSON(router, "/users/fields_user/transactions", map[string]interface{}{
+		"amount": -5.0, "type": "bonus", "description": strings.Repeat("x", 501),
+	})
+	var body struct {
+		Code    string `json:"code"`
+		Field   string `json:"field"`
+		Details struct {
+			Fields json.RawMessage `json:"fields"`
+		} `json:"details"`
+	}
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not parse the body: %v", err)
+	}
+
+	expected := `[
+		{"field": "amount", "code": "not_positive", "message": "amount must be positive", "rule": "positive"},
+		{"field": "type", "code": "invalid_value", "message": "invalid transaction type", "rule": "enum", "allowed": ["deposit", "withdrawal"]},
+		{"field": "description", "code": "max_length", "message": "description exceeds maximum length of 500 characters", "rule": "max_length", "max": 500}
+	]`
+	assertJSONEqual(t, expected, body.Details.Fields)
+	if body.Code != "not_positive" || body.Field != "amount" {
+		t.Errorf("expected the legacy code and field of the first error, got %q and %q", body.Code, body.Field)
+	}
+
+	// the limit comes with the rule
+	rr = postJSON(router, "/users/fields_user/transactions", map[string]interface{}{"amount": 2000000.0, "type": "deposit"})
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not parse the body: %v", err)
+	}
+	assertJSONEqual(t, `[{"field": "amount", "code": "max_amount", "message": "deposit amount exceeds maximum allowed of 1000000.00", "rule": "max", "max": 1000000}]`, body.Details.Fields)
+}
+
+// assertJSONEqual compares two JSON documents regardless of their formatting
+func assertJSONEqual(t *testing.T, expected string, got []byte) {
+	t.Helper()
+	var expectedValue, gotValue any
+	if err := json.Unmarshal([]byte(expected), &expectedValue); err != nil {
+		t.Fatalf("could not parse the expected JSON: %v", err)
+	}
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("could not parse %s: %v", got, err)
+	}
+	if !reflect.DeepEqual(expectedValue, gotValue) {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"tiny-ledger/internal/services"
+)
+
+// etag is the strong entity tag of a ledger version, the quoted number
+func etag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// setETag tags the response with the current version of the user's ledger. it's read before the data so a write in
+// between can only make the tag older than the body, a conditional request then fails rather than matching a
+// version it didn't see. an unknown user gets no tag, the data call reports it
+func (h *LedgerHandler) setETag(w http.ResponseWriter, r *http.Request, userId string) {
+	version, err := h.ledger(r).GetLedgerVersion(userId)
+	if err != nil {
+		return
+	}
+	w.Header().Set("ETag", etag(version))
+}
+
+// ifMatch parses If-Match against a ledger version. conditional is false without the header or with *, the user
+// exists by the time the write runs anyway. a weak tag, a list or anything but a version the API handed out is
+// rejected rather than ignored, the client meant the write to be conditional
+func ifMatch(r *http.Request) (version uint64, conditional bool, verr *services.ValidationError) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, false, nil
+	}
+
+	invalid := &services.ValidationError{Field: "If-Match", Code: "invalid_value", Message: "If-Match must be a single ETag of the ledger, as returned by the balance"}
+	unquoted, ok := strings.CutPrefix(value, `"`)
+	if !ok {
+		return 0, false, invalid
+	}
+	unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	if !ok {
+		return 0, false, invalid
+	}
+	version, err := strconv.ParseUint(unquoted, 10, 64)
+	if err != nil {
+		return 0, false, invalid
+	}
+	return version, true, nil
+}
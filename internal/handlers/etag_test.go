@@ -0,0 +1,85 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"tiny-ledger/internal/apitest"
+)
+
+// reverseIfMatch posts an empty reversal of txID with the If-Match header, none when ifMatch is empty
+func reverseIfMatch(t *testing.T, s *apitest.Server, txID, ifMatch string) apitest.Response {
+	t.Helper()
+	req := httptest.NewRequest("POST", s.Prefix+"/users/alice/transactions/"+txID+"/reversal", nil)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	return s.Serve(t, req)
+}
+
+func setupETagServer(t *testing.T) (*apitest.Server, apitest.Transaction) {
+	t.Helper()
+
+	s := apitest.NewTestServer()
+	deposit := s.PostTransaction(t, "alice", apitest.TransactionRequest{Type: "deposit", Amount: 100, Description: "salary"}).Expect(t, http.StatusCreated).Transaction(t)
+	return s, deposit
+}
+
+func TestIfMatchReversal(t *testing.T) {
+	s, deposit := setupETagServer(t)
+
+	tag := s.Do(t, "GET", "/users/alice/balance", nil).Header.Get("ETag")
+	if tag == "" {
+		t.Fatalf("expected an ETag on the balance")
+	}
+	if summaryTag := s.Do(t, "GET", "/users/alice/summary", nil).Header.Get("ETag"); summaryTag != tag {
+		t.Errorf("expected the summary to carry the same ETag %s, got %s", tag, summaryTag)
+	}
+
+	// an unrelated write moves the ledger on
+	s.PostTransaction(t, "alice", apitest.TransactionRequest{Type: "deposit", Amount: 5, Description: "interest"})
+	current := s.Do(t, "GET", "/users/alice/balance", nil).Header.Get("ETag")
+	if current == tag {
+		t.Fatalf("expected the deposit to change the ETag %s", tag)
+	}
+
+	resp := reverseIfMatch(t, s, deposit.ID.String(), tag)
+	body := resp.Error(t, http.StatusPreconditionFailed, "PRECONDITION_FAILED")
+	if body.Details.Version == nil || fmt.Sprintf(`"%d"`, *body.Details.Version) != current {
+		t.Errorf("expected the current version %s in the details, got %+v", current, body.Details)
+	}
+	if resp.Header.Get("ETag") != current {
+		t.Errorf("expected the ETag %s on the 412, got %q", current, resp.Header.Get("ETag"))
+	}
+
+	reverseIfMatch(t, s, deposit.ID.String(), current).Expect(t, http.StatusCreated)
+	if resp := s.Do(t, "GET", "/users/alice/balance", nil); resp.Header.Get("ETag") == current {
+		t.Errorf("expected the reversal to change the ETag %s", current)
+	}
+}
+
+func TestIfMatchUnconditional(t *testing.T) {
+	for _, ifMatch := range []string{"", "*"} {
+		t.Run("If-Match "+ifMatch, func(t *testing.T) {
+			s, deposit := setupETagServer(t)
+			if resp := reverseIfMatch(t, s, deposit.ID.String(), ifMatch); resp.Status != http.StatusCreated {
+				t.Errorf("expected status 201, got %d: %s", resp.Status, resp.Body)
+			}
+		})
+	}
+}
+
+func TestIfMatchInvalid(t *testing.T) {
+	s, deposit := setupETagServer(t)
+
+	for _, ifMatch := range []string{`W/"1"`, `"1", "2"`, "1", `"abc"`, `"-1"`} {
+		t.Run(ifMatch, func(t *testing.T) {
+			body := reverseIfMatch(t, s, deposit.ID.String(), ifMatch).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+			if body.Field != "If-Match" {
+				t.Errorf("expected the If-Match header to be blamed, got %q", body.Field)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+)
+
+const csvContentType = "text/csv; charset=utf-8"
+
+// wantsCSV tells whether the client prefers CSV to JSON in the Accept header
+func wantsCSV(r *http.Request) bool {
+	mediaType, _ := negotiate(r, jsonMediaType, csvMediaType)
+	return mediaType == csvMediaType
+}
+
+func (h *LedgerHandler) handleExport(w http.ResponseWriter, r *http.Request) {
+	if format := r.URL.Query().Get("format"); format != "" && format != "csv" {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "format", Code: "invalid_value", Message: "invalid format value, use csv"})
+		return
+	}
+
+	q, verr := h.parseHistoryQuery(r.URL.Query())
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+	h.exportCSV(w, r, mux.Vars(r)["userId"], q)
+}
+
+// exportCSV streams the history as a CSV attachment. the rows are flushed to the client as they're written, so
+// once the first one went out a failure can only cut the response short
+func (h *LedgerHandler) exportCSV(w http.ResponseWriter, r *http.Request, userId string, q historyQuery) {
+	if verr := unpaginated(r.URL.Query(), q, "the export isn't paginated, leave out page, pageSize, cursor and limit"); verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
+	w.Header().Set("Content-Type", csvContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="transactions-%s-%s.csv"`, userId, exportRange(q.filter)))
+
+	stream := &flushWriter{w: w}
+	err := h.serviceFor(r.Context()).ExportTransactionsCSV(r.Context(), userId, q.filter, stream)
+	if err == nil {
+		return
+	}
+
+	if stream.started {
+		if !errors.Is(err, context.Canceled) {
+			h.requestLogger(r).ErrorContext(r.Context(), "export interrupted", "error", err)
+		}
+		// the status is already sent, aborting tells the client the file is incomplete
+		panic(http.ErrAbortHandler)
+	}
+
+	w.Header().Del("Content-Disposition")
+	if errors.Is(err, context.Canceled) {
+		// the client is gone, nobody to answer
+		return
+	}
+	h.sendServiceError(w, r, err)
+}
+
+// exportRange names the period of the file, e.g. 2024-01-01_2024-01-31, an open end is start or now
+func exportRange(filter services.HistoryFilter) string {
+	if filter.StartTime == nil && filter.EndTime == nil {
+		return "all"
+	}
+
+	start, end := "start", "now"
+	if filter.StartTime != nil {
+		start = filter.StartTime.UTC().Format(time.DateOnly)
+	}
+	if filter.EndTime != nil {
+		end = filter.EndTime.UTC().Format(time.DateOnly)
+	}
+	return start + "_" + end
+}
+
+// flushWriter pushes every write to the client instead of letting the response buffer up
+type flushWriter struct {
+	w       http.ResponseWriter
+	started bool
+}
+
+func (f *flushWriter) Write(p []byte) (int, error) {
+	f.started = true
+	n, err := f.w.Write(p)
+	if flusher, ok := f.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return n, err
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+)
+
+func TestExportCSV(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	for i := 0; i < 30; i++ {
+		txType := "deposit"
+		if i%3 == 2 {
+			txType = "withdrawal"
+		}
+		postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": txType, "amount": float64(i + 1), "description": "row, with \"quotes\" " + strconv.Itoa(i)})
+	}
+
+	start := time.Now().Add(-time.Hour).UTC()
+	end := time.Now().Add(time.Hour).UTC()
+	rangeQuery := "start=" + url.QueryEscape(start.Format(time.RFC3339)) + "&end=" + url.QueryEscape(end.Format(time.RFC3339))
+	expectedFilename := `attachment; filename="transactions-user1-` + start.Format(time.DateOnly) + "_" + end.Format(time.DateOnly) + `.csv"`
+
+	tests := []struct {
+		name   string
+		path   string
+		accept string
+	}{
+		{"export endpoint", "/users/user1/transactions/export?format=csv&" + rangeQuery, ""},
+		{"export endpoint without format", "/users/user1/transactions/export?" + rangeQuery, ""},
+		{"content negotiation", "/users/user1/transactions?" + rangeQuery, "text/csv"},
+		{"content negotiation among others", "/users/user1/transactions?" + rangeQuery, "application/json;q=0.5, text/csv"},
+	}
+
+	req, _ := http.NewRequest("GET", "/users/user1/transactions?pageSize=100&"+rangeQuery, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	var history struct {
+		Transactions []models.TransactionRecord `json:"transactions"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&history); err != nil {
+		t.Fatalf("failed to decode the history: %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			if ct := rr.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+				t.Errorf("unexpected Content-Type %q", ct)
+			}
+			if cd := rr.Header().Get("Content-Disposition"); cd != expectedFilename {
+				t.Errorf("expected Content-Disposition %q, got %q", expectedFilename, cd)
+			}
+			if !rr.Flushed {
+				t.Errorf("expected the export to be flushed while streaming")
+			}
+
+			rows, err := csv.NewReader(rr.Body).ReadAll()
+			if err != nil {
+				t.Fatalf("export is not valid CSV: %v", err)
+			}
+			if len(rows) != len(history.Transactions)+1 {
+				t.Fatalf("expected %d rows, got %d", len(history.Transactions)+1, len(rows))
+			}
+
+			for i, tx := range history.Transactions {
+				row := rows[i+1]
+				amount, _ := strconv.ParseFloat(row[3], 64)
+				timestamp, _ := time.Parse(time.RFC3339Nano, row[1])
+				if row[0] != tx.ID.String() || !timestamp.Equal(tx.Timestamp) || row[2] != string(tx.Type) || amount != tx.Amount || row[5] != tx.Description {
+					t.Errorf("row %d %v doesn't match %+v", i+1, row, tx)
+				}
+			}
+		})
+	}
+}
+
+func TestExportCSVErrors(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 1.0})
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"unknown format", "format=xlsx", "invalid_value"},
+		{"invalid filter", "start=yesterday", "invalid_time"},
+		{"paginated", "page=2", "unsupported_parameter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/user1/transactions/export?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", rr.Code)
+			}
+			if cd := rr.Header().Get("Content-Disposition"); cd != "" {
+				t.Errorf("expected no attachment for an error, got %q", cd)
+			}
+			var response ErrorResponse
+			_ = json.NewDecoder(rr.Body).Decode(&response)
+			if response.Code != tt.expectedCode {
+				t.Errorf("expected code %q, got %q", tt.expectedCode, response.Code)
+			}
+		})
+	}
+
+	t.Run("cancelled request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		req, _ := http.NewRequestWithContext(ctx, "GET", "/users/user1/transactions/export", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Body.Len() != 0 {
+			t.Errorf("expected nothing to be written for a cancelled request, got %q", rr.Body.String())
+		}
+	})
+}
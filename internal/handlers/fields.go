@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+
+	"tiny-ledger/internal/services"
+)
+
+// fieldSet is a ?fields= selection of the top level fields of a response DTO, nil keeps every field
+type fieldSet map[string]bool
+
+// parseFields validates ?fields= (comma separated, may be repeated) against the JSON names of dto. the identifier
+// idField is always kept. the selection is a JSON projection, other media types reject it
+func parseFields(query url.Values, mediaType string, dto any, idField string) (fieldSet, *services.ValidationError) {
+	if !query.Has("fields") {
+		return nil, nil
+	}
+	if mediaType != jsonMediaType {
+		return nil, &services.ValidationError{Field: "fields", Code: "unsupported_parameter", Message: "fields is only supported on JSON responses"}
+	}
+
+	valid := jsonFieldNames(reflect.TypeOf(dto))
+	selected := fieldSet{idField: true}
+	for _, value := range query["fields"] {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			if !slices.Contains(valid, name) {
+				return nil, &services.ValidationError{
+					Field:   "fields",
+					Code:    "unknown_field",
+					Message: fmt.Sprintf("unknown field %q, use %s", name, strings.Join(valid, ", ")),
+				}
+			}
+			selected[name] = true
+		}
+	}
+	return selected, nil
+}
+
+// jsonFieldNames are the names the fields of the struct type have in JSON, in declaration order
+func jsonFieldNames(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// project is the JSON object of dto with only the selected fields, the others are left out rather than null
+func (f fieldSet) project(dto any) (any, error) {
+	if f == nil {
+		return dto, nil
+	}
+
+	object, err := jsonObject(dto)
+	if err != nil {
+		return nil, err
+	}
+	for name := range object {
+		if !f[name] {
+			delete(object, name)
+		}
+	}
+	return object, nil
+}
+
+// projectTransactions applies the selection to every record in the transactions of a history page, the pagination is
+// kept whole
+func (f fieldSet) projectTransactions(page any) (any, error) {
+	if f == nil {
+		return page, nil
+	}
+
+	object, err := jsonObject(page)
+	if err != nil {
+		return nil, err
+	}
+	var transactions []map[string]json.RawMessage
+	if err := json.Unmarshal(object["transactions"], &transactions); err != nil {
+		return nil, err
+	}
+	for _, tx := range transactions {
+		for name := range tx {
+			if !f[name] {
+				delete(tx, name)
+			}
+		}
+	}
+	if object["transactions"], err = json.Marshal(transactions); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+func jsonObject(v any) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var object map[string]json.RawMessage
+	err = json.Unmarshal(encoded, &object)
+	return object, err
+}
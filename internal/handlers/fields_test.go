@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+
+	"tiny-ledger/internal/apitest"
+)
+
+// setupFieldsServer serves alice with three described deposits
+func setupFieldsServer(t *testing.T) (*apitest.Server, apitest.Transaction) {
+	t.Helper()
+
+	s := apitest.NewTestServer()
+	var last apitest.Transaction
+	for _, description := range []string{"salary", "bonus", "refund of the phone bill"} {
+		last = s.PostTransaction(t, "alice", apitest.TransactionRequest{Type: "deposit", Amount: 25, Description: description}).Expect(t, http.StatusCreated).Transaction(t)
+	}
+	return s, last
+}
+
+// assertKeys checks the object has exactly the expected keys, an excluded field mustn't be there even as null
+func assertKeys(t *testing.T, object map[string]json.RawMessage, expected ...string) {
+	t.Helper()
+
+	keys := slices.Sorted(maps.Keys(object))
+	slices.Sort(expected)
+	if !slices.Equal(keys, expected) {
+		t.Errorf("expected the fields %v, got %v", expected, keys)
+	}
+}
+
+func TestSparseFieldsTransaction(t *testing.T) {
+	s, tx := setupFieldsServer(t)
+	path := "/users/alice/transactions/" + tx.ID.String()
+
+	full := s.Do(t, "GET", path, nil)
+	sparse := s.Do(t, "GET", path+"?fields=amount,timestamp", nil).Expect(t, http.StatusOK)
+	if len(sparse.Body) >= len(full.Body) {
+		t.Errorf("expected a smaller payload, got %d bytes against %d", len(sparse.Body), len(full.Body))
+	}
+
+	var object map[string]json.RawMessage
+	sparse.Decode(t, &object)
+	// id is always there
+	assertKeys(t, object, "id", "amount", "timestamp")
+	if string(object["id"]) != `"`+tx.ID.String()+`"` || string(object["amount"]) != "25" {
+		t.Errorf("unexpected values: %s", sparse.Body)
+	}
+}
+
+func TestSparseFieldsHistory(t *testing.T) {
+	s, _ := setupFieldsServer(t)
+
+	for _, query := range []string{"?fields=id,amount,timestamp", "?fields=amount&fields=timestamp", "?fields=amount,timestamp&limit=2"} {
+		t.Run(query, func(t *testing.T) {
+			full := s.Do(t, "GET", "/users/alice/transactions", nil)
+			sparse := s.Do(t, "GET", "/users/alice/transactions"+query, nil).Expect(t, http.StatusOK)
+			if len(sparse.Body) >= len(full.Body) {
+				t.Errorf("expected a smaller payload, got %d bytes against %d", len(sparse.Body), len(full.Body))
+			}
+
+			var page struct {
+				Transactions []map[string]json.RawMessage `json:"transactions"`
+				Pagination   map[string]json.RawMessage   `json:"pagination"`
+			}
+			sparse.Decode(t, &page)
+			if len(page.Transactions) == 0 || len(page.Pagination) == 0 {
+				t.Fatalf("expected the records and the pagination, got %s", sparse.Body)
+			}
+			for _, tx := range page.Transactions {
+				assertKeys(t, tx, "id", "amount", "timestamp")
+			}
+		})
+	}
+}
+
+func TestSparseFieldsSummary(t *testing.T) {
+	s, _ := setupFieldsServer(t)
+
+	resp := s.Do(t, "GET", "/users/alice/summary?fields=balance,transactionCount", nil)
+	var object map[string]json.RawMessage
+	resp.Decode(t, &object)
+	assertKeys(t, object, "userId", "balance", "transactionCount")
+	if string(object["balance"]) != "75" || string(object["transactionCount"]) != "3" {
+		t.Errorf("unexpected values: %s", resp.Body)
+	}
+}
+
+func TestSparseFieldsErrors(t *testing.T) {
+	s, tx := setupFieldsServer(t)
+
+	tests := []struct {
+		name         string
+		path         string
+		accept       string
+		expectedCode string
+	}{
+		{"Unknown field", "/users/alice/transactions?fields=amount,page_size", "", "unknown_field"},
+		{"Storage only field", "/users/alice/transactions/" + tx.ID.String() + "?fields=idempotencyKey", "", "unknown_field"},
+		{"Empty field", "/users/alice/summary?fields=", "", "unknown_field"},
+		{"Summary field on a transaction", "/users/alice/transactions/" + tx.ID.String() + "?fields=totalDeposits", "", "unknown_field"},
+		{"XML", "/users/alice/transactions?fields=amount", "application/xml", "unsupported_parameter"},
+		{"CSV", "/users/alice/transactions?fields=amount", "text/csv", "unsupported_parameter"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := s.GetAccepting(t, tt.path, tt.accept).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+			if body.Field != "fields" || body.Code != tt.expectedCode {
+				t.Errorf("expected %s on fields, got %s on %s: %s", tt.expectedCode, body.Code, body.Field, body.Error)
+			}
+		})
+	}
+}
@@ -0,0 +1,513 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	graphql "github.com/graph-gophers/graphql-go"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+)
+
+const (
+	// graphQLMaxDepth fits the deepest query of the schema (user, transactions, edges, node, field) with room to
+	// spare, it's what stops introspection queries that walk the type graph
+	graphQLMaxDepth = 7
+	// graphQLMaxQueryLength bounds the text of a query, a long list of aliases is rejected before being parsed
+	graphQLMaxQueryLength = 8 << 10
+	// graphQLMaxCost is the budget of a request: every field that calls the service costs 1 and transactions cost
+	// the size of the page, the first field over budget fails instead of reading the store
+	graphQLMaxCost = 500
+
+	kindQueryTooComplex = "QUERY_TOO_COMPLEX"
+)
+
+const graphQLSchema = `
+schema {
+	query: Query
+	mutation: Mutation
+}
+
+scalar Time
+
+type Query {
+	user(id: ID!): User!
+}
+
+type Mutation {
+	recordTransaction(userId: ID!, input: TransactionInput!): Transaction!
+	transfer(fromUserId: ID!, toUserId: ID!, amount: Float!, description: String): Journal!
+}
+
+enum TransactionType {
+	DEPOSIT
+	WITHDRAWAL
+}
+
+type User {
+	id: ID!
+	balance: Balance!
+	summary: Summary!
+	transactions(first: Int = 10, after: String, filter: TransactionFilter): TransactionConnection!
+}
+
+type Balance {
+	balance: Float!
+	minimumBalance: Float!
+	availableBalance: Float!
+	currency: String!
+	asOf: Time!
+}
+
+type Summary {
+	totalDeposits: Float!
+	totalWithdrawals: Float!
+	totalFees: Float!
+	transactionCount: Int!
+}
+
+type Transaction {
+	id: ID!
+	amount: Float!
+	fee: Float!
+	type: TransactionType!
+	timestamp: Time!
+	description: String
+	referenceId: String
+	journalId: ID
+	voided: Boolean!
+}
+
+input TransactionFilter {
+	type: TransactionType
+	start: Time
+	end: Time
+	minAmount: Float
+	maxAmount: Float
+	query: String
+	newestFirst: Boolean
+}
+
+type TransactionConnection {
+	edges: [TransactionEdge!]!
+	pageInfo: PageInfo!
+}
+
+type TransactionEdge {
+	cursor: String!
+	node: Transaction!
+}
+
+type PageInfo {
+	hasNextPage: Boolean!
+	endCursor: String
+}
+
+input TransactionInput {
+	type: TransactionType!
+	amount: Float!
+	description: String
+	referenceId: String
+}
+
+type Journal {
+	id: ID!
+	entries: [JournalEntry!]!
+}
+
+type JournalEntry {
+	userId: ID!
+	transaction: Transaction!
+	balanceAfter: Float
+}
+`
+
+type graphQLRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	Extensions    map[string]interface{} `json:"extensions,omitempty"` // sent by some clients, ignored
+}
+
+// graphQLError is a resolver error, graphql-go copies Extensions into the errors array
+type graphQLError struct {
+	message    string
+	extensions map[string]interface{}
+}
+
+func (e *graphQLError) Error() string {
+	return e.message
+}
+
+func (e *graphQLError) Extensions() map[string]interface{} {
+	return e.extensions
+}
+
+func newGraphQLSchema(h *LedgerHandler) *graphql.Schema {
+	return graphql.MustParseSchema(graphQLSchema, &graphQLResolver{h: h},
+		graphql.UseFieldResolvers(),
+		graphql.MaxDepth(graphQLMaxDepth),
+	)
+}
+
+// handleGraphQL answers 200 with data and errors like any GraphQL server, only a body that isn't a request gets
+// the REST error
+func (h *LedgerHandler) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphQLRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "query", Code: "required", Message: "query is required"})
+		return
+	}
+	if len(req.Query) > graphQLMaxQueryLength {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "query", Code: "max_length", Message: fmt.Sprintf("query must be at most %d bytes", graphQLMaxQueryLength)})
+		return
+	}
+
+	ctx := context.WithValue(auditContext(r), graphQLCostKey{}, new(atomic.Int64))
+	ctx = context.WithValue(ctx, graphQLRequestKey{}, r)
+	sendJSONResponse(w, r, http.StatusOK, h.graphQL().Exec(ctx, req.Query, req.OperationName, req.Variables))
+}
+
+// graphQL parses the schema once, on the first request
+func (h *LedgerHandler) graphQL() *graphql.Schema {
+	h.graphQLOnce.Do(func() {
+		h.graphQLSchema = newGraphQLSchema(h)
+	})
+	return h.graphQLSchema
+}
+
+type graphQLCostKey struct{}
+
+type graphQLRequestKey struct{}
+
+// chargeGraphQL spends cost from the budget of the request
+func chargeGraphQL(ctx context.Context, cost int) error {
+	spent, ok := ctx.Value(graphQLCostKey{}).(*atomic.Int64)
+	if !ok {
+		return nil
+	}
+	if spent.Add(int64(cost)) > graphQLMaxCost {
+		return &graphQLError{
+			message:    fmt.Sprintf("query exceeds the cost limit of %d", graphQLMaxCost),
+			extensions: map[string]interface{}{"code": kindQueryTooComplex},
+		}
+	}
+	return nil
+}
+
+// authorizeGraphQL is authorizeUser for a user named in the query
+func authorizeGraphQL(ctx context.Context, userId string) error {
+	if principal, ok := auth.PrincipalFrom(ctx); ok && !principal.CanAccess(userId) {
+		return &graphQLError{message: "token is not allowed to access this user", extensions: map[string]interface{}{"code": kindForbidden}}
+	}
+	return nil
+}
+
+// graphQLServiceError is sendServiceError for the errors array: the kind goes in extensions.code, with the rule and
+// field of a validation error
+func (h *LedgerHandler) graphQLServiceError(ctx context.Context, err error) error {
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		extensions := map[string]interface{}{"code": kindValidationFailed, "rule": validationErr.Code}
+		if validationErr.Field != "" {
+			extensions["field"] = validationErr.Field
+		}
+		return &graphQLError{message: validationErr.Message, extensions: extensions}
+	}
+
+	if _, body, known := knownServiceError(err); known {
+		extensions := map[string]interface{}{"code": body.Details.Code}
+		if body.OriginalID != "" {
+			extensions["originalId"] = body.OriginalID
+		}
+		return &graphQLError{message: body.Error, extensions: extensions}
+	}
+
+	if r, ok := ctx.Value(graphQLRequestKey{}).(*http.Request); ok {
+		h.requestLogger(r).ErrorContext(ctx, "internal error", "error", err)
+	}
+	return &graphQLError{message: err.Error(), extensions: map[string]interface{}{"code": kindInternal}}
+}
+
+type graphQLResolver struct {
+	h *LedgerHandler
+}
+
+func (q *graphQLResolver) User(ctx context.Context, args struct{ ID graphql.ID }) (*userResolver, error) {
+	userId := string(args.ID)
+	if err := authorizeGraphQL(ctx, userId); err != nil {
+		return nil, err
+	}
+	return &userResolver{h: q.h, userId: userId}, nil
+}
+
+type transactionInputArgs struct {
+	Type        string
+	Amount      float64
+	Description *string
+	ReferenceId *string
+}
+
+func (q *graphQLResolver) RecordTransaction(ctx context.Context, args struct {
+	UserID graphql.ID
+	Input  transactionInputArgs
+}) (*gqlTransaction, error) {
+	userId := string(args.UserID)
+	if err := authorizeGraphQL(ctx, userId); err != nil {
+		return nil, err
+	}
+	if err := chargeGraphQL(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	tx, err := q.h.serviceFor(ctx).WithContext(ctx).RecordTransactionInput(userId, services.TransactionInput{
+		Type:        fromGraphQLType(args.Input.Type),
+		Amount:      args.Input.Amount,
+		Description: derefString(args.Input.Description),
+		ReferenceID: derefString(args.Input.ReferenceId),
+	})
+	if err != nil {
+		return nil, q.h.graphQLServiceError(ctx, err)
+	}
+	return newGQLTransaction(tx), nil
+}
+
+func (q *graphQLResolver) Transfer(ctx context.Context, args struct {
+	FromUserID  graphql.ID
+	ToUserID    graphql.ID
+	Amount      float64
+	Description *string
+}) (*gqlJournal, error) {
+	if err := authorizeGraphQL(ctx, string(args.FromUserID)); err != nil {
+		return nil, err
+	}
+	if err := chargeGraphQL(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	journal, err := q.h.serviceFor(ctx).WithContext(ctx).Transfer(string(args.FromUserID), string(args.ToUserID), args.Amount, derefString(args.Description))
+	if err != nil {
+		return nil, q.h.graphQLServiceError(ctx, err)
+	}
+
+	result := &gqlJournal{ID: graphql.ID(journal.ID.String())}
+	for _, entry := range journal.Entries {
+		result.Entries = append(result.Entries, &gqlJournalEntry{
+			UserID:       graphql.ID(entry.UserID),
+			Transaction:  newGQLTransaction(entry.Transaction),
+			BalanceAfter: entry.BalanceAfter,
+		})
+	}
+	return result, nil
+}
+
+type userResolver struct {
+	h      *LedgerHandler
+	userId string
+}
+
+func (u *userResolver) ID() graphql.ID {
+	return graphql.ID(u.userId)
+}
+
+func (u *userResolver) Balance(ctx context.Context) (*gqlBalance, error) {
+	if err := chargeGraphQL(ctx, 1); err != nil {
+		return nil, err
+	}
+	details, err := u.h.serviceFor(ctx).WithContext(ctx).GetBalanceDetails(u.userId)
+	if err != nil {
+		return nil, u.h.graphQLServiceError(ctx, err)
+	}
+	return &gqlBalance{
+		Balance:          details.Balance,
+		MinimumBalance:   details.MinimumBalance,
+		AvailableBalance: details.AvailableBalance,
+		Currency:         details.Currency,
+		AsOf:             graphql.Time{Time: details.AsOf},
+	}, nil
+}
+
+func (u *userResolver) Summary(ctx context.Context) (*gqlSummary, error) {
+	if err := chargeGraphQL(ctx, 1); err != nil {
+		return nil, err
+	}
+	summary, err := u.h.serviceFor(ctx).WithContext(ctx).GetAccountSummary(u.userId)
+	if err != nil {
+		return nil, u.h.graphQLServiceError(ctx, err)
+	}
+	return &gqlSummary{
+		TotalDeposits:    summary.TotalDeposits,
+		TotalWithdrawals: summary.TotalWithdrawals,
+		TotalFees:        summary.TotalFees,
+		TransactionCount: int32(summary.TransactionCount),
+	}, nil
+}
+
+type transactionFilterArgs struct {
+	Type        *string
+	Start       *graphql.Time
+	End         *graphql.Time
+	MinAmount   *float64
+	MaxAmount   *float64
+	Query       *string
+	NewestFirst *bool
+}
+
+// Transactions walks the history by cursor, the edge cursors are the ones of the REST history
+func (u *userResolver) Transactions(ctx context.Context, args struct {
+	First  int32 // defaults to 10 in the schema
+	After  *string
+	Filter *transactionFilterArgs
+}) (*gqlConnection, error) {
+	first := int(args.First)
+	if first < 1 {
+		return nil, u.h.graphQLServiceError(ctx, &services.ValidationError{Field: "first", Code: "not_positive", Message: "first must be positive"})
+	}
+	if first > MaxPageSize {
+		return nil, u.h.graphQLServiceError(ctx, &services.ValidationError{Field: "first", Code: "out_of_range", Message: fmt.Sprintf("first must be at most %d", MaxPageSize)})
+	}
+	if err := chargeGraphQL(ctx, first); err != nil {
+		return nil, err
+	}
+
+	var filter services.HistoryFilter
+	if f := args.Filter; f != nil {
+		if f.Type != nil {
+			txType := fromGraphQLType(*f.Type)
+			filter.Type = &txType
+		}
+		if f.Start != nil {
+			filter.StartTime = &f.Start.Time
+		}
+		if f.End != nil {
+			filter.EndTime = &f.End.Time
+		}
+		filter.MinAmount, filter.MaxAmount = f.MinAmount, f.MaxAmount
+		filter.Query = derefString(f.Query)
+		filter.Descending = f.NewestFirst != nil && *f.NewestFirst
+	}
+
+	var after *services.HistoryCursor
+	if args.After != nil {
+		cursor, verr := decodeCursor(*args.After)
+		if verr != nil {
+			verr.Field = "after"
+			return nil, u.h.graphQLServiceError(ctx, verr)
+		}
+		after = &cursor
+	}
+
+	page, err := u.h.serviceFor(ctx).WithContext(ctx).GetTransactionHistoryAfter(u.userId, filter, after, first)
+	if err != nil {
+		return nil, u.h.graphQLServiceError(ctx, err)
+	}
+
+	connection := &gqlConnection{Edges: make([]*gqlEdge, 0, len(page.Transactions)), PageInfo: &gqlPageInfo{HasNextPage: page.NextCursor != nil}}
+	for _, tx := range page.Transactions {
+		cursor := encodeCursor(services.HistoryCursor{Timestamp: tx.Timestamp, ID: tx.ID, Descending: filter.Descending})
+		connection.Edges = append(connection.Edges, &gqlEdge{Cursor: cursor, Node: newGQLTransaction(tx)})
+	}
+	if n := len(connection.Edges); n > 0 {
+		connection.PageInfo.EndCursor = &connection.Edges[n-1].Cursor
+	}
+	return connection, nil
+}
+
+// the types below are resolved field by field through graphql.UseFieldResolvers
+
+type gqlBalance struct {
+	Balance          float64
+	MinimumBalance   float64
+	AvailableBalance float64
+	Currency         string
+	AsOf             graphql.Time
+}
+
+type gqlSummary struct {
+	TotalDeposits    float64
+	TotalWithdrawals float64
+	TotalFees        float64
+	TransactionCount int32
+}
+
+type gqlTransaction struct {
+	ID          graphql.ID
+	Amount      float64
+	Fee         float64
+	Type        string
+	Timestamp   graphql.Time
+	Description *string
+	ReferenceID *string
+	JournalID   *graphql.ID
+	Voided      bool
+}
+
+type gqlConnection struct {
+	Edges    []*gqlEdge
+	PageInfo *gqlPageInfo
+}
+
+type gqlEdge struct {
+	Cursor string
+	Node   *gqlTransaction
+}
+
+type gqlPageInfo struct {
+	HasNextPage bool
+	EndCursor   *string
+}
+
+type gqlJournal struct {
+	ID      graphql.ID
+	Entries []*gqlJournalEntry
+}
+
+type gqlJournalEntry struct {
+	UserID       graphql.ID
+	Transaction  *gqlTransaction
+	BalanceAfter *float64
+}
+
+func newGQLTransaction(tx models.TransactionRecord) *gqlTransaction {
+	result := &gqlTransaction{
+		ID:        graphql.ID(tx.ID.String()),
+		Amount:    tx.Amount,
+		Fee:       tx.Fee,
+		Type:      strings.ToUpper(string(tx.Type)),
+		Timestamp: graphql.Time{Time: tx.Timestamp},
+		Voided:    tx.Voided,
+	}
+	if tx.Description != "" {
+		result.Description = &tx.Description
+	}
+	if tx.ReferenceID != "" {
+		result.ReferenceID = &tx.ReferenceID
+	}
+	if tx.JournalID != nil {
+		journalID := graphql.ID(tx.JournalID.String())
+		result.JournalID = &journalID
+	}
+	return result
+}
+
+// fromGraphQLType maps the enum value to the service's type, the schema only lets DEPOSIT and WITHDRAWAL through
+func fromGraphQLType(value string) models.TransactionType {
+	return models.TransactionType(strings.ToLower(value))
+}
+
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+type graphQLTestResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Path       []any          `json:"path"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// setupGraphQLServer serves the API with alice holding 10 deposits of 1 to 10
+func setupGraphQLServer(t *testing.T, opts ...HandlerOption) *httptest.Server {
+	t.Helper()
+
+	svc := services.NewLedgerService(store.NewLedgerStore())
+	for i := range 10 {
+		if _, err := svc.RecordTransaction("alice", "deposit", float64(i+1), fmt.Sprintf("deposit %d", i+1)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	router := mux.NewRouter()
+	NewLedgerHandler(svc, discardLogger, opts...).RegisterRoutes(router, APIPrefix)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func postGraphQL(t *testing.T, server *httptest.Server, token, query string, variables map[string]any) (int, graphQLTestResponse) {
+	t.Helper()
+
+	body, _ := json.Marshal(map[string]any{"query": query, "variables": variables})
+	req, _ := http.NewRequest("POST", server.URL+APIPrefix+"/graphql", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result graphQLTestResponse
+	if resp.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			t.Fatalf("could not parse the response: %v", err)
+		}
+	}
+	return resp.StatusCode, result
+}
+
+// expectGraphQLError checks the single error of the response and its extensions.code
+func expectGraphQLError(t *testing.T, result graphQLTestResponse, code string) map[string]any {
+	t.Helper()
+
+	if len(result.Errors) != 1 {
+		t.Fatalf("expected one error, got %+v", result.Errors)
+	}
+	if got := result.Errors[0].Extensions["code"]; got != code {
+		t.Errorf("expected extensions.code %s, got %v (%s)", code, got, result.Errors[0].Message)
+	}
+	return result.Errors[0].Extensions
+}
+
+func TestGraphQLUserQuery(t *testing.T) {
+	server := setupGraphQLServer(t)
+
+	// the query of the web dashboard: balance, summary and the latest 5 records in one round trip
+	status, result := postGraphQL(t, server, "", `query($id: ID!) {
+		user(id: $id) {
+			id
+			balance { balance availableBalance currency }
+			summary { totalDeposits transactionCount }
+			transactions(first: 5, filter: {newestFirst: true}) {
+				edges { cursor node { amount type description } }
+				pageInfo { hasNextPage endCursor }
+			}
+		}
+	}`, map[string]any{"id": "alice"})
+	if status != http.StatusOK || len(result.Errors) != 0 {
+		t.Fatalf("expected a successful query, got %d %+v", status, result.Errors)
+	}
+
+	var data struct {
+		User struct {
+			ID      string
+			Balance struct {
+				Balance          float64
+				AvailableBalance float64
+				Currency         string
+			}
+			Summary struct {
+				TotalDeposits    float64
+				TransactionCount int
+			}
+			Transactions struct {
+				Edges []struct {
+					Cursor string
+					Node   struct {
+						Amount      float64
+						Type        string
+						Description string
+					}
+				}
+				PageInfo struct {
+					HasNextPage bool
+					EndCursor   string
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(result.Data, &data); err != nil {
+		t.Fatalf("could not parse the data: %v", err)
+	}
+
+	user := data.User
+	if user.ID != "alice" || user.Balance.Balance != 55 || user.Balance.AvailableBalance != 55 || user.Balance.Currency == "" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+	if user.Summary.TotalDeposits != 55 || user.Summary.TransactionCount != 10 {
+		t.Errorf("unexpected summary: %+v", user.Summary)
+	}
+	edges := user.Transactions.Edges
+	if len(edges) != 5 || edges[0].Node.Amount != 10 || edges[4].Node.Amount != 6 || edges[0].Node.Type != "DEPOSIT" {
+		t.Fatalf("expected the 5 newest deposits, got %+v", edges)
+	}
+	if !user.Transactions.PageInfo.HasNextPage || user.Transactions.PageInfo.EndCursor != edges[4].Cursor {
+		t.Errorf("expected a next page after the last edge, got %+v", user.Transactions.PageInfo)
+	}
+
+	// the next page picks up after the end cursor
+	_, next := postGraphQL(t, server, "", `query($after: String) {
+		user(id: "alice") { transactions(first: 5, after: $after, filter: {newestFirst: true}) { edges { node { amount } } pageInfo { hasNextPage } } }
+	}`, map[string]any{"after": user.Transactions.PageInfo.EndCursor})
+	if len(next.Errors) != 0 {
+		t.Fatalf("unexpected errors: %+v", next.Errors)
+	}
+	var nextData struct {
+		User struct {
+			Transactions struct {
+				Edges []struct {
+					Node struct{ Amount float64 }
+				}
+				PageInfo struct{ HasNextPage bool }
+			}
+		}
+	}
+	_ = json.Unmarshal(next.Data, &nextData)
+	if got := nextData.User.Transactions.Edges; len(got) != 5 || got[0].Node.Amount != 5 || got[4].Node.Amount != 1 || nextData.User.Transactions.PageInfo.HasNextPage {
+		t.Errorf("expected the 5 oldest deposits on the last page, got %+v", nextData.User.Transactions)
+	}
+}
+
+func TestGraphQLTransactionFilter(t *testing.T) {
+	server := setupGraphQLServer(t)
+
+	_, result := postGraphQL(t, server, "", `{
+		user(id: "alice") { transactions(filter: {minAmount: 4, maxAmount: 6, query: "deposit"}) { edges { node { amount } } } }
+	}`, nil)
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected errors: %+v", result.Errors)
+	}
+	if !strings.Contains(string(result.Data), `[{"node":{"amount":4}},{"node":{"amount":5}},{"node":{"amount":6}}]`) {
+		t.Errorf("expected the deposits of 4 to 6, got %s", result.Data)
+	}
+}
+
+func TestGraphQLMutations(t *testing.T) {
+	server := setupGraphQLServer(t)
+
+	_, result := postGraphQL(t, server, "", `mutation($input: TransactionInput!) {
+		recordTransaction(userId: "alice", input: $input) { id amount type description }
+	}`, map[string]any{"input": map[string]any{"type": "WITHDRAWAL", "amount": 15, "description": "groceries"}})
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected errors: %+v", result.Errors)
+	}
+	if !strings.Contains(string(result.Data), `"amount":15,"type":"WITHDRAWAL","description":"groceries"`) {
+		t.Errorf("expected the recorded withdrawal, got %s", result.Data)
+	}
+
+	_, result = postGraphQL(t, server, "", `mutation {
+		transfer(fromUserId: "alice", toUserId: "bob", amount: 40) { id entries { userId balanceAfter transaction { type journalId } } }
+	}`, nil)
+	if len(result.Errors) != 0 {
+		t.Fatalf("unexpected errors: %+v", result.Errors)
+	}
+	for _, want := range []string{`"userId":"alice","balanceAfter":0`, `"userId":"bob","balanceAfter":40`} {
+		if !strings.Contains(string(result.Data), want) {
+			t.Errorf("expected %s in %s", want, result.Data)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		mutation      string
+		variables     map[string]any
+		expectedCode  string
+		expectedField string
+	}{
+		{"Insufficient funds", `mutation { recordTransaction(userId: "alice", input: {type: WITHDRAWAL, amount: 1}) { id } }`, nil, kindInsufficientFunds, ""},
+		// graphql-go only accepts positive Float literals, a negative amount has to come in a variable
+		{"Negative amount", `mutation($input: TransactionInput!) { recordTransaction(userId: "alice", input: $input) { id } }`,
+			map[string]any{"input": map[string]any{"type": "DEPOSIT", "amount": -5}}, kindValidationFailed, "amount"},
+		{"Transfer to self", `mutation { transfer(fromUserId: "bob", toUserId: "bob", amount: 1) { id } }`, nil, kindValidationFailed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, result := postGraphQL(t, server, "", tt.mutation, tt.variables)
+			if status != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", status)
+			}
+			extensions := expectGraphQLError(t, result, tt.expectedCode)
+			if tt.expectedField != "" && extensions["field"] != tt.expectedField {
+				t.Errorf("expected field %s, got %v", tt.expectedField, extensions["field"])
+			}
+		})
+	}
+}
+
+func TestGraphQLLimits(t *testing.T) {
+	server := setupGraphQLServer(t)
+
+	var aliases strings.Builder
+	for i := range 6 {
+		fmt.Fprintf(&aliases, "t%d: transactions(first: 100) { edges { cursor } } ", i)
+	}
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"Page over the maximum", `{ user(id: "alice") { transactions(first: 500) { edges { cursor } } } }`, kindValidationFailed},
+		{"Over the cost budget", `{ user(id: "alice") { ` + aliases.String() + `} }`, kindQueryTooComplex},
+		{"Invalid cursor", `{ user(id: "alice") { transactions(after: "nope") { edges { cursor } } } }`, kindValidationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, result := postGraphQL(t, server, "", tt.query, nil)
+			expectGraphQLError(t, result, tt.expectedCode)
+		})
+	}
+
+	// introspection is recursive, the depth limit stops it walking the types
+	_, result := postGraphQL(t, server, "", `{ __schema { types { fields { type { ofType { ofType { ofType { name } } } } } } } }`, nil)
+	if len(result.Errors) == 0 || !strings.Contains(result.Errors[0].Message, "depth") {
+		t.Errorf("expected the depth limit to refuse the query, got %+v", result.Errors)
+	}
+
+	status, _ := postGraphQL(t, server, "", "{ user(id: \"alice\") { id } }"+strings.Repeat(" ", graphQLMaxQueryLength), nil)
+	if status != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a query over the length limit, got %d", status)
+	}
+}
+
+func TestGraphQLAuthorization(t *testing.T) {
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	server := setupGraphQLServer(t, WithAuth(verifier))
+
+	status, _ := postGraphQL(t, server, "", `{ user(id: "alice") { id } }`, nil)
+	if status != http.StatusUnauthorized {
+		t.Errorf("expected status 401 without a token, got %d", status)
+	}
+
+	_, result := postGraphQL(t, server, authtest.Token(authtest.Secret, "alice"), `{ user(id: "alice") { balance { balance } } }`, nil)
+	if len(result.Errors) != 0 {
+		t.Errorf("expected alice to read her own user, got %+v", result.Errors)
+	}
+
+	_, result = postGraphQL(t, server, authtest.Token(authtest.Secret, "mallory"), `{ user(id: "alice") { balance { balance } } }`, nil)
+	expectGraphQLError(t, result, kindForbidden)
+
+	_, result = postGraphQL(t, server, authtest.Token(authtest.Secret, "mallory"), `mutation { transfer(fromUserId: "alice", toUserId: "mallory", amount: 5) { id } }`, nil)
+	expectGraphQLError(t, result, kindForbidden)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"tiny-ledger/internal/buildinfo"
+
+	"github.com/gorilla/mux"
+)
+
+// HealthHandler serves the liveness and readiness probes and the build info, they're not user scoped
+type HealthHandler struct {
+	build   buildinfo.Info
+	started time.Time
+	ready   atomic.Bool
+}
+
+// NewHealthHandler starts not ready, main marks it ready once the store is loaded
+func NewHealthHandler(build buildinfo.Info) *HealthHandler {
+	return &HealthHandler{build: build, started: time.Now()}
+}
+
+// SetReady is the readiness hook: true once the store is loaded, false again when shutdown starts draining
+func (h *HealthHandler) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+func (h *HealthHandler) RegisterRoutes(r *mux.Router) {
+	r.HandleFunc("/healthz", h.handleHealth).Methods("GET")
+	r.HandleFunc("/readyz", h.handleReady).Methods("GET")
+	r.HandleFunc("/version", h.handleVersion).Methods("GET")
+}
+
+type healthResponse struct {
+	Status  string `json:"status"`
+	Uptime  string `json:"uptime"`
+	Version string `json:"version"`
+}
+
+// handleHealth is 200 as long as the process serves requests
+func (h *HealthHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
+	sendJSONResponse(w, r, http.StatusOK, h.response("ok"))
+}
+
+func (h *HealthHandler) handleReady(w http.ResponseWriter, r *http.Request) {
+	if !h.ready.Load() {
+		sendJSONResponse(w, r, http.StatusServiceUnavailable, h.response("not ready"))
+		return
+	}
+	sendJSONResponse(w, r, http.StatusOK, h.response("ready"))
+}
+
+func (h *HealthHandler) response(status string) healthResponse {
+	return healthResponse{
+		Status:  status,
+		Uptime:  time.Since(h.started).Round(time.Second).String(),
+		Version: h.build.Version,
+	}
+}
+
+type versionResponse struct {
+	Version       string    `json:"version"`
+	Commit        string    `json:"commit"`
+	BuildDate     string    `json:"buildDate"`
+	GoVersion     string    `json:"goVersion"`
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+}
+
+// handleVersion tells which build is running and since when
+func (h *HealthHandler) handleVersion(w http.ResponseWriter, r *http.Request) {
+	sendJSONResponse(w, r, http.StatusOK, versionResponse{
+		Version:       h.build.Version,
+		Commit:        h.build.Commit,
+		BuildDate:     h.build.BuildDate,
+		GoVersion:     h.build.GoVersion,
+		StartedAt:     h.started.UTC(),
+		UptimeSeconds: int64(time.Since(h.started).Seconds()),
+	})
+}
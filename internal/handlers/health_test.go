@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/buildinfo"
+
+	"github.com/gorilla/mux"
+)
+
+func TestHealthHandler(t *testing.T) {
+	handler := NewHealthHandler(buildinfo.Info{Version: "1.2.3"})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	get := func(path string) (int, healthResponse) {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var response healthResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("could not parse response: %v", err)
+		}
+		return rr.Code, response
+	}
+
+	tests := []struct {
+		name           string
+		ready          bool
+		path           string
+		expectedStatus int
+	}{
+		{"Live while loading", false, "/healthz", http.StatusOK},
+		{"Not ready while loading", false, "/readyz", http.StatusServiceUnavailable},
+		{"Ready once loaded", true, "/readyz", http.StatusOK},
+		{"Live when ready", true, "/healthz", http.StatusOK},
+		{"Not ready while draining", false, "/readyz", http.StatusServiceUnavailable},
+		{"Still live while draining", false, "/healthz", http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler.SetReady(test.ready)
+
+			status, response := get(test.path)
+			if status != test.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, test.expectedStatus)
+			}
+			if response.Version != "1.2.3" || response.Uptime == "" {
+				t.Errorf("unexpected response body: %+v", response)
+			}
+		})
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	handler := NewHealthHandler(buildinfo.Info{Version: "1.2.3", Commit: "0123abcd", BuildDate: "2026-10-16T08:00:00Z", GoVersion: "go1.23.0"})
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router)
+
+	req := httptest.NewRequest("GET", "/version", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not parse the body: %v", err)
+	}
+	expected := map[string]any{"version": "1.2.3", "commit": "0123abcd", "buildDate": "2026-10-16T08:00:00Z", "goVersion": "go1.23.0"}
+	for field, value := range expected {
+		if body[field] != value {
+			t.Errorf("expected %s %v, got %v", field, value, body[field])
+		}
+	}
+	if startedAt, _ := time.Parse(time.RFC3339Nano, body["startedAt"].(string)); time.Since(startedAt) > time.Minute {
+		t.Errorf("expected the start time of the handler, got %v", body["startedAt"])
+	}
+	if uptime, ok := body["uptimeSeconds"].(float64); !ok || uptime < 0 {
+		t.Errorf("expected the uptime in seconds, got %v", body["uptimeSeconds"])
+	}
+	if len(body) != len(expected)+2 {
+		t.Errorf("unexpected fields in %s", rr.Body.String())
+	}
+}
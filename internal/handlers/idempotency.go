@@ -0,0 +1,27 @@
+package handlers
+
+import "net/http"
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotency-Replayed"
+
+	codeIdempotencyKeyReused = "idempotency_key_reused"
+)
+
+// idempotencyKey returns the Idempotency-Key of the request, ok is false when the client didn't send one.
+// the key is validated by the service, keys are scoped to the user of the path
+func idempotencyKey(r *http.Request) (string, bool) {
+	values, ok := r.Header[http.CanonicalHeaderKey(IdempotencyKeyHeader)]
+	if !ok || len(values) == 0 {
+		return "", false
+	}
+	return values[0], true
+}
+
+// markReplayed tells the client the response is the one of the original request, nothing was recorded this time
+func markReplayed(w http.ResponseWriter, replayed bool) {
+	if replayed {
+		w.Header().Set(IdempotencyReplayedHeader, "true")
+	}
+}
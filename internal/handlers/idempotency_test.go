@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func postWithKey(router *mux.Router, path, key string, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyKeyHeader, key)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func historyTotal(t *testing.T, router *mux.Router, userId string) int {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/users/"+userId+"/transactions", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var response struct {
+		Pagination struct {
+			TotalItems int `json:"totalItems"`
+		} `json:"pagination"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode the history: %v", err)
+	}
+	return response.Pagination.TotalItems
+}
+
+func TestIdempotencyKeyTransaction(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	deposit := map[string]interface{}{"type": "deposit", "amount": 100.0, "description": "salary"}
+
+	first := postWithKey(router, "/users/user1/transactions", "retry-1", deposit)
+	if first.Code != http.StatusCreated || first.Header().Get(IdempotencyReplayedHeader) != "" {
+		t.Fatalf("expected a new transaction, got %d replayed=%q", first.Code, first.Header().Get(IdempotencyReplayedHeader))
+	}
+
+	// the client didn't get the response and retries
+	retry := postWithKey(router, "/users/user1/transactions", "retry-1", deposit)
+	if retry.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 on the retry, got %d", retry.Code)
+	}
+	if retry.Header().Get(IdempotencyReplayedHeader) != "true" {
+		t.Errorf("expected Idempotency-Replayed: true on the retry")
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the original body, got %s want %s", retry.Body.String(), first.Body.String())
+	}
+	if retry.Header().Get("Location") != first.Header().Get("Location") {
+		t.Errorf("expected the original Location")
+	}
+
+	if total := historyTotal(t, router, "user1"); total != 1 {
+		t.Errorf("expected 1 transaction in the history, got %d", total)
+	}
+
+	deposit["amount"] = 200.0
+	rr := postWithKey(router, "/users/user1/transactions", "retry-1", deposit)
+	if body := decodeErrorBody(t, rr, http.StatusUnprocessableEntity, kindIdempotencyKeyReused); body.Code != codeIdempotencyKeyReused {
+		t.Errorf("expected code %s for the same key with a different body, got %q", codeIdempotencyKeyReused, body.Code)
+	}
+
+	// keys are scoped per user
+	if rr := postWithKey(router, "/users/user2/transactions", "retry-1", deposit); rr.Code != http.StatusCreated || rr.Header().Get(IdempotencyReplayedHeader) != "" {
+		t.Errorf("expected a new transaction for another user, got %d", rr.Code)
+	}
+
+	for _, key := range []string{"", strings.Repeat("k", 65)} {
+		if rr := postWithKey(router, "/users/user1/transactions", key, deposit); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for key of length %d, got %d", len(key), rr.Code)
+		}
+	}
+}
+
+func TestIdempotencyKeyTransfer(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	postJSON(router, "/users/alice/transactions", map[string]interface{}{"type": "deposit", "amount": 100.0})
+	transfer := map[string]interface{}{"toUserId": "bob", "amount": 40.0}
+
+	first := postWithKey(router, "/users/alice/transfers", "550e8400-e29b-41d4-a716-446655440000", transfer)
+	retry := postWithKey(router, "/users/alice/transfers", "550e8400-e29b-41d4-a716-446655440000", transfer)
+
+	if first.Code != http.StatusCreated || retry.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 twice, got %d and %d", first.Code, retry.Code)
+	}
+	if retry.Header().Get(IdempotencyReplayedHeader) != "true" {
+		t.Errorf("expected Idempotency-Replayed: true on the retry")
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the original body, got %s want %s", retry.Body.String(), first.Body.String())
+	}
+
+	if total := historyTotal(t, router, "bob"); total != 1 {
+		t.Errorf("expected 1 transaction for the recipient, got %d", total)
+	}
+
+	transfer["amount"] = 50.0
+	if rr := postWithKey(router, "/users/alice/transfers", "550e8400-e29b-41d4-a716-446655440000", transfer); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for the same key with a different body, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+)
+
+const (
+	// importRouteName marks the upload routes, they take multipart/form-data and get the batch limit
+	importRouteName = "import"
+
+	// importMemory is how much of an upload is kept in memory, the rest goes to a temporary file
+	importMemory = 1 << 20
+)
+
+// handleImport records the entries of the bank file in the file part, format names it (ofx, qfx or qif) and
+// defaults to the extension of the file name. the report lists what was imported, skipped and failed
+func (h *LedgerHandler) handleImport(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["userId"]
+
+	if err := r.ParseMultipartForm(importMemory); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			h.sendDecodeError(w, r, decodeError(err))
+			return
+		}
+		h.sendValidationError(w, r, &services.ValidationError{Code: "invalid_value", Message: "invalid multipart body: " + err.Error()})
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "file", Code: "required", Message: "the bank file is required in the file part"})
+		return
+	}
+	defer file.Close()
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(header.Filename), ".")
+	}
+	if format == "" {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "format", Code: "required", Message: "format is required when the file name has no extension"})
+		return
+	}
+
+	report, err := h.ledger(r).ImportBankFile(userId, file, format)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+	h.requestLogger(r).InfoContext(r.Context(), "bank file imported", "format", report.Format,
+		"imported", len(report.Imported), "skipped", len(report.Skipped), "failed", len(report.Failed))
+	sendJSONResponse(w, r, http.StatusOK, report)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+const importQIF = "!Type:Bank\nD01/03/2025\nT100.00\nPSALARY\n^\nD01/04/2025\nT-30.00\nPGROCERIES\n^\nD01/05/2025\nT-500.00\nPRENT\n^\n"
+
+// uploadFile POSTs a multipart body with the file part and the given fields
+func uploadFile(router *mux.Router, path, filename, content string, fields map[string]string) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	if filename != "" {
+		part, _ := form.CreateFormFile("file", filename)
+		part.Write([]byte(content))
+	}
+	form.Close()
+
+	req := httptest.NewRequest("POST", path, &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleImport(t *testing.T) {
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger).RegisterRoutes(router, APIPrefix)
+	path := APIPrefix + "/users/alice/imports"
+
+	// the format comes from the extension
+	rr := uploadFile(router, path, "january.QIF", importQIF, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var report services.ImportReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("could not parse the body: %v", err)
+	}
+	if report.Format != "qif" || len(report.Imported) != 2 || len(report.Failed) != 1 || report.Failed[0].Description != "RENT" {
+		t.Errorf("expected 2 imported and the rent failed, got %+v", report)
+	}
+
+	rr = uploadFile(router, path, "export", importQIF, map[string]string{"format": "qif"})
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil || rr.Code != http.StatusOK || len(report.Skipped) != 2 {
+		t.Errorf("expected the 2 entries skipped on the second upload, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for _, tc := range []struct {
+		name, filename, content string
+		fields                  map[string]string
+		status                  int
+		field                   string
+	}{
+		{"no file", "", "", map[string]string{"format": "qif"}, http.StatusBadRequest, "file"},
+		{"no format", "export", importQIF, nil, http.StatusBadRequest, "format"},
+		{"unknown format", "export.csv", "date,amount\n", nil, http.StatusBadRequest, "format"},
+		{"not of the format", "export.ofx", importQIF, nil, http.StatusBadRequest, "file"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := uploadFile(router, path, tc.filename, tc.content, tc.fields)
+			var body ErrorResponse
+			json.Unmarshal(rr.Body.Bytes(), &body)
+			if rr.Code != tc.status || body.Field != tc.field {
+				t.Errorf("expected %d on %s, got %d: %s", tc.status, tc.field, rr.Code, rr.Body.String())
+			}
+		})
+	}
+
+	if rr := postJSON(router, path, map[string]string{"format": "qif"}); rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for a JSON body, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,18 @@
+package handlers
+
+import "net/http"
+
+// handleIntegrity runs the consistency checks of the ledger, a failed check is reported by the service and answered
+// 200 with consistent false: the request went through, the ledger didn't
+func (h *LedgerHandler) handleIntegrity(w http.ResponseWriter, r *http.Request) {
+	report, err := h.ledger(r).CheckIntegrity()
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+	if !report.Consistent {
+		h.requestLogger(r).WarnContext(r.Context(), "integrity check failed",
+			"totals_consistent", report.TotalsConsistent, "unbalanced_journals", len(report.UnbalancedJournals))
+	}
+	sendJSONResponse(w, r, http.StatusOK, report)
+}
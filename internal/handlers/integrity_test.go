@@ -0,0 +1,50 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/apitest"
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/errreport/errreporttest"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+)
+
+func TestAdminIntegrity(t *testing.T) {
+	reporter := &errreporttest.Reporter{}
+	credentials := handlers.AdminCredentials{APIKey: "admin-key"}
+	s := apitest.NewTestServer(apitest.WithServiceOptions(services.WithErrorReporter(reporter)),
+		apitest.WithHandlerOptions(handlers.WithAdmin(credentials)))
+	s.Deposit(t, "alice", 100)
+
+	check := func() services.IntegrityReport {
+		t.Helper()
+		req := httptest.NewRequest("GET", s.Prefix+"/admin/integrity", nil)
+		req.Header.Set(handlers.AdminKeyHeader, credentials.APIKey)
+		var report services.IntegrityReport
+		s.Serve(t, req).Expect(t, http.StatusOK).Decode(t, &report)
+		return report
+	}
+
+	s.Do(t, "GET", "/admin/integrity", nil).Expect(t, http.StatusUnauthorized)
+	if report := check(); !report.Consistent {
+		t.Errorf("expected a consistent ledger, got %+v", report)
+	}
+
+	// the odd dollar is lost in the sum of the deposits but not in the sum of the balances
+	s.Store.AddTransactionWithTime("whale", models.TransactionRecord{ID: uuid.New(), Type: models.Deposit, Amount: 1e16})
+	s.Store.AddTransactionWithTime("whale", models.TransactionRecord{ID: uuid.New(), Type: models.Withdrawal, Amount: 1e16})
+	s.Store.AddTransactionWithTime("minnow", models.TransactionRecord{ID: uuid.New(), Type: models.Deposit, Amount: 1})
+	if report := check(); report.Consistent || report.TotalsConsistent {
+		t.Errorf("expected the totals to fail the check, got %+v", report)
+	}
+	reports := reporter.Reports()
+	if len(reports) != 1 || reports[0].Kind != errreport.KindIntegrity || reports[0].Tags["check"] != "totals" {
+		t.Errorf("expected the failed check reported, got %+v", reports)
+	}
+}
@@ -2,51 +2,343 @@ package handlers
 
 import (
 	"encoding/json"
-	"log"
+	"encoding/xml"
+	"errors"
+	"log/slog"
 	"net/http"
-	"strconv"
+	"sync"
 	"time"
+	"tiny-ledger/internal/auth"
 	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/ratelimit"
 	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/signing"
+	"tiny-ledger/internal/store"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	graphql "github.com/graph-gophers/graphql-go"
 )
 
 type LedgerHandler struct {
-	service services.LedgerService
+	service           services.LedgerService
+	logger            *slog.Logger
+	maxBodyBytes      int64
+	maxBatchBodyBytes int64
+	verifier          *auth.Verifier
+	signatures        *signing.Verifier // nil when requests aren't signed
+	limiter           *ratelimit.Limiter
+	admin             *AdminCredentials            // nil when the admin routes are disabled
+	reload            func() (ConfigReload, error) // of POST /admin/config/reload, nil when it is not mounted
+	outbox            Outbox                       // of the outbox admin routes, nil when they're not mounted
+	payments          *paymentInbox                // of the payments webhook, nil when it's not mounted
+	tenants           *services.TenantRegistry     // nil outside of multi-tenant mode
+	trustForwarded    bool
+	clampPageSize     bool
+	defaultPageSize   int
+	strictQuery       bool // unknown query parameters are rejected on the versioned mount
+	strictLegacyQuery bool // and on the legacy paths
+	requestTimeout    time.Duration
+	prefix            string // where RegisterRoutes mounted the API
+	legacyMounted     bool   // the unprefixed paths are registered too
+	now               func() time.Time
+
+	openAPIOnce sync.Once
+	openAPI     []byte
+
+	graphQLOnce   sync.Once
+	graphQLSchema *graphql.Schema
+
+	wsMu       sync.Mutex
+	wsSessions map[*wsSession]struct{} // the open sockets, for CloseWebSockets
+}
+
+type HandlerOption func(*LedgerHandler)
+
+// NewLedgerHandler uses slog.Default() when logger is nil
+func NewLedgerHandler(s services.LedgerService, logger *slog.Logger, opts ...HandlerOption) *LedgerHandler {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	h := &LedgerHandler{
+		service:           s,
+		logger:            logger,
+		maxBodyBytes:      DefaultMaxBodyBytes,
+		maxBatchBodyBytes: DefaultMaxBatchBodyBytes,
+		defaultPageSize:   DefaultPageSize,
+		now:               time.Now,
+		requestTimeout:    DefaultRequestTimeout,
+		strictQuery:       true,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// RegisterRoutes adds the ledger API to r under prefix (APIPrefix, or "" for the root), its middleware only wraps
+// the ledger routes so the health and metrics endpoints registered on the same router stay unauthenticated
+func (h *LedgerHandler) RegisterRoutes(r *mux.Router, prefix string) {
+	h.RegisterAPIRoutes(r, prefix)
+	h.RegisterAdminRoutes(r, prefix)
 }
 
-func NewLedgerHandler(s services.LedgerService) *LedgerHandler {
-	return &LedgerHandler{service: s}
+// RegisterAPIRoutes is RegisterRoutes without the admin routes, which RegisterAdminRoutes mounts on the router of
+// another listener
+func (h *LedgerHandler) RegisterAPIRoutes(r *mux.Router, prefix string) {
+	h.prefix = prefix
+	h.registerAPI(r, prefix, h.strictQuery)
+
+	r.HandleFunc("/openapi.json", h.handleOpenAPI).Methods("GET")
+	r.HandleFunc("/docs", handleDocs).Methods("GET")
+	if h.payments != nil {
+		// the provider authenticates with the signature, none of the middleware of the API applies but the timeout
+		r.Handle(PaymentsWebhookPath, h.limitTime(http.HandlerFunc(h.handlePaymentWebhook))).Methods("POST")
+	}
+	setErrorHandlers(r)
+}
+
+// RegisterAdminRoutes adds the admin routes to r under prefix, nothing when WithAdmin isn't set
+func (h *LedgerHandler) RegisterAdminRoutes(r *mux.Router, prefix string) {
+	if h.admin != nil {
+		h.registerAdmin(r, prefix)
+	}
+	setErrorHandlers(r)
 }
 
-func (h *LedgerHandler) RegisterRoutes(r *mux.Router) {
-	r.HandleFunc("/users/{userId}/transactions", h.handleTransaction).Methods("POST")
-	r.HandleFunc("/users/{userId}/balance", h.handleBalance).Methods("GET")
-	r.HandleFunc("/users/{userId}/transactions", h.handleTransactionsHistory).Methods("GET")
+// setErrorHandlers answers the unknown paths and methods of r with the error shape of the API
+func setErrorHandlers(r *mux.Router) {
+	r.NotFoundHandler = notFoundHandler()
+	r.MethodNotAllowedHandler = methodNotAllowedHandler(r)
+}
+
+// registerAPI mounts the ledger routes under prefix, the extra middleware runs first
+func (h *LedgerHandler) registerAPI(r *mux.Router, prefix string, strictQuery bool, extra ...mux.MiddlewareFunc) {
+	api := r.NewRoute().Subrouter()
+	if prefix != "" {
+		api = r.PathPrefix(prefix).Subrouter()
+	}
+
+	routes := &apiRoutes{}
+	api.Use(extra...)
+	api.Use(withAPIRoutes(routes), h.limitTime, requireJSON, h.limitBody)
+	if h.signatures != nil {
+		api.Use(h.verifySignature)
+	}
+	if h.verifier != nil {
+		api.Use(h.authenticate)
+	}
+	if h.tenants != nil {
+		api.Use(h.selectTenant)
+	}
+	if h.limiter != nil {
+		api.Use(h.rateLimit)
+	}
+	if strictQuery {
+		api.Use(h.rejectUnknownQuery(prefix))
+	}
+
+	api.HandleFunc("/users", h.handleCreateUser).Methods("POST")
+	api.HandleFunc("/users/{userId}/transactions", h.handleTransaction).Methods("POST")
+	api.HandleFunc("/users/{userId}/transactions/preview", h.handlePreviewTransaction).Methods("POST")
+	api.HandleFunc("/users/{userId}/transactions/batch", h.handleBatch).Methods("POST").Name(batchRouteName)
+	api.HandleFunc("/users/{userId}/balance", h.handleBalance).Methods("GET")
+	api.HandleFunc("/users/{userId}/summary", h.handleSummary).Methods("GET")
+	api.HandleFunc("/users/{userId}/transactions", h.handleTransactionsHistory).Methods("GET").Name(historyRouteName)
+	api.HandleFunc("/users/{userId}/transactions", h.handleHistoryHead).Methods("HEAD")
+	api.HandleFunc("/users/{userId}/transactions/count", h.handleCount).Methods("GET")
+	api.HandleFunc("/users/{userId}/transactions/export", h.handleExport).Methods("GET").Name(exportRouteName)
+	api.HandleFunc("/users/{userId}/statements/{year}/{month}", h.handleStatement).Methods("GET")
+	api.HandleFunc("/users/{userId}/totals", h.handleTotals).Methods("GET")
+	routes.transaction = api.HandleFunc("/users/{userId}/transactions/{txId}", h.handleGetTransaction).Methods("GET")
+	api.HandleFunc("/users/{userId}/transactions/{txId}/reversal", h.handleReverseTransaction).Methods("POST")
+	api.HandleFunc("/users/{userId}/transfers", h.handleTransfer).Methods("POST")
+	api.HandleFunc("/users/{userId}/imports", h.handleImport).Methods("POST").Name(importRouteName)
+	api.HandleFunc("/users/{userId}/ws", h.handleWebSocket).Methods("GET").Name(webSocketRouteName)
+	api.HandleFunc("/graphql", h.handleGraphQL).Methods("POST")
 }
 
 type transactionRequest struct {
 	Amount          float64 `json:"amount"`
 	TransactionType string  `json:"type"`
 	Description     string  `json:"description,omitempty"`
+	ReferenceID     string  `json:"referenceId,omitempty"` // external reference, a second transaction with it is a 409
+	AllowDuplicate  bool    `json:"allowDuplicate,omitempty"`
+}
+
+type transferRequest struct {
+	ToUserID    string  `json:"toUserId"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description,omitempty"`
+}
+
+// transactionResponse is a record as the API shows it, the same whether it was just created or read back
+type transactionResponse struct {
+	XMLName        xml.Name                 `json:"-" xml:"transaction"`
+	ID             uuid.UUID                `json:"id" xml:"id"`
+	Amount         float64                  `json:"amount" xml:"amount"`
+	Fee            float64                  `json:"fee,omitempty" xml:"fee,omitempty"`
+	Type           models.TransactionType   `json:"type" xml:"type"`
+	Timestamp      time.Time                `json:"timestamp" xml:"timestamp"`
+	Description    string                   `json:"description,omitempty" xml:"description,omitempty"`
+	ReferenceID    string                   `json:"referenceId,omitempty" xml:"referenceId,omitempty"`
+	JournalID      *uuid.UUID               `json:"journalId,omitempty" xml:"journalId,omitempty"`
+	ReversalOf     *uuid.UUID               `json:"reversalOf,omitempty" xml:"reversalOf,omitempty"`
+	ReversedBy     *uuid.UUID               `json:"reversedBy,omitempty" xml:"reversedBy,omitempty"`
+	ReversalReason string                   `json:"reversalReason,omitempty" xml:"reversalReason,omitempty"`
+	Edits          []models.DescriptionEdit `json:"edits,omitempty" xml:"edit,omitempty"`
+	Voided         bool                     `json:"voided,omitempty" xml:"voided,omitempty"`
+	VoidedAt       *time.Time               `json:"voidedAt,omitempty" xml:"voidedAt,omitempty"`
+	VoidReason     string                   `json:"voidReason,omitempty" xml:"voidReason,omitempty"`
+	BalanceAfter   *float64                 `json:"balanceAfter,omitempty" xml:"balanceAfter,omitempty"` // only on the history with include=runningBalance
+}
+
+func newTransactionResponse(tx models.TransactionRecord) transactionResponse {
+	return transactionResponse{
+		ID:             tx.ID,
+		Amount:         tx.Amount,
+		Fee:            tx.Fee,
+		Type:           tx.Type,
+		Timestamp:      tx.Timestamp,
+		Description:    tx.Description,
+		ReferenceID:    tx.ReferenceID,
+		JournalID:      tx.JournalID,
+		ReversalOf:     tx.ReversalOf,
+		ReversedBy:     tx.ReversedBy,
+		ReversalReason: tx.ReversalReason,
+		Edits:          tx.Edits,
+		Voided:         tx.Voided,
+		VoidedAt:       tx.VoidedAt,
+		VoidReason:     tx.VoidReason,
+	}
+}
+
+func newTransactionResponses(txs []models.TransactionRecord) []transactionResponse {
+	responses := make([]transactionResponse, len(txs))
+	for i, tx := range txs {
+		responses[i] = newTransactionResponse(tx)
+	}
+	return responses
+}
+
+// historyTransactions are the records of a page of the history, with the balance after each of them when the
+// query includes runningBalance
+func (h *LedgerHandler) historyTransactions(r *http.Request, userId string, q historyQuery, txs []models.TransactionRecord) ([]transactionResponse, error) {
+	responses := newTransactionResponses(txs)
+	if !q.runningBalance || len(txs) == 0 {
+		return responses, nil
+	}
+
+	txIDs := make([]uuid.UUID, len(txs))
+	for i, tx := range txs {
+		txIDs[i] = tx.ID
+	}
+	balances, err := h.ledger(r).GetRunningBalances(userId, txIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range responses {
+		if balance, ok := balances[responses[i].ID]; ok {
+			responses[i].BalanceAfter = &balance
+		}
+	}
+	return responses, nil
+}
+
+type transferResponse struct {
+	TransferID uuid.UUID           `json:"transferId"`
+	Debit      transactionResponse `json:"debit"`
+	Credit     transactionResponse `json:"credit"`
+	Balance    float64             `json:"balance"` // the sender's balance right after the transfer
+}
+
+type reversalRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type createUserRequest struct {
+	UserID string `json:"userId"`
+}
+
+type createUserResponse struct {
+	UserID string `json:"userId"`
+}
+
+type balanceResponse struct {
+	XMLName          xml.Name  `json:"-" xml:"balance"`
+	Balance          float64   `json:"balance" xml:"balance"`
+	AvailableBalance float64   `json:"availableBalance" xml:"availableBalance"` // the balance minus the minimum balance, never negative
+	Currency         string    `json:"currency" xml:"currency"`
+	AsOf             time.Time `json:"asOf" xml:"asOf"` // server time of the read, or the requested at
+	PendingCount     int       `json:"pendingCount" xml:"pendingCount"`
+	Exists           bool      `json:"exists" xml:"exists"` // false for an unknown user of the permissive mode, whose balance reads 0
+}
+
+type historyResponse struct {
+	XMLName      xml.Name              `json:"-" xml:"history"`
+	Transactions []transactionResponse `json:"transactions" xml:"transactions>transaction"`
+	Pagination   pagePagination        `json:"pagination" xml:"pagination"`
+}
+
+// pagePagination describes a page of the history, the links keep the other query parameters
+type pagePagination struct {
+	Page       int    `json:"page" xml:"page"`
+	PageSize   int    `json:"pageSize" xml:"pageSize"`
+	TotalItems int    `json:"totalItems" xml:"totalItems"`
+	TotalPages int    `json:"totalPages" xml:"totalPages"`
+	First      string `json:"first" xml:"first"`
+	Prev       string `json:"prev,omitempty" xml:"prev,omitempty"`
+	Next       string `json:"next,omitempty" xml:"next,omitempty"`
+	Last       string `json:"last" xml:"last"`
+	// AccountExists is only set on the history, false for an unknown user of the permissive mode
+	AccountExists *bool `json:"accountExists,omitempty" xml:"accountExists,omitempty"`
+}
+
+type cursorHistoryResponse struct {
+	XMLName      xml.Name              `json:"-" xml:"history"`
+	Transactions []transactionResponse `json:"transactions" xml:"transactions>transaction"`
+	Pagination   cursorPagination      `json:"pagination" xml:"pagination"`
 }
 
-type ErrorResponse struct {
-	Error string `json:"error"`
+// cursorPagination describes a page of a cursor walk, NextCursor and Next are left out on the last page
+type cursorPagination struct {
+	Limit         int    `json:"limit" xml:"limit"`
+	NextCursor    string `json:"nextCursor,omitempty" xml:"nextCursor,omitempty"`
+	Next          string `json:"next,omitempty" xml:"next,omitempty"`
+	AccountExists bool   `json:"accountExists" xml:"accountExists"`
 }
 
-func sendJSONResponse(w http.ResponseWriter, status int, data interface{}) {
+func sendJSONResponse(w http.ResponseWriter, r *http.Request, status int, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(data); err != nil {
-		log.Printf("Error encoding response: %v", err)
+		if errors.Is(err, http.ErrHandlerTimeout) {
+			return // the client already got the timeout response
+		}
+		slog.ErrorContext(r.Context(), "encoding response", "request_id", RequestID(r.Context()), "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
 	}
 }
 
-func sendErrorResponse(w http.ResponseWriter, status int, message string) {
-	sendJSONResponse(w, status, ErrorResponse{Error: message})
+func (h *LedgerHandler) handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req createUserRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	if !authorizeUser(r, req.UserID) {
+		sendForbidden(w, r)
+		return
+	}
+
+	if err := h.ledger(r).CreateUser(req.UserID); err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, r, http.StatusCreated, createUserResponse{UserID: req.UserID})
 }
 
 func (h *LedgerHandler) handleTransaction(w http.ResponseWriter, r *http.Request) {
@@ -54,107 +346,313 @@ func (h *LedgerHandler) handleTransaction(w http.ResponseWriter, r *http.Request
 	userId := vars["userId"]
 
 	if userId == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "user ID is required")
+		sendErrorResponse(w, r, http.StatusBadRequest, "user ID is required")
 		return
 	}
 
 	var req transactionRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, "invalid request format: "+err.Error())
+	if err := decodeJSONBody(r, &req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	input := services.TransactionInput{
+		Type:           models.TransactionType(req.TransactionType),
+		Amount:         req.Amount,
+		Description:    req.Description,
+		ReferenceID:    req.ReferenceID,
+		AllowDuplicate: req.AllowDuplicate,
+	}
+
+	var tx models.TransactionRecord
+	var replayed bool
+	var err error
+	if key, ok := idempotencyKey(r); ok {
+		tx, replayed, err = h.ledger(r).RecordTransactionIdempotent(userId, key, input)
+	} else {
+		tx, err = h.ledger(r).RecordTransactionInput(userId, input)
+	}
+	if err != nil {
+		h.sendServiceError(w, r, err)
 		return
 	}
 
-	const maxTransactionAmount = 1000000.0 // this is just for limiting the amont of transactions
-	if req.Amount > maxTransactionAmount {
-		sendErrorResponse(w, http.StatusBadRequest, "transaction amount exceeds maximum allowed")
+	w.Header().Set("Location", transactionURL(r, userId, tx.ID))
+	markReplayed(w, replayed)
+	sendJSONResponse(w, r, http.StatusCreated, newTransactionResponse(tx))
+}
+
+func (h *LedgerHandler) handleTransfer(w http.ResponseWriter, r *http.Request) {
+	fromUserId := mux.Vars(r)["userId"]
+
+	var req transferRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		h.sendDecodeError(w, r, err)
 		return
 	}
 
-	tx, err := h.service.RecordTransaction(userId, models.TransactionType(req.TransactionType), req.Amount, req.Description)
+	var journal models.Journal
+	var replayed bool
+	var err error
+	if key, ok := idempotencyKey(r); ok {
+		journal, replayed, err = h.ledger(r).TransferIdempotent(fromUserId, key, req.ToUserID, req.Amount, req.Description)
+	} else {
+		journal, err = h.ledger(r).Transfer(fromUserId, req.ToUserID, req.Amount, req.Description)
+	}
 	if err != nil {
-		sendErrorResponse(w, http.StatusBadRequest, err.Error())
+		h.sendServiceError(w, r, err)
 		return
 	}
 
-	sendJSONResponse(w, http.StatusCreated, tx)
+	response := transferResponse{TransferID: journal.ID}
+	for _, entry := range journal.Entries {
+		if entry.UserID == fromUserId {
+			response.Debit = newTransactionResponse(entry.Transaction)
+			if entry.BalanceAfter != nil {
+				response.Balance = *entry.BalanceAfter
+			}
+		} else {
+			response.Credit = newTransactionResponse(entry.Transaction)
+		}
+	}
+
+	// the transfer has no resource of its own, the sender's leg is what the sender can read back
+	w.Header().Set("Location", transactionURL(r, fromUserId, response.Debit.ID))
+	markReplayed(w, replayed)
+	sendJSONResponse(w, r, http.StatusCreated, response)
+}
+
+func (h *LedgerHandler) handleReverseTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+
+	txID, err := uuid.Parse(vars["txId"])
+	if err != nil {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "txId", Code: "invalid_value", Message: "invalid transaction ID"})
+		return
+	}
+
+	// the body is optional
+	var req reversalRequest
+	if err := decodeJSONBody(r, &req); err != nil && err.Code != codeEmptyBody {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	version, conditional, verr := ifMatch(r)
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
+	var reversal models.TransactionRecord
+	if conditional {
+		reversal, err = h.ledger(r).ReverseTransactionIfVersion(userId, txID, req.Reason, version)
+	} else {
+		reversal, err = h.ledger(r).ReverseTransaction(userId, txID, req.Reason)
+	}
+	var mismatch *store.VersionMismatchError
+	if errors.As(err, &mismatch) {
+		w.Header().Set("ETag", etag(mismatch.Current))
+	}
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", transactionURL(r, userId, reversal.ID))
+	sendJSONResponse(w, r, http.StatusCreated, newTransactionResponse(reversal))
+}
+
+func (h *LedgerHandler) handleGetTransaction(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := negotiateResponse(w, r, readMediaTypes...)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+
+	txID, err := uuid.Parse(vars["txId"])
+	if err != nil {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "txId", Code: "invalid_value", Message: "invalid transaction ID"})
+		return
+	}
+	fields, verr := parseFields(r.URL.Query(), mediaType, transactionResponse{}, "id")
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
+	tx, err := h.ledger(r).GetTransaction(userId, txID)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	body, err := fields.project(newTransactionResponse(tx))
+	if err != nil {
+		h.sendInternalError(w, r, err)
+		return
+	}
+	sendNegotiatedResponse(w, r, mediaType, http.StatusOK, body)
+}
+
+func (h *LedgerHandler) handlePreviewTransaction(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["userId"]
+
+	var req transactionRequest
+	if err := decodeJSONBody(r, &req); err != nil {
+		h.sendDecodeError(w, r, err)
+		return
+	}
+
+	preview, err := h.ledger(r).PreviewTransaction(userId, services.TransactionInput{
+		Type:        models.TransactionType(req.TransactionType),
+		Amount:      req.Amount,
+		Description: req.Description,
+	})
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, r, http.StatusOK, preview)
 }
 
 func (h *LedgerHandler) handleBalance(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := negotiateResponse(w, r, readMediaTypes...)
+	if !ok {
+		return
+	}
+
 	userId := mux.Vars(r)["userId"]
 	if userId == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "user ID is required")
+		sendErrorResponse(w, r, http.StatusBadRequest, "user ID is required")
+		return
+	}
+
+	at, verr := timeParam(r.URL.Query(), "at")
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
 		return
 	}
 
-	balance, err := h.service.GetCurrentBalance(userId)
+	var details services.BalanceDetails
+	var err error
+	if at != nil {
+		details, err = h.ledger(r).GetBalanceAsOf(userId, *at)
+	} else {
+		h.setETag(w, r, userId)
+		details, err = h.ledger(r).GetBalanceDetails(userId)
+	}
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+		h.sendServiceError(w, r, err)
 		return
 	}
 
-	sendJSONResponse(w, http.StatusOK, map[string]float64{"balance": balance})
+	sendNegotiatedResponse(w, r, mediaType, http.StatusOK, newBalanceResponse(details))
 }
 
-func (h *LedgerHandler) handleTransactionsHistory(w http.ResponseWriter, r *http.Request) {
+// handleSummary is the account overview in one call, an unknown user is a 200 with exists false unless accounts are
+// strict
+func (h *LedgerHandler) handleSummary(w http.ResponseWriter, r *http.Request) {
+	fields, verr := parseFields(r.URL.Query(), jsonMediaType, services.AccountSummary{}, "userId")
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
 	userId := mux.Vars(r)["userId"]
-	if userId == "" {
-		sendErrorResponse(w, http.StatusBadRequest, "user ID is required")
+	h.setETag(w, r, userId)
+	summary, err := h.ledger(r).GetAccountSummary(userId)
+	if err != nil {
+		h.sendServiceError(w, r, err)
 		return
 	}
 
-	// Default values for page and pagesize
-	page := 1
-	pageSize := 10
+	body, err := fields.project(summary)
+	if err != nil {
+		h.sendInternalError(w, r, err)
+		return
+	}
+	sendJSONResponse(w, r, http.StatusOK, body)
+}
 
-	if pageStr := r.URL.Query().Get("page"); pageStr != "" {
-		if p, err := strconv.Atoi(pageStr); err == nil && p > 0 {
-			page = p
-		}
+func newBalanceResponse(details services.BalanceDetails) balanceResponse {
+	return balanceResponse{
+		Balance:          details.Balance,
+		AvailableBalance: details.AvailableBalance,
+		Currency:         details.Currency,
+		AsOf:             details.AsOf,
+		PendingCount:     details.PendingCount,
+		Exists:           details.Exists,
 	}
+}
 
-	if pageSizeStr := r.URL.Query().Get("pageSize"); pageSizeStr != "" {
-		if ps, err := strconv.Atoi(pageSizeStr); err == nil && ps > 0 && ps <= 100 {
-			pageSize = ps
-		}
+func (h *LedgerHandler) handleTransactionsHistory(w http.ResponseWriter, r *http.Request) {
+	mediaType, ok := negotiateResponse(w, r, historyMediaTypes...)
+	if !ok {
+		return
+	}
+
+	userId := mux.Vars(r)["userId"]
+	if userId == "" {
+		sendErrorResponse(w, r, http.StatusBadRequest, "user ID is required")
+		return
 	}
 
-	var startTime, endTime *time.Time
-	startStr := r.URL.Query().Get("start")
-	endStr := r.URL.Query().Get("end")
+	q, verr := h.parseHistoryQuery(r.URL.Query())
+	if verr == nil {
+		q.fields, verr = parseFields(r.URL.Query(), mediaType, transactionResponse{}, "id")
+	}
+	if verr == nil {
+		q.envelope, verr = parseEnvelope(r.URL.Query(), mediaType)
+	}
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
 
-	if startStr != "" {
-		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-			startTime = &t
-		} else {
-			sendErrorResponse(w, http.StatusBadRequest, "invalid start time format, use RFC3339")
-			return
-		}
+	if !h.cacheHistory(w, r, userId, q.filter) {
+		return
 	}
 
-	if endStr != "" {
-		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
-			endTime = &t
-		} else {
-			sendErrorResponse(w, http.StatusBadRequest, "invalid end time format, use RFC3339")
-			return
-		}
+	if mediaType == csvMediaType {
+		h.exportCSV(w, r, userId, q)
+		return
+	}
+
+	if q.byCursor {
+		h.handleHistoryByCursor(w, r, userId, q, mediaType)
+		return
 	}
 
-	result, err := h.service.GetPaginatedTransactionHistory(userId, startTime, endTime, page, pageSize)
+	result, err := h.ledger(r).GetTransactionHistory(userId, q.filter, q.page, q.pageSize)
 	if err != nil {
-		sendErrorResponse(w, http.StatusInternalServerError, err.Error())
+		h.sendServiceError(w, r, err)
 		return
 	}
 
-	response := map[string]interface{}{
-		"transactions": result.Transactions,
-		"pagination": map[string]interface{}{
-			"page":       result.Page,
-			"pageSize":   result.PageSize,
-			"totalItems": result.TotalCount,
-			"totalPages": result.TotalPages,
-		},
+	transactions, err := h.historyTransactions(r, userId, q, result.Transactions)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
 	}
 
-	sendJSONResponse(w, http.StatusOK, response)
+	pagination := h.paginate(w, r, result.Page, result.PageSize, result.TotalCount, result.TotalPages)
+	pagination.AccountExists = &result.AccountExists
+	body, err := q.fields.projectTransactions(historyResponse{
+		Transactions: transactions,
+		Pagination:   pagination,
+	})
+	if err == nil && !q.envelope {
+		setPageHeaders(w, pagination)
+		body, err = unwrapTransactions(body)
+	}
+	if err != nil {
+		h.sendInternalError(w, r, err)
+		return
+	}
+	sendNegotiatedResponse(w, r, mediaType, http.StatusOK, body)
 }
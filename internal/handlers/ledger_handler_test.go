@@ -1,36 +1,34 @@
-package handlers
+package handlers_test
 
 import (
-	"bytes"
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"tiny-ledger/internal/apitest"
+	"tiny-ledger/internal/clock/clocktest"
+	"tiny-ledger/internal/metrics"
+	"tiny-ledger/internal/models"
 	"tiny-ledger/internal/services"
-	"tiny-ledger/internal/store"
 
-	"github.com/gorilla/mux"
+	"github.com/google/uuid"
 )
 
-func setupTestHandler() *LedgerHandler {
-	ledgerStore := store.NewLedgerStore()
-	ledgerService := services.NewLedgerService(ledgerStore)
-	return NewLedgerHandler(ledgerService)
-}
-
 func TestHandleTransaction(t *testing.T) {
-	handler := setupTestHandler()
-	router := mux.NewRouter()
-	handler.RegisterRoutes(router)
+	s := apitest.NewTestServer()
 
 	tests := []struct {
 		name           string
 		userId         string
 		requestBody    map[string]interface{}
 		expectedStatus int
+		expectedCode   string
 	}{
 		{
 			name:   "Valid deposit",
@@ -51,6 +49,7 @@ func TestHandleTransaction(t *testing.T) {
 				"description": "Zero amount",
 			},
 			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "not_positive",
 		},
 		{
 			name:   "Negative amount",
@@ -61,6 +60,7 @@ func TestHandleTransaction(t *testing.T) {
 				"description": "Negative amount",
 			},
 			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "not_positive",
 		},
 		{
 			name:   "Excessive amount",
@@ -71,6 +71,7 @@ func TestHandleTransaction(t *testing.T) {
 				"description": "Too much money",
 			},
 			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "max_amount",
 		},
 		{
 			name:   "Invalid transaction type",
@@ -81,228 +82,610 @@ func TestHandleTransaction(t *testing.T) {
 				"description": "Invalid type",
 			},
 			expectedStatus: http.StatusBadRequest,
+			expectedCode:   "invalid_value",
 		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			jsonBody, _ := json.Marshal(test.requestBody)
-			req, _ := http.NewRequest("POST", "/users/"+test.userId+"/transactions", bytes.NewBuffer(jsonBody))
-			req.Header.Set("Content-Type", "application/json")
-
-			rr := httptest.NewRecorder()
-			router.ServeHTTP(rr, req)
-
-			if status := rr.Code; status != test.expectedStatus {
-				t.Errorf("handler returned wrong status code: got %v want %v, body: %s",
-					status, test.expectedStatus, rr.Body.String())
+			resp := s.PostTransaction(t, test.userId, test.requestBody).Expect(t, test.expectedStatus)
+			if test.expectedCode != "" {
+				if body := resp.Error(t, test.expectedStatus, "VALIDATION_FAILED"); body.Details.Fields[0].Code != test.expectedCode {
+					t.Errorf("unexpected error code: got %+v want %q", body.Details.Fields, test.expectedCode)
+				}
 			}
 		})
 	}
 }
 
 func TestHandleBalance(t *testing.T) {
-	handler := setupTestHandler()
-	router := mux.NewRouter()
-	handler.RegisterRoutes(router)
-
-	userId := "balance_test_user"
-	depositBody := map[string]interface{}{
-		"amount":      100.0,
-		"type":        "deposit",
-		"description": "Initial deposit",
-	}
-	jsonBody, _ := json.Marshal(depositBody)
-	req, _ := http.NewRequest("POST", "/users/"+userId+"/transactions", bytes.NewBuffer(jsonBody))
-	req.Header.Set("Content-Type", "application/json")
-	rr := httptest.NewRecorder()
-	router.ServeHTTP(rr, req)
+	s := apitest.NewTestServer()
+	s.PostTransaction(t, "balance_test_user", apitest.TransactionRequest{Type: "deposit", Amount: 100.0, Description: "Initial deposit"})
 
-	req, _ = http.NewRequest("GET", "/users/"+userId+"/balance", nil)
-	rr = httptest.NewRecorder()
-	router.ServeHTTP(rr, req)
-
-	if status := rr.Code; status != http.StatusOK {
-		t.Errorf("handler returned wrong status code: got %v want %v",
-			status, http.StatusOK)
-	}
-
-	var response map[string]float64
-	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-		t.Errorf("could not parse response: %v", err)
-	}
+	var response map[string]interface{}
+	s.Do(t, "GET", "/users/balance_test_user/balance", nil).Expect(t, http.StatusOK).Decode(t, &response)
 
+	// the legacy numeric key stays next to the richer fields
 	if balance, exists := response["balance"]; !exists || balance != 100.0 {
 		t.Errorf("unexpected balance: got %v want %v", balance, 100.0)
 	}
+	for _, key := range []string{"availableBalance", "currency", "asOf", "pendingCount"} {
+		if _, exists := response[key]; !exists {
+			t.Errorf("missing %s in %v", key, response)
+		}
+	}
 }
 
 func TestHandleTransactionHistory(t *testing.T) {
-	handler := setupTestHandler()
-	router := mux.NewRouter()
-	handler.RegisterRoutes(router)
-
+	clock := clocktest.NewFake(clocktest.Start)
+	s := apitest.NewTestServer(apitest.WithClock(clock))
 	userId := "history_test_user"
 
 	for i := 0; i < 15; i++ {
-		depositBody := map[string]interface{}{
-			"amount":      float64(i+1) * 10.0,
-			"type":        "deposit",
-			"description": "Deposit " + string(rune('A'+i)),
-		}
-		jsonBody, _ := json.Marshal(depositBody)
-		req, _ := http.NewRequest("POST", "/users/"+userId+"/transactions", bytes.NewBuffer(jsonBody))
-		req.Header.Set("Content-Type", "application/json")
-		rr := httptest.NewRecorder()
-		router.ServeHTTP(rr, req)
+		s.PostTransaction(t, userId, apitest.TransactionRequest{Type: "deposit", Amount: float64(i+1) * 10.0, Description: "Deposit " + string(rune('A'+i))})
 	}
 
 	testCases := []struct {
-		name           string
-		queryParams    string
-		expectedStatus int
-		expectedCount  int
+		name          string
+		query         string
+		expectedCount int
+		expectedPages int
 	}{
-		{
-			name:           "Default pagination (page 1, 10 items)",
-			queryParams:    "",
-			expectedStatus: http.StatusOK,
-			expectedCount:  10,
-		},
-		{
-			name:           "Page 2 (5 items)",
-			queryParams:    "?page=2",
-			expectedStatus: http.StatusOK,
-			expectedCount:  5,
-		},
-		{
-			name:           "Custom page size",
-			queryParams:    "?pageSize=5",
-			expectedStatus: http.StatusOK,
-			expectedCount:  5,
-		},
-		{
-			name:           "No results on page 3",
-			queryParams:    "?page=3",
-			expectedStatus: http.StatusOK,
-			expectedCount:  0,
-		},
+		{"Default pagination (page 1, 10 items)", "", 10, 2},
+		{"Page 2 (5 items)", "page=2", 5, 2},
+		{"Custom page size", "pageSize=5", 5, 3},
+		{"No results on page 3", "page=3", 0, 2},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			req, _ := http.NewRequest("GET", "/users/"+userId+"/transactions"+tc.queryParams, nil)
-			rr := httptest.NewRecorder()
-			router.ServeHTTP(rr, req)
+			history := s.GetHistory(t, userId, tc.query)
+			if len(history.Transactions) != tc.expectedCount {
+				t.Errorf("unexpected transaction count: got %v want %v", len(history.Transactions), tc.expectedCount)
+			}
+			if history.Pagination.Page == 0 {
+				t.Errorf("page number not found in pagination data")
+			}
+			if history.Pagination.TotalItems != 15 {
+				t.Errorf("unexpected totalItems: got %v want %v", history.Pagination.TotalItems, 15)
+			}
+			if history.Pagination.TotalPages != tc.expectedPages {
+				t.Errorf("unexpected totalPages: got %v want %v", history.Pagination.TotalPages, tc.expectedPages)
+			}
+		})
+	}
+
+	// the records are all at the time of the fake clock, a day either side of it takes them all
+	yesterday := url.QueryEscape(clock.Now().Add(-24 * time.Hour).Format(time.RFC3339))
+	tomorrow := url.QueryEscape(clock.Now().Add(24 * time.Hour).Format(time.RFC3339))
+	clock.Advance(time.Hour)
+	s.PostTransaction(t, userId, apitest.TransactionRequest{Type: "deposit", Amount: 150.0, Description: "Past transaction"})
 
-			if status := rr.Code; status != tc.expectedStatus {
-				t.Errorf("handler returned wrong status code: got %v want %v",
-					status, tc.expectedStatus)
+	timeRangeTests := []struct {
+		name  string
+		query string
+		total int
+	}{
+		{"Filter by start time only", "start=" + yesterday, 16},
+		{"Filter by end time only", "end=" + tomorrow, 16},
+		{"Filter by time range", "start=" + yesterday + "&end=" + tomorrow, 16},
+		{"Before the last one", "end=" + url.QueryEscape(clocktest.Start.Format(time.RFC3339)), 15},
+	}
+
+	for _, tc := range timeRangeTests {
+		t.Run(tc.name, func(t *testing.T) {
+			if history := s.GetHistory(t, userId, tc.query); history.Pagination.TotalItems != tc.total {
+				t.Errorf("unexpected totalItems: got %v want %v", history.Pagination.TotalItems, tc.total)
 			}
+		})
+	}
+	s.Do(t, "GET", "/users/"+userId+"/transactions?start=invalid-time", nil).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+}
 
-			var response map[string]interface{}
-			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
-				t.Errorf("could not parse response: %v", err)
+func TestHandleTransactionHistory_IncludeVoided(t *testing.T) {
+	s := apitest.NewTestServer()
+
+	userId := "void_history_user"
+	kept, _ := s.Service.RecordTransaction(userId, models.Deposit, 100.0, "kept")
+	voided, _ := s.Service.RecordTransaction(userId, models.Deposit, 20.0, "typo")
+	if _, err := s.Service.VoidTransaction(userId, voided.ID, "entered twice"); err != nil {
+		t.Fatalf("failed to void transaction: %v", err)
+	}
+
+	testCases := []struct {
+		name        string
+		query       string
+		expectedIDs []uuid.UUID
+	}{
+		{"Voided included by default", "", []uuid.UUID{kept.ID, voided.ID}},
+		{"Voided explicitly included", "includeVoided=true", []uuid.UUID{kept.ID, voided.ID}},
+		{"Voided excluded", "includeVoided=false", []uuid.UUID{kept.ID}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			history := s.GetHistory(t, userId, tc.query)
+			if len(history.Transactions) != len(tc.expectedIDs) {
+				t.Fatalf("unexpected transaction count: got %v want %v", len(history.Transactions), len(tc.expectedIDs))
+			}
+			for i, tx := range history.Transactions {
+				if tx.ID != tc.expectedIDs[i] {
+					t.Errorf("unexpected transaction at %d: got %v want %v", i, tx.ID, tc.expectedIDs[i])
+				}
 			}
+		})
+	}
+	s.Do(t, "GET", "/users/"+userId+"/transactions?includeVoided=maybe", nil).Expect(t, http.StatusBadRequest)
+}
 
-			transactions, ok := response["transactions"].([]interface{})
-			if !ok {
-				t.Errorf("unexpected response format, transactions not found or not array")
-				return
+func TestHandleCreateUser_StrictAccounts(t *testing.T) {
+	s := apitest.NewTestServer(apitest.WithStrictAccounts())
+	deposit := apitest.TransactionRequest{Type: "deposit", Amount: 10.0}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           interface{}
+		expectedStatus int
+	}{
+		{"Balance of unknown user", "GET", "/users/strict_user/balance", nil, http.StatusNotFound},
+		{"History of unknown user", "GET", "/users/strict_user/transactions", nil, http.StatusNotFound},
+		{"Deposit for unknown user", "POST", "/users/strict_user/transactions", deposit, http.StatusNotFound},
+		{"Register user", "POST", "/users", map[string]string{"userId": "strict_user"}, http.StatusCreated},
+		{"Register user twice", "POST", "/users", map[string]string{"userId": "strict_user"}, http.StatusConflict},
+		{"Register invalid user", "POST", "/users", map[string]string{"userId": "x"}, http.StatusBadRequest},
+		{"Deposit for registered user", "POST", "/users/strict_user/transactions", deposit, http.StatusCreated},
+		{"Balance of registered user", "GET", "/users/strict_user/balance", nil, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if resp := s.Do(t, test.method, test.path, test.body); resp.Status != test.expectedStatus {
+				t.Errorf("handler returned wrong status code: got %v want %v", resp.Status, test.expectedStatus)
 			}
+		})
+	}
+}
+
+func TestHandleTransaction_ValidatorCode(t *testing.T) {
+	s := apitest.NewTestServer(apitest.WithServiceOptions(services.WithValidators(services.NewBlockedWordsValidator("casino"))))
+
+	resp := s.PostTransaction(t, "test_user", apitest.TransactionRequest{Type: "deposit", Amount: 10.0, Description: "casino night"})
+	if response := resp.Error(t, http.StatusBadRequest, "VALIDATION_FAILED"); response.Code != "blocked_description" {
+		t.Errorf("unexpected error code: got %q want %q", response.Code, "blocked_description")
+	}
+}
+
+func TestHandleTransaction_PossibleDuplicate(t *testing.T) {
+	config := services.DefaultConfig()
+	config.DuplicateWindow = time.Minute
+	s := apitest.NewTestServer(apitest.WithConfig(config))
+
+	body := apitest.TransactionRequest{Type: "deposit", Amount: 10.0, Description: "gift"}
+	original := s.PostTransaction(t, "test_user", body).Expect(t, http.StatusCreated).Transaction(t)
+
+	response := s.PostTransaction(t, "test_user", body).Error(t, http.StatusConflict, "DUPLICATE")
+	if response.OriginalID != original.ID.String() {
+		t.Errorf("unexpected originalId: got %q want %q", response.OriginalID, original.ID)
+	}
+
+	body.AllowDuplicate = true
+	s.PostTransaction(t, "test_user", body).Expect(t, http.StatusCreated)
+}
 
-			if len(transactions) != tc.expectedCount {
-				t.Errorf("unexpected transaction count: got %v want %v", len(transactions), tc.expectedCount)
+func TestHandleBalance_AvailableBalance(t *testing.T) {
+	s := apitest.NewTestServer(apitest.WithClock(clocktest.NewFake(clocktest.Start)))
+	s.Service.RecordTransaction("floor_user", models.Deposit, 100.0, "funding")
+	s.Service.SetMinimumBalance("floor_user", 30.0)
+
+	response := s.GetBalance(t, "floor_user", "")
+	if response.Balance != 100.0 || response.AvailableBalance != 70.0 {
+		t.Errorf("unexpected balance response: %+v", response)
+	}
+	if response.Currency != "USD" || response.PendingCount != 0 {
+		t.Errorf("unexpected currency or pending count: %+v", response)
+	}
+	if !response.AsOf.Equal(clocktest.Start) {
+		t.Errorf("expected asOf to be the time of the read, got %v", response.AsOf)
+	}
+}
+
+func TestHandleBalance_At(t *testing.T) {
+	s := apitest.NewTestServer()
+
+	first := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	s.Store.AddTransactionWithTime("history_user", models.TransactionRecord{ID: uuid.New(), Amount: 80, Type: models.Deposit, Timestamp: first})
+	s.Store.AddTransactionWithTime("history_user", models.TransactionRecord{ID: uuid.New(), Amount: 30, Type: models.Withdrawal, Timestamp: first.Add(48 * time.Hour)})
+
+	tests := []struct {
+		name    string
+		at      string
+		balance float64
+	}{
+		{"Before the first transaction", "2025-02-28T00:00:00Z", 0},
+		{"At the first transaction", "2025-03-01T12:00:00Z", 80},
+		{"Between transactions", "2025-03-02T00:00:00+02:00", 80},
+		{"After both", "2025-04-01T00:00:00Z", 50},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := s.GetBalance(t, "history_user", "at="+url.QueryEscape(tt.at))
+			if response.Balance != tt.balance || response.AvailableBalance != tt.balance {
+				t.Errorf("expected balance %v, got %+v", tt.balance, response)
+			}
+			at, _ := time.Parse(time.RFC3339, tt.at)
+			if !response.AsOf.Equal(at) {
+				t.Errorf("expected asOf to echo %v, got %v", at, response.AsOf)
 			}
+		})
+	}
+	s.Do(t, "GET", "/users/history_user/balance?at=yesterday", nil).Expect(t, http.StatusBadRequest)
+}
+
+func TestHandlePreviewTransaction(t *testing.T) {
+	s := apitest.NewTestServer(apitest.WithServiceOptions(services.WithFeeSchedule(services.StandardFeeSchedule())))
+	s.Deposit(t, "fee_user", 100.0)
+
+	var preview services.TransactionPreview
+	s.Do(t, "POST", "/users/fee_user/transactions/preview", apitest.TransactionRequest{Type: "withdrawal", Amount: 10.0}).
+		Expect(t, http.StatusOK).Decode(t, &preview)
+	if preview.Fee != 0.60 || preview.Total != 10.60 || !preview.Allowed {
+		t.Errorf("unexpected preview: %+v", preview)
+	}
+
+	if balance := s.GetBalance(t, "fee_user", ""); balance.Balance != 100.0 {
+		t.Errorf("preview must not record anything, balance %.2f", balance.Balance)
+	}
+}
+
+func TestHandleGetTransaction(t *testing.T) {
+	s := apitest.NewTestServer()
+
+	body := apitest.TransactionRequest{Type: "deposit", Amount: 42.0, Description: "receipt"}
+	resp := s.PostTransaction(t, "owner_user", body)
+	created := resp.Transaction(t)
+
+	location := resp.Header.Get("Location")
+	if location != s.Prefix+"/users/owner_user/transactions/"+created.ID.String() {
+		t.Errorf("unexpected Location header: %q", location)
+	}
 
-			pagination, ok := response["pagination"].(map[string]interface{})
-			if !ok {
-				t.Errorf("pagination information not found in response")
+	// another user exists too, probing with their user ID must not leak the record
+	s.PostTransaction(t, "other_user", body)
+
+	tests := []struct {
+		name           string
+		path           string
+		expectedStatus int
+		expectedKind   string
+	}{
+		{"Happy path via Location", strings.TrimPrefix(location, s.Prefix), http.StatusOK, ""},
+		{"Malformed UUID", "/users/owner_user/transactions/not-a-uuid", http.StatusBadRequest, "VALIDATION_FAILED"},
+		{"Unknown transaction", "/users/owner_user/transactions/" + uuid.New().String(), http.StatusNotFound, "NOT_FOUND"},
+		{"Other user's ID", "/users/other_user/transactions/" + created.ID.String(), http.StatusNotFound, "NOT_FOUND"},
+		{"Unknown user", "/users/nobody_here/transactions/" + created.ID.String(), http.StatusNotFound, "NOT_FOUND"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := s.Do(t, "GET", test.path, nil)
+			if test.expectedKind != "" {
+				resp.Error(t, test.expectedStatus, test.expectedKind)
 				return
 			}
+			if tx := resp.Expect(t, test.expectedStatus).Transaction(t); tx.ID != created.ID || tx.Amount != 42.0 {
+				t.Errorf("unexpected transaction: %+v", tx)
+			}
+		})
+	}
+}
 
-			if _, exists := pagination["page"]; !exists {
-				t.Errorf("page number not found in pagination data")
+// TestCreatedLocationRoundTrip follows the Location of every 201 and expects the same representation back
+func TestCreatedLocationRoundTrip(t *testing.T) {
+	s := apitest.NewTestServer()
+
+	s.Deposit(t, "round_trip", 100.0)
+	withdrawn := s.PostTransaction(t, "round_trip", apitest.TransactionRequest{Type: "withdrawal", Amount: 30.0}).Transaction(t)
+
+	tests := []struct {
+		name string
+		path string
+		body interface{}
+		pick func(created map[string]interface{}) interface{} // the part of the 201 body the Location points at
+	}{
+		{"Transaction", "/users/round_trip/transactions", map[string]interface{}{"amount": 12.5, "type": "deposit", "description": "refund"}, nil},
+		{"Reversal", "/users/round_trip/transactions/" + withdrawn.ID.String() + "/reversal", map[string]string{"reason": "mistake"}, nil},
+		{"Transfer", "/users/round_trip/transfers", map[string]interface{}{"toUserId": "payee", "amount": 5.0}, func(created map[string]interface{}) interface{} {
+			return created["debit"]
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := s.Do(t, "POST", tt.path, tt.body).Expect(t, http.StatusCreated)
+			location := resp.Header.Get("Location")
+			if !strings.HasPrefix(location, s.Prefix+"/users/round_trip/transactions/") {
+				t.Fatalf("unexpected Location header: %q", location)
 			}
 
-			if _, exists := pagination["totalItems"]; !exists {
-				t.Errorf("totalItems not found in pagination data")
+			var created map[string]interface{}
+			resp.Decode(t, &created)
+			var want interface{} = created
+			if tt.pick != nil {
+				want = tt.pick(created)
 			}
 
-			if totalItems, ok := pagination["totalItems"].(float64); !ok || int(totalItems) != 15 {
-				t.Errorf("unexpected totalItems: got %v want %v", totalItems, 15)
+			var got interface{}
+			s.Serve(t, httptest.NewRequest("GET", location, nil)).Expect(t, http.StatusOK).Decode(t, &got)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("the Location returned a different representation:\ncreated %v\ngot     %v", want, got)
 			}
+		})
+	}
+}
 
-			if totalPages, ok := pagination["totalPages"].(float64); !ok {
-				t.Errorf("totalPages not found or not a number")
-			} else {
-				pageSize := 10
-				if tc.queryParams == "?pageSize=5" {
-					pageSize = 5
-				}
-				expectedPages := (15 + pageSize - 1) / pageSize
-				if int(totalPages) != expectedPages {
-					t.Errorf("unexpected totalPages: got %v want %v", totalPages, expectedPages)
+func TestHandleTransfer(t *testing.T) {
+	s := apitest.NewTestServer()
+	s.Deposit(t, "sender_user", 100.0)
+
+	tests := []struct {
+		name           string
+		body           map[string]interface{}
+		expectedStatus int
+		expectedKind   string
+		expectedField  string
+	}{
+		{"Self transfer", map[string]interface{}{"toUserId": "sender_user", "amount": 10.0}, http.StatusBadRequest, "VALIDATION_FAILED", "toUserId"},
+		{"Bad target ID", map[string]interface{}{"toUserId": "x", "amount": 10.0}, http.StatusBadRequest, "VALIDATION_FAILED", "toUserId"},
+		{"Zero amount", map[string]interface{}{"toUserId": "new_user", "amount": 0.0}, http.StatusBadRequest, "VALIDATION_FAILED", "amount"},
+		{"Negative amount", map[string]interface{}{"toUserId": "new_user", "amount": -5.0}, http.StatusBadRequest, "VALIDATION_FAILED", "amount"},
+		{"Insufficient funds", map[string]interface{}{"toUserId": "new_user", "amount": 500.0}, http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS", ""},
+		{"To a previously unseen user", map[string]interface{}{"toUserId": "new_user", "amount": 25.0, "description": "rent split"}, http.StatusCreated, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := s.Do(t, "POST", "/users/sender_user/transfers", test.body)
+			if test.expectedStatus != http.StatusCreated {
+				if response := resp.Error(t, test.expectedStatus, test.expectedKind); response.Field != test.expectedField {
+					t.Errorf("unexpected error field: got %q want %q", response.Field, test.expectedField)
 				}
+				return
+			}
+
+			var response apitest.Transfer
+			resp.Expect(t, http.StatusCreated).Decode(t, &response)
+			if response.Balance != 75.0 {
+				t.Errorf("unexpected sender balance: got %v want %v", response.Balance, 75.0)
+			}
+			if response.Debit.Type != models.Withdrawal || response.Credit.Type != models.Deposit || response.Credit.Amount != 25.0 {
+				t.Errorf("unexpected records: %+v", response)
+			}
+			if response.Debit.JournalID == nil || *response.Debit.JournalID != response.TransferID {
+				t.Errorf("expected the records to carry the transfer ID")
 			}
 		})
 	}
 
-	now := time.Now()
-	yesterday := now.Add(-24 * time.Hour)
-	tomorrow := now.Add(24 * time.Hour)
+	if balance := s.GetBalance(t, "new_user", ""); balance.Balance != 25.0 {
+		t.Errorf("unexpected recipient balance: got %v want %v", balance.Balance, 25.0)
+	}
+}
+
+func TestHandleTransfer_Concurrent(t *testing.T) {
+	s := apitest.NewTestServer()
+	s.Deposit(t, "sender_user", 100.0)
+
+	const attempts = 30
+	statuses := make(chan int, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			statuses <- s.Do(t, "POST", "/users/sender_user/transfers", map[string]interface{}{"toUserId": "receiver_user", "amount": 10.0}).Status
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	created, rejected := 0, 0
+	for status := range statuses {
+		switch status {
+		case http.StatusCreated:
+			created++
+		case http.StatusUnprocessableEntity:
+			rejected++
+		default:
+			t.Errorf("unexpected status code: %v", status)
+		}
+	}
+
+	if created != 10 || rejected != attempts-10 {
+		t.Errorf("expected 10 transfers and %d rejections, got %d and %d", attempts-10, created, rejected)
+	}
+}
 
-	yesterdayStr := yesterday.Format(time.RFC3339)
-	tomorrowStr := tomorrow.Format(time.RFC3339)
+func TestHandleReverseTransaction(t *testing.T) {
+	s := apitest.NewTestServer()
 
-	pastTx := map[string]interface{}{
-		"amount":      150.0,
-		"type":        "deposit",
-		"description": "Past transaction",
+	record := func(txType string, amount float64) apitest.Transaction {
+		return s.PostTransaction(t, "support_user", apitest.TransactionRequest{Type: txType, Amount: amount, Description: "original"}).Transaction(t)
 	}
-	pastTxBody, _ := json.Marshal(pastTx)
-	pastReq, _ := http.NewRequest("POST", "/users/"+userId+"/transactions", bytes.NewBuffer(pastTxBody))
-	pastReq.Header.Set("Content-Type", "application/json")
-	pastRr := httptest.NewRecorder()
-	router.ServeHTTP(pastRr, pastReq)
 
-	timeRangeTests := []struct {
+	record("deposit", 100.0)
+	spent := record("deposit", 50.0)
+	withdrawal := record("withdrawal", 120.0) // leaves 30, less than the 50.00 deposit
+
+	reversalPath := func(id uuid.UUID) string {
+		return "/users/support_user/transactions/" + id.String() + "/reversal"
+	}
+
+	tests := []struct {
 		name           string
-		queryParams    string
+		path           string
+		body           interface{}
 		expectedStatus int
+		expectedKind   string
 	}{
-		{
-			name:           "Filter by start time only",
-			queryParams:    "?start=" + url.QueryEscape(yesterdayStr),
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name:           "Filter by end time only",
-			queryParams:    "?end=" + url.QueryEscape(tomorrowStr),
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name:           "Filter by time range",
-			queryParams:    "?start=" + url.QueryEscape(yesterdayStr) + "&end=" + url.QueryEscape(tomorrowStr),
-			expectedStatus: http.StatusOK,
-		},
-		{
-			name:           "Invalid start time format",
-			queryParams:    "?start=invalid-time",
-			expectedStatus: http.StatusBadRequest,
-		},
+		{"Would overdraw", reversalPath(spent.ID), nil, http.StatusUnprocessableEntity, "INSUFFICIENT_FUNDS"},
+		{"Reversed", reversalPath(withdrawal.ID), map[string]string{"reason": "customer dispute"}, http.StatusCreated, ""},
+		{"Already reversed", reversalPath(withdrawal.ID), nil, http.StatusConflict, "CONFLICT"},
+		{"Not found", reversalPath(uuid.New()), nil, http.StatusNotFound, "NOT_FOUND"},
+		{"Malformed ID", "/users/support_user/transactions/nope/reversal", nil, http.StatusBadRequest, "VALIDATION_FAILED"},
 	}
 
-	for _, tc := range timeRangeTests {
-		t.Run(tc.name, func(t *testing.T) {
-			req, _ := http.NewRequest("GET", "/users/"+userId+"/transactions"+tc.queryParams, nil)
-			rr := httptest.NewRecorder()
-			router.ServeHTTP(rr, req)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := s.Do(t, "POST", test.path, test.body)
+			if test.expectedKind != "" {
+				resp.Error(t, test.expectedStatus, test.expectedKind)
+				return
+			}
+
+			reversal := resp.Expect(t, test.expectedStatus).Transaction(t)
+			if reversal.ReversalOf == nil || *reversal.ReversalOf != withdrawal.ID {
+				t.Errorf("expected the reversal to link back to the original: %+v", reversal)
+			}
+			if reversal.Type != models.Deposit || reversal.Amount != 120.0 || reversal.ReversalReason != "customer dispute" {
+				t.Errorf("unexpected reversal: %+v", reversal)
+			}
+		})
+	}
+
+	if original := s.Do(t, "GET", "/users/support_user/transactions/"+withdrawal.ID.String(), nil).Transaction(t); original.ReversedBy == nil {
+		t.Errorf("expected the original to show reversedBy: %+v", original)
+	}
+}
+
+func TestMetricsScrape(t *testing.T) {
+	var s *apitest.Server
+	ledgerMetrics := metrics.New(func() (int, float64) {
+		totals := s.Store.GetSystemTotals()
+		return totals.UserCount, totals.TotalBalance
+	})
+	s = apitest.NewTestServer(apitest.WithPrefix(""), apitest.WithMiddleware(ledgerMetrics.Middleware),
+		apitest.WithServiceOptions(services.WithMetrics(ledgerMetrics)))
+	s.Router.Handle("/metrics", ledgerMetrics.Handler()).Methods("GET")
+
+	s.PostTransaction(t, "user1", apitest.TransactionRequest{Type: "deposit", Amount: 100.0})
+	s.PostTransaction(t, "user1", apitest.TransactionRequest{Type: "withdrawal", Amount: 500.0})
+	s.PostTransaction(t, "user1", apitest.TransactionRequest{Type: "deposit", Amount: -1.0})
+
+	body := string(s.Do(t, "GET", "/metrics", nil).Expect(t, http.StatusOK).Body)
+	for _, want := range []string{
+		`ledger_transactions_total{outcome="created",type="deposit"} 1`,
+		`ledger_transactions_total{outcome="insufficient_funds",type="withdrawal"} 1`,
+		`ledger_transactions_total{outcome="invalid",type="deposit"} 1`,
+		`ledger_insufficient_funds_total 1`,
+		`ledger_validation_errors_total 1`,
+		`ledger_users 1`,
+		`ledger_total_balance 100`,
+		`ledger_http_request_duration_seconds_count{method="POST",route="/users/{userId}/transactions",status="201"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the scrape", want)
+		}
+	}
+}
 
-			if status := rr.Code; status != tc.expectedStatus {
-				t.Errorf("handler returned wrong status code: got %v want %v, response: %s",
-					status, tc.expectedStatus, rr.Body.String())
+func TestUnknownUserReads(t *testing.T) {
+	s := apitest.NewTestServer()
+	s.Deposit(t, "known", 10)
+
+	reads := []string{
+		"/users/%s/balance",
+		"/users/%s/balance?at=2024-01-01T00:00:00Z",
+		"/users/%s/transactions",
+		"/users/%s/transactions?limit=5",
+	}
+	for _, read := range reads {
+		for userId, expected := range map[string]bool{"known": true, "nobody": false} {
+			var body struct {
+				Exists     *bool `json:"exists"`
+				Pagination struct {
+					AccountExists *bool `json:"accountExists"`
+				} `json:"pagination"`
+			}
+			s.Do(t, "GET", fmt.Sprintf(read, userId), nil).Expect(t, http.StatusOK).Decode(t, &body)
+			exists := body.Exists
+			if exists == nil {
+				exists = body.Pagination.AccountExists
+			}
+			if exists == nil || *exists != expected {
+				t.Errorf("expected exists %v for %s of %s, got %+v", expected, read, userId, body)
+			}
+		}
+	}
+	if s.Store.UserExists("nobody") {
+		t.Error("expected the reads not to create the user")
+	}
+
+	strict := apitest.NewTestServer(apitest.WithStrictAccounts())
+	for _, read := range reads {
+		strict.Do(t, "GET", fmt.Sprintf(read, "nobody"), nil).Error(t, http.StatusNotFound, "NOT_FOUND")
+	}
+	if strict.Store.UserExists("nobody") {
+		t.Error("expected the strict reads not to create the user")
+	}
+}
+
+func TestHistoryRunningBalance(t *testing.T) {
+	s := apitest.NewTestServer()
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	expected := map[uuid.UUID]float64{}
+	balance := 0.0
+	for i := range 12 {
+		tx := models.TransactionRecord{ID: uuid.New(), Amount: float64(20 + i), Type: models.Deposit, Timestamp: base.Add(time.Duration(i) * time.Hour)}
+		if i%3 == 2 {
+			tx.Type, tx.Fee = models.Withdrawal, 0.5
+		}
+		tx.Voided = i == 7
+		s.Store.AddTransactionWithTime("alice", tx)
+
+		switch {
+		case tx.Voided:
+		case tx.Type == models.Withdrawal:
+			balance -= tx.Amount + tx.Fee
+		default:
+			balance += tx.Amount
+		}
+		expected[tx.ID] = balance
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		count int
+	}{
+		{"Oldest first", "include=runningBalance&page=2&pageSize=4", 4},
+		{"Newest first", "include=runningBalance&order=desc&pageSize=5", 5},
+		{"Filtered by type", "include=runningBalance&type=withdrawal", 4},
+		{"Filtered by time", "include=runningBalance&start=2025-01-01T05:00:00Z&order=desc", 7},
+		{"Cursor walk", "include=runningBalance&limit=3&order=desc", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history := s.GetHistory(t, "alice", tt.query)
+			if len(history.Transactions) != tt.count {
+				t.Fatalf("expected %d transactions, got %d", tt.count, len(history.Transactions))
+			}
+			for _, tx := range history.Transactions {
+				if tx.BalanceAfter == nil || *tx.BalanceAfter != expected[tx.ID] {
+					t.Errorf("expected the balance %v after %s, got %v", expected[tx.ID], tx.ID, tx.BalanceAfter)
+				}
 			}
 		})
 	}
+
+	if resp := s.Do(t, "GET", "/users/alice/transactions", nil); strings.Contains(string(resp.Body), "balanceAfter") {
+		t.Errorf("expected no running balance without include, got %s", resp.Body)
+	}
+	body := s.Do(t, "GET", "/users/alice/transactions?include=balance", nil).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+	if body.Field != "include" {
+		t.Errorf("expected an error on include, got %s", body.Field)
+	}
 }
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultSlowRequestThreshold is the duration above which LoggingMiddleware logs a request at Warn
+const DefaultSlowRequestThreshold = time.Second
+
+// LoggingMiddleware logs one line per request when it ends, at Info or at Warn when it took longer than
+// slowThreshold (zero never warns). the path is the route template so the lines of a route group together, only the
+// method, route, userId, status, size, duration and remote address are logged; request bodies carry amounts and
+// descriptions and never reach the logs at Info
+func LoggingMiddleware(logger *slog.Logger, slowThreshold time.Duration) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			duration := time.Since(start)
+
+			attrs := []any{
+				"request_id", RequestID(r.Context()),
+				"method", r.Method,
+				"path", routeTemplate(r),
+				"status", recorder.status,
+				"bytes", recorder.bytes,
+				"duration_ms", float64(duration.Microseconds()) / 1000,
+				"remote_addr", clientIP(r),
+			}
+			if userId := mux.Vars(r)["userId"]; userId != "" {
+				attrs = append(attrs, "userId", userId)
+			}
+			if clientCert := ClientCertificate(r.Context()); clientCert != "" {
+				attrs = append(attrs, "client_cert", clientCert)
+			}
+
+			level := slog.LevelInfo
+			if slowThreshold > 0 && duration > slowThreshold {
+				level = slog.LevelWarn
+			}
+			logger.Log(r.Context(), level, "request", attrs...)
+		})
+	}
+}
+
+// routeTemplate is the path template of the matched route, e.g. /api/v1/users/{userId}/transactions, so no user ID
+// or transaction ID ends up in the path attribute
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return "unmatched"
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Write counts the bytes of the body as they're sent, after compression when the compression middleware runs inside
+func (r *statusRecorder) Write(p []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(p)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Flush keeps streamed responses streaming through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// requestLogger tags the handler's log lines with the request they belong to
+func (h *LedgerHandler) requestLogger(r *http.Request) *slog.Logger {
+	return h.logger.With("request_id", RequestID(r.Context()), "method", r.Method, "path", r.URL.Path)
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+var discardLogger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+func setupLoggedRouter(level slog.Level) (*mux.Router, *bytes.Buffer) {
+	return setupSlowLoggedRouter(level, DefaultSlowRequestThreshold)
+}
+
+func setupSlowLoggedRouter(level slog.Level, slowThreshold time.Duration) (*mux.Router, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level}))
+
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware, LoggingMiddleware(logger, slowThreshold))
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), logger).RegisterRoutes(router, "")
+	return router, &buf
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var lines []map[string]interface{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("log line isn't JSON: %s", scanner.Text())
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	router, buf := setupLoggedRouter(slog.LevelInfo)
+
+	rr := postJSON(router, "/users/user1/transactions", map[string]interface{}{
+		"type":        "deposit",
+		"amount":      4321.5,
+		"description": "rent for flat 7B",
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", rr.Code)
+	}
+
+	raw := buf.String()
+	if strings.Contains(raw, "rent for flat") || strings.Contains(raw, "4321") {
+		t.Errorf("expected no description or amount in the Info logs, got %s", raw)
+	}
+
+	lines := logLines(t, buf)
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 log line, got %d", len(lines))
+	}
+
+	line := lines[0]
+	expected := map[string]interface{}{
+		"level":      "INFO",
+		"method":     "POST",
+		"path":       "/users/{userId}/transactions",
+		"userId":     "user1",
+		"status":     float64(http.StatusCreated),
+		"bytes":      float64(rr.Body.Len()),
+		"request_id": rr.Header().Get(RequestIDHeader),
+	}
+	for key, want := range expected {
+		if line[key] != want {
+			t.Errorf("expected %s=%v, got %v", key, want, line[key])
+		}
+	}
+	for _, key := range []string{"duration_ms", "remote_addr"} {
+		if _, ok := line[key]; !ok {
+			t.Errorf("expected %s in the log line", key)
+		}
+	}
+}
+
+func TestLoggingNotFound(t *testing.T) {
+	router, buf := setupLoggedRouter(slog.LevelInfo)
+
+	txID := uuid.NewString()
+	rr := serveRequest(router, "GET", "/users/user1/transactions/"+txID)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", rr.Code)
+	}
+
+	var line map[string]interface{}
+	for _, l := range logLines(t, buf) {
+		if l["msg"] == "request" {
+			line = l
+		}
+	}
+	if line == nil {
+		t.Fatalf("expected a request line")
+	}
+	if line["level"] != "INFO" || line["path"] != "/users/{userId}/transactions/{txId}" || line["status"] != float64(http.StatusNotFound) || line["bytes"] != float64(rr.Body.Len()) {
+		t.Errorf("unexpected request line: %v", line)
+	}
+	if strings.Contains(buf.String(), txID) {
+		t.Errorf("expected the transaction ID to stay out of the path, got %s", buf.String())
+	}
+}
+
+func TestLoggingSlowRequest(t *testing.T) {
+	router, buf := setupSlowLoggedRouter(slog.LevelInfo, time.Nanosecond)
+
+	postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 10.0})
+	lines := logLines(t, buf)
+	if len(lines) != 1 || lines[0]["level"] != "WARN" || lines[0]["msg"] != "request" {
+		t.Errorf("expected the request line at WARN, got %v", lines)
+	}
+}
+
+func TestLoggingValidationFailure(t *testing.T) {
+	router, buf := setupLoggedRouter(slog.LevelInfo)
+
+	rr := postJSON(router, "/users/user1/transfers", map[string]interface{}{
+		"toUserId":    "user1",
+		"amount":      12.34,
+		"description": "secret note",
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d", rr.Code)
+	}
+
+	if raw := buf.String(); strings.Contains(raw, "secret note") || strings.Contains(raw, "12.34") {
+		t.Errorf("expected no description or amount in the logs, got %s", raw)
+	}
+
+	var warn map[string]interface{}
+	for _, line := range logLines(t, buf) {
+		if line["level"] == "WARN" {
+			warn = line
+		}
+	}
+	if warn == nil {
+		t.Fatalf("expected a WARN line for the validation failure")
+	}
+	if warn["code"] != "self_transfer" || warn["field"] != "toUserId" {
+		t.Errorf("expected code self_transfer on toUserId, got %v on %v", warn["code"], warn["field"])
+	}
+}
+
+func TestLoggingLevel(t *testing.T) {
+	router, buf := setupLoggedRouter(slog.LevelWarn)
+
+	postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 10.0})
+	if buf.Len() != 0 {
+		t.Errorf("expected no Info lines at level WARN, got %s", buf.String())
+	}
+}
+
+func TestLoggingClientIP(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	trusted, _ := ParseTrustedProxies("10.0.0.0/8")
+
+	router := mux.NewRouter()
+	router.Use(ClientIPMiddleware(trusted), LoggingMiddleware(logger, 0))
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), logger).RegisterRoutes(router, "")
+
+	req, _ := http.NewRequest("GET", "/users/user1/balance", nil)
+	req.RemoteAddr = "10.0.0.5:443"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := logLines(t, &buf)
+	if len(lines) != 1 || lines[0]["remote_addr"] != "198.51.100.1" {
+		t.Errorf("expected the client behind the proxy in the access log, got %v", lines)
+	}
+}
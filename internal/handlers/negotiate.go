@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	jsonMediaType = "application/json"
+	xmlMediaType  = "application/xml"
+	csvMediaType  = "text/csv"
+)
+
+var (
+	// readMediaTypes are the representations of the read routes, the first one is the default
+	readMediaTypes = []string{jsonMediaType, xmlMediaType}
+	// historyMediaTypes adds the CSV export to them
+	historyMediaTypes = []string{jsonMediaType, xmlMediaType, csvMediaType}
+)
+
+// acceptedRange is a media range of the Accept header with its quality
+type acceptedRange struct {
+	mediaType string
+	q         float64
+}
+
+// negotiate picks the offer the Accept header prefers: the highest q first, the order of the header between equal
+// ones. a missing or unparsable header takes the first offer, ok is false when the header rules out every offer
+func negotiate(r *http.Request, offers ...string) (mediaType string, ok bool) {
+	var ranges []acceptedRange
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil || !strings.Contains(mediaType, "/") {
+			continue
+		}
+		q := 1.0
+		if value, found := params["q"]; found {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		ranges = append(ranges, acceptedRange{mediaType: mediaType, q: q})
+	}
+	if len(ranges) == 0 {
+		return offers[0], true
+	}
+
+	// an exact type with q=0 is refused even when a wildcard would take it
+	refused := func(offer string) bool {
+		return slices.ContainsFunc(ranges, func(ar acceptedRange) bool { return ar.q == 0 && ar.mediaType == offer })
+	}
+
+	slices.SortStableFunc(ranges, func(a, b acceptedRange) int {
+		switch {
+		case a.q > b.q:
+			return -1
+		case a.q < b.q:
+			return 1
+		}
+		return 0
+	})
+	for _, ar := range ranges {
+		if ar.q <= 0 {
+			break
+		}
+		for _, offer := range offers {
+			if matchesRange(ar.mediaType, offer) && !refused(offer) {
+				return offer, true
+			}
+		}
+	}
+	return "", false
+}
+
+// matchesRange tells whether offer falls in the media range, */* and text/* included
+func matchesRange(mediaRange, offer string) bool {
+	if mediaRange == "*/*" || mediaRange == offer {
+		return true
+	}
+	prefix, found := strings.CutSuffix(mediaRange, "/*")
+	return found && strings.HasPrefix(offer, prefix+"/")
+}
+
+// negotiateResponse is negotiate for a handler, it answers 406 listing the offers when the client accepts none
+func negotiateResponse(w http.ResponseWriter, r *http.Request, offers ...string) (string, bool) {
+	mediaType, ok := negotiate(r, offers...)
+	if !ok {
+		sendError(w, r, http.StatusNotAcceptable, ErrorResponse{
+			Error:   "none of the accepted media types is supported, use one of " + strings.Join(offers, ", "),
+			Details: ErrorDetails{Code: kindNotAcceptable, Supported: offers},
+		})
+	}
+	return mediaType, ok
+}
+
+// sendNegotiatedResponse sends the body in the media type negotiateResponse picked, JSON unless it's XML
+func sendNegotiatedResponse(w http.ResponseWriter, r *http.Request, mediaType string, status int, data any) {
+	w.Header().Add("Vary", "Accept")
+	if mediaType == xmlMediaType {
+		sendXMLResponse(w, r, status, data)
+		return
+	}
+	sendJSONResponse(w, r, status, data)
+}
+
+// sendXMLResponse renders the body before the status goes out, so a type XML can't encode is still a clean 500
+func sendXMLResponse(w http.ResponseWriter, r *http.Request, status int, data any) {
+	body, err := xml.Marshal(data)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "encoding response", "request_id", RequestID(r.Context()), "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", xmlMediaType+"; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(body)
+}
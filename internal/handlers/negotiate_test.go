@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// assertGoldenXML is assertGolden for an XML body, indented by re-encoding its tokens
+func assertGoldenXML(t *testing.T, name string, body []byte) {
+	t.Helper()
+
+	var indented bytes.Buffer
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	encoder := xml.NewEncoder(&indented)
+	encoder.Indent("", "  ")
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("the body isn't XML: %v", err)
+		}
+		if err := encoder.EncodeToken(token); err != nil {
+			t.Fatalf("could not indent the body: %v", err)
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		t.Fatalf("could not indent the body: %v", err)
+	}
+	indented.WriteString("\n")
+	compareGolden(t, name, indented.Bytes())
+}
+
+func getWithAccept(router *mux.Router, target, accept string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		expected string
+	}{
+		{"No header", "", jsonMediaType},
+		{"Any", "*/*", jsonMediaType},
+		{"JSON", "application/json", jsonMediaType},
+		{"XML", "application/xml", xmlMediaType},
+		{"XML with a charset", "application/xml; charset=utf-8", xmlMediaType},
+		{"Header order between equals", "application/xml, application/json", xmlMediaType},
+		{"Quality wins over order", "application/xml;q=0.5, application/json", jsonMediaType},
+		{"Subtype wildcard", "text/*", csvMediaType},
+		{"Wildcard after a refused type", "application/json;q=0, */*", xmlMediaType},
+		{"Browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", xmlMediaType},
+		{"Unparsable", "nonsense", jsonMediaType},
+		{"Nothing supported", "text/html", ""},
+		{"Everything refused", "*/*;q=0", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			mediaType, ok := negotiate(req, historyMediaTypes...)
+			if mediaType != tt.expected || ok != (tt.expected != "") {
+				t.Errorf("expected %q, got %q (ok %v)", tt.expected, mediaType, ok)
+			}
+		})
+	}
+}
+
+func TestReadRoutesXML(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, APIPrefix)
+
+	rr := postJSON(router, APIPrefix+"/users/alice/transactions", transactionRequest{TransactionType: "deposit", Amount: 42.5, Description: "salary"})
+	var created transactionResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &created)
+
+	rr = getWithAccept(router, APIPrefix+"/users/alice/balance", "application/xml")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/xml; charset=utf-8" || rr.Header().Get("Vary") != "Accept" {
+		t.Fatalf("expected an XML balance, got %d %v", rr.Code, rr.Header())
+	}
+	var balance balanceResponse
+	if err := xml.Unmarshal(rr.Body.Bytes(), &balance); err != nil || balance.Balance != 42.5 || balance.Currency == "" {
+		t.Errorf("unexpected balance %+v (%v): %s", balance, err, rr.Body.String())
+	}
+
+	rr = getWithAccept(router, APIPrefix+"/users/alice/transactions/"+created.ID.String(), "application/xml")
+	var tx transactionResponse
+	if err := xml.Unmarshal(rr.Body.Bytes(), &tx); err != nil || tx.ID != created.ID || tx.Amount != 42.5 || tx.Description != "salary" {
+		t.Errorf("unexpected transaction %+v (%v): %s", tx, err, rr.Body.String())
+	}
+
+	// JSON stays the default
+	rr = getWithAccept(router, APIPrefix+"/users/alice/balance", "")
+	if rr.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("expected JSON without an Accept header, got %s", rr.Header().Get("Content-Type"))
+	}
+
+	// errors are JSON whatever was asked for
+	decodeErrorBody(t, getWithAccept(router, APIPrefix+"/users/alice/transactions/nope", "application/xml"), http.StatusBadRequest, kindValidationFailed)
+}
+
+func TestNotAcceptable(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, APIPrefix)
+
+	tests := []struct {
+		path      string
+		supported []string
+	}{
+		{APIPrefix + "/users/alice/balance", readMediaTypes},
+		{APIPrefix + "/users/alice/transactions/" + uuid.NewString(), readMediaTypes},
+		{APIPrefix + "/users/alice/transactions", historyMediaTypes},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			body := decodeErrorBody(t, getWithAccept(router, tt.path, "text/html"), http.StatusNotAcceptable, kindNotAcceptable)
+			if !slices.Equal(body.Details.Supported, tt.supported) {
+				t.Errorf("expected the supported types %v, got %v", tt.supported, body.Details.Supported)
+			}
+		})
+	}
+}
+
+// TestHistoryXMLGolden pins the XML of a history page, a legacy consumer parses it
+func TestHistoryXMLGolden(t *testing.T) {
+	ledgerStore := store.NewLedgerStore()
+	start := time.Date(2024, time.May, 2, 8, 30, 0, 0, time.UTC)
+	ledgerStore.AddTransactionWithTime("alice", models.TransactionRecord{
+		ID: uuid.MustParse("6f1c2a52-3b7e-4a7e-9d2f-0c1e5b8a9d01"), Type: models.Deposit, Amount: 120.5, Description: "salary", Timestamp: start,
+	})
+	ledgerStore.AddTransactionWithTime("alice", models.TransactionRecord{
+		ID: uuid.MustParse("0b9e4d3c-8a21-4f6b-b5c7-2e3f4a5b6c02"), Type: models.Withdrawal, Amount: 20, Fee: 0.5, Description: "rent & bills", Timestamp: start.Add(time.Hour),
+	})
+
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(ledgerStore), discardLogger).RegisterRoutes(router, APIPrefix)
+
+	rr := getWithAccept(router, APIPrefix+"/users/alice/transactions?pageSize=10", "application/xml")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	assertGoldenXML(t, "history.golden.xml", rr.Body.Bytes())
+}
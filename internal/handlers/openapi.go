@@ -0,0 +1,793 @@
+package handlers
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/audit"
+	"tiny-ledger/internal/bankfile"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+const openAPIVersion = "3.0.3"
+
+// apiOperation documents one route, the OpenAPI document is generated from this table and from the request and
+// response types themselves, so a field added to a DTO shows up without touching the spec
+type apiOperation struct {
+	method      string
+	path        string
+	summary     string
+	userScoped  bool // behind authentication and rate limiting when they're enabled
+	admin       bool // behind the admin credentials, only mounted with WithAdmin
+	reload      bool // only mounted with WithConfigReload, not scoped to a tenant
+	outbox      bool // only mounted with WithOutbox
+	payments    bool // only mounted with WithPaymentsWebhook
+	params      []apiParam
+	request     any            // zero value of the JSON body, nil without a body
+	multipart   map[string]any // schema of a multipart/form-data body, instead of request
+	responses   map[int]apiResponse
+	description string
+	deprecated  bool
+}
+
+type apiParam struct {
+	name        string
+	in          string // path, query or header
+	description string
+	schema      map[string]any
+	required    bool
+}
+
+type apiResponse struct {
+	description string
+	body        any               // zero value of the JSON body, nil for an error or no body
+	oneOf       []any             // zero values of the alternative bodies, instead of body
+	contentType string            // application/json unless set
+	xml         bool              // the body is served as application/xml too
+	headers     []string          // integer headers of the response
+	textHeaders map[string]string // string headers of the response and their description
+	noContent   bool              // the response has no body, e.g. for HEAD
+}
+
+var (
+	stringSchema     = map[string]any{"type": "string"}
+	numberSchema     = map[string]any{"type": "number", "minimum": 0}
+	timeSchema       = map[string]any{"type": "string", "format": "date-time"}
+	dateOrTimeSchema = map[string]any{"oneOf": []any{timeSchema, map[string]any{"type": "string", "format": "date"}}}
+	uuidSchema       = map[string]any{"type": "string", "format": "uuid"}
+
+	userIdParam          = apiParam{name: "userId", in: "path", required: true, schema: stringSchema}
+	txIdParam            = apiParam{name: "txId", in: "path", required: true, schema: uuidSchema}
+	fieldsParam          = apiParam{name: "fields", in: "query", schema: stringSchema, description: "comma separated fields to return (of each record on the history), the identifier is always included"}
+	includeParam         = apiParam{name: "include", in: "query", schema: map[string]any{"type": "string", "enum": []string{"runningBalance"}}, description: "runningBalance adds the balanceAfter of each record, over the whole ledger even when the page is filtered"}
+	envelopeParam        = apiParam{name: "envelope", in: "query", schema: map[string]any{"type": "boolean", "default": true}, description: "false answers a bare JSON array, the page metadata goes to the X-Total-Count, X-Page, X-Total-Pages and Link headers"}
+	ifModifiedSinceParam = apiParam{name: "If-Modified-Since", in: "header", schema: stringSchema, description: "the Last-Modified of a cached copy, answered with 304 while the ledger didn't change"}
+	idempotencyKeyParam  = apiParam{name: IdempotencyKeyHeader, in: "header", schema: stringSchema, description: "makes a retry return the original response instead of recording twice"}
+
+	etagHeader     = map[string]string{"ETag": "the version of the user's ledger, for If-Match"}
+	historyCaching = map[string]string{
+		"Cache-Control": "private with a max-age when end is in the past, no-store otherwise",
+		"Last-Modified": "when the user's ledger last changed",
+	}
+
+	// periodParams are the bounds of a period, shared by the history filters and the totals
+	periodParams = []apiParam{
+		{name: "start", in: "query", schema: dateOrTimeSchema, description: "RFC3339 or YYYY-MM-DD for the start of that day in tz, inclusive"},
+		{name: "end", in: "query", schema: dateOrTimeSchema, description: "RFC3339 or YYYY-MM-DD for the end of that day in tz, inclusive"},
+		{name: "tz", in: "query", schema: map[string]any{"type": "string", "default": "UTC"}, description: "IANA time zone of the dates in start and end, e.g. Europe/Berlin"},
+		{name: "last", in: "query", schema: stringSchema, description: "rolling window up to now instead of start and end, e.g. 24h, 7d or 4w, at most 5 years"},
+	}
+
+	// historyFilterParams are the filters shared by the history and the export
+	historyFilterParams = append(append([]apiParam{}, periodParams...), []apiParam{
+		{name: "includeVoided", in: "query", schema: map[string]any{"type": "boolean", "default": true}},
+		{name: "order", in: "query", schema: map[string]any{"type": "string", "enum": []string{"asc", "desc"}, "default": "asc"}},
+		{name: "type", in: "query", schema: transactionTypeSchema()},
+		{name: "minAmount", in: "query", schema: numberSchema, description: "inclusive"},
+		{name: "maxAmount", in: "query", schema: numberSchema, description: "inclusive"},
+		{name: "q", in: "query", schema: map[string]any{"type": "string", "maxLength": 100}, description: "case-insensitive text searched in the description"},
+	}...)
+
+	historyPaginationParams = []apiParam{
+		{name: "page", in: "query", schema: map[string]any{"type": "integer", "minimum": 1, "default": 1}},
+		{name: "pageSize", in: "query", schema: map[string]any{"type": "integer", "minimum": 1, "maximum": MaxPageSize, "default": DefaultPageSize}},
+		{name: "cursor", in: "query", schema: stringSchema, description: "nextCursor of the previous page, excludes page and pageSize"},
+		{name: "limit", in: "query", schema: map[string]any{"type": "integer", "minimum": 1, "maximum": MaxPageSize, "default": 50}, description: "page size of a cursor walk, excludes page and pageSize"},
+	}
+)
+
+// apiOperations lists every route the ledger and health handlers register
+func apiOperations() []apiOperation {
+	validation := apiResponse{description: "validation failed, code and field name the problem"}
+	notFound := apiResponse{description: "unknown user or transaction"}
+	notAcceptable := apiResponse{description: "the Accept header allows none of the media types, details.supported lists them"}
+
+	return []apiOperation{
+		{
+			method: "GET", path: "/healthz", summary: "Liveness probe",
+			responses: map[int]apiResponse{http.StatusOK: {description: "serving", body: healthResponse{}}},
+		},
+		{
+			method: "GET", path: "/readyz", summary: "Readiness probe",
+			responses: map[int]apiResponse{
+				http.StatusOK:                 {description: "ready", body: healthResponse{}},
+				http.StatusServiceUnavailable: {description: "starting or draining", body: healthResponse{}},
+			},
+		},
+		{
+			method: "GET", path: "/version", summary: "Build and uptime of the running server",
+			responses: map[int]apiResponse{http.StatusOK: {description: "the build info", body: versionResponse{}}},
+		},
+		{
+			method: "GET", path: "/openapi.json", summary: "This document",
+			responses: map[int]apiResponse{http.StatusOK: {description: "the OpenAPI document", body: map[string]any{}}},
+		},
+		{
+			method: "GET", path: "/docs", summary: "Interactive documentation",
+			responses: map[int]apiResponse{http.StatusOK: {description: "Swagger UI", contentType: "text/html"}},
+		},
+		{
+			method: "GET", path: "/admin/users", summary: "Every user with its balance and activity", admin: true,
+			params: []apiParam{
+				{name: "page", in: "query", schema: map[string]any{"type": "integer", "minimum": 1, "default": 1}},
+				{name: "pageSize", in: "query", schema: map[string]any{"type": "integer", "minimum": 1, "maximum": MaxPageSize, "default": defaultAdminPageSize}},
+				{name: "sort", in: "query", schema: map[string]any{"type": "string", "enum": []string{"userId", "balance"}, "default": "userId"}, description: "balance lists the largest balances first"},
+				{name: "minBalance", in: "query", schema: numberSchema, description: "inclusive"},
+			},
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "a page of users, the Link header has the same links as the body", body: adminUsersResponse{}},
+				http.StatusBadRequest: validation,
+			},
+		},
+		{
+			method: "DELETE", path: "/admin/users/{userId}", summary: "Delete or anonymize a user", admin: true,
+			description: "anonymize keeps the transactions for accounting under a generated user ID, without their descriptions, references and reasons",
+			params: []apiParam{
+				userIdParam,
+				{name: "mode", in: "query", schema: map[string]any{"type": "string", "enum": []string{"delete", "anonymize"}, "default": "delete"}},
+				{name: "force", in: "query", schema: map[string]any{"type": "boolean", "default": false}, description: "removes a user whose balance is not zero"},
+			},
+			responses: map[int]apiResponse{
+				http.StatusNoContent:  {description: "the user is gone, its ID is free again", noContent: true},
+				http.StatusBadRequest: validation,
+				http.StatusNotFound:   {description: "unknown user"},
+				http.StatusConflict:   {description: "the balance is not zero, it's in balance, or the user has legs in journals and can only be anonymized"},
+			},
+		},
+		{
+			method: "GET", path: "/admin/audit", summary: "The audit trail of the operations", admin: true,
+			description: "Every operation on a user's ledger with who did it and whether it went through, oldest first. Accept: text/csv returns the page as a CSV attachment instead.",
+			params: []apiParam{
+				{name: "userId", in: "query", schema: stringSchema},
+				{name: "from", in: "query", schema: timeSchema, description: "inclusive"},
+				{name: "to", in: "query", schema: timeSchema, description: "inclusive"},
+				{name: "outcome", in: "query", schema: map[string]any{"type": "string", "enum": []string{audit.OutcomeSuccess, audit.OutcomeFailure}}},
+				{name: "page", in: "query", schema: map[string]any{"type": "integer", "minimum": 1, "default": 1}},
+				{name: "pageSize", in: "query", schema: map[string]any{"type": "integer", "minimum": 1, "maximum": MaxPageSize, "default": defaultAdminPageSize}},
+			},
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "a page of events, the Link header has the same links as the body", body: auditEventsResponse{}},
+				http.StatusBadRequest: validation,
+			},
+		},
+		{
+			method: "GET", path: "/admin/integrity", summary: "Check the consistency of the ledger", admin: true,
+			description: "Runs the trial balance of the system totals and the double-entry check of the journals. A failed check is reported to the error tracker and answered with consistent false.",
+			responses: map[int]apiResponse{
+				http.StatusOK: {description: "the outcome of both checks, the ids of the journals that don't balance", body: services.IntegrityReport{}},
+			},
+		},
+		{
+			method: "GET", path: "/admin/outbox", summary: "The depth of the outbox and its dead letters", admin: true, outbox: true,
+			description: "The entries waiting for their delivery to the webhooks and the event bus, and the ones that ran out of attempts.",
+			responses: map[int]apiResponse{
+				http.StatusOK: {description: "the depth and the dead-lettered entries, oldest first", body: outboxResponse{}},
+			},
+		},
+		{
+			method: "POST", path: "/admin/outbox/{id}/requeue", summary: "Deliver a dead-lettered entry again", admin: true, outbox: true,
+			params: []apiParam{{name: "id", in: "path", required: true, schema: map[string]any{"type": "integer", "minimum": 1}}},
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "the entry, due right away with a new set of attempts", body: store.OutboxEntry{}},
+				http.StatusBadRequest: validation,
+				http.StatusNotFound:   {description: "no dead-lettered entry with this id"},
+			},
+		},
+		{
+			method: "GET", path: "/admin/integrations/payments/dead-letters", summary: "The payment notifications the ledger couldn't record", admin: true, payments: true,
+			description: "Notifications of the payment provider that were answered 200 but not recorded, e.g. of a user the ledger doesn't know in strict mode. A payment notified again replaces its dead letter.",
+			responses: map[int]apiResponse{
+				http.StatusOK: {description: "the dead letters, oldest first", body: paymentDeadLettersResponse{}},
+			},
+		},
+		{
+			method: "POST", path: PaymentsWebhookPath, summary: "Notification of a payment of the payment provider", payments: true,
+			description: "Signed with the shared secret in " + PaymentSignatureHeader + ". A payment.succeeded is recorded as a deposit of the userReference " +
+				"with the payment id as its referenceId, so a notification sent again answers the same deposit. The other types are ignored. " +
+				"A notification the ledger refuses for the user, the currency or the amount is dead-lettered and answered 200 too.",
+			params:  []apiParam{{name: PaymentSignatureHeader, in: "header", required: true, schema: stringSchema, description: "sha256= and the hex HMAC-SHA256 of the body"}},
+			request: paymentNotification{},
+			responses: map[int]apiResponse{
+				http.StatusOK:           {description: "recorded, replayed, ignored or dead_lettered", body: paymentWebhookResponse{}},
+				http.StatusBadRequest:   validation,
+				http.StatusUnauthorized: {description: "the signature is missing or doesn't match the body"},
+			},
+		},
+		{
+			method: "POST", path: "/admin/config/reload", summary: "Reload the config of the server", admin: true, reload: true,
+			description: "Reads the environment and CONFIG_FILE again and applies the settings that can change while serving, the others are listed as requiring a restart. Nothing is applied when the new config is invalid.",
+			responses: map[int]apiResponse{
+				http.StatusOK:                  {description: "the changed settings", body: ConfigReload{}},
+				http.StatusUnprocessableEntity: {description: "the new config is invalid, the running one is kept"},
+			},
+		},
+		{
+			method: "POST", path: "/users", summary: "Register a user", userScoped: true,
+			request: createUserRequest{},
+			responses: map[int]apiResponse{
+				http.StatusCreated:    {description: "registered", body: createUserResponse{}},
+				http.StatusBadRequest: validation,
+				http.StatusConflict:   {description: "the user already exists"},
+			},
+		},
+		{
+			method: "POST", path: "/users/{userId}/transactions", summary: "Record a transaction", userScoped: true,
+			params:  []apiParam{userIdParam, idempotencyKeyParam},
+			request: transactionRequest{},
+			responses: map[int]apiResponse{
+				http.StatusCreated:             {description: "recorded, Location points at the record", body: transactionResponse{}},
+				http.StatusBadRequest:          validation,
+				http.StatusNotFound:            notFound,
+				http.StatusConflict:            {description: "possible duplicate, originalId is the suspected original"},
+				http.StatusUnprocessableEntity: {description: "insufficient funds or idempotency key reused with another body"},
+			},
+		},
+		{
+			method: "POST", path: "/users/{userId}/transactions/preview", summary: "Preview the fee and the resulting balance", userScoped: true,
+			params:  []apiParam{userIdParam},
+			request: transactionRequest{},
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "nothing was recorded", body: services.TransactionPreview{}},
+				http.StatusBadRequest: validation,
+				http.StatusNotFound:   notFound,
+			},
+		},
+		{
+			method: "POST", path: "/users/{userId}/transactions/batch", summary: "Record many transactions at once", userScoped: true,
+			description: "All or nothing, in order. details.items lists the rejected transactions by index.",
+			params:      []apiParam{userIdParam},
+			request:     batchRequest{},
+			responses: map[int]apiResponse{
+				http.StatusCreated:               {description: "every transaction was recorded", body: batchResponse{}},
+				http.StatusBadRequest:            {description: "invalid transactions or too many of them, nothing was recorded"},
+				http.StatusNotFound:              notFound,
+				http.StatusRequestEntityTooLarge: {description: "the body is over the batch limit"},
+				http.StatusUnprocessableEntity:   {description: "a withdrawal the balance can't cover, nothing was recorded"},
+			},
+		},
+		{
+			method: "GET", path: "/users/{userId}/balance", summary: "Current balance", userScoped: true,
+			params: []apiParam{userIdParam, {name: "at", in: "query", schema: timeSchema, description: "RFC3339, the balance at that time"}},
+			responses: map[int]apiResponse{
+				http.StatusOK:            {description: "the balance, the ETag is the ledger version unless at is set", body: balanceResponse{}, xml: true, textHeaders: etagHeader},
+				http.StatusBadRequest:    validation,
+				http.StatusNotFound:      notFound,
+				http.StatusNotAcceptable: notAcceptable,
+			},
+		},
+		{
+			method: "GET", path: "/users/{userId}/summary", summary: "Account overview", userScoped: true,
+			params: []apiParam{userIdParam, fieldsParam},
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "balance, totals, counts and activity, exists is false for an unknown user", body: services.AccountSummary{}, textHeaders: etagHeader},
+				http.StatusBadRequest: validation,
+				http.StatusNotFound:   {description: "unknown user with strict accounts"},
+			},
+		},
+		{
+			method: "GET", path: "/users/{userId}/transactions", summary: "Transaction history", userScoped: true,
+			description: "Paginated by page and pageSize, or walked by cursor and limit. Accept: text/csv returns the export instead.",
+			params:      append(append([]apiParam{userIdParam, fieldsParam, includeParam, envelopeParam, ifModifiedSinceParam}, historyFilterParams...), historyPaginationParams...),
+			responses: map[int]apiResponse{
+				http.StatusOK: {
+					description: "a page of the history, with envelope=false a bare array and the pagination in the headers",
+					oneOf:       []any{historyResponse{}, cursorHistoryResponse{}, []transactionResponse{}},
+					xml:         true,
+					headers:     []string{TotalCountHeader, PageHeader, TotalPagesHeader},
+					textHeaders: historyCaching,
+				},
+				http.StatusNotModified:   {description: "the ledger didn't change since If-Modified-Since", textHeaders: historyCaching, noContent: true},
+				http.StatusBadRequest:    validation,
+				http.StatusNotFound:      notFound,
+				http.StatusNotAcceptable: notAcceptable,
+			},
+		},
+		{
+			method: "HEAD", path: "/users/{userId}/transactions", summary: "Page metadata of the history", userScoped: true,
+			params: append(append([]apiParam{userIdParam}, historyFilterParams...), historyPaginationParams[:2]...),
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "the totals in headers, no body", headers: []string{TotalCountHeader, TotalPagesHeader}, noContent: true},
+				http.StatusBadRequest: {description: "invalid query parameter", noContent: true},
+				http.StatusNotFound:   {description: "unknown user", noContent: true},
+			},
+		},
+		{
+			method: "GET", path: "/users/{userId}/transactions/count", summary: "Number of transactions matching the filters", userScoped: true,
+			params: append([]apiParam{userIdParam}, historyFilterParams...),
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "the count", body: countResponse{}},
+				http.StatusBadRequest: validation,
+				http.StatusNotFound:   notFound,
+			},
+		},
+		{
+			method: "GET", path: "/users/{userId}/transactions/export", summary: "Export the history as CSV", userScoped: true,
+			params: append([]apiParam{userIdParam, {name: "format", in: "query", schema: map[string]any{"type": "string", "enum": []string{"csv"}}}}, historyFilterParams...),
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "streamed CSV attachment", contentType: "text/csv"},
+				http.StatusBadRequest: validation,
+				http.StatusNotFound:   notFound,
+			},
+		},
+		{
+			method: "GET", path: "/users/{userId}/statements/{year}/{month}", summary: "Monthly statement", userScoped: true,
+			description: "The calendar month in UTC with running balances. Accept: text/csv returns it as a CSV attachment instead.",
+			params: []apiParam{
+				userIdParam,
+				{name: "year", in: "path", required: true, schema: map[string]any{"type": "integer", "minimum": 1970, "maximum": 2100}},
+				{name: "month", in: "path", required: true, schema: map[string]any{"type": "integer", "minimum": 1, "maximum": 12}},
+			},
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "the statement, empty for a month without activity", body: services.MonthlyStatement{}},
+				http.StatusBadRequest: validation,
+				http.StatusNotFound:   notFound,
+			},
+		},
+		{
+			method: "GET", path: "/users/{userId}/totals", summary: "Deposit and withdrawal totals of a period", userScoped: true,
+			description: "Voided records are left out, a reversal counts with its own type and fees apart from the withdrawals.",
+			params:      append([]apiParam{userIdParam}, periodParams...),
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "the count and sum of each type, and the net change of the balance", body: services.PeriodTotals{}},
+				http.StatusBadRequest: validation,
+				http.StatusNotFound:   {description: "unknown user with strict accounts"},
+			},
+		},
+		{
+			method: "GET", path: "/users/{userId}/transactions/{txId}", summary: "A single transaction", userScoped: true,
+			params: []apiParam{userIdParam, txIdParam, fieldsParam},
+			responses: map[int]apiResponse{
+				http.StatusOK:            {description: "the record", body: transactionResponse{}, xml: true},
+				http.StatusBadRequest:    {description: "malformed transaction id"},
+				http.StatusNotFound:      notFound,
+				http.StatusNotAcceptable: notAcceptable,
+			},
+		},
+		{
+			method: "POST", path: "/users/{userId}/transactions/{txId}/reversal", summary: "Reverse a transaction", userScoped: true,
+			params:  []apiParam{userIdParam, txIdParam, {name: "If-Match", in: "header", schema: stringSchema, description: "an ETag of the balance or the summary, reverses only if the ledger is still at that version"}},
+			request: reversalRequest{},
+			responses: map[int]apiResponse{
+				http.StatusCreated:             {description: "the reversal record, Location points at it", body: transactionResponse{}},
+				http.StatusBadRequest:          validation,
+				http.StatusNotFound:            notFound,
+				http.StatusConflict:            {description: "already reversed"},
+				http.StatusPreconditionFailed:  {description: "the ledger changed since the If-Match version, the ETag and details.version are the current one", textHeaders: etagHeader},
+				http.StatusUnprocessableEntity: {description: "the reversal would overdraw the account"},
+			},
+		},
+		{
+			method: "POST", path: "/users/{userId}/transfers", summary: "Transfer to another user", userScoped: true,
+			params:  []apiParam{userIdParam, idempotencyKeyParam},
+			request: transferRequest{},
+			responses: map[int]apiResponse{
+				http.StatusCreated:             {description: "both legs were recorded, Location points at the debit", body: transferResponse{}},
+				http.StatusBadRequest:          validation,
+				http.StatusNotFound:            notFound,
+				http.StatusUnprocessableEntity: {description: "insufficient funds or idempotency key reused with another body"},
+			},
+		},
+		{
+			method: "POST", path: "/users/{userId}/imports", summary: "Import a bank file", userScoped: true,
+			description: "Credits become deposits and debits withdrawals, one by one in the order of their date. The FITID " +
+				"is the referenceId of the record, importing the same file again skips what is in.",
+			params: []apiParam{userIdParam},
+			multipart: map[string]any{
+				"type":     "object",
+				"required": []string{"file"},
+				"properties": map[string]any{
+					"file":   map[string]any{"type": "string", "format": "binary"},
+					"format": map[string]any{"type": "string", "enum": bankfile.Formats, "description": "the extension of the file name when not set"},
+				},
+			},
+			responses: map[int]apiResponse{
+				http.StatusOK:                    {description: "what was imported, skipped and failed", body: services.ImportReport{}},
+				http.StatusBadRequest:            {description: "no file, an unknown format or a file that isn't of the format"},
+				http.StatusNotFound:              notFound,
+				http.StatusRequestEntityTooLarge: {description: "the file is over the batch limit"},
+			},
+		},
+		{
+			method: "GET", path: "/users/{userId}/ws", summary: "WebSocket of events and commands",
+			description: "streams an event frame for every new record of the user and takes deposit, withdrawal and balance " +
+				"commands, each answered by a response or error frame with the requestId of the command",
+			userScoped: true,
+			params:     []apiParam{userIdParam},
+			responses: map[int]apiResponse{
+				http.StatusSwitchingProtocols: {description: "upgraded to a WebSocket", noContent: true},
+				http.StatusBadRequest:         {description: "not a WebSocket handshake"},
+			},
+		},
+		{
+			method: "POST", path: "/graphql", summary: "GraphQL query or mutation", userScoped: true,
+			description: "the user's balance, summary and transactions, and the recordTransaction and transfer mutations. " +
+				"errors are in the errors array with the error kind in extensions.code, queries over the depth or cost limit are refused",
+			request: graphQLRequest{},
+			responses: map[int]apiResponse{
+				http.StatusOK:         {description: "data and errors of the query", body: map[string]any{}},
+				http.StatusBadRequest: {description: "the body is not a GraphQL request"},
+			},
+		},
+	}
+}
+
+// openAPIDocument builds the OpenAPI 3 document of the routes, it's only built once
+func (h *LedgerHandler) openAPIDocument() []byte {
+	h.openAPIOnce.Do(func() {
+		operations := apiOperations()
+		if h.admin == nil {
+			operations = slices.DeleteFunc(operations, func(op apiOperation) bool { return op.admin })
+		}
+		if h.reload == nil {
+			operations = slices.DeleteFunc(operations, func(op apiOperation) bool { return op.reload })
+		}
+		if h.outbox == nil {
+			operations = slices.DeleteFunc(operations, func(op apiOperation) bool { return op.outbox })
+		}
+		if h.payments == nil {
+			operations = slices.DeleteFunc(operations, func(op apiOperation) bool { return op.payments })
+		}
+		if h.tenants != nil {
+			operations = withTenantParam(operations)
+		}
+		if h.defaultPageSize != DefaultPageSize {
+			operations = withPageSizeDefault(operations, h.defaultPageSize)
+		}
+		h.openAPI, _ = json.Marshal(buildOpenAPI(mountOperations(operations, h.prefix, h.legacyMounted)))
+	})
+	return h.openAPI
+}
+
+// withTenantParam requires the tenant header on the ledger and admin routes, the document is public so the tenants
+// aren't listed
+func withTenantParam(operations []apiOperation) []apiOperation {
+	param := apiParam{name: TenantHeader, in: "header", required: true, schema: stringSchema, description: "one of the configured tenants"}
+	for i, op := range operations {
+		if (op.userScoped || op.admin) && !op.reload {
+			operations[i].params = append(slices.Clip(op.params), param)
+		}
+	}
+	return operations
+}
+
+// withPageSizeDefault documents the configured default of pageSize on the ledger routes, the admin lists have their own
+func withPageSizeDefault(operations []apiOperation, pageSize int) []apiOperation {
+	for i, op := range operations {
+		if !op.userScoped {
+			continue
+		}
+		params := slices.Clone(op.params)
+		for j, param := range params {
+			if param.name == "pageSize" {
+				params[j].schema = maps.Clone(param.schema)
+				params[j].schema["default"] = pageSize
+			}
+		}
+		operations[i].params = params
+	}
+	return operations
+}
+
+// mountOperations moves the ledger routes under the prefix they're served from, with legacy the unprefixed copies
+// are documented too but marked deprecated
+func mountOperations(operations []apiOperation, prefix string, legacy bool) []apiOperation {
+	mounted := make([]apiOperation, 0, len(operations))
+	var deprecated []apiOperation
+	for _, op := range operations {
+		if op.admin {
+			// the admin routes never had an unprefixed path
+			op.path = prefix + op.path
+			mounted = append(mounted, op)
+			continue
+		}
+		if !op.userScoped || prefix == "" {
+			mounted = append(mounted, op)
+			continue
+		}
+
+		if legacy {
+			old := op
+			old.deprecated = true
+			deprecated = append(deprecated, old)
+		}
+		op.path = prefix + op.path
+		mounted = append(mounted, op)
+	}
+	return append(mounted, deprecated...)
+}
+
+// buildOpenAPI turns the operations into the document
+func buildOpenAPI(operations []apiOperation) map[string]any {
+	schemas := newSchemaRegistry()
+	errorRef := schemas.ref(reflect.TypeOf(ErrorResponse{}))
+
+	paths := map[string]any{}
+	for _, op := range operations {
+		item, _ := paths[op.path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[op.path] = item
+		}
+
+		operation := map[string]any{"summary": op.summary}
+		if op.description != "" {
+			operation["description"] = op.description
+		}
+		if op.deprecated {
+			operation["deprecated"] = true
+		}
+
+		if len(op.params) > 0 {
+			params := make([]any, 0, len(op.params))
+			for _, p := range op.params {
+				param := map[string]any{"name": p.name, "in": p.in, "schema": p.schema, "required": p.required}
+				if p.description != "" {
+					param["description"] = p.description
+				}
+				params = append(params, param)
+			}
+			operation["parameters"] = params
+		}
+
+		if op.request != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"application/json": map[string]any{"schema": schemas.ref(reflect.TypeOf(op.request))}},
+			}
+		}
+		if op.multipart != nil {
+			operation["requestBody"] = map[string]any{
+				"required": true,
+				"content":  map[string]any{"multipart/form-data": map[string]any{"schema": op.multipart}},
+			}
+		}
+
+		responses := map[string]any{}
+		for status, resp := range op.responses {
+			responses[strconv.Itoa(status)] = response(resp, schemas, errorRef)
+		}
+		if op.userScoped {
+			responses["401"] = response(apiResponse{description: "missing or invalid bearer token or request signature"}, schemas, errorRef)
+			responses["403"] = response(apiResponse{description: "the token belongs to another user"}, schemas, errorRef)
+			responses["429"] = response(apiResponse{description: "rate limited, see Retry-After"}, schemas, errorRef)
+			operation["security"] = []any{map[string]any{"bearerAuth": []string{}}}
+		}
+		if op.admin {
+			responses["401"] = response(apiResponse{description: "missing or invalid admin credentials"}, schemas, errorRef)
+			operation["security"] = []any{map[string]any{"adminKey": []string{}}, map[string]any{"adminBasic": []string{}}}
+		}
+		if op.request != nil {
+			responses["413"] = response(apiResponse{description: "body too large"}, schemas, errorRef)
+			responses["415"] = response(apiResponse{description: "body is not application/json"}, schemas, errorRef)
+		}
+		if op.multipart != nil {
+			responses["415"] = response(apiResponse{description: "body is not multipart/form-data"}, schemas, errorRef)
+		}
+		responses["default"] = response(apiResponse{description: "unexpected error"}, schemas, errorRef)
+		operation["responses"] = responses
+
+		item[strings.ToLower(op.method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":   "Tiny Ledger",
+			"version": "1.0.0",
+			"description": "Errors share the ErrorResponse shape. details.code is the kind of error: VALIDATION_FAILED, " +
+				"UNAUTHORIZED, FORBIDDEN, NOT_FOUND, METHOD_NOT_ALLOWED, CONFLICT, DUPLICATE, BODY_TOO_LARGE, " +
+				"UNSUPPORTED_MEDIA_TYPE, INSUFFICIENT_FUNDS, MINIMUM_BALANCE, IDEMPOTENCY_KEY_REUSED, UNPROCESSABLE, " +
+				"RATE_LIMITED or INTERNAL. The error string and the flat code and field are kept for one release, " +
+				"code (also in details.fields) is one of empty_body, malformed_json, unknown_field, " +
+				"invalid_type, body_too_large, unsupported_media_type, not_positive, max_amount, max_length, invalid_utf8, " +
+				"invalid_user_id, self_transfer, balance_not_zero, invalid_idempotency_key, idempotency_key_reused, invalid_number, " +
+				"out_of_range, invalid_time, invalid_range, invalid_value, invalid_cursor, conflicting_pagination, " +
+				"unsupported_parameter, validation_failed, unauthorized, signature_required, signature_expired, invalid_signature, " +
+				"forbidden or rate_limited.",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": schemas.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"adminKey":   map[string]any{"type": "apiKey", "in": "header", "name": AdminKeyHeader},
+				"adminBasic": map[string]any{"type": "http", "scheme": "basic"},
+			},
+		},
+	}
+}
+
+func response(resp apiResponse, schemas *schemaRegistry, errorRef map[string]any) map[string]any {
+	contentType := resp.contentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	schema := errorRef
+	switch {
+	case resp.body != nil:
+		schema = schemas.ref(reflect.TypeOf(resp.body))
+	case len(resp.oneOf) > 0:
+		alternatives := make([]any, 0, len(resp.oneOf))
+		for _, body := range resp.oneOf {
+			alternatives = append(alternatives, schemas.ref(reflect.TypeOf(body)))
+		}
+		schema = map[string]any{"oneOf": alternatives}
+	case contentType != "application/json":
+		schema = stringSchema
+	}
+
+	result := map[string]any{"description": resp.description}
+	if !resp.noContent {
+		content := map[string]any{contentType: map[string]any{"schema": schema}}
+		if resp.xml {
+			content[xmlMediaType] = map[string]any{"schema": schema}
+		}
+		result["content"] = content
+	}
+	if len(resp.headers) > 0 || len(resp.textHeaders) > 0 {
+		headers := map[string]any{}
+		for _, name := range resp.headers {
+			headers[name] = map[string]any{"schema": map[string]any{"type": "integer"}}
+		}
+		for name, description := range resp.textHeaders {
+			headers[name] = map[string]any{"schema": stringSchema, "description": description}
+		}
+		result["headers"] = headers
+	}
+	return result
+}
+
+// schemaRegistry generates the JSON schemas of Go types from their json tags, structs go to the components and are
+// referenced by name
+type schemaRegistry struct {
+	schemas map[string]any
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: map[string]any{}}
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	uuidType            = reflect.TypeOf(uuid.UUID{})
+	transactionTypeType = reflect.TypeOf(models.TransactionType(""))
+)
+
+func transactionTypeSchema() map[string]any {
+	return map[string]any{"type": "string", "enum": []string{string(models.Deposit), string(models.Withdrawal)}}
+}
+
+func (s *schemaRegistry) ref(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return timeSchema
+	case uuidType:
+		return uuidSchema
+	case transactionTypeType:
+		return transactionTypeSchema()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, exists := s.schemas[name]; !exists {
+			s.schemas[name] = nil // placeholder so recursive types terminate
+			s.schemas[name] = s.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": s.ref(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": s.ref(t.Elem())}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	}
+	return map[string]any{}
+}
+
+// object is the schema of a struct, fields without omitempty are required
+func (s *schemaRegistry) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = s.ref(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+
+	schema := map[string]any{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaName exports the Go type name, transactionRequest becomes TransactionRequest
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func (h *LedgerHandler) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(h.openAPIDocument())
+}
+
+// docsPage loads Swagger UI from its CDN and points it at the document
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Tiny Ledger API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>window.ui = SwaggerUIBundle({url: "/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(docsPage))
+}
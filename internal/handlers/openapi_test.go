@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/buildinfo"
+	"tiny-ledger/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+type openAPITestDocument struct {
+	OpenAPI string `json:"openapi"`
+	Paths   map[string]map[string]struct {
+		Parameters []struct {
+			Name     string `json:"name"`
+			In       string `json:"in"`
+			Required bool   `json:"required"`
+		} `json:"parameters"`
+		Responses map[string]json.RawMessage `json:"responses"`
+	} `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+			Required   []string                   `json:"required"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func fetchOpenAPI(t *testing.T, router *mux.Router) openAPITestDocument {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+
+	var doc openAPITestDocument
+	if err := json.NewDecoder(rr.Body).Decode(&doc); err != nil {
+		t.Fatalf("the document is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+// TestOpenAPIMatchesRoutes fails when a route is registered without being documented or the other way around
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	router := mux.NewRouter()
+	NewHealthHandler(buildinfo.Info{Version: "test"}).RegisterRoutes(router)
+	// the admin routes are optional, they're enabled so they're checked too
+	handler := setupTestHandler()
+	WithAdmin(testAdminCredentials)(handler)
+	WithConfigReload(func() (ConfigReload, error) { return ConfigReload{}, nil })(handler)
+	WithOutbox(store.NewLedgerStore(store.WithOutbox()))(handler)
+	WithPaymentsWebhook([]byte("psp-secret"))(handler)
+	handler.RegisterRoutes(router, APIPrefix)
+	handler.RegisterLegacyRoutes(router, time.Now().AddDate(0, 6, 0))
+
+	doc := fetchOpenAPI(t, router)
+	if doc.OpenAPI != openAPIVersion {
+		t.Errorf("expected openapi %s, got %q", openAPIVersion, doc.OpenAPI)
+	}
+
+	pathVar := regexp.MustCompile(`\{([^}:]+)`)
+	registered := map[string]bool{}
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			key := strings.ToLower(method) + " " + path
+			registered[key] = true
+
+			op, documented := doc.Paths[path][strings.ToLower(method)]
+			if !documented {
+				t.Errorf("%s %s is not documented", method, path)
+				continue
+			}
+
+			params := map[string]bool{}
+			for _, p := range op.Parameters {
+				if p.In == "path" && p.Required {
+					params[p.Name] = true
+				}
+			}
+			for _, match := range pathVar.FindAllStringSubmatch(path, -1) {
+				if !params[match[1]] {
+					t.Errorf("%s %s doesn't document the path parameter %s", method, path, match[1])
+				}
+			}
+		}
+		return nil
+	})
+
+	for path, item := range doc.Paths {
+		for method := range item {
+			if !registered[method+" "+path] {
+				t.Errorf("%s %s is documented but not registered", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestOpenAPIHistoryParameters(t *testing.T) {
+	router := mux.NewRouter()
+	setupTestHandler().RegisterRoutes(router, "")
+	doc := fetchOpenAPI(t, router)
+
+	var documented []string
+	for _, p := range doc.Paths["/users/{userId}/transactions"]["get"].Parameters {
+		if p.In == "query" {
+			documented = append(documented, p.Name)
+		}
+	}
+	sort.Strings(documented)
+
+	expected := []string{"cursor", "end", "envelope", "fields", "include", "includeVoided", "last", "limit", "maxAmount", "minAmount", "order", "page", "pageSize", "q", "start", "type", "tz"}
+	if strings.Join(documented, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected the history parameters %v, got %v", expected, documented)
+	}
+
+	for _, status := range []string{"200", "400", "401", "403", "404", "429"} {
+		if _, found := doc.Paths["/users/{userId}/transactions"]["get"].Responses[status]; !found {
+			t.Errorf("expected the history to document a %s response", status)
+		}
+	}
+}
+
+func TestOpenAPISchemasFromStructs(t *testing.T) {
+	router := mux.NewRouter()
+	setupTestHandler().RegisterRoutes(router, "")
+	doc := fetchOpenAPI(t, router)
+
+	tests := []struct {
+		schema   string
+		property string
+		required bool
+	}{
+		{"ErrorResponse", "error", true},
+		{"ErrorResponse", "code", false},
+		{"TransactionRequest", "amount", true},
+		{"TransactionRequest", "allowDuplicate", false},
+		{"ErrorResponse", "details", true},
+		{"ErrorDetails", "fields", false},
+		{"TransactionResponse", "id", true},
+		{"TransactionResponse", "reversedBy", false},
+		{"HistoryResponse", "pagination", true},
+		{"PagePagination", "totalItems", true},
+		{"CursorPagination", "nextCursor", false},
+		{"TransferResponse", "transferId", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schema+"."+tt.property, func(t *testing.T) {
+			schema, found := doc.Components.Schemas[tt.schema]
+			if !found {
+				t.Fatalf("schema %s not found", tt.schema)
+			}
+			if _, found := schema.Properties[tt.property]; !found {
+				t.Fatalf("property %s not found", tt.property)
+			}
+			required := false
+			for _, name := range schema.Required {
+				required = required || name == tt.property
+			}
+			if required != tt.required {
+				t.Errorf("expected required=%v, got %v", tt.required, required)
+			}
+		})
+	}
+
+	if _, found := doc.Components.Schemas["TransactionRecord"].Properties["idempotencyKey"]; found {
+		t.Errorf("fields tagged json:\"-\" must not be documented")
+	}
+}
+
+func TestDocsPage(t *testing.T) {
+	router := mux.NewRouter()
+	setupTestHandler().RegisterRoutes(router, "")
+
+	req, _ := http.NewRequest("GET", "/docs", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("expected an HTML page, got %d %q", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rr.Body.String(), `url: "/openapi.json"`) {
+		t.Errorf("expected the page to load /openapi.json")
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// Outbox is the outbox of a store made with store.WithOutbox
+type Outbox interface {
+	OutboxStats() store.OutboxStats
+	OutboxDeadLetters() []store.OutboxEntry
+	RequeueOutbox(id uint64, now time.Time) (store.OutboxEntry, error)
+}
+
+// WithOutbox mounts GET <prefix>/admin/outbox and POST <prefix>/admin/outbox/{id}/requeue, admin routes like the
+// others, only mounted with WithAdmin too
+func WithOutbox(outbox Outbox) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.outbox = outbox
+	}
+}
+
+type outboxResponse struct {
+	Pending      int                 `json:"pending"`
+	DeadLettered int                 `json:"deadLettered"`
+	DeadLetters  []store.OutboxEntry `json:"deadLetters"` // oldest first
+}
+
+func (h *LedgerHandler) handleOutbox(w http.ResponseWriter, r *http.Request) {
+	dead := h.outbox.OutboxDeadLetters()
+	if dead == nil {
+		dead = []store.OutboxEntry{}
+	}
+	stats := h.outbox.OutboxStats()
+	sendJSONResponse(w, r, http.StatusOK, outboxResponse{Pending: stats.Pending, DeadLettered: stats.DeadLettered, DeadLetters: dead})
+}
+
+func (h *LedgerHandler) handleRequeueOutbox(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "id", Code: "invalid_value", Message: "invalid outbox entry id"})
+		return
+	}
+
+	entry, err := h.outbox.RequeueOutbox(id, h.now())
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+	h.audit(r, "outbox.requeued", "entry", id, "userId", entry.UserID)
+	sendJSONResponse(w, r, http.StatusOK, entry)
+}
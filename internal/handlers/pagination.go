@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// WithForwardedHeaders builds absolute URLs from X-Forwarded-Proto and X-Forwarded-Host, only enable it behind a
+// proxy that sets them, otherwise clients can point the links anywhere
+func WithForwardedHeaders() HandlerOption {
+	return func(h *LedgerHandler) {
+		h.trustForwarded = true
+	}
+}
+
+// baseURL is the scheme and host the client used to reach the server
+func (h *LedgerHandler) baseURL(r *http.Request) string {
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if h.trustForwarded {
+		// a chain of proxies appends, the first value is the one the client saw
+		if proto := firstHeaderValue(r, "X-Forwarded-Proto"); proto == "http" || proto == "https" {
+			scheme = proto
+		}
+		if forwardedHost := firstHeaderValue(r, "X-Forwarded-Host"); forwardedHost != "" {
+			host = forwardedHost
+		}
+	}
+	return scheme + "://" + host
+}
+
+func firstHeaderValue(r *http.Request, name string) string {
+	value, _, _ := strings.Cut(r.Header.Get(name), ",")
+	return strings.TrimSpace(value)
+}
+
+type pageLink struct {
+	rel string
+	url string
+}
+
+// pageLinks returns the first, prev, next and last pages of the request, keeping every query parameter but the page.
+// prev is left out on the first page and next on the last one
+func (h *LedgerHandler) pageLinks(r *http.Request, page, totalPages int) []pageLink {
+	if totalPages < 1 {
+		totalPages = 1
+	}
+
+	base := h.baseURL(r) + r.URL.EscapedPath()
+	link := func(p int) string {
+		query := r.URL.Query()
+		query.Set("page", strconv.Itoa(p))
+		return base + "?" + query.Encode()
+	}
+
+	links := []pageLink{{rel: "first", url: link(1)}}
+	if page > 1 {
+		links = append(links, pageLink{rel: "prev", url: link(min(page-1, totalPages))})
+	}
+	if page < totalPages {
+		links = append(links, pageLink{rel: "next", url: link(page + 1)})
+	}
+	return append(links, pageLink{rel: "last", url: link(totalPages)})
+}
+
+// paginate describes the page in the body and in the Link header
+func (h *LedgerHandler) paginate(w http.ResponseWriter, r *http.Request, page, pageSize, totalItems, totalPages int) pagePagination {
+	pagination := pagePagination{
+		Page:       page,
+		PageSize:   pageSize,
+		TotalItems: totalItems,
+		TotalPages: totalPages,
+	}
+	links := h.pageLinks(r, page, totalPages)
+	for _, l := range links {
+		switch l.rel {
+		case "first":
+			pagination.First = l.url
+		case "prev":
+			pagination.Prev = l.url
+		case "next":
+			pagination.Next = l.url
+		case "last":
+			pagination.Last = l.url
+		}
+	}
+
+	setLinkHeader(w, links)
+	return pagination
+}
+
+// setLinkHeader sets the RFC 8288 Link header with the same relations as the body
+func setLinkHeader(w http.ResponseWriter, links []pageLink) {
+	values := make([]string, 0, len(links))
+	for _, l := range links {
+		values = append(values, fmt.Sprintf(`<%s>; rel="%s"`, l.url, l.rel))
+	}
+	w.Header().Set("Link", strings.Join(values, ", "))
+}
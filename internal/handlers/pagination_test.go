@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+func TestHistoryPaginationLinks(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	for i := 0; i < 25; i++ {
+		postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 1.0})
+	}
+
+	start := url.QueryEscape(time.Now().Add(-time.Hour).UTC().Format(time.RFC3339))
+	base := "http://ledger.test/users/user1/transactions?"
+	pageURL := func(page string) string {
+		return base + "page=" + page + "&pageSize=10&start=" + start
+	}
+
+	tests := []struct {
+		name     string
+		page     string
+		expected map[string]string
+	}{
+		{
+			name:     "first page",
+			page:     "1",
+			expected: map[string]string{"first": pageURL("1"), "next": pageURL("2"), "last": pageURL("3")},
+		},
+		{
+			name:     "middle page",
+			page:     "2",
+			expected: map[string]string{"first": pageURL("1"), "prev": pageURL("1"), "next": pageURL("3"), "last": pageURL("3")},
+		},
+		{
+			name:     "last page",
+			page:     "3",
+			expected: map[string]string{"first": pageURL("1"), "prev": pageURL("2"), "last": pageURL("3")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/user1/transactions?start="+start+"&pageSize=10&page="+tt.page, nil)
+			req.Host = "ledger.test"
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rr.Code)
+			}
+
+			var response struct {
+				Pagination map[string]interface{} `json:"pagination"`
+			}
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatalf("failed to decode the response: %v", err)
+			}
+
+			for _, rel := range []string{"first", "prev", "next", "last"} {
+				expected, present := tt.expected[rel]
+				got, found := response.Pagination[rel]
+				if present != found {
+					t.Errorf("expected %s present=%v, got %v", rel, present, found)
+					continue
+				}
+				if present && got != expected {
+					t.Errorf("expected %s %q, got %q", rel, expected, got)
+				}
+
+				linkEntry := `<` + expected + `>; rel="` + rel + `"`
+				if strings.Contains(rr.Header().Get("Link"), linkEntry) != present {
+					t.Errorf("expected %s in the Link header=%v, got %q", rel, present, rr.Header().Get("Link"))
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryPaginationLinksBehindProxy(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []HandlerOption
+		expected string
+	}{
+		{name: "forwarded headers ignored by default", expected: "http://10.0.0.5:8080/users/user1/transactions?page=1&pageSize=10"},
+		{name: "forwarded headers trusted", opts: []HandlerOption{WithForwardedHeaders()}, expected: "https://ledger.example.com/users/user1/transactions?page=1&pageSize=10"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := mux.NewRouter()
+			NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, tt.opts...).RegisterRoutes(router, "")
+
+			req, _ := http.NewRequest("GET", "/users/user1/transactions?pageSize=10", nil)
+			req.Host = "10.0.0.5:8080"
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("X-Forwarded-Host", "ledger.example.com, proxy.internal")
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			var response struct {
+				Pagination map[string]interface{} `json:"pagination"`
+			}
+			_ = json.NewDecoder(rr.Body).Decode(&response)
+			if response.Pagination["first"] != tt.expected {
+				t.Errorf("expected first %q, got %q", tt.expected, response.Pagination["first"])
+			}
+			if _, found := response.Pagination["next"]; found {
+				t.Errorf("expected no next link for an empty history")
+			}
+		})
+	}
+}
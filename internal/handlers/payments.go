@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// PaymentSignatureHeader is "sha256=" followed by the hex HMAC-SHA256 of the body with the secret of
+// WithPaymentsWebhook
+const PaymentSignatureHeader = "X-Payment-Signature"
+
+const (
+	// PaymentsWebhookPath is where the payment provider POSTs its notifications, outside of the versioned API
+	PaymentsWebhookPath = "/integrations/payments/webhook"
+
+	paymentSucceeded = "payment.succeeded"
+
+	// maxPaymentDeadLetters bounds the dead letters, the oldest go first
+	maxPaymentDeadLetters = 1000
+)
+
+// what became of a notification, paymentWebhookResponse.Status
+const (
+	paymentRecorded     = "recorded"
+	paymentReplayed     = "replayed"
+	paymentIgnored      = "ignored"
+	paymentDeadLettered = "dead_lettered"
+)
+
+// WithPaymentsWebhook mounts POST /integrations/payments/webhook, where the payment provider notifies the settled
+// payments signed with secret, and GET <prefix>/admin/integrations/payments/dead-letters with WithAdmin
+func WithPaymentsWebhook(secret []byte) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.payments = &paymentInbox{secret: secret}
+	}
+}
+
+// paymentNotification is the body the provider POSTs, the fields the ledger doesn't use are ignored
+type paymentNotification struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"`   // only payment.succeeded is recorded
+	Amount        int64  `json:"amount"` // in minor units, cents
+	Currency      string `json:"currency,omitempty"`
+	UserReference string `json:"userReference"`
+	Description   string `json:"description,omitempty"`
+}
+
+type paymentWebhookResponse struct {
+	Status        string     `json:"status"` // recorded, replayed, ignored or dead_lettered
+	TransactionID *uuid.UUID `json:"transactionId,omitempty"`
+}
+
+// PaymentDeadLetter is a notification the ledger couldn't record, e.g. of a user it doesn't know in strict mode.
+// the provider got its 200, an operator settles it by hand
+type PaymentDeadLetter struct {
+	ID            uint64    `json:"id"`
+	PaymentID     string    `json:"paymentId"`
+	UserReference string    `json:"userReference"`
+	Amount        int64     `json:"amount"` // in minor units, as notified
+	Currency      string    `json:"currency,omitempty"`
+	Reason        string    `json:"reason"`
+	ReceivedAt    time.Time `json:"receivedAt"` // of the last notification of the payment
+}
+
+type paymentDeadLettersResponse struct {
+	DeadLetters []PaymentDeadLetter `json:"deadLetters"` // oldest first
+}
+
+// paymentInbox keeps the dead letters in memory, they're lost on restart like the rest of the memory store
+type paymentInbox struct {
+	secret []byte
+
+	mu          sync.Mutex
+	nextID      uint64
+	deadLetters []PaymentDeadLetter
+}
+
+// deadLetter adds the notification, a payment notified again replaces its earlier dead letter
+func (p *paymentInbox) deadLetter(n paymentNotification, reason string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i, letter := range p.deadLetters {
+		if letter.PaymentID == n.ID {
+			p.deadLetters = append(p.deadLetters[:i], p.deadLetters[i+1:]...)
+			break
+		}
+	}
+	if len(p.deadLetters) == maxPaymentDeadLetters {
+		p.deadLetters = p.deadLetters[1:]
+	}
+	p.nextID++
+	p.deadLetters = append(p.deadLetters, PaymentDeadLetter{
+		ID: p.nextID, PaymentID: n.ID, UserReference: n.UserReference, Amount: n.Amount, Currency: n.Currency,
+		Reason: reason, ReceivedAt: now,
+	})
+}
+
+func (p *paymentInbox) list() []PaymentDeadLetter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]PaymentDeadLetter{}, p.deadLetters...)
+}
+
+// verify checks the signature of the body in constant time
+func (p *paymentInbox) verify(body []byte, header string) bool {
+	signature, found := strings.CutPrefix(header, "sha256=")
+	if !found {
+		return false
+	}
+	sum, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(body)
+	return hmac.Equal(sum, mac.Sum(nil))
+}
+
+// handlePaymentWebhook records a settled payment as a deposit of the user, the payment ID is its reference so a
+// notification sent again is answered with the same deposit. the write is done before the 200, a notification the
+// ledger refuses for the user or the amount is dead-lettered and answered 200 too, the provider would only retry
+// it. a failure of the server is answered 500 so the provider retries
+func (h *LedgerHandler) handlePaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.maxBodyBytes))
+	if err != nil {
+		h.sendDecodeError(w, r, decodeError(err))
+		return
+	}
+	header := r.Header.Get(PaymentSignatureHeader)
+	if header == "" {
+		sendError(w, r, http.StatusUnauthorized, ErrorResponse{Error: "payment signature required", Code: "signature_required"})
+		return
+	}
+	if !h.payments.verify(body, header) {
+		h.requestLogger(r).WarnContext(r.Context(), "payment notification with an invalid signature")
+		sendError(w, r, http.StatusUnauthorized, ErrorResponse{Error: "invalid payment signature", Code: "invalid_signature"})
+		return
+	}
+
+	var notification paymentNotification
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&notification); err != nil {
+		h.sendDecodeError(w, r, decodeError(err))
+		return
+	}
+	if notification.Type != paymentSucceeded {
+		sendJSONResponse(w, r, http.StatusOK, paymentWebhookResponse{Status: paymentIgnored})
+		return
+	}
+	var errs services.ValidationErrors
+	if notification.ID == "" {
+		errs = append(errs, &services.ValidationError{Field: "id", Code: "required", Message: "id is required"})
+	}
+	if notification.UserReference == "" {
+		errs = append(errs, &services.ValidationError{Field: "userReference", Code: "required", Message: "userReference is required"})
+	}
+	if notification.Amount <= 0 {
+		errs = append(errs, &services.ValidationError{Field: "amount", Code: "not_positive", Rule: services.RulePositive, Message: "amount must be positive"})
+	}
+	if len(errs) > 0 {
+		h.sendValidationErrors(w, r, errs)
+		return
+	}
+
+	ledger := h.ledger(r)
+	if currency := ledger.Config().Currency; notification.Currency != "" && !strings.EqualFold(notification.Currency, currency) {
+		h.deadLetterPayment(w, r, notification, "the ledger is kept in "+currency)
+		return
+	}
+	description := notification.Description
+	if description == "" {
+		description = "Payment " + notification.ID
+	}
+	tx, replayed, err := ledger.RecordExternalPayment(services.ExternalPayment{
+		ID:          notification.ID,
+		UserID:      notification.UserReference,
+		Amount:      float64(notification.Amount) / 100,
+		Description: description,
+	})
+	var validationErr *services.ValidationError
+	var validationErrs services.ValidationErrors
+	switch {
+	case errors.Is(err, store.ErrUserNotFound), errors.As(err, &validationErr), errors.As(err, &validationErrs):
+		h.deadLetterPayment(w, r, notification, err.Error())
+	case err != nil:
+		h.sendServiceError(w, r, err)
+	case replayed:
+		sendJSONResponse(w, r, http.StatusOK, paymentWebhookResponse{Status: paymentReplayed, TransactionID: &tx.ID})
+	default:
+		sendJSONResponse(w, r, http.StatusOK, paymentWebhookResponse{Status: paymentRecorded, TransactionID: &tx.ID})
+	}
+}
+
+func (h *LedgerHandler) deadLetterPayment(w http.ResponseWriter, r *http.Request, n paymentNotification, reason string) {
+	h.requestLogger(r).WarnContext(r.Context(), "payment dead-lettered", "payment_id", n.ID, "reason", reason)
+	h.payments.deadLetter(n, reason, h.now())
+	sendJSONResponse(w, r, http.StatusOK, paymentWebhookResponse{Status: paymentDeadLettered})
+}
+
+func (h *LedgerHandler) handlePaymentDeadLetters(w http.ResponseWriter, r *http.Request) {
+	sendJSONResponse(w, r, http.StatusOK, paymentDeadLettersResponse{DeadLetters: h.payments.list()})
+}
@@ -0,0 +1,157 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/apitest"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/store"
+)
+
+var (
+	paymentsSecret          = []byte("psp-secret")
+	paymentsAdminCredential = handlers.AdminCredentials{APIKey: "admin-key"}
+)
+
+// paymentResult is the answer of the webhook
+type paymentResult struct {
+	Status        string     `json:"status"`
+	TransactionID *uuid.UUID `json:"transactionId"`
+}
+
+func signPayment(body []byte) string {
+	mac := hmac.New(sha256.New, paymentsSecret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// postPayment notifies the webhook, which isn't under the prefix of the API
+func postPayment(t *testing.T, s *apitest.Server, body []byte, signature string) apitest.Response {
+	t.Helper()
+	req := httptest.NewRequest("POST", handlers.PaymentsWebhookPath, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(handlers.PaymentSignatureHeader, signature)
+	}
+	return s.Serve(t, req)
+}
+
+func setupPaymentsServer(t *testing.T) *apitest.Server {
+	t.Helper()
+	s := apitest.NewTestServer(apitest.WithStrictAccounts(),
+		apitest.WithHandlerOptions(handlers.WithAdmin(paymentsAdminCredential), handlers.WithPaymentsWebhook(paymentsSecret)))
+	if err := s.Service.CreateUser("alice"); err != nil {
+		t.Fatalf("failed to create the user: %v", err)
+	}
+	return s
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	s := setupPaymentsServer(t)
+	body := []byte(`{"id":"pay_123","type":"payment.succeeded","amount":1250,"currency":"usd","userReference":"alice","method":"card"}`)
+
+	var first paymentResult
+	postPayment(t, s, body, signPayment(body)).Expect(t, http.StatusOK).Decode(t, &first)
+	if first.Status != "recorded" {
+		t.Fatalf("expected the payment recorded, got %+v", first)
+	}
+	tx, err := s.Service.GetTransaction("alice", *first.TransactionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tx.Amount != 12.5 || tx.ReferenceID != "pay_123" || tx.Description != "Payment pay_123" || tx.Fee != 0 {
+		t.Errorf("expected a deposit of 12.50 with the payment as reference, got %+v", tx)
+	}
+
+	// the provider sends it again, nothing more is recorded
+	var replay paymentResult
+	postPayment(t, s, body, signPayment(body)).Expect(t, http.StatusOK).Decode(t, &replay)
+	if replay.Status != "replayed" || *replay.TransactionID != *first.TransactionID {
+		t.Errorf("expected the first deposit replayed, got %+v", replay)
+	}
+	if balance := s.GetBalance(t, "alice", ""); balance.Balance != 12.5 {
+		t.Errorf("expected a balance of 12.50, got %v", balance.Balance)
+	}
+
+	refund := []byte(`{"id":"re_1","type":"refund.created","amount":1250,"userReference":"alice"}`)
+	var ignored paymentResult
+	postPayment(t, s, refund, signPayment(refund)).Expect(t, http.StatusOK).Decode(t, &ignored)
+	if ignored.Status != "ignored" {
+		t.Errorf("expected the other types ignored, got %+v", ignored)
+	}
+
+	invalid := []byte(`{"id":"pay_9","type":"payment.succeeded","amount":-5}`)
+	if errBody := postPayment(t, s, invalid, signPayment(invalid)).Error(t, http.StatusBadRequest, "VALIDATION_FAILED"); len(errBody.Details.Fields) != 2 {
+		t.Errorf("expected the user reference and the amount rejected, got %+v", errBody)
+	}
+}
+
+func TestPaymentWebhookSignature(t *testing.T) {
+	s := setupPaymentsServer(t)
+	body := []byte(`{"id":"pay_123","type":"payment.succeeded","amount":1250,"userReference":"alice"}`)
+	tampered := bytes.Replace(body, []byte("1250"), []byte("125000"), 1)
+
+	for _, tc := range []struct {
+		name, signature, code string
+		body                  []byte
+	}{
+		{"missing", "", "signature_required", body},
+		{"tampered body", signPayment(body), "invalid_signature", tampered},
+		{"other secret", "sha256=" + hex.EncodeToString(hmac.New(sha256.New, []byte("other")).Sum(nil)), "invalid_signature", body},
+		{"not hex", "sha256=zz", "invalid_signature", body},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var errBody handlers.ErrorResponse
+			postPayment(t, s, tc.body, tc.signature).Expect(t, http.StatusUnauthorized).Decode(t, &errBody)
+			if errBody.Code != tc.code {
+				t.Errorf("expected %s, got %+v", tc.code, errBody)
+			}
+		})
+	}
+	if balance := s.GetBalance(t, "alice", ""); balance.Balance != 0 {
+		t.Errorf("expected nothing recorded, got a balance of %v", balance.Balance)
+	}
+}
+
+func TestPaymentWebhookDeadLetters(t *testing.T) {
+	s := setupPaymentsServer(t)
+
+	unknown := []byte(`{"id":"pay_7","type":"payment.succeeded","amount":900,"userReference":"mallory"}`)
+	for range 2 {
+		var result paymentResult
+		postPayment(t, s, unknown, signPayment(unknown)).Expect(t, http.StatusOK).Decode(t, &result)
+		if result.Status != "dead_lettered" {
+			t.Fatalf("expected the unknown user dead-lettered, got %+v", result)
+		}
+	}
+	euros := []byte(`{"id":"pay_8","type":"payment.succeeded","amount":900,"currency":"EUR","userReference":"alice"}`)
+	postPayment(t, s, euros, signPayment(euros)).Expect(t, http.StatusOK)
+
+	s.Do(t, "GET", "/admin/integrations/payments/dead-letters", nil).Expect(t, http.StatusUnauthorized)
+
+	req := httptest.NewRequest("GET", s.Prefix+"/admin/integrations/payments/dead-letters", nil)
+	req.Header.Set(handlers.AdminKeyHeader, paymentsAdminCredential.APIKey)
+	var response struct {
+		DeadLetters []handlers.PaymentDeadLetter `json:"deadLetters"`
+	}
+	s.Serve(t, req).Expect(t, http.StatusOK).Decode(t, &response)
+	// the second notification of pay_7 replaced the first
+	if len(response.DeadLetters) != 2 {
+		t.Fatalf("expected 2 dead letters, got %+v", response.DeadLetters)
+	}
+	first, second := response.DeadLetters[0], response.DeadLetters[1]
+	if first.PaymentID != "pay_7" || first.UserReference != "mallory" || first.Amount != 900 || first.Reason != store.ErrUserNotFound.Error() {
+		t.Errorf("unexpected dead letter %+v", first)
+	}
+	if second.PaymentID != "pay_8" || second.Reason != "the ledger is kept in USD" {
+		t.Errorf("unexpected dead letter %+v", second)
+	}
+}
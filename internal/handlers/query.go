@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+)
+
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100 // also the cap of limit
+
+	maxLast = 5 * 365 * 24 * time.Hour // the longest rolling window of last
+)
+
+// WithPageSizeClamp caps a pageSize or limit above the maximum instead of rejecting the request
+func WithPageSizeClamp() HandlerOption {
+	return func(h *LedgerHandler) {
+		h.clampPageSize = true
+	}
+}
+
+// WithDefaultPageSize is the pageSize of a history page that doesn't name one, it must be 1 to MaxPageSize
+func WithDefaultPageSize(pageSize int) HandlerOption {
+	return func(h *LedgerHandler) {
+		if pageSize >= 1 && pageSize <= MaxPageSize {
+			h.defaultPageSize = pageSize
+		}
+	}
+}
+
+// WithClock replaces time.Now as the end of the rolling window of last, for tests
+func WithClock(now func() time.Time) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.now = now
+	}
+}
+
+// historyQuery is the validated query string of the history endpoint, either a page or a cursor walk
+type historyQuery struct {
+	filter   services.HistoryFilter
+	page     int
+	pageSize int
+
+	byCursor bool
+	cursor   *services.HistoryCursor
+	limit    int // 0 lets the service pick the default
+
+	fields         fieldSet // of each record, only the history route takes it
+	runningBalance bool     // include=runningBalance, only the history route takes it
+	envelope       bool     // false for a bare array, only the history route takes it
+}
+
+// parseHistoryQuery rejects every malformed parameter with the field it came from instead of falling back to a
+// default, so clients learn about a typo rather than silently getting another page
+func (h *LedgerHandler) parseHistoryQuery(query url.Values) (historyQuery, *services.ValidationError) {
+	q := historyQuery{page: 1, pageSize: h.defaultPageSize}
+
+	q.byCursor = query.Has("cursor") || query.Has("limit")
+	if q.byCursor && (query.Has("page") || query.Has("pageSize")) {
+		return historyQuery{}, &services.ValidationError{
+			Field:   "cursor",
+			Code:    "conflicting_pagination",
+			Message: "cursor and limit cannot be combined with page and pageSize",
+		}
+	}
+
+	var verr *services.ValidationError
+	if q.page, verr = positiveParam(query, "page", q.page, 0, false); verr != nil {
+		return historyQuery{}, verr
+	}
+	if q.pageSize, verr = positiveParam(query, "pageSize", q.pageSize, MaxPageSize, h.clampPageSize); verr != nil {
+		return historyQuery{}, verr
+	}
+	if q.limit, verr = positiveParam(query, "limit", 0, MaxPageSize, h.clampPageSize); verr != nil {
+		return historyQuery{}, verr
+	}
+
+	if q.filter.StartTime, q.filter.EndTime, verr = h.timeRangeParams(query); verr != nil {
+		return historyQuery{}, verr
+	}
+
+	// voided records are part of the history unless explicitly excluded
+	if value := query.Get("includeVoided"); value != "" {
+		includeVoided, err := strconv.ParseBool(value)
+		if err != nil {
+			return historyQuery{}, &services.ValidationError{Field: "includeVoided", Code: "invalid_value", Message: "invalid includeVoided value, use true or false"}
+		}
+		q.filter.ExcludeVoided = !includeVoided
+	}
+
+	order, verr := enumParam(query, "order", "asc", "desc")
+	if verr != nil {
+		return historyQuery{}, verr
+	}
+	q.filter.Descending = order == "desc"
+
+	txType, verr := enumParam(query, "type", string(models.Deposit), string(models.Withdrawal))
+	if verr != nil {
+		return historyQuery{}, verr
+	}
+	if txType != "" {
+		t := models.TransactionType(txType)
+		q.filter.Type = &t
+	}
+
+	if q.filter.MinAmount, verr = amountParam(query, "minAmount"); verr != nil {
+		return historyQuery{}, verr
+	}
+	if q.filter.MaxAmount, verr = amountParam(query, "maxAmount"); verr != nil {
+		return historyQuery{}, verr
+	}
+	if q.filter.MinAmount != nil && q.filter.MaxAmount != nil && *q.filter.MinAmount > *q.filter.MaxAmount {
+		return historyQuery{}, &services.ValidationError{Field: "minAmount", Code: "invalid_range", Message: "minAmount cannot be greater than maxAmount"}
+	}
+
+	// the length and the trimming are up to the service
+	q.filter.Query = query.Get("q")
+
+	include, verr := enumParam(query, "include", "runningBalance")
+	if verr != nil {
+		return historyQuery{}, verr
+	}
+	q.runningBalance = include != ""
+
+	if value := query.Get("cursor"); value != "" {
+		c, verr := decodeCursor(value)
+		if verr != nil {
+			return historyQuery{}, verr
+		}
+		// the cursor remembers the order it was issued for, an explicit order must agree with it
+		if order == "" {
+			q.filter.Descending = c.Descending
+		}
+		q.cursor = &c
+	}
+
+	return q, nil
+}
+
+// positiveParam parses an optional positive integer, above a non zero upper bound it's either clamped or rejected
+func positiveParam(query url.Values, name string, fallback, upper int, clamp bool) (int, *services.ValidationError) {
+	raw := query.Get(name)
+	if raw == "" {
+		return fallback, nil
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, &services.ValidationError{Field: name, Code: "invalid_number", Message: name + " must be an integer"}
+	}
+	if value < 1 {
+		return 0, &services.ValidationError{Field: name, Code: "not_positive", Message: name + " must be positive"}
+	}
+	if upper > 0 && value > upper {
+		if clamp {
+			return upper, nil
+		}
+		return 0, &services.ValidationError{Field: name, Code: "out_of_range", Message: fmt.Sprintf("%s must be at most %d", name, upper)}
+	}
+	return value, nil
+}
+
+// timeRangeParams parses the optional start and end of a period, both inclusive, start can't be after end. a date
+// without a time is a whole day in the tz time zone (UTC by default): start is its first instant and end its last.
+// last is the rolling window up to now instead, it can't be combined with start or end
+func (h *LedgerHandler) timeRangeParams(query url.Values) (start, end *time.Time, verr *services.ValidationError) {
+	if query.Has("last") {
+		if query.Has("start") || query.Has("end") {
+			return nil, nil, &services.ValidationError{Field: "last", Code: "conflicting_range", Message: "last cannot be combined with start and end"}
+		}
+		window, verr := windowParam(query, "last")
+		if verr != nil {
+			return nil, nil, verr
+		}
+		from := h.now().Add(-window)
+		return &from, nil, nil
+	}
+
+	loc, verr := locationParam(query, "tz")
+	if verr != nil {
+		return nil, nil, verr
+	}
+	if start, verr = boundParam(query, "start", loc, false); verr != nil {
+		return nil, nil, verr
+	}
+	if end, verr = boundParam(query, "end", loc, true); verr != nil {
+		return nil, nil, verr
+	}
+	if start != nil && end != nil && start.After(*end) {
+		return nil, nil, &services.ValidationError{Field: "start", Code: "invalid_range", Message: "start time cannot be after end time"}
+	}
+	return start, end, nil
+}
+
+// windowUnits are the units of last on top of Go's durations
+var windowUnits = map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour}
+
+// windowParam parses a positive duration of at most maxLast: Go's units (90m, 24h) or a whole number of days or
+// weeks (7d, 4w)
+func windowParam(query url.Values, name string) (time.Duration, *services.ValidationError) {
+	value := query.Get(name)
+	tooLong := &services.ValidationError{Field: name, Code: "out_of_range", Message: name + " cannot be longer than 5 years"}
+
+	window, err := time.ParseDuration(value)
+	for suffix, unit := range windowUnits {
+		count, ok := strings.CutSuffix(value, suffix)
+		if !ok {
+			continue
+		}
+		n, convErr := strconv.Atoi(count)
+		if convErr == nil && n > int(maxLast/unit) {
+			return 0, tooLong
+		}
+		window, err = time.Duration(n)*unit, convErr
+	}
+	if err != nil {
+		return 0, &services.ValidationError{Field: name, Code: "invalid_duration", Message: "invalid " + name + ", use a duration such as 24h, 7d or 4w"}
+	}
+
+	if window <= 0 {
+		return 0, &services.ValidationError{Field: name, Code: "not_positive", Message: name + " must be positive"}
+	}
+	if window > maxLast {
+		return 0, tooLong
+	}
+	return window, nil
+}
+
+// locationParam loads an optional IANA time zone, UTC when it's absent. Local is refused, the zone of the server
+// means nothing to a client
+func locationParam(query url.Values, name string) (*time.Location, *services.ValidationError) {
+	value := query.Get(name)
+	if value == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(value)
+	if err != nil || value == "Local" {
+		return nil, &services.ValidationError{Field: name, Code: "invalid_timezone", Message: "invalid " + name + ", use an IANA time zone such as Europe/Berlin"}
+	}
+	return loc, nil
+}
+
+// boundParam parses an RFC3339 time or a YYYY-MM-DD date in loc, a date is the first instant of the day or with
+// endOfDay its last nanosecond, which takes the length of the day (23 or 25 hours on a DST change) into account
+func boundParam(query url.Values, name string, loc *time.Location, endOfDay bool) (*time.Time, *services.ValidationError) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	day, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err != nil {
+		return nil, &services.ValidationError{Field: name, Code: "invalid_time", Message: "invalid " + name + " time format, use RFC3339 or YYYY-MM-DD"}
+	}
+	if endOfDay {
+		day = day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return &day, nil
+}
+
+func timeParam(query url.Values, name string) (*time.Time, *services.ValidationError) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, &services.ValidationError{Field: name, Code: "invalid_time", Message: "invalid " + name + " time format, use RFC3339"}
+	}
+	return &t, nil
+}
+
+// amountParam parses an optional non negative amount
+func amountParam(query url.Values, name string) (*float64, *services.ValidationError) {
+	raw := query.Get(name)
+	if raw == "" {
+		return nil, nil
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) {
+		return nil, &services.ValidationError{Field: name, Code: "invalid_number", Message: name + " must be a number"}
+	}
+	if value < 0 {
+		return nil, &services.ValidationError{Field: name, Code: "out_of_range", Message: name + " must be a non negative number"}
+	}
+	return &value, nil
+}
+
+// enumParam returns the value of an optional parameter restricted to allowed, empty when it's absent
+func enumParam(query url.Values, name string, allowed ...string) (string, *services.ValidationError) {
+	value := query.Get(name)
+	if value == "" {
+		return "", nil
+	}
+
+	if !slices.Contains(allowed, value) {
+		return "", &services.ValidationError{
+			Field:   name,
+			Code:    "invalid_value",
+			Message: fmt.Sprintf("invalid %s value, use one of %s", name, strings.Join(allowed, ", ")),
+		}
+	}
+	return value, nil
+}
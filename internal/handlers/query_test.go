@@ -0,0 +1,462 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+func TestHistoryQueryValidation(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 1.0})
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedField string
+		expectedCode  string
+	}{
+		{"page not a number", "page=abc", "page", "invalid_number"},
+		{"negative page", "page=-5", "page", "not_positive"},
+		{"zero pageSize", "pageSize=0", "pageSize", "not_positive"},
+		{"pageSize over the max", "pageSize=5000", "pageSize", "out_of_range"},
+		{"pageSize not a number", "pageSize=1.5", "pageSize", "invalid_number"},
+		{"invalid start", "start=yesterday", "start", "invalid_time"},
+		{"invalid end", "end=2024-13-01T00:00:00Z", "end", "invalid_time"},
+		{"start after end", "start=2024-02-01T00:00:00Z&end=2024-01-01T00:00:00Z", "start", "invalid_range"},
+		{"invalid date", "start=2024-02-30", "start", "invalid_time"},
+		{"date after date", "start=2024-02-02&end=2024-02-01", "start", "invalid_range"},
+		{"unknown time zone", "start=2024-02-01&tz=Mars/Olympus", "tz", "invalid_timezone"},
+		{"server time zone", "start=2024-02-01&tz=Local", "tz", "invalid_timezone"},
+		{"unknown order", "order=sideways", "order", "invalid_value"},
+		{"order is case sensitive", "order=DESC", "order", "invalid_value"},
+		{"unknown type", "type=refund", "type", "invalid_value"},
+		{"invalid includeVoided", "includeVoided=maybe", "includeVoided", "invalid_value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/user1/transactions?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", rr.Code)
+			}
+			var response ErrorResponse
+			_ = json.NewDecoder(rr.Body).Decode(&response)
+			if response.Field != tt.expectedField || response.Code != tt.expectedCode {
+				t.Errorf("expected %s/%s, got %s/%s", tt.expectedField, tt.expectedCode, response.Field, response.Code)
+			}
+		})
+	}
+}
+
+func TestHistoryQueryOrderAndType(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 10.0})
+	postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "withdrawal", "amount": 3.0})
+	postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": 20.0})
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []float64
+	}{
+		{"oldest first by default", "", []float64{10, 3, 20}},
+		{"newest first", "order=desc", []float64{20, 3, 10}},
+		{"deposits only", "type=deposit", []float64{10, 20}},
+		{"newest withdrawals", "type=withdrawal&order=desc", []float64{3}},
+		{"newest first by cursor", "order=desc&limit=2", []float64{20, 3}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/user1/transactions?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			var response struct {
+				Transactions []struct {
+					Amount float64 `json:"amount"`
+				} `json:"transactions"`
+			}
+			_ = json.NewDecoder(rr.Body).Decode(&response)
+			if len(response.Transactions) != len(tt.expected) {
+				t.Fatalf("expected %d transactions, got %d", len(tt.expected), len(response.Transactions))
+			}
+			for i, amount := range tt.expected {
+				if response.Transactions[i].Amount != amount {
+					t.Errorf("expected amount %.2f at %d, got %.2f", amount, i, response.Transactions[i].Amount)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryQueryCursorOrder(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	for i := 0; i < 3; i++ {
+		postJSON(router, "/users/user1/transactions", map[string]interface{}{"type": "deposit", "amount": float64(i + 1)})
+	}
+
+	first := getCursorPage(t, router, "order=desc&limit=1")
+	if first.Pagination.NextCursor == "" {
+		t.Fatalf("expected a next cursor")
+	}
+
+	// the cursor remembers its order
+	second := getCursorPage(t, router, "limit=1&cursor="+first.Pagination.NextCursor)
+	if len(second.Transactions) != 1 || second.Transactions[0].Amount != 2.0 {
+		t.Errorf("expected the walk to continue newest first, got %+v", second.Transactions)
+	}
+
+	req, _ := http.NewRequest("GET", "/users/user1/transactions?order=asc&limit=1&cursor="+first.Pagination.NextCursor, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a cursor of the other order, got %d", rr.Code)
+	}
+}
+
+func TestHistoryQueryPageSizeClamp(t *testing.T) {
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, WithPageSizeClamp()).RegisterRoutes(router, "")
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedSize float64
+	}{
+		{"pageSize over the max is clamped", "pageSize=5000", MaxPageSize},
+		{"limit over the max is clamped", "limit=5000", MaxPageSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/user1/transactions?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d", rr.Code)
+			}
+			var response struct {
+				Pagination map[string]interface{} `json:"pagination"`
+			}
+			_ = json.NewDecoder(rr.Body).Decode(&response)
+			size := response.Pagination["pageSize"]
+			if size == nil {
+				size = response.Pagination["limit"]
+			}
+			if size != tt.expectedSize {
+				t.Errorf("expected the size to be clamped to %v, got %v", tt.expectedSize, size)
+			}
+		})
+	}
+
+	req, _ := http.NewRequest("GET", "/users/user1/transactions?pageSize=0", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a non positive pageSize to still be rejected, got %d", rr.Code)
+	}
+}
+
+func TestHistoryQueryDefaultPageSize(t *testing.T) {
+	ledgerStore := store.NewLedgerStore()
+	for range 5 {
+		if _, err := ledgerStore.AddTransaction("user1", models.Deposit, 10, "seed"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	router := mux.NewRouter()
+	handler := NewLedgerHandler(services.NewLedgerService(ledgerStore), discardLogger, WithDefaultPageSize(3))
+	handler.RegisterRoutes(router, "")
+
+	var page historyResponse
+	if err := json.Unmarshal(serveRequest(router, "GET", "/users/user1/transactions").Body.Bytes(), &page); err != nil {
+		t.Fatalf("could not parse the body: %v", err)
+	}
+	if len(page.Transactions) != 3 || page.Pagination.PageSize != 3 || page.Pagination.TotalPages != 2 {
+		t.Errorf("expected 3 of 5 transactions on the first page, got %d of %+v", len(page.Transactions), page.Pagination)
+	}
+	if rr := serveRequest(router, "GET", "/users/user1/transactions?pageSize=5"); !strings.Contains(rr.Body.String(), `"pageSize":5`) {
+		t.Errorf("expected an explicit pageSize to win, got %s", rr.Body.String())
+	}
+	if !strings.Contains(string(handler.openAPIDocument()), `"default":3`) {
+		t.Error("expected the document to show the configured default")
+	}
+}
+
+func TestTimeRangeParamsDates(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("could not load the time zone: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedStart time.Time
+		expectedEnd   time.Time
+	}{
+		{"UTC by default", "start=2024-03-01&end=2024-03-31",
+			time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 23, 59, 59, 999999999, time.UTC)},
+		{"23 hour day", "start=2024-03-31&end=2024-03-31&tz=Europe/Berlin",
+			time.Date(2024, 3, 30, 23, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 21, 59, 59, 999999999, time.UTC)},
+		{"25 hour day", "start=2024-10-27&end=2024-10-27&tz=Europe/Berlin",
+			time.Date(2024, 10, 26, 22, 0, 0, 0, time.UTC), time.Date(2024, 10, 27, 22, 59, 59, 999999999, time.UTC)},
+		{"date and RFC3339 mixed", "start=2024-03-31T01:30:00Z&end=2024-03-31&tz=Europe/Berlin",
+			time.Date(2024, 3, 31, 1, 30, 0, 0, time.UTC), time.Date(2024, 3, 31, 23, 59, 59, 999999999, berlin)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			start, end, verr := setupTestHandler().timeRangeParams(query)
+			if verr != nil {
+				t.Fatalf("unexpected error: %v", verr)
+			}
+			if !start.Equal(tt.expectedStart) || !end.Equal(tt.expectedEnd) {
+				t.Errorf("expected %v to %v, got %v to %v", tt.expectedStart, tt.expectedEnd, start, end)
+			}
+		})
+	}
+}
+
+func TestHistoryQueryDateRange(t *testing.T) {
+	ledgerStore := store.NewLedgerStore()
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(ledgerStore), discardLogger).RegisterRoutes(router, APIPrefix)
+
+	// every half hour around the spring forward of Europe/Berlin, on 2024-03-31 at 01:00 UTC
+	base := time.Date(2024, 3, 30, 20, 0, 0, 0, time.UTC)
+	for i := range 60 {
+		ledgerStore.AddTransactionWithTime("alice", models.TransactionRecord{
+			ID: uuid.New(), Amount: float64(i + 1), Type: models.Deposit, Timestamp: base.Add(time.Duration(i) * 30 * time.Minute),
+		})
+	}
+
+	amounts := func(query string) []float64 {
+		t.Helper()
+		rr := serveRequest(router, "GET", APIPrefix+"/users/alice/transactions?pageSize=100&"+query)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 for %s, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var response historyResponse
+		_ = json.Unmarshal(rr.Body.Bytes(), &response)
+		result := make([]float64, len(response.Transactions))
+		for i, tx := range response.Transactions {
+			result[i] = tx.Amount
+		}
+		return result
+	}
+
+	byDate := amounts("start=2024-03-31&end=2024-03-31&tz=Europe/Berlin")
+	byTime := amounts("start=2024-03-31T00:00:00%2B01:00&end=2024-03-31T23:59:59.999999999%2B02:00")
+	if len(byDate) != 46 {
+		t.Errorf("expected the 23 hours of the day to hold 46 records, got %d", len(byDate))
+	}
+	if !slices.Equal(byDate, byTime) {
+		t.Errorf("expected the date range to match the RFC3339 range, got %v and %v", byDate, byTime)
+	}
+
+	// without tz the dates are UTC days
+	if utc := amounts("start=2024-03-31&end=2024-03-31"); len(utc) != 48 || utc[0] != 9 {
+		t.Errorf("expected the 48 records of the UTC day from 9, got %v", utc)
+	}
+}
+
+func TestLastWindow(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.UTC)
+	ledgerStore := store.NewLedgerStore()
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(ledgerStore), discardLogger, WithClock(func() time.Time { return now })).RegisterRoutes(router, APIPrefix)
+
+	// a record every 10 hours over the 40 days up to now
+	for i := range 96 {
+		tx := models.TransactionRecord{ID: uuid.New(), Amount: float64(i + 1), Type: models.Deposit, Timestamp: now.Add(-time.Duration(i) * 10 * time.Hour)}
+		if i%3 == 0 {
+			tx.Type = models.Withdrawal
+		}
+		ledgerStore.AddTransactionWithTime("alice", tx)
+	}
+
+	get := func(path string, body any) {
+		t.Helper()
+		rr := serveRequest(router, "GET", APIPrefix+"/users/alice/"+path)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status 200 for %s, got %d: %s", path, rr.Code, rr.Body.String())
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), body); err != nil {
+			t.Fatalf("could not parse the body: %v", err)
+		}
+	}
+
+	windows := map[string]time.Duration{"24h": 24 * time.Hour, "90m": 90 * time.Minute, "7d": 7 * 24 * time.Hour, "4w": 28 * 24 * time.Hour}
+	for last, window := range windows {
+		start := url.QueryEscape(now.Add(-window).Format(time.RFC3339))
+
+		var byLast, byStart historyResponse
+		get("transactions?pageSize=100&last="+last, &byLast)
+		get("transactions?pageSize=100&start="+start, &byStart)
+		if len(byLast.Transactions) == 0 || !reflect.DeepEqual(byLast.Transactions, byStart.Transactions) {
+			t.Errorf("expected the history of last=%s to match the explicit range, got %d and %d records", last, len(byLast.Transactions), len(byStart.Transactions))
+		}
+
+		var totalsByLast, totalsByStart services.PeriodTotals
+		get("totals?last="+last, &totalsByLast)
+		get("totals?start="+start, &totalsByStart)
+		if totalsByLast.Deposits != totalsByStart.Deposits || totalsByLast.Withdrawals != totalsByStart.Withdrawals || !totalsByLast.Start.Equal(*totalsByStart.Start) {
+			t.Errorf("expected the totals of last=%s to match the explicit range, got %+v and %+v", last, totalsByLast, totalsByStart)
+		}
+	}
+
+	invalid := []struct {
+		query        string
+		expectedCode string
+	}{
+		{"last=7d&start=2025-06-01", "conflicting_range"},
+		{"last=24h&end=2025-06-01", "conflicting_range"},
+		{"last=7y", "invalid_duration"},
+		{"last=seven", "invalid_duration"},
+		{"last=", "invalid_duration"},
+		{"last=0d", "not_positive"},
+		{"last=-24h", "not_positive"},
+		{"last=261w", "out_of_range"},
+		{"last=50000h", "out_of_range"},
+		{"last=99999999999999999999d", "invalid_duration"},
+	}
+	for _, tt := range invalid {
+		for _, path := range []string{"transactions", "totals", "transactions/count"} {
+			body := decodeErrorBody(t, serveRequest(router, "GET", APIPrefix+"/users/alice/"+path+"?"+tt.query), http.StatusBadRequest, kindValidationFailed)
+			if body.Field != "last" || body.Code != tt.expectedCode {
+				t.Errorf("expected %s on last for %s?%s, got %s on %s", tt.expectedCode, path, tt.query, body.Code, body.Field)
+			}
+		}
+	}
+}
+
+func TestHistoryQueryFilters(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	for _, tx := range []map[string]interface{}{
+		{"type": "deposit", "amount": 500.0, "description": "salary"},
+		{"type": "withdrawal", "amount": 40.0, "description": "rent share"},
+		{"type": "deposit", "amount": 15.0, "description": "Café crème"},
+		{"type": "withdrawal", "amount": 120.0, "description": "Rent June"},
+		{"type": "deposit", "amount": 60.0, "description": "rent share refund"},
+	} {
+		if rr := postJSON(router, "/users/user1/transactions", tx); rr.Code != http.StatusCreated {
+			t.Fatalf("failed to record %v: %d", tx, rr.Code)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		query         url.Values
+		expected      []float64
+		expectedTotal int
+	}{
+		{"text", url.Values{"q": {"rent"}}, []float64{40, 120, 60}, 3},
+		{"text with a space", url.Values{"q": {"rent share"}}, []float64{40, 60}, 2},
+		{"unicode text", url.Values{"q": {"CAFÉ CRÈME"}}, []float64{15}, 1},
+		{"amount range", url.Values{"minAmount": {"40"}, "maxAmount": {"120"}}, []float64{40, 120, 60}, 3},
+		{"type and amount", url.Values{"type": {"withdrawal"}, "minAmount": {"100"}}, []float64{120}, 1},
+		{"text, type and order", url.Values{"q": {"rent"}, "type": {"withdrawal"}, "order": {"desc"}}, []float64{120, 40}, 2},
+		{"text with a page", url.Values{"q": {"rent"}, "pageSize": {"2"}, "page": {"2"}}, []float64{60}, 3},
+		{"amount with a time range", url.Values{"maxAmount": {"60"}, "start": {time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)}}, []float64{40, 15, 60}, 3},
+		{"nothing matches", url.Values{"q": {"groceries"}}, []float64{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/user1/transactions?"+tt.query.Encode(), nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+			}
+			var response struct {
+				Transactions []struct {
+					Amount float64 `json:"amount"`
+				} `json:"transactions"`
+				Pagination struct {
+					TotalItems int `json:"totalItems"`
+				} `json:"pagination"`
+			}
+			_ = json.NewDecoder(rr.Body).Decode(&response)
+
+			if response.Pagination.TotalItems != tt.expectedTotal {
+				t.Errorf("expected totalItems %d, got %d", tt.expectedTotal, response.Pagination.TotalItems)
+			}
+			if len(response.Transactions) != len(tt.expected) {
+				t.Fatalf("expected %d transactions, got %d", len(tt.expected), len(response.Transactions))
+			}
+			for i, amount := range tt.expected {
+				if response.Transactions[i].Amount != amount {
+					t.Errorf("expected amount %.2f at %d, got %.2f", amount, i, response.Transactions[i].Amount)
+				}
+			}
+		})
+	}
+
+	invalid := []struct {
+		name          string
+		query         string
+		expectedField string
+		expectedCode  string
+	}{
+		{"min above max", "minAmount=100&maxAmount=10", "minAmount", "invalid_range"},
+		{"amount not a number", "maxAmount=lots", "maxAmount", "invalid_number"},
+		{"negative amount", "minAmount=-1", "minAmount", "out_of_range"},
+		{"text too long", "q=" + strings.Repeat("x", 101), "q", "max_length"},
+		{"unknown type with text", "q=rent&type=refund", "type", "invalid_value"},
+	}
+
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/user1/transactions?"+tt.query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("expected status 400, got %d", rr.Code)
+			}
+			var response ErrorResponse
+			_ = json.NewDecoder(rr.Body).Decode(&response)
+			if response.Field != tt.expectedField || response.Code != tt.expectedCode {
+				t.Errorf("expected %s/%s, got %s/%s", tt.expectedField, tt.expectedCode, response.Field, response.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/ratelimit"
+
+	"github.com/gorilla/mux"
+)
+
+// WithRateLimit limits every ledger route per authenticated user, per path userId without auth and per client IP
+// for the routes that name no user
+func WithRateLimit(limiter *ratelimit.Limiter) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.limiter = limiter
+	}
+}
+
+func (h *LedgerHandler) rateLimit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		decision := h.limiter.Allow(rateLimitKey(r))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+
+		if !decision.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+			sendError(w, r, http.StatusTooManyRequests, ErrorResponse{Error: "rate limit exceeded", Code: "rate_limited"})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ceilSeconds rounds up, a client that waits the advertised seconds never comes back too early
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// rateLimitKey is the budget the request is counted against, the same user in two tenants has two
+func rateLimitKey(r *http.Request) string {
+	if tenant := tenantOf(r.Context()); tenant != "" {
+		return tenant + "/" + userRateLimitKey(r)
+	}
+	return userRateLimitKey(r)
+}
+
+func userRateLimitKey(r *http.Request) string {
+	if principal, ok := auth.PrincipalFrom(r.Context()); ok {
+		return "user:" + principal.Subject
+	}
+	if userId := mux.Vars(r)["userId"]; userId != "" {
+		return "user:" + userId
+	}
+	return "ip:" + clientIP(r)
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/ratelimit"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := ratelimit.New(1, 2, ratelimit.WithClock(func() time.Time { return now }))
+
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, WithRateLimit(limiter)).RegisterRoutes(router, "")
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		rr := get("/users/user1/balance")
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected request %d to succeed, got %d", i+1, rr.Code)
+		}
+		if rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Remaining") != remaining {
+			t.Errorf("expected limit 2 and %s remaining, got %s and %s", remaining,
+				rr.Header().Get("RateLimit-Limit"), rr.Header().Get("RateLimit-Remaining"))
+		}
+	}
+
+	rr := get("/users/user1/balance")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 past the burst, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", rr.Header().Get("Retry-After"))
+	}
+	var body ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || body.Code != "rate_limited" {
+		t.Errorf("expected the rate_limited error body, got %+v", body)
+	}
+
+	if rr := get("/users/user2/balance"); rr.Code != http.StatusOK {
+		t.Errorf("expected another user to have its own limit, got %d", rr.Code)
+	}
+
+	now = now.Add(time.Second)
+	if rr := get("/users/user1/balance"); rr.Code != http.StatusOK {
+		t.Errorf("expected the request to succeed after the window, got %d", rr.Code)
+	}
+}
+
+func TestRateLimitHeadersCountDown(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := ratelimit.New(2, 5, ratelimit.WithClock(func() time.Time { return now }))
+
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, WithRateLimit(limiter)).RegisterRoutes(router, "")
+
+	assertHeaders := func(rr *httptest.ResponseRecorder, remaining, reset string) {
+		t.Helper()
+		if got := rr.Header().Get("RateLimit-Limit"); got != "5" {
+			t.Errorf("expected limit 5, got %q", got)
+		}
+		if got := rr.Header().Get("RateLimit-Remaining"); got != remaining {
+			t.Errorf("expected %s remaining, got %q", remaining, got)
+		}
+		if got := rr.Header().Get("RateLimit-Reset"); got != reset {
+			t.Errorf("expected a reset in %s seconds, got %q", reset, got)
+		}
+	}
+
+	// 2 tokens a second refill the bucket of 5 half a second per spent token, rounded up
+	burst := []struct {
+		rr        *httptest.ResponseRecorder
+		status    int
+		remaining string
+		reset     string
+	}{
+		{postJSON(router, "/users/user1/transactions", transactionRequest{TransactionType: "deposit", Amount: 10}), http.StatusCreated, "4", "1"},
+		{serveRequest(router, "GET", "/users/user1/balance"), http.StatusOK, "3", "1"},
+		{postJSON(router, "/users/user1/transactions", transactionRequest{TransactionType: "withdrawal", Amount: 50}), http.StatusUnprocessableEntity, "2", "2"},
+		{serveRequest(router, "GET", "/users/user1/transactions/"+uuid.NewString()), http.StatusNotFound, "1", "2"},
+		{serveRequest(router, "GET", "/users/user1/transactions"), http.StatusOK, "0", "3"},
+	}
+	for i, step := range burst {
+		if step.rr.Code != step.status {
+			t.Fatalf("expected status %d for request %d, got %d", step.status, i+1, step.rr.Code)
+		}
+		assertHeaders(step.rr, step.remaining, step.reset)
+		if step.rr.Header().Get("Retry-After") != "" {
+			t.Errorf("expected no Retry-After on request %d", i+1)
+		}
+	}
+
+	rr := serveRequest(router, "GET", "/users/user1/balance")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status 429 past the burst, got %d", rr.Code)
+	}
+	assertHeaders(rr, "0", "3")
+	if rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1, got %q", rr.Header().Get("Retry-After"))
+	}
+
+	now = now.Add(time.Second)
+	rr = serveRequest(router, "GET", "/users/user1/balance")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected the request to succeed after the retry delay, got %d", rr.Code)
+	}
+	assertHeaders(rr, "1", "2")
+}
+
+func TestRateLimitKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		expected   string
+	}{
+		{name: "path user", path: "/users/user1/balance", remoteAddr: "10.0.0.1:1234", expected: "user:user1"},
+		{name: "no user in the path", path: "/users", remoteAddr: "10.0.0.1:1234", expected: "ip:10.0.0.1"},
+		{name: "IPv6 client", path: "/users", remoteAddr: "[::1]:1234", expected: "ip:::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			router := mux.NewRouter()
+			handler := func(w http.ResponseWriter, r *http.Request) { got = rateLimitKey(r) }
+			router.HandleFunc("/users/{userId}/balance", handler)
+			router.HandleFunc("/users", handler)
+
+			req := httptest.NewRequest("GET", tt.path, nil)
+			req.RemoteAddr = tt.remoteAddr
+			router.ServeHTTP(httptest.NewRecorder(), req)
+
+			if got != tt.expected {
+				t.Errorf("expected key %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/errreport"
+)
+
+// RecoveryMiddleware turns a panic in a handler into the standard JSON 500, logs the stack with the request ID and
+// reports the panic to the reporter of ErrorReportMiddleware. http.ErrAbortHandler is re-panicked, it's how a handler asks net/http to abort the response
+func RecoveryMiddleware(logger *slog.Logger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				stack := string(debug.Stack())
+				logger.ErrorContext(r.Context(), "panic serving request",
+					"request_id", RequestID(r.Context()),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"panic", recovered,
+					"stack", stack,
+				)
+				reportError(r, errreport.KindPanic, http.StatusInternalServerError, fmt.Sprint(recovered), stack)
+				writeError(w, r, http.StatusInternalServerError, ErrorResponse{Error: internalErrorMessage})
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
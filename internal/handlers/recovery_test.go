@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/errreport/errreporttest"
+)
+
+func setupPanickingRouter(logs *bytes.Buffer, panicValue interface{}) *mux.Router {
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware, RecoveryMiddleware(slog.New(slog.NewJSONHandler(logs, nil))))
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic(panicValue)
+	})
+	router.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return router
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	router := setupPanickingRouter(&logs, "boom")
+
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	req.Header.Set(RequestIDHeader, "req-1")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected status 500, got %d", rr.Code)
+	}
+	if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Errorf("expected a JSON body, got Content-Type %q", contentType)
+	}
+
+	var body ErrorResponse
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode the error body: %v", err)
+	}
+	if body.Details.Code != kindInternal || body.RequestID != "req-1" {
+		t.Errorf("unexpected error body: %+v", body)
+	}
+
+	if !strings.Contains(logs.String(), `"request_id":"req-1"`) || !strings.Contains(logs.String(), `"stack"`) {
+		t.Errorf("expected the stack logged with the request ID, got %s", logs.String())
+	}
+
+	req, _ = http.NewRequest("GET", "/ok", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected the router to keep serving, got status %d", rr.Code)
+	}
+}
+
+func TestRecoveryMiddlewareAbortHandler(t *testing.T) {
+	var logs bytes.Buffer
+	router := setupPanickingRouter(&logs, http.ErrAbortHandler)
+
+	defer func() {
+		if recovered := recover(); recovered != http.ErrAbortHandler {
+			t.Errorf("expected http.ErrAbortHandler to be re-panicked, got %v", recovered)
+		}
+	}()
+
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	t.Errorf("expected the panic to propagate")
+}
+
+func TestRecoveryMiddlewareReportsThePanic(t *testing.T) {
+	reporter := &errreporttest.Reporter{}
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware, ErrorReportMiddleware(reporter), RecoveryMiddleware(discardLogger))
+	router.HandleFunc("/users/{userId}/transactions", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}).Methods("POST")
+	router.HandleFunc("/users/{userId}/balance", func(w http.ResponseWriter, r *http.Request) {
+		sendErrorResponse(w, r, http.StatusInternalServerError, "store unavailable")
+	})
+
+	req := httptest.NewRequest("POST", "/users/alice/transactions?description=rent", strings.NewReader(`{"amount":950,"description":"rent"}`))
+	req.Header.Set(RequestIDHeader, "req-1")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	reports := reporter.Reports()
+	if len(reports) != 1 {
+		t.Fatalf("expected exactly one report, got %+v", reports)
+	}
+	report := reports[0]
+	expectedTags := map[string]string{"request_id": "req-1", "route": "/users/{userId}/transactions", "method": "POST", "status": "500"}
+	if report.Kind != errreport.KindPanic || report.Message != "boom" || !maps.Equal(report.Tags, expectedTags) || report.Stack == "" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	for _, leaked := range []string{"alice", "rent", "950"} {
+		if strings.Contains(fmt.Sprint(report.Tags), leaked) {
+			t.Errorf("expected %q kept out of the report, got %v", leaked, report.Tags)
+		}
+	}
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/alice/balance", nil))
+	reports = reporter.Reports()
+	if len(reports) != 2 || reports[1].Kind != errreport.KindInternal || reports[1].Message != "store unavailable" ||
+		reports[1].Tags["route"] != "/users/{userId}/balance" {
+		t.Errorf("expected the 500 reported, got %+v", reports)
+	}
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// ConfigReload is what a reload of the config changed: Applied is in effect already, RequiresRestart only takes
+// effect after a restart. both name the settings as config.Config.Changes does
+type ConfigReload struct {
+	Applied         []string `json:"applied"`
+	RequiresRestart []string `json:"requiresRestart"`
+}
+
+// WithConfigReload mounts POST <prefix>/admin/config/reload, which calls reload. it's an admin route, only mounted
+// with WithAdmin too. an error of reload is an invalid new config that wasn't applied
+func WithConfigReload(reload func() (ConfigReload, error)) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.reload = reload
+	}
+}
+
+// registerConfigReload mounts the reload apart from the other admin routes, the config is the server's and not the
+// one of a tenant
+func (h *LedgerHandler) registerConfigReload(r *mux.Router, prefix string) {
+	reload := r.PathPrefix(prefix + "/admin/config").Subrouter()
+	reload.Use(h.authenticateAdmin)
+	if h.strictQuery {
+		reload.Use(h.rejectUnknownQuery(prefix))
+	}
+	reload.HandleFunc("/reload", h.handleConfigReload).Methods("POST")
+}
+
+func (h *LedgerHandler) handleConfigReload(w http.ResponseWriter, r *http.Request) {
+	result, err := h.reload()
+	if err != nil {
+		h.audit(r, "config.reload_failed", "error", err)
+		sendError(w, r, http.StatusUnprocessableEntity, ErrorResponse{Error: err.Error(), Code: "invalid_config"})
+		return
+	}
+
+	h.audit(r, "config.reloaded", "applied", result.Applied, "requires_restart", result.RequiresRestart)
+	sendJSONResponse(w, r, http.StatusOK, result)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware)
+	handler.RegisterRoutes(router, "")
+
+	tests := []struct {
+		name       string
+		suppliedID string
+		expectSame bool
+	}{
+		{name: "supplied ID round-trips", suppliedID: "client-req.42:a_b", expectSame: true},
+		{name: "missing ID is generated", suppliedID: ""},
+		{name: "ID with spaces is replaced", suppliedID: "bad id"},
+		{name: "ID with a newline is replaced", suppliedID: "abc\ninjected: 1"},
+		{name: "ID that's too long is replaced", suppliedID: strings.Repeat("a", 129)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/users/unknown/transactions/not-a-uuid", nil)
+			if tt.suppliedID != "" {
+				req.Header.Set(RequestIDHeader, tt.suppliedID)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			got := rr.Header().Get(RequestIDHeader)
+			if tt.expectSame {
+				if got != tt.suppliedID {
+					t.Errorf("expected request ID %q, got %q", tt.suppliedID, got)
+				}
+			} else if _, err := uuid.Parse(got); err != nil {
+				t.Errorf("expected a generated UUID, got %q", got)
+			}
+
+			var body ErrorResponse
+			if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+				t.Fatalf("failed to decode the error body: %v", err)
+			}
+			if body.RequestID != got {
+				t.Errorf("expected requestId %q in the error body, got %q", got, body.RequestID)
+			}
+		})
+	}
+}
+
+func TestRequestIDWithoutMiddleware(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	req, _ := http.NewRequest("GET", "/users/unknown/transactions/not-a-uuid", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if strings.Contains(rr.Body.String(), "requestId") {
+		t.Errorf("expected no requestId without the middleware, got %s", rr.Body.String())
+	}
+}
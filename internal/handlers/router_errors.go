@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// notFoundHandler answers paths no route matches with the standard error JSON instead of mux's plain text
+func notFoundHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sendErrorResponse(w, r, http.StatusNotFound, "no route for "+r.URL.Path)
+	})
+}
+
+// methodNotAllowedHandler answers a known path with the wrong method, Allow lists the methods registered for the path
+func methodNotAllowedHandler(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := allowedMethods(router, r.URL.Path)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		sendErrorResponse(w, r, http.StatusMethodNotAllowed, "method "+r.Method+" not allowed on "+r.URL.Path)
+	})
+}
+
+func allowedMethods(router *mux.Router, path string) []string {
+	seen := make(map[string]bool)
+	_ = router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		// mux anchors the path regexp, a match is a match of the whole path
+		pattern, err := route.GetPathRegexp()
+		if err != nil {
+			return nil
+		}
+		if matched, err := regexp.MatchString(pattern, path); err != nil || !matched {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			seen[method] = true
+		}
+		return nil
+	})
+
+	allowed := make([]string, 0, len(seen))
+	for method := range seen {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+	return allowed
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRouterErrors(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, "")
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		expectedStatus int
+		expectedKind   string
+		expectedAllow  string
+	}{
+		{name: "unknown path", method: "GET", path: "/nope", expectedStatus: http.StatusNotFound, expectedKind: kindNotFound},
+		{name: "unknown nested path", method: "GET", path: "/users/x/unknown", expectedStatus: http.StatusNotFound, expectedKind: kindNotFound},
+		{name: "PUT on balance", method: "PUT", path: "/users/x/balance", expectedStatus: http.StatusMethodNotAllowed, expectedKind: kindMethodNotAllowed, expectedAllow: "GET"},
+		{name: "DELETE on transactions", method: "DELETE", path: "/users/x/transactions", expectedStatus: http.StatusMethodNotAllowed, expectedKind: kindMethodNotAllowed, expectedAllow: "GET, HEAD, POST"},
+		{name: "GET on transfers", method: "GET", path: "/users/x/transfers", expectedStatus: http.StatusMethodNotAllowed, expectedKind: kindMethodNotAllowed, expectedAllow: "POST"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest(tt.method, tt.path, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if contentType := rr.Header().Get("Content-Type"); contentType != "application/json" {
+				t.Errorf("expected a JSON body, got Content-Type %q", contentType)
+			}
+			if allow := rr.Header().Get("Allow"); allow != tt.expectedAllow {
+				t.Errorf("expected Allow %q, got %q", tt.expectedAllow, allow)
+			}
+
+			decodeErrorBody(t, rr, tt.expectedStatus, tt.expectedKind)
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// the plumbing of the tests that need the internals of the package, the others go through apitest
+
+func setupTestHandler() *LedgerHandler {
+	ledgerStore := store.NewLedgerStore()
+	ledgerService := services.NewLedgerService(ledgerStore)
+	return NewLedgerHandler(ledgerService, discardLogger)
+}
+
+func serveRequest(router *mux.Router, method, target string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, target, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func postJSON(router *mux.Router, path string, body interface{}) *httptest.ResponseRecorder {
+	jsonBody, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(jsonBody))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"tiny-ledger/internal/signing"
+)
+
+// WithSignedRequests requires every ledger request to carry an HMAC signature of a known server-to-server client,
+// on top of the bearer token when WithAuth is set too
+func WithSignedRequests(verifier *signing.Verifier) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.signatures = verifier
+	}
+}
+
+// verifySignature runs after limitBody, so a body over the limit is answered 413 before it's buffered whole
+func (h *LedgerHandler) verifySignature(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client, err := h.signatures.Verify(r)
+		if err != nil {
+			response := ErrorResponse{Error: "invalid request signature", Code: "invalid_signature"}
+			switch {
+			case errors.Is(err, signing.ErrMissingSignature):
+				response = ErrorResponse{Error: "request signature required", Code: "signature_required"}
+			case errors.Is(err, signing.ErrStaleSignature):
+				response = ErrorResponse{Error: "request signature timestamp is too old or in the future", Code: "signature_expired"}
+			case !errors.Is(err, signing.ErrInvalidSignature):
+				h.sendDecodeError(w, r, decodeError(err))
+				return
+			}
+			h.requestLogger(r).InfoContext(r.Context(), "signature verification failed", "client", r.Header.Get(signing.ClientHeader), "error", err)
+			sendError(w, r, http.StatusUnauthorized, response)
+			return
+		}
+
+		h.requestLogger(r).DebugContext(r.Context(), "signed request", "client", client)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/signing"
+	"tiny-ledger/internal/store"
+)
+
+func TestSignedRequests(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	secret := []byte("partner-secret")
+	verifier, err := signing.NewVerifier(map[string][]byte{"partner": secret}, signing.WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, WithSignedRequests(verifier)).RegisterRoutes(router, APIPrefix)
+
+	const target = APIPrefix + "/users/alice/transactions"
+	const body = `{"type":"deposit","amount":10}`
+	signed := func(signedAt time.Time) *http.Request {
+		req := httptest.NewRequest("POST", target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if err := signing.SignRequest(req, "partner", secret, signedAt); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return req
+	}
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// the handler still reads the body the signature check buffered
+	if rr := serve(signed(now.Add(-time.Minute))); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	tampered := signed(now)
+	tampered.Body = io.NopCloser(strings.NewReader(strings.Replace(body, "10", "1000", 1)))
+	unsigned := httptest.NewRequest("GET", APIPrefix+"/users/alice/balance", nil)
+
+	tests := []struct {
+		name         string
+		req          *http.Request
+		expectedCode string
+	}{
+		{"Stale", signed(now.Add(-6 * time.Minute)), "signature_expired"},
+		{"Tampered body", tampered, "invalid_signature"},
+		{"Unsigned", unsigned, "signature_required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := decodeErrorBody(t, serve(tt.req), http.StatusUnauthorized, kindUnauthorized)
+			if body.Code != tt.expectedCode {
+				t.Errorf("expected code %s, got %+v", tt.expectedCode, body)
+			}
+		})
+	}
+
+	balance := httptest.NewRequest("GET", APIPrefix+"/users/alice/balance", nil)
+	if err := signing.SignRequest(balance, "partner", secret, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rr := serve(balance); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"balance":10`) {
+		t.Errorf("expected the balance of the one signed deposit, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+)
+
+// handleStatement serves the monthly statement as JSON, or as a CSV attachment for Accept: text/csv
+func (h *LedgerHandler) handleStatement(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["userId"]
+
+	year, err := strconv.Atoi(vars["year"])
+	if err != nil {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "year", Code: "invalid_value", Message: "year must be a number, e.g. 2024"})
+		return
+	}
+	month, err := strconv.Atoi(vars["month"])
+	if err != nil {
+		h.sendValidationError(w, r, &services.ValidationError{Field: "month", Code: "invalid_value", Message: "month must be a number from 1 to 12"})
+		return
+	}
+
+	statement, err := h.ledger(r).GetMonthlyStatement(userId, year, month)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+
+	if !wantsCSV(r) {
+		sendJSONResponse(w, r, http.StatusOK, statement)
+		return
+	}
+
+	// a statement is at most a month of records, it's rendered before the status goes out so a failure is still a 500
+	var buf bytes.Buffer
+	if err := statement.WriteCSV(&buf); err != nil {
+		h.sendInternalError(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", csvContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="statement-%s-%04d-%02d.csv"`, userId, year, month))
+	w.WriteHeader(http.StatusOK)
+	_, _ = buf.WriteTo(w)
+}
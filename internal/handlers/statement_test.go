@@ -0,0 +1,109 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/apitest"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+)
+
+// setupStatementServer gives alice a March 2024 of deposits in the first half and withdrawals in the second, after a
+// February opening deposit
+func setupStatementServer(t *testing.T) *apitest.Server {
+	t.Helper()
+
+	s := apitest.NewTestServer()
+	add := func(txType models.TransactionType, amount float64, month time.Month, day int) {
+		s.Store.AddTransactionWithTime("alice", models.TransactionRecord{
+			ID: uuid.New(), Type: txType, Amount: amount, Timestamp: time.Date(2024, month, day, 9, 0, 0, 0, time.UTC),
+		})
+	}
+	add(models.Deposit, 100, time.February, 20)
+	for day := 1; day <= 15; day += 2 {
+		add(models.Deposit, 40, time.March, day)
+	}
+	for day := 16; day <= 31; day += 3 {
+		add(models.Withdrawal, 55, time.March, day)
+	}
+	add(models.Withdrawal, 10, time.April, 1)
+	return s
+}
+
+func TestHandleStatement(t *testing.T) {
+	s := setupStatementServer(t)
+
+	var statement services.MonthlyStatement
+	s.Do(t, "GET", "/users/alice/statements/2024/03", nil).Expect(t, http.StatusOK).Decode(t, &statement)
+
+	// 8 deposits of 40 then 6 withdrawals of 55 on top of the opening 100
+	if statement.OpeningBalance != 100 || statement.ClosingBalance != 90 {
+		t.Errorf("expected balances 100 to 90, got %v to %v", statement.OpeningBalance, statement.ClosingBalance)
+	}
+	if statement.Deposits.Count != 8 || statement.Deposits.Total != 320 || statement.Withdrawals.Count != 6 || statement.Withdrawals.Total != 330 {
+		t.Errorf("unexpected subtotals: %+v %+v", statement.Deposits, statement.Withdrawals)
+	}
+	if len(statement.Transactions) != 14 {
+		t.Fatalf("expected the 14 records of March, got %d", len(statement.Transactions))
+	}
+	// the balance peaks at the end of the deposits and runs down from there
+	if peak := statement.Transactions[7].RunningBalance; peak != 420 {
+		t.Errorf("expected a running balance of 420 after the last deposit, got %v", peak)
+	}
+	if last := statement.Transactions[13].RunningBalance; last != statement.ClosingBalance {
+		t.Errorf("expected the last running balance to be the closing balance, got %v", last)
+	}
+
+	// a month before the account existed is empty, not a 404
+	empty := string(s.Do(t, "GET", "/users/alice/statements/2023/12", nil).Expect(t, http.StatusOK).Body)
+	if !strings.Contains(empty, `"openingBalance":0,"closingBalance":0`) || !strings.Contains(empty, `"transactions":[]`) {
+		t.Errorf("expected an empty statement, got %s", empty)
+	}
+}
+
+func TestHandleStatementCSV(t *testing.T) {
+	s := setupStatementServer(t)
+
+	resp := s.GetAccepting(t, "/users/alice/statements/2024/3", "text/csv")
+	if resp.Status != http.StatusOK || resp.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Fatalf("expected a CSV, got %d %s", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="statement-alice-2024-03.csv"` {
+		t.Errorf("unexpected Content-Disposition: %s", got)
+	}
+	lines := strings.Split(strings.TrimSpace(string(resp.Body)), "\n")
+	if len(lines) != 17 || !strings.HasSuffix(lines[1], ",100.00") || !strings.Contains(lines[16], "closing_balance") || !strings.HasSuffix(lines[16], ",90.00") {
+		t.Errorf("expected a header, the balances and 14 rows, got:\n%s", resp.Body)
+	}
+}
+
+func TestHandleStatementValidation(t *testing.T) {
+	s := setupStatementServer(t)
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedField string
+	}{
+		{"Month 13", "/users/alice/statements/2024/13", "month"},
+		{"Month 0", "/users/alice/statements/2024/0", "month"},
+		{"Month not a number", "/users/alice/statements/2024/march", "month"},
+		{"Year too early", "/users/alice/statements/1900/1", "year"},
+		{"Year too late", "/users/alice/statements/3000/1", "year"},
+		{"Year not a number", "/users/alice/statements/last/1", "year"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := s.Do(t, "GET", tt.path, nil).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+			if body.Field != tt.expectedField {
+				t.Errorf("expected field %s, got %s", tt.expectedField, body.Field)
+			}
+		})
+	}
+}
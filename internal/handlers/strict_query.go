@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+)
+
+// WithStrictQuery rejects GET and HEAD requests with query parameters their route doesn't take, on the APIPrefix
+// mount (and the admin routes) when versioned is set and on the legacy paths when legacy is. a misspelt parameter is
+// otherwise silently ignored. NewLedgerHandler turns it on for the versioned mount only
+func WithStrictQuery(versioned, legacy bool) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.strictQuery = versioned
+		h.strictLegacyQuery = legacy
+	}
+}
+
+// queryParameters are the query parameters of every documented operation by method and unprefixed path, the
+// OpenAPI document is the one list of what a route takes
+var queryParameters = sync.OnceValue(func() map[string][]string {
+	params := map[string][]string{}
+	for _, op := range apiOperations() {
+		key := op.method + " " + op.path
+		params[key] = []string{}
+		for _, p := range op.params {
+			if p.in == "query" {
+				params[key] = append(params[key], p.name)
+			}
+		}
+	}
+	return params
+})
+
+// refusedParameters are taken by a route only to reject them with a message of its own, which says more than
+// unknown_parameter would
+var refusedParameters = map[string][]string{
+	"GET /users/{userId}/transactions/count":  {"page", "pageSize", "cursor", "limit"},
+	"GET /users/{userId}/transactions/export": {"page", "pageSize", "cursor", "limit"},
+}
+
+// rejectUnknownQuery answers 400 for query parameters the route doesn't document, each with the closest valid name
+// when one is near enough to be a typo. repeating a known parameter is fine
+func (h *LedgerHandler) rejectUnknownQuery(prefix string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || r.URL.RawQuery == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			template, err := route.GetPathTemplate()
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key := r.Method + " " + strings.TrimPrefix(template, prefix)
+			known, documented := queryParameters()[key]
+			if !documented {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var unknown []FieldError
+			for _, name := range slices.Sorted(maps.Keys(r.URL.Query())) {
+				if slices.Contains(known, name) || slices.Contains(refusedParameters[key], name) {
+					continue
+				}
+				field := FieldError{Field: name, Code: "unknown_parameter", Message: fmt.Sprintf("unknown query parameter %q", name)}
+				if field.Suggestion = closestName(name, known); field.Suggestion != "" {
+					field.Message += fmt.Sprintf(", did you mean %q?", field.Suggestion)
+				}
+				unknown = append(unknown, field)
+			}
+			if len(unknown) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			names := make([]string, len(unknown))
+			for i, field := range unknown {
+				names[i] = field.Field
+			}
+			h.requestLogger(r).WarnContext(r.Context(), "unknown query parameters", "parameters", names)
+
+			message := unknown[0].Message
+			if len(unknown) > 1 {
+				message = "unknown query parameters: " + strings.Join(names, ", ")
+			}
+			sendError(w, r, http.StatusBadRequest, ErrorResponse{
+				Error:   message,
+				Code:    "unknown_parameter",
+				Field:   unknown[0].Field,
+				Details: ErrorDetails{Fields: unknown},
+			})
+		})
+	}
+}
+
+// closestName is the candidate with the smallest case-insensitive edit distance to name, empty when even that one
+// differs in more than half of name
+func closestName(name string, candidates []string) string {
+	best, bestDistance := "", len(name)/2+1
+	for _, candidate := range candidates {
+		if distance := editDistance(strings.ToLower(name), strings.ToLower(candidate)); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best
+}
+
+// editDistance is the Levenshtein distance of a and b in bytes, query parameter names are ASCII
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,20 @@
+package handlers
+
+import "testing"
+
+func TestClosestName(t *testing.T) {
+	known := []string{"start", "end", "page", "pageSize", "limit", "q"}
+	tests := map[string]string{
+		"page_size": "pageSize",
+		"PAGE":      "page",
+		"strat":     "start",
+		"qq":        "q",
+		"offset":    "",
+		"x":         "",
+	}
+	for name, expected := range tests {
+		if suggestion := closestName(name, known); suggestion != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, suggestion)
+		}
+	}
+}
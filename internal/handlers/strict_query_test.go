@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/apitest"
+	"tiny-ledger/internal/handlers"
+)
+
+// setupStrictQueryServer mounts the versioned and the legacy routes, opts decide which of them are strict
+func setupStrictQueryServer(t *testing.T, opts ...handlers.HandlerOption) *apitest.Server {
+	t.Helper()
+
+	s := apitest.NewTestServer(apitest.WithLegacyRoutes(time.Now().AddDate(0, 6, 0)), apitest.WithHandlerOptions(opts...))
+	s.PostTransaction(t, "alice", apitest.TransactionRequest{Type: "deposit", Amount: 10, Description: "salary"})
+	return s
+}
+
+// getPath reads path as is, the legacy paths aren't under Prefix
+func getPath(t *testing.T, s *apitest.Server, path string) apitest.Response {
+	t.Helper()
+	return s.Serve(t, httptest.NewRequest("GET", path, nil))
+}
+
+func TestStrictQueryTypo(t *testing.T) {
+	s := setupStrictQueryServer(t)
+
+	body := s.Do(t, "GET", "/users/alice/transactions?page_size=5", nil).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+	if body.Code != "unknown_parameter" || body.Field != "page_size" {
+		t.Errorf("expected unknown_parameter on page_size, got %s on %s", body.Code, body.Field)
+	}
+	if len(body.Details.Fields) != 1 || body.Details.Fields[0].Suggestion != "pageSize" {
+		t.Fatalf("expected pageSize to be suggested, got %+v", body.Details.Fields)
+	}
+	if body.Error != `unknown query parameter "page_size", did you mean "pageSize"?` {
+		t.Errorf("unexpected message %q", body.Error)
+	}
+}
+
+func TestStrictQueryLists(t *testing.T) {
+	s := setupStrictQueryServer(t)
+
+	body := s.Do(t, "GET", "/users/alice/balance?verbose=1&At=2025-01-01T00:00:00Z", nil).Error(t, http.StatusBadRequest, "VALIDATION_FAILED")
+	if len(body.Details.Fields) != 2 {
+		t.Fatalf("expected both parameters to be listed, got %+v", body.Details.Fields)
+	}
+	// sorted by name, the case of a name counts but not for the suggestion
+	if at := body.Details.Fields[0]; at.Field != "At" || at.Suggestion != "at" {
+		t.Errorf("expected At with the suggestion at, got %+v", at)
+	}
+	if verbose := body.Details.Fields[1]; verbose.Field != "verbose" || verbose.Suggestion != "" {
+		t.Errorf("expected verbose without a suggestion, got %+v", verbose)
+	}
+	if body.Error != "unknown query parameters: At, verbose" {
+		t.Errorf("unexpected message %q", body.Error)
+	}
+}
+
+func TestStrictQueryAccepts(t *testing.T) {
+	s := setupStrictQueryServer(t)
+
+	paths := []string{
+		handlers.APIPrefix + "/users/alice/transactions?fields=amount&fields=timestamp",
+		handlers.APIPrefix + "/users/alice/transactions?start=2020-01-01T00:00:00Z&end=2030-01-01T00:00:00Z&type=deposit&pageSize=5",
+		handlers.APIPrefix + "/users/alice/transactions?limit=5",
+		handlers.APIPrefix + "/users/alice/balance?at=2030-01-01T00:00:00Z",
+		handlers.APIPrefix + "/users/alice/summary",
+		// the legacy paths aren't strict by default
+		"/users/alice/transactions?page_size=5",
+	}
+	for _, path := range paths {
+		if resp := getPath(t, s, path); resp.Status != http.StatusOK {
+			t.Errorf("%s: expected status 200, got %d: %s", path, resp.Status, resp.Body)
+		}
+	}
+
+	// only reads are checked
+	resp := s.Do(t, "POST", "/users/alice/transactions?page_size=5", apitest.TransactionRequest{Type: "deposit", Amount: 1})
+	if resp.Status != http.StatusCreated {
+		t.Errorf("expected a write to ignore the query, got %d: %s", resp.Status, resp.Body)
+	}
+}
+
+func TestStrictQueryConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		versioned bool
+		legacy    bool
+	}{
+		{"Disabled", false, false},
+		{"Legacy only", false, true},
+		{"Both", true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := setupStrictQueryServer(t, handlers.WithStrictQuery(tt.versioned, tt.legacy))
+			for path, strict := range map[string]bool{handlers.APIPrefix: tt.versioned, "": tt.legacy} {
+				expected := http.StatusOK
+				if strict {
+					expected = http.StatusBadRequest
+				}
+				if resp := getPath(t, s, path+"/users/alice/transactions?page_size=5"); resp.Status != expected {
+					t.Errorf("%q: expected status %d, got %d", path, expected, resp.Status)
+				}
+			}
+		})
+	}
+}
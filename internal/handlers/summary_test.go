@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+// assertGolden compares the body with testdata/name, go test -update rewrites the file instead
+func assertGolden(t *testing.T, name string, body []byte) {
+	t.Helper()
+
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, body, "", "  "); err != nil {
+		t.Fatalf("the body isn't JSON: %v", err)
+	}
+	compareGolden(t, name, indented.Bytes())
+}
+
+// compareGolden is assertGolden for a body that's already indented
+func compareGolden(t *testing.T, name string, body []byte) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name)
+	if *updateGolden {
+		if err := os.WriteFile(path, body, 0o644); err != nil {
+			t.Fatalf("could not update %s: %v", path, err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("could not read %s: %v", path, err)
+	}
+	if !bytes.Equal(expected, body) {
+		t.Errorf("the body differs from %s, run go test -update if the change is intended\ngot:\n%s", path, body)
+	}
+}
+
+func TestHandleSummary(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, APIPrefix)
+
+	postJSON(router, APIPrefix+"/users/alice/transactions", transactionRequest{TransactionType: "deposit", Amount: 200})
+	postJSON(router, APIPrefix+"/users/alice/transactions", transactionRequest{TransactionType: "deposit", Amount: 50})
+	postJSON(router, APIPrefix+"/users/alice/transactions", transactionRequest{TransactionType: "withdrawal", Amount: 80})
+	rr := postJSON(router, APIPrefix+"/users/alice/transactions", transactionRequest{TransactionType: "withdrawal", Amount: 20})
+	var withdrawal transactionResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &withdrawal)
+
+	// the reversal of the 20 withdrawal is a deposit of 20
+	if rr := postJSON(router, APIPrefix+"/users/alice/transactions/"+withdrawal.ID.String()+"/reversal", reversalRequest{Reason: "refund"}); rr.Code != http.StatusCreated {
+		t.Fatalf("expected the reversal to be recorded, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveRequest(router, "GET", APIPrefix+"/users/alice/summary")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var summary services.AccountSummary
+	if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil {
+		t.Fatalf("could not parse the summary: %v", err)
+	}
+	if !summary.Exists || summary.Balance != 170 || summary.TotalDeposits != 270 || summary.TotalWithdrawals != 100 {
+		t.Errorf("unexpected totals: %+v", summary)
+	}
+	if summary.TransactionCount != 5 || summary.DepositCount != 3 || summary.WithdrawalCount != 2 {
+		t.Errorf("unexpected counts: %+v", summary)
+	}
+	if summary.FirstActivity == nil || summary.LastActivity == nil || summary.LastActivity.Before(*summary.FirstActivity) {
+		t.Errorf("expected the activity range, got %v to %v", summary.FirstActivity, summary.LastActivity)
+	}
+}
+
+func TestHandleSummaryUnknownUser(t *testing.T) {
+	handler := setupTestHandler()
+	router := mux.NewRouter()
+	handler.RegisterRoutes(router, APIPrefix)
+
+	rr := serveRequest(router, "GET", APIPrefix+"/users/nobody/summary")
+	var summary services.AccountSummary
+	if err := json.Unmarshal(rr.Body.Bytes(), &summary); err != nil || rr.Code != http.StatusOK || summary.Exists {
+		t.Errorf("expected a 200 with exists false, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	config := services.DefaultConfig()
+	config.StrictAccounts = true
+	router = mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore(), services.WithConfig(config)), discardLogger).RegisterRoutes(router, APIPrefix)
+	decodeErrorBody(t, serveRequest(router, "GET", APIPrefix+"/users/nobody/summary"), http.StatusNotFound, kindNotFound)
+}
+
+// TestSummaryGolden pins the JSON shape of the summary, clients build the account screen from it
+func TestSummaryGolden(t *testing.T) {
+	ledgerStore := store.NewLedgerStore()
+	start := time.Date(2024, time.May, 2, 8, 30, 0, 0, time.UTC)
+	withdrawalID := uuid.New()
+	ledgerStore.AddTransactionWithTime("alice", models.TransactionRecord{ID: uuid.New(), Type: models.Deposit, Amount: 120.5, Timestamp: start})
+	ledgerStore.AddTransactionWithTime("alice", models.TransactionRecord{ID: withdrawalID, Type: models.Withdrawal, Amount: 20, Fee: 0.5, Timestamp: start.Add(time.Hour)})
+	ledgerStore.AddTransactionWithTime("alice", models.TransactionRecord{ID: uuid.New(), Type: models.Deposit, Amount: 20, ReversalOf: &withdrawalID, Timestamp: start.Add(2 * time.Hour)})
+
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(ledgerStore), discardLogger).RegisterRoutes(router, APIPrefix)
+
+	rr := serveRequest(router, "GET", APIPrefix+"/users/alice/summary")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rr.Code)
+	}
+	assertGolden(t, "summary.golden.json", rr.Body.Bytes())
+}
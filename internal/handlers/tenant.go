@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"tiny-ledger/internal/services"
+)
+
+// TenantHeader names the tenant of a request in multi-tenant mode
+const TenantHeader = "X-Tenant-ID"
+
+// WithTenants turns on the multi-tenant mode: every ledger and admin request must name an allowed tenant in
+// TenantHeader and is served by the ledger of that tenant. the service given to NewLedgerHandler isn't used then
+func WithTenants(registry *services.TenantRegistry) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.tenants = registry
+	}
+}
+
+type tenantKey struct{}
+
+type tenantLedger struct {
+	tenant  string
+	service services.LedgerService
+}
+
+// selectTenant puts the ledger of the tenant of the request in its context, a missing or unknown tenant is a 400
+func (h *LedgerHandler) selectTenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant := r.Header.Get(TenantHeader)
+		if tenant == "" {
+			h.sendValidationError(w, r, &services.ValidationError{Field: TenantHeader, Code: "tenant_required", Message: TenantHeader + " header is required"})
+			return
+		}
+		service, err := h.tenants.Service(tenant)
+		if err != nil {
+			h.sendValidationError(w, r, &services.ValidationError{Field: TenantHeader, Code: "unknown_tenant", Message: "unknown tenant"})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), tenantKey{}, tenantLedger{tenant: tenant, service: service})))
+	})
+}
+
+// serviceFor is the ledger of the tenant of the request context, the one of the handler outside of multi-tenant mode
+func (h *LedgerHandler) serviceFor(ctx context.Context) services.LedgerService {
+	if ledger, ok := ctx.Value(tenantKey{}).(tenantLedger); ok {
+		return ledger.service
+	}
+	return h.service
+}
+
+// tenantOf is the tenant of the request context, empty outside of multi-tenant mode
+func tenantOf(ctx context.Context) string {
+	ledger, _ := ctx.Value(tenantKey{}).(tenantLedger)
+	return ledger.tenant
+}
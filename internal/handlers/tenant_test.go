@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// setupTenantRouter serves the tenants staging and sandbox, and the admin routes
+func setupTenantRouter(t *testing.T) *mux.Router {
+	t.Helper()
+
+	registry, err := services.NewTenantRegistry([]string{"staging", "sandbox"}, func(string) services.LedgerService {
+		return services.NewLedgerService(store.NewLedgerStore())
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	router := mux.NewRouter()
+	NewLedgerHandler(nil, discardLogger, WithTenants(registry), WithAdmin(testAdminCredentials)).RegisterRoutes(router, APIPrefix)
+	return router
+}
+
+func tenantRequest(router *mux.Router, method, target, tenant string, body any) *httptest.ResponseRecorder {
+	var encoded []byte
+	if body != nil {
+		encoded, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, target, bytes.NewReader(encoded))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if tenant != "" {
+		req.Header.Set(TenantHeader, tenant)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestTenantIsolation(t *testing.T) {
+	router := setupTenantRouter(t)
+
+	deposits := map[string]float64{"staging": 100, "sandbox": 7}
+	for tenant, amount := range deposits {
+		rr := tenantRequest(router, "POST", APIPrefix+"/users/alice/transactions", tenant, transactionRequest{TransactionType: "deposit", Amount: amount})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status 201 in %s, got %d: %s", tenant, rr.Code, rr.Body.String())
+		}
+	}
+	// the withdrawal only fits the balance of staging
+	if rr := tenantRequest(router, "POST", APIPrefix+"/users/alice/transactions", "sandbox", transactionRequest{TransactionType: "withdrawal", Amount: 50}); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected status 422 in sandbox, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	for tenant, expected := range deposits {
+		rr := tenantRequest(router, "GET", APIPrefix+"/users/alice/balance", tenant, nil)
+		var body struct {
+			Balance float64 `json:"balance"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("could not parse the body: %v", err)
+		}
+		if body.Balance != expected {
+			t.Errorf("expected the balance %v in %s, got %v", expected, tenant, body.Balance)
+		}
+	}
+}
+
+func TestTenantAdminIsolation(t *testing.T) {
+	router := setupTenantRouter(t)
+	tenantRequest(router, "POST", APIPrefix+"/users/alice/transactions", "staging", transactionRequest{TransactionType: "deposit", Amount: 10})
+
+	for tenant, expected := range map[string]int{"staging": 1, "sandbox": 0} {
+		rr := adminRequest(router, APIPrefix+"/admin/users", func(req *http.Request) {
+			req.Header.Set(AdminKeyHeader, testAdminCredentials.APIKey)
+			req.Header.Set(TenantHeader, tenant)
+		})
+		var body adminUsersResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+			t.Fatalf("could not parse the body: %v", err)
+		}
+		if len(body.Users) != expected {
+			t.Errorf("expected %d users in %s, got %s", expected, tenant, rr.Body.String())
+		}
+	}
+}
+
+func TestTenantHeaderErrors(t *testing.T) {
+	router := setupTenantRouter(t)
+
+	tests := []struct {
+		name         string
+		tenant       string
+		expectedCode string
+	}{
+		{"Missing tenant", "", "tenant_required"},
+		{"Unknown tenant", "production", "unknown_tenant"},
+		{"Tenant with another case", "Staging", "unknown_tenant"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, rr := range []*httptest.ResponseRecorder{
+				tenantRequest(router, "GET", APIPrefix+"/users/alice/balance", tt.tenant, nil),
+				tenantRequest(router, "POST", APIPrefix+"/users/alice/transactions", tt.tenant, transactionRequest{TransactionType: "deposit", Amount: 10}),
+			} {
+				body := decodeErrorBody(t, rr, http.StatusBadRequest, kindValidationFailed)
+				if body.Code != tt.expectedCode || body.Field != TenantHeader {
+					t.Errorf("expected %s on %s, got %s on %s", tt.expectedCode, TenantHeader, body.Code, body.Field)
+				}
+			}
+		})
+	}
+
+	// the document doesn't belong to a tenant
+	if rr := serveRequest(router, "GET", "/openapi.json"); rr.Code != http.StatusOK {
+		t.Errorf("expected status 200 for the OpenAPI document, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	DefaultRequestTimeout = 10 * time.Second
+
+	// the streaming routes run as long as the client reads, the export flushes its rows as they're written and the
+	// websocket has its own ping/pong deadlines. neither the request timeout nor the server's write timeout apply
+	exportRouteName    = "export"
+	webSocketRouteName = "websocket"
+	historyRouteName   = "history" // streams too when it answers with CSV
+)
+
+// WithRequestTimeout cancels the context of an API request after timeout, zero or less disables it
+func WithRequestTimeout(timeout time.Duration) HandlerOption {
+	return func(h *LedgerHandler) {
+		h.requestTimeout = timeout
+	}
+}
+
+// limitTime runs the request under a deadline. when it passes before a read wrote anything the client gets a 503
+// right away and whatever the handler writes afterwards is dropped, a response already under way is let finish. a
+// write (any method but GET and HEAD) is never answered for the handler: its service call may have committed already
+// and a client told to try again would record it twice. it answers for itself once the call returns, the 503 of
+// context.DeadlineExceeded when the deadline stopped the call before the store. a streaming route is exempt from the
+// write timeout of the server too
+func (h *LedgerHandler) limitTime(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if streaming(r) {
+			// errors.ErrUnsupported without a server connection underneath, e.g. in a recorder
+			_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+			next.ServeHTTP(w, r)
+			return
+		}
+		if h.requestTimeout <= 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), h.requestTimeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+
+		tw := &timeoutWriter{w: w, header: w.Header().Clone()}
+		done := make(chan struct{})
+		panicked := make(chan any, 1)
+		go func() {
+			defer func() {
+				if p := recover(); p != nil {
+					panicked <- p
+					return
+				}
+				close(done)
+			}()
+			next.ServeHTTP(tw, r)
+		}()
+
+		select {
+		case <-done:
+			return
+		case p := <-panicked:
+			// re-raised here so the recovery middleware answers it
+			panic(p)
+		case <-ctx.Done():
+		}
+
+		tw.mu.Lock()
+		if !tw.wroteHeader && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+			tw.timedOut = true
+			h.requestLogger(r).WarnContext(r.Context(), "request timed out", "timeout", h.requestTimeout)
+			sendError(w, r, http.StatusServiceUnavailable, ErrorResponse{
+				Error:   "the request took too long, try again later",
+				Details: ErrorDetails{Code: kindTimeout},
+			})
+			tw.mu.Unlock()
+			return
+		}
+		tw.mu.Unlock()
+
+		select {
+		case <-done:
+		case p := <-panicked:
+			panic(p)
+		}
+	})
+}
+
+// streaming reports whether the request is served by one of the streaming routes, a CSV history is an export too
+func streaming(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	switch route.GetName() {
+	case exportRouteName, webSocketRouteName:
+		return true
+	case historyRouteName:
+		mediaType, _ := negotiate(r, historyMediaTypes...)
+		return mediaType == csvMediaType
+	}
+	return false
+}
+
+// timeoutWriter keeps the handler off the real writer until it writes, so the timeout response can't interleave with
+// it. the handler gets a header map of its own, copied over on the first write
+type timeoutWriter struct {
+	w      http.ResponseWriter
+	header http.Header
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeader(status)
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.w.Write(p)
+}
+
+// Flush passes through once the response is under way
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || !tw.wroteHeader {
+		return
+	}
+	if flusher, ok := tw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (tw *timeoutWriter) writeHeader(status int) {
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+
+	dst := tw.w.Header()
+	for key := range dst {
+		delete(dst, key)
+	}
+	for key, values := range tw.header {
+		dst[key] = values
+	}
+	tw.w.WriteHeader(status)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// slowLedger stands in for a slow store backend: its balance reads and exports take delay, a balance read gives up
+// with the context like a remote store would
+type slowLedger struct {
+	services.LedgerService
+	delay    time.Duration
+	ctx      context.Context
+	canceled chan error
+}
+
+func (s *slowLedger) WithContext(ctx context.Context) services.LedgerService {
+	bound := *s
+	bound.ctx = ctx
+	return &bound
+}
+
+func (s *slowLedger) GetBalanceDetails(userId string) (services.BalanceDetails, error) {
+	select {
+	case <-time.After(s.delay):
+		return s.LedgerService.GetBalanceDetails(userId)
+	case <-s.ctx.Done():
+		s.canceled <- s.ctx.Err()
+		return services.BalanceDetails{}, s.ctx.Err()
+	}
+}
+
+func (s *slowLedger) ExportTransactionsCSV(ctx context.Context, userId string, filter services.HistoryFilter, w io.Writer) error {
+	time.Sleep(s.delay)
+	return s.LedgerService.ExportTransactionsCSV(ctx, userId, filter, w)
+}
+
+func setupTimeoutRouter(t *testing.T, delay, timeout time.Duration) (*mux.Router, *slowLedger) {
+	t.Helper()
+
+	ledgerStore := store.NewLedgerStore()
+	if _, err := ledgerStore.InsertTransaction("alice", models.NewTransactionRecord(models.Deposit, 10, "salary", time.Now())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	slow := &slowLedger{LedgerService: services.NewLedgerService(ledgerStore), delay: delay, ctx: context.Background(), canceled: make(chan error, 1)}
+
+	router := mux.NewRouter()
+	NewLedgerHandler(slow, discardLogger, WithRequestTimeout(timeout)).RegisterRoutes(router, APIPrefix)
+	return router, slow
+}
+
+func TestRequestTimeout(t *testing.T) {
+	router, slow := setupTimeoutRouter(t, time.Second, 20*time.Millisecond)
+
+	start := time.Now()
+	rr := serveRequest(router, "GET", APIPrefix+"/users/alice/balance")
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("expected the timeout to answer before the slow call returned, took %s", elapsed)
+	}
+	body := decodeErrorBody(t, rr, http.StatusServiceUnavailable, kindTimeout)
+	if body.Error == "" {
+		t.Errorf("expected an error message, got %+v", body)
+	}
+
+	select {
+	case err := <-slow.canceled:
+		if err != context.DeadlineExceeded {
+			t.Errorf("expected the deadline to cancel the call, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected the service call to be canceled")
+	}
+}
+
+// stallingLedger records transactions with the real service, stalling before or after the store has the record
+type stallingLedger struct {
+	services.LedgerService
+	before, after time.Duration
+}
+
+func (s *stallingLedger) WithContext(ctx context.Context) services.LedgerService {
+	return &stallingLedger{LedgerService: s.LedgerService.WithContext(ctx), before: s.before, after: s.after}
+}
+
+func (s *stallingLedger) RecordTransactionInput(userId string, input services.TransactionInput) (models.TransactionRecord, error) {
+	time.Sleep(s.before)
+	tx, err := s.LedgerService.RecordTransactionInput(userId, input)
+	time.Sleep(s.after)
+	return tx, err
+}
+
+func TestRequestTimeoutLetsWritesAnswer(t *testing.T) {
+	tests := []struct {
+		name           string
+		before, after  time.Duration
+		expectedStatus int
+		expectedBal    float64
+	}{
+		// a 503 would have the client record the deposit a second time
+		{"Committed before the deadline", 0, 60 * time.Millisecond, http.StatusCreated, 100},
+		{"Deadline before the store", 60 * time.Millisecond, 0, http.StatusServiceUnavailable, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc := services.NewLedgerService(store.NewLedgerStore())
+			router := mux.NewRouter()
+			NewLedgerHandler(&stallingLedger{LedgerService: svc, before: tt.before, after: tt.after}, discardLogger,
+				WithRequestTimeout(20*time.Millisecond)).RegisterRoutes(router, APIPrefix)
+
+			rr := postJSON(router, APIPrefix+"/users/alice/transactions", map[string]any{"type": "deposit", "amount": 100, "description": "salary"})
+			if rr.Code != tt.expectedStatus {
+				t.Fatalf("expected %d, got %d: %s", tt.expectedStatus, rr.Code, rr.Body.String())
+			}
+			if tt.expectedStatus == http.StatusServiceUnavailable {
+				decodeErrorBody(t, rr, http.StatusServiceUnavailable, kindTimeout)
+			}
+			if balance, _ := svc.GetCurrentBalance("alice"); balance != tt.expectedBal {
+				t.Errorf("expected a balance of %v, got %v", tt.expectedBal, balance)
+			}
+		})
+	}
+}
+
+func TestRequestTimeoutNotReached(t *testing.T) {
+	router, _ := setupTimeoutRouter(t, 0, time.Second)
+
+	rr := serveRequest(router, "GET", APIPrefix+"/users/alice/balance")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"balance":10`) {
+		t.Errorf("expected the balance, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRequestTimeoutSkipsStreaming(t *testing.T) {
+	router, _ := setupTimeoutRouter(t, 50*time.Millisecond, 10*time.Millisecond)
+
+	rr := serveRequest(router, "GET", APIPrefix+"/users/alice/transactions/export")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "salary") {
+		t.Errorf("expected the export to outlive the timeout, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ := http.NewRequest("GET", APIPrefix+"/users/alice/transactions", nil)
+	req.Header.Set("Accept", "text/csv")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "salary") {
+		t.Errorf("expected the CSV history to outlive the timeout, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestStreamingOutlivesTheWriteTimeout(t *testing.T) {
+	router, _ := setupTimeoutRouter(t, 100*time.Millisecond, 0)
+	server := httptest.NewUnstartedServer(router)
+	server.Config.WriteTimeout = 30 * time.Millisecond
+	server.Start()
+	t.Cleanup(server.Close)
+
+	resp, err := http.Get(server.URL + APIPrefix + "/users/alice/transactions/export")
+	if err != nil {
+		t.Fatalf("expected the export to outlive the write timeout: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "salary") {
+		t.Errorf("expected the export, got %d: %s", resp.StatusCode, body)
+	}
+
+	// a plain route as slow as the export is cut
+	if resp, err := http.Get(server.URL + APIPrefix + "/users/alice/balance"); err == nil {
+		resp.Body.Close()
+		t.Errorf("expected the write timeout to cut the balance, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	"tiny-ledger/internal/tlsconfig"
+)
+
+type clientCertKey struct{}
+
+// ClientCertMiddleware puts the identity of the verified client certificate of a mutual TLS connection in the context,
+// the audit events and the access log attribute the request to it. see tlsconfig.Identity
+func ClientCertMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// only the verified chains, a certificate the client merely sent proves nothing
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			if identity := tlsconfig.Identity(r.TLS.VerifiedChains[0][0]); identity != "" {
+				r = r.WithContext(context.WithValue(r.Context(), clientCertKey{}, identity))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ClientCertificate is the identity ClientCertMiddleware found, empty without a client certificate
+func ClientCertificate(ctx context.Context) string {
+	identity, _ := ctx.Value(clientCertKey{}).(string)
+	return identity
+}
+
+// RedirectToHTTPS answers every plain HTTP request with a 308 to the same URL on the TLS port, the method and the body
+// are kept. port 443 is left out of the URL
+func RedirectToHTTPS(tlsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host // no port
+		}
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// RejectPlainHTTP answers every plain HTTP request with a 403, a client that sent a token in the clear learns it
+// has to rotate it instead of having it silently accepted
+func RejectPlainHTTP(w http.ResponseWriter, r *http.Request) {
+	sendError(w, r, http.StatusForbidden, ErrorResponse{Error: "HTTPS is required", Code: "https_required"})
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"tiny-ledger/internal/audit"
+
+	"github.com/gorilla/mux"
+)
+
+// withClientCert makes the request arrive over mutual TLS with a verified certificate of the common name
+func withClientCert(commonName string) func(*http.Request) {
+	return func(req *http.Request) {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+}
+
+func TestClientCertMiddleware(t *testing.T) {
+	var identity string
+	handler := ClientCertMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity = ClientCertificate(r.Context())
+	}))
+
+	tests := []struct {
+		name     string
+		setup    func(*http.Request)
+		expected string
+	}{
+		{"verified certificate", withClientCert("partner-service"), "partner-service"},
+		{"plain HTTP", func(*http.Request) {}, ""},
+		{"TLS without a client certificate", func(req *http.Request) { req.TLS = &tls.ConnectionState{} }, ""},
+		{"unverified certificate", func(req *http.Request) {
+			withClientCert("partner-service")(req)
+			req.TLS.VerifiedChains = nil
+		}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			tt.setup(req)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if identity != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, identity)
+			}
+		})
+	}
+}
+
+func TestClientCertInTheAuditEvents(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware, ClientCertMiddleware)
+	handler := NewLedgerHandler(setupTestHandler().service, discardLogger, WithAdmin(testAdminCredentials))
+	handler.RegisterRoutes(router, APIPrefix)
+
+	req := httptest.NewRequest("POST", APIPrefix+"/users/alice/transactions", strings.NewReader(`{"type": "deposit", "amount": 10}`))
+	req.Header.Set("Content-Type", "application/json")
+	withClientCert("partner-service")(req)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr = adminRequest(router, APIPrefix+"/admin/audit?userId=alice", withAdminKey(testAdminCredentials.APIKey))
+	var body auditEventsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("could not parse the body: %v", err)
+	}
+	if len(body.Events) != 1 || body.Events[0].ClientCert != "partner-service" || body.Events[0].Outcome != audit.OutcomeSuccess {
+		t.Errorf("expected the deposit attributed to partner-service, got %s", rr.Body.String())
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		port     string
+		host     string
+		expected string
+	}{
+		{"8443", "ledger.example.com:8080", "https://ledger.example.com:8443/v1/users/alice/balance?currency=EUR"},
+		{"443", "ledger.example.com", "https://ledger.example.com/v1/users/alice/balance?currency=EUR"},
+		{"443", "[::1]:80", "https://::1/v1/users/alice/balance?currency=EUR"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("POST", "/v1/users/alice/balance?currency=EUR", strings.NewReader("{}"))
+		req.Host = tt.host
+		rr := httptest.NewRecorder()
+		RedirectToHTTPS(tt.port).ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusPermanentRedirect {
+			t.Errorf("expected status 308, got %d", rr.Code)
+		}
+		if location := rr.Header().Get("Location"); location != tt.expected {
+			t.Errorf("expected %s, got %s", tt.expected, location)
+		}
+	}
+}
+
+func TestRejectPlainHTTP(t *testing.T) {
+	rr := httptest.NewRecorder()
+	RejectPlainHTTP(rr, httptest.NewRequest("GET", "/v1/users/alice/balance", nil))
+	decodeErrorBody(t, rr, http.StatusForbidden, kindForbidden)
+}
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// handleTotals answers the deposit and withdrawal totals of a period without listing its records
+func (h *LedgerHandler) handleTotals(w http.ResponseWriter, r *http.Request) {
+	start, end, verr := h.timeRangeParams(r.URL.Query())
+	if verr != nil {
+		h.sendValidationError(w, r, verr)
+		return
+	}
+
+	totals, err := h.ledger(r).GetTotals(mux.Vars(r)["userId"], start, end)
+	if err != nil {
+		h.sendServiceError(w, r, err)
+		return
+	}
+	sendJSONResponse(w, r, http.StatusOK, totals)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+func TestHandleTotals(t *testing.T) {
+	ledgerStore := store.NewLedgerStore()
+	router := mux.NewRouter()
+	NewLedgerHandler(services.NewLedgerService(ledgerStore), discardLogger).RegisterRoutes(router, APIPrefix)
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 30 {
+		tx := models.TransactionRecord{ID: uuid.New(), Amount: float64(10 + i), Type: models.Deposit, Timestamp: base.Add(time.Duration(i) * 12 * time.Hour)}
+		if i%4 == 0 {
+			tx.Type, tx.Fee = models.Withdrawal, 1
+		}
+		tx.Voided = i == 5
+		ledgerStore.AddTransactionWithTime("alice", tx)
+	}
+
+	const period = "start=2025-01-03T00:00:00Z&end=2025-01-09T23:59:59Z"
+	rr := serveRequest(router, "GET", APIPrefix+"/users/alice/totals?"+period)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var totals services.PeriodTotals
+	if err := json.Unmarshal(rr.Body.Bytes(), &totals); err != nil {
+		t.Fatalf("could not parse the body: %v", err)
+	}
+
+	// the same period summed from the history
+	var history historyResponse
+	if err := json.Unmarshal(serveRequest(router, "GET", APIPrefix+"/users/alice/transactions?pageSize=100&includeVoided=false&"+period).Body.Bytes(), &history); err != nil {
+		t.Fatalf("could not parse the history: %v", err)
+	}
+	var expected services.PeriodTotals
+	for _, tx := range history.Transactions {
+		if tx.Type == models.Withdrawal {
+			expected.Withdrawals.Count++
+			expected.Withdrawals.Sum += tx.Amount
+			expected.Fees += tx.Fee
+		} else {
+			expected.Deposits.Count++
+			expected.Deposits.Sum += tx.Amount
+		}
+	}
+	if totals.Deposits != expected.Deposits || totals.Withdrawals != expected.Withdrawals || totals.Fees != expected.Fees {
+		t.Errorf("expected %+v %+v fees %v, got %s", expected.Deposits, expected.Withdrawals, expected.Fees, rr.Body.String())
+	}
+	if net := expected.Deposits.Sum - expected.Withdrawals.Sum - expected.Fees; totals.Net != net {
+		t.Errorf("expected net %v, got %v", net, totals.Net)
+	}
+
+	tests := []struct {
+		name         string
+		query        string
+		expectedCode string
+	}{
+		{"Malformed start", "?start=yesterday", "invalid_time"},
+		{"Start after end", "?start=2025-01-09T00:00:00Z&end=2025-01-03T00:00:00Z", "invalid_range"},
+		{"Unsupported filter", "?type=deposit", "unknown_parameter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := decodeErrorBody(t, serveRequest(router, "GET", APIPrefix+"/users/alice/totals"+tt.query), http.StatusBadRequest, kindValidationFailed)
+			if body.Code != tt.expectedCode {
+				t.Errorf("expected code %s, got %+v", tt.expectedCode, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"tiny-ledger/internal/services"
+)
+
+// tracerName is the instrumentation scope of the server spans
+const tracerName = "tiny-ledger/internal/handlers"
+
+// TracingMiddleware starts a server span per request, continuing the trace of an incoming W3C traceparent header.
+// the span is named after the route template, a 5xx sets its status to error
+func TracingMiddleware(provider trace.TracerProvider) mux.MiddlewareFunc {
+	tracer := provider.Tracer(tracerName)
+	propagator := propagation.TraceContext{}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			route := routeTemplate(r)
+			ctx, span := tracer.Start(ctx, r.Method+" "+route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("http.route", route),
+					attribute.String("request.id", RequestID(r.Context())),
+				))
+			defer span.End()
+
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r.WithContext(ctx))
+
+			span.SetAttributes(attribute.Int("http.response.status_code", recorder.status))
+			if recorder.status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, fmt.Sprintf("status %d", recorder.status))
+			}
+		})
+	}
+}
+
+// ledger is the service bound to the request, its spans become children of the request span and its audit events
+// name the actor and the request ID
+func (h *LedgerHandler) ledger(r *http.Request) services.LedgerService {
+	return h.serviceFor(r.Context()).WithContext(auditContext(r))
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func setupTracedRouter(t *testing.T) (*mux.Router, *tracetest.SpanRecorder) {
+	t.Helper()
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	t.Cleanup(func() { _ = provider.Shutdown(context.Background()) })
+
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware, TracingMiddleware(provider))
+	svc := services.NewLedgerService(store.NewLedgerStore(), services.WithTracerProvider(provider))
+	NewLedgerHandler(svc, discardLogger).RegisterRoutes(router, APIPrefix)
+	return router, recorder
+}
+
+func postTraced(router *mux.Router, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("traceparent", testTraceParent)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// spanNamed returns the single ended span with the name
+func spanNamed(t *testing.T, recorder *tracetest.SpanRecorder, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+
+	var found []sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.Name() == name {
+			found = append(found, span)
+		}
+	}
+	if len(found) != 1 {
+		t.Fatalf("expected one %s span, got %d", name, len(found))
+	}
+	return found[0]
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, attr := range span.Attributes() {
+		if attr.Key == key {
+			return attr.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracingSpanHierarchy(t *testing.T) {
+	router, recorder := setupTracedRouter(t)
+
+	rr := postTraced(router, APIPrefix+"/users/alice/transactions", `{"type":"deposit","amount":25}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", rr.Code)
+	}
+
+	server := spanNamed(t, recorder, "POST "+APIPrefix+"/users/{userId}/transactions")
+	service := spanNamed(t, recorder, "LedgerService.RecordTransaction")
+	storeCall := spanNamed(t, recorder, "LedgerStore.InsertTransaction")
+
+	// the server span continues the caller's trace
+	if got := server.SpanContext().TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected the trace of the traceparent header, got %s", got)
+	}
+	if server.Parent().SpanID().String() != "00f067aa0ba902b7" || !server.Parent().IsRemote() {
+		t.Errorf("expected the remote caller as parent, got %v", server.Parent())
+	}
+	if service.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("expected the service span under the server span")
+	}
+	if storeCall.Parent().SpanID() != service.SpanContext().SpanID() {
+		t.Errorf("expected the store span under the service span")
+	}
+
+	if got := spanAttribute(server, "http.response.status_code").AsInt64(); got != http.StatusCreated {
+		t.Errorf("expected status code 201 on the server span, got %d", got)
+	}
+	if got := spanAttribute(service, "ledger.transaction_type").AsString(); got != "deposit" {
+		t.Errorf("expected transaction type deposit, got %q", got)
+	}
+	if got := spanAttribute(service, "ledger.outcome").AsString(); got != "created" {
+		t.Errorf("expected outcome created, got %q", got)
+	}
+	hash := spanAttribute(service, "ledger.user_id_hash").AsString()
+	if hash == "" || strings.Contains(hash, "alice") {
+		t.Errorf("expected a hash of the user ID, got %q", hash)
+	}
+}
+
+func TestTracingErrorStatus(t *testing.T) {
+	router, recorder := setupTracedRouter(t)
+
+	rr := postTraced(router, APIPrefix+"/users/alice/transactions", `{"type":"withdrawal","amount":25}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d", rr.Code)
+	}
+
+	service := spanNamed(t, recorder, "LedgerService.RecordTransaction")
+	if service.Status().Code != codes.Error || spanAttribute(service, "ledger.outcome").AsString() != "insufficient_funds" {
+		t.Errorf("expected an error status with outcome insufficient_funds, got %v %v", service.Status(), spanAttribute(service, "ledger.outcome"))
+	}
+	if storeCall := spanNamed(t, recorder, "LedgerStore.InsertTransaction"); storeCall.Status().Code != codes.Error {
+		t.Errorf("expected the store span to fail too, got %v", storeCall.Status())
+	}
+	// a client error isn't a failure of the server
+	if server := spanNamed(t, recorder, "POST "+APIPrefix+"/users/{userId}/transactions"); server.Status().Code != codes.Unset {
+		t.Errorf("expected no error status on the server span for a 422, got %v", server.Status())
+	}
+}
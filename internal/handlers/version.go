@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// APIPrefix is the mount point of the current version of the ledger API
+const APIPrefix = "/v1"
+
+// LegacyDeprecatedSince is when the unprefixed paths were deprecated in favour of APIPrefix
+var LegacyDeprecatedSince = time.Date(2026, time.October, 16, 0, 0, 0, 0, time.UTC)
+
+// apiRoutes are the routes of one mount the handlers link to, URLs are built from their templates so a Location
+// header points into the same version the request came through
+type apiRoutes struct {
+	transaction *mux.Route
+}
+
+type apiRoutesKey struct{}
+
+func withAPIRoutes(routes *apiRoutes) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiRoutesKey{}, routes)))
+		})
+	}
+}
+
+// transactionURL is the path of the transaction under the mount that served r
+func transactionURL(r *http.Request, userId string, txID uuid.UUID) string {
+	routes, _ := r.Context().Value(apiRoutesKey{}).(*apiRoutes)
+	if routes == nil || routes.transaction == nil {
+		return ""
+	}
+
+	u, err := routes.transaction.URLPath("userId", userId, "txId", txID.String())
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// RegisterLegacyRoutes keeps the unprefixed paths of the API working next to the versioned ones. their responses
+// carry the Deprecation (RFC 9745) and Sunset (RFC 8594) headers so clients know to move to APIPrefix before sunset
+func (h *LedgerHandler) RegisterLegacyRoutes(r *mux.Router, sunset time.Time) {
+	h.legacyMounted = true
+	h.registerAPI(r, "", h.strictLegacyQuery, deprecation(LegacyDeprecatedSince, sunset))
+}
+
+func deprecation(since, sunset time.Time) mux.MiddlewareFunc {
+	deprecated := "@" + strconv.FormatInt(since.Unix(), 10)
+	sunsetDate := sunset.UTC().Format(http.TimeFormat)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", deprecated)
+			w.Header().Set("Sunset", sunsetDate)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
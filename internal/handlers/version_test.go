@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/models"
+)
+
+func setupVersionedRouter(sunset time.Time) *mux.Router {
+	router := mux.NewRouter()
+	handler := setupTestHandler()
+	handler.RegisterRoutes(router, APIPrefix)
+	handler.RegisterLegacyRoutes(router, sunset)
+	return router
+}
+
+func TestVersionedAndLegacyPaths(t *testing.T) {
+	sunset := time.Date(2027, time.April, 16, 0, 0, 0, 0, time.UTC)
+	router := setupVersionedRouter(sunset)
+
+	tests := []struct {
+		name       string
+		prefix     string
+		deprecated bool
+	}{
+		{"Versioned", APIPrefix, false},
+		{"Legacy", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := postJSON(router, tt.prefix+"/users/alice/transactions", map[string]interface{}{"amount": 10.0, "type": "deposit"})
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("expected status 201, got %d: %s", rr.Code, rr.Body.String())
+			}
+
+			var created models.TransactionRecord
+			if err := json.Unmarshal(rr.Body.Bytes(), &created); err != nil {
+				t.Fatalf("could not parse response: %v", err)
+			}
+			location := rr.Header().Get("Location")
+			if want := tt.prefix + "/users/alice/transactions/" + created.ID.String(); location != want {
+				t.Errorf("expected Location %q, got %q", want, location)
+			}
+
+			req, _ := http.NewRequest("GET", location, nil)
+			get := httptest.NewRecorder()
+			router.ServeHTTP(get, req)
+			if get.Code != http.StatusOK {
+				t.Errorf("expected the Location to resolve, got %d", get.Code)
+			}
+
+			for _, header := range []http.Header{rr.Header(), get.Header()} {
+				deprecation, sunsetHeader := header.Get("Deprecation"), header.Get("Sunset")
+				if !tt.deprecated {
+					if deprecation != "" || sunsetHeader != "" {
+						t.Errorf("expected no deprecation headers, got %q and %q", deprecation, sunsetHeader)
+					}
+					continue
+				}
+				if deprecation != "@1792108800" {
+					t.Errorf("unexpected Deprecation header: %q", deprecation)
+				}
+				if sunsetHeader != "Fri, 16 Apr 2027 00:00:00 GMT" {
+					t.Errorf("unexpected Sunset header: %q", sunsetHeader)
+				}
+			}
+		})
+	}
+}
+
+func TestLegacyPathsShareTheLedger(t *testing.T) {
+	router := setupVersionedRouter(time.Now().AddDate(0, 6, 0))
+
+	postJSON(router, "/users/bob/transactions", map[string]interface{}{"amount": 25.0, "type": "deposit"})
+	postJSON(router, APIPrefix+"/users/bob/transactions", map[string]interface{}{"amount": 5.0, "type": "withdrawal"})
+
+	for _, path := range []string{"/users/bob/balance", APIPrefix + "/users/bob/balance"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var balance balanceResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &balance); err != nil {
+			t.Fatalf("could not parse response: %v", err)
+		}
+		if balance.Balance != 20 {
+			t.Errorf("%s: expected balance 20, got %v", path, balance.Balance)
+		}
+	}
+}
+
+func TestOpenAPIDocumentsBothMounts(t *testing.T) {
+	router := setupVersionedRouter(time.Now().AddDate(0, 6, 0))
+
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var doc struct {
+		Paths map[string]map[string]struct {
+			Deprecated bool `json:"deprecated"`
+		} `json:"paths"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("the document is not valid JSON: %v", err)
+	}
+
+	tests := []struct {
+		path       string
+		present    bool
+		deprecated bool
+	}{
+		{APIPrefix + "/users/{userId}/balance", true, false},
+		{"/users/{userId}/balance", true, true},
+		{"/healthz", true, false},
+		{APIPrefix + "/healthz", false, false},
+	}
+
+	for _, tt := range tests {
+		op, ok := doc.Paths[tt.path]["get"]
+		if ok != tt.present {
+			t.Errorf("%s: expected documented=%v", tt.path, tt.present)
+			continue
+		}
+		if op.Deprecated != tt.deprecated {
+			t.Errorf("%s: expected deprecated=%v, got %v", tt.path, tt.deprecated, op.Deprecated)
+		}
+	}
+}
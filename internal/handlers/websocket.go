@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second    // a frame the client doesn't take in time closes the socket
+	wsPongWait   = 60 * time.Second    // the client has this long to answer a ping
+	wsPingPeriod = wsPongWait * 9 / 10 // pings go out before the pong wait runs out
+	wsSendBuffer = 64                  // frames waiting for the writer, a client further behind is disconnected
+)
+
+// wsCommand is a frame sent by the client. Action is deposit, withdrawal or balance, RequestID is echoed on the
+// response so the client can match it
+type wsCommand struct {
+	Action      string  `json:"action"`
+	RequestID   string  `json:"requestId,omitempty"`
+	Amount      float64 `json:"amount,omitempty"`
+	Description string  `json:"description,omitempty"`
+}
+
+// wsFrame is a frame sent to the client: an event for every new record of the user, the response to a command or
+// the error it failed with
+type wsFrame struct {
+	Type        string               `json:"type"` // event, response or error
+	RequestID   string               `json:"requestId,omitempty"`
+	Action      string               `json:"action,omitempty"`
+	Transaction *transactionResponse `json:"transaction,omitempty"`
+	Balance     *balanceResponse     `json:"balance,omitempty"`
+	Error       *ErrorResponse       `json:"error,omitempty"`
+}
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// hijacker lets the upgrader take the connection through the middleware that wrap the writer
+type hijacker struct {
+	http.ResponseWriter
+}
+
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(h.ResponseWriter).Hijack()
+}
+
+// handleWebSocket upgrades to a socket that streams the events of the user and takes commands, it sits behind the
+// same authentication as the rest of the user's routes
+func (h *LedgerHandler) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	userId := mux.Vars(r)["userId"]
+
+	conn, err := wsUpgrader.Upgrade(hijacker{w}, r, nil)
+	if err != nil {
+		// the upgrader already answered the client
+		h.requestLogger(r).InfoContext(r.Context(), "websocket upgrade failed", "error", err)
+		return
+	}
+
+	session := &wsSession{
+		handler: h,
+		conn:    conn,
+		request: r,
+		userId:  userId,
+		send:    make(chan wsFrame, wsSendBuffer),
+		done:    make(chan struct{}),
+	}
+	h.trackSession(session, true)
+	defer h.trackSession(session, false)
+	unsubscribe := h.serviceFor(r.Context()).Subscribe(func(event services.TransactionEvent) {
+		if event.UserID == userId {
+			tx := newTransactionResponse(event.Transaction)
+			session.push(wsFrame{Type: "event", Transaction: &tx})
+		}
+	})
+	defer unsubscribe()
+
+	go session.writeLoop()
+	session.readLoop()
+}
+
+// trackSession adds or removes an open session, CloseWebSockets closes them
+func (h *LedgerHandler) trackSession(s *wsSession, open bool) {
+	h.wsMu.Lock()
+	defer h.wsMu.Unlock()
+	if !open {
+		delete(h.wsSessions, s)
+		return
+	}
+	if h.wsSessions == nil {
+		h.wsSessions = make(map[*wsSession]struct{})
+	}
+	h.wsSessions[s] = struct{}{}
+}
+
+// CloseWebSockets tells every open socket the server is going away and closes it. http.Server.Shutdown doesn't wait
+// for hijacked connections, main calls this when the drain starts so the clients get a close frame and reconnect
+func (h *LedgerHandler) CloseWebSockets() {
+	h.wsMu.Lock()
+	sessions := make([]*wsSession, 0, len(h.wsSessions))
+	for s := range h.wsSessions {
+		sessions = append(sessions, s)
+	}
+	h.wsMu.Unlock()
+
+	goingAway := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for _, s := range sessions {
+		_ = s.conn.WriteControl(websocket.CloseMessage, goingAway, time.Now().Add(wsWriteWait))
+		s.close()
+	}
+}
+
+type wsSession struct {
+	handler *LedgerHandler
+	conn    *websocket.Conn
+	request *http.Request
+	userId  string
+
+	send      chan wsFrame
+	done      chan struct{} // closed when the session ends, the writer stops with it
+	closeOnce sync.Once
+}
+
+// push queues a frame without ever blocking the event bus or the reader, a client that can't keep up is dropped
+func (s *wsSession) push(frame wsFrame) {
+	select {
+	case <-s.done:
+	case s.send <- frame:
+	default:
+		s.handler.requestLogger(s.request).WarnContext(s.request.Context(), "websocket client too slow, closing")
+		s.close()
+	}
+}
+
+func (s *wsSession) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.conn.Close()
+	})
+}
+
+func (s *wsSession) readLoop() {
+	defer s.close()
+
+	s.conn.SetReadLimit(s.handler.maxBodyBytes)
+	_ = s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		// a close, a read error or a missed pong ends the session
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var cmd wsCommand
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			s.push(s.errorFrame(cmd, http.StatusBadRequest, ErrorResponse{Error: "frame is not a valid JSON command", Code: "malformed_json"}))
+			continue
+		}
+		s.push(s.execute(cmd))
+	}
+}
+
+// writeLoop is the only writer of the connection, it sends the queued frames and the keepalive pings
+func (s *wsSession) writeLoop() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer ticker.Stop()
+	defer s.close()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case frame := <-s.send:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := s.conn.WriteJSON(frame); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// execute runs a command through the same service calls and validation as the REST routes
+func (s *wsSession) execute(cmd wsCommand) wsFrame {
+	switch cmd.Action {
+	case string(models.Deposit), string(models.Withdrawal):
+		tx, err := s.handler.service.RecordTransactionInput(s.userId, services.TransactionInput{
+			Type:        models.TransactionType(cmd.Action),
+			Amount:      cmd.Amount,
+			Description: cmd.Description,
+		})
+		if err != nil {
+			return s.serviceErrorFrame(cmd, err)
+		}
+		response := newTransactionResponse(tx)
+		return wsFrame{Type: "response", RequestID: cmd.RequestID, Action: cmd.Action, Transaction: &response}
+
+	case "balance":
+		details, err := s.handler.service.GetBalanceDetails(s.userId)
+		if err != nil {
+			return s.serviceErrorFrame(cmd, err)
+		}
+		balance := newBalanceResponse(details)
+		return wsFrame{Type: "response", RequestID: cmd.RequestID, Action: cmd.Action, Balance: &balance}
+
+	default:
+		return s.errorFrame(cmd, http.StatusBadRequest, ErrorResponse{
+			Error: "invalid action value, use one of deposit, withdrawal, balance",
+			Code:  "invalid_value",
+			Field: "action",
+		})
+	}
+}
+
+func (s *wsSession) serviceErrorFrame(cmd wsCommand, err error) wsFrame {
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		return s.errorFrame(cmd, http.StatusBadRequest, ErrorResponse{Error: validationErr.Message, Code: validationErr.Code, Field: validationErr.Field})
+	}
+	if status, body, known := knownServiceError(err); known {
+		return s.errorFrame(cmd, status, body)
+	}
+
+	s.handler.requestLogger(s.request).ErrorContext(s.request.Context(), "internal error", "error", err, "action", cmd.Action)
+	return s.errorFrame(cmd, http.StatusInternalServerError, ErrorResponse{Error: internalErrorMessage})
+}
+
+// errorFrame carries the error body the REST route would answer with the same status
+func (s *wsSession) errorFrame(cmd wsCommand, status int, body ErrorResponse) wsFrame {
+	body.complete(status, RequestID(s.request.Context()))
+	return wsFrame{Type: "error", RequestID: cmd.RequestID, Action: cmd.Action, Error: &body}
+}
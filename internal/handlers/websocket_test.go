@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// setupWebSocketServer serves the API behind the middleware of main, the upgrade has to get through their writers
+func setupWebSocketServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	router := mux.NewRouter()
+	router.Use(RequestIDMiddleware, LoggingMiddleware(discardLogger, 0), RecoveryMiddleware(discardLogger), CompressMiddleware(DefaultCompressMinSize))
+	NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger, WithAuth(verifier)).RegisterRoutes(router, APIPrefix)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func dialWebSocket(t *testing.T, server *httptest.Server, userId, subject string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+authtest.Token(authtest.Secret, subject))
+	header.Set("Accept-Encoding", "gzip")
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+APIPrefix+"/users/"+userId+"/ws", header)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	return conn, resp, err
+}
+
+// readFrame returns the next frame matching accept, skipping the others
+func readFrame(t *testing.T, conn *websocket.Conn, accept func(wsFrame) bool) wsFrame {
+	t.Helper()
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var frame wsFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("expected a frame: %v", err)
+		}
+		if accept(frame) {
+			return frame
+		}
+	}
+}
+
+func withRequestID(requestID string) func(wsFrame) bool {
+	return func(frame wsFrame) bool { return frame.Type != "event" && frame.RequestID == requestID }
+}
+
+func TestWebSocketCommands(t *testing.T) {
+	server := setupWebSocketServer(t)
+	conn, _, err := dialWebSocket(t, server, "alice", "alice")
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		command       map[string]any
+		expectedType  string
+		expectedKind  string
+		expectedCode  string
+		expectBalance float64
+	}{
+		{"Deposit", map[string]any{"action": "deposit", "amount": 25.0, "description": "salary"}, "response", "", "", 25},
+		{"Withdrawal", map[string]any{"action": "withdrawal", "amount": 10.0}, "response", "", "", 15},
+		{"Balance", map[string]any{"action": "balance"}, "response", "", "", 15},
+		{"Negative amount", map[string]any{"action": "deposit", "amount": -5.0}, "error", kindValidationFailed, "not_positive", 15},
+		{"Insufficient funds", map[string]any{"action": "withdrawal", "amount": 500.0}, "error", kindInsufficientFunds, "", 15},
+		{"Unknown action", map[string]any{"action": "transfer"}, "error", kindValidationFailed, "invalid_value", 15},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requestID := "req-" + string(rune('a'+i))
+			tt.command["requestId"] = requestID
+			if err := conn.WriteJSON(tt.command); err != nil {
+				t.Fatalf("could not send the command: %v", err)
+			}
+
+			frame := readFrame(t, conn, withRequestID(requestID))
+			if frame.Type != tt.expectedType {
+				t.Fatalf("expected a %s frame, got %+v", tt.expectedType, frame)
+			}
+			if tt.expectedType == "error" {
+				if frame.Error == nil || frame.Error.Details.Code != tt.expectedKind || frame.Error.Code != tt.expectedCode {
+					t.Errorf("expected error %s/%q, got %+v", tt.expectedKind, tt.expectedCode, frame.Error)
+				}
+				return
+			}
+
+			switch tt.command["action"] {
+			case "balance":
+				if frame.Balance == nil || frame.Balance.Balance != tt.expectBalance {
+					t.Errorf("expected balance %v, got %+v", tt.expectBalance, frame.Balance)
+				}
+			default:
+				if frame.Transaction == nil || frame.Transaction.Amount != tt.command["amount"] {
+					t.Errorf("expected the recorded transaction, got %+v", frame.Transaction)
+				}
+			}
+		})
+	}
+
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("{not json")); err != nil {
+		t.Fatalf("could not send the frame: %v", err)
+	}
+	frame := readFrame(t, conn, func(frame wsFrame) bool { return frame.Type == "error" })
+	if frame.Error == nil || frame.Error.Code != "malformed_json" {
+		t.Errorf("expected malformed_json, got %+v", frame.Error)
+	}
+}
+
+func TestWebSocketStreamsTheUserEvents(t *testing.T) {
+	server := setupWebSocketServer(t)
+	conn, _, err := dialWebSocket(t, server, "bob", "bob")
+	if err != nil {
+		t.Fatalf("could not connect: %v", err)
+	}
+
+	// records made over REST, the other user's must not reach bob
+	for _, deposit := range []struct {
+		userId string
+		amount string
+	}{{"carol", "99"}, {"bob", "40"}} {
+		req, _ := http.NewRequest("POST", server.URL+APIPrefix+"/users/"+deposit.userId+"/transactions", strings.NewReader(`{"type":"deposit","amount":`+deposit.amount+`}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+authtest.Token(authtest.Secret, deposit.userId))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", resp.StatusCode)
+		}
+	}
+
+	frame := readFrame(t, conn, func(frame wsFrame) bool { return frame.Type == "event" })
+	if frame.Transaction == nil || frame.Transaction.Amount != 40 {
+		t.Errorf("expected the event of bob's deposit of 40, got %+v", frame.Transaction)
+	}
+}
+
+func TestWebSocketAuthentication(t *testing.T) {
+	server := setupWebSocketServer(t)
+
+	tests := []struct {
+		name           string
+		userId         string
+		subject        string
+		expectedStatus int
+	}{
+		{"Own socket", "dave", "dave", http.StatusSwitchingProtocols},
+		{"Another user's socket", "erin", "dave", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp, err := dialWebSocket(t, server, tt.userId, tt.subject)
+			if resp == nil {
+				t.Fatalf("expected a response, got %v", err)
+			}
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+APIPrefix+"/users/dave/ws", nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without a token, got %v", err)
+	}
+
+	// a plain GET is not a handshake
+	req, _ := http.NewRequest("GET", server.URL+APIPrefix+"/users/dave/ws", nil)
+	req.Header.Set("Authorization", "Bearer "+authtest.Token(authtest.Secret, "dave"))
+	plain, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	plain.Body.Close()
+	if plain.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status 400 for a plain GET, got %d", plain.StatusCode)
+	}
+}
+
+func TestCloseWebSockets(t *testing.T) {
+	router := mux.NewRouter()
+	handler := NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), discardLogger)
+	handler.RegisterRoutes(router, APIPrefix)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+APIPrefix+"/users/erin/ws", nil)
+	if err != nil {
+		t.Fatalf("could not dial: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(wsCommand{Action: "balance", RequestID: "1"}); err != nil {
+		t.Fatalf("could not send the command: %v", err)
+	}
+	readFrame(t, conn, withRequestID("1"))
+
+	handler.CloseWebSockets()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Errorf("expected a going away close frame, got %v", err)
+	}
+}
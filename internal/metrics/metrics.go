@@ -0,0 +1,326 @@
+// Package metrics records the metrics of the ledger so the service and the handlers don't depend on where they go,
+// a Prometheus registry (the default), a StatsD agent or nowhere. a nil *Metrics is valid and records nothing
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"tiny-ledger/internal/buildinfo"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	OutcomeCreated           = "created"
+	OutcomeInsufficientFunds = "insufficient_funds"
+	OutcomeInvalid           = "invalid"
+	OutcomeRejected          = "rejected" // duplicates, unknown users and other business rules
+)
+
+// classes of an error response
+const (
+	ErrorBusiness = "business" // a valid request a business rule refused, e.g. insufficient funds or a duplicate
+	ErrorClient   = "client"   // a request that's malformed, unauthorized, unknown or over the rate limit
+	ErrorServer   = "server"
+)
+
+// outcomes of a webhook delivery
+const (
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"  // every attempt failed
+	DeliveryDropped   = "dropped" // the queue of the target was full
+)
+
+// outcomes of an event of the message bus
+const (
+	BusPublished = "published"
+	BusFailed    = "failed"  // every attempt of its batch failed
+	BusDropped   = "dropped" // the queue of the publisher was full
+)
+
+// the series Metrics emits, the tags are in the comments
+const (
+	nameBuildInfo         = "ledger_build_info"         // version, commit, build_date, goversion
+	nameTransactions      = "ledger_transactions_total" // type, outcome
+	nameInsufficientFunds = "ledger_insufficient_funds_total"
+	nameValidationErrors  = "ledger_validation_errors_total"
+	nameUsers             = "ledger_users"
+	nameTotalBalance      = "ledger_total_balance"
+	nameRequestDuration   = "ledger_http_request_duration_seconds" // route, method, status
+	nameErrorResponses    = "ledger_http_errors_total"             // route, class
+	nameWebhookDeliveries = "ledger_webhook_deliveries_total"      // outcome
+	nameWebhookAttempts   = "ledger_webhook_attempts_total"        // result
+	nameBusEvents         = "ledger_bus_events_total"              // outcome
+	nameOutboxEntries     = "ledger_outbox_entries"                // state
+)
+
+// DefaultGaugeInterval is how often PushGauges reports the gauges, about the scrape interval of Prometheus
+const DefaultGaugeInterval = 10 * time.Second
+
+// StatsFunc reports the current number of users and the sum of their balances, it's called on every scrape
+type StatsFunc func() (userCount int, totalBalance float64)
+
+// Metrics records what happens in the ledger to its Sink
+type Metrics struct {
+	sink   Sink
+	gauges *gauges // shared with the metrics of the tenants
+	ledger bool    // counts transactions, the shared metrics of NewMultiTenant don't
+	tags   []Tag   // of the series of the ledger, the tenant of ForTenant
+}
+
+type Option func(*Metrics)
+
+// WithSink sends the metrics to sink instead of a Prometheus registry
+func WithSink(sink Sink) Option {
+	return func(m *Metrics) {
+		m.sink = sink
+	}
+}
+
+func New(stats StatsFunc, opts ...Option) *Metrics {
+	m := newShared(opts)
+	m.registerLedger(stats)
+	return m
+}
+
+// NewMultiTenant leaves out the series of the ledger, every tenant registers its own with ForTenant
+func NewMultiTenant(opts ...Option) *Metrics {
+	return newShared(opts)
+}
+
+// ForTenant returns the metrics of the ledger of one tenant, its transaction counters and gauges carry a tenant
+// tag. the request durations and the webhooks are shared. it's meant for metrics made with NewMultiTenant and
+// must be called once per tenant
+func (m *Metrics) ForTenant(tenant string, stats StatsFunc) *Metrics {
+	if m == nil {
+		return nil
+	}
+
+	tenantMetrics := *m
+	tenantMetrics.tags = []Tag{{"tenant", tenant}}
+	tenantMetrics.registerLedger(stats)
+	return &tenantMetrics
+}
+
+// newShared creates the metrics with the series that aren't about a single ledger
+func newShared(opts []Option) *Metrics {
+	m := &Metrics{gauges: &gauges{}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.sink == nil {
+		m.sink = NewPrometheus()
+	}
+
+	// the build as the tags of a constant 1, joined on a query when a series should carry it
+	build := buildinfo.Get()
+	m.gauges.add(nameBuildInfo, []Tag{
+		{"version", build.Version}, {"commit", build.Commit}, {"build_date", build.BuildDate}, {"goversion", build.GoVersion},
+	}, func() float64 { return 1 })
+	return m
+}
+
+// registerLedger adds the gauges of a ledger and starts its counters at zero
+func (m *Metrics) registerLedger(stats StatsFunc) {
+	m.ledger = true
+	m.sink.Count(nameInsufficientFunds, 0, m.tags...)
+	m.sink.Count(nameValidationErrors, 0, m.tags...)
+	m.gauges.add(nameUsers, m.tags, func() float64 {
+		users, _ := stats()
+		return float64(users)
+	})
+	m.gauges.add(nameTotalBalance, m.tags, func() float64 {
+		_, balance := stats()
+		return balance
+	})
+}
+
+// RegisterOutbox reports the depth of the outbox with the gauges, depth returns the entries waiting for their
+// delivery and the dead-lettered ones. it must be called once
+func (m *Metrics) RegisterOutbox(depth func() (pending, deadLettered int)) {
+	if m == nil {
+		return
+	}
+	m.gauges.add(nameOutboxEntries, []Tag{{"state", "pending"}}, func() float64 {
+		pending, _ := depth()
+		return float64(pending)
+	})
+	m.gauges.add(nameOutboxEntries, []Tag{{"state", "dead_lettered"}}, func() float64 {
+		_, dead := depth()
+		return float64(dead)
+	})
+}
+
+// ObserveTransaction counts a transaction request, the outcome is one of the Outcome constants
+func (m *Metrics) ObserveTransaction(txType string, outcome string) {
+	// the shared metrics of NewMultiTenant have no ledger to count for
+	if m == nil || !m.ledger {
+		return
+	}
+
+	// the type comes from the client, keep the tag cardinality bounded
+	if txType != "deposit" && txType != "withdrawal" {
+		txType = "invalid"
+	}
+
+	m.sink.Count(nameTransactions, 1, append([]Tag{{"type", txType}, {"outcome", outcome}}, m.tags...)...)
+	switch outcome {
+	case OutcomeInsufficientFunds:
+		m.sink.Count(nameInsufficientFunds, 1, m.tags...)
+	case OutcomeInvalid:
+		m.sink.Count(nameValidationErrors, 1, m.tags...)
+	}
+}
+
+// ObserveWebhookAttempt counts a single POST to a webhook target
+func (m *Metrics) ObserveWebhookAttempt(success bool) {
+	if m == nil {
+		return
+	}
+
+	result := "failure"
+	if success {
+		result = "success"
+	}
+	m.sink.Count(nameWebhookAttempts, 1, Tag{"result", result})
+}
+
+// ObserveWebhookDelivery counts an event once its delivery is settled, the outcome is one of the Delivery constants
+func (m *Metrics) ObserveWebhookDelivery(outcome string) {
+	if m == nil {
+		return
+	}
+	m.sink.Count(nameWebhookDeliveries, 1, Tag{"outcome", outcome})
+}
+
+// ObserveBusEvents counts n events of the message bus once they're settled, the outcome is one of the Bus constants
+func (m *Metrics) ObserveBusEvents(outcome string, n int) {
+	if m == nil {
+		return
+	}
+	m.sink.Count(nameBusEvents, float64(n), Tag{"outcome", outcome})
+}
+
+// PushGauges reports the gauges to the sink every interval until ctx is done, for a sink that isn't scraped. the
+// scrapes of Handler report them otherwise
+func (m *Metrics) PushGauges(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.gauges.report(m.sink)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format, the gauges are read on every scrape. a sink that pushes
+// its metrics answers 404
+func (m *Metrics) Handler() http.Handler {
+	sink, ok := m.sink.(scraped)
+	if !ok {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "the metrics aren't scraped, they are pushed to the configured sink", http.StatusNotFound)
+		})
+	}
+	handler := sink.Handler()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.gauges.report(m.sink)
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Middleware times the requests by route template, so /users/{userId}/balance is a single series
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		m.sink.Histogram(nameRequestDuration, time.Since(start).Seconds(),
+			Tag{"route", route}, Tag{"method", r.Method}, Tag{"status", strconv.Itoa(recorder.status)})
+		if class := errorClass(recorder.status); class != "" {
+			m.sink.Count(nameErrorResponses, 1, Tag{"route", route}, Tag{"class", class})
+		}
+	})
+}
+
+// errorClass tells the business rejections, 409, 412 and 422, from the other 4xx a client can fix by changing the
+// request. empty below 400
+func errorClass(status int) string {
+	switch {
+	case status == http.StatusConflict, status == http.StatusPreconditionFailed, status == http.StatusUnprocessableEntity:
+		return ErrorBusiness
+	case status >= http.StatusInternalServerError:
+		return ErrorServer
+	case status >= http.StatusBadRequest:
+		return ErrorClient
+	}
+	return ""
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streamed responses streaming through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// gauges are the gauges read when they're reported rather than set as things happen
+type gauges struct {
+	mu    sync.Mutex
+	funcs []gaugeFunc
+}
+
+type gaugeFunc struct {
+	name  string
+	tags  []Tag
+	value func() float64
+}
+
+func (g *gauges) add(name string, tags []Tag, value func() float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.funcs = append(g.funcs, gaugeFunc{name: name, tags: tags, value: value})
+}
+
+// report reads every gauge and sets it on sink
+func (g *gauges) report(sink Sink) {
+	g.mu.Lock()
+	funcs := append([]gaugeFunc(nil), g.funcs...)
+	g.mu.Unlock()
+	for _, gauge := range funcs {
+		sink.Gauge(gauge.name, gauge.value(), gauge.tags...)
+	}
+}
@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+
+	"tiny-ledger/internal/buildinfo"
+
+	"github.com/gorilla/mux"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("scrape returned status %d", rr.Code)
+	}
+	body, _ := io.ReadAll(rr.Body)
+	return string(body)
+}
+
+func TestBuildInfo(t *testing.T) {
+	defer func(version, commit string) { buildinfo.Version, buildinfo.Commit = version, commit }(buildinfo.Version, buildinfo.Commit)
+	buildinfo.Version, buildinfo.Commit = "1.4.0", "0123abcd"
+
+	for _, m := range []*Metrics{New(func() (int, float64) { return 0, 0 }), NewMultiTenant()} {
+		if body := scrape(t, m); !strings.Contains(body, `ledger_build_info{build_date="`) ||
+			!strings.Contains(body, `commit="0123abcd",goversion="`+runtime.Version()+`",version="1.4.0"} 1`) {
+			t.Errorf("expected the build info, got:\n%s", body)
+		}
+	}
+}
+
+func TestObserveTransaction(t *testing.T) {
+	m := New(func() (int, float64) { return 3, 125.5 })
+
+	m.ObserveTransaction("deposit", OutcomeCreated)
+	m.ObserveTransaction("deposit", OutcomeCreated)
+	m.ObserveTransaction("withdrawal", OutcomeInsufficientFunds)
+	m.ObserveTransaction("bogus", OutcomeInvalid)
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`ledger_transactions_total{outcome="created",type="deposit"} 2`,
+		`ledger_transactions_total{outcome="insufficient_funds",type="withdrawal"} 1`,
+		`ledger_transactions_total{outcome="invalid",type="invalid"} 1`,
+		`ledger_insufficient_funds_total 1`,
+		`ledger_validation_errors_total 1`,
+		`ledger_users 3`,
+		`ledger_total_balance 125.5`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the scrape", want)
+		}
+	}
+}
+
+func TestForTenant(t *testing.T) {
+	m := NewMultiTenant()
+	alpha := m.ForTenant("alpha", func() (int, float64) { return 1, 10 })
+	beta := m.ForTenant("beta", func() (int, float64) { return 2, 20 })
+
+	alpha.ObserveTransaction("deposit", OutcomeCreated)
+	beta.ObserveTransaction("deposit", OutcomeCreated)
+	beta.ObserveTransaction("deposit", OutcomeCreated)
+	m.ObserveTransaction("deposit", OutcomeCreated)
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`ledger_transactions_total{outcome="created",tenant="alpha",type="deposit"} 1`,
+		`ledger_transactions_total{outcome="created",tenant="beta",type="deposit"} 2`,
+		`ledger_users{tenant="alpha"} 1`,
+		`ledger_total_balance{tenant="beta"} 20`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the scrape", want)
+		}
+	}
+	if strings.Contains(body, "\nledger_users ") {
+		t.Error("expected no ledger series without a tenant")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	m := New(func() (int, float64) { return 0, 0 })
+
+	r := mux.NewRouter()
+	r.Use(m.Middleware)
+	r.HandleFunc("/users/{userId}/balance", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}).Methods("GET")
+
+	for _, userId := range []string{"a", "b"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/"+userId+"/balance", nil))
+	}
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`ledger_http_request_duration_seconds_count{method="GET",route="/users/{userId}/balance",status="404"} 2`,
+		`ledger_http_errors_total{class="client",route="/users/{userId}/balance"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in the scrape", want)
+		}
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := map[int]string{
+		http.StatusOK:                  "",
+		http.StatusNotModified:         "",
+		http.StatusBadRequest:          ErrorClient,
+		http.StatusNotFound:            ErrorClient,
+		http.StatusTooManyRequests:     ErrorClient,
+		http.StatusConflict:            ErrorBusiness,
+		http.StatusPreconditionFailed:  ErrorBusiness,
+		http.StatusUnprocessableEntity: ErrorBusiness,
+		http.StatusServiceUnavailable:  ErrorServer,
+	}
+	for status, expected := range tests {
+		if class := errorClass(status); class != expected {
+			t.Errorf("expected %q for %d, got %q", expected, status, class)
+		}
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	m.ObserveTransaction("deposit", OutcomeCreated)
+
+	rr := httptest.NewRecorder()
+	m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusTeapot {
+		t.Errorf("expected the request to pass through, got status %d", rr.Code)
+	}
+}
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// help is the HELP of every series, the sink takes any name but these are the ones Metrics emits
+var help = map[string]string{
+	nameBuildInfo:         "The build of the server, always 1.",
+	nameTransactions:      "Transaction requests by type and outcome.",
+	nameInsufficientFunds: "Transactions rejected because the balance doesn't cover them.",
+	nameValidationErrors:  "Transactions rejected by input validation.",
+	nameUsers:             "Number of users with a ledger.",
+	nameTotalBalance:      "Sum of the balances of all users.",
+	nameRequestDuration:   "HTTP request duration by route template, method and status.",
+	nameErrorResponses:    "HTTP error responses by route template and class: business, client or server.",
+	nameWebhookDeliveries: "Webhook events by outcome, after the retries.",
+	nameWebhookAttempts:   "Webhook POSTs by result, success or failure.",
+	nameBusEvents:         "Events for the message bus by outcome: published, failed or dropped.",
+	nameOutboxEntries:     "Entries of the outbox waiting for their delivery.",
+}
+
+// Prometheus keeps the metrics in a registry for the scrapes of Handler, with the Go runtime and process
+// collectors. a series is registered on its first call with the keys of its tags as labels, a later call with
+// other keys or of another kind is dropped
+type Prometheus struct {
+	registry *prometheus.Registry
+
+	mu     sync.RWMutex
+	series map[string]*promSeries
+}
+
+type promSeries struct {
+	labels    []string
+	counter   *prometheus.CounterVec
+	gauge     *prometheus.GaugeVec
+	histogram *prometheus.HistogramVec
+}
+
+func NewPrometheus() *Prometheus {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return &Prometheus{registry: registry, series: make(map[string]*promSeries)}
+}
+
+func (p *Prometheus) Count(name string, value float64, tags ...Tag) {
+	// a counter only goes up, Add panics otherwise
+	if s := p.lookup(name, tags, kindCounter); s != nil && value >= 0 {
+		s.counter.With(promLabels(tags)).Add(value)
+	}
+}
+
+func (p *Prometheus) Gauge(name string, value float64, tags ...Tag) {
+	if s := p.lookup(name, tags, kindGauge); s != nil {
+		s.gauge.With(promLabels(tags)).Set(value)
+	}
+}
+
+func (p *Prometheus) Histogram(name string, value float64, tags ...Tag) {
+	if s := p.lookup(name, tags, kindHistogram); s != nil {
+		s.histogram.With(promLabels(tags)).Observe(value)
+	}
+}
+
+// Handler serves the registry in the Prometheus text format
+func (p *Prometheus) Handler() http.Handler {
+	return promhttp.HandlerFor(p.registry, promhttp.HandlerOpts{})
+}
+
+type kind int
+
+const (
+	kindCounter kind = iota
+	kindGauge
+	kindHistogram
+)
+
+// lookup returns the series of name, registered on the first call. nil when the tags or the kind don't match it
+func (p *Prometheus) lookup(name string, tags []Tag, k kind) *promSeries {
+	p.mu.RLock()
+	s, found := p.series[name]
+	p.mu.RUnlock()
+	if !found {
+		p.mu.Lock()
+		if s, found = p.series[name]; !found {
+			s = newPromSeries(name, tags, k)
+			p.registry.MustRegister(s.collector())
+			p.series[name] = s
+		}
+		p.mu.Unlock()
+	}
+
+	if s.kind() != k || len(s.labels) != len(tags) {
+		return nil
+	}
+	for i, tag := range tags {
+		if s.labels[i] != tag.Key {
+			return nil
+		}
+	}
+	return s
+}
+
+func newPromSeries(name string, tags []Tag, k kind) *promSeries {
+	s := &promSeries{labels: make([]string, len(tags))}
+	for i, tag := range tags {
+		s.labels[i] = tag.Key
+	}
+	description := help[name]
+	if description == "" {
+		description = name
+	}
+
+	switch k {
+	case kindCounter:
+		s.counter = prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: description}, s.labels)
+	case kindGauge:
+		s.gauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name, Help: description}, s.labels)
+	case kindHistogram:
+		s.histogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: description, Buckets: prometheus.DefBuckets}, s.labels)
+	}
+	return s
+}
+
+func (s *promSeries) kind() kind {
+	switch {
+	case s.gauge != nil:
+		return kindGauge
+	case s.histogram != nil:
+		return kindHistogram
+	}
+	return kindCounter
+}
+
+func (s *promSeries) collector() prometheus.Collector {
+	switch s.kind() {
+	case kindGauge:
+		return s.gauge
+	case kindHistogram:
+		return s.histogram
+	}
+	return s.counter
+}
+
+func promLabels(tags []Tag) prometheus.Labels {
+	labels := make(prometheus.Labels, len(tags))
+	for _, tag := range tags {
+		labels[tag.Key] = tag.Value
+	}
+	return labels
+}
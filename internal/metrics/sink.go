@@ -0,0 +1,44 @@
+package metrics
+
+import "net/http"
+
+const (
+	SinkPrometheus = "prometheus"
+	SinkStatsD     = "statsd"
+	SinkNone       = "none"
+)
+
+// Sinks are the sinks the server can be configured with
+var Sinks = []string{SinkPrometheus, SinkStatsD, SinkNone}
+
+// Tag is a label of a Prometheus series, a tag of StatsD
+type Tag struct {
+	Key   string
+	Value string
+}
+
+// Sink is where the metrics go, Metrics turns the events of the ledger into these calls. the names are the ones of
+// the Prometheus series and a name always comes with the same tag keys. the calls are on the hot paths, they must
+// not block nor fail
+type Sink interface {
+	// Count adds value to a counter
+	Count(name string, value float64, tags ...Tag)
+	// Gauge sets a gauge
+	Gauge(name string, value float64, tags ...Tag)
+	// Histogram observes a value, e.g. a duration in seconds
+	Histogram(name string, value float64, tags ...Tag)
+}
+
+// scraped is a sink read over HTTP rather than pushed to
+type scraped interface {
+	Handler() http.Handler
+}
+
+// Noop drops everything, for a server without metrics
+var Noop Sink = noop{}
+
+type noop struct{}
+
+func (noop) Count(string, float64, ...Tag)     {}
+func (noop) Gauge(string, float64, ...Tag)     {}
+func (noop) Histogram(string, float64, ...Tag) {}
@@ -0,0 +1,161 @@
+package metrics
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the ways the tags are written into a StatsD line
+const (
+	TagsDatadog = "datadog" // name:1|c|#key:value, DogStatsD
+	TagsInflux  = "influx"  // name,key=value:1|c, the statsd input of Telegraf
+	TagsNone    = "none"    // the tags are left out
+)
+
+// TagFormats are the tag formats NewStatsD takes
+var TagFormats = []string{TagsDatadog, TagsInflux, TagsNone}
+
+type StatsDConfig struct {
+	Addr          string        // host:port of the agent, e.g. 127.0.0.1:8125
+	Namespace     string        // put before every name, "tinyledger." sends tinyledger.ledger_users
+	TagFormat     string        // one of TagFormats, TagsDatadog when empty
+	FlushInterval time.Duration // longest a line waits for its datagram to fill up, 1s by default
+	MaxPacketSize int           // of a datagram, 1432 bytes by default so it fits an Ethernet frame
+}
+
+// StatsD sends the metrics over UDP to a StatsD agent, the lines are batched into datagrams. the counters and the
+// histograms are sent as they're recorded (histograms as h, which DogStatsD and Telegraf take), the gauges when
+// Metrics.PushGauges reports them. a line that can't be sent is lost, the agent being down never slows the ledger
+type StatsD struct {
+	config   StatsDConfig
+	conn     net.Conn
+	replacer *strings.Replacer // of the characters of the line format in the names and the tags
+
+	mu     sync.Mutex
+	buffer []byte
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewStatsD resolves the address of the agent and starts the flushes, Close stops them
+func NewStatsD(config StatsDConfig) (*StatsD, error) {
+	if config.TagFormat == "" {
+		config.TagFormat = TagsDatadog
+	}
+	switch config.TagFormat {
+	case TagsDatadog, TagsInflux, TagsNone:
+	default:
+		return nil, fmt.Errorf("unknown tag format %q, use one of %s", config.TagFormat, strings.Join(TagFormats, ", "))
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = time.Second
+	}
+	if config.MaxPacketSize <= 0 {
+		config.MaxPacketSize = 1432
+	}
+
+	conn, err := net.Dial("udp", config.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd agent %s: %w", config.Addr, err)
+	}
+	s := &StatsD{
+		config:   config,
+		conn:     conn,
+		replacer: strings.NewReplacer(":", "_", "|", "_", "@", "_", ",", "_", "=", "_", "#", "_", " ", "_", "\n", "_"),
+		buffer:   make([]byte, 0, config.MaxPacketSize),
+		done:     make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+func (s *StatsD) Count(name string, value float64, tags ...Tag) {
+	s.write(name, value, "c", tags)
+}
+
+func (s *StatsD) Gauge(name string, value float64, tags ...Tag) {
+	s.write(name, value, "g", tags)
+}
+
+func (s *StatsD) Histogram(name string, value float64, tags ...Tag) {
+	s.write(name, value, "h", tags)
+}
+
+// Close sends what's buffered and closes the socket
+func (s *StatsD) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flush()
+	return s.conn.Close()
+}
+
+// line formats a metric in the tag format of the config
+func (s *StatsD) line(name string, value float64, kind string, tags []Tag) string {
+	var b strings.Builder
+	b.WriteString(s.config.Namespace)
+	b.WriteString(s.replacer.Replace(name))
+	if s.config.TagFormat == TagsInflux {
+		for _, tag := range tags {
+			b.WriteString("," + s.replacer.Replace(tag.Key) + "=" + s.replacer.Replace(tag.Value))
+		}
+	}
+	b.WriteString(":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + kind)
+	if s.config.TagFormat == TagsDatadog && len(tags) > 0 {
+		for i, tag := range tags {
+			separator := ","
+			if i == 0 {
+				separator = "|#"
+			}
+			b.WriteString(separator + s.replacer.Replace(tag.Key) + ":" + s.replacer.Replace(tag.Value))
+		}
+	}
+	return b.String()
+}
+
+// write adds the line to the datagram, which is sent first when the line doesn't fit
+func (s *StatsD) write(name string, value float64, kind string, tags []Tag) {
+	line := s.line(name, value, kind, tags)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.buffer) > 0 && len(s.buffer)+1+len(line) > s.config.MaxPacketSize {
+		s.flush()
+	}
+	if len(s.buffer) > 0 {
+		s.buffer = append(s.buffer, '\n')
+	}
+	s.buffer = append(s.buffer, line...)
+}
+
+// flush sends the datagram, the caller holds mu. the error of a write is dropped with the datagram
+func (s *StatsD) flush() {
+	if len(s.buffer) == 0 {
+		return
+	}
+	_, _ = s.conn.Write(s.buffer)
+	s.buffer = s.buffer[:0]
+}
+
+func (s *StatsD) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			s.flush()
+			s.mu.Unlock()
+		}
+	}
+}
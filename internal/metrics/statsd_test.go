@@ -0,0 +1,147 @@
+package metrics
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// agent is a fake StatsD agent, it collects the lines of the datagrams it receives
+type agent struct {
+	conn  net.PacketConn
+	lines chan string
+}
+
+func newAgent(t *testing.T) *agent {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	a := &agent{conn: conn, lines: make(chan string, 100)}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			for _, line := range strings.Split(string(buf[:n]), "\n") {
+				a.lines <- line
+			}
+		}
+	}()
+	return a
+}
+
+// expect waits for the lines in any order, the others are ignored
+func (a *agent) expect(t *testing.T, want ...string) {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for len(want) > 0 {
+		select {
+		case line := <-a.lines:
+			if i := slices.Index(want, line); i >= 0 {
+				want = slices.Delete(want, i, i+1)
+			}
+		case <-timeout:
+			t.Fatalf("expected the lines %q", want)
+		}
+	}
+}
+
+func newTestStatsD(t *testing.T, a *agent, tagFormat string) *StatsD {
+	t.Helper()
+	s, err := NewStatsD(StatsDConfig{Addr: a.conn.LocalAddr().String(), Namespace: "tl.", TagFormat: tagFormat, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("failed to create the sink: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestStatsD(t *testing.T) {
+	a := newAgent(t)
+	m := New(func() (int, float64) { return 3, 125.5 }, WithSink(newTestStatsD(t, a, TagsDatadog)))
+
+	m.ObserveTransaction("deposit", OutcomeCreated)
+	m.ObserveTransaction("withdrawal", OutcomeInsufficientFunds)
+	m.ObserveWebhookDelivery(DeliveryDelivered)
+	a.expect(t,
+		"tl.ledger_transactions_total:1|c|#type:deposit,outcome:created",
+		"tl.ledger_transactions_total:1|c|#type:withdrawal,outcome:insufficient_funds",
+		"tl.ledger_insufficient_funds_total:1|c",
+		"tl.ledger_webhook_deliveries_total:1|c|#outcome:delivered",
+	)
+
+	r := mux.NewRouter()
+	r.Use(m.Middleware)
+	r.HandleFunc("/users/{userId}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/alice", nil))
+	a.expect(t, "tl.ledger_http_errors_total:1|c|#route:/users/{userId},class:client")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.PushGauges(ctx, time.Hour)
+	a.expect(t, "tl.ledger_users:3|g", "tl.ledger_total_balance:125.5|g")
+
+	// the metrics are pushed, there's nothing to scrape
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a scrape, got %d", rr.Code)
+	}
+}
+
+func TestStatsDTagFormats(t *testing.T) {
+	for _, tc := range []struct {
+		format, want string
+	}{
+		{TagsDatadog, "tl.ledger_users:2|g|#tenant:acme_corp"},
+		{TagsInflux, "tl.ledger_users,tenant=acme_corp:2|g"},
+		{TagsNone, "tl.ledger_users:2|g"},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			a := newAgent(t)
+			s := newTestStatsD(t, a, tc.format)
+			// the characters of the line format are replaced
+			s.Gauge(nameUsers, 2, Tag{"tenant", "acme:corp"})
+			a.expect(t, tc.want)
+		})
+	}
+
+	if _, err := NewStatsD(StatsDConfig{Addr: "127.0.0.1:8125", TagFormat: "graphite"}); err == nil {
+		t.Error("expected an error for an unknown tag format")
+	}
+}
+
+func TestStatsDBatchesLines(t *testing.T) {
+	a := newAgent(t)
+	s, err := NewStatsD(StatsDConfig{Addr: a.conn.LocalAddr().String(), FlushInterval: time.Hour, MaxPacketSize: 64})
+	if err != nil {
+		t.Fatalf("failed to create the sink: %v", err)
+	}
+
+	// 2 lines of 25 bytes fill a datagram, the third sends it and the last two wait for Close
+	for range 4 {
+		s.Count("ledger_requests_total", 1)
+	}
+	a.expect(t, "ledger_requests_total:1|c", "ledger_requests_total:1|c")
+	select {
+	case line := <-a.lines:
+		t.Fatalf("expected the last lines to wait for Close, got %q", line)
+	case <-time.After(50 * time.Millisecond):
+	}
+	s.Close()
+	a.expect(t, "ledger_requests_total:1|c", "ledger_requests_total:1|c")
+}
@@ -0,0 +1,41 @@
+package models
+
+import "github.com/google/uuid"
+
+// JournalEntry is a single leg of a journal, a transaction on the ledger of one user
+type JournalEntry struct {
+	UserID       string            `json:"userId"`
+	Transaction  TransactionRecord `json:"transaction"`
+	BalanceAfter *float64          `json:"balanceAfter,omitempty"` // the user's balance right after the leg, only when just posted
+}
+
+// Journal groups the legs that were applied atomically, the signed amounts of the legs always sum to zero
+type Journal struct {
+	ID         uuid.UUID      `json:"id"`
+	Entries    []JournalEntry `json:"entries"`
+	ReversalOf *uuid.UUID     `json:"reversalOf,omitempty"`
+	ReversedBy *uuid.UUID     `json:"reversedBy,omitempty"`
+}
+
+type EntryDirection string
+
+const (
+	Debit  EntryDirection = "debit"  // money leaves the user's ledger
+	Credit EntryDirection = "credit" // money enters the user's ledger
+)
+
+// JournalLeg is the input for one leg of a journal
+type JournalLeg struct {
+	UserID      string         `json:"userId"`
+	Direction   EntryDirection `json:"direction"`
+	Amount      float64        `json:"amount"`
+	Description string         `json:"description,omitempty"`
+}
+
+// TransactionType is the type of the record the leg produces on the user's ledger
+func (l JournalLeg) TransactionType() TransactionType {
+	if l.Direction == Debit {
+		return Withdrawal
+	}
+	return Deposit
+}
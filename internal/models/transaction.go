@@ -20,19 +20,38 @@ type Transaction struct {
 }
 
 type TransactionRecord struct {
-	ID          uuid.UUID       `json:"id"`
-	Amount      float64         `json:"amount"`
-	Type        TransactionType `json:"type"`
-	Timestamp   time.Time       `json:"timestamp"`
-	Description string          `json:"description,omitempty"`
+	ID             uuid.UUID         `json:"id"`
+	Amount         float64           `json:"amount"`
+	Fee            float64           `json:"fee,omitempty"` // charged on top of the amount of a withdrawal
+	Type           TransactionType   `json:"type"`
+	Timestamp      time.Time         `json:"timestamp"`
+	Description    string            `json:"description,omitempty"`
+	ReferenceID    string            `json:"referenceId,omitempty"` // external reference, unique per user
+	JournalID      *uuid.UUID        `json:"journalId,omitempty"`   // set on every leg of a journal entry (e.g. transfers)
+	ReversalOf     *uuid.UUID        `json:"reversalOf,omitempty"`  // the transaction this record reverses
+	ReversedBy     *uuid.UUID        `json:"reversedBy,omitempty"`  // the transaction that reversed this record
+	ReversalReason string            `json:"reversalReason,omitempty"`
+	Edits          []DescriptionEdit `json:"edits,omitempty"`  // history of description changes, oldest first
+	Voided         bool              `json:"voided,omitempty"` // voided records stay visible but don't affect the balance
+	VoidedAt       *time.Time        `json:"voidedAt,omitempty"`
+	VoidReason     string            `json:"voidReason,omitempty"`
+
+	IdempotencyKey string `json:"-"` // client supplied retry key, unique per user
+}
+
+// DescriptionEdit keeps the description a transaction had before an edit
+type DescriptionEdit struct {
+	PreviousDescription string    `json:"previousDescription" xml:"previousDescription"`
+	EditedAt            time.Time `json:"editedAt" xml:"editedAt"`
 }
 
-func NewTransactionRecord(transactionType TransactionType, amount float64, description string) TransactionRecord {
+// NewTransactionRecord is a new record stamped with timestamp, the time of the caller's clock
+func NewTransactionRecord(transactionType TransactionType, amount float64, description string, timestamp time.Time) TransactionRecord {
 	return TransactionRecord{
 		ID:          uuid.New(),
 		Amount:      amount,
 		Type:        transactionType,
-		Timestamp:   time.Now(),
+		Timestamp:   timestamp,
 		Description: description,
 	}
 }
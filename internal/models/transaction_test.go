@@ -2,14 +2,15 @@ package models
 
 import (
 	"testing"
-	"time"
+
+	"tiny-ledger/internal/clock/clocktest"
 )
 
 func TestNewTransactionRecord(t *testing.T) {
 	amount := 100.0
 	description := "Test transaction"
 
-	tx := NewTransactionRecord(Deposit, amount, description)
+	tx := NewTransactionRecord(Deposit, amount, description, clocktest.Start)
 
 	if tx.Amount != amount {
 		t.Errorf("Expected amount %f, got %f", amount, tx.Amount)
@@ -27,13 +28,11 @@ func TestNewTransactionRecord(t *testing.T) {
 		t.Errorf("Expected a valid UUID, got zero UUID")
 	}
 
-	now := time.Now()
-	timeDiff := now.Sub(tx.Timestamp)
-	if timeDiff < 0 || timeDiff > time.Second {
-		t.Errorf("Expected timestamp to be close to now, difference was %v", timeDiff)
+	if !tx.Timestamp.Equal(clocktest.Start) {
+		t.Errorf("Expected timestamp %v, got %v", clocktest.Start, tx.Timestamp)
 	}
 
-	withdrawalTx := NewTransactionRecord(Withdrawal, amount, description)
+	withdrawalTx := NewTransactionRecord(Withdrawal, amount, description, clocktest.Start)
 	if withdrawalTx.Type != Withdrawal {
 		t.Errorf("Expected type %s, got %s", Withdrawal, withdrawalTx.Type)
 	}
@@ -0,0 +1,202 @@
+// Package outbox delivers the outbox of the store to the sinks, the webhooks and the event bus, instead of the
+// fire-and-forget subscribers: an event is only removed once every sink took it, so a dispatcher stopped between
+// the write and the delivery leaves it for the next one. the delivery is at least once, the sinks repeat the event
+// id so the receivers drop duplicates
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"tiny-ledger/internal/clock"
+	"tiny-ledger/internal/eventbus"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+	"tiny-ledger/internal/webhook"
+)
+
+// Sink is a destination of the entries, Deliver returns once it took all of them and an error retries all of them
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, entries []store.OutboxEntry) error
+}
+
+type Config struct {
+	Store *store.LedgerStore // made WithOutbox
+	Sinks []Sink
+
+	BatchSize      int           // entries per delivery, 100 by default
+	PollInterval   time.Duration // how often the outbox is read when it was empty, 100ms by default
+	MaxAttempts    int           // of an entry before it's dead-lettered, 10 by default
+	InitialBackoff time.Duration // before the first retry, doubled on every retry up to MaxBackoff. 1s by default
+	MaxBackoff     time.Duration // 5m by default
+	Timeout        time.Duration // of a delivery to a sink, 10s by default
+
+	Logger *slog.Logger // slog.Default() when nil
+	Clock  clock.Clock  // of the retries, clock.Real when nil
+}
+
+type Dispatcher struct {
+	config Config
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New starts the dispatcher, Close stops it
+func New(config Config) *Dispatcher {
+	if config.BatchSize < 1 {
+		config.BatchSize = 100
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = 100 * time.Millisecond
+	}
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 10
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = time.Second
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 5 * time.Minute
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+
+	d := &Dispatcher{config: config}
+	var ctx context.Context
+	ctx, d.cancel = context.WithCancel(context.Background())
+	d.wg.Add(1)
+	go d.run(ctx)
+	return d
+}
+
+// Close stops the dispatcher, a delivery in flight is cancelled and its entries stay in the outbox
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) run(ctx context.Context) {
+	defer d.wg.Done()
+
+	for {
+		// a full batch is likely followed by more, the outbox is read again right away
+		if len(d.dispatch(ctx)) == d.config.BatchSize {
+			continue
+		}
+		timer := time.NewTimer(d.config.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// dispatch delivers the entries that are due to every sink and returns them
+func (d *Dispatcher) dispatch(ctx context.Context) []store.OutboxEntry {
+	entries := d.config.Store.OutboxPending(d.config.Clock.Now(), d.config.BatchSize)
+	if len(entries) == 0 {
+		return nil
+	}
+	ids := make([]uint64, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+
+	for _, sink := range d.config.Sinks {
+		deliverCtx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+		err := sink.Deliver(deliverCtx, entries)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			d.failed(entries, sink.Name(), err)
+			return entries
+		}
+	}
+	d.config.Store.OutboxDelivered(ids...)
+	return entries
+}
+
+// failed schedules the retry of every entry after the backoff of its attempts, or dead-letters it
+func (d *Dispatcher) failed(entries []store.OutboxEntry, sink string, err error) {
+	var dead int
+	for _, entry := range entries {
+		attempts := entry.Attempts + 1
+		backoff := d.config.InitialBackoff
+		for range attempts - 1 {
+			backoff = min(backoff*2, d.config.MaxBackoff)
+		}
+		deadLetter := attempts >= d.config.MaxAttempts
+		if deadLetter {
+			dead++
+		}
+		d.config.Store.OutboxFailed(entry.ID, sink+": "+err.Error(), d.config.Clock.Now().Add(backoff), deadLetter)
+	}
+
+	if dead > 0 {
+		d.config.Logger.Error("outbox delivery failed, entries dead-lettered", "sink", sink, "entries", len(entries), "dead_lettered", dead, "error", err)
+		return
+	}
+	d.config.Logger.Warn("outbox delivery failed, retrying", "sink", sink, "entries", len(entries), "attempt", entries[0].Attempts+1, "error", err)
+}
+
+// transactionEvent is the event of the subscribers the entry stands for
+func transactionEvent(entry store.OutboxEntry) services.TransactionEvent {
+	return services.TransactionEvent{UserID: entry.UserID, Transaction: entry.Transaction, Balance: entry.Balance}
+}
+
+type webhookSink struct {
+	dispatcher *webhook.Dispatcher
+}
+
+// WebhookSink POSTs the entries to the targets of the dispatcher, one by one. the delivery ID is the event id
+func WebhookSink(dispatcher *webhook.Dispatcher) Sink {
+	return webhookSink{dispatcher: dispatcher}
+}
+
+func (s webhookSink) Name() string {
+	return "webhook"
+}
+
+func (s webhookSink) Deliver(ctx context.Context, entries []store.OutboxEntry) error {
+	for _, entry := range entries {
+		if err := s.dispatcher.Deliver(ctx, entry.EventID, transactionEvent(entry), entry.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type busSink struct {
+	publisher *eventbus.Publisher
+}
+
+// BusSink publishes the entries to the event bus in one batch, the id of the events is the event id
+func BusSink(publisher *eventbus.Publisher) Sink {
+	return busSink{publisher: publisher}
+}
+
+func (s busSink) Name() string {
+	return "event_bus"
+}
+
+func (s busSink) Deliver(ctx context.Context, entries []store.OutboxEntry) error {
+	events := make([]eventbus.Pending, len(entries))
+	for i, entry := range entries {
+		events[i] = eventbus.Pending{ID: entry.EventID, Event: transactionEvent(entry), Timestamp: entry.CreatedAt}
+	}
+	return s.publisher.Deliver(ctx, events)
+}
@@ -0,0 +1,147 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/eventbus"
+	"tiny-ledger/internal/eventbus/eventbustest"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+var discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// fakeSink keeps what it took, or fails while failing is set
+type fakeSink struct {
+	mu       sync.Mutex
+	failing  bool
+	attempts int
+	taken    []store.OutboxEntry
+}
+
+func (s *fakeSink) Name() string {
+	return "fake"
+}
+
+func (s *fakeSink) Deliver(ctx context.Context, entries []store.OutboxEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts++
+	if s.failing {
+		return errors.New("sink unavailable")
+	}
+	s.taken = append(s.taken, entries...)
+	return nil
+}
+
+func (s *fakeSink) setFailing(failing bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failing = failing
+}
+
+func (s *fakeSink) state() (attempts int, taken []store.OutboxEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attempts, append([]store.OutboxEntry(nil), s.taken...)
+}
+
+func newTestDispatcher(t *testing.T, ledgerStore *store.LedgerStore, sinks ...Sink) *Dispatcher {
+	t.Helper()
+
+	d := New(Config{Store: ledgerStore, Sinks: sinks, PollInterval: time.Millisecond, MaxAttempts: 3, InitialBackoff: time.Millisecond, Logger: discardLogger})
+	t.Cleanup(d.Close)
+	return d
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRestartDeliversTheOutbox(t *testing.T) {
+	ledgerStore := store.NewLedgerStore(store.WithOutbox())
+	svc := services.NewLedgerService(ledgerStore)
+
+	// the records are committed while the sink is down, then the dispatcher dies
+	sink := &fakeSink{failing: true}
+	crashed := newTestDispatcher(t, ledgerStore, sink)
+	for i := 1; i <= 3; i++ {
+		svc.RecordTransaction("alice", models.Deposit, float64(i), "")
+		svc.RecordTransaction("bob", models.Deposit, float64(i*10), "")
+	}
+	waitFor(t, func() bool { attempts, _ := sink.state(); return attempts > 0 })
+	crashed.Close()
+	pending := ledgerStore.OutboxPending(time.Now().Add(time.Hour), 100)
+	if len(pending) != 6 {
+		t.Fatalf("expected the 6 records in the outbox, got %d", len(pending))
+	}
+
+	// the next dispatcher finds them and publishes them with the same event ids, in the order of every user
+	broker := eventbustest.NewBroker()
+	publisher, err := eventbus.New(eventbus.Config{Broker: broker, Topic: "ledger", Logger: discardLogger})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer publisher.Close(context.Background())
+	newTestDispatcher(t, ledgerStore, BusSink(publisher))
+
+	events := broker.WaitFor(t, "ledger", 6)
+	last := map[string]float64{}
+	for i, event := range events {
+		if event.ID != pending[i].EventID {
+			t.Errorf("expected the event id of the entry %v, got %v", pending[i].EventID, event.ID)
+		}
+		if event.Transaction.Amount <= last[event.UserID] {
+			t.Errorf("%s: %v delivered after %v", event.UserID, event.Transaction.Amount, last[event.UserID])
+		}
+		last[event.UserID] = event.Transaction.Amount
+	}
+	waitFor(t, func() bool { return ledgerStore.OutboxStats() == store.OutboxStats{} })
+}
+
+func TestDeadLetterAndRequeue(t *testing.T) {
+	ledgerStore := store.NewLedgerStore(store.WithOutbox())
+	sink := &fakeSink{failing: true}
+	newTestDispatcher(t, ledgerStore, sink)
+
+	ledgerStore.AddTransaction("alice", models.Deposit, 10, "")
+	waitFor(t, func() bool { return ledgerStore.OutboxStats().DeadLettered == 1 })
+	if attempts, _ := sink.state(); attempts != 3 {
+		t.Errorf("expected 3 attempts before the dead letter, got %d", attempts)
+	}
+	dead := ledgerStore.OutboxDeadLetters()[0]
+	if dead.Attempts != 3 || dead.LastError != "fake: sink unavailable" {
+		t.Errorf("unexpected dead letter %+v", dead)
+	}
+
+	// the dead letter doesn't hold up the next records
+	sink.setFailing(false)
+	ledgerStore.AddTransaction("alice", models.Deposit, 20, "")
+	waitFor(t, func() bool { _, taken := sink.state(); return len(taken) == 1 })
+
+	if _, err := ledgerStore.RequeueOutbox(dead.ID, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitFor(t, func() bool { _, taken := sink.state(); return len(taken) == 2 })
+	if _, taken := sink.state(); taken[1].EventID != dead.EventID {
+		t.Errorf("expected the requeued entry delivered, got %+v", taken[1])
+	}
+	if _, err := ledgerStore.RequeueOutbox(dead.ID, time.Now()); !errors.Is(err, store.ErrOutboxEntryNotFound) {
+		t.Errorf("expected ErrOutboxEntryNotFound once delivered, got %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Package ratelimit keeps one token bucket per key, buckets that have been idle long enough to refill are evicted
+// so the memory follows the number of active clients
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type Limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+	now   func() time.Time
+
+	// a bucket idle for this long is full again and can be dropped, it's also how often the buckets are swept
+	idleAfter time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Decision is the outcome of a request, Remaining is what's left after it and RetryAfter is set when it's denied.
+// Reset is how long until the bucket is full again, all measured on the clock of the limiter
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+type Option func(*Limiter)
+
+// WithClock replaces time.Now, for tests
+func WithClock(now func() time.Time) Option {
+	return func(l *Limiter) {
+		l.now = now
+	}
+}
+
+// New allows rate requests per second on average and bursts of up to burst requests per key
+func New(rate float64, burst int, opts ...Option) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l := &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	l.idleAfter = idleAfter(rate, l.burst)
+	l.lastSweep = l.now()
+	return l
+}
+
+// SetLimit changes the rate and the burst of every key, the buckets keep their tokens up to the new burst
+func (l *Limiter) SetLimit(rate float64, burst int) {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst = rate, float64(burst)
+	l.idleAfter = idleAfter(rate, l.burst)
+	for _, b := range l.buckets {
+		b.tokens = math.Min(b.tokens, l.burst)
+	}
+}
+
+func idleAfter(rate, burst float64) time.Duration {
+	return max(time.Duration(burst/rate*float64(time.Second)), time.Second)
+}
+
+func (l *Limiter) Allow(key string) Decision {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(l.burst, b.tokens+elapsed*l.rate)
+	}
+	b.last = now
+
+	decision := Decision{Limit: int(l.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	decision.Remaining = int(b.tokens)
+	decision.Reset = time.Duration((l.burst - b.tokens) / l.rate * float64(time.Second))
+	return decision
+}
+
+// sweep drops the buckets that would be full by now, a new bucket starts full so nothing is lost
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.idleAfter {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.idleAfter {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Len is the number of buckets currently tracked
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
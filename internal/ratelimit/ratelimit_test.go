@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func TestLimiterBurst(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := New(2, 3, WithClock(clock.Now))
+
+	for i := 0; i < 3; i++ {
+		decision := limiter.Allow("user1")
+		if !decision.Allowed {
+			t.Fatalf("expected request %d of the burst to be allowed", i+1)
+		}
+		if decision.Remaining != 2-i {
+			t.Errorf("expected %d remaining, got %d", 2-i, decision.Remaining)
+		}
+		if expected := time.Duration(i+1) * 500 * time.Millisecond; decision.Reset != expected {
+			t.Errorf("expected a reset after %v, got %v", expected, decision.Reset)
+		}
+	}
+
+	decision := limiter.Allow("user1")
+	if decision.Allowed {
+		t.Fatalf("expected the request past the burst to be denied")
+	}
+	if decision.RetryAfter != 500*time.Millisecond {
+		t.Errorf("expected retry after 500ms, got %v", decision.RetryAfter)
+	}
+	if decision.Reset != 1500*time.Millisecond {
+		t.Errorf("expected a denied request to leave the reset at 1.5s, got %v", decision.Reset)
+	}
+
+	if !limiter.Allow("user2").Allowed {
+		t.Errorf("expected another key to have its own bucket")
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if !limiter.Allow("user1").Allowed {
+		t.Errorf("expected a request to be allowed after the retry delay")
+	}
+	if limiter.Allow("user1").Allowed {
+		t.Errorf("expected the refilled token to be used up")
+	}
+}
+
+func TestLimiterEvictsIdleBuckets(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := New(1, 5, WithClock(clock.Now))
+
+	for i := 0; i < 100; i++ {
+		limiter.Allow(fmt.Sprintf("ip-%d", i))
+	}
+	if limiter.Len() != 100 {
+		t.Fatalf("expected 100 buckets, got %d", limiter.Len())
+	}
+
+	// 5 tokens at 1/s are refilled after 5 seconds
+	clock.Advance(5 * time.Second)
+	limiter.Allow("active")
+	if limiter.Len() != 1 {
+		t.Errorf("expected the idle buckets to be evicted, got %d buckets", limiter.Len())
+	}
+
+	limiter.Allow("ip-1")
+	if decision := limiter.Allow("ip-1"); decision.Remaining != 3 {
+		t.Errorf("expected an evicted key to start with a full bucket, got %d remaining", decision.Remaining)
+	}
+}
+
+func TestLimiterSetLimit(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	limiter := New(1, 5, WithClock(clock.Now))
+	limiter.Allow("user1")
+
+	// the bucket had 4 tokens left, it keeps 2 of them
+	limiter.SetLimit(10, 2)
+	for i := 0; i < 2; i++ {
+		if decision := limiter.Allow("user1"); !decision.Allowed || decision.Limit != 2 {
+			t.Fatalf("expected request %d to be allowed with the new burst, got %+v", i+1, decision)
+		}
+	}
+	decision := limiter.Allow("user1")
+	if decision.Allowed || decision.RetryAfter != 100*time.Millisecond {
+		t.Errorf("expected to wait for a token at the new rate, got %+v", decision)
+	}
+}
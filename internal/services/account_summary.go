@@ -0,0 +1,51 @@
+package services
+
+import "time"
+
+// AccountSummary is the overview of a single account, RoundingPolicy tells how the amounts were rounded. Exists is
+// false for a user the ledger has never seen, which only happens outside strict accounts
+type AccountSummary struct {
+	UserID           string         `json:"userId"`
+	Exists           bool           `json:"exists"`
+	Balance          float64        `json:"balance"`
+	Currency         string         `json:"currency"`
+	TotalDeposits    float64        `json:"totalDeposits"`
+	TotalWithdrawals float64        `json:"totalWithdrawals"`
+	TotalFees        float64        `json:"totalFees"`
+	TransactionCount int            `json:"transactionCount"`
+	DepositCount     int            `json:"depositCount"`
+	WithdrawalCount  int            `json:"withdrawalCount"`
+	VoidedCount      int            `json:"voidedCount"`
+	FirstActivity    *time.Time     `json:"firstActivity,omitempty"` // left out without any record
+	LastActivity     *time.Time     `json:"lastActivity,omitempty"`
+	RoundingPolicy   RoundingPolicy `json:"roundingPolicy"`
+}
+
+func (s *ledgerService) GetAccountSummary(userId string) (AccountSummary, error) {
+	if err := validateUserId(userId); err != nil {
+		return AccountSummary{}, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return AccountSummary{}, err
+	}
+
+	totals := s.store.GetAccountTotals(userId)
+
+	return AccountSummary{
+		UserID:           userId,
+		Exists:           s.store.UserExists(userId),
+		Balance:          s.round(totals.Balance),
+		Currency:         s.config.Load().Currency,
+		TotalDeposits:    s.round(totals.TotalDeposits),
+		TotalWithdrawals: s.round(totals.TotalWithdrawals),
+		TotalFees:        s.round(totals.TotalFees),
+		TransactionCount: totals.TransactionCount,
+		DepositCount:     totals.DepositCount,
+		WithdrawalCount:  totals.WithdrawalCount,
+		VoidedCount:      totals.VoidedCount,
+		FirstActivity:    totals.FirstActivity,
+		LastActivity:     totals.LastActivity,
+		RoundingPolicy:   s.config.Load().RoundingPolicy,
+	}, nil
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestGetAccountSummary(t *testing.T) {
+	tests := []struct {
+		policy          RoundingPolicy
+		expectedBalance float64
+	}{
+		{RoundHalfUp, 7.63},
+		{RoundHalfEven, 7.62},
+		{RoundTruncate, 7.62},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.policy), func(t *testing.T) {
+			config := DefaultConfig()
+			config.RoundingPolicy = test.policy
+			svc := NewLedgerService(store.NewLedgerStore(), WithConfig(config))
+
+			svc.RecordTransaction("user1", models.Deposit, 10.125, "interest bearing")
+			svc.RecordTransaction("user1", models.Withdrawal, 2.5, "coffee")
+
+			summary, err := svc.GetAccountSummary("user1")
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			if summary.RoundingPolicy != test.policy {
+				t.Errorf("expected rounding policy %q, got %q", test.policy, summary.RoundingPolicy)
+			}
+			if summary.Balance != test.expectedBalance {
+				t.Errorf("expected balance %v, got %v", test.expectedBalance, summary.Balance)
+			}
+			if !summary.Exists || summary.TotalWithdrawals != 2.5 || summary.TransactionCount != 2 || summary.DepositCount != 1 || summary.WithdrawalCount != 1 {
+				t.Errorf("unexpected totals: %+v", summary)
+			}
+		})
+	}
+}
+
+func TestGetAccountSummary_UnknownUser(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	summary, err := svc.GetAccountSummary("nobody")
+	if err != nil || summary.Exists || summary.Balance != 0 || summary.TransactionCount != 0 || summary.FirstActivity != nil {
+		t.Errorf("expected an empty summary in permissive mode, got %+v (%v)", summary, err)
+	}
+
+	config := DefaultConfig()
+	config.StrictAccounts = true
+	svc = NewLedgerService(store.NewLedgerStore(), WithConfig(config))
+	if _, err := svc.GetAccountSummary("nobody"); !errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound in strict mode, got %v", err)
+	}
+}
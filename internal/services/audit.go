@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"tiny-ledger/internal/audit"
+	"tiny-ledger/internal/store"
+)
+
+// audited operations, Event.Operation
+const (
+	operationRecordTransaction = "transaction.record"
+	operationRecordBatch       = "transaction.batch"
+	operationImportBankFile    = "transaction.import"
+	operationExternalPayment   = "transaction.external_payment"
+	operationReverse           = "transaction.reverse"
+	operationVoid              = "transaction.void"
+	operationDescribe          = "transaction.describe"
+	operationTransfer          = "transfer"
+	operationPostJournal       = "journal.post"
+	operationCreateUser        = "user.create"
+	operationDeleteUser        = "user.delete"
+	operationAnonymizeUser     = "user.anonymize"
+	operationMinimumBalance    = "user.minimum_balance"
+)
+
+// WithAuditLog records the operations in log instead of a log of the service's own
+func WithAuditLog(log *audit.Log) Option {
+	return func(s *ledgerService) {
+		s.auditLog = log
+	}
+}
+
+// auditErrorCodes name the business rules of the store and the service in the events, the first match wins
+var auditErrorCodes = []struct {
+	err  error
+	code string
+}{
+	{store.ErrInsufficientFunds, "insufficient_funds"},
+	{store.ErrMinimumBalance, "minimum_balance"},
+	{store.ErrPossibleDuplicate, "possible_duplicate"},
+	{store.ErrDuplicateReference, "duplicate_reference"},
+	{store.ErrIdempotencyKeyTaken, "idempotency_key_reused"},
+	{ErrIdempotencyKeyReused, "idempotency_key_reused"},
+	{store.ErrUserNotFound, "user_not_found"},
+	{store.ErrUserExists, "user_exists"},
+	{store.ErrTransactionNotFound, "transaction_not_found"},
+	{store.ErrJournalNotFound, "journal_not_found"},
+	{store.ErrAlreadyReversed, "already_reversed"},
+	{store.ErrReversalOfReversal, "reversal_of_reversal"},
+	{store.ErrReverseJournalLeg, "journal_leg"},
+	{store.ErrAlreadyVoided, "already_voided"},
+	{store.ErrVoidJournalLeg, "journal_leg"},
+	{store.ErrBalanceNotZero, "balance_not_zero"},
+	{store.ErrUserHasJournals, "has_journals"},
+	{store.ErrVersionMismatch, "version_mismatch"},
+	{context.DeadlineExceeded, "timeout"},
+	{context.Canceled, "canceled"},
+}
+
+// auditErrorCode is the ErrorCode of a failed operation: the rule of a validation error, the name of a known error,
+// "internal" for anything else
+func auditErrorCode(err error) string {
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return validationErr.Code
+	}
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		return "invalid_batch"
+	}
+	for _, candidate := range auditErrorCodes {
+		if errors.Is(err, candidate.err) {
+			return candidate.code
+		}
+	}
+	return "internal"
+}
+
+// recordAudit adds the operation on the user to the audit log, with the actor and request the context carries
+func (s *ledgerService) recordAudit(operation, userId string, err error) {
+	source := audit.SourceFrom(s.ctx)
+	event := audit.Event{
+		UserID:     userId,
+		Actor:      source.Actor,
+		Operation:  operation,
+		Outcome:    audit.OutcomeSuccess,
+		RequestID:  source.RequestID,
+		ClientCert: source.ClientCert,
+	}
+	if err != nil {
+		event.Outcome = audit.OutcomeFailure
+		event.ErrorCode = auditErrorCode(err)
+	}
+	s.auditLog.Record(event)
+}
+
+type PaginatedAuditEvents struct {
+	Events     []audit.Event
+	TotalCount int
+	Page       int
+	PageSize   int
+	TotalPages int
+}
+
+// ListAuditEvents returns a page of the audited operations, oldest first. it's meant for operators and isn't scoped
+// to a user
+func (s *ledgerService) ListAuditEvents(filter audit.Filter, page, pageSize int) (PaginatedAuditEvents, error) {
+	if filter.UserID != "" {
+		if err := validateUserId(filter.UserID); err != nil {
+			return PaginatedAuditEvents{}, err
+		}
+	}
+	switch filter.Outcome {
+	case "", audit.OutcomeSuccess, audit.OutcomeFailure:
+	default:
+		return PaginatedAuditEvents{}, &ValidationError{Field: "outcome", Code: "invalid_value", Message: "invalid outcome, use success or failure"}
+	}
+	if filter.From != nil && filter.To != nil && filter.From.After(*filter.To) {
+		return PaginatedAuditEvents{}, &ValidationError{Field: "from", Code: "invalid_range", Message: "from cannot be after to"}
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 50
+	}
+
+	events, total := s.auditLog.Query(filter, (page-1)*pageSize, pageSize)
+	return PaginatedAuditEvents{
+		Events:     events,
+		TotalCount: total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: max((total+pageSize-1)/pageSize, 1),
+	}, nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/audit"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestAuditRecording(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	ctx := audit.WithSource(context.Background(), audit.Source{Actor: "ops", RequestID: "req-1"})
+
+	if _, err := svc.WithContext(ctx).RecordTransaction("user1", models.Deposit, 100, "salary"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.RecordTransaction("user1", models.Withdrawal, 500, "rent"); err == nil {
+		t.Fatal("expected the overdraft to fail")
+	}
+	if _, err := svc.Transfer("user1", "user2", 30, "lunch"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.DeleteUser("user9", false); err == nil {
+		t.Fatal("expected the deletion of an unknown user to fail")
+	}
+	// a replay isn't an operation of its own
+	for range 2 {
+		if _, _, err := svc.RecordTransactionIdempotent("user2", "key-1", TransactionInput{Type: models.Deposit, Amount: 5}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	result, err := svc.ListAuditEvents(audit.Filter{}, 1, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := []audit.Event{
+		{UserID: "user1", Actor: "ops", Operation: operationRecordTransaction, Outcome: audit.OutcomeSuccess, RequestID: "req-1"},
+		{UserID: "user1", Operation: operationRecordTransaction, Outcome: audit.OutcomeFailure, ErrorCode: "insufficient_funds"},
+		{UserID: "user1", Operation: operationTransfer, Outcome: audit.OutcomeSuccess},
+		{UserID: "user9", Operation: operationDeleteUser, Outcome: audit.OutcomeFailure, ErrorCode: "user_not_found"},
+		{UserID: "user2", Operation: operationRecordTransaction, Outcome: audit.OutcomeSuccess},
+	}
+	if result.TotalCount != len(expected) || len(result.Events) != len(expected) {
+		t.Fatalf("expected %d events, got %+v", len(expected), result.Events)
+	}
+	for i, event := range result.Events {
+		event.Time = time.Time{}
+		if event != expected[i] {
+			t.Errorf("expected %+v at %d, got %+v", expected[i], i, event)
+		}
+	}
+}
+
+func TestListAuditEventsValidation(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	from, to := time.Now(), time.Now().Add(-time.Hour)
+
+	_, err := svc.ListAuditEvents(audit.Filter{Outcome: "maybe"}, 1, 10)
+	assertValidationCode(t, err, "invalid_value")
+	_, err = svc.ListAuditEvents(audit.Filter{From: &from, To: &to}, 1, 10)
+	assertValidationCode(t, err, "invalid_range")
+	_, err = svc.ListAuditEvents(audit.Filter{UserID: "a b"}, 1, 10)
+	assertValidationCode(t, err, "invalid_user_id")
+
+	result, err := svc.ListAuditEvents(audit.Filter{}, 0, 0)
+	if err != nil || result.Page != 1 || result.PageSize != 50 || result.TotalPages != 1 {
+		t.Errorf("expected the first empty page of 50, got %+v, %v", result, err)
+	}
+}
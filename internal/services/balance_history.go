@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+const maxBalanceHistoryDays = 366
+
+type BalancePoint struct {
+	Date    time.Time `json:"date"`
+	Balance float64   `json:"balance"`
+}
+
+// GetBalanceHistory returns the end-of-day balance for every UTC day between start and end (both inclusive)
+func (s *ledgerService) GetBalanceHistory(userId string, start, end time.Time) ([]BalancePoint, error) {
+	if err := validateUserId(userId); err != nil {
+		return nil, err
+	}
+
+	if start.After(end) {
+		return nil, errors.New("start time cannot be after end time")
+	}
+
+	firstDay := startOfDay(start)
+	lastDay := startOfDay(end)
+
+	days := int(lastDay.Sub(firstDay)/(24*time.Hour)) + 1
+	if days > maxBalanceHistoryDays {
+		return nil, fmt.Errorf("balance history range cannot exceed %d days", maxBalanceHistoryDays)
+	}
+
+	// balance carried in from everything before the first day
+	balance, err := s.store.GetBalanceAt(userId, firstDay.Add(-time.Nanosecond))
+	if err != nil {
+		return nil, err
+	}
+
+	rangeEnd := lastDay.Add(24*time.Hour - time.Nanosecond)
+	transactions := s.store.GetTransactionsInRange(userId, &firstDay, &rangeEnd)
+
+	// transactions are sorted so a single pass is enough, days without activity keep the previous balance
+	points := make([]BalancePoint, 0, days)
+	i := 0
+	for day := firstDay; !day.After(lastDay); day = day.Add(24 * time.Hour) {
+		nextDay := day.Add(24 * time.Hour)
+		for ; i < len(transactions) && transactions[i].Timestamp.Before(nextDay); i++ {
+			if transactions[i].Voided {
+				continue
+			}
+			if transactions[i].Type == models.Withdrawal {
+				balance = store.Settle(balance - transactions[i].Amount - transactions[i].Fee)
+			} else {
+				balance = store.Settle(balance + transactions[i].Amount)
+			}
+		}
+		points = append(points, BalancePoint{Date: day, Balance: s.round(balance)})
+	}
+
+	return points, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestGetBalanceHistory(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "history_user"
+	day := func(d, hour int) time.Time {
+		return time.Date(2024, time.January, d, hour, 0, 0, 0, time.UTC)
+	}
+
+	s.AddTransactionWithTime(userId, models.TransactionRecord{Amount: 100.0, Type: models.Deposit, Timestamp: day(1, 9)})
+	s.AddTransactionWithTime(userId, models.TransactionRecord{Amount: 50.0, Type: models.Deposit, Timestamp: day(3, 10)})
+	s.AddTransactionWithTime(userId, models.TransactionRecord{Amount: 30.0, Type: models.Withdrawal, Timestamp: day(3, 18)})
+	s.AddTransactionWithTime(userId, models.TransactionRecord{Amount: 20.0, Type: models.Withdrawal, Timestamp: day(6, 8)})
+
+	points, err := svc.GetBalanceHistory(userId, day(2, 15), day(5, 1))
+	if err != nil {
+		t.Fatalf("failed to get balance history: %v", err)
+	}
+
+	expected := []BalancePoint{
+		{Date: day(2, 0), Balance: 100.0},
+		{Date: day(3, 0), Balance: 120.0},
+		{Date: day(4, 0), Balance: 120.0},
+		{Date: day(5, 0), Balance: 120.0},
+	}
+
+	if len(points) != len(expected) {
+		t.Fatalf("expected %d points, got %d", len(expected), len(points))
+	}
+
+	for i, p := range points {
+		if !p.Date.Equal(expected[i].Date) || p.Balance != expected[i].Balance {
+			t.Errorf("point %d: expected %+v, got %+v", i, expected[i], p)
+		}
+	}
+}
+
+func TestGetBalanceHistory_OnlyTransactionBeforeRange(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "carry_in_user"
+	s.AddTransactionWithTime(userId, models.TransactionRecord{
+		Amount:    75.0,
+		Type:      models.Deposit,
+		Timestamp: time.Date(2023, time.December, 15, 12, 0, 0, 0, time.UTC),
+	})
+
+	start := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(2024, time.February, 3, 0, 0, 0, 0, time.UTC)
+
+	points, err := svc.GetBalanceHistory(userId, start, end)
+	if err != nil {
+		t.Fatalf("failed to get balance history: %v", err)
+	}
+
+	if len(points) != 3 {
+		t.Fatalf("expected 3 points, got %d", len(points))
+	}
+
+	for _, p := range points {
+		if p.Balance != 75.0 {
+			t.Errorf("expected carried balance 75.00 on %s, got %.2f", p.Date.Format(time.DateOnly), p.Balance)
+		}
+	}
+}
+
+func TestGetBalanceHistory_Validation(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		userId      string
+		start       time.Time
+		end         time.Time
+		expectError bool
+	}{
+		{"Valid single day", "valid_user", start, start, false},
+		{"Exactly 366 days", "valid_user", start, start.AddDate(0, 0, 365), false},
+		{"More than 366 days", "valid_user", start, start.AddDate(0, 0, 366), true},
+		{"Start after end", "valid_user", start.Add(48 * time.Hour), start, true},
+		{"Invalid user ID", "user@invalid", start, start, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := svc.GetBalanceHistory(test.userId, test.start, test.end)
+
+			if test.expectError && err == nil {
+				t.Errorf("expected error but got none")
+			}
+
+			if !test.expectError && err != nil {
+				t.Errorf("expected no error but got: %v", err)
+			}
+		})
+	}
+}
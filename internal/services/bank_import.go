@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+
+	"tiny-ledger/internal/bankfile"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+// importReferencePrefix marks the references derived from an entry without a FITID
+const importReferencePrefix = "import:"
+
+// ImportEntry is an entry of a bank file and what became of it
+type ImportEntry struct {
+	Line          int        `json:"line"`
+	Date          time.Time  `json:"date"`
+	Amount        float64    `json:"amount"` // signed like in the file, negative for a debit
+	Description   string     `json:"description,omitempty"`
+	FITID         string     `json:"fitid,omitempty"`
+	ReferenceID   string     `json:"referenceId,omitempty"`   // of the record, the FITID or one derived from the entry
+	TransactionID *uuid.UUID `json:"transactionId,omitempty"` // the record created, or the one of an earlier import
+	Reason        string     `json:"reason,omitempty"`        // why it failed
+}
+
+type ImportReport struct {
+	UserID   string        `json:"userId"`
+	Format   string        `json:"format"`
+	Imported []ImportEntry `json:"imported"`
+	Skipped  []ImportEntry `json:"skipped"` // imported before, a record of the user carries their reference
+	Failed   []ImportEntry `json:"failed"`
+}
+
+// ImportBankFile records the entries of an OFX or QIF export of the user's bank, credits as deposits and debits as
+// withdrawals dated when the bank posted them. the FITID is the reference of the record so importing the same file
+// again skips what's in; an entry without one gets a reference derived from its date, amount, payee and memo.
+// the entries are applied one by one in the order of their date, an entry the ledger refuses (a withdrawal over
+// the balance...) fails alone and the report lists it. the fee schedule doesn't apply, the bank charged its own
+func (s *ledgerService) ImportBankFile(userId string, r io.Reader, format string) (ImportReport, error) {
+	ctx, span := s.startSpan("ImportBankFile", userId, "")
+	report, err := s.importBankFile(ctx, userId, r, format)
+	span.SetAttributes(
+		attribute.Int("ledger.import.imported", len(report.Imported)),
+		attribute.Int("ledger.import.skipped", len(report.Skipped)),
+		attribute.Int("ledger.import.failed", len(report.Failed)),
+	)
+	s.recordAudit(operationImportBankFile, userId, err)
+	endSpan(span, transactionOutcome(err), err)
+	return report, err
+}
+
+func (s *ledgerService) importBankFile(ctx context.Context, userId string, r io.Reader, format string) (ImportReport, error) {
+	if err := validateUserId(userId); err != nil {
+		return ImportReport{}, err
+	}
+	format = strings.ToLower(format)
+	if !slices.Contains(bankfile.Formats, format) {
+		return ImportReport{}, &ValidationError{
+			Field: "format", Code: "invalid_value",
+			Message: "format must be one of " + strings.Join(bankfile.Formats, ", "),
+		}
+	}
+	if err := s.requireAccount(userId); err != nil {
+		return ImportReport{}, err
+	}
+
+	entries, err := bankfile.Parse(r, format)
+	if err != nil {
+		return ImportReport{}, &ValidationError{Field: "file", Code: "invalid_value", Message: fmt.Sprintf("invalid %s file: %s", format, err)}
+	}
+	// the balance checks go in the order the bank posted the entries, the file doesn't have to
+	slices.SortStableFunc(entries, func(a, b bankfile.Entry) int { return a.Date.Compare(b.Date) })
+
+	report := ImportReport{UserID: userId, Format: format, Imported: []ImportEntry{}, Skipped: []ImportEntry{}, Failed: []ImportEntry{}}
+	occurrences := make(map[string]int)
+	for _, entry := range entries {
+		item := ImportEntry{Line: entry.Line, Date: entry.Date, Amount: entry.Amount, Description: importDescription(entry), FITID: entry.FITID}
+		if entry.Err != nil {
+			item.Reason = entry.Err.Error()
+			report.Failed = append(report.Failed, item)
+			continue
+		}
+		item.ReferenceID = entry.FITID
+		if item.ReferenceID == "" {
+			item.ReferenceID = derivedReference(entry, occurrences)
+		}
+
+		input := TransactionInput{Type: models.Deposit, Amount: math.Abs(entry.Amount), Description: item.Description, ReferenceID: item.ReferenceID}
+		if entry.Amount < 0 {
+			input.Type = models.Withdrawal
+		}
+		tx, err := s.importEntry(ctx, userId, entry.Date, input)
+		s.metrics.ObserveTransaction(string(input.Type), transactionOutcome(err))
+		switch {
+		case err == nil:
+			item.TransactionID = &tx.ID
+			report.Imported = append(report.Imported, item)
+		case errors.Is(err, store.ErrDuplicateReference):
+			item.TransactionID = &tx.ID
+			report.Skipped = append(report.Skipped, item)
+		case ctx.Err() != nil:
+			// the caller gave up, a new import of the file picks up from here
+			return report, err
+		default:
+			item.Reason = err.Error()
+			report.Failed = append(report.Failed, item)
+		}
+	}
+	return report, nil
+}
+
+// importEntry records one entry, store.ErrDuplicateReference with the earlier record when its reference is taken
+func (s *ledgerService) importEntry(ctx context.Context, userId string, date time.Time, input TransactionInput) (models.TransactionRecord, error) {
+	if existing, err := s.store.FindByReference(userId, input.ReferenceID); err == nil {
+		return existing, store.ErrDuplicateReference
+	}
+	if err := s.validateTransactionInput(userId, &input); err != nil {
+		return models.TransactionRecord{}, err
+	}
+	if err := s.runValidators(ctx, userId, input); err != nil {
+		return models.TransactionRecord{}, err
+	}
+	if err := ctx.Err(); err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	tx := models.NewTransactionRecord(input.Type, input.Amount, input.Description, date)
+	tx.ReferenceID = input.ReferenceID
+	end := s.storeSpan(ctx, "InsertTransaction")
+	tx, err := s.store.InsertTransaction(userId, tx)
+	end(err)
+	if errors.Is(err, store.ErrDuplicateReference) {
+		// a concurrent import of the same file got there first
+		existing, _ := s.store.FindByReference(userId, input.ReferenceID)
+		return existing, err
+	}
+	return tx, err
+}
+
+// importDescription is the payee and the memo of the entry, the memo often repeats the payee
+func importDescription(entry bankfile.Entry) string {
+	switch {
+	case entry.Memo == "" || entry.Memo == entry.Payee:
+		return entry.Payee
+	case entry.Payee == "":
+		return entry.Memo
+	}
+	return entry.Payee + " - " + entry.Memo
+}
+
+// derivedReference stands in for the missing FITID of an entry. it's the hash of what the bank shows of the entry
+// and of how many identical entries came before it in the file, so two equal coffees of the same day are both
+// imported and a new import of the file finds both again
+func derivedReference(entry bankfile.Entry, occurrences map[string]int) string {
+	key := fmt.Sprintf("%s|%v|%s|%s", entry.Date.UTC().Format(time.RFC3339), entry.Amount, entry.Payee, entry.Memo)
+	occurrences[key]++
+	sum := sha256.Sum256(fmt.Appendf(nil, "%s|%d", key, occurrences[key]))
+	return importReferencePrefix + hex.EncodeToString(sum[:16])
+}
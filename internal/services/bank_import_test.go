@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func importFixture(t *testing.T, svc LedgerService, userId string) ImportReport {
+	t.Helper()
+
+	file, err := os.Open("testdata/bank_import.ofx")
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer file.Close()
+	report, err := svc.ImportBankFile(userId, file, "OFX")
+	if err != nil {
+		t.Fatalf("failed to import: %v", err)
+	}
+	return report
+}
+
+func TestImportBankFile(t *testing.T) {
+	ledgerStore := store.NewLedgerStore()
+	svc := NewLedgerService(ledgerStore)
+
+	report := importFixture(t, svc, "alice")
+	if report.Format != "ofx" || len(report.Imported) != 4 || len(report.Skipped) != 0 || len(report.Failed) != 3 {
+		t.Fatalf("expected 4 imported and 3 failed, got %+v", report)
+	}
+
+	// in the order of their date, whatever the order of the file
+	salary, groceries := report.Imported[0], report.Imported[1]
+	if salary.FITID != "0001" || salary.ReferenceID != "0001" || salary.Description != "ACME PAYROLL - January salary" {
+		t.Errorf("unexpected salary entry %+v", salary)
+	}
+	if groceries.Amount != -84.17 || groceries.Description != "CORNER GROCERY" {
+		t.Errorf("unexpected groceries entry %+v", groceries)
+	}
+	tx, err := svc.GetTransaction("alice", *groceries.TransactionID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tx.Type != models.Withdrawal || tx.Amount != 84.17 || tx.Fee != 0 || tx.ReferenceID != "0002" ||
+		!tx.Timestamp.Equal(time.Date(2025, 1, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected a withdrawal of the bank's date, got %+v", tx)
+	}
+
+	// the two coffees of the same day have no FITID, each gets a reference of its own
+	first, second := report.Imported[2], report.Imported[3]
+	if !strings.HasPrefix(first.ReferenceID, importReferencePrefix) || first.ReferenceID == second.ReferenceID {
+		t.Errorf("expected two distinct derived references, got %q and %q", first.ReferenceID, second.ReferenceID)
+	}
+
+	reasons := make([]string, len(report.Failed))
+	for i, entry := range report.Failed {
+		reasons[i] = entry.Reason
+	}
+	for i, expected := range []string{"amount must be positive", store.ErrInsufficientFunds.Error(), `invalid amount "twelve"`} {
+		if !strings.Contains(reasons[i], expected) {
+			t.Errorf("failed entry %d: expected %q, got %q", i, expected, reasons[i])
+		}
+	}
+
+	balance, _ := svc.GetCurrentBalance("alice")
+	if math.Abs(balance-2408.83) > amountTolerance {
+		t.Errorf("expected a balance of 2408.83, got %v", balance)
+	}
+
+	// the same file again adds nothing
+	again := importFixture(t, svc, "alice")
+	if len(again.Imported) != 0 || len(again.Skipped) != 4 || len(again.Failed) != 3 {
+		t.Fatalf("expected the 4 entries skipped, got %+v", again)
+	}
+	for i, entry := range again.Skipped {
+		if *entry.TransactionID != *report.Imported[i].TransactionID {
+			t.Errorf("expected the record of the first import for %+v", entry)
+		}
+	}
+	if after, _ := svc.GetCurrentBalance("alice"); after != balance {
+		t.Errorf("expected the balance unchanged, got %v", after)
+	}
+}
+
+func TestImportBankFileRejectsTheFile(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	for _, tc := range []struct {
+		name, format, body, field string
+	}{
+		{"unknown format", "csv", "date,amount\n", "format"},
+		{"not of the format", "ofx", "date,amount\n", "file"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := svc.ImportBankFile("alice", strings.NewReader(tc.body), tc.format)
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != tc.field {
+				t.Errorf("expected a validation error of %s, got %v", tc.field, err)
+			}
+		})
+	}
+
+	strict := NewLedgerService(store.NewLedgerStore(), WithConfig(Config{StrictAccounts: true}))
+	if _, err := strict.ImportBankFile("nobody", strings.NewReader(""), "qif"); !errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+// DefaultMaxBatchSize is the MaxBatchSize of DefaultConfig
+const DefaultMaxBatchSize = 100
+
+// BatchError lists every invalid transaction of a batch, each item wraps its *ValidationError. nothing was applied
+type BatchError struct {
+	Items []*store.ItemError
+}
+
+func (e *BatchError) Error() string {
+	if len(e.Items) == 1 {
+		return "1 transaction of the batch is invalid"
+	}
+	return fmt.Sprintf("%d transactions of the batch are invalid", len(e.Items))
+}
+
+// RecordTransactionsBatch records the transactions in order, all or nothing. every item is validated first and the
+// invalid ones are reported together in a *BatchError; then the store applies the batch in one step, a withdrawal
+// the earlier items can't cover fails the whole batch with a *store.ItemError. the duplicate window doesn't apply
+// to batches, a batch is intentional by nature
+func (s *ledgerService) RecordTransactionsBatch(userId string, inputs []TransactionInput) ([]models.TransactionRecord, error) {
+	ctx, span := s.startSpan("RecordTransactionsBatch", userId, "")
+	span.SetAttributes(attribute.Int("ledger.batch_size", len(inputs)))
+	records, err := s.recordTransactionsBatch(ctx, userId, inputs)
+	s.observeBatch(inputs, err)
+	s.recordAudit(operationRecordBatch, userId, err)
+	endSpan(span, transactionOutcome(err), err)
+	return records, err
+}
+
+func (s *ledgerService) recordTransactionsBatch(ctx context.Context, userId string, inputs []TransactionInput) ([]models.TransactionRecord, error) {
+	if err := validateUserId(userId); err != nil {
+		return nil, err
+	}
+
+	maxSize := s.config.Load().MaxBatchSize
+	if maxSize < 1 {
+		maxSize = DefaultMaxBatchSize
+	}
+	if len(inputs) == 0 {
+		return nil, &ValidationError{Field: "transactions", Code: "required", Message: "the batch has no transactions"}
+	}
+	if len(inputs) > maxSize {
+		return nil, &ValidationError{
+			Field:   "transactions",
+			Code:    "max_items",
+			Message: fmt.Sprintf("the batch has %d transactions, at most %d are allowed", len(inputs), maxSize),
+		}
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return nil, err
+	}
+
+	batchErr := &BatchError{}
+	records := make([]models.TransactionRecord, len(inputs))
+	for i := range inputs {
+		input := inputs[i]
+		err := s.validateTransactionInput(userId, &input)
+		if err == nil {
+			err = s.runValidators(ctx, userId, input)
+		}
+		if err != nil {
+			batchErr.Items = append(batchErr.Items, &store.ItemError{Index: i, Err: err})
+			continue
+		}
+		records[i] = s.newTransactionRecord(input)
+	}
+	if len(batchErr.Items) > 0 {
+		return nil, batchErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	end := s.storeSpan(ctx, "InsertTransactions")
+	created, err := s.store.InsertTransactions(userId, records)
+	end(err)
+	return created, err
+}
+
+// observeBatch counts every item of the batch, the failed items with their own outcome and the others as invalid
+// since they weren't recorded either
+func (s *ledgerService) observeBatch(inputs []TransactionInput, err error) {
+	failed := make(map[int]error)
+	var batchErr *BatchError
+	var itemErr *store.ItemError
+	switch {
+	case errors.As(err, &batchErr):
+		for _, item := range batchErr.Items {
+			failed[item.Index] = item.Err
+		}
+	case errors.As(err, &itemErr):
+		failed[itemErr.Index] = itemErr.Err
+	}
+
+	for i, input := range inputs {
+		itemErr, found := failed[i]
+		if !found && err != nil {
+			itemErr = err
+		}
+		s.metrics.ObserveTransaction(string(input.Type), transactionOutcome(itemErr))
+	}
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestRecordTransactionsBatch(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	records, err := svc.RecordTransactionsBatch("user1", []TransactionInput{
+		{Type: models.Deposit, Amount: 100, Description: "  salary  "},
+		{Type: models.Withdrawal, Amount: 30, Description: "rent"},
+		{Type: models.Withdrawal, Amount: 70, ReferenceID: "inv-1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 3 || records[0].Description != "salary" || records[2].ReferenceID != "inv-1" {
+		t.Fatalf("expected the 3 records in order, got %+v", records)
+	}
+	assertBalance(t, svc, "user1", 0)
+}
+
+func TestRecordTransactionsBatch_AllOrNothing(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	if _, err := svc.RecordTransaction("user1", models.Deposit, 50, "initial"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the third withdrawal overdraws once the first two are applied
+	_, err := svc.RecordTransactionsBatch("user1", []TransactionInput{
+		{Type: models.Deposit, Amount: 10},
+		{Type: models.Withdrawal, Amount: 40},
+		{Type: models.Withdrawal, Amount: 25},
+	})
+	var itemErr *store.ItemError
+	if !errors.As(err, &itemErr) || itemErr.Index != 2 || !errors.Is(err, store.ErrInsufficientFunds) {
+		t.Fatalf("expected insufficient funds on item 2, got %v", err)
+	}
+	assertBalance(t, svc, "user1", 50)
+
+	// every invalid item is reported, not only the first
+	_, err = svc.RecordTransactionsBatch("user1", []TransactionInput{
+		{Type: models.Deposit, Amount: -1},
+		{Type: models.Deposit, Amount: 5},
+		{Type: "transfer", Amount: 5},
+	})
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) || len(batchErr.Items) != 2 || batchErr.Items[0].Index != 0 || batchErr.Items[1].Index != 2 {
+		t.Fatalf("expected items 0 and 2 to be invalid, got %v", err)
+	}
+	assertValidationCode(t, batchErr.Items[0].Err, "not_positive")
+	assertValidationCode(t, batchErr.Items[1].Err, "invalid_value")
+	assertBalance(t, svc, "user1", 50)
+}
+
+func TestRecordTransactionsBatch_Size(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore(), WithConfig(Config{MaxBatchSize: 2, MaxDepositAmount: 100, MaxWithdrawalAmount: 100}))
+
+	deposit := TransactionInput{Type: models.Deposit, Amount: 1}
+	tests := []struct {
+		name         string
+		inputs       []TransactionInput
+		expectedCode string
+	}{
+		{"Empty batch", nil, "required"},
+		{"At the maximum", []TransactionInput{deposit, deposit}, ""},
+		{"Over the maximum", []TransactionInput{deposit, deposit, deposit}, "max_items"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.RecordTransactionsBatch("user1", tt.inputs)
+			assertValidationCode(t, err, tt.expectedCode)
+		})
+	}
+}
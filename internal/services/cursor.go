@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+const (
+	defaultCursorLimit = 50
+	maxCursorLimit     = 100
+)
+
+// HistoryCursor points at the last record of a page, the walk continues after it in the same direction
+type HistoryCursor struct {
+	Timestamp  time.Time
+	ID         uuid.UUID
+	Descending bool
+}
+
+// CursorPage is a page of a cursor walk, NextCursor is nil once the walk reached the end
+type CursorPage struct {
+	Transactions  []models.TransactionRecord
+	NextCursor    *HistoryCursor
+	Limit         int
+	AccountExists bool // as in PaginatedTransactions
+}
+
+// GetTransactionHistoryAfter walks the history by keyset instead of by offset, a nil cursor starts at the oldest
+// record, the newest when descending. unlike pages, cursors stay valid while records are being added: every record
+// is returned exactly once
+func (s *ledgerService) GetTransactionHistoryAfter(userId string, filter HistoryFilter, after *HistoryCursor, limit int) (CursorPage, error) {
+	if err := validateUserId(userId); err != nil {
+		return CursorPage{}, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return CursorPage{}, err
+	}
+
+	if limit < 1 {
+		limit = defaultCursorLimit
+	}
+	if limit > maxCursorLimit {
+		limit = maxCursorLimit
+	}
+
+	storeFilter, err := filter.validate()
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	var position *store.Cursor
+	if after != nil {
+		if after.Descending != filter.Descending {
+			return CursorPage{}, &ValidationError{Field: "cursor", Code: "invalid_cursor", Message: "cursor was issued for the other order"}
+		}
+		position = &store.Cursor{Timestamp: after.Timestamp, ID: after.ID}
+	}
+
+	result, err := s.store.GetTransactionsAfter(userId, storeFilter, position, limit)
+	if errors.Is(err, store.ErrCursorNotFound) {
+		return CursorPage{}, &ValidationError{Field: "cursor", Code: "invalid_cursor", Message: "cursor does not point at a transaction of this user"}
+	}
+	if err != nil {
+		return CursorPage{}, err
+	}
+
+	page := CursorPage{Transactions: result.Transactions, Limit: limit, AccountExists: s.store.UserExists(userId)}
+	if result.HasMore {
+		last := result.Transactions[len(result.Transactions)-1]
+		page.NextCursor = &HistoryCursor{Timestamp: last.Timestamp, ID: last.ID, Descending: filter.Descending}
+	}
+	return page, nil
+}
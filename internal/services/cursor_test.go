@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestGetTransactionHistoryAfter(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "cursor_walk"
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		s.AddTransactionWithTime(userId, models.TransactionRecord{
+			ID:          uuid.New(),
+			Type:        models.Deposit,
+			Amount:      float64(i + 1),
+			Description: "deposit",
+			Timestamp:   base.Add(time.Duration(i) * time.Hour),
+		})
+	}
+
+	first, err := svc.GetTransactionHistoryAfter(userId, HistoryFilter{}, nil, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(first.Transactions) != 3 || first.Transactions[0].Amount != 1.0 || first.NextCursor == nil {
+		t.Fatalf("unexpected first page: %+v", first)
+	}
+
+	second, err := svc.GetTransactionHistoryAfter(userId, HistoryFilter{}, first.NextCursor, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(second.Transactions) != 2 || second.Transactions[0].Amount != 4.0 || second.NextCursor != nil {
+		t.Errorf("unexpected second page: %+v", second)
+	}
+
+	descending := &HistoryCursor{Timestamp: first.NextCursor.Timestamp, ID: first.NextCursor.ID, Descending: true}
+	back, err := svc.GetTransactionHistoryAfter(userId, HistoryFilter{Descending: true}, descending, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(back.Transactions) != 2 || back.Transactions[0].Amount != 2.0 || back.Transactions[1].Amount != 1.0 {
+		t.Errorf("unexpected descending page: %+v", back)
+	}
+
+	if page, _ := svc.GetTransactionHistoryAfter(userId, HistoryFilter{}, nil, 0); page.Limit != defaultCursorLimit {
+		t.Errorf("expected the default limit %d, got %d", defaultCursorLimit, page.Limit)
+	}
+	if page, _ := svc.GetTransactionHistoryAfter(userId, HistoryFilter{}, nil, 1000); page.Limit != maxCursorLimit {
+		t.Errorf("expected the limit to be capped at %d, got %d", maxCursorLimit, page.Limit)
+	}
+
+	_, err = svc.GetTransactionHistoryAfter(userId, HistoryFilter{}, &HistoryCursor{Timestamp: base, ID: uuid.New()}, 3)
+	assertValidationCode(t, err, "invalid_cursor")
+
+	_, err = svc.GetTransactionHistoryAfter(userId, HistoryFilter{}, descending, 3)
+	assertValidationCode(t, err, "invalid_cursor")
+}
@@ -0,0 +1,39 @@
+package services
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// normalizeDescription trims the description, replaces tabs and line breaks with a space (newlines are kept when
+// Config.AllowDescriptionNewlines is set) and strips the other ASCII control characters. the length limit is
+// counted in runes, not bytes
+func (s *ledgerService) normalizeDescription(description string) (string, error) {
+	if !utf8.ValidString(description) {
+		return "", &ValidationError{Field: "description", Code: "invalid_utf8", Rule: RuleUTF8, Message: "description must be valid UTF-8"}
+	}
+
+	var b strings.Builder
+	b.Grow(len(description))
+	for _, r := range strings.ReplaceAll(description, "\r\n", "\n") {
+		switch {
+		case r == '\n' && s.config.Load().AllowDescriptionNewlines:
+			b.WriteRune(r)
+		case r == '\t' || r == '\n' || r == '\r':
+			b.WriteByte(' ')
+		case r < 0x20 || r == 0x7f:
+			// other control characters are dropped
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	normalized := strings.TrimSpace(b.String())
+	if utf8.RuneCountInString(normalized) > maxDescriptionLength {
+		return "", &ValidationError{
+			Field: "description", Code: "max_length", Rule: RuleMaxLength, Max: limit(maxDescriptionLength),
+			Message: "description exceeds maximum length of 500 characters",
+		}
+	}
+	return normalized, nil
+}
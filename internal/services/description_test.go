@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestDescriptionNormalization(t *testing.T) {
+	tests := []struct {
+		name          string
+		description   string
+		allowNewlines bool
+		expected      string
+		expectedCode  string
+	}{
+		{"Plain text", "Monthly salary", false, "Monthly salary", ""},
+		{"Surrounding whitespace", "  \tcoffee \n", false, "coffee", ""},
+		{"Emoji within the limit", strings.Repeat("🎉", 200), false, strings.Repeat("🎉", 200), ""},
+		{"Multi-byte at the limit", strings.Repeat("é", 500), false, strings.Repeat("é", 500), ""},
+		{"501 runes", strings.Repeat("é", 501), false, "", "max_length"},
+		{"Invalid UTF-8", "caf\xe9 latte", false, "", "invalid_utf8"},
+		{"Embedded NUL and ESC", "rent\x00 for\x1b[31m march", false, "rent for[31m march", ""},
+		{"DEL character", "re\x7ffund", false, "refund", ""},
+		{"Newlines replaced", "line one\r\nline two\nline three", false, "line one line two line three", ""},
+		{"Newlines kept", "line one\r\nline two", true, "line one\nline two", ""},
+		{"Only control characters", "\x00\x01\x02", false, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.AllowDescriptionNewlines = test.allowNewlines
+			svc := NewLedgerService(store.NewLedgerStore(), WithConfig(config))
+
+			tx, err := svc.RecordTransaction("user1", models.Deposit, 10.0, test.description)
+
+			if test.expectedCode != "" {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("expected a validation error with code %q, got %v", test.expectedCode, err)
+				}
+				if validationErr.Field != "description" || validationErr.Code != test.expectedCode {
+					t.Errorf("expected description/%s, got %s/%s", test.expectedCode, validationErr.Field, validationErr.Code)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if tx.Description != test.expected {
+				t.Errorf("expected description %q, got %q", test.expected, tx.Description)
+			}
+		})
+	}
+}
+
+func TestDescriptionNormalization_TransferAndJournal(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	svc.RecordTransaction("alice", models.Deposit, 100.0, "funding")
+
+	journal, err := svc.Transfer("alice", "bob", 10.0, " rent\x00 ")
+	if err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+	for _, entry := range journal.Entries {
+		if entry.Transaction.Description != "rent" {
+			t.Errorf("expected normalized description %q, got %q", "rent", entry.Transaction.Description)
+		}
+	}
+
+	legs := []models.JournalLeg{
+		{UserID: "alice", Direction: models.Debit, Amount: 5.0, Description: "split\tpayment"},
+		{UserID: "bob", Direction: models.Credit, Amount: 5.0, Description: strings.Repeat("x", 501)},
+	}
+	if _, err := svc.PostJournal(legs); err == nil || !strings.HasPrefix(err.Error(), "leg 1:") {
+		t.Errorf("expected the too long leg to be rejected, got %v", err)
+	}
+	if legs[0].Description != "split\tpayment" {
+		t.Errorf("PostJournal must not modify the caller's legs")
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func newDuplicateWindowService(window time.Duration) LedgerService {
+	config := DefaultConfig()
+	config.DuplicateWindow = window
+	return NewLedgerService(store.NewLedgerStore(), WithConfig(config))
+}
+
+func TestDuplicateWindow(t *testing.T) {
+	svc := newDuplicateWindowService(10 * time.Second)
+	input := TransactionInput{Type: models.Deposit, Amount: 25.0, Description: "lunch"}
+
+	original, err := svc.RecordTransactionInput("user1", input)
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+
+	_, err = svc.RecordTransactionInput("user1", input)
+	var duplicateErr *store.DuplicateError
+	if !errors.As(err, &duplicateErr) || duplicateErr.OriginalID != original.ID {
+		t.Fatalf("expected a possible duplicate of %s, got %v", original.ID, err)
+	}
+
+	// the override records the repeat, other users are not affected
+	input.AllowDuplicate = true
+	if _, err := svc.RecordTransactionInput("user1", input); err != nil {
+		t.Errorf("expected the override to record the transaction, got %v", err)
+	}
+	if _, err := svc.RecordTransaction("user2", models.Deposit, 25.0, "lunch"); err != nil {
+		t.Errorf("expected no duplicate across users, got %v", err)
+	}
+
+	// a voided original doesn't block the corrected retry
+	first, _ := svc.RecordTransaction("user3", models.Deposit, 5.0, "snack")
+	if _, err := svc.VoidTransaction("user3", first.ID, "wrong amount"); err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+	if _, err := svc.RecordTransaction("user3", models.Deposit, 5.0, "snack"); err != nil {
+		t.Errorf("expected a voided original to be ignored, got %v", err)
+	}
+}
+
+func TestDuplicateWindow_Disabled(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	for i := 0; i < 2; i++ {
+		if _, err := svc.RecordTransaction("user1", models.Deposit, 25.0, "lunch"); err != nil {
+			t.Fatalf("expected no duplicate check by default, got %v", err)
+		}
+	}
+}
+
+func TestDuplicateWindow_Concurrent(t *testing.T) {
+	svc := newDuplicateWindowService(time.Minute)
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	recorded, duplicates := 0, 0
+
+	start := make(chan struct{})
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := svc.RecordTransaction("user1", models.Deposit, 99.0, "double click")
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				recorded++
+			case errors.Is(err, store.ErrPossibleDuplicate):
+				duplicates++
+			default:
+				t.Errorf("unexpected error: %v", err)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	if recorded != 1 || duplicates != attempts-1 {
+		t.Errorf("expected 1 record and %d duplicates, got %d and %d", attempts-1, recorded, duplicates)
+	}
+	assertBalance(t, svc, "user1", 99.0)
+}
@@ -0,0 +1,10 @@
+package services
+
+import "tiny-ledger/internal/errreport"
+
+// WithErrorReporter reports the failed integrity checks, errreport.Noop by default
+func WithErrorReporter(reporter errreport.ErrorReporter) Option {
+	return func(s *ledgerService) {
+		s.reporter = reporter
+	}
+}
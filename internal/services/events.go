@@ -0,0 +1,112 @@
+package services
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"tiny-ledger/internal/models"
+)
+
+// TransactionEvent is emitted for every new record, Balance is the balance of the user right after it
+type TransactionEvent struct {
+	UserID      string                   `json:"userId"`
+	Transaction models.TransactionRecord `json:"transaction"`
+	Balance     float64                  `json:"balance"`
+}
+
+// Subscribe registers fn for the events of every new record: deposits, withdrawals, both legs of transfers and
+// journals, and reversals. events are delivered asynchronously in commit order on a single worker, so a slow
+// subscriber delays the others but never the writers.
+// the buffer holds Config.EventBufferSize events, when it is full new events are dropped (and counted) rather
+// than blocking the write
+func (s *ledgerService) Subscribe(fn func(event TransactionEvent)) (unsubscribe func()) {
+	s.events.start.Do(func() {
+		go s.events.run()
+		s.store.SetCommitHook(s.events.publish)
+	})
+	return s.events.subscribe(fn)
+}
+
+type eventBus struct {
+	events      chan TransactionEvent
+	start       sync.Once
+	mu          sync.RWMutex
+	subscribers map[int]func(TransactionEvent)
+	nextID      int
+	dropped     atomic.Int64
+}
+
+func newEventBus(bufferSize int) *eventBus {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	return &eventBus{
+		events:      make(chan TransactionEvent, bufferSize),
+		subscribers: make(map[int]func(TransactionEvent)),
+	}
+}
+
+// publish is the store commit hook, it runs under the store lock and must never block
+func (b *eventBus) publish(userId string, tx models.TransactionRecord, balance float64) {
+	select {
+	case b.events <- TransactionEvent{UserID: userId, Transaction: tx, Balance: balance}:
+	default:
+		b.dropped.Add(1)
+	}
+}
+
+func (b *eventBus) subscribe(fn func(TransactionEvent)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = fn
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			delete(b.subscribers, id)
+		})
+	}
+}
+
+func (b *eventBus) run() {
+	for event := range b.events {
+		for _, fn := range b.snapshot() {
+			deliver(fn, event)
+		}
+	}
+}
+
+// snapshot returns the current subscribers in subscription order
+func (b *eventBus) snapshot() []func(TransactionEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	ids := make([]int, 0, len(b.subscribers))
+	for id := range b.subscribers {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	fns := make([]func(TransactionEvent), len(ids))
+	for i, id := range ids {
+		fns[i] = b.subscribers[id]
+	}
+	return fns
+}
+
+// deliver keeps the worker alive when a subscriber panics
+func deliver(fn func(TransactionEvent), event TransactionEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("transaction event subscriber panicked: %v", r)
+		}
+	}()
+	fn(event)
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+// collector gathers events and lets the test wait for a number of them
+type collector struct {
+	mu     sync.Mutex
+	events []TransactionEvent
+	signal chan struct{}
+}
+
+func newCollector() *collector {
+	return &collector{signal: make(chan struct{}, 1)}
+}
+
+func (c *collector) handle(event TransactionEvent) {
+	c.mu.Lock()
+	c.events = append(c.events, event)
+	c.mu.Unlock()
+
+	select {
+	case c.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (c *collector) wait(t *testing.T, count int) []TransactionEvent {
+	t.Helper()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		c.mu.Lock()
+		if len(c.events) >= count {
+			events := append([]TransactionEvent(nil), c.events...)
+			c.mu.Unlock()
+			return events
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-c.signal:
+		case <-deadline:
+			t.Fatalf("timed out waiting for %d events", count)
+		}
+	}
+}
+
+func TestSubscribe_OrderingPerUser(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	c := newCollector()
+	unsubscribe := svc.Subscribe(c.handle)
+	defer unsubscribe()
+
+	const users, perUser = 5, 50
+	var wg sync.WaitGroup
+	for u := 0; u < users; u++ {
+		wg.Add(1)
+		go func(userId string) {
+			defer wg.Done()
+			for i := 0; i < perUser; i++ {
+				if _, err := svc.RecordTransaction(userId, models.Deposit, 1.0, fmt.Sprintf("deposit %d", i)); err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+		}(fmt.Sprintf("user_%d", u))
+	}
+	wg.Wait()
+
+	events := c.wait(t, users*perUser)
+
+	// deposits of 1 each, so the balances of a user must count up without gaps
+	last := make(map[string]float64)
+	for _, event := range events {
+		if event.Balance != last[event.UserID]+1.0 {
+			t.Fatalf("out of order event for %s: balance %.2f after %.2f", event.UserID, event.Balance, last[event.UserID])
+		}
+		last[event.UserID] = event.Balance
+	}
+}
+
+func TestSubscribe_TransfersAndReversals(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	c := newCollector()
+	defer svc.Subscribe(c.handle)()
+
+	if _, err := svc.RecordTransaction("alice", models.Deposit, 100.0, "funding"); err != nil {
+		t.Fatalf("failed to fund the account: %v", err)
+	}
+	journal, err := svc.Transfer("alice", "bob", 40.0, "rent")
+	if err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+	if _, err := svc.ReverseJournal(journal.ID); err != nil {
+		t.Fatalf("reversal failed: %v", err)
+	}
+
+	events := c.wait(t, 5)
+
+	expected := []struct {
+		userId  string
+		txType  models.TransactionType
+		balance float64
+	}{
+		{"alice", models.Deposit, 100.0},
+		{"alice", models.Withdrawal, 60.0},
+		{"bob", models.Deposit, 40.0},
+		{"alice", models.Deposit, 100.0},
+		{"bob", models.Withdrawal, 0.0},
+	}
+
+	for i, want := range expected {
+		got := events[i]
+		if got.UserID != want.userId || got.Transaction.Type != want.txType || got.Balance != want.balance {
+			t.Errorf("event %d: expected %s %s balance %.2f, got %s %s balance %.2f",
+				i, want.userId, want.txType, want.balance, got.UserID, got.Transaction.Type, got.Balance)
+		}
+	}
+
+	if events[1].Transaction.JournalID == nil || *events[1].Transaction.JournalID != journal.ID {
+		t.Errorf("expected the transfer events to carry the journal ID")
+	}
+}
+
+func TestSubscribe_Unsubscribe(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	stopped, active := newCollector(), newCollector()
+	unsubscribe := svc.Subscribe(stopped.handle)
+	defer svc.Subscribe(active.handle)()
+
+	svc.RecordTransaction("user1", models.Deposit, 10.0, "before")
+	stopped.wait(t, 1)
+
+	unsubscribe()
+	unsubscribe() // safe to call twice
+
+	svc.RecordTransaction("user1", models.Deposit, 10.0, "after")
+	active.wait(t, 2)
+
+	if events := stopped.wait(t, 1); len(events) != 1 {
+		t.Errorf("expected no delivery after unsubscribe, got %d events", len(events))
+	}
+}
+
+func TestSubscribe_FullBufferDropsEvents(t *testing.T) {
+	config := DefaultConfig()
+	config.EventBufferSize = 1
+	svc := NewLedgerService(store.NewLedgerStore(), WithConfig(config))
+
+	release := make(chan struct{})
+	defer svc.Subscribe(func(TransactionEvent) { <-release })()
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			svc.RecordTransaction("user1", models.Deposit, 1.0, "deposit")
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a blocked subscriber must not block RecordTransaction")
+	}
+	close(release)
+
+	if dropped := svc.(*ledgerService).events.dropped.Load(); dropped == 0 {
+		t.Error("expected events to be dropped while the buffer was full")
+	}
+
+	balance, _ := svc.GetCurrentBalance("user1")
+	if balance != 10.0 {
+		t.Errorf("expected all deposits to be stored, balance %.2f", balance)
+	}
+}
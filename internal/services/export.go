@@ -0,0 +1,96 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+// exportBatchSize is how many records are read from the store at a time, the lock isn't held while they're written
+const exportBatchSize = 500
+
+// ExportColumns is the header row of the CSV export
+var ExportColumns = []string{"id", "timestamp", "type", "amount", "fee", "description", "referenceId", "journalId", "voided"}
+
+// ExportTransactionsCSV writes the user's history matching the filter as CSV to w, oldest first unless descending.
+// the history is read by keyset in batches, so a slow reader never blocks writers and records added meanwhile are
+// neither repeated nor skipped. a cancelled ctx stops the export between batches
+func (s *ledgerService) ExportTransactionsCSV(ctx context.Context, userId string, filter HistoryFilter, w io.Writer) error {
+	if err := validateUserId(userId); err != nil {
+		return err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return err
+	}
+
+	storeFilter, err := filter.validate()
+	if err != nil {
+		return err
+	}
+
+	out := csv.NewWriter(w)
+	if err := out.Write(ExportColumns); err != nil {
+		return err
+	}
+
+	var after *store.Cursor
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		batch, err := s.store.GetTransactionsAfter(userId, storeFilter, after, exportBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, tx := range batch.Transactions {
+			if err := out.Write(exportRow(tx)); err != nil {
+				return err
+			}
+		}
+		out.Flush()
+		if err := out.Error(); err != nil {
+			return err
+		}
+
+		if !batch.HasMore {
+			return nil
+		}
+		last := batch.Transactions[len(batch.Transactions)-1]
+		after = &store.Cursor{Timestamp: last.Timestamp, ID: last.ID}
+	}
+}
+
+// safeCell keeps spreadsheets from evaluating client supplied text as a formula
+func safeCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func exportRow(tx models.TransactionRecord) []string {
+	journalID := ""
+	if tx.JournalID != nil {
+		journalID = tx.JournalID.String()
+	}
+
+	return []string{
+		tx.ID.String(),
+		tx.Timestamp.UTC().Format(time.RFC3339Nano),
+		string(tx.Type),
+		strconv.FormatFloat(tx.Amount, 'f', 2, 64),
+		strconv.FormatFloat(tx.Fee, 'f', 2, 64),
+		safeCell(tx.Description),
+		safeCell(tx.ReferenceID),
+		journalID,
+		strconv.FormatBool(tx.Voided),
+	}
+}
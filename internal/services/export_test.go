@@ -0,0 +1,69 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"testing"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestExportTransactionsCSV(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "exporter"
+	// more than a batch so the export has to resume from a cursor
+	const count = exportBatchSize*2 + 7
+	for i := 0; i < count; i++ {
+		if _, err := svc.RecordTransaction(userId, models.Deposit, float64(i%50+1), fmt.Sprintf("deposit %d", i)); err != nil {
+			t.Fatalf("failed to create test transaction: %v", err)
+		}
+	}
+	if _, err := svc.RecordTransaction(userId, models.Withdrawal, 10.0, "=HYPERLINK(\"http://evil\")"); err != nil {
+		t.Fatalf("failed to create test transaction: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := svc.ExportTransactionsCSV(context.Background(), userId, HistoryFilter{}, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("export is not valid CSV: %v", err)
+	}
+	if len(rows) != count+2 {
+		t.Fatalf("expected a header and %d rows, got %d rows", count+1, len(rows))
+	}
+	if fmt.Sprint(rows[0]) != fmt.Sprint(ExportColumns) {
+		t.Errorf("unexpected header: %v", rows[0])
+	}
+	for i := 0; i < count; i++ {
+		if expected := fmt.Sprintf("deposit %d", i); rows[i+1][5] != expected {
+			t.Fatalf("expected %q in row %d, got %q", expected, i+1, rows[i+1][5])
+		}
+	}
+	if last := rows[len(rows)-1]; last[2] != "withdrawal" || last[3] != "10.00" || last[5] != "'=HYPERLINK(\"http://evil\")" {
+		t.Errorf("unexpected last row: %v", last)
+	}
+
+	withdrawal := models.Withdrawal
+	buf.Reset()
+	if err := svc.ExportTransactionsCSV(context.Background(), userId, HistoryFilter{Type: &withdrawal}, &buf); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rows, _ := csv.NewReader(&buf).ReadAll(); len(rows) != 2 {
+		t.Errorf("expected the filter to leave a single row, got %d rows", len(rows))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := svc.ExportTransactionsCSV(ctx, userId, HistoryFilter{}, &bytes.Buffer{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the export to stop on a cancelled context, got %v", err)
+	}
+}
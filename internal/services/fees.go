@@ -0,0 +1,110 @@
+package services
+
+import (
+	"sort"
+
+	"tiny-ledger/internal/models"
+)
+
+// FeeSchedule computes the fee charged on top of a withdrawal of the given amount
+type FeeSchedule interface {
+	Fee(amount float64) float64
+}
+
+// FeeTier applies to amounts from MinAmount (inclusive) up to the MinAmount of the next tier
+type FeeTier struct {
+	MinAmount float64
+	Flat      float64
+	Percent   float64 // of the amount, 1 is 1%
+	Cap       float64 // maximum fee of the tier, zero is uncapped
+}
+
+// TieredFeeSchedule charges flat + percent of the amount, capped, by the tier the amount falls in.
+// amounts below the first tier are free
+type TieredFeeSchedule struct {
+	tiers []FeeTier
+}
+
+func NewTieredFeeSchedule(tiers ...FeeTier) *TieredFeeSchedule {
+	sorted := append([]FeeTier(nil), tiers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].MinAmount < sorted[j].MinAmount })
+	return &TieredFeeSchedule{tiers: sorted}
+}
+
+// StandardFeeSchedule is 0.50 plus 1% capped at 5.00 for every withdrawal
+func StandardFeeSchedule() *TieredFeeSchedule {
+	return NewTieredFeeSchedule(FeeTier{Flat: 0.50, Percent: 1, Cap: 5.00})
+}
+
+func (f *TieredFeeSchedule) Fee(amount float64) float64 {
+	idx := sort.Search(len(f.tiers), func(i int) bool { return f.tiers[i].MinAmount > amount }) - 1
+	if idx < 0 {
+		return 0
+	}
+
+	tier := f.tiers[idx]
+	fee := tier.Flat + amount*tier.Percent/100
+	if tier.Cap > 0 && fee > tier.Cap {
+		fee = tier.Cap
+	}
+	return fee
+}
+
+// WithFeeSchedule charges withdrawals by the schedule, without one transactions are free
+func WithFeeSchedule(schedule FeeSchedule) Option {
+	return func(s *ledgerService) {
+		s.fees = schedule
+	}
+}
+
+// fee is the rounded fee of the transaction, only withdrawals are charged
+func (s *ledgerService) fee(txType models.TransactionType, amount float64) float64 {
+	if s.fees == nil || txType != models.Withdrawal {
+		return 0
+	}
+
+	fee := s.round(s.fees.Fee(amount))
+	if fee < 0 {
+		return 0
+	}
+	return fee
+}
+
+// TransactionPreview shows what a transaction would cost before it's recorded
+type TransactionPreview struct {
+	Type         models.TransactionType `json:"type"`
+	Amount       float64                `json:"amount"`
+	Fee          float64                `json:"fee"`
+	Total        float64                `json:"total"` // what leaves the account for a withdrawal, the amount for a deposit
+	BalanceAfter float64                `json:"balanceAfter"`
+	Allowed      bool                   `json:"allowed"` // false when the funds or the minimum balance don't cover it
+}
+
+// PreviewTransaction validates the input and computes the fee and the resulting balance without recording anything
+func (s *ledgerService) PreviewTransaction(userId string, input TransactionInput) (TransactionPreview, error) {
+	if err := s.validateTransactionInput(userId, &input); err != nil {
+		return TransactionPreview{}, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return TransactionPreview{}, err
+	}
+
+	balance, _, available := s.store.GetAvailableBalance(userId)
+	preview := TransactionPreview{
+		Type:    input.Type,
+		Amount:  input.Amount,
+		Fee:     s.fee(input.Type, input.Amount),
+		Allowed: true,
+	}
+
+	if input.Type == models.Withdrawal {
+		preview.Total = input.Amount + preview.Fee
+		preview.BalanceAfter = balance - preview.Total
+		preview.Allowed = preview.Total <= available
+	} else {
+		preview.Total = input.Amount
+		preview.BalanceAfter = balance + input.Amount
+	}
+	return preview, nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestTieredFeeSchedule(t *testing.T) {
+	standard := StandardFeeSchedule()
+	tiered := NewTieredFeeSchedule(
+		FeeTier{MinAmount: 1000, Percent: 0.5},
+		FeeTier{MinAmount: 50, Flat: 0.25},
+		FeeTier{MinAmount: 100, Flat: 0.50, Percent: 1, Cap: 5.00},
+	)
+
+	tests := []struct {
+		name     string
+		schedule FeeSchedule
+		amount   float64
+		expected float64
+	}{
+		{"Standard smallest amount", standard, 0.01, 0.50},
+		{"Standard 10.00", standard, 10.00, 0.60},
+		{"Standard reaches the cap", standard, 450.00, 5.00},
+		{"Standard above the cap", standard, 451.00, 5.00},
+		{"Standard large amount", standard, 100000.00, 5.00},
+		{"Below the first tier is free", tiered, 49.99, 0},
+		{"First tier lower bound", tiered, 50.00, 0.25},
+		{"First tier upper bound", tiered, 99.99, 0.25},
+		{"Second tier lower bound", tiered, 100.00, 1.50},
+		{"Second tier capped", tiered, 999.99, 5.00},
+		{"Third tier lower bound", tiered, 1000.00, 5.00},
+		{"Third tier uncapped", tiered, 2000.00, 10.00},
+	}
+
+	svc := NewLedgerService(store.NewLedgerStore()).(*ledgerService)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc.fees = test.schedule
+			if got := svc.fee(models.Withdrawal, test.amount); got != test.expected {
+				t.Errorf("expected fee %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestFees_RecordTransaction(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore(), WithFeeSchedule(StandardFeeSchedule()))
+	userId := "fee_user"
+
+	deposit, err := svc.RecordTransaction(userId, models.Deposit, 100.0, "funding")
+	if err != nil || deposit.Fee != 0 {
+		t.Fatalf("expected a free deposit, got fee %.2f (%v)", deposit.Fee, err)
+	}
+
+	// 99.50 + 1.50 fee is more than the balance
+	if _, err := svc.RecordTransaction(userId, models.Withdrawal, 99.50, "too much"); !errors.Is(err, store.ErrInsufficientFunds) {
+		t.Errorf("expected the fee to count against the funds, got %v", err)
+	}
+
+	withdrawal, err := svc.RecordTransaction(userId, models.Withdrawal, 50.0, "rent")
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	if withdrawal.Fee != 1.00 {
+		t.Errorf("expected fee 1.00 on the record, got %.2f", withdrawal.Fee)
+	}
+	assertBalance(t, svc, userId, 49.0)
+
+	totals, _ := svc.GetSystemTotals()
+	if totals.TotalWithdrawals != 50.0 || totals.TotalFees != 1.0 || !totals.Consistent {
+		t.Errorf("expected fees reported separately from withdrawals, got %+v", totals)
+	}
+
+	summary, _ := svc.GetAccountSummary(userId)
+	if summary.TotalWithdrawals != 50.0 || summary.TotalFees != 1.0 {
+		t.Errorf("expected fees in the summary, got %+v", summary)
+	}
+
+	// voiding the withdrawal refunds its fee
+	if _, err := svc.VoidTransaction(userId, withdrawal.ID, "cancelled"); err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+	assertBalance(t, svc, userId, 100.0)
+	totals, _ = svc.GetSystemTotals()
+	if totals.TotalFees != 0 || !totals.Consistent {
+		t.Errorf("expected the fee to be refunded, got %+v", totals)
+	}
+}
+
+func TestPreviewTransaction(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore(), WithFeeSchedule(StandardFeeSchedule()))
+	userId := "fee_user"
+	svc.RecordTransaction(userId, models.Deposit, 100.0, "funding")
+
+	tests := []struct {
+		name     string
+		input    TransactionInput
+		expected TransactionPreview
+	}{
+		{
+			name:     "Withdrawal",
+			input:    TransactionInput{Type: models.Withdrawal, Amount: 20.0},
+			expected: TransactionPreview{Type: models.Withdrawal, Amount: 20.0, Fee: 0.70, Total: 20.70, BalanceAfter: 79.30, Allowed: true},
+		},
+		{
+			name:     "Withdrawal not covered with the fee",
+			input:    TransactionInput{Type: models.Withdrawal, Amount: 99.50},
+			expected: TransactionPreview{Type: models.Withdrawal, Amount: 99.50, Fee: 1.50, Total: 101.00, BalanceAfter: -1.00, Allowed: false},
+		},
+		{
+			name:     "Deposit",
+			input:    TransactionInput{Type: models.Deposit, Amount: 20.0},
+			expected: TransactionPreview{Type: models.Deposit, Amount: 20.0, Fee: 0, Total: 20.0, BalanceAfter: 120.0, Allowed: true},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			preview, err := svc.PreviewTransaction(userId, test.input)
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if preview != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, preview)
+			}
+		})
+	}
+
+	if _, err := svc.PreviewTransaction(userId, TransactionInput{Type: models.Withdrawal, Amount: -1}); err == nil {
+		t.Error("expected the preview to validate the input")
+	}
+	assertBalance(t, svc, userId, 100.0)
+}
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+var ErrIdempotencyKeyReused = errors.New("idempotency key was already used with a different request")
+
+const maxIdempotencyKeyLength = 64
+
+type idempotencyCacheKey struct {
+	userId string
+	key    string
+}
+
+type idempotencyEntry struct {
+	cacheKey    idempotencyCacheKey
+	fingerprint string
+	response    []byte // the serialized original record
+	expiresAt   time.Time
+}
+
+// idempotencyCache keeps the serialized result of recent idempotent requests, bounded by ttl and size (LRU).
+// it's only a fast path: the store index on the idempotency key is the source of truth, so an evicted entry
+// can never turn a retry into a duplicate
+type idempotencyCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	maxSize int
+	entries map[idempotencyCacheKey]*list.Element
+	order   *list.List // front is the most recently used
+	now     func() time.Time
+}
+
+func newIdempotencyCache(ttl time.Duration, maxSize int) *idempotencyCache {
+	return &idempotencyCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+		entries: make(map[idempotencyCacheKey]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+func (c *idempotencyCache) get(key idempotencyCacheKey) (idempotencyEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, exists := c.entries[key]
+	if !exists {
+		return idempotencyEntry{}, false
+	}
+
+	entry := elem.Value.(*idempotencyEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return idempotencyEntry{}, false
+	}
+
+	c.order.MoveToFront(elem)
+	return *entry, true
+}
+
+func (c *idempotencyCache) put(key idempotencyCacheKey, fingerprint string, response []byte) {
+	if c.maxSize <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &idempotencyEntry{
+		cacheKey:    key,
+		fingerprint: fingerprint,
+		response:    response,
+		expiresAt:   c.now().Add(c.ttl),
+	}
+
+	if elem, exists := c.entries[key]; exists {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.maxSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*idempotencyEntry).cacheKey)
+	}
+}
+
+// forgetUser drops the cached responses of the user, they'd replay records that no longer exist under that ID
+func (c *idempotencyCache) forgetUser(userId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, elem := range c.entries {
+		if key.userId == userId {
+			c.order.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// RecordTransactionIdempotent records the transaction once per (userId, key). retries with the same key get the
+// original record back with wasReplay set, a retry with the same key but a different request is rejected
+func (s *ledgerService) RecordTransactionIdempotent(userId, key string, input TransactionInput) (models.TransactionRecord, bool, error) {
+	ctx, span := s.startSpan("RecordTransactionIdempotent", userId, input.Type)
+	tx, wasReplay, err := s.recordTransactionIdempotent(ctx, userId, key, input)
+	if !wasReplay {
+		s.metrics.ObserveTransaction(string(input.Type), transactionOutcome(err))
+		s.recordAudit(operationRecordTransaction, userId, err)
+	}
+	span.SetAttributes(attribute.Bool("ledger.replayed", wasReplay))
+	endSpan(span, transactionOutcome(err), err)
+	return tx, wasReplay, err
+}
+
+func (s *ledgerService) recordTransactionIdempotent(ctx context.Context, userId, key string, input TransactionInput) (models.TransactionRecord, bool, error) {
+	if err := validateIdempotencyKey(key); err != nil {
+		return models.TransactionRecord{}, false, err
+	}
+
+	if err := s.validateTransactionInput(userId, &input); err != nil {
+		return models.TransactionRecord{}, false, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return models.TransactionRecord{}, false, err
+	}
+
+	cacheKey := idempotencyCacheKey{userId: userId, key: key}
+	fingerprint := inputFingerprint(input)
+
+	if entry, found := s.idempotency.get(cacheKey); found {
+		if entry.fingerprint != fingerprint {
+			return models.TransactionRecord{}, false, ErrIdempotencyKeyReused
+		}
+
+		var tx models.TransactionRecord
+		if err := json.Unmarshal(entry.response, &tx); err == nil {
+			return tx, true, nil
+		}
+	}
+
+	if err := s.runValidators(ctx, userId, input); err != nil {
+		return models.TransactionRecord{}, false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return models.TransactionRecord{}, false, err
+	}
+
+	tx := s.newTransactionRecord(input)
+	tx.IdempotencyKey = key
+
+	end := s.storeSpan(ctx, "InsertIdempotentTransaction")
+	stored, replayed, err := s.store.InsertIdempotentTransaction(userId, tx)
+	end(err)
+	if err != nil {
+		return models.TransactionRecord{}, false, err
+	}
+
+	// a key used by a transfer names its debit leg, which is never a replay of a single transaction
+	if replayed && (stored.JournalID != nil || recordFingerprint(stored) != fingerprint) {
+		return models.TransactionRecord{}, false, ErrIdempotencyKeyReused
+	}
+
+	if response, err := json.Marshal(stored); err == nil {
+		s.idempotency.put(cacheKey, recordFingerprint(stored), response)
+	}
+
+	return stored, replayed, nil
+}
+
+// TransferIdempotent is Transfer once per (fromUserId, key), the key space is shared with
+// RecordTransactionIdempotent. a retry gets the original journal back with wasReplay set, a retry with the same key
+// but a different transfer is rejected
+func (s *ledgerService) TransferIdempotent(fromUserId, key, toUserId string, amount float64, description string) (_ models.Journal, wasReplay bool, err error) {
+	ctx, span := s.startSpan("TransferIdempotent", fromUserId, models.Withdrawal)
+	defer func() {
+		if !wasReplay {
+			s.recordAudit(operationTransfer, fromUserId, err)
+		}
+		endSpan(span, transactionOutcome(err), err)
+	}()
+
+	if err := validateIdempotencyKey(key); err != nil {
+		return models.Journal{}, false, err
+	}
+
+	description, err = s.validateTransfer(fromUserId, toUserId, amount, description)
+	if err != nil {
+		return models.Journal{}, false, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return models.Journal{}, false, err
+	}
+
+	end := s.storeSpan(ctx, "TransferIdempotent")
+	journal, replayed, err := s.store.TransferIdempotent(fromUserId, toUserId, amount, description, key)
+	end(err)
+	if errors.Is(err, store.ErrIdempotencyKeyTaken) {
+		return models.Journal{}, false, ErrIdempotencyKeyReused
+	}
+	if err != nil {
+		return models.Journal{}, false, err
+	}
+
+	if replayed && !sameTransfer(journal, fromUserId, toUserId, amount, description) {
+		return models.Journal{}, false, ErrIdempotencyKeyReused
+	}
+	return journal, replayed, nil
+}
+
+func sameTransfer(journal models.Journal, fromUserId, toUserId string, amount float64, description string) bool {
+	if len(journal.Entries) != 2 {
+		return false
+	}
+	for _, entry := range journal.Entries {
+		expectedUser, expectedType := toUserId, models.Deposit
+		if entry.Transaction.Type == models.Withdrawal {
+			expectedUser, expectedType = fromUserId, models.Withdrawal
+		}
+		tx := entry.Transaction
+		if entry.UserID != expectedUser || tx.Type != expectedType || tx.Amount != amount || tx.Description != description {
+			return false
+		}
+	}
+	return true
+}
+
+func validateIdempotencyKey(key string) error {
+	if key == "" || len(key) > maxIdempotencyKeyLength {
+		return &ValidationError{
+			Field:   "idempotencyKey",
+			Code:    "invalid_idempotency_key",
+			Message: fmt.Sprintf("idempotency key must be 1-%d characters", maxIdempotencyKeyLength),
+		}
+	}
+	return nil
+}
+
+func inputFingerprint(input TransactionInput) string {
+	return fmt.Sprintf("%s|%v|%s|%s", input.Type, input.Amount, input.Description, input.ReferenceID)
+}
+
+func recordFingerprint(tx models.TransactionRecord) string {
+	return inputFingerprint(TransactionInput{
+		Type:        tx.Type,
+		Amount:      tx.Amount,
+		Description: tx.Description,
+		ReferenceID: tx.ReferenceID,
+	})
+}
@@ -0,0 +1,235 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/clock/clocktest"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestRecordTransactionIdempotent_Replay(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	input := TransactionInput{Type: models.Deposit, Amount: 100.0, Description: "salary"}
+	original, wasReplay, err := svc.RecordTransactionIdempotent("idem_user", "key-1", input)
+	if err != nil {
+		t.Fatalf("failed to record transaction: %v", err)
+	}
+	if wasReplay {
+		t.Errorf("first request must not be a replay")
+	}
+
+	replay, wasReplay, err := svc.RecordTransactionIdempotent("idem_user", "key-1", input)
+	if err != nil {
+		t.Fatalf("failed to replay transaction: %v", err)
+	}
+	if !wasReplay {
+		t.Errorf("expected a replay")
+	}
+	if replay.ID != original.ID || !replay.Timestamp.Equal(original.Timestamp) {
+		t.Errorf("expected the original record back, got %+v want %+v", replay, original)
+	}
+
+	input.Amount = 200.0
+	if _, _, err := svc.RecordTransactionIdempotent("idem_user", "key-1", input); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("expected key reuse error, got %v", err)
+	}
+
+	// keys are scoped per user
+	if _, wasReplay, err := svc.RecordTransactionIdempotent("other_user", "key-1", input); err != nil || wasReplay {
+		t.Errorf("expected a new record for another user, got replay=%v err=%v", wasReplay, err)
+	}
+
+	assertBalance(t, svc, "idem_user", 100.0)
+}
+
+func TestRecordTransactionIdempotent_AfterEviction(t *testing.T) {
+	config := DefaultConfig()
+	config.IdempotencyCacheSize = 1
+	config.IdempotencyTTL = time.Minute
+	clock := clocktest.NewFake(clocktest.Start)
+	svc := NewLedgerService(store.NewLedgerStore(), WithConfig(config), WithClock(clock))
+	cache := svc.(*ledgerService).idempotency
+
+	input := TransactionInput{Type: models.Deposit, Amount: 10.0}
+	first, _, err := svc.RecordTransactionIdempotent("evict_user", "key-a", input)
+	if err != nil {
+		t.Fatalf("failed to record transaction: %v", err)
+	}
+
+	// key-b pushes key-a out of the cache
+	if _, _, err := svc.RecordTransactionIdempotent("evict_user", "key-b", input); err != nil {
+		t.Fatalf("failed to record transaction: %v", err)
+	}
+	if _, found := cache.get(idempotencyCacheKey{userId: "evict_user", key: "key-a"}); found {
+		t.Fatalf("expected key-a to be evicted")
+	}
+
+	// the original can still be found in the store so the retry is a replay, not a new record
+	retry, wasReplay, err := svc.RecordTransactionIdempotent("evict_user", "key-a", input)
+	if err != nil || !wasReplay || retry.ID != first.ID {
+		t.Errorf("expected replay of %s after eviction, got %s replay=%v err=%v", first.ID, retry.ID, wasReplay, err)
+	}
+
+	// same after the ttl expired
+	clock.Advance(2 * time.Minute)
+	retry, wasReplay, err = svc.RecordTransactionIdempotent("evict_user", "key-a", input)
+	if err != nil || !wasReplay || retry.ID != first.ID {
+		t.Errorf("expected replay of %s after expiry, got %s replay=%v err=%v", first.ID, retry.ID, wasReplay, err)
+	}
+
+	history, _ := svc.GetPaginatedTransactionHistory("evict_user", nil, nil, 1, 10)
+	if history.TotalCount != 2 {
+		t.Errorf("expected 2 transactions, got %d", history.TotalCount)
+	}
+}
+
+func TestRecordTransactionIdempotent_ConcurrentRetries(t *testing.T) {
+	config := DefaultConfig()
+	config.IdempotencyCacheSize = 0 // every retry has to go through the store
+	svc := NewLedgerService(store.NewLedgerStore(), WithConfig(config))
+
+	numGoroutines := 50
+	var replays int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	wg.Add(numGoroutines)
+
+	for i := 0; i < numGoroutines; i++ {
+		go func() {
+			defer wg.Done()
+			_, wasReplay, err := svc.RecordTransactionIdempotent("race_user", "same-key", TransactionInput{Type: models.Deposit, Amount: 5.0})
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+			if wasReplay {
+				mu.Lock()
+				replays++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if replays != numGoroutines-1 {
+		t.Errorf("expected %d replays, got %d", numGoroutines-1, replays)
+	}
+	assertBalance(t, svc, "race_user", 5.0)
+}
+
+func TestRecordTransactionIdempotent_InvalidKey(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	input := TransactionInput{Type: models.Deposit, Amount: 5.0}
+
+	for _, key := range []string{"", string(make([]byte, 65))} {
+		if _, _, err := svc.RecordTransactionIdempotent("valid_user", key, input); err == nil {
+			t.Errorf("expected error for key of length %d", len(key))
+		}
+	}
+}
+
+func TestIdempotencyCache_LRU(t *testing.T) {
+	cache := newIdempotencyCache(time.Hour, 2)
+	a := idempotencyCacheKey{userId: "u", key: "a"}
+	b := idempotencyCacheKey{userId: "u", key: "b"}
+	c := idempotencyCacheKey{userId: "u", key: "c"}
+
+	cache.put(a, "fa", []byte("A"))
+	cache.put(b, "fb", []byte("B"))
+	cache.get(a) // a becomes the most recently used
+	cache.put(c, "fc", []byte("C"))
+
+	if _, found := cache.get(b); found {
+		t.Errorf("expected b to be evicted")
+	}
+	if entry, found := cache.get(a); !found || string(entry.response) != "A" {
+		t.Errorf("expected a to be kept")
+	}
+	if _, found := cache.get(c); !found {
+		t.Errorf("expected c to be kept")
+	}
+}
+
+func TestTransferIdempotent(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	if _, err := svc.RecordTransaction("alice", models.Deposit, 100.0, "seed"); err != nil {
+		t.Fatalf("failed to seed: %v", err)
+	}
+
+	original, wasReplay, err := svc.TransferIdempotent("alice", "transfer-1", "bob", 30.0, "rent")
+	if err != nil || wasReplay {
+		t.Fatalf("expected a new transfer, got replay=%v err=%v", wasReplay, err)
+	}
+
+	replay, wasReplay, err := svc.TransferIdempotent("alice", "transfer-1", "bob", 30.0, "rent")
+	if err != nil || !wasReplay {
+		t.Fatalf("expected a replay, got replay=%v err=%v", wasReplay, err)
+	}
+	if replay.ID != original.ID {
+		t.Errorf("expected the original journal %s back, got %s", original.ID, replay.ID)
+	}
+	for i, entry := range replay.Entries {
+		if entry.BalanceAfter == nil || *entry.BalanceAfter != *original.Entries[i].BalanceAfter {
+			t.Errorf("expected the original balance after on leg %d", i)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		toUserId string
+		amount   float64
+		key      string
+	}{
+		{name: "different amount", toUserId: "bob", amount: 31.0, key: "transfer-1"},
+		{name: "different recipient", toUserId: "carol", amount: 30.0, key: "transfer-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := svc.TransferIdempotent("alice", tt.key, tt.toUserId, tt.amount, "rent"); !errors.Is(err, ErrIdempotencyKeyReused) {
+				t.Errorf("expected key reuse error, got %v", err)
+			}
+		})
+	}
+
+	assertBalance(t, svc, "alice", 70.0)
+	assertBalance(t, svc, "bob", 30.0)
+}
+
+func TestIdempotencyKeysSharedBetweenTransactionsAndTransfers(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	input := TransactionInput{Type: models.Deposit, Amount: 100.0}
+	if _, _, err := svc.RecordTransactionIdempotent("alice", "key-1", input); err != nil {
+		t.Fatalf("failed to record: %v", err)
+	}
+	if _, _, err := svc.TransferIdempotent("alice", "key-1", "bob", 10.0, ""); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("expected a transaction's key to be rejected for a transfer, got %v", err)
+	}
+
+	if _, _, err := svc.TransferIdempotent("alice", "key-2", "bob", 10.0, ""); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	withdrawal := TransactionInput{Type: models.Withdrawal, Amount: 10.0}
+	if _, _, err := svc.RecordTransactionIdempotent("alice", "key-2", withdrawal); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("expected a transfer's key to be rejected for a transaction, got %v", err)
+	}
+
+	assertBalance(t, svc, "alice", 90.0)
+}
+
+func TestIdempotencyKeyValidation(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	for _, key := range []string{"", string(make([]byte, 65))} {
+		_, _, err := svc.RecordTransactionIdempotent("alice", key, TransactionInput{Type: models.Deposit, Amount: 1.0})
+		assertValidationCode(t, err, "invalid_idempotency_key")
+
+		_, _, err = svc.TransferIdempotent("alice", key, "bob", 1.0, "")
+		assertValidationCode(t, err, "invalid_idempotency_key")
+	}
+}
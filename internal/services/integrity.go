@@ -0,0 +1,55 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/errreport"
+)
+
+// IntegrityReport is the outcome of the consistency checks of the whole ledger, Consistent is true when both passed
+type IntegrityReport struct {
+	Consistent         bool        `json:"consistent"`
+	TotalsConsistent   bool        `json:"totalsConsistent"`   // the trial balance of GetSystemTotals
+	UnbalancedJournals []uuid.UUID `json:"unbalancedJournals"` // the double-entry check, empty when every journal balances
+}
+
+// CheckIntegrity runs the trial balance and the double-entry check, every failed one is reported
+func (s *ledgerService) CheckIntegrity() (IntegrityReport, error) {
+	totals, err := s.GetSystemTotals()
+	if err != nil {
+		return IntegrityReport{}, err
+	}
+	if !totals.Consistent {
+		// the amounts stay out of the report, like the ones of the journals
+		s.reportIntegrity("totals", "the deposits minus the withdrawals and fees don't match the sum of the balances")
+	}
+
+	unbalanced, err := s.UnbalancedJournals()
+	if err != nil {
+		return IntegrityReport{}, err
+	}
+	if unbalanced == nil {
+		unbalanced = []uuid.UUID{}
+	}
+
+	return IntegrityReport{
+		Consistent:         totals.Consistent && len(unbalanced) == 0,
+		TotalsConsistent:   totals.Consistent,
+		UnbalancedJournals: unbalanced,
+	}, nil
+}
+
+// reportIntegrity reports a failed consistency check, check names it in the tags
+func (s *ledgerService) reportIntegrity(check, message string) {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	s.reporter.Report(ctx, errreport.Report{
+		Kind:    errreport.KindIntegrity,
+		Message: message,
+		Tags:    map[string]string{"check": check},
+	})
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/errreport/errreporttest"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestCheckIntegrity(t *testing.T) {
+	s := store.NewLedgerStore()
+	reporter := &errreporttest.Reporter{}
+	svc := NewLedgerService(s, WithErrorReporter(reporter))
+
+	if _, err := svc.RecordTransaction("sender", models.Deposit, 100, "salary"); err != nil {
+		t.Fatalf("failed to deposit: %v", err)
+	}
+	if _, err := svc.Transfer("sender", "receiver", 40, "rent"); err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	report, err := svc.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.Consistent || !report.TotalsConsistent || report.UnbalancedJournals == nil || len(report.UnbalancedJournals) != 0 {
+		t.Errorf("expected a consistent ledger, got %+v", report)
+	}
+	if reports := reporter.Reports(); len(reports) != 0 {
+		t.Errorf("expected nothing reported, got %+v", reports)
+	}
+
+	// the odd dollar is lost in the sum of the deposits but not in the sum of the balances
+	s.AddTransactionWithTime("whale", models.TransactionRecord{ID: uuid.New(), Type: models.Deposit, Amount: 1e16})
+	s.AddTransactionWithTime("whale", models.TransactionRecord{ID: uuid.New(), Type: models.Withdrawal, Amount: 1e16})
+	s.AddTransactionWithTime("minnow", models.TransactionRecord{ID: uuid.New(), Type: models.Deposit, Amount: 1})
+
+	report, err = svc.CheckIntegrity()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Consistent || report.TotalsConsistent || len(report.UnbalancedJournals) != 0 {
+		t.Errorf("expected the totals to fail the check, got %+v", report)
+	}
+	reports := reporter.Reports()
+	if len(reports) != 1 || reports[0].Kind != errreport.KindIntegrity || reports[0].Tags["check"] != "totals" {
+		t.Errorf("expected the totals reported, got %+v", reports)
+	}
+}
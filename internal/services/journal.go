@@ -0,0 +1,209 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+// Transfer moves money from one user to another as a balanced pair of journal entries
+func (s *ledgerService) Transfer(fromUserId, toUserId string, amount float64, description string) (_ models.Journal, err error) {
+	ctx, span := s.startSpan("Transfer", fromUserId, models.Withdrawal)
+	defer func() {
+		s.recordAudit(operationTransfer, fromUserId, err)
+		endSpan(span, transactionOutcome(err), err)
+	}()
+
+	description, err = s.validateTransfer(fromUserId, toUserId, amount, description)
+	if err != nil {
+		return models.Journal{}, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return models.Journal{}, err
+	}
+
+	end := s.storeSpan(ctx, "Transfer")
+	journal, err := s.store.Transfer(fromUserId, toUserId, amount, description)
+	end(err)
+	return s.roundBalancesAfter(journal), err
+}
+
+// roundBalancesAfter rounds the balances the store filled in after each leg to cents, like every balance the
+// service returns
+func (s *ledgerService) roundBalancesAfter(journal models.Journal) models.Journal {
+	for i, entry := range journal.Entries {
+		if entry.BalanceAfter != nil {
+			balance := s.round(*entry.BalanceAfter)
+			journal.Entries[i].BalanceAfter = &balance
+		}
+	}
+	return journal
+}
+
+// validateTransfer checks both users and the amount and returns the normalized description
+func (s *ledgerService) validateTransfer(fromUserId, toUserId string, amount float64, description string) (string, error) {
+	if err := validateUserId(fromUserId); err != nil {
+		return "", err
+	}
+
+	if err := validateUserId(toUserId); err != nil {
+		return "", &ValidationError{Field: "toUserId", Code: "invalid_user_id", Message: "invalid target user ID"}
+	}
+
+	if fromUserId == toUserId {
+		return "", &ValidationError{Field: "toUserId", Code: "self_transfer", Message: "cannot transfer to the same user"}
+	}
+
+	if amount <= 0 {
+		return "", &ValidationError{Field: "amount", Code: "not_positive", Message: "amount must be positive"}
+	}
+
+	// the sender withdraws the amount, the configured limits of a withdrawal apply
+	if err := s.checkAmountLimits(models.Withdrawal, amount); err != nil {
+		return "", err
+	}
+
+	description, err := s.normalizeDescription(description)
+	if err != nil {
+		return "", err
+	}
+
+	for _, userId := range []string{fromUserId, toUserId} {
+		if err := s.requireAccount(userId); err != nil {
+			return "", err
+		}
+	}
+	return description, nil
+}
+
+const maxJournalLegs = 50
+
+// PostJournal applies a multi-party entry (e.g. a payment split between a merchant, a fee account and tax)
+// atomically, debits must equal credits and any failing leg aborts the whole journal. every user of a leg gets the
+// audit event
+func (s *ledgerService) PostJournal(legs []models.JournalLeg) (_ models.Journal, err error) {
+	defer func() {
+		for _, userId := range journalUsers(legs) {
+			s.recordAudit(operationPostJournal, userId, err)
+		}
+	}()
+
+	if len(legs) < 2 {
+		return models.Journal{}, &ValidationError{Field: "legs", Code: "required", Message: "journal must have at least two legs"}
+	}
+
+	if len(legs) > maxJournalLegs {
+		return models.Journal{}, &ValidationError{
+			Field:   "legs",
+			Code:    "max_items",
+			Message: fmt.Sprintf("journal cannot have more than %d legs", maxJournalLegs),
+		}
+	}
+
+	legs = append([]models.JournalLeg(nil), legs...) // descriptions are normalized in place
+	var debits, credits float64
+	for i, leg := range legs {
+		if err := validateUserId(leg.UserID); err != nil {
+			return models.Journal{}, legError(i, err)
+		}
+
+		if err := s.requireAccount(leg.UserID); err != nil {
+			return models.Journal{}, legError(i, err)
+		}
+
+		if leg.Amount <= 0 || math.IsNaN(leg.Amount) {
+			return models.Journal{}, legError(i, &ValidationError{Code: "not_positive", Rule: RulePositive, Message: "amount must be positive"})
+		}
+
+		if leg.Amount > maxTransactionAmount {
+			return models.Journal{}, legError(i, &ValidationError{
+				Code: "max_amount", Rule: RuleMax, Max: limit(maxTransactionAmount),
+				Message: "amount exceeds maximum allowed",
+			})
+		}
+
+		description, err := s.normalizeDescription(leg.Description)
+		if err != nil {
+			return models.Journal{}, legError(i, err)
+		}
+		legs[i].Description = description
+
+		switch leg.Direction {
+		case models.Debit:
+			debits = store.Settle(debits + leg.Amount)
+		case models.Credit:
+			credits = store.Settle(credits + leg.Amount)
+		default:
+			return models.Journal{}, legError(i, &ValidationError{
+				Code: "invalid_value", Rule: RuleEnum, Allowed: []string{string(models.Debit), string(models.Credit)},
+				Message: "invalid direction, use debit or credit",
+			})
+		}
+	}
+
+	// exactly, the store refuses anything else: a journal off by a fraction of a cent would never balance
+	if debits != credits {
+		return models.Journal{}, &ValidationError{
+			Field:   "legs",
+			Code:    "unbalanced",
+			Message: fmt.Sprintf("unbalanced journal: debits %v do not equal credits %v", debits, credits),
+		}
+	}
+
+	journal, err := s.store.PostJournal(legs)
+	return s.roundBalancesAfter(journal), err
+}
+
+// legError is the rejection of leg i, a validation error is moved to the field legs[i]
+func legError(i int, err error) error {
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		return fmt.Errorf("leg %d: %w", i, err)
+	}
+	leg := *validationErr
+	leg.Field = fmt.Sprintf("legs[%d]", i)
+	leg.Message = fmt.Sprintf("leg %d: %s", i, validationErr.Message)
+	return &leg
+}
+
+// journalUsers is every user of the legs once, in the order of the legs
+func journalUsers(legs []models.JournalLeg) []string {
+	var userIds []string
+	for _, leg := range legs {
+		if !slices.Contains(userIds, leg.UserID) {
+			userIds = append(userIds, leg.UserID)
+		}
+	}
+	return userIds
+}
+
+func (s *ledgerService) GetJournal(journalID uuid.UUID) (models.Journal, error) {
+	return s.store.GetJournal(journalID)
+}
+
+// ReverseJournal reverses every leg of the journal atomically under a new journal
+func (s *ledgerService) ReverseJournal(journalID uuid.UUID) (models.Journal, error) {
+	return s.store.ReverseJournal(journalID)
+}
+
+// UnbalancedJournals is the double-entry consistency check, it returns the journals whose legs don't sum to zero.
+// a failed check is reported, the ids go along but not the amounts
+func (s *ledgerService) UnbalancedJournals() ([]uuid.UUID, error) {
+	unbalanced := s.store.UnbalancedJournals()
+	if len(unbalanced) > 0 {
+		ids := make([]string, len(unbalanced))
+		for i, id := range unbalanced {
+			ids[i] = id.String()
+		}
+		s.reportIntegrity("journals", fmt.Sprintf("%d journals don't balance: %s", len(unbalanced), strings.Join(ids, ", ")))
+	}
+	return unbalanced, nil
+}
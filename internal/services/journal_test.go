@@ -0,0 +1,406 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/audit"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestTransfer_JournalPair(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	if _, err := svc.RecordTransaction("sender", models.Deposit, 100.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+
+	journal, err := svc.Transfer("sender", "receiver", 40.0, "rent split")
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	if len(journal.Entries) != 2 {
+		t.Fatalf("expected 2 legs, got %d", len(journal.Entries))
+	}
+
+	for _, entry := range journal.Entries {
+		if entry.Transaction.JournalID == nil || *entry.Transaction.JournalID != journal.ID {
+			t.Errorf("leg of %s doesn't reference journal %s", entry.UserID, journal.ID)
+		}
+	}
+
+	fetched, err := svc.GetJournal(journal.ID)
+	if err != nil {
+		t.Fatalf("failed to get journal: %v", err)
+	}
+	if len(fetched.Entries) != 2 || fetched.Entries[0].UserID != "sender" || fetched.Entries[1].UserID != "receiver" {
+		t.Errorf("unexpected journal legs: %+v", fetched.Entries)
+	}
+
+	assertBalance(t, svc, "sender", 60.0)
+	assertBalance(t, svc, "receiver", 40.0)
+
+	if _, err := svc.GetJournal(uuid.New()); !errors.Is(err, store.ErrJournalNotFound) {
+		t.Errorf("expected journal not found error, got %v", err)
+	}
+
+	unbalanced, err := svc.UnbalancedJournals()
+	if err != nil || len(unbalanced) != 0 {
+		t.Errorf("expected no unbalanced journals, got %v (err: %v)", unbalanced, err)
+	}
+}
+
+func TestTransfer_BalanceAfterInCents(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	if _, err := svc.RecordTransaction("sender", models.Deposit, 10.004, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+
+	journal, err := svc.Transfer("sender", "receiver", 1, "coffee")
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	// the store keeps 9.004, the balances are returned in cents
+	for _, entry := range journal.Entries {
+		if expected := map[string]float64{"sender": 9, "receiver": 1}[entry.UserID]; entry.BalanceAfter == nil || *entry.BalanceAfter != expected {
+			t.Errorf("expected %s at %v after the transfer, got %v", entry.UserID, expected, entry.BalanceAfter)
+		}
+	}
+}
+
+func TestTransfer_Validation(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	if _, err := svc.RecordTransaction("sender", models.Deposit, 100.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		from   string
+		to     string
+		amount float64
+	}{
+		{"Self transfer", "sender", "sender", 10.0},
+		{"Invalid target", "sender", "bad@user", 10.0},
+		{"Zero amount", "sender", "receiver", 0.0},
+		{"Excessive amount", "sender", "receiver", 2000000.0},
+		{"Insufficient funds", "sender", "receiver", 100.01},
+		{"Unknown sender", "nobody", "receiver", 1.0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := svc.Transfer(test.from, test.to, test.amount, "invalid"); err == nil {
+				t.Errorf("expected error but got none")
+			}
+		})
+	}
+
+	assertBalance(t, svc, "sender", 100.0)
+}
+
+func TestTransfer_ConfiguredLimits(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxWithdrawalAmount = 50.0
+	config.MinWithdrawalAmount = 5.0
+	svc := NewLedgerService(store.NewLedgerStore(), WithConfig(config))
+	if _, err := svc.RecordTransaction("sender", models.Deposit, 100.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		amount       float64
+		expectedCode string
+	}{
+		{"At the maximum", 50.0, ""},
+		{"Above the maximum", 50.01, "max_amount"},
+		{"Below the minimum", 4.99, "min_amount"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := svc.Transfer("sender", "receiver", test.amount, "limits")
+			var validationErr *ValidationError
+			if test.expectedCode == "" {
+				if err != nil {
+					t.Errorf("expected the transfer to go through, got %v", err)
+				}
+				return
+			}
+			if !errors.As(err, &validationErr) || validationErr.Code != test.expectedCode || validationErr.Field != "amount" {
+				t.Errorf("expected %s on amount, got %v", test.expectedCode, err)
+			}
+		})
+	}
+
+	assertBalance(t, svc, "sender", 50.0)
+}
+
+func TestReverseJournal(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	if _, err := svc.RecordTransaction("sender", models.Deposit, 100.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+
+	journal, err := svc.Transfer("sender", "receiver", 40.0, "rent split")
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	reversal, err := svc.ReverseJournal(journal.ID)
+	if err != nil {
+		t.Fatalf("failed to reverse journal: %v", err)
+	}
+
+	if reversal.ID == journal.ID || reversal.ReversalOf == nil || *reversal.ReversalOf != journal.ID {
+		t.Errorf("reversal should be a new journal linked to the original: %+v", reversal)
+	}
+
+	assertBalance(t, svc, "sender", 100.0)
+	assertBalance(t, svc, "receiver", 0.0)
+
+	original, err := svc.GetJournal(journal.ID)
+	if err != nil {
+		t.Fatalf("failed to get journal: %v", err)
+	}
+	if original.ReversedBy == nil || *original.ReversedBy != reversal.ID {
+		t.Errorf("original journal should be marked as reversed by %s", reversal.ID)
+	}
+	for _, entry := range original.Entries {
+		if entry.Transaction.ReversedBy == nil {
+			t.Errorf("leg of %s should be marked as reversed", entry.UserID)
+		}
+	}
+
+	if _, err := svc.ReverseJournal(journal.ID); !errors.Is(err, store.ErrAlreadyReversed) {
+		t.Errorf("expected already reversed error, got %v", err)
+	}
+
+	if _, err := svc.ReverseJournal(reversal.ID); !errors.Is(err, store.ErrReversalOfReversal) {
+		t.Errorf("expected reversal of reversal error, got %v", err)
+	}
+
+	unbalanced, _ := svc.UnbalancedJournals()
+	if len(unbalanced) != 0 {
+		t.Errorf("expected no unbalanced journals, got %v", unbalanced)
+	}
+}
+
+func TestReverseJournal_RecipientAlreadySpent(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	if _, err := svc.RecordTransaction("sender", models.Deposit, 100.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+
+	journal, err := svc.Transfer("sender", "receiver", 40.0, "rent split")
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+
+	if _, err := svc.RecordTransaction("receiver", models.Withdrawal, 30.0, "spent it"); err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+
+	if _, err := svc.ReverseJournal(journal.ID); !errors.Is(err, store.ErrInsufficientFunds) {
+		t.Fatalf("expected insufficient funds error, got %v", err)
+	}
+
+	// nothing from the failed reversal must be applied
+	assertBalance(t, svc, "sender", 60.0)
+	assertBalance(t, svc, "receiver", 10.0)
+
+	original, err := svc.GetJournal(journal.ID)
+	if err != nil {
+		t.Fatalf("failed to get journal: %v", err)
+	}
+	if original.ReversedBy != nil {
+		t.Errorf("journal should not be marked as reversed")
+	}
+
+	history, _ := svc.GetPaginatedTransactionHistory("receiver", nil, nil, 1, 10)
+	if history.TotalCount != 2 {
+		t.Errorf("expected 2 receiver transactions, got %d", history.TotalCount)
+	}
+}
+
+func assertBalance(t *testing.T, svc LedgerService, userId string, expected float64) {
+	t.Helper()
+
+	balance, err := svc.GetCurrentBalance(userId)
+	if err != nil {
+		t.Fatalf("failed to get balance of %s: %v", userId, err)
+	}
+	if balance != expected {
+		t.Errorf("expected balance of %s to be %.2f, got %.2f", userId, expected, balance)
+	}
+}
+
+func TestPostJournal_ThreeParty(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	if _, err := svc.RecordTransaction("customer", models.Deposit, 200.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+
+	journal, err := svc.PostJournal([]models.JournalLeg{
+		{UserID: "customer", Direction: models.Debit, Amount: 100.0, Description: "order 42"},
+		{UserID: "merchant", Direction: models.Credit, Amount: 85.0, Description: "order 42"},
+		{UserID: "fee_account", Direction: models.Credit, Amount: 5.0, Description: "order 42 fee"},
+		{UserID: "tax_account", Direction: models.Credit, Amount: 10.0, Description: "order 42 tax"},
+	})
+	if err != nil {
+		t.Fatalf("failed to post journal: %v", err)
+	}
+
+	if len(journal.Entries) != 4 {
+		t.Fatalf("expected 4 legs, got %d", len(journal.Entries))
+	}
+
+	assertBalance(t, svc, "customer", 100.0)
+	assertBalance(t, svc, "merchant", 85.0)
+	assertBalance(t, svc, "fee_account", 5.0)
+	assertBalance(t, svc, "tax_account", 10.0)
+
+	if _, err := svc.ReverseJournal(journal.ID); err != nil {
+		t.Fatalf("failed to reverse three-party journal: %v", err)
+	}
+
+	assertBalance(t, svc, "customer", 200.0)
+	assertBalance(t, svc, "merchant", 0.0)
+
+	unbalanced, _ := svc.UnbalancedJournals()
+	if len(unbalanced) != 0 {
+		t.Errorf("expected no unbalanced journals, got %v", unbalanced)
+	}
+}
+
+func TestPostJournal_Rejected(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	if _, err := svc.RecordTransaction("customer", models.Deposit, 50.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+	if _, err := svc.RecordTransaction("partner", models.Deposit, 10.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		legs          []models.JournalLeg
+		expectedField string // of the ValidationError, none for the rejections of the store
+		expectedCode  string
+	}{
+		{"Unbalanced", []models.JournalLeg{
+			{UserID: "customer", Direction: models.Debit, Amount: 30.0},
+			{UserID: "merchant", Direction: models.Credit, Amount: 20.0},
+			{UserID: "fee_account", Direction: models.Credit, Amount: 5.0},
+		}, "legs", "unbalanced"},
+		{"Off by a fraction of a cent", []models.JournalLeg{
+			{UserID: "customer", Direction: models.Debit, Amount: 10.004},
+			{UserID: "merchant", Direction: models.Credit, Amount: 10.0},
+		}, "legs", "unbalanced"},
+		{"Single leg", []models.JournalLeg{
+			{UserID: "customer", Direction: models.Debit, Amount: 30.0},
+		}, "legs", "required"},
+		{"Invalid user", []models.JournalLeg{
+			{UserID: "customer", Direction: models.Debit, Amount: 30.0},
+			{UserID: "x", Direction: models.Credit, Amount: 30.0},
+		}, "legs[1]", "invalid_user_id"},
+		{"Invalid direction", []models.JournalLeg{
+			{UserID: "customer", Direction: "sideways", Amount: 30.0},
+			{UserID: "merchant", Direction: models.Credit, Amount: 30.0},
+		}, "legs[0]", "invalid_value"},
+		{"NaN amount", []models.JournalLeg{
+			{UserID: "customer", Direction: models.Debit, Amount: math.NaN()},
+			{UserID: "merchant", Direction: models.Credit, Amount: 30.0},
+		}, "legs[0]", "not_positive"},
+		{"Amount over the maximum", []models.JournalLeg{
+			{UserID: "customer", Direction: models.Debit, Amount: 30.0},
+			{UserID: "merchant", Direction: models.Credit, Amount: 2000000.0},
+		}, "legs[1]", "max_amount"},
+		{"One debited user without funds", []models.JournalLeg{
+			{UserID: "customer", Direction: models.Debit, Amount: 20.0},
+			{UserID: "partner", Direction: models.Debit, Amount: 20.0},
+			{UserID: "merchant", Direction: models.Credit, Amount: 40.0},
+		}, "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := svc.PostJournal(test.legs)
+			if err == nil {
+				t.Fatalf("expected error but got none")
+			}
+			if test.expectedField == "" {
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != test.expectedField || validationErr.Code != test.expectedCode {
+				t.Errorf("expected %s on %s, got %v", test.expectedCode, test.expectedField, err)
+			}
+		})
+	}
+
+	// a failing leg must abort the whole journal
+	assertBalance(t, svc, "customer", 50.0)
+	assertBalance(t, svc, "partner", 10.0)
+	assertBalance(t, svc, "merchant", 0.0)
+}
+
+func TestPostJournal_Audit(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	if _, err := svc.RecordTransaction("customer", models.Deposit, 100.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to add initial deposit: %v", err)
+	}
+
+	legs := []models.JournalLeg{
+		{UserID: "customer", Direction: models.Debit, Amount: 30.0},
+		{UserID: "merchant", Direction: models.Credit, Amount: 25.0},
+		{UserID: "merchant", Direction: models.Credit, Amount: 5.0},
+	}
+	if _, err := svc.PostJournal(legs); err != nil {
+		t.Fatalf("failed to post journal: %v", err)
+	}
+	legs[0].Amount = 300.0
+	legs[1].Amount = 295.0
+	if _, err := svc.PostJournal(legs); err == nil {
+		t.Fatal("expected insufficient funds")
+	}
+
+	result, err := svc.ListAuditEvents(audit.Filter{}, 1, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// every user once per journal, after the deposit
+	expected := []audit.Event{
+		{UserID: "customer", Operation: operationPostJournal, Outcome: audit.OutcomeSuccess},
+		{UserID: "merchant", Operation: operationPostJournal, Outcome: audit.OutcomeSuccess},
+		{UserID: "customer", Operation: operationPostJournal, Outcome: audit.OutcomeFailure, ErrorCode: "insufficient_funds"},
+		{UserID: "merchant", Operation: operationPostJournal, Outcome: audit.OutcomeFailure, ErrorCode: "insufficient_funds"},
+	}
+	if len(result.Events) != len(expected)+1 {
+		t.Fatalf("expected %d events, got %+v", len(expected)+1, result.Events)
+	}
+	for i, event := range result.Events[1:] {
+		event.Time = time.Time{}
+		if event != expected[i] {
+			t.Errorf("expected %+v at %d, got %+v", expected[i], i, event)
+		}
+	}
+}
@@ -1,80 +1,509 @@
 package services
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"regexp"
+	"strings"
+	"sync/atomic"
 	"time"
+	"unicode/utf8"
 
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"tiny-ledger/internal/audit"
+	"tiny-ledger/internal/clock"
+	"tiny-ledger/internal/errreport"
+	"tiny-ledger/internal/metrics"
 	"tiny-ledger/internal/models"
 	"tiny-ledger/internal/store"
 )
 
 type PaginatedTransactions struct {
-	Transactions []models.TransactionRecord
-	TotalCount   int
-	Page         int
-	PageSize     int
-	TotalPages   int
+	Transactions  []models.TransactionRecord
+	TotalCount    int
+	Page          int
+	PageSize      int
+	TotalPages    int
+	AccountExists bool // false for a user that never registered nor transacted, its history is empty
+}
+
+// HistoryFilter narrows down the transaction history, nil times are open ended
+type HistoryFilter struct {
+	StartTime     *time.Time
+	EndTime       *time.Time
+	ExcludeVoided bool
+	Type          *models.TransactionType // nil for every type
+	MinAmount     *float64                // inclusive, nil for no bound
+	MaxAmount     *float64                // inclusive, nil for no bound
+	Query         string                  // case-insensitive text searched in the description
+	Descending    bool                    // newest first
+}
+
+const maxHistoryQueryLength = 100
+
+// validate checks the filter and turns it into the store's
+func (f HistoryFilter) validate() (store.TransactionFilter, error) {
+	if f.StartTime != nil && f.EndTime != nil && f.StartTime.After(*f.EndTime) {
+		return store.TransactionFilter{}, &ValidationError{Field: "start", Code: "invalid_range", Message: "start time cannot be after end time"}
+	}
+
+	if f.Type != nil && *f.Type != models.Deposit && *f.Type != models.Withdrawal {
+		return store.TransactionFilter{}, &ValidationError{Field: "type", Code: "invalid_value", Message: "invalid transaction type"}
+	}
+
+	for _, bound := range []struct {
+		field  string
+		amount *float64
+	}{{"minAmount", f.MinAmount}, {"maxAmount", f.MaxAmount}} {
+		if bound.amount != nil && (*bound.amount < 0 || math.IsNaN(*bound.amount) || math.IsInf(*bound.amount, 0)) {
+			return store.TransactionFilter{}, &ValidationError{Field: bound.field, Code: "out_of_range", Message: bound.field + " must be a non negative number"}
+		}
+	}
+	if f.MinAmount != nil && f.MaxAmount != nil && *f.MinAmount > *f.MaxAmount {
+		return store.TransactionFilter{}, &ValidationError{Field: "minAmount", Code: "invalid_range", Message: "minAmount cannot be greater than maxAmount"}
+	}
+
+	query := strings.TrimSpace(f.Query)
+	if utf8.RuneCountInString(query) > maxHistoryQueryLength {
+		return store.TransactionFilter{}, &ValidationError{Field: "q", Code: "max_length", Message: fmt.Sprintf("q exceeds maximum length of %d characters", maxHistoryQueryLength)}
+	}
+
+	return store.TransactionFilter{
+		StartTime:     f.StartTime,
+		EndTime:       f.EndTime,
+		ExcludeVoided: f.ExcludeVoided,
+		Type:          f.Type,
+		MinAmount:     f.MinAmount,
+		MaxAmount:     f.MaxAmount,
+		Query:         query,
+		Descending:    f.Descending,
+	}, nil
+}
+
+type TransactionInput struct {
+	Type        models.TransactionType
+	Amount      float64
+	Description string
+	ReferenceID string // optional external reference, unique per user
+
+	// AllowDuplicate skips the duplicate detection window for an intentional repeat
+	AllowDuplicate bool
 }
 
 type LedgerService interface {
+	WithContext(ctx context.Context) LedgerService
 	RecordTransaction(userId string, txType models.TransactionType, amount float64, description string) (models.TransactionRecord, error)
+	RecordTransactionInput(userId string, input TransactionInput) (models.TransactionRecord, error)
+	RecordTransactionIdempotent(userId, key string, input TransactionInput) (tx models.TransactionRecord, wasReplay bool, err error)
+	RecordTransactionsBatch(userId string, inputs []TransactionInput) ([]models.TransactionRecord, error)
 	GetPaginatedTransactionHistory(userId string, startTime, endTime *time.Time, page, pageSize int) (PaginatedTransactions, error)
+	GetTransactionHistory(userId string, filter HistoryFilter, page, pageSize int) (PaginatedTransactions, error)
+	GetTransactionHistoryAfter(userId string, filter HistoryFilter, after *HistoryCursor, limit int) (CursorPage, error)
+	CountTransactions(userId string, filter HistoryFilter) (int, error)
+	GetRunningBalances(userId string, txIDs []uuid.UUID) (map[uuid.UUID]float64, error)
+	ExportTransactionsCSV(ctx context.Context, userId string, filter HistoryFilter, w io.Writer) error
 	GetCurrentBalance(userId string) (float64, error)
+	GetBalanceHistory(userId string, start, end time.Time) ([]BalancePoint, error)
+	GetSystemTotals() (SystemTotals, error)
+	Transfer(fromUserId, toUserId string, amount float64, description string) (models.Journal, error)
+	TransferIdempotent(fromUserId, key, toUserId string, amount float64, description string) (journal models.Journal, wasReplay bool, err error)
+	GetJournal(journalID uuid.UUID) (models.Journal, error)
+	ReverseJournal(journalID uuid.UUID) (models.Journal, error)
+	UnbalancedJournals() ([]uuid.UUID, error)
+	CheckIntegrity() (IntegrityReport, error)
+	PostJournal(legs []models.JournalLeg) (models.Journal, error)
+	Reconcile(userId string, r io.Reader) (ReconciliationReport, error)
+	ImportBankFile(userId string, r io.Reader, format string) (ImportReport, error)
+	RecordExternalPayment(payment ExternalPayment) (tx models.TransactionRecord, replayed bool, err error)
+	UpdateTransactionDescription(userId string, txID uuid.UUID, newDescription string) (models.TransactionRecord, error)
+	VoidTransaction(userId string, txID uuid.UUID, reason string) (models.TransactionRecord, error)
+	CreateUser(userId string) error
+	ListUsers(filter UserFilter, page, pageSize int) (PaginatedUsers, error)
+	DeleteUser(userId string, force bool) (float64, error)
+	AnonymizeUser(userId string, force bool) (float64, error)
+	Subscribe(fn func(event TransactionEvent)) (unsubscribe func())
+	GetAccountSummary(userId string) (AccountSummary, error)
+	GetMonthlyStatement(userId string, year, month int) (MonthlyStatement, error)
+	GetTotals(userId string, startTime, endTime *time.Time) (PeriodTotals, error)
+	GetTopTransactions(userId string, startTime, endTime *time.Time, txType *models.TransactionType, n int) ([]models.TransactionRecord, error)
+	SetMinimumBalance(userId string, amount float64) error
+	GetBalanceDetails(userId string) (BalanceDetails, error)
+	GetBalanceAsOf(userId string, at time.Time) (BalanceDetails, error)
+	PreviewTransaction(userId string, input TransactionInput) (TransactionPreview, error)
+	GetTransaction(userId string, txID uuid.UUID) (models.TransactionRecord, error)
+	ReverseTransaction(userId string, txID uuid.UUID, reason string) (models.TransactionRecord, error)
+	ReverseTransactionIfVersion(userId string, txID uuid.UUID, reason string, version uint64) (models.TransactionRecord, error)
+	GetLedgerVersion(userId string) (uint64, error)
+	GetLastModified(userId string) (time.Time, error)
+	ListAuditEvents(filter audit.Filter, page, pageSize int) (PaginatedAuditEvents, error)
+	Config() Config
+	SetConfig(config Config)
+}
+
+type Config struct {
+	// per transaction limits, a zero minimum only requires the amount to be positive
+	MaxDepositAmount    float64
+	MaxWithdrawalAmount float64
+	MinDepositAmount    float64
+	MinWithdrawalAmount float64
+
+	// ReconcileDateTolerance is how far apart a statement row and a ledger record can be and still match
+	ReconcileDateTolerance time.Duration
+
+	// IdempotencyTTL and IdempotencyCacheSize bound the cache of replayable responses
+	IdempotencyTTL       time.Duration
+	IdempotencyCacheSize int
+
+	// StrictAccounts requires users to be registered with CreateUser before they can transact or be queried,
+	// otherwise the first transaction implicitly opens the ledger
+	StrictAccounts bool
+
+	// AllowDescriptionNewlines keeps line breaks in descriptions, otherwise they are replaced with a space
+	AllowDescriptionNewlines bool
+
+	// EventBufferSize is how many transaction events can wait for the subscribers before new ones are dropped
+	EventBufferSize int
+
+	// DuplicateWindow rejects a transaction identical (type, amount, description) to one of the user recorded within
+	// the window with store.ErrPossibleDuplicate, zero disables the check
+	DuplicateWindow time.Duration
+
+	// RoundingPolicy rounds every computed amount (fees, interest, derived totals) to cents
+	RoundingPolicy RoundingPolicy
+
+	// Currency is the ISO 4217 code the ledger is kept in, every user shares it
+	Currency string
+
+	// MaxBatchSize is how many transactions RecordTransactionsBatch takes at once, 100 when zero
+	MaxBatchSize int
+}
+
+func DefaultConfig() Config {
+	return Config{
+		MaxDepositAmount:       maxTransactionAmount,
+		MaxWithdrawalAmount:    maxTransactionAmount,
+		ReconcileDateTolerance: 24 * time.Hour,
+		IdempotencyTTL:         24 * time.Hour,
+		IdempotencyCacheSize:   10000,
+		EventBufferSize:        1024,
+		RoundingPolicy:         RoundHalfUp,
+		Currency:               "USD",
+		MaxBatchSize:           DefaultMaxBatchSize,
+	}
+}
+
+type Option func(*ledgerService)
+
+func WithConfig(config Config) Option {
+	return func(s *ledgerService) {
+		s.config.Store(&config)
+	}
+}
+
+// WithClock sets the clock of the timestamps, the idempotency TTL and the audit log, the store's clock when not set
+func WithClock(c clock.Clock) Option {
+	return func(s *ledgerService) {
+		s.clock = c
+	}
 }
 
 type ledgerService struct {
-	store *store.LedgerStore
+	store       *store.LedgerStore
+	config      *atomic.Pointer[Config] // swapped by SetConfig, shared with the copies of WithContext
+	clock       clock.Clock
+	idempotency *idempotencyCache
+	validators  []Validator
+	events      *eventBus
+	fees        FeeSchedule
+	metrics     *metrics.Metrics
+	reporter    errreport.ErrorReporter
+	auditLog    *audit.Log
+	tracer      trace.Tracer
+	ctx         context.Context // parent of the spans, see WithContext
 }
 
-func NewLedgerService(store *store.LedgerStore) LedgerService {
-	return &ledgerService{
-		store: store,
+func NewLedgerService(store *store.LedgerStore, opts ...Option) LedgerService {
+	s := &ledgerService{
+		store:    store,
+		config:   new(atomic.Pointer[Config]),
+		reporter: errreport.Noop,
+		tracer:   noop.NewTracerProvider().Tracer(tracerName),
+	}
+	defaults := DefaultConfig()
+	s.config.Store(&defaults)
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.clock == nil {
+		s.clock = store.Clock()
+	}
+	config := s.config.Load()
+	s.idempotency = newIdempotencyCache(config.IdempotencyTTL, config.IdempotencyCacheSize)
+	s.idempotency.now = s.clock.Now
+	s.events = newEventBus(config.EventBufferSize)
+	if s.auditLog == nil {
+		s.auditLog = audit.NewLog(audit.WithClock(s.clock.Now))
 	}
+	return s
+}
+
+// Config is the config in effect
+func (s *ledgerService) Config() Config {
+	return *s.config.Load()
+}
+
+// SetConfig swaps the config, the operations that start after it see the new one. IdempotencyTTL,
+// IdempotencyCacheSize and EventBufferSize size what NewLedgerService built and keep their first value
+func (s *ledgerService) SetConfig(config Config) {
+	s.config.Store(&config)
 }
 
 var userIdRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,50}$`)
 
+const (
+	maxTransactionAmount = 1000000.0
+	maxDescriptionLength = 500
+	maxReferenceLength   = 64
+)
+
 func (s *ledgerService) RecordTransaction(userId string, txType models.TransactionType, amount float64, description string) (models.TransactionRecord, error) {
-	if userId == "" {
-		return models.TransactionRecord{}, errors.New("user ID is required")
-	}
+	return s.RecordTransactionInput(userId, TransactionInput{
+		Type:        txType,
+		Amount:      amount,
+		Description: description,
+	})
+}
 
-	if !userIdRegex.MatchString(userId) {
-		return models.TransactionRecord{}, errors.New("invalid user ID format: must be 3-50 alphanumeric characters, underscores, dots, or hyphens")
+func (s *ledgerService) RecordTransactionInput(userId string, input TransactionInput) (models.TransactionRecord, error) {
+	ctx, span := s.startSpan("RecordTransaction", userId, input.Type)
+	tx, err := s.recordTransaction(ctx, userId, input)
+	s.metrics.ObserveTransaction(string(input.Type), transactionOutcome(err))
+	s.recordAudit(operationRecordTransaction, userId, err)
+	endSpan(span, transactionOutcome(err), err)
+	return tx, err
+}
+
+func (s *ledgerService) recordTransaction(ctx context.Context, userId string, input TransactionInput) (models.TransactionRecord, error) {
+	if err := s.validateTransactionInput(userId, &input); err != nil {
+		return models.TransactionRecord{}, err
 	}
 
-	if amount <= 0 {
-		return models.TransactionRecord{}, errors.New("amount must be positive")
+	if err := s.requireAccount(userId); err != nil {
+		return models.TransactionRecord{}, err
 	}
 
-	const maxAmount = 1000000.0
-	if amount > maxAmount {
-		return models.TransactionRecord{}, errors.New("amount exceeds maximum allowed")
+	if err := s.runValidators(ctx, userId, input); err != nil {
+		return models.TransactionRecord{}, err
 	}
 
-	if txType != models.Deposit && txType != models.Withdrawal {
-		return models.TransactionRecord{}, errors.New("invalid transaction type")
+	// a caller that gave up (the request timed out) can't be told about the record, so don't write it
+	if err := ctx.Err(); err != nil {
+		return models.TransactionRecord{}, err
 	}
 
-	if len(description) > 500 {
-		return models.TransactionRecord{}, errors.New("description exceeds maximum length of 500 characters")
+	if window := s.config.Load().DuplicateWindow; window > 0 && !input.AllowDuplicate {
+		end := s.storeSpan(ctx, "InsertTransactionUnlessDuplicate")
+		tx, err := s.store.InsertTransactionUnlessDuplicate(userId, s.newTransactionRecord(input), window)
+		end(err)
+		return tx, err
 	}
 
-	tx, err := s.store.AddTransaction(userId, txType, amount, description)
+	end := s.storeSpan(ctx, "InsertTransaction")
+	tx, err := s.store.InsertTransaction(userId, s.newTransactionRecord(input))
+	end(err)
 	if err != nil {
 		return models.TransactionRecord{}, err
 	}
 	return tx, nil
 }
 
-func (s *ledgerService) GetPaginatedTransactionHistory(userId string, startTime, endTime *time.Time, page, pageSize int) (PaginatedTransactions, error) {
+// GetTransaction returns a single transaction of the user, store.ErrTransactionNotFound when the id belongs to
+// someone else so ids can't be probed across users
+func (s *ledgerService) GetTransaction(userId string, txID uuid.UUID) (models.TransactionRecord, error) {
+	if err := validateUserId(userId); err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	return s.store.GetTransaction(userId, txID)
+}
+
+// UpdateTransactionDescription fixes the description of a transaction, the previous value is kept in the edit history
+func (s *ledgerService) UpdateTransactionDescription(userId string, txID uuid.UUID, newDescription string) (_ models.TransactionRecord, err error) {
+	defer func() { s.recordAudit(operationDescribe, userId, err) }()
+
+	if err := validateUserId(userId); err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	newDescription, err = s.normalizeDescription(newDescription)
+	if err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	return s.store.UpdateDescription(userId, txID, newDescription)
+}
+
+// VoidTransaction voids an erroneous record: it stays in the history for audit but no longer affects the balance
+// or the aggregates. voiding twice returns store.ErrAlreadyVoided, a reversed transaction store.ErrAlreadyReversed
+// and a reversal store.ErrReversalOfReversal
+func (s *ledgerService) VoidTransaction(userId string, txID uuid.UUID, reason string) (_ models.TransactionRecord, err error) {
+	defer func() { s.recordAudit(operationVoid, userId, err) }()
+
+	if err := validateUserId(userId); err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	if len(reason) > maxDescriptionLength {
+		return models.TransactionRecord{}, &ValidationError{Field: "reason", Code: "max_length", Message: "void reason exceeds maximum length of 500 characters"}
+	}
+
+	return s.store.VoidTransaction(userId, txID, reason)
+}
+
+// ReverseTransaction posts the opposite of the transaction, linked both ways through ReversalOf and ReversedBy.
+// a transaction is reversed at most once (store.ErrAlreadyReversed) and journal legs are reversed with their journal
+func (s *ledgerService) ReverseTransaction(userId string, txID uuid.UUID, reason string) (_ models.TransactionRecord, err error) {
+	defer func() { s.recordAudit(operationReverse, userId, err) }()
+
+	if err := s.validateReversal(userId, reason); err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	return s.store.ReverseTransaction(userId, txID, reason)
+}
+
+func (s *ledgerService) validateReversal(userId, reason string) error {
+	if err := validateUserId(userId); err != nil {
+		return err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return err
+	}
+
+	if len(reason) > maxDescriptionLength {
+		return &ValidationError{Field: "reason", Code: "max_length", Message: "reversal reason exceeds maximum length of 500 characters"}
+	}
+	return nil
+}
+
+// validateTransactionInput checks the input and normalizes its description in place
+func (s *ledgerService) validateTransactionInput(userId string, input *TransactionInput) error {
 	if userId == "" {
-		return PaginatedTransactions{}, errors.New("user ID is required")
+		return &ValidationError{Field: "userId", Code: "invalid_user_id", Message: "user ID is required"}
 	}
 
 	if !userIdRegex.MatchString(userId) {
-		return PaginatedTransactions{}, errors.New("invalid user ID format")
+		return &ValidationError{Field: "userId", Code: "invalid_user_id", Message: "invalid user ID format: must be 3-50 alphanumeric characters, underscores, dots, or hyphens"}
+	}
+
+	// the body is checked as a whole, a client gets every rejected field at once
+	var errs ValidationErrors
+	if input.Amount <= 0 {
+		errs = append(errs, &ValidationError{Field: "amount", Code: "not_positive", Rule: RulePositive, Message: "amount must be positive"})
+	}
+
+	// the minimum is moot for an amount that isn't positive, an unknown type is reported either way
+	if err := s.checkAmountLimits(input.Type, input.Amount); err != nil && (input.Amount > 0 || err.Field == "type") {
+		errs = append(errs, err)
+	}
+
+	description, err := s.normalizeDescription(input.Description)
+	var descriptionErr *ValidationError
+	if errors.As(err, &descriptionErr) {
+		errs = append(errs, descriptionErr)
+	}
+	input.Description = description
+
+	if len(input.ReferenceID) > maxReferenceLength {
+		errs = append(errs, &ValidationError{
+			Field: "referenceId", Code: "max_length", Rule: RuleMaxLength, Max: limit(maxReferenceLength),
+			Message: "reference ID exceeds maximum length of 64 characters",
+		})
+	}
+	return errs.err()
+}
+
+// checkAmountLimits enforces the configured minimum and maximum of the transaction type
+func (s *ledgerService) checkAmountLimits(txType models.TransactionType, amount float64) *ValidationError {
+	var minAmount, maxAmount float64
+	config := s.config.Load()
+	switch txType {
+	case models.Deposit:
+		minAmount, maxAmount = config.MinDepositAmount, config.MaxDepositAmount
+	case models.Withdrawal:
+		minAmount, maxAmount = config.MinWithdrawalAmount, config.MaxWithdrawalAmount
+	default:
+		return &ValidationError{
+			Field: "type", Code: "invalid_value", Rule: RuleEnum, Allowed: []string{string(models.Deposit), string(models.Withdrawal)},
+			Message: "invalid transaction type",
+		}
+	}
+
+	if amount > maxAmount {
+		return &ValidationError{
+			Field: "amount", Code: "max_amount", Rule: RuleMax, Max: limit(maxAmount),
+			Message: fmt.Sprintf("%s amount exceeds maximum allowed of %.2f", txType, maxAmount),
+		}
+	}
+
+	if amount < minAmount {
+		return &ValidationError{
+			Field: "amount", Code: "min_amount", Rule: RuleMin, Min: limit(minAmount),
+			Message: fmt.Sprintf("%s amount is below minimum allowed of %.2f", txType, minAmount),
+		}
+	}
+	return nil
+}
+
+func (s *ledgerService) newTransactionRecord(input TransactionInput) models.TransactionRecord {
+	tx := models.NewTransactionRecord(input.Type, input.Amount, input.Description, s.clock.Now())
+	tx.ReferenceID = input.ReferenceID
+	tx.Fee = s.fee(input.Type, input.Amount)
+	return tx
+}
+
+func (s *ledgerService) GetPaginatedTransactionHistory(userId string, startTime, endTime *time.Time, page, pageSize int) (PaginatedTransactions, error) {
+	return s.GetTransactionHistory(userId, HistoryFilter{StartTime: startTime, EndTime: endTime}, page, pageSize)
+}
+
+// CountTransactions is the number of transactions GetTransactionHistory would page through with the same filter
+func (s *ledgerService) CountTransactions(userId string, filter HistoryFilter) (int, error) {
+	if err := validateUserId(userId); err != nil {
+		return 0, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return 0, err
+	}
+
+	storeFilter, err := filter.validate()
+	if err != nil {
+		return 0, err
+	}
+	return s.store.CountTransactions(userId, storeFilter), nil
+}
+
+func (s *ledgerService) GetTransactionHistory(userId string, filter HistoryFilter, page, pageSize int) (_ PaginatedTransactions, err error) {
+	ctx, span := s.startSpan("GetTransactionHistory", userId, "")
+	defer func() { endSpan(span, readOutcome(err), err) }()
+
+	if err := validateUserId(userId); err != nil {
+		return PaginatedTransactions{}, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return PaginatedTransactions{}, err
 	}
 
 	if page < 1 {
@@ -90,11 +519,14 @@ func (s *ledgerService) GetPaginatedTransactionHistory(userId string, startTime,
 		pageSize = maxPageSize
 	}
 
-	if startTime != nil && endTime != nil && startTime.After(*endTime) {
-		return PaginatedTransactions{}, errors.New("start time cannot be after end time")
+	storeFilter, err := filter.validate()
+	if err != nil {
+		return PaginatedTransactions{}, err
 	}
 
-	result := s.store.GetPaginatedTransactions(userId, startTime, endTime, page, pageSize)
+	end := s.storeSpan(ctx, "GetFilteredTransactions")
+	result := s.store.GetFilteredTransactions(userId, storeFilter, page, pageSize)
+	end(nil)
 
 	totalPages := (result.TotalCount + pageSize - 1) / pageSize
 	if totalPages < 1 {
@@ -102,26 +534,39 @@ func (s *ledgerService) GetPaginatedTransactionHistory(userId string, startTime,
 	}
 
 	return PaginatedTransactions{
-		Transactions: result.Transactions,
-		TotalCount:   result.TotalCount,
-		Page:         page,
-		PageSize:     pageSize,
-		TotalPages:   totalPages,
+		Transactions:  result.Transactions,
+		TotalCount:    result.TotalCount,
+		Page:          page,
+		PageSize:      pageSize,
+		TotalPages:    totalPages,
+		AccountExists: s.store.UserExists(userId),
 	}, nil
 }
 
 func (s *ledgerService) GetCurrentBalance(userId string) (float64, error) {
-	if userId == "" {
-		return 0, errors.New("user ID is required")
+	if err := validateUserId(userId); err != nil {
+		return 0, err
 	}
 
-	if !userIdRegex.MatchString(userId) {
-		return 0, errors.New("invalid user ID format")
+	if err := s.requireAccount(userId); err != nil {
+		return 0, err
 	}
 
 	balance, err := s.store.GetBalance(userId)
 	if err != nil {
 		return 0, err
 	}
-	return balance, nil
+	// the store keeps sub-cent amounts, the balance is shown in cents
+	return s.round(balance), nil
+}
+
+func validateUserId(userId string) error {
+	if userId == "" {
+		return &ValidationError{Field: "userId", Code: "invalid_user_id", Message: "user ID is required"}
+	}
+
+	if !userIdRegex.MatchString(userId) {
+		return &ValidationError{Field: "userId", Code: "invalid_user_id", Message: "invalid user ID format"}
+	}
+	return nil
 }
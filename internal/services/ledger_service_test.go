@@ -1,10 +1,16 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/clock/clocktest"
 	"tiny-ledger/internal/models"
 	"tiny-ledger/internal/store"
 )
@@ -71,35 +77,28 @@ func TestInputValidation(t *testing.T) {
 	svc := NewLedgerService(s)
 
 	tests := []struct {
-		name        string
-		userId      string
-		txType      models.TransactionType
-		amount      float64
-		description string
-		expectError bool
+		name         string
+		userId       string
+		txType       models.TransactionType
+		amount       float64
+		description  string
+		expectedCode string
 	}{
-		{"Valid deposit", "validUser123", models.Deposit, 100.0, "Valid deposit", false},
-		{"Valid withdrawal", "validUser123", models.Withdrawal, 50.0, "Valid withdrawal", false},
-		{"Empty user ID", "", models.Deposit, 100.0, "Valid deposit", true},
-		{"Invalid user ID", "user@invalid", models.Deposit, 100.0, "Valid deposit", true},
-		{"Zero amount", "validUser123", models.Deposit, 0.0, "Zero amount", true},
-		{"Negative amount", "validUser123", models.Deposit, -50.0, "Negative amount", true},
-		{"Excessive amount", "validUser123", models.Deposit, 2000000.0, "Too much money", true},
-		{"Invalid transaction type", "validUser123", "invalid_type", 100.0, "Invalid type", true},
-		{"Very long description", "validUser123", models.Deposit, 100.0, string(make([]byte, 1000)), true},
+		{"Valid deposit", "validUser123", models.Deposit, 100.0, "Valid deposit", ""},
+		{"Valid withdrawal", "validUser123", models.Withdrawal, 50.0, "Valid withdrawal", ""},
+		{"Empty user ID", "", models.Deposit, 100.0, "Valid deposit", "invalid_user_id"},
+		{"Invalid user ID", "user@invalid", models.Deposit, 100.0, "Valid deposit", "invalid_user_id"},
+		{"Zero amount", "validUser123", models.Deposit, 0.0, "Zero amount", "not_positive"},
+		{"Negative amount", "validUser123", models.Deposit, -50.0, "Negative amount", "not_positive"},
+		{"Excessive amount", "validUser123", models.Deposit, 2000000.0, "Too much money", "max_amount"},
+		{"Invalid transaction type", "validUser123", "invalid_type", 100.0, "Invalid type", "invalid_value"},
+		{"Very long description", "validUser123", models.Deposit, 100.0, strings.Repeat("a", 1000), "max_length"},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			_, err := svc.RecordTransaction(test.userId, test.txType, test.amount, test.description)
-
-			if test.expectError && err == nil {
-				t.Errorf("expected error but got none")
-			}
-
-			if !test.expectError && err != nil {
-				t.Errorf("expected no error but got: %v", err)
-			}
+			assertValidationCode(t, err, test.expectedCode)
 		})
 	}
 }
@@ -130,6 +129,40 @@ func TestInsufficientFunds(t *testing.T) {
 	}
 }
 
+func TestNoFloatDrift(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	userId := "test_user"
+
+	// 0.1 is no exact float, three hundred of them summed are 29.999999999999996
+	for range 300 {
+		if _, err := svc.RecordTransaction(userId, models.Deposit, 0.1, "Dime"); err != nil {
+			t.Fatalf("failed to add deposit: %v", err)
+		}
+	}
+	if balance, _ := svc.GetCurrentBalance(userId); balance != 30 {
+		t.Errorf("expected balance 30, got %v", balance)
+	}
+	now := time.Now()
+	history, err := svc.GetBalanceHistory(userId, now, now)
+	if err != nil {
+		t.Fatalf("failed to get the balance history: %v", err)
+	}
+	if len(history) != 1 || history[0].Balance != 30 {
+		t.Errorf("expected a day ending at 30, got %+v", history)
+	}
+
+	if _, err := svc.RecordTransaction(userId, models.Withdrawal, 30, "Everything"); err != nil {
+		t.Fatalf("expected the withdrawal of the whole balance to go through, got %v", err)
+	}
+	details, err := svc.GetBalanceDetails(userId)
+	if err != nil {
+		t.Fatalf("failed to get balance: %v", err)
+	}
+	if details.Balance != 0 || details.AvailableBalance != 0 {
+		t.Errorf("expected nothing left, got %+v", details)
+	}
+}
+
 func TestTimeRangeFiltering(t *testing.T) {
 	s := store.NewLedgerStore()
 	svc := NewLedgerService(s)
@@ -333,6 +366,127 @@ func TestPagination(t *testing.T) {
 	}
 }
 
+func TestHistoryOrderAndType(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "ordered_user"
+	for _, tx := range []struct {
+		txType models.TransactionType
+		amount float64
+	}{
+		{models.Deposit, 10.0}, {models.Withdrawal, 3.0}, {models.Deposit, 20.0}, {models.Withdrawal, 5.0}, {models.Deposit, 30.0},
+	} {
+		if _, err := svc.RecordTransaction(userId, tx.txType, tx.amount, "ordered"); err != nil {
+			t.Fatalf("failed to create test transaction: %v", err)
+		}
+	}
+
+	deposit, withdrawal := models.Deposit, models.Withdrawal
+	invalidType := models.TransactionType("refund")
+
+	testCases := []struct {
+		name          string
+		filter        HistoryFilter
+		page          int
+		pageSize      int
+		expected      []float64
+		expectedTotal int
+		expectErr     bool
+	}{
+		{name: "Newest first", filter: HistoryFilter{Descending: true}, page: 1, pageSize: 2, expected: []float64{30, 5}, expectedTotal: 5},
+		{name: "Newest first last page", filter: HistoryFilter{Descending: true}, page: 3, pageSize: 2, expected: []float64{10}, expectedTotal: 5},
+		{name: "Deposits only", filter: HistoryFilter{Type: &deposit}, page: 1, pageSize: 10, expected: []float64{10, 20, 30}, expectedTotal: 3},
+		{name: "Withdrawals newest first", filter: HistoryFilter{Type: &withdrawal, Descending: true}, page: 1, pageSize: 1, expected: []float64{5}, expectedTotal: 2},
+		{name: "Invalid type", filter: HistoryFilter{Type: &invalidType}, page: 1, pageSize: 10, expectErr: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := svc.GetTransactionHistory(userId, tc.filter, tc.page, tc.pageSize)
+			if tc.expectErr {
+				if err == nil {
+					t.Errorf("expected an error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to get transactions: %v", err)
+			}
+
+			if result.TotalCount != tc.expectedTotal {
+				t.Errorf("expected total count %d, got %d", tc.expectedTotal, result.TotalCount)
+			}
+			if len(result.Transactions) != len(tc.expected) {
+				t.Fatalf("expected %d transactions, got %d", len(tc.expected), len(result.Transactions))
+			}
+			for i, amount := range tc.expected {
+				if result.Transactions[i].Amount != amount {
+					t.Errorf("expected amount %.2f at %d, got %.2f", amount, i, result.Transactions[i].Amount)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryAmountAndTextFilters(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "filtered_user"
+	for _, tx := range []struct {
+		amount      float64
+		description string
+	}{
+		{5.0, "coffee"}, {10.0, "Rent share"}, {50.0, "rent"}, {100.0, "Café crème"}, {500.0, "salary"},
+	} {
+		if _, err := svc.RecordTransaction(userId, models.Deposit, tx.amount, tx.description); err != nil {
+			t.Fatalf("failed to create test transaction: %v", err)
+		}
+	}
+
+	amount := func(v float64) *float64 { return &v }
+
+	testCases := []struct {
+		name         string
+		filter       HistoryFilter
+		expected     []float64
+		expectedCode string
+	}{
+		{name: "Amount range", filter: HistoryFilter{MinAmount: amount(10), MaxAmount: amount(100)}, expected: []float64{10, 50, 100}},
+		{name: "Minimum only", filter: HistoryFilter{MinAmount: amount(100)}, expected: []float64{100, 500}},
+		{name: "Text is case-insensitive", filter: HistoryFilter{Query: "RENT"}, expected: []float64{10, 50}},
+		{name: "Unicode text", filter: HistoryFilter{Query: "CAFÉ"}, expected: []float64{100}},
+		{name: "Text and amount", filter: HistoryFilter{Query: "rent", MaxAmount: amount(20)}, expected: []float64{10}},
+		{name: "Min above max", filter: HistoryFilter{MinAmount: amount(50), MaxAmount: amount(10)}, expectedCode: "invalid_range"},
+		{name: "Negative amount", filter: HistoryFilter{MaxAmount: amount(-1)}, expectedCode: "out_of_range"},
+		{name: "Text too long", filter: HistoryFilter{Query: strings.Repeat("a", 101)}, expectedCode: "max_length"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := svc.GetTransactionHistory(userId, tc.filter, 1, 10)
+			if tc.expectedCode != "" {
+				assertValidationCode(t, err, tc.expectedCode)
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to get transactions: %v", err)
+			}
+
+			if result.TotalCount != len(tc.expected) {
+				t.Errorf("expected total count %d, got %d", len(tc.expected), result.TotalCount)
+			}
+			for i, amount := range tc.expected {
+				if i >= len(result.Transactions) || result.Transactions[i].Amount != amount {
+					t.Errorf("expected amount %.2f at %d, got %+v", amount, i, result.Transactions)
+					return
+				}
+			}
+		})
+	}
+}
+
 func TestMultiUserIsolation(t *testing.T) {
 	s := store.NewLedgerStore()
 	svc := NewLedgerService(s)
@@ -400,3 +554,252 @@ func TestMultiUserIsolation(t *testing.T) {
 func timePtr(t time.Time) *time.Time {
 	return &t
 }
+
+func TestUpdateTransactionDescription(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "edit_user"
+	original, err := svc.RecordTransaction(userId, models.Deposit, 100.0, "Salray")
+	if err != nil {
+		t.Fatalf("failed to record transaction: %v", err)
+	}
+
+	updated, err := svc.UpdateTransactionDescription(userId, original.ID, "Salary")
+	if err != nil {
+		t.Fatalf("failed to update description: %v", err)
+	}
+
+	if updated.Description != "Salary" {
+		t.Errorf("expected description Salary, got %q", updated.Description)
+	}
+	if updated.Amount != original.Amount || updated.Type != original.Type || !updated.Timestamp.Equal(original.Timestamp) {
+		t.Errorf("edit must not change amount, type or timestamp: %+v", updated)
+	}
+	if len(updated.Edits) != 1 || updated.Edits[0].PreviousDescription != "Salray" {
+		t.Errorf("expected the previous description in the edit history, got %+v", updated.Edits)
+	}
+
+	updated, err = svc.UpdateTransactionDescription(userId, original.ID, "Monthly salary")
+	if err != nil {
+		t.Fatalf("failed to update description: %v", err)
+	}
+	if len(updated.Edits) != 2 || updated.Edits[1].PreviousDescription != "Salary" {
+		t.Errorf("expected two edits, got %+v", updated.Edits)
+	}
+
+	// the record is still reachable by id and through the history
+	history, _ := svc.GetPaginatedTransactionHistory(userId, nil, nil, 1, 10)
+	if len(history.Transactions) != 1 || history.Transactions[0].Description != "Monthly salary" {
+		t.Errorf("history doesn't reflect the edit: %+v", history.Transactions)
+	}
+	assertBalance(t, svc, userId, 100.0)
+
+	if _, err := svc.UpdateTransactionDescription(userId, original.ID, strings.Repeat("a", 501)); err == nil {
+		t.Errorf("expected error for a too long description")
+	}
+
+	if _, err := svc.UpdateTransactionDescription(userId, uuid.New(), "nothing"); !errors.Is(err, store.ErrTransactionNotFound) {
+		t.Errorf("expected transaction not found, got %v", err)
+	}
+
+	if _, err := svc.UpdateTransactionDescription("another_user", original.ID, "not mine"); !errors.Is(err, store.ErrTransactionNotFound) {
+		t.Errorf("expected transaction not found for another user, got %v", err)
+	}
+}
+
+func TestClock(t *testing.T) {
+	clock := clocktest.NewFake(clocktest.Start)
+	svc := NewLedgerService(store.NewLedgerStore(store.WithClock(clock)))
+
+	deposit, err := svc.RecordTransaction("clock_user", models.Deposit, 100.0, "salary")
+	if err != nil || !deposit.Timestamp.Equal(clocktest.Start) {
+		t.Fatalf("expected the deposit at %v, got %+v (err: %v)", clocktest.Start, deposit, err)
+	}
+
+	edit := clock.Advance(time.Hour)
+	updated, err := svc.UpdateTransactionDescription("clock_user", deposit.ID, "monthly salary")
+	if err != nil || len(updated.Edits) != 1 || !updated.Edits[0].EditedAt.Equal(edit) {
+		t.Errorf("expected the edit at %v, got %+v (err: %v)", edit, updated.Edits, err)
+	}
+
+	asOf := clock.Advance(time.Hour)
+	if details, err := svc.GetBalanceDetails("clock_user"); err != nil || !details.AsOf.Equal(asOf) {
+		t.Errorf("expected the balance as of %v, got %+v (err: %v)", asOf, details, err)
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	bound := svc.WithContext(context.Background()) // the copies share the config
+
+	if _, err := bound.RecordTransaction("config_user", models.Deposit, 500.0, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	config := svc.Config()
+	config.MaxDepositAmount = 100
+	svc.SetConfig(config)
+
+	var validation *ValidationError
+	if _, err := bound.RecordTransaction("config_user", models.Deposit, 500.0, ""); !errors.As(err, &validation) || validation.Code != "max_amount" {
+		t.Errorf("expected the new max amount to apply, got %v", err)
+	}
+	if svc.Config().MaxWithdrawalAmount != DefaultConfig().MaxWithdrawalAmount {
+		t.Errorf("expected the other settings to stay, got %+v", svc.Config())
+	}
+}
+
+func TestUpdateTransactionDescription_ReversedTransaction(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	if _, err := svc.RecordTransaction("sender", models.Deposit, 50.0, "Initial deposit"); err != nil {
+		t.Fatalf("failed to record transaction: %v", err)
+	}
+
+	journal, err := svc.Transfer("sender", "receiver", 20.0, "lunch")
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if _, err := svc.ReverseJournal(journal.ID); err != nil {
+		t.Fatalf("failed to reverse transfer: %v", err)
+	}
+
+	leg := journal.Entries[0].Transaction
+	updated, err := svc.UpdateTransactionDescription("sender", leg.ID, "lunch with team")
+	if err != nil {
+		t.Fatalf("failed to update reversed transaction: %v", err)
+	}
+
+	if updated.ReversedBy == nil || updated.JournalID == nil || *updated.JournalID != journal.ID {
+		t.Errorf("edit must keep the reversal and journal links: %+v", updated)
+	}
+	assertBalance(t, svc, "sender", 50.0)
+}
+
+func TestVoidTransaction(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "void_user"
+	day := func(d int) time.Time {
+		return time.Date(2024, time.June, d, 12, 0, 0, 0, time.UTC)
+	}
+	deposit := models.TransactionRecord{ID: uuid.New(), Amount: 100.0, Type: models.Deposit, Timestamp: day(1)}
+	duplicate := models.TransactionRecord{ID: uuid.New(), Amount: 100.0, Type: models.Deposit, Timestamp: day(2)}
+	withdrawal := models.TransactionRecord{ID: uuid.New(), Amount: 30.0, Type: models.Withdrawal, Timestamp: day(3)}
+	for _, tx := range []models.TransactionRecord{deposit, duplicate, withdrawal} {
+		s.AddTransactionWithTime(userId, tx)
+	}
+
+	voided, err := svc.VoidTransaction(userId, duplicate.ID, "entered twice")
+	if err != nil {
+		t.Fatalf("failed to void transaction: %v", err)
+	}
+	if !voided.Voided || voided.VoidedAt == nil || voided.VoidReason != "entered twice" {
+		t.Errorf("unexpected voided record: %+v", voided)
+	}
+
+	assertBalance(t, svc, userId, 70.0)
+
+	if _, err := svc.VoidTransaction(userId, duplicate.ID, "again"); !errors.Is(err, store.ErrAlreadyVoided) {
+		t.Errorf("expected already voided error, got %v", err)
+	}
+
+	// voided records stay in the history unless excluded
+	all, _ := svc.GetTransactionHistory(userId, HistoryFilter{}, 1, 10)
+	if all.TotalCount != 3 {
+		t.Errorf("expected 3 transactions including voided, got %d", all.TotalCount)
+	}
+	active, _ := svc.GetTransactionHistory(userId, HistoryFilter{ExcludeVoided: true}, 1, 10)
+	if active.TotalCount != 2 || len(active.Transactions) != 2 {
+		t.Errorf("expected 2 transactions excluding voided, got %d", active.TotalCount)
+	}
+
+	// and are excluded from the aggregates
+	totals, _ := svc.GetSystemTotals()
+	if totals.TotalDeposits != 100.0 || totals.TransactionCount != 2 || !totals.Consistent {
+		t.Errorf("voided record must not count in the totals: %+v", totals)
+	}
+
+	points, _ := svc.GetBalanceHistory(userId, day(1), day(3))
+	if len(points) != 3 || points[1].Balance != 100.0 || points[2].Balance != 70.0 {
+		t.Errorf("voided record must not count in the balance history: %+v", points)
+	}
+}
+
+func TestVoidTransaction_Rejected(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	deposit, _ := svc.RecordTransaction("spender", models.Deposit, 50.0, "deposit")
+	if _, err := svc.RecordTransaction("spender", models.Withdrawal, 40.0, "spent"); err != nil {
+		t.Fatalf("failed to withdraw: %v", err)
+	}
+
+	// voiding the deposit would overdraw the account
+	if _, err := svc.VoidTransaction("spender", deposit.ID, "mistake"); !errors.Is(err, store.ErrInsufficientFunds) {
+		t.Errorf("expected insufficient funds error, got %v", err)
+	}
+	assertBalance(t, svc, "spender", 10.0)
+
+	journal, err := svc.Transfer("spender", "friend", 5.0, "coffee")
+	if err != nil {
+		t.Fatalf("failed to transfer: %v", err)
+	}
+	if _, err := svc.VoidTransaction("spender", journal.Entries[0].Transaction.ID, "mistake"); !errors.Is(err, store.ErrVoidJournalLeg) {
+		t.Errorf("expected journal leg error, got %v", err)
+	}
+
+	if _, err := svc.VoidTransaction("spender", uuid.New(), "missing"); !errors.Is(err, store.ErrTransactionNotFound) {
+		t.Errorf("expected transaction not found, got %v", err)
+	}
+}
+
+func TestPerTypeAmountLimits(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxDepositAmount = 10000.0
+	config.MaxWithdrawalAmount = 2500.0
+	config.MinDepositAmount = 1.0
+	config.MinWithdrawalAmount = 5.0
+
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s, WithConfig(config))
+
+	userId := "limits_user"
+	if _, err := svc.RecordTransaction(userId, models.Deposit, 10000.0, "funding"); err != nil {
+		t.Fatalf("failed to fund the account: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		txType        models.TransactionType
+		amount        float64
+		expectedError string
+	}{
+		{"Deposit below maximum", models.Deposit, 9999.99, ""},
+		{"Deposit at maximum", models.Deposit, 10000.0, ""},
+		{"Deposit above maximum", models.Deposit, 10000.01, "deposit amount exceeds maximum allowed of 10000.00"},
+		{"Deposit at minimum", models.Deposit, 1.0, ""},
+		{"Deposit below minimum", models.Deposit, 0.99, "deposit amount is below minimum allowed of 1.00"},
+		{"Withdrawal below maximum", models.Withdrawal, 2499.99, ""},
+		{"Withdrawal at maximum", models.Withdrawal, 2500.0, ""},
+		{"Withdrawal above maximum", models.Withdrawal, 2500.01, "withdrawal amount exceeds maximum allowed of 2500.00"},
+		{"Withdrawal at minimum", models.Withdrawal, 5.0, ""},
+		{"Withdrawal below minimum", models.Withdrawal, 4.99, "withdrawal amount is below minimum allowed of 5.00"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := svc.RecordTransaction(userId, test.txType, test.amount, test.name)
+
+			if test.expectedError == "" && err != nil {
+				t.Errorf("expected no error but got: %v", err)
+			}
+
+			if test.expectedError != "" && (err == nil || err.Error() != test.expectedError) {
+				t.Errorf("expected error %q, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
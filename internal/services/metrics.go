@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"tiny-ledger/internal/metrics"
+	"tiny-ledger/internal/store"
+)
+
+// WithMetrics records the outcome of every transaction request
+func WithMetrics(m *metrics.Metrics) Option {
+	return func(s *ledgerService) {
+		s.metrics = m
+	}
+}
+
+// transactionOutcome classifies the result of a transaction request, errors that aren't business rules of the
+// store are input validation failures
+func transactionOutcome(err error) string {
+	switch {
+	case err == nil:
+		return metrics.OutcomeCreated
+	case errors.Is(err, store.ErrInsufficientFunds), errors.Is(err, store.ErrMinimumBalance):
+		return metrics.OutcomeInsufficientFunds
+	case errors.Is(err, store.ErrPossibleDuplicate), errors.Is(err, store.ErrDuplicateReference),
+		errors.Is(err, store.ErrUserNotFound), errors.Is(err, ErrIdempotencyKeyReused),
+		errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return metrics.OutcomeRejected
+	default:
+		return metrics.OutcomeInvalid
+	}
+}
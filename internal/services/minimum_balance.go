@@ -0,0 +1,104 @@
+package services
+
+import (
+	"math"
+	"time"
+)
+
+// BalanceDetails is the balance with the floor applied, AvailableBalance is what can be withdrawn right now
+type BalanceDetails struct {
+	Balance          float64   `json:"balance"`
+	MinimumBalance   float64   `json:"minimumBalance"`
+	AvailableBalance float64   `json:"availableBalance"`
+	Currency         string    `json:"currency"`
+	AsOf             time.Time `json:"asOf"`         // when the balance was read, or the requested point in time
+	PendingCount     int       `json:"pendingCount"` // transactions not settled yet, nothing is held today so it's 0
+	Exists           bool      `json:"exists"`       // false for a user that never registered nor transacted
+}
+
+// SetMinimumBalance sets the floor withdrawals and transfers out can't cross (store.ErrMinimumBalance), reversals
+// debiting the user are held to it too. the floor can be set above the current balance, only deposits go through
+// until the balance is back above it.
+// precedence: a debit larger than the balance is always store.ErrInsufficientFunds, the floor is checked after it.
+// there is no account freeze or overdraft yet; a freeze should win over both, and an overdraft limit would be a
+// negative floor, which is why the floor can't be negative here
+func (s *ledgerService) SetMinimumBalance(userId string, amount float64) (err error) {
+	defer func() { s.recordAudit(operationMinimumBalance, userId, err) }()
+
+	if err := validateUserId(userId); err != nil {
+		return err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return err
+	}
+
+	if amount < 0 || math.IsNaN(amount) {
+		return &ValidationError{
+			Field: "minimum_balance", Code: "out_of_range", Rule: RuleMin, Min: limit(0),
+			Message: "minimum balance must be a non negative number",
+		}
+	}
+
+	if amount > maxTransactionAmount {
+		return &ValidationError{
+			Field: "minimum_balance", Code: "max_amount", Rule: RuleMax, Max: limit(maxTransactionAmount),
+			Message: "minimum balance exceeds maximum allowed",
+		}
+	}
+
+	s.store.SetMinimumBalance(userId, amount)
+	return nil
+}
+
+func (s *ledgerService) GetBalanceDetails(userId string) (_ BalanceDetails, err error) {
+	ctx, span := s.startSpan("GetBalance", userId, "")
+	defer func() { endSpan(span, readOutcome(err), err) }()
+
+	if err := validateUserId(userId); err != nil {
+		return BalanceDetails{}, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return BalanceDetails{}, err
+	}
+
+	asOf := s.clock.Now().UTC()
+	end := s.storeSpan(ctx, "GetAvailableBalance")
+	balance, minimum, available := s.store.GetAvailableBalance(userId)
+	end(nil)
+	return BalanceDetails{
+		Balance:          s.round(balance),
+		MinimumBalance:   minimum,
+		AvailableBalance: s.round(available),
+		Currency:         s.config.Load().Currency,
+		AsOf:             asOf,
+		Exists:           s.store.UserExists(userId),
+	}, nil
+}
+
+// GetBalanceAsOf is the balance considering only the transactions up to and including at, records voided since
+// then don't count. the floor is the current one, there is no history of it
+func (s *ledgerService) GetBalanceAsOf(userId string, at time.Time) (BalanceDetails, error) {
+	if err := validateUserId(userId); err != nil {
+		return BalanceDetails{}, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return BalanceDetails{}, err
+	}
+
+	balance, err := s.store.GetBalanceAt(userId, at)
+	if err != nil {
+		return BalanceDetails{}, err
+	}
+	_, minimum, _ := s.store.GetAvailableBalance(userId)
+	return BalanceDetails{
+		Balance:          s.round(balance),
+		MinimumBalance:   minimum,
+		AvailableBalance: s.round(max(balance-minimum, 0)),
+		Currency:         s.config.Load().Currency,
+		AsOf:             at,
+		Exists:           s.store.UserExists(userId),
+	}, nil
+}
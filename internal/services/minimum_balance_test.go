@@ -0,0 +1,178 @@
+package services
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestMinimumBalance_Withdrawals(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	userId := "floor_user"
+
+	svc.RecordTransaction(userId, models.Deposit, 100.0, "funding")
+	if err := svc.SetMinimumBalance(userId, 10.0); err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+
+	tests := []struct {
+		name            string
+		amount          float64
+		expectedError   error
+		expectedBalance float64
+	}{
+		{"Above the floor", 50.0, nil, 50.0},
+		{"One cent below the floor", 40.01, store.ErrMinimumBalance, 50.0},
+		{"Exactly at the floor", 40.0, nil, 10.0},
+		{"Anything at the floor", 0.01, store.ErrMinimumBalance, 10.0},
+		{"More than the balance", 20.0, store.ErrInsufficientFunds, 10.0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := svc.RecordTransaction(userId, models.Withdrawal, test.amount, test.name)
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("expected error %v, got %v", test.expectedError, err)
+			}
+			assertBalance(t, svc, userId, test.expectedBalance)
+		})
+	}
+}
+
+func TestMinimumBalance_AboveCurrentBalance(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	userId := "floor_user"
+
+	svc.RecordTransaction(userId, models.Deposit, 30.0, "funding")
+	if err := svc.SetMinimumBalance(userId, 50.0); err != nil {
+		t.Fatalf("expected the floor to be accepted above the balance, got %v", err)
+	}
+
+	details, _ := svc.GetBalanceDetails(userId)
+	if details.Balance != 30.0 || details.MinimumBalance != 50.0 || details.AvailableBalance != 0 {
+		t.Errorf("unexpected balance details: %+v", details)
+	}
+
+	if _, err := svc.RecordTransaction(userId, models.Withdrawal, 1.0, "blocked"); !errors.Is(err, store.ErrMinimumBalance) {
+		t.Errorf("expected ErrMinimumBalance, got %v", err)
+	}
+
+	if _, err := svc.RecordTransaction(userId, models.Deposit, 40.0, "top up"); err != nil {
+		t.Errorf("expected deposits to go through below the floor, got %v", err)
+	}
+
+	details, _ = svc.GetBalanceDetails(userId)
+	if details.AvailableBalance != 20.0 {
+		t.Errorf("expected available balance 20.00, got %.2f", details.AvailableBalance)
+	}
+
+	if _, err := svc.RecordTransaction(userId, models.Withdrawal, 20.0, "allowed again"); err != nil {
+		t.Errorf("expected the withdrawal down to the floor to succeed, got %v", err)
+	}
+}
+
+func TestMinimumBalance_Transfers(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	svc.RecordTransaction("alice", models.Deposit, 100.0, "funding")
+	svc.SetMinimumBalance("alice", 25.0)
+
+	if _, err := svc.Transfer("alice", "bob", 80.0, "rent"); !errors.Is(err, store.ErrMinimumBalance) {
+		t.Errorf("expected ErrMinimumBalance, got %v", err)
+	}
+	assertBalance(t, svc, "alice", 100.0)
+	assertBalance(t, svc, "bob", 0.0)
+
+	journal, err := svc.Transfer("alice", "bob", 75.0, "rent")
+	if err != nil {
+		t.Fatalf("expected the transfer down to the floor to succeed, got %v", err)
+	}
+
+	// the recipient's floor holds the reversal back
+	svc.SetMinimumBalance("bob", 1.0)
+	if _, err := svc.ReverseJournal(journal.ID); !errors.Is(err, store.ErrMinimumBalance) {
+		t.Errorf("expected ErrMinimumBalance for the reversal, got %v", err)
+	}
+}
+
+func TestSetMinimumBalance_Validation(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	tests := []struct {
+		name          string
+		userId        string
+		amount        float64
+		expectedField string // the field of the ValidationError, none when it goes through
+		expectedCode  string
+	}{
+		{"Zero floor", "user1", 0, "", ""},
+		{"Positive floor", "user1", 10.0, "", ""},
+		{"Negative floor", "user1", -5.0, "minimum_balance", "out_of_range"},
+		{"NaN floor", "user1", math.NaN(), "minimum_balance", "out_of_range"},
+		{"Floor over the maximum", "user1", 2000000.0, "minimum_balance", "max_amount"},
+		{"Invalid user", "x", 10.0, "userId", "invalid_user_id"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := svc.SetMinimumBalance(test.userId, test.amount)
+			if test.expectedField == "" {
+				if err != nil {
+					t.Errorf("expected no error but got: %v", err)
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || validationErr.Field != test.expectedField || validationErr.Code != test.expectedCode {
+				t.Errorf("expected %s on %s, got %v", test.expectedCode, test.expectedField, err)
+			}
+		})
+	}
+}
+
+func TestGetBalanceAsOf(t *testing.T) {
+	ledgerStore := store.NewLedgerStore()
+	svc := NewLedgerService(ledgerStore)
+	userId := "as_of_user"
+
+	day := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	ledgerStore.AddTransactionWithTime(userId, models.TransactionRecord{ID: uuid.New(), Amount: 100, Type: models.Deposit, Timestamp: day})
+	ledgerStore.AddTransactionWithTime(userId, models.TransactionRecord{ID: uuid.New(), Amount: 40, Type: models.Withdrawal, Timestamp: day.AddDate(0, 0, 1)})
+	svc.SetMinimumBalance(userId, 70.0)
+
+	tests := []struct {
+		name      string
+		at        time.Time
+		balance   float64
+		available float64
+	}{
+		{"Before the first transaction", day.Add(-time.Second), 0, 0},
+		{"After the deposit", day.Add(time.Hour), 100, 30},
+		{"Today", time.Now(), 60, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details, err := svc.GetBalanceAsOf(userId, tt.at)
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+			if details.Balance != tt.balance || details.AvailableBalance != tt.available {
+				t.Errorf("expected balance %.2f and available %.2f, got %+v", tt.balance, tt.available, details)
+			}
+			if !details.AsOf.Equal(tt.at) || details.Currency != "USD" {
+				t.Errorf("unexpected asOf or currency: %+v", details)
+			}
+		})
+	}
+
+	if _, err := svc.GetBalanceAsOf("x", day); err == nil {
+		t.Error("expected an error for an invalid user ID")
+	}
+}
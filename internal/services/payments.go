@@ -0,0 +1,47 @@
+package services
+
+import (
+	"errors"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+// ExternalPayment is a payment an upstream provider settled for a user, the ledger records it as a deposit
+type ExternalPayment struct {
+	ID          string  // of the provider, the referenceId of the deposit
+	UserID      string  // the user reference the provider was given
+	Amount      float64 // in the currency of the ledger
+	Description string
+}
+
+// RecordExternalPayment records the deposit of a payment once, a notification of the same payment again returns
+// the deposit of the first one with replayed set. the fee schedule doesn't apply, the provider took its own
+func (s *ledgerService) RecordExternalPayment(payment ExternalPayment) (tx models.TransactionRecord, replayed bool, err error) {
+	ctx, span := s.startSpan("RecordExternalPayment", payment.UserID, models.Deposit)
+	defer func() {
+		// a replay isn't an operation of its own
+		if !replayed {
+			s.recordAudit(operationExternalPayment, payment.UserID, err)
+		}
+		endSpan(span, transactionOutcome(err), err)
+	}()
+
+	if err := validateUserId(payment.UserID); err != nil {
+		return models.TransactionRecord{}, false, err
+	}
+	if payment.ID == "" {
+		return models.TransactionRecord{}, false, &ValidationError{Field: "id", Code: "required", Message: "payment ID is required"}
+	}
+	if err := s.requireAccount(payment.UserID); err != nil {
+		return models.TransactionRecord{}, false, err
+	}
+
+	input := TransactionInput{Type: models.Deposit, Amount: payment.Amount, Description: payment.Description, ReferenceID: payment.ID}
+	tx, err = s.importEntry(ctx, payment.UserID, s.clock.Now(), input)
+	if errors.Is(err, store.ErrDuplicateReference) {
+		return tx, true, nil
+	}
+	s.metrics.ObserveTransaction(string(models.Deposit), transactionOutcome(err))
+	return tx, false, err
+}
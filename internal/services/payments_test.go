@@ -0,0 +1,39 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestRecordExternalPayment(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	payment := ExternalPayment{ID: "pay_123", UserID: "alice", Amount: 12.5, Description: "Top-up"}
+
+	tx, replayed, err := svc.RecordExternalPayment(payment)
+	if err != nil || replayed {
+		t.Fatalf("expected the payment recorded, got %v, replayed %v", err, replayed)
+	}
+	if tx.Type != models.Deposit || tx.Amount != 12.5 || tx.ReferenceID != "pay_123" || tx.Fee != 0 {
+		t.Errorf("expected a deposit of 12.50 with the payment as reference, got %+v", tx)
+	}
+
+	again, replayed, err := svc.RecordExternalPayment(payment)
+	if err != nil || !replayed || again.ID != tx.ID {
+		t.Errorf("expected the first deposit replayed, got %+v, %v, %v", again, replayed, err)
+	}
+	if balance, _ := svc.GetCurrentBalance("alice"); balance != 12.5 {
+		t.Errorf("expected a balance of 12.50, got %v", balance)
+	}
+
+	var validationErr *ValidationError
+	if _, _, err := svc.RecordExternalPayment(ExternalPayment{UserID: "alice", Amount: 1}); !errors.As(err, &validationErr) || validationErr.Field != "id" {
+		t.Errorf("expected the payment ID required, got %v", err)
+	}
+	strict := NewLedgerService(store.NewLedgerStore(), WithConfig(Config{StrictAccounts: true}))
+	if _, _, err := strict.RecordExternalPayment(payment); !errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+}
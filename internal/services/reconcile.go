@@ -0,0 +1,219 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+)
+
+const (
+	MatchedByReference = "reference"
+	MatchedByHeuristic = "amount_and_date"
+)
+
+// StatementRow is a single row of an external statement, Line is the line number in the file
+type StatementRow struct {
+	Line      int                    `json:"line"`
+	Date      time.Time              `json:"date"`
+	Amount    float64                `json:"amount"`
+	Type      models.TransactionType `json:"type"`
+	Reference string                 `json:"reference,omitempty"`
+}
+
+type ReconciliationMatch struct {
+	Statement   StatementRow             `json:"statement"`
+	Transaction models.TransactionRecord `json:"transaction"`
+	MatchedBy   string                   `json:"matchedBy"`
+}
+
+type ReconciliationReport struct {
+	UserID               string                     `json:"userId"`
+	PeriodStart          time.Time                  `json:"periodStart"`
+	PeriodEnd            time.Time                  `json:"periodEnd"`
+	Matched              []ReconciliationMatch      `json:"matched"`
+	MissingFromStatement []models.TransactionRecord `json:"missingFromStatement"` // ledger records of the period not on the statement
+	MissingFromLedger    []StatementRow             `json:"missingFromLedger"`    // statement rows without a ledger record
+	AmountMismatches     []ReconciliationMatch      `json:"amountMismatches"`     // same reference but different amount or type
+}
+
+// Reconcile matches a CSV statement of (date, amount, type, reference) rows against the user's ledger.
+// rows are matched by reference first and fall back to the same type and amount within the configured date tolerance
+func (s *ledgerService) Reconcile(userId string, r io.Reader) (ReconciliationReport, error) {
+	if err := validateUserId(userId); err != nil {
+		return ReconciliationReport{}, err
+	}
+
+	rows, err := parseStatement(r)
+	if err != nil {
+		return ReconciliationReport{}, err
+	}
+
+	report := ReconciliationReport{
+		UserID:               userId,
+		Matched:              []ReconciliationMatch{},
+		MissingFromStatement: []models.TransactionRecord{},
+		MissingFromLedger:    []StatementRow{},
+		AmountMismatches:     []ReconciliationMatch{},
+	}
+	if len(rows) == 0 {
+		return report, nil
+	}
+
+	tolerance := s.config.Load().ReconcileDateTolerance
+	report.PeriodStart, report.PeriodEnd = rows[0].Date, rows[0].Date
+	for _, row := range rows[1:] {
+		if row.Date.Before(report.PeriodStart) {
+			report.PeriodStart = row.Date
+		}
+		if row.Date.After(report.PeriodEnd) {
+			report.PeriodEnd = row.Date
+		}
+	}
+
+	from, to := report.PeriodStart.Add(-tolerance), report.PeriodEnd.Add(tolerance)
+	ledger := s.store.GetTransactionsInRange(userId, &from, &to)
+	consumed := make(map[uuid.UUID]bool)
+	var unmatched []StatementRow
+
+	// first pass: the external reference is authoritative when present
+	for _, row := range rows {
+		if row.Reference == "" {
+			unmatched = append(unmatched, row)
+			continue
+		}
+
+		tx, err := s.store.FindByReference(userId, row.Reference)
+		if err != nil || tx.Voided {
+			unmatched = append(unmatched, row)
+			continue
+		}
+
+		consumed[tx.ID] = true
+		match := ReconciliationMatch{Statement: row, Transaction: tx, MatchedBy: MatchedByReference}
+		if tx.Type != row.Type || !sameAmount(tx.Amount, row.Amount) {
+			report.AmountMismatches = append(report.AmountMismatches, match)
+		} else {
+			report.Matched = append(report.Matched, match)
+		}
+	}
+
+	// second pass: same type and amount, closest date within the tolerance. records carrying a different
+	// reference than the row are never matched by heuristics
+	for _, row := range unmatched {
+		best := -1
+		var bestDistance time.Duration
+		for i, tx := range ledger {
+			if consumed[tx.ID] || tx.Voided || tx.Type != row.Type || !sameAmount(tx.Amount, row.Amount) {
+				continue
+			}
+			if row.Reference != "" && tx.ReferenceID != "" {
+				continue
+			}
+
+			distance := tx.Timestamp.Sub(row.Date).Abs()
+			if distance > tolerance {
+				continue
+			}
+			if best == -1 || distance < bestDistance {
+				best, bestDistance = i, distance
+			}
+		}
+
+		if best == -1 {
+			report.MissingFromLedger = append(report.MissingFromLedger, row)
+			continue
+		}
+
+		consumed[ledger[best].ID] = true
+		report.Matched = append(report.Matched, ReconciliationMatch{Statement: row, Transaction: ledger[best], MatchedBy: MatchedByHeuristic})
+	}
+
+	for _, tx := range ledger {
+		if !consumed[tx.ID] && !tx.Voided {
+			report.MissingFromStatement = append(report.MissingFromStatement, tx)
+		}
+	}
+
+	return report, nil
+}
+
+// parseStatement reads the statement rows, the header row is optional
+func parseStatement(r io.Reader) ([]StatementRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	var rows []StatementRow
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid statement: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+		if len(rows) == 0 && line == 1 && strings.EqualFold(strings.TrimSpace(record[0]), "date") {
+			continue
+		}
+
+		row, err := parseStatementRow(record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid statement line %d: %w", line, err)
+		}
+		row.Line = line
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func parseStatementRow(record []string) (StatementRow, error) {
+	if len(record) < 3 || len(record) > 4 {
+		return StatementRow{}, errors.New("expected date, amount, type and an optional reference")
+	}
+
+	date, err := parseStatementDate(strings.TrimSpace(record[0]))
+	if err != nil {
+		return StatementRow{}, err
+	}
+
+	amount, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+	if err != nil || amount <= 0 {
+		return StatementRow{}, errors.New("amount must be a positive number")
+	}
+
+	txType := models.TransactionType(strings.ToLower(strings.TrimSpace(record[2])))
+	if txType != models.Deposit && txType != models.Withdrawal {
+		return StatementRow{}, errors.New("invalid transaction type")
+	}
+
+	row := StatementRow{Date: date, Amount: amount, Type: txType}
+	if len(record) == 4 {
+		row.Reference = strings.TrimSpace(record[3])
+	}
+	return row, nil
+}
+
+func parseStatementDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.New("invalid date, use RFC3339 or YYYY-MM-DD")
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < amountTolerance
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestReconcile(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "recon_user"
+	at := func(day, hour int) time.Time {
+		return time.Date(2024, time.March, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	records := []models.TransactionRecord{
+		{ID: uuid.New(), Amount: 500.0, Type: models.Deposit, Timestamp: at(1, 10), ReferenceID: "PAY-001"},
+		{ID: uuid.New(), Amount: 120.0, Type: models.Withdrawal, Timestamp: at(2, 9), ReferenceID: "PAY-002"},
+		{ID: uuid.New(), Amount: 40.0, Type: models.Withdrawal, Timestamp: at(3, 15)},
+		{ID: uuid.New(), Amount: 75.0, Type: models.Deposit, Timestamp: at(4, 12)},
+		{ID: uuid.New(), Amount: 10.0, Type: models.Deposit, Timestamp: time.Date(2024, time.April, 20, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tx := range records {
+		s.AddTransactionWithTime(userId, tx)
+	}
+
+	file, err := os.Open("testdata/reconcile_statement.csv")
+	if err != nil {
+		t.Fatalf("failed to open fixture: %v", err)
+	}
+	defer file.Close()
+
+	report, err := svc.Reconcile(userId, file)
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+
+	if len(report.Matched) != 2 {
+		t.Fatalf("expected 2 matches, got %d: %+v", len(report.Matched), report.Matched)
+	}
+	if report.Matched[0].Transaction.ID != records[0].ID || report.Matched[0].MatchedBy != MatchedByReference {
+		t.Errorf("expected PAY-001 to match by reference, got %+v", report.Matched[0])
+	}
+	if report.Matched[1].Transaction.ID != records[2].ID || report.Matched[1].MatchedBy != MatchedByHeuristic {
+		t.Errorf("expected the 40.00 withdrawal to match by amount and date, got %+v", report.Matched[1])
+	}
+
+	if len(report.AmountMismatches) != 1 || report.AmountMismatches[0].Transaction.ID != records[1].ID {
+		t.Errorf("expected PAY-002 to be an amount mismatch, got %+v", report.AmountMismatches)
+	}
+
+	if len(report.MissingFromStatement) != 1 || report.MissingFromStatement[0].ID != records[3].ID {
+		t.Errorf("expected the 75.00 deposit to be missing from the statement, got %+v", report.MissingFromStatement)
+	}
+
+	if len(report.MissingFromLedger) != 2 {
+		t.Fatalf("expected 2 rows missing from the ledger, got %+v", report.MissingFromLedger)
+	}
+	if report.MissingFromLedger[0].Reference != "PAY-009" || report.MissingFromLedger[0].Line != 5 {
+		t.Errorf("unexpected missing row: %+v", report.MissingFromLedger[0])
+	}
+}
+
+func TestReconcile_DateTolerance(t *testing.T) {
+	s := store.NewLedgerStore()
+	config := DefaultConfig()
+	config.ReconcileDateTolerance = time.Hour
+	svc := NewLedgerService(s, WithConfig(config))
+
+	userId := "tolerance_user"
+	s.AddTransactionWithTime(userId, models.TransactionRecord{
+		ID:        uuid.New(),
+		Amount:    40.0,
+		Type:      models.Withdrawal,
+		Timestamp: time.Date(2024, time.March, 3, 15, 0, 0, 0, time.UTC),
+	})
+
+	report, err := svc.Reconcile(userId, strings.NewReader("2024-03-03,40.00,withdrawal\n"))
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+
+	if len(report.Matched) != 0 || len(report.MissingFromLedger) != 1 {
+		t.Errorf("expected no match outside the tolerance, got %+v", report)
+	}
+}
+
+func TestReconcile_InvalidStatement(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	tests := []struct {
+		name      string
+		statement string
+	}{
+		{"Invalid date", "03/01/2024,10.00,deposit,REF\n"},
+		{"Invalid amount", "2024-03-01,ten,deposit,REF\n"},
+		{"Negative amount", "2024-03-01,-10.00,deposit,REF\n"},
+		{"Invalid type", "2024-03-01,10.00,refund,REF\n"},
+		{"Missing columns", "2024-03-01,10.00\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := svc.Reconcile("valid_user", strings.NewReader(test.statement)); err == nil {
+				t.Errorf("expected error but got none")
+			}
+		})
+	}
+}
+
+func TestRecordTransactionInput_DuplicateReference(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	input := TransactionInput{Type: models.Deposit, Amount: 10.0, ReferenceID: "EXT-1"}
+	tx, err := svc.RecordTransactionInput("ref_user", input)
+	if err != nil {
+		t.Fatalf("failed to record transaction: %v", err)
+	}
+	if tx.ReferenceID != "EXT-1" {
+		t.Errorf("expected reference EXT-1, got %q", tx.ReferenceID)
+	}
+
+	if _, err := svc.RecordTransactionInput("ref_user", input); !errors.Is(err, store.ErrDuplicateReference) {
+		t.Errorf("expected duplicate reference error, got %v", err)
+	}
+
+	// references are scoped per user
+	if _, err := svc.RecordTransactionInput("other_user", input); err != nil {
+		t.Errorf("expected the same reference to be accepted for another user, got %v", err)
+	}
+
+	input.ReferenceID = strings.Repeat("x", 65)
+	if _, err := svc.RecordTransactionInput("ref_user", input); err == nil {
+		t.Errorf("expected error for a too long reference")
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import "math"
+
+// RoundingPolicy decides how computed amounts with sub-cent values are rounded to cents
+type RoundingPolicy string
+
+const (
+	RoundHalfUp   RoundingPolicy = "half_up"   // ties away from zero: 0.005 -> 0.01, 0.015 -> 0.02
+	RoundHalfEven RoundingPolicy = "half_even" // ties to the even cent (banker's rounding): 0.005 -> 0.00, 0.015 -> 0.02
+	RoundTruncate RoundingPolicy = "truncate"  // drops the sub-cent part: 0.005 -> 0.00, 0.015 -> 0.01
+)
+
+// Round rounds the amount to cents, an unknown policy rounds half up.
+// the amount is first snapped to 1e-6 of a cent so binary float noise (0.015 is stored as 0.01499999...)
+// doesn't turn a tie into a round down
+func (p RoundingPolicy) Round(amount float64) float64 {
+	cents := math.Round(amount*100*1e6) / 1e6
+
+	switch p {
+	case RoundHalfEven:
+		cents = math.RoundToEven(cents)
+	case RoundTruncate:
+		cents = math.Trunc(cents)
+	default:
+		cents = math.Round(cents)
+	}
+	return cents / 100
+}
+
+// round applies the configured policy, every derived amount goes through here
+func (s *ledgerService) round(amount float64) float64 {
+	return s.config.Load().RoundingPolicy.Round(amount)
+}
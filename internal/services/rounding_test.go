@@ -0,0 +1,36 @@
+package services
+
+import "testing"
+
+func TestRoundingPolicy_Round(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   RoundingPolicy
+		amount   float64
+		expected float64
+	}{
+		{"Half up 0.005", RoundHalfUp, 0.005, 0.01},
+		{"Half up 0.015", RoundHalfUp, 0.015, 0.02},
+		{"Half up 1.005", RoundHalfUp, 1.005, 1.01},
+		{"Half up below the tie", RoundHalfUp, 0.0049, 0.00},
+		{"Half up negative tie", RoundHalfUp, -0.015, -0.02},
+		{"Half even 0.005", RoundHalfEven, 0.005, 0.00},
+		{"Half even 0.015", RoundHalfEven, 0.015, 0.02},
+		{"Half even 0.025", RoundHalfEven, 0.025, 0.02},
+		{"Half even above the tie", RoundHalfEven, 0.0051, 0.01},
+		{"Truncate 0.005", RoundTruncate, 0.005, 0.00},
+		{"Truncate 0.015", RoundTruncate, 0.015, 0.01},
+		{"Truncate 0.019", RoundTruncate, 0.019, 0.01},
+		{"Truncate negative", RoundTruncate, -0.019, -0.01},
+		{"Whole cents unchanged", RoundTruncate, 0.29, 0.29},
+		{"Unknown policy rounds half up", RoundingPolicy("bogus"), 0.015, 0.02},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.Round(test.amount); got != test.expected {
+				t.Errorf("expected %v, got %v", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package services
+
+import "github.com/google/uuid"
+
+// GetRunningBalances returns the balance of the user right after each of the given transactions, rounded. it reflects
+// the whole ledger: records a filter left out of a page still moved the balance, voided ones didn't. unknown ids are
+// left out
+func (s *ledgerService) GetRunningBalances(userId string, txIDs []uuid.UUID) (map[uuid.UUID]float64, error) {
+	if err := validateUserId(userId); err != nil {
+		return nil, err
+	}
+
+	balances := s.store.BalancesAfter(userId, txIDs)
+	for txID, balance := range balances {
+		balances[txID] = s.round(balance)
+	}
+	return balances, nil
+}
@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestGetRunningBalances(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore(), WithFeeSchedule(StandardFeeSchedule()))
+
+	deposit, _ := svc.RecordTransaction("user1", models.Deposit, 100, "salary")
+	withdrawal, _ := svc.RecordTransaction("user1", models.Withdrawal, 10.1, "coffee")
+	reversal, err := svc.ReverseTransaction("user1", withdrawal.ID, "refund")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the fee of 0.60 is kept by the reversal
+	balances, err := svc.GetRunningBalances("user1", []uuid.UUID{reversal.ID, deposit.ID, withdrawal.ID})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := map[uuid.UUID]float64{deposit.ID: 100, withdrawal.ID: 89.3, reversal.ID: 99.4}
+	for txID, balance := range expected {
+		if balances[txID] != balance {
+			t.Errorf("expected the balance %v after %s, got %v", balance, txID, balances[txID])
+		}
+	}
+
+	_, err = svc.GetRunningBalances("bad user", nil)
+	assertValidationCode(t, err, "invalid_user_id")
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"tiny-ledger/internal/models"
+)
+
+// the years a statement can be asked for, anything else is a typo
+const (
+	minStatementYear = 1970
+	maxStatementYear = 2100
+)
+
+// MonthlyStatement is the activity of a calendar month (UTC). voided records are listed but leave the balance and the
+// subtotals alone
+type MonthlyStatement struct {
+	UserID         string            `json:"userId"`
+	Year           int               `json:"year"`
+	Month          int               `json:"month"`
+	PeriodStart    time.Time         `json:"periodStart"`
+	PeriodEnd      time.Time         `json:"periodEnd"` // the last instant of the month
+	Currency       string            `json:"currency"`
+	OpeningBalance float64           `json:"openingBalance"`
+	ClosingBalance float64           `json:"closingBalance"`
+	Deposits       StatementSubtotal `json:"deposits"`
+	Withdrawals    StatementSubtotal `json:"withdrawals"`
+	TotalFees      float64           `json:"totalFees"`
+	Transactions   []StatementLine   `json:"transactions"`
+}
+
+type StatementSubtotal struct {
+	Count int     `json:"count"`
+	Total float64 `json:"total"`
+}
+
+// StatementLine is a record of the statement with the balance right after it
+type StatementLine struct {
+	Transaction    models.TransactionRecord `json:"transaction"`
+	RunningBalance float64                  `json:"runningBalance"`
+}
+
+// GetMonthlyStatement returns the statement of the month, oldest record first. a month before the first record of the
+// user is an empty statement with zero balances
+func (s *ledgerService) GetMonthlyStatement(userId string, year, month int) (MonthlyStatement, error) {
+	if err := validateUserId(userId); err != nil {
+		return MonthlyStatement{}, err
+	}
+
+	if year < minStatementYear || year > maxStatementYear {
+		return MonthlyStatement{}, &ValidationError{
+			Field:   "year",
+			Code:    "out_of_range",
+			Message: fmt.Sprintf("year must be between %d and %d", minStatementYear, maxStatementYear),
+		}
+	}
+	if month < 1 || month > 12 {
+		return MonthlyStatement{}, &ValidationError{Field: "month", Code: "out_of_range", Message: "month must be between 1 and 12"}
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return MonthlyStatement{}, err
+	}
+
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0).Add(-time.Nanosecond)
+
+	opening, err := s.store.GetBalanceAt(userId, start.Add(-time.Nanosecond))
+	if err != nil {
+		return MonthlyStatement{}, err
+	}
+
+	statement := MonthlyStatement{
+		UserID:       userId,
+		Year:         year,
+		Month:        month,
+		PeriodStart:  start,
+		PeriodEnd:    end,
+		Currency:     s.config.Load().Currency,
+		Transactions: []StatementLine{},
+	}
+
+	balance := opening
+	for _, tx := range s.store.GetTransactionsInRange(userId, &start, &end) {
+		if !tx.Voided {
+			switch tx.Type {
+			case models.Withdrawal:
+				balance -= tx.Amount + tx.Fee
+				statement.Withdrawals.Count++
+				statement.Withdrawals.Total += tx.Amount
+				statement.TotalFees += tx.Fee
+			default:
+				balance += tx.Amount
+				statement.Deposits.Count++
+				statement.Deposits.Total += tx.Amount
+			}
+		}
+		statement.Transactions = append(statement.Transactions, StatementLine{Transaction: tx, RunningBalance: s.round(balance)})
+	}
+
+	statement.OpeningBalance = s.round(opening)
+	statement.ClosingBalance = s.round(balance)
+	statement.Deposits.Total = s.round(statement.Deposits.Total)
+	statement.Withdrawals.Total = s.round(statement.Withdrawals.Total)
+	statement.TotalFees = s.round(statement.TotalFees)
+	return statement, nil
+}
+
+// StatementColumns is the header row of the CSV statement, the export columns plus the running balance
+var StatementColumns = append(append([]string{}, ExportColumns...), "runningBalance")
+
+// WriteCSV writes the statement as CSV, framed by an opening_balance and a closing_balance row so the file stands on
+// its own. the subtotals are left out, they're the sums of the rows
+func (m MonthlyStatement) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(StatementColumns); err != nil {
+		return err
+	}
+	if err := out.Write(balanceRow("opening_balance", m.PeriodStart, m.OpeningBalance)); err != nil {
+		return err
+	}
+	for _, line := range m.Transactions {
+		if err := out.Write(append(exportRow(line.Transaction), formatAmount(line.RunningBalance))); err != nil {
+			return err
+		}
+	}
+	if err := out.Write(balanceRow("closing_balance", m.PeriodEnd, m.ClosingBalance)); err != nil {
+		return err
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// balanceRow is a row of the statement CSV that only carries a balance
+func balanceRow(kind string, at time.Time, balance float64) []string {
+	row := make([]string, len(StatementColumns))
+	row[1] = at.UTC().Format(time.RFC3339Nano)
+	row[2] = kind
+	row[len(row)-1] = formatAmount(balance)
+	return row
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
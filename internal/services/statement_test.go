@@ -0,0 +1,78 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestGetMonthlyStatement(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	at := func(month time.Month, day int) time.Time {
+		return time.Date(2024, month, day, 12, 0, 0, 0, time.UTC)
+	}
+	s.AddTransactionWithTime("user1", models.TransactionRecord{Amount: 100, Type: models.Deposit, Timestamp: at(time.January, 31)})
+	s.AddTransactionWithTime("user1", models.TransactionRecord{Amount: 50, Type: models.Deposit, Timestamp: at(time.February, 1)})
+	s.AddTransactionWithTime("user1", models.TransactionRecord{Amount: 30, Fee: 1, Type: models.Withdrawal, Timestamp: at(time.February, 10)})
+	s.AddTransactionWithTime("user1", models.TransactionRecord{Amount: 500, Type: models.Deposit, Timestamp: at(time.February, 11), Voided: true})
+	s.AddTransactionWithTime("user1", models.TransactionRecord{Amount: 20, Type: models.Withdrawal, Timestamp: at(time.March, 1)})
+
+	statement, err := svc.GetMonthlyStatement("user1", 2024, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if statement.OpeningBalance != 100 || statement.ClosingBalance != 119 {
+		t.Errorf("expected balances 100 to 119, got %v to %v", statement.OpeningBalance, statement.ClosingBalance)
+	}
+	if statement.Deposits != (StatementSubtotal{Count: 1, Total: 50}) || statement.Withdrawals != (StatementSubtotal{Count: 1, Total: 30}) || statement.TotalFees != 1 {
+		t.Errorf("unexpected subtotals: %+v %+v fees %v", statement.Deposits, statement.Withdrawals, statement.TotalFees)
+	}
+
+	// the voided deposit is listed without moving the balance
+	expected := []float64{150, 119, 119}
+	if len(statement.Transactions) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(statement.Transactions))
+	}
+	for i, line := range statement.Transactions {
+		if line.RunningBalance != expected[i] {
+			t.Errorf("line %d: expected running balance %v, got %v", i, expected[i], line.RunningBalance)
+		}
+	}
+
+	var csv strings.Builder
+	if err := statement.WriteCSV(&csv); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(lines) != 6 || !strings.HasSuffix(lines[0], ",runningBalance") || !strings.Contains(lines[1], "opening_balance") || !strings.HasSuffix(lines[5], ",119.00") {
+		t.Errorf("unexpected CSV:\n%s", csv.String())
+	}
+}
+
+func TestGetMonthlyStatement_Validation(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	tests := []struct {
+		name         string
+		year, month  int
+		expectedCode string
+	}{
+		{"Valid month", 2024, 12, ""},
+		{"Month 13", 2024, 13, "out_of_range"},
+		{"Month 0", 2024, 0, "out_of_range"},
+		{"Year too early", 1900, 1, "out_of_range"},
+		{"Year too late", 20240, 1, "out_of_range"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.GetMonthlyStatement("user1", tt.year, tt.month)
+			assertValidationCode(t, err, tt.expectedCode)
+		})
+	}
+}
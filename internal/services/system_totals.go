@@ -0,0 +1,40 @@
+package services
+
+import (
+	"math"
+
+	"tiny-ledger/internal/store"
+)
+
+// amountTolerance absorbs the float rounding noise when comparing sums of amounts (half a cent)
+const amountTolerance = 0.005
+
+type SystemTotals struct {
+	TotalBalance     float64 `json:"totalBalance"`
+	TotalDeposits    float64 `json:"totalDeposits"`
+	TotalWithdrawals float64 `json:"totalWithdrawals"`
+	TotalFees        float64 `json:"totalFees"`
+	UserCount        int     `json:"userCount"`
+	TransactionCount int     `json:"transactionCount"`
+	Consistent       bool    `json:"consistent"`
+}
+
+// GetSystemTotals returns the trial balance of the whole ledger, Consistent is false when
+// the money that entered minus the money that left (withdrawals and fees) doesn't match the sum of the balances
+func (s *ledgerService) GetSystemTotals() (SystemTotals, error) {
+	totals := s.store.GetSystemTotals()
+
+	return SystemTotals{
+		TotalBalance:     totals.TotalBalance,
+		TotalDeposits:    totals.TotalDeposits,
+		TotalWithdrawals: totals.TotalWithdrawals,
+		TotalFees:        totals.TotalFees,
+		UserCount:        totals.UserCount,
+		TransactionCount: totals.TransactionCount,
+		Consistent:       isConsistent(totals),
+	}, nil
+}
+
+func isConsistent(totals store.SystemTotals) bool {
+	return math.Abs(totals.TotalDeposits-totals.TotalWithdrawals-totals.TotalFees-totals.TotalBalance) <= amountTolerance
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"testing"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestGetSystemTotals(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	totals, err := svc.GetSystemTotals()
+	if err != nil {
+		t.Fatalf("failed to get system totals: %v", err)
+	}
+	if totals.UserCount != 0 || totals.TransactionCount != 0 || !totals.Consistent {
+		t.Errorf("unexpected totals for empty ledger: %+v", totals)
+	}
+
+	operations := []struct {
+		userId string
+		txType models.TransactionType
+		amount float64
+	}{
+		{"user_one", models.Deposit, 100.0},
+		{"user_one", models.Withdrawal, 40.0},
+		{"user_two", models.Deposit, 250.5},
+		{"user_three", models.Deposit, 10.0},
+		{"user_three", models.Withdrawal, 10.0},
+	}
+
+	for _, op := range operations {
+		if _, err := svc.RecordTransaction(op.userId, op.txType, op.amount, "totals test"); err != nil {
+			t.Fatalf("failed to record transaction: %v", err)
+		}
+	}
+
+	// rejected transactions must not change the totals
+	if _, err := svc.RecordTransaction("user_three", models.Withdrawal, 1.0, "overdraft"); err == nil {
+		t.Fatalf("expected insufficient funds error")
+	}
+
+	totals, err = svc.GetSystemTotals()
+	if err != nil {
+		t.Fatalf("failed to get system totals: %v", err)
+	}
+
+	if totals.UserCount != 3 {
+		t.Errorf("expected 3 users, got %d", totals.UserCount)
+	}
+	if totals.TransactionCount != 5 {
+		t.Errorf("expected 5 transactions, got %d", totals.TransactionCount)
+	}
+	if totals.TotalDeposits != 360.5 {
+		t.Errorf("expected total deposits 360.50, got %.2f", totals.TotalDeposits)
+	}
+	if totals.TotalWithdrawals != 50.0 {
+		t.Errorf("expected total withdrawals 50.00, got %.2f", totals.TotalWithdrawals)
+	}
+	if totals.TotalBalance != 310.5 {
+		t.Errorf("expected total balance 310.50, got %.2f", totals.TotalBalance)
+	}
+	if !totals.Consistent {
+		t.Errorf("expected totals to be consistent: %+v", totals)
+	}
+}
+
+func TestIsConsistent(t *testing.T) {
+	tests := []struct {
+		name     string
+		totals   store.SystemTotals
+		expected bool
+	}{
+		{"Balanced", store.SystemTotals{TotalBalance: 60, TotalDeposits: 100, TotalWithdrawals: 40}, true},
+		{"Float noise", store.SystemTotals{TotalBalance: 0.30000000000000004, TotalDeposits: 0.3}, true},
+		{"Missing money", store.SystemTotals{TotalBalance: 50, TotalDeposits: 100, TotalWithdrawals: 40}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := isConsistent(test.totals); got != test.expected {
+				t.Errorf("expected consistent=%v, got %v", test.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownTenant is returned for a tenant that isn't in the allow-list of the registry
+var ErrUnknownTenant = errors.New("unknown tenant")
+
+// a tenant ID ends up in metric labels and file names, so no dots or slashes
+var tenantIdRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,50}$`)
+
+// TenantRegistry hands out a ledger of its own to every tenant of the allow-list, so the same user ID in two tenants
+// are two unrelated users. the service of a tenant is created by newService on its first request and kept after that
+type TenantRegistry struct {
+	tenants    []string
+	newService func(tenant string) LedgerService
+
+	mu       sync.Mutex
+	services map[string]LedgerService
+}
+
+func NewTenantRegistry(tenants []string, newService func(tenant string) LedgerService) (*TenantRegistry, error) {
+	if len(tenants) == 0 {
+		return nil, errors.New("no tenant allowed")
+	}
+	for _, tenant := range tenants {
+		if !tenantIdRegex.MatchString(tenant) {
+			return nil, fmt.Errorf("invalid tenant ID %q, use letters, digits, '_' or '-'", tenant)
+		}
+	}
+
+	return &TenantRegistry{
+		tenants:    slices.Compact(slices.Sorted(slices.Values(tenants))),
+		newService: newService,
+		services:   make(map[string]LedgerService),
+	}, nil
+}
+
+// ParseTenants splits a comma separated allow-list, blanks around the names are ignored
+func ParseTenants(list string) []string {
+	var tenants []string
+	for _, tenant := range strings.Split(list, ",") {
+		if tenant = strings.TrimSpace(tenant); tenant != "" {
+			tenants = append(tenants, tenant)
+		}
+	}
+	return tenants
+}
+
+// Service returns the ledger of the tenant, creating it on the first call
+func (r *TenantRegistry) Service(tenant string) (LedgerService, error) {
+	if _, found := slices.BinarySearch(r.tenants, tenant); !found {
+		return nil, ErrUnknownTenant
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	service, ok := r.services[tenant]
+	if !ok {
+		service = r.newService(tenant)
+		r.services[tenant] = service
+	}
+	return service, nil
+}
+
+// Tenants is the allow-list, sorted
+func (r *TenantRegistry) Tenants() []string {
+	return slices.Clone(r.tenants)
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"tiny-ledger/internal/store"
+)
+
+func TestTenantRegistry(t *testing.T) {
+	var created []string
+	registry, err := NewTenantRegistry([]string{"staging", "dev", "staging"}, func(tenant string) LedgerService {
+		created = append(created, tenant)
+		return NewLedgerService(store.NewLedgerStore())
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tenants := registry.Tenants(); !slices.Equal(tenants, []string{"dev", "staging"}) {
+		t.Errorf("expected the sorted allow-list, got %v", tenants)
+	}
+	if len(created) != 0 {
+		t.Errorf("expected no ledger before the first request, got %v", created)
+	}
+
+	first, err := registry.Service("staging")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, _ := registry.Service("staging")
+	if first != second || !slices.Equal(created, []string{"staging"}) {
+		t.Errorf("expected the ledger of staging to be created once, got %v", created)
+	}
+
+	if _, err := registry.Service("production"); !errors.Is(err, ErrUnknownTenant) {
+		t.Errorf("expected ErrUnknownTenant, got %v", err)
+	}
+}
+
+func TestNewTenantRegistryValidation(t *testing.T) {
+	newService := func(string) LedgerService { return nil }
+	for _, tenants := range [][]string{nil, {"ok", "../etc"}, {"a.b"}} {
+		if _, err := NewTenantRegistry(tenants, newService); err == nil {
+			t.Errorf("expected %v to be rejected", tenants)
+		}
+	}
+
+	if tenants := ParseTenants(" staging, ,dev,"); !slices.Equal(tenants, []string{"staging", "dev"}) {
+		t.Errorf("unexpected tenants %v", tenants)
+	}
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"time"
+
+	"tiny-ledger/internal/models"
+)
+
+const maxTopTransactions = 100
+
+// GetTopTransactions returns the n largest transactions of the period, optionally of a single type, by amount
+// descending and the older first on equal amounts. voided records are left out.
+// only the best n are kept in a min-heap while scanning, so it's O(history * log n) without sorting the history
+func (s *ledgerService) GetTopTransactions(userId string, startTime, endTime *time.Time, txType *models.TransactionType, n int) ([]models.TransactionRecord, error) {
+	if err := validateUserId(userId); err != nil {
+		return nil, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return nil, err
+	}
+
+	if n < 1 || n > maxTopTransactions {
+		return nil, fmt.Errorf("n must be between 1 and %d", maxTopTransactions)
+	}
+
+	if txType != nil && *txType != models.Deposit && *txType != models.Withdrawal {
+		return nil, errors.New("invalid transaction type")
+	}
+
+	if startTime != nil && endTime != nil && startTime.After(*endTime) {
+		return nil, errors.New("start time cannot be after end time")
+	}
+
+	top := make(topHeap, 0, n)
+	seq := 0
+	s.store.ScanTransactions(userId, startTime, endTime, func(tx models.TransactionRecord) bool {
+		if tx.Voided || (txType != nil && tx.Type != *txType) {
+			return true
+		}
+
+		candidate := rankedTransaction{tx: tx, seq: seq}
+		seq++
+		if len(top) < n {
+			heap.Push(&top, candidate)
+		} else if top.less(top[0], candidate) {
+			top[0] = candidate
+			heap.Fix(&top, 0)
+		}
+		return true
+	})
+
+	// popping the min-heap yields the smallest first, fill the result from the back
+	result := make([]models.TransactionRecord, len(top))
+	for i := len(result) - 1; i >= 0; i-- {
+		result[i] = heap.Pop(&top).(rankedTransaction).tx
+	}
+	return result, nil
+}
+
+// rankedTransaction remembers the scan position so equal amount and timestamp still have a stable order
+type rankedTransaction struct {
+	tx  models.TransactionRecord
+	seq int
+}
+
+// topHeap is a min-heap on the rank, the root is the weakest of the kept transactions
+type topHeap []rankedTransaction
+
+// less reports whether a ranks below b: smaller amount, or on equal amounts the newer one
+func (h topHeap) less(a, b rankedTransaction) bool {
+	if a.tx.Amount != b.tx.Amount {
+		return a.tx.Amount < b.tx.Amount
+	}
+	if !a.tx.Timestamp.Equal(b.tx.Timestamp) {
+		return a.tx.Timestamp.After(b.tx.Timestamp)
+	}
+	return a.seq > b.seq
+}
+
+func (h topHeap) Len() int           { return len(h) }
+func (h topHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h topHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *topHeap) Push(x interface{}) {
+	*h = append(*h, x.(rankedTransaction))
+}
+
+func (h *topHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
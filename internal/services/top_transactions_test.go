@@ -0,0 +1,103 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestGetTopTransactions(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s)
+
+	userId := "fraud_review"
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	add := func(description string, txType models.TransactionType, amount float64, offset time.Duration) {
+		s.AddTransactionWithTime(userId, models.TransactionRecord{
+			ID:          uuid.New(),
+			Type:        txType,
+			Amount:      amount,
+			Description: description,
+			Timestamp:   base.Add(offset),
+		})
+	}
+
+	add("d1", models.Deposit, 500.0, 0)
+	add("w1", models.Withdrawal, 200.0, 1*time.Hour)
+	add("d2", models.Deposit, 200.0, 2*time.Hour)
+	add("d3", models.Deposit, 900.0, 3*time.Hour)
+	add("w2", models.Withdrawal, 200.0, 4*time.Hour)
+	add("d4", models.Deposit, 50.0, 5*time.Hour)
+	add("d5", models.Deposit, 200.0, 5*time.Hour)
+	add("d6", models.Deposit, 200.0, 5*time.Hour) // tie with d5 on amount and timestamp, insertion order decides
+
+	deposit, withdrawal := models.Deposit, models.Withdrawal
+	invalidType := models.TransactionType("refund")
+
+	tests := []struct {
+		name      string
+		start     *time.Time
+		end       *time.Time
+		txType    *models.TransactionType
+		n         int
+		expected  []string
+		expectErr bool
+	}{
+		{"Top 3", nil, nil, nil, 3, []string{"d3", "d1", "w1"}, false},
+		{"Ties by timestamp then insertion", nil, nil, nil, 7, []string{"d3", "d1", "w1", "d2", "w2", "d5", "d6"}, false},
+		{"More than available", nil, nil, nil, 100, []string{"d3", "d1", "w1", "d2", "w2", "d5", "d6", "d4"}, false},
+		{"Deposits only", nil, nil, &deposit, 2, []string{"d3", "d1"}, false},
+		{"Withdrawals only", nil, nil, &withdrawal, 5, []string{"w1", "w2"}, false},
+		{"Period", timePtr(base.Add(90 * time.Minute)), timePtr(base.Add(4 * time.Hour)), nil, 2, []string{"d3", "d2"}, false},
+		{"Zero n", nil, nil, nil, 0, nil, true},
+		{"n over the cap", nil, nil, nil, 101, nil, true},
+		{"Invalid type", nil, nil, &invalidType, 3, nil, true},
+		{"Inverted period", timePtr(base.Add(time.Hour)), timePtr(base), nil, 3, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := svc.GetTopTransactions(userId, test.start, test.end, test.txType, test.n)
+			if test.expectErr {
+				if err == nil {
+					t.Error("expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error but got: %v", err)
+			}
+
+			if len(result) != len(test.expected) {
+				t.Fatalf("expected %d transactions, got %d", len(test.expected), len(result))
+			}
+			for i, description := range test.expected {
+				if result[i].Description != description {
+					t.Errorf("position %d: expected %s, got %s", i, description, result[i].Description)
+				}
+			}
+		})
+	}
+}
+
+func TestGetTopTransactions_SkipsVoided(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	big, _ := svc.RecordTransaction("user1", models.Deposit, 1000.0, "typo")
+	svc.RecordTransaction("user1", models.Deposit, 10.0, "real")
+	if _, err := svc.VoidTransaction("user1", big.ID, "wrong amount"); err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+
+	result, err := svc.GetTopTransactions("user1", nil, nil, nil, 5)
+	if err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+	if len(result) != 1 || result[0].Description != "real" {
+		t.Errorf("expected only the non voided record, got %+v", result)
+	}
+}
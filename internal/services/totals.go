@@ -0,0 +1,74 @@
+package services
+
+import (
+	"time"
+
+	"tiny-ledger/internal/models"
+)
+
+// TypeTotals is the number of records of a type and the sum of their amounts
+type TypeTotals struct {
+	Count int     `json:"count"`
+	Sum   float64 `json:"sum"`
+}
+
+// PeriodTotals are the deposits and withdrawals of a user over a period, voided records are left out. a reversal is
+// a record of the opposite type, so the reversal of a withdrawal is counted with the deposits and the withdrawal stays
+// in its own bucket, the same way the balance sees them. fees aren't part of the withdrawals, net is deposits minus
+// withdrawals minus fees: how much the balance moved over the period
+type PeriodTotals struct {
+	UserID      string     `json:"userId"`
+	Start       *time.Time `json:"start,omitempty"` // left out when the period is open ended
+	End         *time.Time `json:"end,omitempty"`
+	Currency    string     `json:"currency"`
+	Deposits    TypeTotals `json:"deposits"`
+	Withdrawals TypeTotals `json:"withdrawals"`
+	Fees        float64    `json:"fees"`
+	Net         float64    `json:"net"`
+}
+
+// GetTotals adds up the records between startTime and endTime (both inclusive, nil is open ended). the whole history
+// comes from the incremental aggregates of the user, a period takes a single pass over its records
+func (s *ledgerService) GetTotals(userId string, startTime, endTime *time.Time) (PeriodTotals, error) {
+	if err := validateUserId(userId); err != nil {
+		return PeriodTotals{}, err
+	}
+
+	if startTime != nil && endTime != nil && startTime.After(*endTime) {
+		return PeriodTotals{}, &ValidationError{Field: "start", Code: "invalid_range", Message: "start time cannot be after end time"}
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return PeriodTotals{}, err
+	}
+
+	totals := PeriodTotals{UserID: userId, Start: startTime, End: endTime, Currency: s.config.Load().Currency}
+	if startTime == nil && endTime == nil {
+		aggregates := s.store.GetAccountTotals(userId)
+		totals.Deposits = TypeTotals{Count: aggregates.DepositCount, Sum: aggregates.TotalDeposits}
+		totals.Withdrawals = TypeTotals{Count: aggregates.WithdrawalCount, Sum: aggregates.TotalWithdrawals}
+		totals.Fees = aggregates.TotalFees
+	} else {
+		s.store.ScanTransactions(userId, startTime, endTime, func(tx models.TransactionRecord) bool {
+			if tx.Voided {
+				return true
+			}
+			switch tx.Type {
+			case models.Withdrawal:
+				totals.Withdrawals.Count++
+				totals.Withdrawals.Sum += tx.Amount
+				totals.Fees += tx.Fee
+			default:
+				totals.Deposits.Count++
+				totals.Deposits.Sum += tx.Amount
+			}
+			return true
+		})
+	}
+
+	totals.Net = s.round(totals.Deposits.Sum - totals.Withdrawals.Sum - totals.Fees)
+	totals.Deposits.Sum = s.round(totals.Deposits.Sum)
+	totals.Withdrawals.Sum = s.round(totals.Withdrawals.Sum)
+	totals.Fees = s.round(totals.Fees)
+	return totals, nil
+}
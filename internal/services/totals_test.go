@@ -0,0 +1,108 @@
+package services
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestGetTotals(t *testing.T) {
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s, WithFeeSchedule(StandardFeeSchedule()))
+
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 40; i++ {
+		tx := models.TransactionRecord{Amount: float64(10 + i*7%23), Type: models.Deposit, Timestamp: base.Add(time.Duration(i) * 7 * time.Hour)}
+		if i%3 == 0 {
+			tx.Type, tx.Fee = models.Withdrawal, 0.5
+		}
+		tx.Voided = i%11 == 0
+		s.AddTransactionWithTime("user1", tx)
+	}
+	// a fee charged withdrawal and a reversed one, recorded now
+	if _, err := svc.RecordTransaction("user1", models.Withdrawal, 40, "rent"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	reversed, err := svc.RecordTransaction("user1", models.Withdrawal, 25, "mistake")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.ReverseTransaction("user1", reversed.ID, "typo"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// bruteForce walks the whole history and keeps what falls in the period
+	bruteForce := func(start, end *time.Time) (deposits, withdrawals TypeTotals, fees float64) {
+		for _, tx := range s.GetTransactionsInRange("user1", nil, nil) {
+			if tx.Voided || (start != nil && tx.Timestamp.Before(*start)) || (end != nil && tx.Timestamp.After(*end)) {
+				continue
+			}
+			if tx.Type == models.Withdrawal {
+				withdrawals.Count++
+				withdrawals.Sum += tx.Amount
+				fees += tx.Fee
+			} else {
+				deposits.Count++
+				deposits.Sum += tx.Amount
+			}
+		}
+		return deposits, withdrawals, fees
+	}
+
+	weekStart, weekEnd := base.AddDate(0, 0, 3), base.AddDate(0, 0, 10).Add(-time.Nanosecond)
+	exact := base.Add(21 * time.Hour)
+	ranges := []struct {
+		name       string
+		start, end *time.Time
+	}{
+		{"whole history", nil, nil},
+		{"a week", &weekStart, &weekEnd},
+		{"open end", &weekStart, nil},
+		{"open start", nil, &weekEnd},
+		{"a single instant", &exact, &exact},
+	}
+	for _, tt := range ranges {
+		t.Run(tt.name, func(t *testing.T) {
+			totals, err := svc.GetTotals("user1", tt.start, tt.end)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			deposits, withdrawals, fees := bruteForce(tt.start, tt.end)
+			if totals.Deposits.Count != deposits.Count || math.Abs(totals.Deposits.Sum-deposits.Sum) > 0.005 {
+				t.Errorf("expected deposits %+v, got %+v", deposits, totals.Deposits)
+			}
+			if totals.Withdrawals.Count != withdrawals.Count || math.Abs(totals.Withdrawals.Sum-withdrawals.Sum) > 0.005 {
+				t.Errorf("expected withdrawals %+v, got %+v", withdrawals, totals.Withdrawals)
+			}
+			if math.Abs(totals.Fees-fees) > 0.005 || math.Abs(totals.Net-(deposits.Sum-withdrawals.Sum-fees)) > 0.005 {
+				t.Errorf("expected fees %v and net %v, got %v and %v", fees, deposits.Sum-withdrawals.Sum-fees, totals.Fees, totals.Net)
+			}
+		})
+	}
+
+	// over the whole history net is the balance, the reversal cancels the reversed withdrawal but not its fee
+	totals, _ := svc.GetTotals("user1", nil, nil)
+	balance, _ := svc.GetCurrentBalance("user1")
+	if totals.Net != balance {
+		t.Errorf("expected net %v to be the balance %v", totals.Net, balance)
+	}
+}
+
+func TestGetTotals_Validation(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	start, end := time.Now(), time.Now().Add(-time.Hour)
+	_, err := svc.GetTotals("user1", &start, &end)
+	assertValidationCode(t, err, "invalid_range")
+
+	totals, err := svc.GetTotals("nobody", nil, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if totals.Deposits != (TypeTotals{}) || totals.Withdrawals != (TypeTotals{}) || totals.Net != 0 {
+		t.Errorf("expected zero totals for an unknown user, got %+v", totals)
+	}
+}
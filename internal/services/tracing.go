@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"tiny-ledger/internal/models"
+)
+
+// tracerName is the instrumentation scope of the service and store spans
+const tracerName = "tiny-ledger/internal/services"
+
+// WithTracerProvider records a span around the traced service methods and their store calls. without it the spans
+// go to a no-op tracer
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(s *ledgerService) {
+		s.tracer = provider.Tracer(tracerName)
+	}
+}
+
+// WithContext returns the service bound to ctx, the spans of its calls become children of the span in ctx and its
+// writes aren't made once ctx is done. the returned service shares everything else with s
+func (s *ledgerService) WithContext(ctx context.Context) LedgerService {
+	bound := *s
+	bound.ctx = ctx
+	return &bound
+}
+
+// startSpan starts the span of a service method, the user ID is hashed so traces don't carry it in the clear
+func (s *ledgerService) startSpan(method, userId string, txType models.TransactionType) (context.Context, trace.Span) {
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	attrs := []attribute.KeyValue{attribute.String("ledger.user_id_hash", hashUserId(userId))}
+	if txType != "" {
+		attrs = append(attrs, attribute.String("ledger.transaction_type", string(txType)))
+	}
+	return s.tracer.Start(ctx, "LedgerService."+method, trace.WithAttributes(attrs...))
+}
+
+// endSpan records the outcome of the call (transactionOutcome for writes, readOutcome for reads), an error sets the
+// span status
+func endSpan(span trace.Span, outcome string, err error) {
+	span.SetAttributes(attribute.String("ledger.outcome", outcome))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// storeSpan starts the span of a store call under the method span in ctx, call the returned func with its error
+func (s *ledgerService) storeSpan(ctx context.Context, operation string) func(error) {
+	_, span := s.tracer.Start(ctx, "LedgerStore."+operation)
+	return func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// readOutcome is the outcome of a span that doesn't record anything
+func readOutcome(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "ok"
+}
+
+// hashUserId is the first 16 hex digits of the SHA-256 of the user ID, enough to follow a user across traces
+func hashUserId(userId string) string {
+	sum := sha256.Sum256([]byte(userId))
+	return hex.EncodeToString(sum[:8])
+}
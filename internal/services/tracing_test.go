@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	defer provider.Shutdown(context.Background())
+	svc := NewLedgerService(store.NewLedgerStore(), WithTracerProvider(provider))
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	if _, err := svc.WithContext(ctx).RecordTransaction("user1", models.Deposit, 10, "salary"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.WithContext(ctx).Transfer("user1", "user2", 50, "rent"); !errors.Is(err, store.ErrInsufficientFunds) {
+		t.Fatalf("expected insufficient funds, got %v", err)
+	}
+	parent.End()
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	record, insert := spans["LedgerService.RecordTransaction"], spans["LedgerStore.InsertTransaction"]
+	if record == nil || insert == nil {
+		t.Fatalf("expected the service and store spans, got %v", spans)
+	}
+	if record.Parent().SpanID() != parent.SpanContext().SpanID() || insert.Parent().SpanID() != record.SpanContext().SpanID() {
+		t.Errorf("expected request > service > store")
+	}
+
+	// the transfer overdraws, its span carries the error
+	transfer := spans["LedgerService.Transfer"]
+	if transfer == nil || transfer.Status().Code != codes.Error {
+		t.Errorf("expected the failed transfer to set the span status, got %v", transfer)
+	}
+
+	// a service without a context starts its own traces
+	if _, err := svc.GetBalanceDetails("user1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, span := range recorder.Ended() {
+		if span.Name() == "LedgerService.GetBalance" && span.Parent().IsValid() {
+			t.Errorf("expected a root span without a context, got parent %v", span.Parent())
+		}
+	}
+}
+
+func TestWithContextCanceled(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	if _, err := svc.RecordTransaction("user1", models.Deposit, 100, "salary"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	canceled := svc.WithContext(ctx)
+
+	if _, err := canceled.RecordTransaction("user1", models.Withdrawal, 10, "rent"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the withdrawal to be canceled, got %v", err)
+	}
+	if _, err := canceled.Transfer("user1", "user2", 10, "lunch"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the transfer to be canceled, got %v", err)
+	}
+	if _, err := canceled.RecordTransactionsBatch("user1", []TransactionInput{{Type: models.Deposit, Amount: 1}}); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the batch to be canceled, got %v", err)
+	}
+
+	// nothing was written, and reads still answer
+	assertBalance(t, canceled, "user1", 100)
+}
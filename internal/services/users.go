@@ -0,0 +1,127 @@
+package services
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/store"
+)
+
+// UserSort is the order of ListUsers, the values are the ones of the sort query parameter
+type UserSort string
+
+const (
+	SortUsersByID      UserSort = "userId"
+	SortUsersByBalance UserSort = "balance" // largest balance first
+)
+
+// UserFilter narrows down ListUsers, an empty Sort orders by user ID
+type UserFilter struct {
+	MinBalance *float64 // inclusive, nil for every user
+	Sort       UserSort
+}
+
+// UserSummary is a user with its balance and activity, LastActivity is nil until the first transaction
+type UserSummary struct {
+	UserID           string
+	Balance          float64
+	TransactionCount int
+	LastActivity     *time.Time
+}
+
+type PaginatedUsers struct {
+	Users      []UserSummary
+	TotalCount int
+	Page       int
+	PageSize   int
+	TotalPages int
+}
+
+// CreateUser registers an account, in strict mode only registered accounts can transact
+func (s *ledgerService) CreateUser(userId string) (err error) {
+	defer func() { s.recordAudit(operationCreateUser, userId, err) }()
+
+	if err := validateUserId(userId); err != nil {
+		return err
+	}
+
+	return s.store.CreateUser(userId)
+}
+
+// ListUsers returns a page of every user of the ledger, it's meant for operators and isn't scoped to a user
+func (s *ledgerService) ListUsers(filter UserFilter, page, pageSize int) (PaginatedUsers, error) {
+	storeFilter := store.UserFilter{MinBalance: filter.MinBalance}
+	switch filter.Sort {
+	case "", SortUsersByID:
+		storeFilter.Sort = store.SortUsersByID
+	case SortUsersByBalance:
+		storeFilter.Sort = store.SortUsersByBalance
+	default:
+		return PaginatedUsers{}, &ValidationError{Field: "sort", Code: "invalid_value", Message: "invalid sort value, use userId or balance"}
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 50
+	}
+
+	result := s.store.ListUsers(storeFilter, page, pageSize)
+	users := make([]UserSummary, 0, len(result.Users))
+	for _, user := range result.Users {
+		users = append(users, UserSummary(user))
+	}
+
+	return PaginatedUsers{
+		Users:      users,
+		TotalCount: result.TotalCount,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: max((result.TotalCount+pageSize-1)/pageSize, 1),
+	}, nil
+}
+
+// DeleteUser removes the user and its transactions and returns the balance it had, a non zero balance is refused
+// with a store.BalanceNotZeroError unless force is set. the ID can be used again afterwards as a new user
+func (s *ledgerService) DeleteUser(userId string, force bool) (_ float64, err error) {
+	defer func() { s.recordAudit(operationDeleteUser, userId, err) }()
+
+	if err := validateUserId(userId); err != nil {
+		return 0, err
+	}
+
+	balance, err := s.store.DeleteUser(userId, force)
+	if err != nil {
+		return 0, err
+	}
+	s.idempotency.forgetUser(userId)
+	return balance, nil
+}
+
+// AnonymizeUser keeps the transactions of the user for accounting under a generated token, scrubbed of descriptions,
+// references and reasons, and frees the user ID like DeleteUser does
+func (s *ledgerService) AnonymizeUser(userId string, force bool) (_ float64, err error) {
+	defer func() { s.recordAudit(operationAnonymizeUser, userId, err) }()
+
+	if err := validateUserId(userId); err != nil {
+		return 0, err
+	}
+
+	balance, err := s.store.AnonymizeUser(userId, "anon-"+uuid.NewString(), force)
+	if err != nil {
+		return 0, err
+	}
+	s.idempotency.forgetUser(userId)
+	return balance, nil
+}
+
+// requireAccount rejects unregistered users when strict accounts are enabled, the permissive default lets the
+// first transaction open the ledger
+func (s *ledgerService) requireAccount(userId string) error {
+	if s.config.Load().StrictAccounts && !s.store.UserExists(userId) {
+		return store.ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestStrictAccounts(t *testing.T) {
+	tests := []struct {
+		name          string
+		strict        bool
+		register      bool
+		expectedError error
+	}{
+		{"Permissive mode opens unknown users", false, false, nil},
+		{"Permissive mode with registered user", false, true, nil},
+		{"Strict mode rejects unknown users", true, false, store.ErrUserNotFound},
+		{"Strict mode with registered user", true, true, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := DefaultConfig()
+			config.StrictAccounts = test.strict
+			svc := NewLedgerService(store.NewLedgerStore(), WithConfig(config))
+
+			userId := "strict_user"
+			if test.register {
+				if err := svc.CreateUser(userId); err != nil {
+					t.Fatalf("failed to create user: %v", err)
+				}
+			}
+
+			if _, err := svc.RecordTransaction(userId, models.Deposit, 100.0, "deposit"); !errors.Is(err, test.expectedError) {
+				t.Errorf("record transaction: expected error %v, got %v", test.expectedError, err)
+			}
+
+			if _, err := svc.GetCurrentBalance(userId); !errors.Is(err, test.expectedError) {
+				t.Errorf("get balance: expected error %v, got %v", test.expectedError, err)
+			}
+
+			if _, err := svc.GetTransactionHistory(userId, HistoryFilter{}, 1, 10); !errors.Is(err, test.expectedError) {
+				t.Errorf("get history: expected error %v, got %v", test.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestStrictAccounts_Transfer(t *testing.T) {
+	config := DefaultConfig()
+	config.StrictAccounts = true
+	svc := NewLedgerService(store.NewLedgerStore(), WithConfig(config))
+
+	if err := svc.CreateUser("alice"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if _, err := svc.RecordTransaction("alice", models.Deposit, 100.0, "funding"); err != nil {
+		t.Fatalf("failed to fund the account: %v", err)
+	}
+
+	if _, err := svc.Transfer("alice", "bobb_typo", 50.0, "rent"); !errors.Is(err, store.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound for an unregistered recipient, got %v", err)
+	}
+
+	balance, _ := svc.GetCurrentBalance("alice")
+	if balance != 100.0 {
+		t.Errorf("expected balance 100.00 after the rejected transfer, got %.2f", balance)
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	if err := svc.CreateUser("new_user"); err != nil {
+		t.Fatalf("expected no error but got: %v", err)
+	}
+
+	if err := svc.CreateUser("new_user"); !errors.Is(err, store.ErrUserExists) {
+		t.Errorf("expected ErrUserExists, got %v", err)
+	}
+
+	if err := svc.CreateUser("a"); err == nil {
+		t.Error("expected an error for an invalid user ID")
+	}
+
+	balance, err := svc.GetCurrentBalance("new_user")
+	if err != nil || balance != 0 {
+		t.Errorf("expected zero balance for a new user, got %.2f (%v)", balance, err)
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	for userId, amount := range map[string]float64{"alice": 10, "bob": 30, "carol": 20} {
+		if _, err := svc.RecordTransaction(userId, models.Deposit, amount, "deposit"); err != nil {
+			t.Fatalf("failed to record a deposit: %v", err)
+		}
+	}
+
+	result, err := svc.ListUsers(UserFilter{Sort: SortUsersByBalance}, 1, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.TotalCount != 3 || result.TotalPages != 2 || len(result.Users) != 2 {
+		t.Fatalf("expected 2 of 3 users on 2 pages, got %+v", result)
+	}
+	if result.Users[0].UserID != "bob" || result.Users[1].UserID != "carol" {
+		t.Errorf("expected bob then carol, got %s and %s", result.Users[0].UserID, result.Users[1].UserID)
+	}
+	if result.Users[0].LastActivity == nil || result.Users[0].TransactionCount != 1 {
+		t.Errorf("expected the activity of bob, got %+v", result.Users[0])
+	}
+
+	_, err = svc.ListUsers(UserFilter{Sort: "name"}, 1, 2)
+	assertValidationCode(t, err, "invalid_value")
+}
+
+func TestDeleteUserForgetsIdempotencyKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		remove func(svc LedgerService, userId string) (float64, error)
+	}{
+		{"Delete", func(svc LedgerService, userId string) (float64, error) { return svc.DeleteUser(userId, true) }},
+		{"Anonymize", func(svc LedgerService, userId string) (float64, error) { return svc.AnonymizeUser(userId, true) }},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := NewLedgerService(store.NewLedgerStore())
+			input := TransactionInput{Type: models.Deposit, Amount: 50}
+			if _, _, err := svc.RecordTransactionIdempotent("leaver", "key-1", input); err != nil {
+				t.Fatalf("failed to record a deposit: %v", err)
+			}
+
+			if _, err := test.remove(svc, "leaver"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// the same key now belongs to a new user
+			input.Amount = 20
+			tx, replayed, err := svc.RecordTransactionIdempotent("leaver", "key-1", input)
+			if err != nil || replayed || tx.Amount != 20 {
+				t.Errorf("expected a new deposit of 20, got %v (replayed %v, error %v)", tx.Amount, replayed, err)
+			}
+			assertBalance(t, svc, "leaver", 20)
+		})
+	}
+
+	_, err := NewLedgerService(store.NewLedgerStore()).DeleteUser("", false)
+	assertValidationCode(t, err, "invalid_user_id")
+}
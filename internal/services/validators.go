@@ -0,0 +1,173 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tiny-ledger/internal/models"
+)
+
+// Validator is a deployment specific rule, validators run after the built-in checks and before the store write
+type Validator interface {
+	ValidateTransaction(ctx context.Context, userId string, input TransactionInput) error
+}
+
+// ValidatorFunc adapts a plain function to the Validator interface
+type ValidatorFunc func(ctx context.Context, userId string, input TransactionInput) error
+
+func (f ValidatorFunc) ValidateTransaction(ctx context.Context, userId string, input TransactionInput) error {
+	return f(ctx, userId, input)
+}
+
+// ValidationError names the rule (Code) and, when it is about a single field, the Field that was rejected. Rule is
+// the generic form of Code (max, enum...) with its parameter in Min, Max or Allowed, so a client can show the limit
+// without parsing Message. it's only set by the checks of a transaction body
+type ValidationError struct {
+	Field   string
+	Code    string
+	Message string
+	Rule    string
+	Min     *float64
+	Max     *float64
+	Allowed []string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// rules of ValidationError.Rule
+const (
+	RulePositive  = "positive"
+	RuleMin       = "min"
+	RuleMax       = "max"
+	RuleEnum      = "enum"
+	RuleMaxLength = "max_length"
+	RuleUTF8      = "utf8"
+)
+
+// ValidationErrors is every rule a request broke, in the order of the fields. errors.As finds its first
+// *ValidationError, so code that only reports one keeps working
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Message
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0].Message, len(e)-1)
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// err is nil without errors and a single error on its own, the list is only returned for two or more
+func (e ValidationErrors) err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	}
+	return e
+}
+
+func limit(v float64) *float64 {
+	return &v
+}
+
+const codeValidationFailed = "validation_failed"
+
+// WithValidators appends validators, they run in the given order and the first error aborts the transaction
+func WithValidators(validators ...Validator) Option {
+	return func(s *ledgerService) {
+		s.validators = append(s.validators, validators...)
+	}
+}
+
+// runValidators returns the first rejection, errors without a code are reported as validation_failed
+func (s *ledgerService) runValidators(ctx context.Context, userId string, input TransactionInput) error {
+	for _, v := range s.validators {
+		err := v.ValidateTransaction(ctx, userId, input)
+		if err == nil {
+			continue
+		}
+
+		var validationErr *ValidationError
+		if !errors.As(err, &validationErr) {
+			return &ValidationError{Code: codeValidationFailed, Message: err.Error()}
+		}
+		return err
+	}
+	return nil
+}
+
+// BusinessHoursValidator only allows withdrawals between StartHour (inclusive) and EndHour (exclusive) local time
+type BusinessHoursValidator struct {
+	StartHour int
+	EndHour   int
+	Location  *time.Location
+	now       func() time.Time
+}
+
+func NewBusinessHoursValidator(startHour, endHour int, location *time.Location) *BusinessHoursValidator {
+	if location == nil {
+		location = time.UTC
+	}
+	return &BusinessHoursValidator{
+		StartHour: startHour,
+		EndHour:   endHour,
+		Location:  location,
+		now:       time.Now,
+	}
+}
+
+func (v *BusinessHoursValidator) ValidateTransaction(_ context.Context, _ string, input TransactionInput) error {
+	if input.Type != models.Withdrawal {
+		return nil
+	}
+
+	hour := v.now().In(v.Location).Hour()
+	if hour < v.StartHour || hour >= v.EndHour {
+		return &ValidationError{
+			Code:    "outside_business_hours",
+			Message: fmt.Sprintf("withdrawals are only allowed between %02d:00 and %02d:00", v.StartHour, v.EndHour),
+		}
+	}
+	return nil
+}
+
+// BlockedWordsValidator rejects transactions whose description contains one of the words, case insensitive
+type BlockedWordsValidator struct {
+	words []string
+}
+
+func NewBlockedWordsValidator(words ...string) *BlockedWordsValidator {
+	v := &BlockedWordsValidator{}
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			v.words = append(v.words, word)
+		}
+	}
+	return v
+}
+
+func (v *BlockedWordsValidator) ValidateTransaction(_ context.Context, _ string, input TransactionInput) error {
+	description := strings.ToLower(input.Description)
+	for _, word := range v.words {
+		if strings.Contains(description, word) {
+			return &ValidationError{
+				Code:    "blocked_description",
+				Message: "description contains a blocked word",
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestBusinessHoursValidator(t *testing.T) {
+	v := NewBusinessHoursValidator(9, 17, time.UTC)
+
+	tests := []struct {
+		name         string
+		now          time.Time
+		txType       models.TransactionType
+		expectedCode string
+	}{
+		{"Withdrawal at opening", time.Date(2024, 3, 4, 9, 0, 0, 0, time.UTC), models.Withdrawal, ""},
+		{"Withdrawal during the day", time.Date(2024, 3, 4, 13, 30, 0, 0, time.UTC), models.Withdrawal, ""},
+		{"Withdrawal at closing", time.Date(2024, 3, 4, 17, 0, 0, 0, time.UTC), models.Withdrawal, "outside_business_hours"},
+		{"Withdrawal at night", time.Date(2024, 3, 4, 2, 0, 0, 0, time.UTC), models.Withdrawal, "outside_business_hours"},
+		{"Deposit at night", time.Date(2024, 3, 4, 2, 0, 0, 0, time.UTC), models.Deposit, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v.now = func() time.Time { return test.now }
+			err := v.ValidateTransaction(context.Background(), "user1", TransactionInput{Type: test.txType, Amount: 10})
+			assertValidationCode(t, err, test.expectedCode)
+		})
+	}
+}
+
+func TestBlockedWordsValidator(t *testing.T) {
+	v := NewBlockedWordsValidator("Sanctioned", " ", "casino")
+
+	tests := []struct {
+		name         string
+		description  string
+		expectedCode string
+	}{
+		{"Clean description", "groceries", ""},
+		{"Empty description", "", ""},
+		{"Blocked word", "payment to casino royale", "blocked_description"},
+		{"Blocked word different case", "SANCTIONED entity", "blocked_description"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := v.ValidateTransaction(context.Background(), "user1", TransactionInput{Type: models.Deposit, Amount: 10, Description: test.description})
+			assertValidationCode(t, err, test.expectedCode)
+		})
+	}
+}
+
+func TestValidators_Composed(t *testing.T) {
+	var calls, rejected atomic.Int64
+	metrics := ValidatorFunc(func(_ context.Context, _ string, _ TransactionInput) error {
+		calls.Add(1)
+		return nil
+	})
+	manualApproval := ValidatorFunc(func(_ context.Context, _ string, input TransactionInput) error {
+		if input.Amount > 500 {
+			rejected.Add(1)
+			return errors.New("amount needs manual approval")
+		}
+		return nil
+	})
+
+	s := store.NewLedgerStore()
+	svc := NewLedgerService(s, WithValidators(metrics, NewBlockedWordsValidator("casino")), WithValidators(manualApproval))
+
+	tests := []struct {
+		name          string
+		amount        float64
+		description   string
+		expectedCode  string
+		expectedCalls int64
+	}{
+		{"Passes all validators", 100, "salary", "", 1},
+		{"Rejected by blocked words", 100, "casino chips", "blocked_description", 2},
+		{"Plain error gets the default code", 600, "bonus", codeValidationFailed, 3},
+		{"Built-in checks run first", -1, "salary", "", 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := svc.RecordTransaction("user1", models.Deposit, test.amount, test.description)
+			if test.amount > 0 {
+				assertValidationCode(t, err, test.expectedCode)
+			} else if err == nil {
+				t.Error("expected the built-in validation to fail")
+			}
+
+			if got := calls.Load(); got != test.expectedCalls {
+				t.Errorf("expected %d validator calls, got %d", test.expectedCalls, got)
+			}
+		})
+	}
+
+	if rejected.Load() != 1 {
+		t.Errorf("expected the last validator to reject once, got %d", rejected.Load())
+	}
+
+	balance, _ := svc.GetCurrentBalance("user1")
+	if balance != 100 {
+		t.Errorf("expected only the accepted deposit to be stored, balance %.2f", balance)
+	}
+}
+
+func TestValidators_Idempotent(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore(), WithValidators(NewBlockedWordsValidator("casino")))
+
+	_, _, err := svc.RecordTransactionIdempotent("user1", "key-1", TransactionInput{Type: models.Deposit, Amount: 10, Description: "casino"})
+	assertValidationCode(t, err, "blocked_description")
+
+	if _, _, err := svc.RecordTransactionIdempotent("user1", "key-1", TransactionInput{Type: models.Deposit, Amount: 10, Description: "salary"}); err != nil {
+		t.Errorf("a rejected request must not consume the idempotency key, got %v", err)
+	}
+}
+
+func TestValidationErrors_Aggregated(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+
+	_, err := svc.RecordTransactionInput("user1", TransactionInput{Type: "bonus", Amount: -1, ReferenceID: strings.Repeat("r", 65)})
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("expected ValidationErrors, got %v", err)
+	}
+	var got []string
+	for _, e := range errs {
+		got = append(got, e.Field+" "+e.Code+" "+e.Rule)
+	}
+	expected := []string{"amount not_positive positive", "type invalid_value enum", "referenceId max_length max_length"}
+	if strings.Join(got, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if *errs[2].Max != 64 || len(errs[1].Allowed) != 2 {
+		t.Errorf("expected the rule parameters, got max %v and allowed %q", *errs[2].Max, errs[1].Allowed)
+	}
+	// the first error is still found on its own
+	assertValidationCode(t, err, "not_positive")
+
+	// a single problem isn't wrapped in a list
+	_, err = svc.RecordTransactionInput("user1", TransactionInput{Type: models.Deposit, Amount: 2000000})
+	if errors.As(err, &errs) {
+		t.Errorf("expected a single error, got the list %v", err)
+	}
+	assertValidationCode(t, err, "max_amount")
+}
+
+func assertValidationCode(t *testing.T, err error, expectedCode string) {
+	t.Helper()
+
+	if expectedCode == "" {
+		if err != nil {
+			t.Errorf("expected no error but got: %v", err)
+		}
+		return
+	}
+
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected a validation error with code %q, got %v", expectedCode, err)
+	}
+	if validationErr.Code != expectedCode {
+		t.Errorf("expected code %q, got %q", expectedCode, validationErr.Code)
+	}
+}
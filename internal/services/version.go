@@ -0,0 +1,49 @@
+package services
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+)
+
+// GetLedgerVersion returns the version of the user's ledger, it changes with every write to it. clients read it to
+// make a later change conditional on nothing having happened in between
+func (s *ledgerService) GetLedgerVersion(userId string) (uint64, error) {
+	if err := validateUserId(userId); err != nil {
+		return 0, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return 0, err
+	}
+
+	return s.store.Version(userId), nil
+}
+
+// GetLastModified is when the user's ledger last changed, a new record, a void, a reversal, an edit or a new minimum
+// balance. zero for a user without any
+func (s *ledgerService) GetLastModified(userId string) (time.Time, error) {
+	if err := validateUserId(userId); err != nil {
+		return time.Time{}, err
+	}
+
+	if err := s.requireAccount(userId); err != nil {
+		return time.Time{}, err
+	}
+
+	return s.store.ModifiedAt(userId), nil
+}
+
+// ReverseTransactionIfVersion is ReverseTransaction only while the ledger is still at version, a
+// *store.VersionMismatchError carries the current version otherwise
+func (s *ledgerService) ReverseTransactionIfVersion(userId string, txID uuid.UUID, reason string, version uint64) (_ models.TransactionRecord, err error) {
+	defer func() { s.recordAudit(operationReverse, userId, err) }()
+
+	if err := s.validateReversal(userId, reason); err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	return s.store.ReverseTransactionIfVersion(userId, txID, reason, version)
+}
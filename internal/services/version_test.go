@@ -0,0 +1,60 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"tiny-ledger/internal/clock/clocktest"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/store"
+)
+
+func TestReverseTransactionIfVersion(t *testing.T) {
+	svc := NewLedgerService(store.NewLedgerStore())
+	deposit, err := svc.RecordTransaction("user1", models.Deposit, 100, "salary")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	version, err := svc.GetLedgerVersion("user1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.RecordTransaction("user1", models.Deposit, 5, "interest"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var mismatch *store.VersionMismatchError
+	if _, err := svc.ReverseTransactionIfVersion("user1", deposit.ID, "refund", version); !errors.As(err, &mismatch) {
+		t.Fatalf("expected a version mismatch after the second deposit, got %v", err)
+	}
+	assertBalance(t, svc, "user1", 105)
+
+	// the reason is validated like an unconditional reversal
+	_, err = svc.ReverseTransactionIfVersion("user1", deposit.ID, string(make([]byte, maxDescriptionLength+1)), mismatch.Current)
+	assertValidationCode(t, err, "max_length")
+
+	if _, err := svc.ReverseTransactionIfVersion("user1", deposit.ID, "refund", mismatch.Current); err != nil {
+		t.Fatalf("expected the reversal at the current version, got %v", err)
+	}
+	assertBalance(t, svc, "user1", 5)
+
+	if _, err := svc.GetLedgerVersion(""); err == nil {
+		t.Errorf("expected an empty user ID to be rejected")
+	}
+}
+
+func TestGetLastModified(t *testing.T) {
+	clock := clocktest.NewFake(clocktest.Start)
+	svc := NewLedgerService(store.NewLedgerStore(store.WithClock(clock)))
+	if modified, err := svc.GetLastModified("user1"); err != nil || !modified.IsZero() {
+		t.Errorf("expected no modification time for a user without records, got %v, %v", modified, err)
+	}
+
+	if _, err := svc.RecordTransaction("user1", models.Deposit, 100, "salary"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if modified, err := svc.GetLastModified("user1"); err != nil || !modified.Equal(clocktest.Start) {
+		t.Errorf("expected the deposit to set the modification time to %v, got %v, %v", clocktest.Start, modified, err)
+	}
+}
@@ -0,0 +1,164 @@
+// Package signing signs and verifies the HMAC-SHA256 request signatures of server-to-server callers, each client with
+// a secret of its own. SignRequest is what a client needs to call a server that verifies them
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ClientHeader    = "X-Client-ID"
+	TimestampHeader = "X-Signature-Timestamp" // unix seconds
+	SignatureHeader = "X-Signature"           // hex HMAC-SHA256
+
+	// DefaultWindow is how far the timestamp of a request may be from the clock of the server, either way
+	DefaultWindow = 5 * time.Minute
+)
+
+var (
+	ErrMissingSignature = errors.New("missing request signature")
+	ErrStaleSignature   = errors.New("signature timestamp outside the window")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// Sign is the hex HMAC-SHA256 of the timestamp, the method, the request URI (the path and its query) and the body,
+// concatenated
+func Sign(secret []byte, timestamp, method, requestURI string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + method + requestURI))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest sets the signature headers of req for the client at now, the body is read and put back so the request
+// can still be sent
+func SignRequest(req *http.Request, clientID string, secret []byte, now time.Time) error {
+	body, err := readBody(req)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set(ClientHeader, clientID)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, req.Method, req.URL.RequestURI(), body))
+	return nil
+}
+
+type Verifier struct {
+	secrets map[string][]byte
+	window  time.Duration
+	now     func() time.Time
+}
+
+type Option func(*Verifier)
+
+// WithClock replaces time.Now, for tests
+func WithClock(now func() time.Time) Option {
+	return func(v *Verifier) {
+		v.now = now
+	}
+}
+
+// WithWindow replaces DefaultWindow
+func WithWindow(window time.Duration) Option {
+	return func(v *Verifier) {
+		v.window = window
+	}
+}
+
+// NewVerifier accepts the requests signed with the secret of their client
+func NewVerifier(secrets map[string][]byte, opts ...Option) (*Verifier, error) {
+	if len(secrets) == 0 {
+		return nil, errors.New("signing: no client secrets")
+	}
+
+	v := &Verifier{secrets: make(map[string][]byte, len(secrets)), window: DefaultWindow, now: time.Now}
+	for client, secret := range secrets {
+		if client == "" || len(secret) == 0 {
+			return nil, fmt.Errorf("signing: empty client ID or secret for %q", client)
+		}
+		v.secrets[client] = append([]byte(nil), secret...)
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	return v, nil
+}
+
+// Verify checks the signature of r and returns its client. the body is buffered and put back so the handler can read
+// it afterwards. an unknown client is an invalid signature, so the answer doesn't tell which clients exist
+func (v *Verifier) Verify(r *http.Request) (string, error) {
+	client, timestamp, signature := r.Header.Get(ClientHeader), r.Header.Get(TimestampHeader), r.Header.Get(SignatureHeader)
+	if client == "" || timestamp == "" || signature == "" {
+		return "", ErrMissingSignature
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	if skew := v.now().Sub(time.Unix(seconds, 0)); skew > v.window || skew < -v.window {
+		return "", ErrStaleSignature
+	}
+
+	body, err := readBody(r)
+	if err != nil {
+		return "", err
+	}
+
+	secret, known := v.secrets[client]
+	if !known {
+		return "", fmt.Errorf("%w: unknown client", ErrInvalidSignature)
+	}
+	given, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return "", fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+	expected, _ := hex.DecodeString(Sign(secret, timestamp, r.Method, r.URL.RequestURI(), body))
+	if !hmac.Equal(given, expected) {
+		return "", ErrInvalidSignature
+	}
+	return client, nil
+}
+
+// ParseSecrets reads a comma separated list of client:secret pairs
+func ParseSecrets(list string) (map[string][]byte, error) {
+	secrets := map[string][]byte{}
+	for _, pair := range strings.Split(list, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		client, secret, found := strings.Cut(pair, ":")
+		if !found || client == "" || secret == "" {
+			return nil, fmt.Errorf("signing: %q isn't a client:secret pair", pair)
+		}
+		secrets[client] = []byte(secret)
+	}
+	return secrets, nil
+}
+
+// readBody reads the whole body and replaces it with a reader over the same bytes
+func readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
@@ -0,0 +1,130 @@
+package signing
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var partnerSecret = []byte("partner-secret")
+
+func newTestVerifier(t *testing.T, now time.Time) *Verifier {
+	t.Helper()
+	v, err := NewVerifier(map[string][]byte{"partner": partnerSecret}, WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	v := newTestVerifier(t, now)
+
+	const body = `{"type":"deposit","amount":10}`
+	tests := []struct {
+		name     string
+		signedAt time.Time
+		tamper   func(r *httptestRequest)
+		expected error
+	}{
+		{"valid", now, nil, nil},
+		{"clock ahead within the window", now.Add(4 * time.Minute), nil, nil},
+		{"stale", now.Add(-6 * time.Minute), nil, ErrStaleSignature},
+		{"from the future", now.Add(6 * time.Minute), nil, ErrStaleSignature},
+		{"tampered body", now, func(r *httptestRequest) { r.body = strings.Replace(body, "10", "1000", 1) }, ErrInvalidSignature},
+		{"tampered path", now, func(r *httptestRequest) { r.target = "/v1/users/mallory/transactions" }, ErrInvalidSignature},
+		{"tampered query", now, func(r *httptestRequest) { r.target += "?dryRun=true" }, ErrInvalidSignature},
+		{"other client", now, func(r *httptestRequest) { r.client = "intruder" }, ErrInvalidSignature},
+		{"missing signature", now, func(r *httptestRequest) { r.signature = "" }, ErrMissingSignature},
+		{"malformed signature", now, func(r *httptestRequest) { r.signature = "not hex" }, ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed := httptest.NewRequest("POST", "/v1/users/alice/transactions", strings.NewReader(body))
+			if err := SignRequest(signed, "partner", partnerSecret, tt.signedAt); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			sent := &httptestRequest{
+				target: "/v1/users/alice/transactions", body: body,
+				client: signed.Header.Get(ClientHeader), timestamp: signed.Header.Get(TimestampHeader), signature: signed.Header.Get(SignatureHeader),
+			}
+			if tt.tamper != nil {
+				tt.tamper(sent)
+			}
+			r := sent.build()
+
+			client, err := v.Verify(r)
+			if !errors.Is(err, tt.expected) {
+				t.Fatalf("expected %v, got %v", tt.expected, err)
+			}
+			if err != nil {
+				return
+			}
+			if client != "partner" {
+				t.Errorf("expected the client partner, got %q", client)
+			}
+			if read, _ := io.ReadAll(r.Body); string(read) != body {
+				t.Errorf("expected the body to be readable after the check, got %q", read)
+			}
+		})
+	}
+}
+
+func TestSignRequestKeepsTheBody(t *testing.T) {
+	r := httptest.NewRequest("POST", "/v1/users/alice/transactions", strings.NewReader("payload"))
+	if err := SignRequest(r, "partner", partnerSecret, time.Now()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if read, _ := io.ReadAll(r.Body); string(read) != "payload" {
+		t.Errorf("expected the body to be put back, got %q", read)
+	}
+
+	// a GET without a body signs the empty body
+	get := httptest.NewRequest("GET", "/v1/users/alice/balance", nil)
+	if err := SignRequest(get, "partner", partnerSecret, time.Unix(1700000000, 0)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if expected := Sign(partnerSecret, "1700000000", "GET", "/v1/users/alice/balance", nil); get.Header.Get(SignatureHeader) != expected {
+		t.Errorf("expected the signature %s, got %s", expected, get.Header.Get(SignatureHeader))
+	}
+}
+
+func TestParseSecrets(t *testing.T) {
+	secrets, err := ParseSecrets(" partner:s3cret, ,other:key:with:colons")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(secrets["partner"]) != "s3cret" || string(secrets["other"]) != "key:with:colons" || len(secrets) != 2 {
+		t.Errorf("unexpected secrets %q", secrets)
+	}
+
+	for _, list := range []string{"partner", ":secret", "partner:"} {
+		if _, err := ParseSecrets(list); err == nil {
+			t.Errorf("expected %q to be rejected", list)
+		}
+	}
+	if _, err := NewVerifier(nil); err == nil {
+		t.Error("expected a verifier without secrets to be rejected")
+	}
+}
+
+// httptestRequest is a signed request as it reaches the server, its parts can be tampered with before it's built
+type httptestRequest struct {
+	target, body                 string
+	client, timestamp, signature string
+}
+
+func (r *httptestRequest) build() *http.Request {
+	req := httptest.NewRequest("POST", r.target, strings.NewReader(r.body))
+	req.Header.Set(ClientHeader, r.client)
+	req.Header.Set(TimestampHeader, r.timestamp)
+	req.Header.Set(SignatureHeader, r.signature)
+	return req
+}
@@ -0,0 +1,84 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrInsufficientFunds   = errors.New("insufficient funds")
+	ErrTransactionNotFound = errors.New("transaction not found")
+	ErrJournalNotFound     = errors.New("journal not found")
+	ErrAlreadyReversed     = errors.New("already reversed")
+	ErrReversalOfReversal  = errors.New("a reversal cannot be reversed")
+	ErrDuplicateReference  = errors.New("a transaction with this reference already exists")
+	ErrAlreadyVoided       = errors.New("transaction is already voided")
+	ErrVoidJournalLeg      = errors.New("journal legs cannot be voided, reverse the journal instead")
+	ErrUnbalancedJournal   = errors.New("the debits of the journal do not equal its credits")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrUserExists          = errors.New("user already exists")
+	ErrPossibleDuplicate   = errors.New("possible duplicate transaction")
+	ErrMinimumBalance      = errors.New("balance would fall below the minimum balance")
+	ErrReverseJournalLeg   = errors.New("journal legs cannot be reversed one by one, reverse the journal instead")
+	ErrIdempotencyKeyTaken = errors.New("idempotency key is already used by a transaction")
+	ErrCursorNotFound      = errors.New("cursor does not match a transaction of the user")
+	ErrBalanceNotZero      = errors.New("the balance of the user is not zero")
+	ErrUserHasJournals     = errors.New("the user has legs in journals, anonymize it instead")
+	ErrVersionMismatch     = errors.New("the ledger changed since the expected version")
+	ErrOutboxEntryNotFound = errors.New("no dead-lettered outbox entry with this id")
+)
+
+// DuplicateError carries the suspected original of a possible duplicate, errors.Is matches ErrPossibleDuplicate
+type DuplicateError struct {
+	OriginalID uuid.UUID
+}
+
+func (e *DuplicateError) Error() string {
+	return fmt.Sprintf("%s of %s", ErrPossibleDuplicate, e.OriginalID)
+}
+
+func (e *DuplicateError) Unwrap() error {
+	return ErrPossibleDuplicate
+}
+
+// BalanceNotZeroError carries the balance of a user that can't be removed, errors.Is matches ErrBalanceNotZero
+type BalanceNotZeroError struct {
+	Balance float64
+}
+
+func (e *BalanceNotZeroError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrBalanceNotZero, e.Balance)
+}
+
+func (e *BalanceNotZeroError) Unwrap() error {
+	return ErrBalanceNotZero
+}
+
+// ItemError is the failure of one transaction of a batch, Index is its position in the batch. errors.Is matches Err
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("transaction %d: %s", e.Index, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// VersionMismatchError carries the current version of a ledger that moved on, errors.Is matches ErrVersionMismatch
+type VersionMismatchError struct {
+	Current uint64
+}
+
+func (e *VersionMismatchError) Error() string {
+	return fmt.Sprintf("%s, it is at version %d", ErrVersionMismatch, e.Current)
+}
+
+func (e *VersionMismatchError) Unwrap() error {
+	return ErrVersionMismatch
+}
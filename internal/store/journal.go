@@ -0,0 +1,275 @@
+package store
+
+import (
+	"math"
+	"sort"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+)
+
+// journalTolerance absorbs the float noise when checking that the legs of a journal sum to zero
+const journalTolerance = 1e-6
+
+type journalLeg struct {
+	userId       string
+	txID         uuid.UUID
+	balanceAfter float64 // kept so a replayed idempotent transfer answers like the original
+}
+
+type journal struct {
+	legs       []journalLeg
+	reversalOf *uuid.UUID
+	reversedBy *uuid.UUID
+}
+
+// Transfer moves the amount between two users as a balanced pair of entries sharing the same journal id
+func (s *LedgerStore) Transfer(fromUserId, toUserId string, amount float64, description string) (models.Journal, error) {
+	return s.PostJournal([]models.JournalLeg{
+		{UserID: fromUserId, Direction: models.Debit, Amount: amount, Description: description},
+		{UserID: toUserId, Direction: models.Credit, Amount: amount, Description: description},
+	})
+}
+
+// TransferIdempotent is Transfer once per (fromUserId, key). the key is recorded on the debit leg, so it shares the
+// sender's idempotency keys with single transactions; a retry gets the original journal back with replayed set.
+// a key already taken by a single transaction returns ErrIdempotencyKeyTaken
+func (s *LedgerStore) TransferIdempotent(fromUserId, toUserId string, amount float64, description, key string) (models.Journal, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if ledger, exists := s.users[fromUserId]; exists {
+		if txID, exists := ledger.byIdemKey[key]; exists {
+			idx, found := ledger.find(txID)
+			if !found {
+				return models.Journal{}, false, ErrTransactionNotFound
+			}
+			journalID := ledger.transactions[idx].JournalID
+			if journalID == nil {
+				return models.Journal{}, false, ErrIdempotencyKeyTaken
+			}
+			j := s.journals[*journalID]
+			entries := s.journalEntries(j)
+			for i := range entries {
+				for _, leg := range j.legs {
+					if leg.txID == entries[i].Transaction.ID {
+						balance := leg.balanceAfter
+						entries[i].BalanceAfter = &balance
+					}
+				}
+			}
+			return j.toModel(*journalID, entries), true, nil
+		}
+	}
+
+	j, err := s.postJournal([]models.JournalLeg{
+		{UserID: fromUserId, Direction: models.Debit, Amount: amount, Description: description},
+		{UserID: toUserId, Direction: models.Credit, Amount: amount, Description: description},
+	}, key)
+	return j, false, err
+}
+
+// PostJournal applies all the legs atomically or none of them, legs whose sum doesn't settle to exactly zero are
+// refused with ErrUnbalancedJournal. a single store lock covers all the users, so concurrent journals can't deadlock
+// nor observe a partially applied journal. the users are checked in sorted order only so that a journal two of them
+// can't afford always reports the same one
+func (s *LedgerStore) PostJournal(legs []models.JournalLeg) (models.Journal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.postJournal(legs, "")
+}
+
+// postJournal records idempotencyKey on the first debit leg, the caller must hold the write lock
+func (s *LedgerStore) postJournal(legs []models.JournalLeg, idempotencyKey string) (models.Journal, error) {
+	journalID := uuid.New()
+	now := s.clock.Now()
+	net := make(map[string]float64)
+	entries := make([]models.JournalEntry, 0, len(legs))
+	sum := 0.0
+
+	for _, leg := range legs {
+		tx := models.NewTransactionRecord(leg.TransactionType(), leg.Amount, leg.Description, now)
+		tx.Timestamp = now
+		tx.JournalID = &journalID
+		if idempotencyKey != "" && leg.Direction == models.Debit {
+			tx.IdempotencyKey = idempotencyKey
+			idempotencyKey = ""
+		}
+
+		net[leg.UserID] = Settle(net[leg.UserID] + signedAmount(tx))
+		sum = Settle(sum + signedAmount(tx))
+		entries = append(entries, models.JournalEntry{UserID: leg.UserID, Transaction: tx})
+	}
+	if sum != 0 {
+		return models.Journal{}, ErrUnbalancedJournal
+	}
+
+	if err := s.checkFunds(net); err != nil {
+		return models.Journal{}, err
+	}
+
+	j := s.commitJournal(journalID, entries)
+	return j.toModel(journalID, entries), nil
+}
+
+func (s *LedgerStore) GetJournal(journalID uuid.UUID) (models.Journal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	j, exists := s.journals[journalID]
+	if !exists {
+		return models.Journal{}, ErrJournalNotFound
+	}
+	return j.toModel(journalID, s.journalEntries(j)), nil
+}
+
+// ReverseJournal posts the opposite of every leg of the journal under a new journal, all or nothing.
+// it fails when any user can't afford giving the money back (e.g. the recipient of a transfer already spent it)
+func (s *LedgerStore) ReverseJournal(journalID uuid.UUID) (models.Journal, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	original, exists := s.journals[journalID]
+	if !exists {
+		return models.Journal{}, ErrJournalNotFound
+	}
+	if original.reversedBy != nil {
+		return models.Journal{}, ErrAlreadyReversed
+	}
+	if original.reversalOf != nil {
+		return models.Journal{}, ErrReversalOfReversal
+	}
+
+	reversalID := uuid.New()
+	now := s.clock.Now()
+	net := make(map[string]float64)
+	entries := make([]models.JournalEntry, 0, len(original.legs))
+
+	for _, entry := range s.journalEntries(original) {
+		originalID := entry.Transaction.ID
+		tx := models.NewTransactionRecord(oppositeType(entry.Transaction.Type), entry.Transaction.Amount, "reversal: "+entry.Transaction.Description, now)
+		tx.Timestamp = now
+		tx.JournalID = &reversalID
+		tx.ReversalOf = &originalID
+
+		net[entry.UserID] = Settle(net[entry.UserID] + signedAmount(tx))
+		entries = append(entries, models.JournalEntry{UserID: entry.UserID, Transaction: tx})
+	}
+
+	if err := s.checkFunds(net); err != nil {
+		return models.Journal{}, err
+	}
+
+	j := s.commitJournal(reversalID, entries)
+	j.reversalOf = &journalID
+	original.reversedBy = &reversalID
+
+	for _, entry := range entries {
+		ledger := s.users[entry.UserID]
+		if idx, found := ledger.find(*entry.Transaction.ReversalOf); found {
+			reversedBy := entry.Transaction.ID
+			ledger.transactions[idx].ReversedBy = &reversedBy
+		}
+	}
+
+	return j.toModel(reversalID, entries), nil
+}
+
+// UnbalancedJournals returns the ids of the journals whose legs don't sum to zero, an empty result means the
+// double-entry invariant holds across the system
+func (s *LedgerStore) UnbalancedJournals() []uuid.UUID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var unbalanced []uuid.UUID
+	for id, j := range s.journals {
+		sum := 0.0
+		for _, entry := range s.journalEntries(j) {
+			sum += signedAmount(entry.Transaction)
+		}
+		if len(j.legs) == 0 || math.Abs(sum) > journalTolerance {
+			unbalanced = append(unbalanced, id)
+		}
+	}
+
+	sort.Slice(unbalanced, func(i, j int) bool {
+		return unbalanced[i].String() < unbalanced[j].String()
+	})
+	return unbalanced
+}
+
+// checkFunds verifies that every user can afford its net change, the first one that can't in sorted order is the one
+// reported. the caller must hold the lock
+func (s *LedgerStore) checkFunds(net map[string]float64) error {
+	userIds := make([]string, 0, len(net))
+	for userId := range net {
+		userIds = append(userIds, userId)
+	}
+	sort.Strings(userIds)
+
+	for _, userId := range userIds {
+		change := net[userId]
+		if change >= 0 {
+			continue
+		}
+		ledger, exists := s.users[userId]
+		if !exists {
+			return ErrInsufficientFunds
+		}
+		if err := ledger.canDebit(-change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitJournal applies already validated legs, fills in the balance after each of them and registers the
+// journal, the caller must hold the write lock
+func (s *LedgerStore) commitJournal(journalID uuid.UUID, entries []models.JournalEntry) *journal {
+	j := &journal{legs: make([]journalLeg, 0, len(entries))}
+	for i, entry := range entries {
+		ledger := s.ledgerFor(entry.UserID)
+		ledger.apply(entry.Transaction)
+		ledger.insert(entry.Transaction)
+		s.committed(entry.UserID, entry.Transaction)
+
+		balance := ledger.balance
+		entries[i].BalanceAfter = &balance
+		j.legs = append(j.legs, journalLeg{userId: entry.UserID, txID: entry.Transaction.ID, balanceAfter: balance})
+	}
+	s.journals[journalID] = j
+	return j
+}
+
+// journalEntries resolves the current state of the legs, the caller must hold the lock
+func (s *LedgerStore) journalEntries(j *journal) []models.JournalEntry {
+	entries := make([]models.JournalEntry, 0, len(j.legs))
+	for _, leg := range j.legs {
+		ledger, exists := s.users[leg.userId]
+		if !exists {
+			continue
+		}
+		if idx, found := ledger.find(leg.txID); found {
+			entries = append(entries, models.JournalEntry{UserID: leg.userId, Transaction: ledger.transactions[idx]})
+		}
+	}
+	return entries
+}
+
+func (j *journal) toModel(journalID uuid.UUID, entries []models.JournalEntry) models.Journal {
+	return models.Journal{
+		ID:         journalID,
+		Entries:    entries,
+		ReversalOf: j.reversalOf,
+		ReversedBy: j.reversedBy,
+	}
+}
+
+func oppositeType(txType models.TransactionType) models.TransactionType {
+	if txType == models.Withdrawal {
+		return models.Deposit
+	}
+	return models.Withdrawal
+}
@@ -0,0 +1,86 @@
+package store
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+)
+
+// Cursor is the position of a record in the (timestamp, insertion order) ordering of a user's history, the id
+// tells apart the records sharing a timestamp
+type Cursor struct {
+	Timestamp time.Time
+	ID        uuid.UUID
+}
+
+// KeysetPage is one page of a keyset walk, HasMore tells whether more matching records follow the last one
+type KeysetPage struct {
+	Transactions []models.TransactionRecord
+	HasMore      bool
+}
+
+// GetTransactionsAfter returns up to limit records matching the filter that come after the cursor, a nil cursor
+// starts at the oldest record (the newest one when the filter is descending). positions are resolved by timestamp and
+// id rather than by index, so records inserted between two calls never shift a walk into duplicates or gaps.
+// a cursor that doesn't match a record of the user returns ErrCursorNotFound
+func (s *LedgerStore) GetTransactionsAfter(userId string, filter TransactionFilter, after *Cursor, limit int) (KeysetPage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := KeysetPage{Transactions: []models.TransactionRecord{}}
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		if after != nil {
+			return KeysetPage{}, ErrCursorNotFound
+		}
+		return result, nil
+	}
+
+	startIdx, endIdx := ledger.timeRange(filter.StartTime, filter.EndTime)
+
+	step, pos := 1, startIdx
+	if filter.Descending {
+		step, pos = -1, endIdx-1
+	}
+	if after != nil {
+		idx, found := ledger.seek(*after)
+		if !found {
+			return KeysetPage{}, ErrCursorNotFound
+		}
+		if next := idx + step; filter.Descending {
+			pos = min(next, endIdx-1)
+		} else {
+			pos = max(next, startIdx)
+		}
+	}
+
+	for ; pos >= startIdx && pos < endIdx; pos += step {
+		tx := ledger.transactions[pos]
+		if !filter.matches(tx) {
+			continue
+		}
+		if len(result.Transactions) == limit {
+			result.HasMore = true
+			break
+		}
+		result.Transactions = append(result.Transactions, tx)
+	}
+	return result, nil
+}
+
+// seek returns the position of the record the cursor points at, the caller must hold the lock
+func (l *userLedger) seek(c Cursor) (int, bool) {
+	n := len(l.transactions)
+	for i := sort.Search(n, func(i int) bool {
+		return !l.transactions[i].Timestamp.Before(c.Timestamp)
+	}); i < n && l.transactions[i].Timestamp.Equal(c.Timestamp); i++ {
+		if l.transactions[i].ID == c.ID {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+)
+
+// OutboxEntry is a new record waiting for its delivery to the sinks of the outbox dispatcher
+type OutboxEntry struct {
+	ID          uint64                   `json:"id"`      // the commit order
+	EventID     uuid.UUID                `json:"eventId"` // the same on every attempt so the receivers can drop duplicates
+	UserID      string                   `json:"userId"`
+	Transaction models.TransactionRecord `json:"transaction"`
+	Balance     float64                  `json:"balance"` // of the user right after the record
+	CreatedAt   time.Time                `json:"createdAt"`
+
+	Attempts     int       `json:"attempts"`
+	LastError    string    `json:"lastError,omitempty"`
+	NextAttempt  time.Time `json:"nextAttempt"`
+	DeadLettered bool      `json:"deadLettered"` // out of attempts, waits for a requeue
+}
+
+// OutboxStats is the depth of the outbox
+type OutboxStats struct {
+	Pending      int `json:"pending"`
+	DeadLettered int `json:"deadLettered"`
+}
+
+// outbox holds the entries in commit order. the entries are appended under the write lock of the store with the
+// record itself, a record is never committed without its entry. its own lock keeps the dispatcher off the store's
+type outbox struct {
+	mu      sync.Mutex
+	entries []OutboxEntry
+	nextID  uint64
+}
+
+// WithOutbox keeps an outbox entry of every new record until the outbox dispatcher marks it delivered. the memory
+// store loses it with the records when the process exits, a persistent store keeps both in the same write
+func WithOutbox() Option {
+	return func(s *LedgerStore) {
+		s.outbox = &outbox{}
+	}
+}
+
+// append adds the entry of a new record, the caller must hold the write lock of the store
+func (o *outbox) append(userId string, tx models.TransactionRecord, balance float64, now time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.nextID++
+	o.entries = append(o.entries, OutboxEntry{
+		ID:          o.nextID,
+		EventID:     uuid.New(),
+		UserID:      userId,
+		Transaction: tx,
+		Balance:     balance,
+		CreatedAt:   now,
+		NextAttempt: now,
+	})
+}
+
+// OutboxPending returns up to limit entries due at now, oldest first. an entry waiting for its retry holds back the
+// later entries of its user so they're delivered in order, a dead-lettered one doesn't. nil without an outbox
+func (s *LedgerStore) OutboxPending(now time.Time, limit int) []OutboxEntry {
+	if s.outbox == nil {
+		return nil
+	}
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+
+	var due []OutboxEntry
+	waiting := make(map[string]bool)
+	for _, entry := range s.outbox.entries {
+		if len(due) == limit {
+			break
+		}
+		switch {
+		case entry.DeadLettered:
+		case waiting[entry.UserID] || entry.NextAttempt.After(now):
+			waiting[entry.UserID] = true
+		default:
+			due = append(due, entry)
+		}
+	}
+	return due
+}
+
+// OutboxDelivered removes the entries, they've reached every sink
+func (s *LedgerStore) OutboxDelivered(ids ...uint64) {
+	if s.outbox == nil {
+		return
+	}
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+	s.outbox.entries = slices.DeleteFunc(s.outbox.entries, func(entry OutboxEntry) bool { return slices.Contains(ids, entry.ID) })
+}
+
+// OutboxFailed records a failed attempt of the entry: it's due again at next, or dead-lettered when deadLetter is set
+func (s *LedgerStore) OutboxFailed(id uint64, reason string, next time.Time, deadLetter bool) {
+	if s.outbox == nil {
+		return
+	}
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+	for i, entry := range s.outbox.entries {
+		if entry.ID == id {
+			s.outbox.entries[i].Attempts++
+			s.outbox.entries[i].LastError = reason
+			s.outbox.entries[i].NextAttempt = next
+			s.outbox.entries[i].DeadLettered = deadLetter
+			return
+		}
+	}
+}
+
+// OutboxDeadLetters are the dead-lettered entries, oldest first
+func (s *LedgerStore) OutboxDeadLetters() []OutboxEntry {
+	if s.outbox == nil {
+		return nil
+	}
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+	var dead []OutboxEntry
+	for _, entry := range s.outbox.entries {
+		if entry.DeadLettered {
+			dead = append(dead, entry)
+		}
+	}
+	return dead
+}
+
+// RequeueOutbox makes a dead-lettered entry due at now with a new set of attempts
+func (s *LedgerStore) RequeueOutbox(id uint64, now time.Time) (OutboxEntry, error) {
+	if s.outbox == nil {
+		return OutboxEntry{}, ErrOutboxEntryNotFound
+	}
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+	for i, entry := range s.outbox.entries {
+		if entry.ID == id && entry.DeadLettered {
+			s.outbox.entries[i].Attempts, s.outbox.entries[i].NextAttempt, s.outbox.entries[i].DeadLettered = 0, now, false
+			return s.outbox.entries[i], nil
+		}
+	}
+	return OutboxEntry{}, ErrOutboxEntryNotFound
+}
+
+// OutboxStats is the depth of the outbox, zero without one
+func (s *LedgerStore) OutboxStats() OutboxStats {
+	var stats OutboxStats
+	if s.outbox == nil {
+		return stats
+	}
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+	for _, entry := range s.outbox.entries {
+		if entry.DeadLettered {
+			stats.DeadLettered++
+		} else {
+			stats.Pending++
+		}
+	}
+	return stats
+}
@@ -43,7 +43,7 @@ func (s *LedgerStoreV2) AddTransactionV2(userId string, txType models.Transactio
 		return models.TransactionRecord{}, errors.New("insufficient funds")
 	}
 
-	tx := models.NewTransactionRecord(txType, amount, description)
+	tx := models.NewTransactionRecord(txType, amount, description, time.Now())
 
 	if txType == models.Deposit {
 		ledger.balance += amount
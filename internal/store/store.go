@@ -1,17 +1,93 @@
 package store
 
 import (
-	"errors"
+	"cmp"
+	"math"
+	"slices"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/clock"
 	"tiny-ledger/internal/models"
 )
 
 type userLedger struct {
 	transactions []models.TransactionRecord
-	balance      float64 // based on float is not accurate it's better not to float!!
+	byID         map[uuid.UUID]time.Time // transaction id -> timestamp, the timestamp leads to the position with a binary search
+	byRef        map[string]uuid.UUID    // external reference -> transaction id
+	byIdemKey    map[string]uuid.UUID    // idempotency key -> transaction id
+	balance      float64                 // based on float is not accurate it's better not to float!!
+	minBalance   float64                 // floor that withdrawals and transfers out can't cross, zero by default
+	version      uint64                  // bumped by every change of the records or the floor, see Version
+	modifiedAt   time.Time               // when version was last bumped
+	clock        clock.Clock             // of the store
+
+	// incremental aggregates so system wide totals don't need to walk the transactions, voided records are excluded
+	totalDeposits    float64
+	totalWithdrawals float64
+	totalFees        float64
+	depositCount     int
+	withdrawalCount  int
+	voidedCount      int
+}
+
+type SystemTotals struct {
+	TotalBalance     float64
+	TotalDeposits    float64
+	TotalWithdrawals float64
+	TotalFees        float64
+	UserCount        int
+	TransactionCount int
+}
+
+// AccountTotals are the aggregates of a single user, voided records are excluded. the activity times cover every
+// record and are nil without any
+type AccountTotals struct {
+	Balance          float64
+	TotalDeposits    float64
+	TotalWithdrawals float64
+	TotalFees        float64
+	TransactionCount int
+	DepositCount     int
+	WithdrawalCount  int
+	VoidedCount      int
+	FirstActivity    *time.Time
+	LastActivity     *time.Time
+}
+
+// TransactionFilter narrows down the transactions of a user, nil times are open ended
+type TransactionFilter struct {
+	StartTime     *time.Time
+	EndTime       *time.Time
+	ExcludeVoided bool
+	Type          *models.TransactionType // nil for every type
+	MinAmount     *float64                // inclusive, nil for no bound
+	MaxAmount     *float64                // inclusive, nil for no bound
+	Query         string                  // matched case-insensitively within the description, empty for every record
+	Descending    bool                    // newest first
+}
+
+// matches checks the non-time conditions of the filter, time is handled by the sorted range
+func (f TransactionFilter) matches(tx models.TransactionRecord) bool {
+	if f.ExcludeVoided && tx.Voided {
+		return false
+	}
+	if f.Type != nil && tx.Type != *f.Type {
+		return false
+	}
+	if (f.MinAmount != nil && tx.Amount < *f.MinAmount) || (f.MaxAmount != nil && tx.Amount > *f.MaxAmount) {
+		return false
+	}
+	return f.Query == "" || strings.Contains(strings.ToLower(tx.Description), strings.ToLower(f.Query))
+}
+
+// selective tells whether the filter has conditions besides time, a page of a time range alone is a plain slice
+func (f TransactionFilter) selective() bool {
+	return f.ExcludeVoided || f.Type != nil || f.MinAmount != nil || f.MaxAmount != nil || f.Query != ""
 }
 
 type PaginatedTransactions struct {
@@ -19,72 +95,141 @@ type PaginatedTransactions struct {
 	TotalCount   int
 }
 
+// CommitHook is called for every new record with the balance of the user right after it, under the write lock so
+// the calls for a user follow the commit order. it must not block or call back into the store
+type CommitHook func(userId string, tx models.TransactionRecord, balance float64)
+
 type LedgerStore struct {
-	mu    sync.RWMutex           // for concurrent hashmap and thread-safety
-	users map[string]*userLedger //sync.Map is the alternative but limit the lock control and prefer to use lock manually
+	mu       sync.RWMutex           // for concurrent hashmap and thread-safety
+	users    map[string]*userLedger //sync.Map is the alternative but limit the lock control and prefer to use lock manually
+	journals map[uuid.UUID]*journal
+	onCommit CommitHook
+	outbox   *outbox // nil without WithOutbox
+	clock    clock.Clock
 }
 
-func NewLedgerStore() *LedgerStore {
-	return &LedgerStore{
-		users: make(map[string]*userLedger),
+type Option func(*LedgerStore)
+
+// WithClock replaces the wall clock the records, edits, voids and journals are stamped with
+func WithClock(c clock.Clock) Option {
+	return func(s *LedgerStore) {
+		s.clock = c
+	}
+}
+
+func NewLedgerStore(opts ...Option) *LedgerStore {
+	s := &LedgerStore{
+		users:    make(map[string]*userLedger),
+		journals: make(map[uuid.UUID]*journal),
+		clock:    clock.Real,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
+}
+
+// Clock is the time source of the store, the service stamps the records it prepares with it too
+func (s *LedgerStore) Clock() clock.Clock {
+	return s.clock
 }
 
 func (s *LedgerStore) AddTransaction(userId string, txType models.TransactionType, amount float64, description string) (models.TransactionRecord, error) {
 	s.mu.Lock() // Lock for writing
 	defer s.mu.Unlock()
 
-	ledger, exists := s.users[userId]
-	if !exists {
-		ledger = &userLedger{}
-		s.users[userId] = ledger
+	tx := models.NewTransactionRecord(txType, amount, description, s.clock.Now())
+	if err := s.ledgerFor(userId).add(tx); err != nil {
+		return models.TransactionRecord{}, err
 	}
+	s.committed(userId, tx)
+	return tx, nil
+}
+
+// InsertTransaction adds a transaction prepared by the caller (e.g. carrying a reference id)
+func (s *LedgerStore) InsertTransaction(userId string, tx models.TransactionRecord) (models.TransactionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if txType == models.Withdrawal && ledger.balance < amount {
-		return models.TransactionRecord{}, errors.New("insufficient funds")
+	if err := s.ledgerFor(userId).add(tx); err != nil {
+		return models.TransactionRecord{}, err
 	}
+	s.committed(userId, tx)
+	return tx, nil
+}
 
-	tx := models.NewTransactionRecord(txType, amount, description)
+// InsertTransactionUnlessDuplicate adds the transaction unless the user has a non voided record with the same type,
+// amount and description within window before it. the check and the insert happen under the same lock, so of two
+// simultaneous identical requests exactly one gets a *DuplicateError
+func (s *LedgerStore) InsertTransactionUnlessDuplicate(userId string, tx models.TransactionRecord, window time.Duration) (models.TransactionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if txType == models.Deposit {
-		ledger.balance += amount
-	} else {
-		ledger.balance -= amount
+	ledger := s.ledgerFor(userId)
+	if original, found := ledger.recentDuplicate(tx, window); found {
+		return models.TransactionRecord{}, &DuplicateError{OriginalID: original}
 	}
 
-	ledger.transactions = append(ledger.transactions, tx)
-	// sort when inserting help optimize get transaction history between 2 dates based on the current structure
-	sort.SliceStable(ledger.transactions, func(i, j int) bool {
-		return ledger.transactions[i].Timestamp.Before(ledger.transactions[j].Timestamp)
-	})
-
+	if err := ledger.add(tx); err != nil {
+		return models.TransactionRecord{}, err
+	}
+	s.committed(userId, tx)
 	return tx, nil
 }
 
-// AddTransactionWithTime add transaction with specific time just for test purpose
-func (s *LedgerStore) AddTransactionWithTime(userId string, tx models.TransactionRecord) {
+// InsertTransactions adds a batch in order, all or nothing: every transaction is checked against the balance the
+// ones before it leave and against the references of the batch, the first that fails is returned as an *ItemError
+// and nothing is applied
+func (s *LedgerStore) InsertTransactions(userId string, txs []models.TransactionRecord) ([]models.TransactionRecord, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	ledger, exists := s.users[userId]
-	if !exists {
-		ledger = &userLedger{}
-		s.users[userId] = ledger
+	ledger := s.ledgerFor(userId)
+	balance := ledger.balance
+	refs := make(map[string]bool)
+	for i, tx := range txs {
+		switch tx.Type {
+		case models.Withdrawal:
+			if err := ledger.canDebitFrom(balance, tx.Amount+tx.Fee); err != nil {
+				return nil, &ItemError{Index: i, Err: err}
+			}
+			balance = Settle(balance - tx.Amount - tx.Fee)
+		case models.Deposit:
+			balance = Settle(balance + tx.Amount)
+		}
+
+		if tx.ReferenceID != "" {
+			if _, exists := ledger.byRef[tx.ReferenceID]; exists || refs[tx.ReferenceID] {
+				return nil, &ItemError{Index: i, Err: ErrDuplicateReference}
+			}
+			refs[tx.ReferenceID] = true
+		}
 	}
 
-	if tx.Type == models.Deposit {
-		ledger.balance += tx.Amount
-	} else if tx.Type == models.Withdrawal {
-		ledger.balance -= tx.Amount
+	for _, tx := range txs {
+		ledger.apply(tx)
+		ledger.insert(tx)
+		s.committed(userId, tx)
 	}
+	return txs, nil
+}
 
-	ledger.transactions = append(ledger.transactions, tx)
-	sort.SliceStable(ledger.transactions, func(i, j int) bool {
-		return ledger.transactions[i].Timestamp.Before(ledger.transactions[j].Timestamp)
-	})
+// AddTransactionWithTime add transaction with specific time just for test purpose
+func (s *LedgerStore) AddTransactionWithTime(userId string, tx models.TransactionRecord) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger := s.ledgerFor(userId)
+	ledger.apply(tx)
+	ledger.insert(tx)
+	s.committed(userId, tx)
 }
 
 func (s *LedgerStore) GetPaginatedTransactions(userId string, startTime, endTime *time.Time, page, pageSize int) PaginatedTransactions {
+	return s.GetFilteredTransactions(userId, TransactionFilter{StartTime: startTime, EndTime: endTime}, page, pageSize)
+}
+
+func (s *LedgerStore) GetFilteredTransactions(userId string, filter TransactionFilter, page, pageSize int) PaginatedTransactions {
 	s.mu.RLock() // RLock for reading
 	defer s.mu.RUnlock()
 
@@ -96,34 +241,27 @@ func (s *LedgerStore) GetPaginatedTransactions(userId string, startTime, endTime
 		}
 	}
 
-	n := len(ledger.transactions)
+	startIdx, endIdx := ledger.timeRange(filter.StartTime, filter.EndTime)
 
-	//  first of all: apply time filterings that start index ≥ startTime
-	startIdx := 0
-	if startTime != nil {
-		startIdx = sort.Search(n, func(i int) bool {
-			return !ledger.transactions[i].Timestamp.Before(*startTime)
-		})
+	if page < 1 {
+		page = 1
 	}
 
-	// end index > endTime
-	endIdx := n
-	if endTime != nil {
-		endIdx = sort.Search(n, func(i int) bool {
-			return ledger.transactions[i].Timestamp.After(*endTime)
-		})
+	if filter.selective() {
+		return ledger.filteredPage(startIdx, endIdx, filter, page, pageSize)
 	}
 
 	filteredCount := endIdx - startIdx
 
-	if page < 1 {
-		page = 1
-	}
-
 	pageStartIdx := startIdx + (page-1)*pageSize
 	pageEndIdx := pageStartIdx + pageSize
+	if filter.Descending {
+		// pages are counted from the newest record
+		pageStartIdx, pageEndIdx = endIdx-(page-1)*pageSize-pageSize, endIdx-(page-1)*pageSize
+		pageStartIdx = max(pageStartIdx, startIdx)
+	}
 
-	if pageStartIdx >= endIdx {
+	if pageStartIdx >= endIdx || pageEndIdx <= startIdx {
 		return PaginatedTransactions{
 			Transactions: []models.TransactionRecord{},
 			TotalCount:   filteredCount,
@@ -137,6 +275,9 @@ func (s *LedgerStore) GetPaginatedTransactions(userId string, startTime, endTime
 	// deep copy of the subset for thread safety
 	pageTransactions := make([]models.TransactionRecord, pageEndIdx-pageStartIdx)
 	copy(pageTransactions, ledger.transactions[pageStartIdx:pageEndIdx])
+	if filter.Descending {
+		slices.Reverse(pageTransactions)
+	}
 
 	return PaginatedTransactions{
 		Transactions: pageTransactions,
@@ -144,6 +285,259 @@ func (s *LedgerStore) GetPaginatedTransactions(userId string, startTime, endTime
 	}
 }
 
+// CountTransactions counts the transactions matching the filter without copying them, a time range alone is two
+// binary searches
+func (s *LedgerStore) CountTransactions(userId string, filter TransactionFilter) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return 0
+	}
+
+	startIdx, endIdx := ledger.timeRange(filter.StartTime, filter.EndTime)
+	if !filter.selective() {
+		return endIdx - startIdx
+	}
+
+	count := 0
+	for _, tx := range ledger.transactions[startIdx:endIdx] {
+		if filter.matches(tx) {
+			count++
+		}
+	}
+	return count
+}
+
+// GetTransactionsInRange returns a copy of all the user transactions between startTime and endTime (both inclusive)
+func (s *LedgerStore) GetTransactionsInRange(userId string, startTime, endTime *time.Time) []models.TransactionRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return []models.TransactionRecord{}
+	}
+
+	startIdx, endIdx := ledger.timeRange(startTime, endTime)
+	transactions := make([]models.TransactionRecord, endIdx-startIdx)
+	copy(transactions, ledger.transactions[startIdx:endIdx])
+	return transactions
+}
+
+// ScanTransactions calls fn for each transaction of the user between startTime and endTime (both inclusive) in time
+// order without copying the history, fn runs under the read lock so it must not call back into the store. returning
+// false stops the scan
+func (s *LedgerStore) ScanTransactions(userId string, startTime, endTime *time.Time, fn func(tx models.TransactionRecord) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return
+	}
+
+	startIdx, endIdx := ledger.timeRange(startTime, endTime)
+	for _, tx := range ledger.transactions[startIdx:endIdx] {
+		if !fn(tx) {
+			return
+		}
+	}
+}
+
+// VoidTransaction flags the transaction as voided and removes its effect from the balance, the record stays visible.
+// voiding a deposit that was already spent is refused like a withdrawal of it would be, it may overdraw the account
+// or take it below its minimum balance. a reversed transaction and a reversal can't be voided
+func (s *LedgerStore) VoidTransaction(userId string, txID uuid.UUID, reason string) (models.TransactionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+
+	idx, found := ledger.find(txID)
+	if !found {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+
+	tx := &ledger.transactions[idx]
+	if tx.Voided {
+		return models.TransactionRecord{}, ErrAlreadyVoided
+	}
+	if tx.JournalID != nil {
+		return models.TransactionRecord{}, ErrVoidJournalLeg
+	}
+	// the reversal already undid the original, voiding either of them would undo it a second time
+	if tx.ReversedBy != nil {
+		return models.TransactionRecord{}, ErrAlreadyReversed
+	}
+	if tx.ReversalOf != nil {
+		return models.TransactionRecord{}, ErrReversalOfReversal
+	}
+	if tx.Type == models.Deposit {
+		if err := ledger.canDebit(tx.Amount); err != nil {
+			return models.TransactionRecord{}, err
+		}
+	}
+
+	ledger.unapply(*tx)
+
+	now := s.clock.Now()
+	tx.Voided = true
+	tx.VoidedAt = &now
+	tx.VoidReason = reason
+	ledger.voidedCount++
+
+	return *tx, nil
+}
+
+// ReverseTransaction posts the opposite of a single transaction and links both records. the fee of a reversed
+// withdrawal is kept, void the withdrawal to cancel it entirely
+func (s *LedgerStore) ReverseTransaction(userId string, txID uuid.UUID, reason string) (models.TransactionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.reverseTransaction(userId, txID, reason)
+}
+
+// ReverseTransactionIfVersion is ReverseTransaction as long as the ledger of the user is still at version, otherwise
+// it returns a *VersionMismatchError with the current one
+func (s *LedgerStore) ReverseTransactionIfVersion(userId string, txID uuid.UUID, reason string, version uint64) (models.TransactionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current := s.version(userId); current != version {
+		return models.TransactionRecord{}, &VersionMismatchError{Current: current}
+	}
+	return s.reverseTransaction(userId, txID, reason)
+}
+
+// reverseTransaction is ReverseTransaction, the caller must hold the write lock
+func (s *LedgerStore) reverseTransaction(userId string, txID uuid.UUID, reason string) (models.TransactionRecord, error) {
+	ledger, exists := s.users[userId]
+	if !exists {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+
+	idx, found := ledger.find(txID)
+	if !found {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+
+	original := ledger.transactions[idx]
+	switch {
+	case original.ReversedBy != nil:
+		return models.TransactionRecord{}, ErrAlreadyReversed
+	case original.ReversalOf != nil:
+		return models.TransactionRecord{}, ErrReversalOfReversal
+	case original.Voided:
+		return models.TransactionRecord{}, ErrAlreadyVoided
+	case original.JournalID != nil:
+		return models.TransactionRecord{}, ErrReverseJournalLeg
+	}
+
+	reversal := models.NewTransactionRecord(oppositeType(original.Type), original.Amount, "reversal: "+original.Description, s.clock.Now())
+	reversal.ReversalOf = &original.ID
+	reversal.ReversalReason = reason
+	if err := ledger.add(reversal); err != nil {
+		return models.TransactionRecord{}, err
+	}
+
+	// the insert may have moved the original
+	if idx, found := ledger.find(txID); found {
+		reversedBy := reversal.ID
+		ledger.transactions[idx].ReversedBy = &reversedBy
+	}
+	s.committed(userId, reversal)
+	return reversal, nil
+}
+
+// Version is the version of the user's ledger, zero for unknown users. every change of the records, a new one, a
+// void, a reversal or an edit, or of the minimum balance increments it, so two reads at the same version saw the same
+// ledger
+func (s *LedgerStore) Version(userId string) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.version(userId)
+}
+
+// ModifiedAt is when the user's ledger last changed, anything that bumps Version counts. zero for unknown users
+func (s *LedgerStore) ModifiedAt(userId string) time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if ledger, exists := s.users[userId]; exists {
+		return ledger.modifiedAt
+	}
+	return time.Time{}
+}
+
+// version is Version, the caller must hold the lock
+func (s *LedgerStore) version(userId string) uint64 {
+	if ledger, exists := s.users[userId]; exists {
+		return ledger.version
+	}
+	return 0
+}
+
+// GetBalanceAt returns the balance of the user considering only the transactions up to and including the given time
+func (s *LedgerStore) GetBalanceAt(userId string, at time.Time) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return 0, nil
+	}
+
+	_, endIdx := ledger.timeRange(nil, &at)
+	balance := 0.0
+	for _, tx := range ledger.transactions[:endIdx] {
+		if !tx.Voided {
+			balance = Settle(balance + signedAmount(tx))
+		}
+	}
+	return balance, nil
+}
+
+// BalancesAfter returns the balance of the user right after each of the given transactions, every earlier record of
+// the ledger counts whether the caller listed it or not. a voided record leaves the balance as it was, unknown ids are
+// left out
+func (s *LedgerStore) BalancesAfter(userId string, txIDs []uuid.UUID) map[uuid.UUID]float64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	balances := make(map[uuid.UUID]float64, len(txIDs))
+	ledger, exists := s.users[userId]
+	if !exists {
+		return balances
+	}
+
+	wanted := make(map[int]uuid.UUID, len(txIDs))
+	last := -1
+	for _, txID := range txIDs {
+		if idx, found := ledger.find(txID); found {
+			wanted[idx] = txID
+			last = max(last, idx)
+		}
+	}
+
+	balance := 0.0
+	for idx, tx := range ledger.transactions[:last+1] {
+		if !tx.Voided {
+			balance = Settle(balance + signedAmount(tx))
+		}
+		if txID, ok := wanted[idx]; ok {
+			balances[txID] = balance
+		}
+	}
+	return balances
+}
+
 func (s *LedgerStore) GetBalance(userId string) (float64, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -154,3 +548,566 @@ func (s *LedgerStore) GetBalance(userId string) (float64, error) {
 	}
 	return ledger.balance, nil
 }
+
+// SetMinimumBalance sets the floor of the user, it may be above the current balance: then only deposits go through
+// until the balance is back above it
+func (s *LedgerStore) SetMinimumBalance(userId string, amount float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger := s.ledgerFor(userId)
+	ledger.minBalance = amount
+	ledger.touch()
+}
+
+// GetAvailableBalance returns the balance, the floor and what can be withdrawn without crossing it (never negative)
+func (s *LedgerStore) GetAvailableBalance(userId string) (balance, minimum, available float64) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return 0, 0, 0
+	}
+	available = Settle(ledger.balance - ledger.minBalance)
+	if available < 0 {
+		available = 0
+	}
+	return ledger.balance, ledger.minBalance, available
+}
+
+// GetSystemTotals aggregates the balances and totals of all users, it's O(users) thanks to the per user aggregates
+func (s *LedgerStore) GetSystemTotals() SystemTotals {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	totals := SystemTotals{UserCount: len(s.users)}
+	for _, ledger := range s.users {
+		totals.TotalBalance = Settle(totals.TotalBalance + ledger.balance)
+		totals.TotalDeposits = Settle(totals.TotalDeposits + ledger.totalDeposits)
+		totals.TotalWithdrawals = Settle(totals.TotalWithdrawals + ledger.totalWithdrawals)
+		totals.TotalFees = Settle(totals.TotalFees + ledger.totalFees)
+		totals.TransactionCount += len(ledger.transactions) - ledger.voidedCount
+	}
+	return totals
+}
+
+// Stats are the sizes of the in-memory structures, what the debug endpoint shows when memory grows
+type Stats struct {
+	Users              int `json:"users"`
+	Transactions       int `json:"transactions"` // every record, voided ones included
+	VoidedTransactions int `json:"voidedTransactions"`
+	References         int `json:"references"`
+	IdempotencyKeys    int `json:"idempotencyKeys"`
+	Journals           int `json:"journals"`
+}
+
+func (s *LedgerStore) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := Stats{Users: len(s.users), Journals: len(s.journals)}
+	for _, ledger := range s.users {
+		stats.Transactions += len(ledger.transactions)
+		stats.VoidedTransactions += ledger.voidedCount
+		stats.References += len(ledger.byRef)
+		stats.IdempotencyKeys += len(ledger.byIdemKey)
+	}
+	return stats
+}
+
+// GetAccountTotals returns the aggregates of the user, zero for unknown users
+func (s *LedgerStore) GetAccountTotals(userId string) AccountTotals {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return AccountTotals{}
+	}
+	totals := AccountTotals{
+		Balance:          ledger.balance,
+		TotalDeposits:    ledger.totalDeposits,
+		TotalWithdrawals: ledger.totalWithdrawals,
+		TotalFees:        ledger.totalFees,
+		TransactionCount: len(ledger.transactions) - ledger.voidedCount,
+		DepositCount:     ledger.depositCount,
+		WithdrawalCount:  ledger.withdrawalCount,
+		VoidedCount:      ledger.voidedCount,
+	}
+	if n := len(ledger.transactions); n > 0 {
+		first, last := ledger.transactions[0].Timestamp, ledger.transactions[n-1].Timestamp
+		totals.FirstActivity, totals.LastActivity = &first, &last
+	}
+	return totals
+}
+
+// GetTransaction returns a single transaction of the user by its id
+func (s *LedgerStore) GetTransaction(userId string, txID uuid.UUID) (models.TransactionRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+
+	idx, found := ledger.find(txID)
+	if !found {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+	return ledger.transactions[idx], nil
+}
+
+// InsertIdempotentTransaction adds the transaction unless one with the same idempotency key already exists for the user,
+// in which case the existing one is returned and replayed is true. the check and the insert happen under the same lock
+// so concurrent retries can't create duplicates
+func (s *LedgerStore) InsertIdempotentTransaction(userId string, tx models.TransactionRecord) (stored models.TransactionRecord, replayed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger := s.ledgerFor(userId)
+	if tx.IdempotencyKey != "" {
+		if txID, exists := ledger.byIdemKey[tx.IdempotencyKey]; exists {
+			if idx, found := ledger.find(txID); found {
+				return ledger.transactions[idx], true, nil
+			}
+		}
+	}
+
+	if err := ledger.add(tx); err != nil {
+		return models.TransactionRecord{}, false, err
+	}
+	s.committed(userId, tx)
+	return tx, false, nil
+}
+
+// UpdateDescription replaces the description of a transaction in place and records the previous value,
+// the amount, type and timestamp never change so the ordering and the indexes stay valid
+func (s *LedgerStore) UpdateDescription(userId string, txID uuid.UUID, description string) (models.TransactionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+
+	idx, found := ledger.find(txID)
+	if !found {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+
+	tx := &ledger.transactions[idx]
+
+	// new slice so copies handed out before never share the backing array
+	edits := make([]models.DescriptionEdit, len(tx.Edits), len(tx.Edits)+1)
+	copy(edits, tx.Edits)
+	tx.Edits = append(edits, models.DescriptionEdit{PreviousDescription: tx.Description, EditedAt: s.clock.Now()})
+	tx.Description = description
+	ledger.touch()
+
+	return *tx, nil
+}
+
+// FindByReference returns the transaction of the user with the given external reference
+func (s *LedgerStore) FindByReference(userId string, referenceId string) (models.TransactionRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ledger, exists := s.users[userId]
+	if !exists {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+
+	txID, exists := ledger.byRef[referenceId]
+	if !exists {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+
+	idx, found := ledger.find(txID)
+	if !found {
+		return models.TransactionRecord{}, ErrTransactionNotFound
+	}
+	return ledger.transactions[idx], nil
+}
+
+// CreateUser registers an empty ledger for the user, ledgers are otherwise created by the first transaction
+func (s *LedgerStore) CreateUser(userId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.users[userId]; exists {
+		return ErrUserExists
+	}
+	s.ledgerFor(userId)
+	return nil
+}
+
+func (s *LedgerStore) UserExists(userId string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.users[userId]
+	return exists
+}
+
+// UserSort is the order of ListUsers
+type UserSort int
+
+const (
+	SortUsersByID      UserSort = iota // ascending user ID
+	SortUsersByBalance                 // largest balance first, ties by user ID
+)
+
+// UserFilter narrows down ListUsers
+type UserFilter struct {
+	MinBalance *float64 // inclusive, nil for every user
+	Sort       UserSort
+}
+
+// UserSummary is a user with its aggregates, LastActivity is the newest transaction and nil for an empty ledger
+type UserSummary struct {
+	UserID           string
+	Balance          float64
+	TransactionCount int
+	LastActivity     *time.Time
+}
+
+type PaginatedUsers struct {
+	Users      []UserSummary
+	TotalCount int
+}
+
+// ListUsers returns a page of the users matching the filter, the summaries come from the per user aggregates so it's
+// O(users log users) whatever the number of transactions
+func (s *LedgerStore) ListUsers(filter UserFilter, page, pageSize int) PaginatedUsers {
+	s.mu.RLock()
+	users := make([]UserSummary, 0, len(s.users))
+	for userId, ledger := range s.users {
+		if filter.MinBalance != nil && ledger.balance < *filter.MinBalance {
+			continue
+		}
+
+		summary := UserSummary{
+			UserID:           userId,
+			Balance:          ledger.balance,
+			TransactionCount: len(ledger.transactions) - ledger.voidedCount,
+		}
+		if n := len(ledger.transactions); n > 0 {
+			last := ledger.transactions[n-1].Timestamp
+			summary.LastActivity = &last
+		}
+		users = append(users, summary)
+	}
+	s.mu.RUnlock()
+
+	slices.SortFunc(users, func(a, b UserSummary) int {
+		if filter.Sort == SortUsersByBalance && a.Balance != b.Balance {
+			return cmp.Compare(b.Balance, a.Balance)
+		}
+		return strings.Compare(a.UserID, b.UserID)
+	})
+
+	if page < 1 {
+		page = 1
+	}
+	start := min((page-1)*pageSize, len(users))
+	end := min(start+pageSize, len(users))
+	return PaginatedUsers{Users: users[start:end], TotalCount: len(users)}
+}
+
+// DeleteUser drops the ledger of the user with its transactions and returns the balance it had. a non zero balance
+// is refused with a BalanceNotZeroError unless force is set. a user with legs in journals is refused with
+// ErrUserHasJournals whatever force says, the other legs would no longer balance: AnonymizeUser keeps them. the user
+// ID is free again afterwards
+func (s *LedgerStore) DeleteUser(userId string, force bool) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger, err := s.removableLedger(userId, force)
+	if err != nil {
+		return 0, err
+	}
+	for _, tx := range ledger.transactions {
+		if tx.JournalID != nil {
+			return 0, ErrUserHasJournals
+		}
+	}
+	delete(s.users, userId)
+	return ledger.balance, nil
+}
+
+// AnonymizeUser moves the ledger of the user under token and scrubs what could identify them: descriptions and their
+// edits, references, reasons and idempotency keys. amounts, types and times stay so the totals and the journals
+// still add up. the balance rule is the one of DeleteUser
+func (s *LedgerStore) AnonymizeUser(userId, token string, force bool) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ledger, err := s.removableLedger(userId, force)
+	if err != nil {
+		return 0, err
+	}
+	if _, exists := s.users[token]; exists {
+		return 0, ErrUserExists
+	}
+
+	for i := range ledger.transactions {
+		tx := &ledger.transactions[i]
+		tx.Description, tx.ReferenceID, tx.ReversalReason, tx.VoidReason, tx.IdempotencyKey = "", "", "", "", ""
+		tx.Edits = nil
+
+		if tx.JournalID == nil {
+			continue
+		}
+		if j, exists := s.journals[*tx.JournalID]; exists {
+			for k := range j.legs {
+				if j.legs[k].userId == userId {
+					j.legs[k].userId = token
+				}
+			}
+		}
+	}
+	ledger.byRef = make(map[string]uuid.UUID)
+	ledger.byIdemKey = make(map[string]uuid.UUID)
+
+	delete(s.users, userId)
+	s.users[token] = ledger
+	return ledger.balance, nil
+}
+
+// removableLedger is the ledger DeleteUser and AnonymizeUser may remove, callers hold the write lock
+func (s *LedgerStore) removableLedger(userId string, force bool) (*userLedger, error) {
+	ledger, exists := s.users[userId]
+	if !exists {
+		return nil, ErrUserNotFound
+	}
+	if ledger.balance != 0 && !force {
+		return nil, &BalanceNotZeroError{Balance: ledger.balance}
+	}
+	return ledger, nil
+}
+
+// SetCommitHook installs the hook called for every new record, nil removes it
+func (s *LedgerStore) SetCommitHook(hook CommitHook) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.onCommit = hook
+}
+
+// committed passes a new record to the outbox and the commit hook, the caller must hold the write lock
+func (s *LedgerStore) committed(userId string, tx models.TransactionRecord) {
+	if s.outbox != nil {
+		s.outbox.append(userId, tx, s.users[userId].balance, s.clock.Now())
+	}
+	if s.onCommit != nil {
+		s.onCommit(userId, tx, s.users[userId].balance)
+	}
+}
+
+// ledgerFor returns the ledger of the user and creates it when missing, the caller must hold the write lock
+func (s *LedgerStore) ledgerFor(userId string) *userLedger {
+	ledger, exists := s.users[userId]
+	if !exists {
+		ledger = &userLedger{
+			byID:      make(map[uuid.UUID]time.Time),
+			byRef:     make(map[string]uuid.UUID),
+			byIdemKey: make(map[string]uuid.UUID),
+			clock:     s.clock,
+		}
+		s.users[userId] = ledger
+	}
+	return ledger
+}
+
+// add validates the funds and the reference uniqueness before applying the transaction, the caller must hold the write lock
+func (l *userLedger) add(tx models.TransactionRecord) error {
+	if tx.Type == models.Withdrawal {
+		if err := l.canDebit(tx.Amount + tx.Fee); err != nil {
+			return err
+		}
+	}
+
+	if tx.ReferenceID != "" {
+		if _, exists := l.byRef[tx.ReferenceID]; exists {
+			return ErrDuplicateReference
+		}
+	}
+
+	l.apply(tx)
+	l.insert(tx)
+	return nil
+}
+
+// recentDuplicate walks back from the newest record while it's within window of tx, so it's O(window) not
+// O(history). the caller must hold the lock
+func (l *userLedger) recentDuplicate(tx models.TransactionRecord, window time.Duration) (uuid.UUID, bool) {
+	since := tx.Timestamp.Add(-window)
+	for i := len(l.transactions) - 1; i >= 0; i-- {
+		recent := l.transactions[i]
+		if recent.Timestamp.Before(since) {
+			break
+		}
+		if !recent.Voided && recent.Type == tx.Type && recent.Amount == tx.Amount && recent.Description == tx.Description {
+			return recent.ID, true
+		}
+	}
+	return uuid.Nil, false
+}
+
+// canDebit checks a debit against the funds first and the minimum balance second, so a debit larger than the
+// balance is always ErrInsufficientFunds. the caller must hold the lock
+func (l *userLedger) canDebit(amount float64) error {
+	return l.canDebitFrom(l.balance, amount)
+}
+
+// canDebitFrom is canDebit for a balance the ledger doesn't have yet, e.g. midway through a batch
+func (l *userLedger) canDebitFrom(balance, amount float64) error {
+	if balance < amount {
+		return ErrInsufficientFunds
+	}
+	if Settle(balance-amount) < l.minBalance {
+		return ErrMinimumBalance
+	}
+	return nil
+}
+
+// insert keeps the transactions sorted by timestamp, which helps optimize get transaction history between 2 dates.
+// equal timestamps keep the insertion order, the caller must hold the write lock
+func (l *userLedger) insert(tx models.TransactionRecord) {
+	n := len(l.transactions)
+	idx := sort.Search(n, func(i int) bool {
+		return l.transactions[i].Timestamp.After(tx.Timestamp)
+	})
+
+	l.transactions = append(l.transactions, models.TransactionRecord{})
+	copy(l.transactions[idx+1:], l.transactions[idx:n])
+	l.transactions[idx] = tx
+	l.byID[tx.ID] = tx.Timestamp
+	if tx.ReferenceID != "" {
+		l.byRef[tx.ReferenceID] = tx.ID
+	}
+	if tx.IdempotencyKey != "" {
+		l.byIdemKey[tx.IdempotencyKey] = tx.ID
+	}
+}
+
+// touch records a change of the ledger, the caller must hold the lock
+func (l *userLedger) touch() {
+	l.version++
+	l.modifiedAt = l.clock.Now()
+}
+
+// find returns the position of the transaction with the given id, the caller must hold the lock
+func (l *userLedger) find(txID uuid.UUID) (int, bool) {
+	ts, exists := l.byID[txID]
+	if !exists {
+		return 0, false
+	}
+	return l.seek(Cursor{Timestamp: ts, ID: txID})
+}
+
+// apply updates the balance and aggregates of the ledger with the transaction, the caller must hold the lock
+func (l *userLedger) apply(tx models.TransactionRecord) {
+	l.touch()
+	if tx.Voided {
+		l.voidedCount++
+		return
+	}
+
+	switch tx.Type {
+	case models.Deposit:
+		l.balance = Settle(l.balance + tx.Amount)
+		l.totalDeposits = Settle(l.totalDeposits + tx.Amount)
+		l.depositCount++
+	case models.Withdrawal:
+		l.balance = Settle(l.balance - tx.Amount - tx.Fee)
+		l.totalWithdrawals = Settle(l.totalWithdrawals + tx.Amount)
+		l.totalFees = Settle(l.totalFees + tx.Fee)
+		l.withdrawalCount++
+	}
+}
+
+// unapply removes the effect of the transaction from the balance and aggregates, the caller must hold the lock
+func (l *userLedger) unapply(tx models.TransactionRecord) {
+	l.touch()
+	switch tx.Type {
+	case models.Deposit:
+		l.balance = Settle(l.balance - tx.Amount)
+		l.totalDeposits = Settle(l.totalDeposits - tx.Amount)
+		l.depositCount--
+	case models.Withdrawal:
+		l.balance = Settle(l.balance + tx.Amount + tx.Fee)
+		l.totalWithdrawals = Settle(l.totalWithdrawals - tx.Amount)
+		l.totalFees = Settle(l.totalFees - tx.Fee)
+		l.withdrawalCount--
+	}
+}
+
+// filteredPage paginates the transactions of [startIdx, endIdx) matching the filter, the caller must hold the lock
+func (l *userLedger) filteredPage(startIdx, endIdx int, filter TransactionFilter, page, pageSize int) PaginatedTransactions {
+	skip := (page - 1) * pageSize
+	result := PaginatedTransactions{Transactions: []models.TransactionRecord{}}
+
+	for i := range endIdx - startIdx {
+		tx := l.transactions[startIdx+i]
+		if filter.Descending {
+			tx = l.transactions[endIdx-1-i]
+		}
+		if !filter.matches(tx) {
+			continue
+		}
+		if result.TotalCount >= skip && len(result.Transactions) < pageSize {
+			result.Transactions = append(result.Transactions, tx)
+		}
+		result.TotalCount++
+	}
+	return result
+}
+
+// timeRange returns the [start, end) indexes of the transactions between startTime and endTime, the caller must hold the lock
+func (l *userLedger) timeRange(startTime, endTime *time.Time) (int, int) {
+	n := len(l.transactions)
+
+	//  first of all: apply time filterings that start index ≥ startTime
+	startIdx := 0
+	if startTime != nil {
+		startIdx = sort.Search(n, func(i int) bool {
+			return !l.transactions[i].Timestamp.Before(*startTime)
+		})
+	}
+
+	// end index > endTime
+	endIdx := n
+	if endTime != nil {
+		endIdx = sort.Search(n, func(i int) bool {
+			return l.transactions[i].Timestamp.After(*endTime)
+		})
+	}
+
+	if endIdx < startIdx {
+		endIdx = startIdx
+	}
+	return startIdx, endIdx
+}
+
+// amountScale is the precision the balances and totals are kept to, a millionth of the currency unit. float sums
+// drift (0.1 deposited 300 times adds up to 29.999999999999996 and a withdrawal of 30 wouldn't go through), every
+// sum is snapped back to it so it's the float closest to the decimal amount. amounts with more decimals lose them
+// in the sums, well below the cents that are shown
+const amountScale = 1e6
+
+// Settle snaps a sum of amounts to amountScale, every balance and total the store computes goes through here
+func Settle(amount float64) float64 {
+	return math.Round(amount*amountScale) / amountScale
+}
+
+// signedAmount is the effect of the transaction on the balance, the fee of a withdrawal included
+func signedAmount(tx models.TransactionRecord) float64 {
+	if tx.Type == models.Withdrawal {
+		return -(tx.Amount + tx.Fee)
+	}
+	return tx.Amount
+}
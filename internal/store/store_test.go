@@ -1,10 +1,15 @@
 package store
 
 import (
+	"errors"
+	"slices"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/clock/clocktest"
 	"tiny-ledger/internal/models"
 )
 
@@ -79,6 +84,31 @@ func TestLedgerStore_GetBalance(t *testing.T) {
 	}
 }
 
+func TestLedgerStore_GetBalance_NoFloatDrift(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "drift_user"
+
+	// summed as floats 0.1 three hundred times is 29.999999999999996
+	for range 300 {
+		if _, err := store.AddTransaction(userId, models.Deposit, 0.1, "Dime"); err != nil {
+			t.Fatalf("Error adding deposit: %v", err)
+		}
+	}
+	if balance, _ := store.GetBalance(userId); balance != 30 {
+		t.Errorf("Expected balance 30, got %v", balance)
+	}
+	if totals := store.GetAccountTotals(userId); totals.TotalDeposits != 30 {
+		t.Errorf("Expected deposits of 30, got %v", totals.TotalDeposits)
+	}
+
+	if _, err := store.AddTransaction(userId, models.Withdrawal, 30, "Everything"); err != nil {
+		t.Fatalf("Expected the withdrawal of the whole balance to go through, got %v", err)
+	}
+	if balance, _ := store.GetBalance(userId); balance != 0 {
+		t.Errorf("Expected balance 0, got %v", balance)
+	}
+}
+
 func TestLedgerStore_GetPaginatedTransactions(t *testing.T) {
 	store := NewLedgerStore()
 	userId := "pagination_test_user"
@@ -278,3 +308,1005 @@ func TestConcurrentAccess_NoRace(t *testing.T) {
 		t.Errorf("Final mixed balance incorrect: got %.2f, want %.2f", balance, expectedBalance)
 	}
 }
+
+func TestLedgerStore_GetBalanceAt(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "balance_at_user"
+	base := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	store.AddTransactionWithTime(userId, models.TransactionRecord{Amount: 100.0, Type: models.Deposit, Timestamp: base})
+	store.AddTransactionWithTime(userId, models.TransactionRecord{Amount: 30.0, Type: models.Withdrawal, Timestamp: base.Add(24 * time.Hour)})
+	store.AddTransactionWithTime(userId, models.TransactionRecord{Amount: 50.0, Type: models.Deposit, Timestamp: base.Add(48 * time.Hour)})
+
+	tests := []struct {
+		name     string
+		at       time.Time
+		expected float64
+	}{
+		{"Before first transaction", base.Add(-time.Second), 0.0},
+		{"Exactly at first transaction", base, 100.0},
+		{"After withdrawal", base.Add(25 * time.Hour), 70.0},
+		{"After everything", base.Add(72 * time.Hour), 120.0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			balance, err := store.GetBalanceAt(userId, tc.at)
+			if err != nil {
+				t.Fatalf("Error getting balance: %v", err)
+			}
+			if balance != tc.expected {
+				t.Errorf("Expected balance %.2f, got %.2f", tc.expected, balance)
+			}
+		})
+	}
+
+	balance, err := store.GetBalanceAt("unknown_user", base)
+	if err != nil || balance != 0 {
+		t.Errorf("Expected 0 balance for unknown user, got %.2f (err: %v)", balance, err)
+	}
+
+	start := base.Add(time.Hour)
+	end := base.Add(48 * time.Hour)
+	transactions := store.GetTransactionsInRange(userId, &start, &end)
+	if len(transactions) != 2 {
+		t.Errorf("Expected 2 transactions in range, got %d", len(transactions))
+	}
+}
+
+func TestLedgerStore_BalancesAfter(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "balances_after_user"
+	base := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	records := []models.TransactionRecord{
+		{ID: uuid.New(), Amount: 100.0, Type: models.Deposit, Timestamp: base},
+		{ID: uuid.New(), Amount: 30.0, Fee: 1.0, Type: models.Withdrawal, Timestamp: base.Add(time.Hour)},
+		{ID: uuid.New(), Amount: 500.0, Type: models.Deposit, Timestamp: base.Add(time.Hour), Voided: true},
+		{ID: uuid.New(), Amount: 50.0, Type: models.Deposit, Timestamp: base.Add(2 * time.Hour)},
+	}
+	for _, tx := range records {
+		store.AddTransactionWithTime(userId, tx)
+	}
+
+	// the first deposit isn't asked for but still counts, the voided one doesn't
+	balances := store.BalancesAfter(userId, []uuid.UUID{records[3].ID, records[1].ID, records[2].ID, uuid.New()})
+	expected := map[uuid.UUID]float64{records[1].ID: 69.0, records[2].ID: 69.0, records[3].ID: 119.0}
+	if len(balances) != len(expected) {
+		t.Fatalf("Expected %d balances, got %v", len(expected), balances)
+	}
+	for txID, balance := range expected {
+		if balances[txID] != balance {
+			t.Errorf("Expected balance %.2f after %s, got %.2f", balance, txID, balances[txID])
+		}
+	}
+
+	if balances := store.BalancesAfter("unknown_user", []uuid.UUID{records[0].ID}); len(balances) != 0 {
+		t.Errorf("Expected no balances for unknown user, got %v", balances)
+	}
+}
+
+func TestLedgerStore_GetSystemTotals(t *testing.T) {
+	store := NewLedgerStore()
+
+	_, _ = store.AddTransaction("user_a", models.Deposit, 100.0, "deposit")
+	_, _ = store.AddTransaction("user_a", models.Withdrawal, 25.0, "withdrawal")
+	_, _ = store.AddTransaction("user_b", models.Deposit, 40.0, "deposit")
+	store.AddTransactionWithTime("user_c", models.TransactionRecord{Amount: 5.0, Type: models.Deposit, Timestamp: time.Now()})
+
+	totals := store.GetSystemTotals()
+	if totals.UserCount != 3 {
+		t.Errorf("Expected 3 users, got %d", totals.UserCount)
+	}
+	if totals.TransactionCount != 4 {
+		t.Errorf("Expected 4 transactions, got %d", totals.TransactionCount)
+	}
+	if totals.TotalDeposits != 145.0 || totals.TotalWithdrawals != 25.0 {
+		t.Errorf("Unexpected deposit/withdrawal totals: %+v", totals)
+	}
+	if totals.TotalBalance != 120.0 {
+		t.Errorf("Expected total balance 120.0, got %.2f", totals.TotalBalance)
+	}
+}
+
+func TestLedgerStore_GetTransaction(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "lookup_user"
+	base := time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC)
+
+	// inserted out of order and with equal timestamps to exercise the sorted insert
+	ids := make([]uuid.UUID, 0, 4)
+	for _, offset := range []time.Duration{2 * time.Hour, 0, time.Hour, time.Hour} {
+		tx := models.TransactionRecord{ID: uuid.New(), Amount: 10.0, Type: models.Deposit, Timestamp: base.Add(offset)}
+		store.AddTransactionWithTime(userId, tx)
+		ids = append(ids, tx.ID)
+	}
+
+	for _, id := range ids {
+		tx, err := store.GetTransaction(userId, id)
+		if err != nil {
+			t.Fatalf("Error getting transaction %s: %v", id, err)
+		}
+		if tx.ID != id {
+			t.Errorf("Expected transaction %s, got %s", id, tx.ID)
+		}
+	}
+
+	result := store.GetPaginatedTransactions(userId, nil, nil, 1, 10)
+	expectedOrder := []uuid.UUID{ids[1], ids[2], ids[3], ids[0]}
+	for i, tx := range result.Transactions {
+		if tx.ID != expectedOrder[i] {
+			t.Errorf("Unexpected transaction at position %d", i)
+		}
+	}
+
+	if _, err := store.GetTransaction(userId, uuid.New()); err != ErrTransactionNotFound {
+		t.Errorf("Expected transaction not found, got %v", err)
+	}
+	if _, err := store.GetTransaction("other_user", ids[0]); err != ErrTransactionNotFound {
+		t.Errorf("Expected transaction not found for another user, got %v", err)
+	}
+}
+
+func TestLedgerStore_Transfer(t *testing.T) {
+	store := NewLedgerStore()
+
+	if _, err := store.Transfer("empty_user", "receiver", 10.0, "no funds"); err != ErrInsufficientFunds {
+		t.Errorf("Expected insufficient funds, got %v", err)
+	}
+
+	_, _ = store.AddTransaction("sender", models.Deposit, 50.0, "deposit")
+	journal, err := store.Transfer("sender", "receiver", 20.0, "transfer")
+	if err != nil {
+		t.Fatalf("Error transferring: %v", err)
+	}
+
+	out := journal.Entries[0].Transaction
+	in := journal.Entries[1].Transaction
+	if out.Type != models.Withdrawal || in.Type != models.Deposit || !out.Timestamp.Equal(in.Timestamp) {
+		t.Errorf("Unexpected legs: %+v %+v", out, in)
+	}
+
+	if _, err := store.GetTransaction("receiver", in.ID); err != nil {
+		t.Errorf("Receiver leg not indexed: %v", err)
+	}
+
+	totals := store.GetSystemTotals()
+	if totals.TotalBalance != 50.0 {
+		t.Errorf("Transfers must not change the total balance, got %.2f", totals.TotalBalance)
+	}
+
+	if unbalanced := store.UnbalancedJournals(); len(unbalanced) != 0 {
+		t.Errorf("Expected no unbalanced journals, got %v", unbalanced)
+	}
+}
+
+func TestLedgerStore_TransferIdempotent(t *testing.T) {
+	store := NewLedgerStore()
+	_, _ = store.AddTransaction("sender", models.Deposit, 50.0, "deposit")
+
+	original, replayed, err := store.TransferIdempotent("sender", "receiver", 20.0, "transfer", "key-1")
+	if err != nil || replayed {
+		t.Fatalf("Expected a new transfer, got replayed=%v err=%v", replayed, err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			journal, replayed, err := store.TransferIdempotent("sender", "receiver", 20.0, "transfer", "key-1")
+			if err != nil || !replayed || journal.ID != original.ID {
+				t.Errorf("Expected the original journal back, got %s replayed=%v err=%v", journal.ID, replayed, err)
+			}
+			if journal.Entries[0].BalanceAfter == nil || *journal.Entries[0].BalanceAfter != 30.0 {
+				t.Errorf("Expected the original balance after on the replay")
+			}
+		}()
+	}
+	wg.Wait()
+
+	if balance, _ := store.GetBalance("sender"); balance != 30.0 {
+		t.Errorf("Expected balance 30.00 after the retries, got %.2f", balance)
+	}
+
+	_, _, _ = store.InsertIdempotentTransaction("sender", models.TransactionRecord{
+		ID: uuid.New(), Type: models.Deposit, Amount: 1.0, Timestamp: time.Now(), IdempotencyKey: "key-2",
+	})
+	if _, _, err := store.TransferIdempotent("sender", "receiver", 1.0, "", "key-2"); err != ErrIdempotencyKeyTaken {
+		t.Errorf("Expected ErrIdempotencyKeyTaken, got %v", err)
+	}
+}
+
+func TestLedgerStore_PostJournal_Concurrent(t *testing.T) {
+	store := NewLedgerStore()
+	users := []string{"user_a", "user_b", "user_c"}
+	for _, userId := range users {
+		_, _ = store.AddTransaction(userId, models.Deposit, 100.0, "deposit")
+	}
+
+	// journals rotating money in opposite directions between the same users
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			from, to := users[i%3], users[(i+1)%3]
+			if i%2 == 0 {
+				from, to = to, from
+			}
+			_, _ = store.PostJournal([]models.JournalLeg{
+				{UserID: from, Direction: models.Debit, Amount: 1.0},
+				{UserID: to, Direction: models.Credit, Amount: 1.0},
+			})
+		}(i)
+	}
+	wg.Wait()
+
+	totals := store.GetSystemTotals()
+	if totals.TotalBalance != 300.0 {
+		t.Errorf("Expected total balance to stay 300.0, got %.2f", totals.TotalBalance)
+	}
+	if unbalanced := store.UnbalancedJournals(); len(unbalanced) != 0 {
+		t.Errorf("Expected no unbalanced journals, got %v", unbalanced)
+	}
+}
+
+func TestLedgerStore_PostJournal_Unbalanced(t *testing.T) {
+	store := NewLedgerStore()
+	if _, err := store.AddTransaction("customer", models.Deposit, 20.0, "deposit"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// off by less than a cent is still off
+	_, err := store.PostJournal([]models.JournalLeg{
+		{UserID: "customer", Direction: models.Debit, Amount: 10.004},
+		{UserID: "merchant", Direction: models.Credit, Amount: 10.0},
+	})
+	if !errors.Is(err, ErrUnbalancedJournal) {
+		t.Fatalf("Expected ErrUnbalancedJournal, got %v", err)
+	}
+	if balance, _ := store.GetBalance("customer"); balance != 20.0 || store.UserExists("merchant") || store.Stats().Journals != 0 {
+		t.Errorf("Expected nothing applied, got a balance of %v", balance)
+	}
+
+	// the float noise of the sum settles to zero
+	if _, err := store.PostJournal([]models.JournalLeg{
+		{UserID: "customer", Direction: models.Debit, Amount: 0.3},
+		{UserID: "merchant", Direction: models.Credit, Amount: 0.1},
+		{UserID: "fees", Direction: models.Credit, Amount: 0.2},
+	}); err != nil {
+		t.Errorf("Expected the journal to balance, got %v", err)
+	}
+}
+
+func TestLedgerStore_FindByReference(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "reference_user"
+
+	tx := models.NewTransactionRecord(models.Deposit, 10.0, "with reference", time.Now())
+	tx.ReferenceID = "EXT-42"
+	if _, err := store.InsertTransaction(userId, tx); err != nil {
+		t.Fatalf("Error inserting transaction: %v", err)
+	}
+
+	found, err := store.FindByReference(userId, "EXT-42")
+	if err != nil || found.ID != tx.ID {
+		t.Errorf("Expected to find %s by reference, got %+v (err: %v)", tx.ID, found, err)
+	}
+
+	duplicate := models.NewTransactionRecord(models.Deposit, 20.0, "same reference", time.Now())
+	duplicate.ReferenceID = "EXT-42"
+	if _, err := store.InsertTransaction(userId, duplicate); err != ErrDuplicateReference {
+		t.Errorf("Expected duplicate reference error, got %v", err)
+	}
+
+	balance, _ := store.GetBalance(userId)
+	if balance != 10.0 {
+		t.Errorf("Rejected duplicate must not change the balance, got %.2f", balance)
+	}
+
+	if _, err := store.FindByReference(userId, "missing"); err != ErrTransactionNotFound {
+		t.Errorf("Expected transaction not found, got %v", err)
+	}
+}
+
+func TestLedgerStore_CreateUser(t *testing.T) {
+	store := NewLedgerStore()
+
+	if store.UserExists("user1") {
+		t.Error("Expected user1 not to exist before registration")
+	}
+
+	if err := store.CreateUser("user1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !store.UserExists("user1") {
+		t.Error("Expected user1 to exist after registration")
+	}
+
+	if err := store.CreateUser("user1"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Expected ErrUserExists, got %v", err)
+	}
+
+	store.AddTransaction("user2", models.Deposit, 10.0, "implicit")
+	if err := store.CreateUser("user2"); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Expected ErrUserExists for an implicitly created user, got %v", err)
+	}
+}
+
+func TestLedgerStore_InsertTransactionUnlessDuplicate(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "user1"
+	window := 5 * time.Second
+	base := time.Now()
+
+	original := models.TransactionRecord{ID: uuid.New(), Type: models.Deposit, Amount: 50.0, Description: "coffee", Timestamp: base.Add(-time.Minute)}
+	store.AddTransactionWithTime(userId, original)
+
+	tests := []struct {
+		name          string
+		tx            models.TransactionRecord
+		expectedError bool
+	}{
+		{"Outside the window", models.TransactionRecord{Type: models.Deposit, Amount: 50.0, Description: "coffee", Timestamp: base}, false},
+		{"Same within the window", models.TransactionRecord{Type: models.Deposit, Amount: 50.0, Description: "coffee", Timestamp: base.Add(2 * time.Second)}, true},
+		{"Different amount", models.TransactionRecord{Type: models.Deposit, Amount: 51.0, Description: "coffee", Timestamp: base.Add(3 * time.Second)}, false},
+		{"Different description", models.TransactionRecord{Type: models.Deposit, Amount: 50.0, Description: "tea", Timestamp: base.Add(3 * time.Second)}, false},
+		{"Different type", models.TransactionRecord{Type: models.Withdrawal, Amount: 50.0, Description: "coffee", Timestamp: base.Add(3 * time.Second)}, false},
+	}
+
+	var firstInWindow uuid.UUID
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.tx.ID = uuid.New()
+			_, err := store.InsertTransactionUnlessDuplicate(userId, test.tx, window)
+
+			if !test.expectedError {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if firstInWindow == uuid.Nil {
+					firstInWindow = test.tx.ID
+				}
+				return
+			}
+
+			var duplicateErr *DuplicateError
+			if !errors.As(err, &duplicateErr) || !errors.Is(err, ErrPossibleDuplicate) {
+				t.Fatalf("Expected a DuplicateError, got %v", err)
+			}
+			if duplicateErr.OriginalID != firstInWindow {
+				t.Errorf("Expected original %s, got %s", firstInWindow, duplicateErr.OriginalID)
+			}
+		})
+	}
+}
+
+func TestLedgerStore_ReverseTransaction(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "user1"
+
+	deposit, _ := store.AddTransaction(userId, models.Deposit, 100.0, "salary")
+	store.AddTransaction(userId, models.Deposit, 20.0, "cushion")
+	voided, _ := store.AddTransaction(userId, models.Deposit, 5.0, "typo")
+	store.VoidTransaction(userId, voided.ID, "typo")
+	journal, _ := store.Transfer(userId, "user2", 10.0, "rent")
+
+	reversal, err := store.ReverseTransaction(userId, deposit.ID, "chargeback")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if reversal.Type != models.Withdrawal || reversal.Amount != 100.0 || *reversal.ReversalOf != deposit.ID {
+		t.Errorf("Unexpected reversal: %+v", reversal)
+	}
+
+	original, _ := store.GetTransaction(userId, deposit.ID)
+	if original.ReversedBy == nil || *original.ReversedBy != reversal.ID {
+		t.Errorf("Expected the original to link to the reversal, got %v", original.ReversedBy)
+	}
+
+	tests := []struct {
+		name          string
+		txID          uuid.UUID
+		expectedError error
+	}{
+		{"Already reversed", deposit.ID, ErrAlreadyReversed},
+		{"Reversal of a reversal", reversal.ID, ErrReversalOfReversal},
+		{"Voided", voided.ID, ErrAlreadyVoided},
+		{"Journal leg", journal.Entries[0].Transaction.ID, ErrReverseJournalLeg},
+		{"Unknown", uuid.New(), ErrTransactionNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := store.ReverseTransaction(userId, test.txID, ""); !errors.Is(err, test.expectedError) {
+				t.Errorf("Expected %v, got %v", test.expectedError, err)
+			}
+		})
+	}
+
+	if balance, _ := store.GetBalance(userId); balance != 10.0 {
+		t.Errorf("Expected balance 10.00, got %.2f", balance)
+	}
+}
+
+func TestLedgerStore_VoidReversedTransaction(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "user1"
+
+	store.AddTransaction(userId, models.Deposit, 100.0, "salary")
+	withdrawal, _ := store.AddTransaction(userId, models.Withdrawal, 50.0, "rent")
+	withdrawalReversal, _ := store.ReverseTransaction(userId, withdrawal.ID, "duplicate")
+	deposit, _ := store.AddTransaction(userId, models.Deposit, 30.0, "refund")
+	depositReversal, _ := store.ReverseTransaction(userId, deposit.ID, "chargeback")
+
+	tests := []struct {
+		name          string
+		txID          uuid.UUID
+		expectedError error
+	}{
+		{"Reversed withdrawal", withdrawal.ID, ErrAlreadyReversed},
+		{"Reversal of a withdrawal", withdrawalReversal.ID, ErrReversalOfReversal},
+		{"Reversed deposit", deposit.ID, ErrAlreadyReversed},
+		{"Reversal of a deposit", depositReversal.ID, ErrReversalOfReversal},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := store.VoidTransaction(userId, test.txID, ""); !errors.Is(err, test.expectedError) {
+				t.Errorf("Expected %v, got %v", test.expectedError, err)
+			}
+		})
+	}
+
+	// every reversal undid its original once, nothing more
+	if balance, _ := store.GetBalance(userId); balance != 100.0 {
+		t.Errorf("Expected balance 100.00, got %.2f", balance)
+	}
+}
+
+func TestLedgerStore_VoidDepositAtTheMinimumBalance(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "user1"
+
+	store.AddTransaction(userId, models.Deposit, 100.0, "salary")
+	dime, _ := store.AddTransaction(userId, models.Deposit, 0.1, "dime")
+	twenty, _ := store.AddTransaction(userId, models.Deposit, 0.2, "twenty cents")
+	store.SetMinimumBalance(userId, 100.1)
+
+	// 100.3 - 0.2 lands exactly on the floor
+	if _, err := store.VoidTransaction(userId, twenty.ID, "typo"); err != nil {
+		t.Fatalf("Expected the void down to the floor to go through, got %v", err)
+	}
+	if _, err := store.VoidTransaction(userId, dime.ID, "typo"); !errors.Is(err, ErrMinimumBalance) {
+		t.Errorf("Expected %v, got %v", ErrMinimumBalance, err)
+	}
+	if balance, _ := store.GetBalance(userId); balance != 100.1 {
+		t.Errorf("Expected balance 100.10, got %v", balance)
+	}
+}
+
+func TestLedgerStore_GetTransactionsAfter(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "user1"
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// two records share each timestamp so the walk has to tell them apart by id
+	var ids []uuid.UUID
+	for i := 0; i < 6; i++ {
+		tx := models.NewTransactionRecord(models.Deposit, float64(i+1), "deposit", base.Add(time.Duration(i/2)*time.Hour))
+		store.AddTransactionWithTime(userId, tx)
+		ids = append(ids, tx.ID)
+	}
+
+	walk := func(descending bool) []uuid.UUID {
+		var seen []uuid.UUID
+		var after *Cursor
+		for {
+			page, err := store.GetTransactionsAfter(userId, TransactionFilter{Descending: descending}, after, 2)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for _, tx := range page.Transactions {
+				seen = append(seen, tx.ID)
+			}
+			if !page.HasMore {
+				return seen
+			}
+			last := page.Transactions[len(page.Transactions)-1]
+			after = &Cursor{Timestamp: last.Timestamp, ID: last.ID}
+
+			// a record inserted before the cursor must not shift the rest of the walk
+			if len(seen) == 2 {
+				backdated := models.NewTransactionRecord(models.Deposit, 1.0, "late", base.Add(-time.Hour))
+				store.AddTransactionWithTime(userId, backdated)
+			}
+		}
+	}
+
+	asc := walk(false)
+	if len(asc) != len(ids) {
+		t.Fatalf("Expected %d records, got %d", len(ids), len(asc))
+	}
+	for i := range ids {
+		if asc[i] != ids[i] {
+			t.Errorf("Expected record %d to be %s, got %s", i, ids[i], asc[i])
+		}
+	}
+
+	desc := walk(true)
+	if len(desc) != len(ids)+2 {
+		t.Fatalf("Expected %d records, got %d", len(ids)+2, len(desc))
+	}
+	for i := range ids {
+		if desc[i] != ids[len(ids)-1-i] {
+			t.Errorf("Expected record %d to be %s, got %s", i, ids[len(ids)-1-i], desc[i])
+		}
+	}
+
+	tests := []struct {
+		name   string
+		userId string
+		cursor Cursor
+	}{
+		{"Unknown id", userId, Cursor{Timestamp: base, ID: uuid.New()}},
+		{"Timestamp mismatch", userId, Cursor{Timestamp: base.Add(time.Minute), ID: ids[0]}},
+		{"Other user", "user2", Cursor{Timestamp: base, ID: ids[0]}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := store.GetTransactionsAfter(test.userId, TransactionFilter{}, &test.cursor, 2); !errors.Is(err, ErrCursorNotFound) {
+				t.Errorf("Expected ErrCursorNotFound, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLedgerStore_CountTransactions(t *testing.T) {
+	store := NewLedgerStore()
+	userId := "user1"
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := range 10 {
+		tx := models.TransactionRecord{ID: uuid.New(), Amount: float64(i + 1), Type: models.Deposit, Timestamp: base.Add(time.Duration(i) * time.Hour)}
+		if i%2 == 1 {
+			tx.Type = models.Withdrawal
+		}
+		store.AddTransactionWithTime(userId, tx)
+	}
+
+	start, end := base.Add(2*time.Hour), base.Add(6*time.Hour)
+	withdrawal := models.Withdrawal
+	minAmount := 5.0
+
+	tests := []struct {
+		name     string
+		userId   string
+		filter   TransactionFilter
+		expected int
+	}{
+		{"No filter", userId, TransactionFilter{}, 10},
+		{"Time range", userId, TransactionFilter{StartTime: &start, EndTime: &end}, 5},
+		{"Type", userId, TransactionFilter{Type: &withdrawal}, 5},
+		{"Type and amount in range", userId, TransactionFilter{StartTime: &start, EndTime: &end, Type: &withdrawal, MinAmount: &minAmount}, 1},
+		{"Unknown user", "user2", TransactionFilter{}, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if count := store.CountTransactions(test.userId, test.filter); count != test.expected {
+				t.Errorf("Expected %d transactions, got %d", test.expected, count)
+			}
+			if test.userId != userId {
+				return
+			}
+			if total := store.GetFilteredTransactions(test.userId, test.filter, 1, 1).TotalCount; total != test.expected {
+				t.Errorf("Expected the count to match the page total %d, got %d", total, test.expected)
+			}
+		})
+	}
+}
+
+func TestLedgerStore_ListUsers(t *testing.T) {
+	store := NewLedgerStore()
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	deposits := map[string]float64{"carol": 30, "alice": 10, "dave": 30, "bob": 20}
+	for userId, amount := range deposits {
+		store.AddTransactionWithTime(userId, models.TransactionRecord{ID: uuid.New(), Amount: amount, Type: models.Deposit, Timestamp: base})
+	}
+	store.AddTransactionWithTime("bob", models.TransactionRecord{ID: uuid.New(), Amount: 5, Type: models.Withdrawal, Timestamp: base.Add(time.Hour)})
+	if err := store.CreateUser("erin"); err != nil {
+		t.Fatalf("Unexpected error creating the user: %v", err)
+	}
+
+	minBalance := 15.0
+
+	tests := []struct {
+		name          string
+		filter        UserFilter
+		page          int
+		pageSize      int
+		expectedUsers []string
+		expectedTotal int
+	}{
+		{"By ID", UserFilter{}, 1, 10, []string{"alice", "bob", "carol", "dave", "erin"}, 5},
+		{"Second page", UserFilter{}, 2, 2, []string{"carol", "dave"}, 5},
+		{"Past the last page", UserFilter{}, 4, 2, []string{}, 5},
+		{"By balance", UserFilter{Sort: SortUsersByBalance}, 1, 10, []string{"carol", "dave", "bob", "alice", "erin"}, 5},
+		{"Minimum balance", UserFilter{MinBalance: &minBalance}, 1, 10, []string{"bob", "carol", "dave"}, 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := store.ListUsers(test.filter, test.page, test.pageSize)
+			if result.TotalCount != test.expectedTotal {
+				t.Errorf("Expected %d users in total, got %d", test.expectedTotal, result.TotalCount)
+			}
+
+			users := make([]string, 0, len(result.Users))
+			for _, user := range result.Users {
+				users = append(users, user.UserID)
+			}
+			if !slices.Equal(users, test.expectedUsers) {
+				t.Errorf("Expected users %v, got %v", test.expectedUsers, users)
+			}
+		})
+	}
+
+	all := store.ListUsers(UserFilter{}, 1, 10).Users
+	if bob := all[1]; bob.Balance != 15 || bob.TransactionCount != 2 || bob.LastActivity == nil || !bob.LastActivity.Equal(base.Add(time.Hour)) {
+		t.Errorf("Unexpected summary of bob: %+v", bob)
+	}
+	if erin := all[4]; erin.TransactionCount != 0 || erin.LastActivity != nil {
+		t.Errorf("Expected no activity for an empty ledger, got %+v", erin)
+	}
+}
+
+func TestLedgerStore_DeleteUser(t *testing.T) {
+	tests := []struct {
+		name            string
+		balance         float64
+		force           bool
+		expectedError   error
+		expectedBalance float64
+	}{
+		{"Empty account", 0, false, nil, 0},
+		{"Funded account", 25, false, ErrBalanceNotZero, 0},
+		{"Forced funded account", 25, true, nil, 25},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewLedgerStore()
+			if err := store.CreateUser("user1"); err != nil {
+				t.Fatalf("Unexpected error creating the user: %v", err)
+			}
+			if test.balance > 0 {
+				if _, err := store.AddTransaction("user1", models.Deposit, test.balance, "salary"); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+
+			balance, err := store.DeleteUser("user1", test.force)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("Expected error %v, got %v", test.expectedError, err)
+			}
+			if test.expectedError != nil {
+				var balanceErr *BalanceNotZeroError
+				if !errors.As(err, &balanceErr) || balanceErr.Balance != test.balance {
+					t.Errorf("Expected the balance %v in the error, got %v", test.balance, err)
+				}
+				if !store.UserExists("user1") {
+					t.Error("Expected the refused user to stay")
+				}
+				return
+			}
+
+			if balance != test.expectedBalance {
+				t.Errorf("Expected balance %v, got %v", test.expectedBalance, balance)
+			}
+			if store.UserExists("user1") || store.GetSystemTotals().UserCount != 0 {
+				t.Error("Expected the user to be gone")
+			}
+		})
+	}
+
+	if _, err := NewLedgerStore().DeleteUser("ghost", true); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("Expected ErrUserNotFound, got %v", err)
+	}
+}
+
+func TestLedgerStore_DeleteUserWithJournals(t *testing.T) {
+	store := NewLedgerStore()
+	if _, err := store.AddTransaction("alice", models.Deposit, 40, "salary"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// alice is back at zero, her leg still balances bob's
+	if _, err := store.Transfer("alice", "bob", 40, "rent"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	for _, force := range []bool{false, true} {
+		if _, err := store.DeleteUser("alice", force); !errors.Is(err, ErrUserHasJournals) {
+			t.Errorf("Expected ErrUserHasJournals with force %v, got %v", force, err)
+		}
+	}
+	if !store.UserExists("alice") {
+		t.Error("Expected the refused user to stay")
+	}
+	if unbalanced := store.UnbalancedJournals(); len(unbalanced) != 0 {
+		t.Errorf("Expected every journal to balance, got %v", unbalanced)
+	}
+
+	if _, err := store.AnonymizeUser("alice", "anon-1", false); err != nil {
+		t.Fatalf("Expected the user to be anonymized, got %v", err)
+	}
+	if unbalanced := store.UnbalancedJournals(); len(unbalanced) != 0 {
+		t.Errorf("Expected every journal to balance after the anonymization, got %v", unbalanced)
+	}
+}
+
+func TestLedgerStore_AnonymizeUser(t *testing.T) {
+	store := NewLedgerStore()
+	deposit, err := store.InsertTransaction("alice", models.TransactionRecord{ID: uuid.New(), Amount: 100, Type: models.Deposit, Timestamp: time.Now(), Description: "salary of Alice", ReferenceID: "inv-1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	journal, err := store.Transfer("alice", "bob", 40, "rent to Bob")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	balance, err := store.AnonymizeUser("alice", "anon-1", false)
+	if !errors.Is(err, ErrBalanceNotZero) {
+		t.Fatalf("Expected ErrBalanceNotZero, got %v", err)
+	}
+	if balance, err = store.AnonymizeUser("alice", "anon-1", true); err != nil || balance != 60 {
+		t.Fatalf("Expected balance 60 and no error, got %v and %v", balance, err)
+	}
+
+	if store.UserExists("alice") {
+		t.Error("Expected alice to be gone")
+	}
+	if got, _ := store.GetBalance("anon-1"); got != 60 {
+		t.Errorf("Expected the token to keep the balance 60, got %v", got)
+	}
+
+	tx, err := store.GetTransaction("anon-1", deposit.ID)
+	if err != nil {
+		t.Fatalf("Expected the deposit under the token, got %v", err)
+	}
+	if tx.Description != "" || tx.ReferenceID != "" || tx.Amount != 100 {
+		t.Errorf("Expected a scrubbed deposit of 100, got %+v", tx)
+	}
+	if _, err := store.FindByReference("anon-1", "inv-1"); !errors.Is(err, ErrTransactionNotFound) {
+		t.Errorf("Expected the reference to be forgotten, got %v", err)
+	}
+
+	entries, err := store.GetJournal(journal.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	users := map[string]bool{}
+	for _, entry := range entries.Entries {
+		users[entry.UserID] = true
+	}
+	if !users["anon-1"] || !users["bob"] || len(users) != 2 {
+		t.Errorf("Expected the journal legs of anon-1 and bob, got %v", users)
+	}
+
+	if _, err := store.AnonymizeUser("bob", "anon-1", true); !errors.Is(err, ErrUserExists) {
+		t.Errorf("Expected ErrUserExists for a taken token, got %v", err)
+	}
+	if totals := store.GetSystemTotals(); totals.TotalBalance != 100 || totals.UserCount != 2 {
+		t.Errorf("Expected the totals to be unchanged, got %+v", totals)
+	}
+}
+
+func TestLedgerStore_InsertTransactions(t *testing.T) {
+	withRef := func(tx models.TransactionRecord, ref string) models.TransactionRecord {
+		tx.ReferenceID = ref
+		return tx
+	}
+
+	tests := []struct {
+		name            string
+		batch           []models.TransactionRecord
+		expectedError   error
+		expectedIndex   int
+		expectedBalance float64
+	}{
+		{
+			"Withdrawal covered by an earlier deposit",
+			[]models.TransactionRecord{
+				models.NewTransactionRecord(models.Deposit, 50, "salary", time.Now()),
+				models.NewTransactionRecord(models.Withdrawal, 60, "rent", time.Now()),
+			},
+			nil, 0, 0,
+		},
+		{
+			"Overdraw midway",
+			[]models.TransactionRecord{
+				models.NewTransactionRecord(models.Deposit, 5, "refund", time.Now()),
+				models.NewTransactionRecord(models.Withdrawal, 10, "groceries", time.Now()),
+				models.NewTransactionRecord(models.Withdrawal, 10, "groceries", time.Now()),
+			},
+			ErrInsufficientFunds, 2, 10,
+		},
+		{
+			"Reference repeated within the batch",
+			[]models.TransactionRecord{
+				withRef(models.NewTransactionRecord(models.Deposit, 5, "a", time.Now()), "ref-1"),
+				withRef(models.NewTransactionRecord(models.Deposit, 5, "b", time.Now()), "ref-1"),
+			},
+			ErrDuplicateReference, 1, 10,
+		},
+		{
+			"Reference already on the ledger",
+			[]models.TransactionRecord{withRef(models.NewTransactionRecord(models.Deposit, 5, "c", time.Now()), "ref-0")},
+			ErrDuplicateReference, 0, 10,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := NewLedgerStore()
+			if _, err := store.InsertTransaction("user1", withRef(models.NewTransactionRecord(models.Deposit, 10, "opening", time.Now()), "ref-0")); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			created, err := store.InsertTransactions("user1", test.batch)
+			if !errors.Is(err, test.expectedError) {
+				t.Fatalf("Expected error %v, got %v", test.expectedError, err)
+			}
+
+			balance, _ := store.GetBalance("user1")
+			if balance != test.expectedBalance {
+				t.Errorf("Expected balance %v, got %v", test.expectedBalance, balance)
+			}
+
+			count := store.CountTransactions("user1", TransactionFilter{})
+			if test.expectedError != nil {
+				var itemErr *ItemError
+				if !errors.As(err, &itemErr) || itemErr.Index != test.expectedIndex {
+					t.Errorf("Expected the error on item %d, got %v", test.expectedIndex, err)
+				}
+				if count != 1 {
+					t.Errorf("Expected nothing of the batch to be applied, got %d transactions", count)
+				}
+				return
+			}
+			if len(created) != len(test.batch) || count != 1+len(test.batch) {
+				t.Errorf("Expected the %d transactions of the batch, got %d", len(test.batch), count-1)
+			}
+		})
+	}
+}
+
+func TestLedgerStore_GetAccountTotals(t *testing.T) {
+	store := NewLedgerStore()
+	if totals := store.GetAccountTotals("user1"); totals.FirstActivity != nil || totals.TransactionCount != 0 {
+		t.Fatalf("Expected empty totals for an unknown user, got %+v", totals)
+	}
+
+	first := time.Date(2024, time.March, 1, 9, 0, 0, 0, time.UTC)
+	store.AddTransactionWithTime("user1", models.TransactionRecord{ID: uuid.New(), Type: models.Deposit, Amount: 100, Timestamp: first})
+	store.AddTransactionWithTime("user1", models.TransactionRecord{ID: uuid.New(), Type: models.Withdrawal, Amount: 30, Fee: 1, Timestamp: first.Add(time.Hour)})
+	voided := models.TransactionRecord{ID: uuid.New(), Type: models.Deposit, Amount: 5, Timestamp: first.Add(2 * time.Hour)}
+	store.AddTransactionWithTime("user1", voided)
+	if _, err := store.VoidTransaction("user1", voided.ID, "typo"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	totals := store.GetAccountTotals("user1")
+	if totals.Balance != 69 || totals.TransactionCount != 2 || totals.DepositCount != 1 || totals.WithdrawalCount != 1 || totals.VoidedCount != 1 {
+		t.Errorf("Unexpected totals: %+v", totals)
+	}
+	if !totals.FirstActivity.Equal(first) || !totals.LastActivity.Equal(first.Add(2*time.Hour)) {
+		t.Errorf("Expected activity from %v to %v, got %v to %v", first, first.Add(2*time.Hour), totals.FirstActivity, totals.LastActivity)
+	}
+}
+
+func TestLedgerStore_Stats(t *testing.T) {
+	store := NewLedgerStore()
+	tx := models.NewTransactionRecord(models.Deposit, 100, "salary", time.Now())
+	tx.ReferenceID = "inv-1"
+	if _, err := store.InsertTransaction("user1", tx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	voided, _ := store.InsertTransaction("user1", models.NewTransactionRecord(models.Deposit, 5, "typo", time.Now()))
+	if _, err := store.VoidTransaction("user1", voided.ID, "typo"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := store.Transfer("user1", "user2", 10, "lunch"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := Stats{Users: 2, Transactions: 4, VoidedTransactions: 1, References: 1, Journals: 1}
+	if got := store.Stats(); got != expected {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestLedgerStore_Version(t *testing.T) {
+	store := NewLedgerStore()
+	if v := store.Version("user1"); v != 0 {
+		t.Errorf("Expected version 0 for an unknown user, got %d", v)
+	}
+
+	deposit, _ := store.InsertTransaction("user1", models.NewTransactionRecord(models.Deposit, 100, "salary", time.Now()))
+	read := store.Version("user1")
+	if read == 0 {
+		t.Fatalf("Expected the deposit to bump the version")
+	}
+
+	// another user's changes leave the version alone, the user's own writes and edits bump it
+	_, _ = store.InsertTransaction("user2", models.NewTransactionRecord(models.Deposit, 1, "other", time.Now()))
+	if v := store.Version("user1"); v != read {
+		t.Errorf("Expected version %d after another user's deposit, got %d", read, v)
+	}
+	if _, err := store.UpdateDescription("user1", deposit.ID, "monthly salary"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	edited := store.Version("user1")
+	if edited <= read {
+		t.Errorf("Expected the edit to bump version %d, got %d", read, edited)
+	}
+
+	var mismatch *VersionMismatchError
+	_, err := store.ReverseTransactionIfVersion("user1", deposit.ID, "refund", read)
+	if !errors.As(err, &mismatch) || mismatch.Current != edited {
+		t.Fatalf("Expected a mismatch at version %d, got %v", edited, err)
+	}
+	if balance, _ := store.GetBalance("user1"); balance != 100 {
+		t.Errorf("Expected the refused reversal to leave the balance at 100, got %v", balance)
+	}
+
+	if _, err := store.ReverseTransactionIfVersion("user1", deposit.ID, "refund", edited); err != nil {
+		t.Fatalf("Expected the reversal at the current version, got %v", err)
+	}
+	if v := store.Version("user1"); v <= edited {
+		t.Errorf("Expected the reversal to bump version %d, got %d", edited, v)
+	}
+}
+
+func TestLedgerStore_ModifiedAt(t *testing.T) {
+	clock := clocktest.NewFake(clocktest.Start)
+	store := NewLedgerStore(WithClock(clock))
+	if modified := store.ModifiedAt("user1"); !modified.IsZero() {
+		t.Errorf("Expected no modification time for an unknown user, got %v", modified)
+	}
+
+	deposit, _ := store.InsertTransaction("user1", models.NewTransactionRecord(models.Deposit, 100, "salary", clock.Now()))
+	if inserted := store.ModifiedAt("user1"); !inserted.Equal(clocktest.Start) {
+		t.Fatalf("Expected the insert to set the modification time to %v, got %v", clocktest.Start, inserted)
+	}
+
+	// an edit changes an old record without adding a newer one
+	edit := clock.Advance(time.Minute)
+	if _, err := store.UpdateDescription("user1", deposit.ID, "monthly salary"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if edited := store.ModifiedAt("user1"); !edited.Equal(edit) {
+		t.Errorf("Expected the edit to move the modification time to %v, got %v", edit, edited)
+	}
+}
+
+func TestPendingHoldsBackTheLaterRecordsOfAUser(t *testing.T) {
+	ledgerStore := NewLedgerStore(WithOutbox())
+	for _, user := range []string{"alice", "bob", "alice"} {
+		ledgerStore.AddTransaction(user, models.Deposit, 1, "")
+	}
+	now := time.Now()
+	first := ledgerStore.OutboxPending(now, 10)[0]
+	ledgerStore.OutboxFailed(first.ID, "down", now.Add(time.Minute), false)
+
+	due := ledgerStore.OutboxPending(now, 10)
+	if len(due) != 1 || due[0].UserID != "bob" {
+		t.Errorf("expected only bob's entry due while alice's first one waits, got %+v", due)
+	}
+}
@@ -0,0 +1,93 @@
+// Package tlsconfig serves TLS from PEM files, with mutual TLS when a client CA is given. the files are read again on
+// Reload, so a renewed certificate is picked up by the next handshake without a restart
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+// Files are the PEM files of the server, ClientCA is optional
+type Files struct {
+	Cert     string
+	Key      string
+	ClientCA string // the CAs the client certificates must chain to, empty serves TLS without client certificates
+}
+
+// Reloader keeps the configuration read from its files, every handshake gets the one of the last successful Reload
+type Reloader struct {
+	files   Files
+	current atomic.Pointer[tls.Config]
+}
+
+// New reads the files once, an error there is an error of the configuration
+func New(files Files) (*Reloader, error) {
+	if files.Cert == "" || files.Key == "" {
+		return nil, errors.New("tlsconfig: a certificate and a key are required")
+	}
+
+	r := &Reloader{files: files}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the files again. on an error the previous configuration is kept, a half-written renewal doesn't take
+// the server down
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.files.Cert, r.files.Key)
+	if err != nil {
+		return fmt.Errorf("tlsconfig: %w", err)
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	if r.files.ClientCA != "" {
+		pem, err := os.ReadFile(r.files.ClientCA)
+		if err != nil {
+			return fmt.Errorf("tlsconfig: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tlsconfig: no certificate in %s", r.files.ClientCA)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	r.current.Store(config)
+	return nil
+}
+
+// Config is the configuration of the server, it hands every handshake the current one
+func (r *Reloader) Config() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// Identity names the owner of a client certificate: its common name, else its first DNS name, email address or URI.
+// empty when the certificate has none of them
+func Identity(cert *x509.Certificate) string {
+	switch {
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0]
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0]
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String()
+	}
+	return ""
+}
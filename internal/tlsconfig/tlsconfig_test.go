@@ -0,0 +1,154 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tiny-ledger/internal/tlsconfig/tlstest"
+)
+
+// serve starts a TLS server on the configuration of the reloader that answers with the identity of the client
+func serve(t *testing.T, reloader *Reloader) *httptest.Server {
+	t.Helper()
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.VerifiedChains) > 0 {
+			w.Write([]byte(Identity(r.TLS.VerifiedChains[0][0])))
+		}
+	}))
+	ts.TLS = reloader.Config()
+	ts.StartTLS()
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func client(ca *tlstest.CA, certs ...tls.Certificate) *http.Client {
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.Pool(), Certificates: certs}}}
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCA, clientCA, strangerCA := tlstest.NewCA("server CA"), tlstest.NewCA("client CA"), tlstest.NewCA("stranger CA")
+	certFile, keyFile := tlstest.WriteFiles(dir, serverCA.Server())
+	caFile := filepath.Join(dir, "clients.pem")
+	if err := os.WriteFile(caFile, clientCA.PEM(), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reloader, err := New(Files{Cert: certFile, Key: keyFile, ClientCA: caFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ts := serve(t, reloader)
+
+	resp, err := client(serverCA, clientCA.Client("partner-service")).Get(ts.URL)
+	if err != nil {
+		t.Fatalf("expected the trusted client to get through, got %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "partner-service" {
+		t.Errorf("expected the identity partner-service, got %q", body)
+	}
+
+	for name, c := range map[string]*http.Client{
+		"untrusted certificate": client(serverCA, strangerCA.Client("partner-service")),
+		"no certificate":        client(serverCA),
+	} {
+		if resp, err := c.Get(ts.URL); err == nil {
+			resp.Body.Close()
+			t.Errorf("%s: expected the handshake to fail, got %d", name, resp.StatusCode)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := tlstest.NewCA("server CA")
+	first := ca.Server()
+	certFile, keyFile := tlstest.WriteFiles(dir, first)
+
+	reloader, err := New(Files{Cert: certFile, Key: keyFile})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ts := serve(t, reloader)
+	served := func() *x509.Certificate {
+		t.Helper()
+		// a new transport, so a new handshake
+		resp, err := client(ca).Get(ts.URL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		resp.Body.Close()
+		return resp.TLS.PeerCertificates[0]
+	}
+	if !served().Equal(first.Leaf) {
+		t.Fatal("expected the first certificate")
+	}
+
+	renewed := ca.Server()
+	tlstest.WriteFiles(dir, renewed)
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !served().Equal(renewed.Leaf) {
+		t.Error("expected the renewed certificate after the reload")
+	}
+
+	// a broken renewal keeps the certificate being served
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := reloader.Reload(); err == nil {
+		t.Error("expected the broken key to be reported")
+	}
+	if !served().Equal(renewed.Leaf) {
+		t.Error("expected the renewed certificate to still be served")
+	}
+}
+
+func TestNewRejectsBadFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := tlstest.WriteFiles(dir, tlstest.NewCA("server CA").Server())
+	notPEM := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(notPEM, []byte("nothing here"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for name, files := range map[string]Files{
+		"no key":             {Cert: certFile},
+		"missing cert":       {Cert: filepath.Join(dir, "missing.pem"), Key: keyFile},
+		"CA without a cert":  {Cert: certFile, Key: keyFile, ClientCA: notPEM},
+		"missing CA":         {Cert: certFile, Key: keyFile, ClientCA: filepath.Join(dir, "missing.pem")},
+		"key in place of CA": {Cert: certFile, Key: keyFile, ClientCA: keyFile},
+	} {
+		if _, err := New(files); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://ledger/partner")
+	tests := []struct {
+		cert     x509.Certificate
+		expected string
+	}{
+		{x509.Certificate{DNSNames: []string{"partner.internal"}, EmailAddresses: []string{"ops@example.com"}}, "partner.internal"},
+		{x509.Certificate{EmailAddresses: []string{"ops@example.com"}}, "ops@example.com"},
+		{x509.Certificate{URIs: []*url.URL{spiffe}}, "spiffe://ledger/partner"},
+		{x509.Certificate{}, ""},
+	}
+	for _, tt := range tests {
+		if identity := Identity(&tt.cert); identity != tt.expected {
+			t.Errorf("expected %q, got %q", tt.expected, identity)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+// Package webhook POSTs the transaction events of the ledger to the configured endpoints. every target has its own
+// queue and worker so a slow or failing endpoint never holds up the others, and nothing here ever blocks a write
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/clock"
+	"tiny-ledger/internal/metrics"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+)
+
+const (
+	// SignatureHeader is "sha256=" followed by the hex HMAC-SHA256 of the body with the shared secret
+	SignatureHeader = "X-Ledger-Signature"
+	// DeliveryHeader is the ID of the event, the same on every attempt so receivers can drop duplicates
+	DeliveryHeader = "X-Ledger-Delivery"
+)
+
+type Config struct {
+	URLs   []string
+	Secret []byte
+
+	MaxAttempts    int           // including the first one, 5 by default
+	InitialBackoff time.Duration // before the first retry, doubled on every retry up to MaxBackoff. 500ms by default
+	MaxBackoff     time.Duration // 30s by default
+	Timeout        time.Duration // of a single attempt, 5s by default
+	QueueSize      int           // pending events per target, further events are dropped. 1000 by default
+
+	Client  *http.Client // a plain http.Client when nil
+	Logger  *slog.Logger // slog.Default() when nil
+	Metrics *metrics.Metrics
+	Clock   clock.Clock // of the payload timestamps, clock.Real when nil
+}
+
+// Payload is the body of every POST
+type Payload struct {
+	ID          uuid.UUID                `json:"id"`
+	Event       string                   `json:"event"`            // transaction.deposit or transaction.withdrawal
+	Tenant      string                   `json:"tenant,omitempty"` // in multi-tenant mode
+	UserID      string                   `json:"userId"`
+	Transaction models.TransactionRecord `json:"transaction"`
+	Balance     float64                  `json:"balance"` // of the user right after the transaction
+	Timestamp   time.Time                `json:"timestamp"`
+}
+
+type Dispatcher struct {
+	config Config
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.RWMutex
+	targets []*target // replaced by SetURLs
+}
+
+type target struct {
+	url    string
+	queue  chan Payload
+	cancel context.CancelFunc // stops the worker of a target SetURLs removed
+}
+
+// New starts one worker per URL, Close stops them
+func New(config Config) (*Dispatcher, error) {
+	if err := validateURLs(config.URLs); err != nil {
+		return nil, err
+	}
+	if len(config.Secret) == 0 {
+		return nil, errors.New("webhook: the signing secret is required")
+	}
+
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 5
+	}
+	if config.InitialBackoff <= 0 {
+		config.InitialBackoff = 500 * time.Millisecond
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = 30 * time.Second
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.QueueSize < 1 {
+		config.QueueSize = 1000
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{}
+	}
+	if config.Clock == nil {
+		config.Clock = clock.Real
+	}
+	if config.Logger == nil {
+		config.Logger = slog.Default()
+	}
+
+	d := &Dispatcher{config: config}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	for _, u := range config.URLs {
+		d.targets = append(d.targets, d.start(u))
+	}
+	return d, nil
+}
+
+func validateURLs(urls []string) error {
+	if len(urls) == 0 {
+		return errors.New("webhook: no target URL")
+	}
+	for _, raw := range urls {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("webhook: invalid target URL %q", raw)
+		}
+	}
+	return nil
+}
+
+// start runs the worker of a new target
+func (d *Dispatcher) start(targetURL string) *target {
+	ctx, cancel := context.WithCancel(d.ctx)
+	t := &target{url: targetURL, queue: make(chan Payload, d.config.QueueSize), cancel: cancel}
+	d.wg.Add(1)
+	go d.run(ctx, t)
+	return t
+}
+
+// SetURLs replaces the targets, e.g. on a reload of the config. a URL that stays keeps its queue, a new one starts
+// with the next event and the events still queued for a removed one are dropped
+func (d *Dispatcher) SetURLs(urls []string) error {
+	if err := validateURLs(urls); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	current := make(map[string]*target, len(d.targets))
+	for _, t := range d.targets {
+		current[t.url] = t
+	}
+	targets := make([]*target, 0, len(urls))
+	for _, u := range urls {
+		if t, ok := current[u]; ok {
+			delete(current, u)
+			targets = append(targets, t)
+			continue
+		}
+		targets = append(targets, d.start(u))
+	}
+	for _, removed := range current {
+		removed.cancel()
+	}
+	d.targets = targets
+	return nil
+}
+
+// Handle queues the event for every target, it's meant to be passed to LedgerService.Subscribe
+func (d *Dispatcher) Handle(event services.TransactionEvent) {
+	d.enqueue("", event)
+}
+
+// HandleTenant is Handle for the ledger of a tenant, the payloads name the tenant
+func (d *Dispatcher) HandleTenant(tenant string) func(services.TransactionEvent) {
+	return func(event services.TransactionEvent) {
+		d.enqueue(tenant, event)
+	}
+}
+
+func newPayload(id uuid.UUID, tenant string, event services.TransactionEvent, timestamp time.Time) Payload {
+	return Payload{
+		ID:          id,
+		Event:       "transaction." + string(event.Transaction.Type),
+		Tenant:      tenant,
+		UserID:      event.UserID,
+		Transaction: event.Transaction,
+		Balance:     event.Balance,
+		Timestamp:   timestamp.UTC(),
+	}
+}
+
+func (d *Dispatcher) enqueue(tenant string, event services.TransactionEvent) {
+	payload := newPayload(uuid.New(), tenant, event, d.config.Clock.Now())
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, t := range d.targets {
+		select {
+		case t.queue <- payload:
+		default:
+			d.config.Metrics.ObserveWebhookDelivery(metrics.DeliveryDropped)
+			d.config.Logger.Warn("webhook queue full, event dropped", "url", t.url, "delivery", payload.ID)
+		}
+	}
+}
+
+// Deliver POSTs the event to every target once, bypassing the queues, for a caller that keeps the event and retries
+// on its own like the outbox. id is the delivery ID, the same on every call for the event so the targets that got it
+// already drop the repeat. the error is of the first target that failed, the others are POSTed anyway
+func (d *Dispatcher) Deliver(ctx context.Context, id uuid.UUID, event services.TransactionEvent, timestamp time.Time) error {
+	payload := newPayload(id, "", event, timestamp)
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	signature := Sign(d.config.Secret, body)
+
+	d.mu.RLock()
+	targets := d.targets
+	d.mu.RUnlock()
+	var first error
+	for _, t := range targets {
+		err := d.post(ctx, t.url, id, body, signature)
+		d.config.Metrics.ObserveWebhookAttempt(err == nil)
+		if err != nil && first == nil {
+			first = fmt.Errorf("%s: %w", t.url, err)
+		}
+	}
+	return first
+}
+
+// Close stops the workers, a retry waiting for its backoff is abandoned and the queued events are dropped
+func (d *Dispatcher) Close() {
+	d.cancel()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) run(ctx context.Context, t *target) {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case payload := <-t.queue:
+			d.deliver(ctx, t.url, payload)
+		}
+	}
+}
+
+// deliver POSTs the payload until it's accepted or MaxAttempts is reached, waiting a doubling backoff in between.
+// ctx is the target's, it's done on Close and when SetURLs removes the target
+func (d *Dispatcher) deliver(ctx context.Context, targetURL string, payload Payload) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.config.Logger.Error("encoding webhook payload", "delivery", payload.ID, "error", err)
+		d.config.Metrics.ObserveWebhookDelivery(metrics.DeliveryFailed)
+		return
+	}
+	signature := Sign(d.config.Secret, body)
+
+	backoff := d.config.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := d.post(ctx, targetURL, payload.ID, body, signature)
+		d.config.Metrics.ObserveWebhookAttempt(err == nil)
+		if err == nil {
+			d.config.Metrics.ObserveWebhookDelivery(metrics.DeliveryDelivered)
+			return
+		}
+
+		var permanent *permanentError
+		if attempt >= d.config.MaxAttempts || errors.As(err, &permanent) {
+			d.config.Logger.Error("webhook delivery failed", "url", targetURL, "delivery", payload.ID, "attempts", attempt, "error", err)
+			d.config.Metrics.ObserveWebhookDelivery(metrics.DeliveryFailed)
+			return
+		}
+		d.config.Logger.Warn("webhook attempt failed, retrying", "url", targetURL, "delivery", payload.ID, "attempt", attempt, "backoff", backoff, "error", err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, d.config.MaxBackoff)
+	}
+}
+
+// permanentError is a failure a retry won't change, e.g. a 400 or 404 answer
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (d *Dispatcher) post(ctx context.Context, targetURL string, id uuid.UUID, body []byte, signature string) error {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, signature)
+	req.Header.Set(DeliveryHeader, id.String())
+
+	resp, err := d.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	// drained so the connection is reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return fmt.Errorf("target answered %d", resp.StatusCode)
+	default:
+		return &permanentError{err: fmt.Errorf("target answered %d", resp.StatusCode)}
+	}
+}
+
+// Sign is the value of SignatureHeader for the body, receivers compare it with hmac.Equal
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
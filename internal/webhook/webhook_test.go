@@ -0,0 +1,275 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/metrics"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+var (
+	testSecret    = []byte("webhook-secret")
+	discardLogger = slog.New(slog.NewTextHandler(io.Discard, nil))
+)
+
+type receivedRequest struct {
+	body      []byte
+	signature string
+	delivery  string
+}
+
+// flakyEndpoint answers the statuses in turn, the last one is repeated
+type flakyEndpoint struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedRequest
+	arrived  chan struct{}
+}
+
+func newFlakyEndpoint(t *testing.T, statuses ...int) (*flakyEndpoint, *httptest.Server) {
+	e := &flakyEndpoint{statuses: statuses, arrived: make(chan struct{}, 100)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		e.mu.Lock()
+		e.requests = append(e.requests, receivedRequest{body: body, signature: r.Header.Get(SignatureHeader), delivery: r.Header.Get(DeliveryHeader)})
+		status := e.statuses[min(len(e.requests), len(e.statuses))-1]
+		e.mu.Unlock()
+
+		w.WriteHeader(status)
+		e.arrived <- struct{}{}
+	}))
+	t.Cleanup(server.Close)
+	return e, server
+}
+
+func (e *flakyEndpoint) waitFor(t *testing.T, n int) []receivedRequest {
+	t.Helper()
+
+	for range n {
+		select {
+		case <-e.arrived:
+		case <-time.After(2 * time.Second):
+			t.Fatalf("expected %d requests in time", n)
+		}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]receivedRequest(nil), e.requests...)
+}
+
+func scrape(m *metrics.Metrics) string {
+	rr := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rr, httptest.NewRequest("GET", "/metrics", nil))
+	return rr.Body.String()
+}
+
+// waitForMetrics polls the scrape, the counters are updated right after the endpoint answers
+func waitForMetrics(t *testing.T, m *metrics.Metrics, want ...string) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		body := scrape(m)
+		missing := ""
+		for _, w := range want {
+			if !strings.Contains(body, w) {
+				missing = w
+				break
+			}
+		}
+		if missing == "" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %q in the scrape", missing)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestDispatcher(t *testing.T, m *metrics.Metrics, urls ...string) *Dispatcher {
+	t.Helper()
+
+	d, err := New(Config{URLs: urls, Secret: testSecret, MaxAttempts: 4, InitialBackoff: time.Millisecond, Metrics: m, Logger: discardLogger})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(d.Close)
+	return d
+}
+
+func TestDeliveryRetriesAFlakyEndpoint(t *testing.T) {
+	endpoint, server := newFlakyEndpoint(t, http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK)
+	m := metrics.New(func() (int, float64) { return 0, 0 })
+	d := newTestDispatcher(t, m, server.URL)
+
+	svc := services.NewLedgerService(store.NewLedgerStore())
+	svc.Subscribe(d.Handle)
+	tx, err := svc.RecordTransaction("hooked", models.Deposit, 42, "salary")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	requests := endpoint.waitFor(t, 3)
+	for i, req := range requests {
+		if !hmac.Equal([]byte(req.signature), []byte(Sign(testSecret, req.body))) {
+			t.Errorf("attempt %d: the signature doesn't match the body", i+1)
+		}
+		if req.delivery == "" || req.delivery != requests[0].delivery {
+			t.Errorf("attempt %d: expected the delivery ID %q, got %q", i+1, requests[0].delivery, req.delivery)
+		}
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(requests[2].body, &payload); err != nil {
+		t.Fatalf("could not parse the payload: %v", err)
+	}
+	if payload.Event != "transaction.deposit" || payload.UserID != "hooked" || payload.Transaction.ID != tx.ID || payload.Balance != 42 {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+	if payload.ID.String() != requests[2].delivery || payload.Timestamp.IsZero() {
+		t.Errorf("expected the delivery ID and a timestamp in the payload, got %+v", payload)
+	}
+
+	waitForMetrics(t, m,
+		`ledger_webhook_attempts_total{result="failure"} 2`,
+		`ledger_webhook_attempts_total{result="success"} 1`,
+		`ledger_webhook_deliveries_total{outcome="delivered"} 1`,
+	)
+}
+
+func TestHandleTenant(t *testing.T) {
+	endpoint, server := newFlakyEndpoint(t, http.StatusOK)
+	d := newTestDispatcher(t, nil, server.URL)
+
+	svc := services.NewLedgerService(store.NewLedgerStore())
+	svc.Subscribe(d.HandleTenant("staging"))
+	if _, err := svc.RecordTransaction("hooked", models.Deposit, 42, "salary"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(endpoint.waitFor(t, 1)[0].body, &payload); err != nil {
+		t.Fatalf("could not parse the payload: %v", err)
+	}
+	if payload.Tenant != "staging" || payload.UserID != "hooked" {
+		t.Errorf("expected the tenant in the payload, got %+v", payload)
+	}
+}
+
+func TestSetURLs(t *testing.T) {
+	first, firstServer := newFlakyEndpoint(t, http.StatusOK)
+	second, secondServer := newFlakyEndpoint(t, http.StatusOK)
+	d := newTestDispatcher(t, nil, firstServer.URL)
+
+	svc := services.NewLedgerService(store.NewLedgerStore())
+	svc.Subscribe(d.Handle)
+	svc.RecordTransaction("hooked", models.Deposit, 1, "")
+	first.waitFor(t, 1)
+
+	if err := d.SetURLs([]string{secondServer.URL}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svc.RecordTransaction("hooked", models.Deposit, 2, "")
+	second.waitFor(t, 1)
+	if requests := first.waitFor(t, 0); len(requests) != 1 {
+		t.Errorf("expected the removed target to get nothing more, got %d requests", len(requests))
+	}
+
+	if err := d.SetURLs([]string{"ftp://example.com"}); err == nil {
+		t.Error("expected an invalid URL to be rejected")
+	}
+}
+
+func TestDeliveryGivesUp(t *testing.T) {
+	tests := []struct {
+		name             string
+		status           int
+		expectedAttempts int
+	}{
+		{"Server error until the last attempt", http.StatusInternalServerError, 4},
+		{"Rejected payload", http.StatusBadRequest, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			endpoint, server := newFlakyEndpoint(t, tt.status)
+			m := metrics.New(func() (int, float64) { return 0, 0 })
+			d := newTestDispatcher(t, m, server.URL)
+
+			d.Handle(services.TransactionEvent{UserID: "hooked", Transaction: models.TransactionRecord{Type: models.Withdrawal, Amount: 5}})
+			endpoint.waitFor(t, tt.expectedAttempts)
+			waitForMetrics(t, m, `ledger_webhook_deliveries_total{outcome="failed"} 1`)
+
+			// no attempt past the limit
+			select {
+			case <-endpoint.arrived:
+				t.Errorf("expected no more than %d attempts", tt.expectedAttempts)
+			case <-time.After(50 * time.Millisecond):
+			}
+		})
+	}
+}
+
+func TestHandleNeverBlocks(t *testing.T) {
+	inFlight, release := make(chan struct{}, 1), make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inFlight <- struct{}{}
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	m := metrics.New(func() (int, float64) { return 0, 0 })
+	d, err := New(Config{URLs: []string{server.URL}, Secret: testSecret, QueueSize: 2, Metrics: m, Logger: discardLogger})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	t.Cleanup(d.Close)
+
+	event := services.TransactionEvent{UserID: "hooked", Transaction: models.TransactionRecord{Type: models.Deposit, Amount: 1}}
+	d.Handle(event)
+	<-inFlight
+
+	start := time.Now()
+	for range 9 {
+		d.Handle(event)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("expected Handle to return at once with a stuck endpoint, took %v", elapsed)
+	}
+	// the first event is stuck in flight, two are queued
+	waitForMetrics(t, m, `ledger_webhook_deliveries_total{outcome="dropped"} 7`)
+}
+
+func TestNewValidatesTheConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{"No URL", Config{Secret: testSecret}},
+		{"No secret", Config{URLs: []string{"https://example.com/hook"}}},
+		{"Relative URL", Config{URLs: []string{"/hook"}, Secret: testSecret}},
+		{"Unsupported scheme", Config{URLs: []string{"ftp://example.com/hook"}, Secret: testSecret}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.config); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,348 @@
+// Package client is the Go client of the ledger HTTP API. it speaks the JSON API under /v1, follows the cursors of
+// the history, retries what is safe to retry and turns the error bodies into *Error, so callers don't hand-roll
+// requests:
+//
+//	c, err := client.New("https://ledger.internal", client.WithAPIKey(key))
+//	tx, err := c.RecordTransaction(ctx, "alice", client.TransactionInput{Type: client.Deposit, Amount: 10})
+//	if errors.Is(err, client.ErrInsufficientFunds) { ... }
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// transaction types
+const (
+	Deposit    = "deposit"
+	Withdrawal = "withdrawal"
+)
+
+// defaults of the options
+const (
+	DefaultTimeout      = 30 * time.Second
+	DefaultRetries      = 2
+	DefaultRetryBackoff = 200 * time.Millisecond
+)
+
+type Client struct {
+	baseURL *url.URL // with the /v1 prefix
+	apiKey  string
+	http    *http.Client
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+type Option func(*Client)
+
+// WithAPIKey sends the key as the bearer token of every request
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.apiKey = key
+	}
+}
+
+// WithHTTPClient replaces http.DefaultClient, e.g. for a custom transport
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.http = httpClient
+	}
+}
+
+// WithTimeout bounds each attempt of a request, zero leaves it to the context of the call
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithRetries retries a request up to max more times when the server is unreachable, overloaded or rate limited,
+// waiting backoff doubled on every attempt (or the Retry-After of the server). a POST is retried with the same
+// idempotency key so it's recorded at most once. zero disables the retries
+func WithRetries(max int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.backoff = max, backoff
+	}
+}
+
+// New talks to the server at baseURL, e.g. https://ledger.internal. the API version prefix is added by the client
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("client: invalid base URL: %w", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("client: base URL %q must be an absolute http or https URL", baseURL)
+	}
+	parsed.Path += "/v1"
+
+	c := &Client{baseURL: parsed, http: http.DefaultClient, timeout: DefaultTimeout, retries: DefaultRetries, backoff: DefaultRetryBackoff}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+type Transaction struct {
+	ID          uuid.UUID `json:"id"`
+	Amount      float64   `json:"amount"`
+	Fee         float64   `json:"fee,omitempty"`
+	Type        string    `json:"type"`
+	Timestamp   time.Time `json:"timestamp"`
+	Description string    `json:"description,omitempty"`
+	ReferenceID string    `json:"referenceId,omitempty"`
+	Voided      bool      `json:"voided,omitempty"`
+}
+
+type TransactionInput struct {
+	Type        string  `json:"type"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description,omitempty"`
+	ReferenceID string  `json:"referenceId,omitempty"` // external reference, unique per user: a second one is ErrDuplicate
+	// IdempotencyKey makes a repeated call return the first transaction instead of recording another one, a random
+	// key is used when empty so the retries of one call are safe
+	IdempotencyKey string `json:"-"`
+}
+
+type Balance struct {
+	Balance          float64   `json:"balance"`
+	AvailableBalance float64   `json:"availableBalance"`
+	Currency         string    `json:"currency"`
+	AsOf             time.Time `json:"asOf"`
+	Exists           bool      `json:"exists"`
+}
+
+type TransferInput struct {
+	ToUserID       string  `json:"toUserId"`
+	Amount         float64 `json:"amount"`
+	Description    string  `json:"description,omitempty"`
+	IdempotencyKey string  `json:"-"` // like the one of TransactionInput
+}
+
+type Transfer struct {
+	TransferID uuid.UUID   `json:"transferId"`
+	Debit      Transaction `json:"debit"`
+	Credit     Transaction `json:"credit"`
+	Balance    float64     `json:"balance"` // of the sender right after the transfer
+}
+
+// ListOptions narrow the history down, the zero value lists everything oldest first
+type ListOptions struct {
+	Last       string // a rolling window up to now, e.g. 7d or 36h
+	Type       string // Deposit or Withdrawal
+	Descending bool   // newest first
+	Limit      int    // per page, the server default when zero
+	Cursor     string // of the page to read, from TransactionPage.NextCursor
+}
+
+// TransactionPage is a page of the history, NextCursor is empty on the last one
+type TransactionPage struct {
+	Transactions []Transaction
+	NextCursor   string
+}
+
+// RecordTransaction records a deposit or a withdrawal of the user
+func (c *Client) RecordTransaction(ctx context.Context, userID string, input TransactionInput) (Transaction, error) {
+	var tx Transaction
+	err := c.do(ctx, "POST", "/users/"+url.PathEscape(userID)+"/transactions", nil, input, orRandom(input.IdempotencyKey), &tx)
+	return tx, err
+}
+
+// RecordBatch records up to 100 transactions of the user in order, all or nothing. the rejected ones are the Items
+// of the *Error. a batch has no idempotency key, it's only retried when every transaction has a ReferenceID: a
+// batch recorded by a lost attempt is then rejected as ErrDuplicate rather than recorded twice
+func (c *Client) RecordBatch(ctx context.Context, userID string, inputs []TransactionInput) ([]Transaction, error) {
+	retryable := len(inputs) > 0
+	for _, input := range inputs {
+		retryable = retryable && input.ReferenceID != ""
+	}
+	var body struct {
+		Transactions []Transaction `json:"transactions"`
+	}
+	request := struct {
+		Transactions []TransactionInput `json:"transactions"`
+	}{inputs}
+	err := c.doRetryable(ctx, "POST", "/users/"+url.PathEscape(userID)+"/transactions/batch", nil, request, "", retryable, &body)
+	return body.Transactions, err
+}
+
+func (c *Client) GetBalance(ctx context.Context, userID string) (Balance, error) {
+	var balance Balance
+	err := c.do(ctx, "GET", "/users/"+url.PathEscape(userID)+"/balance", nil, nil, "", &balance)
+	return balance, err
+}
+
+// ListTransactions reads one page of the history of the user, pass its NextCursor in opts for the next one
+func (c *Client) ListTransactions(ctx context.Context, userID string, opts ListOptions) (TransactionPage, error) {
+	query := url.Values{}
+	if opts.Last != "" {
+		query.Set("last", opts.Last)
+	}
+	if opts.Type != "" {
+		query.Set("type", opts.Type)
+	}
+	if opts.Descending {
+		query.Set("order", "desc")
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+	if !query.Has("limit") && !query.Has("cursor") {
+		// a cursor walk rather than numbered pages, the pages don't shift under concurrent writes
+		query.Set("limit", "50")
+	}
+
+	var body struct {
+		Transactions []Transaction `json:"transactions"`
+		Pagination   struct {
+			NextCursor string `json:"nextCursor"`
+		} `json:"pagination"`
+	}
+	if err := c.do(ctx, "GET", "/users/"+url.PathEscape(userID)+"/transactions", query, nil, "", &body); err != nil {
+		return TransactionPage{}, err
+	}
+	return TransactionPage{Transactions: body.Transactions, NextCursor: body.Pagination.NextCursor}, nil
+}
+
+// AllTransactions iterates over the whole history of the user, reading the pages as it goes. opts.Limit is the size
+// of the pages, an error ends the iteration:
+//
+//	for tx, err := range c.AllTransactions(ctx, "alice", client.ListOptions{Last: "7d"}) {
+//		if err != nil { ... }
+//	}
+func (c *Client) AllTransactions(ctx context.Context, userID string, opts ListOptions) iter.Seq2[Transaction, error] {
+	return func(yield func(Transaction, error) bool) {
+		for {
+			page, err := c.ListTransactions(ctx, userID, opts)
+			if err != nil {
+				yield(Transaction{}, err)
+				return
+			}
+			for _, tx := range page.Transactions {
+				if !yield(tx, nil) {
+					return
+				}
+			}
+			if page.NextCursor == "" {
+				return
+			}
+			opts.Cursor = page.NextCursor
+		}
+	}
+}
+
+// Transfer moves an amount from one user to another, both legs are recorded together or not at all
+func (c *Client) Transfer(ctx context.Context, fromUserID string, input TransferInput) (Transfer, error) {
+	var transfer Transfer
+	err := c.do(ctx, "POST", "/users/"+url.PathEscape(fromUserID)+"/transfers", nil, input, orRandom(input.IdempotencyKey), &transfer)
+	return transfer, err
+}
+
+// orRandom is the idempotency key of a POST, a random one when the caller didn't choose one
+func orRandom(idempotencyKey string) string {
+	if idempotencyKey == "" {
+		return uuid.NewString()
+	}
+	return idempotencyKey
+}
+
+// do sends the request with body as JSON and decodes a 2xx response into out, anything else is an *Error. a POST
+// is only retried with an idempotency key
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body any, idempotencyKey string, out any) error {
+	return c.doRetryable(ctx, method, path, query, body, idempotencyKey, method != "POST" || idempotencyKey != "", out)
+}
+
+// doRetryable is do, retrying the request as many times as the client allows when safe is set
+func (c *Client) doRetryable(ctx context.Context, method, path string, query url.Values, body any, idempotencyKey string, safe bool, out any) error {
+	target := *c.baseURL
+	target.Path += path
+	target.RawQuery = query.Encode()
+
+	var encoded []byte
+	if body != nil {
+		var err error
+		if encoded, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("client: %w", err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		retryable, err := c.attempt(ctx, method, target.String(), encoded, idempotencyKey, out)
+		if err == nil || !retryable || !safe || attempt >= c.retries || ctx.Err() != nil {
+			return err
+		}
+		timer := time.NewTimer(c.wait(attempt, err))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends the request once, retryable is whether it failed in a way another attempt may not
+func (c *Client) attempt(ctx context.Context, method, target string, body []byte, idempotencyKey string, out any) (retryable bool, err error) {
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("client: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// the server may have recorded it, the idempotency key makes the next attempt safe
+		return true, fmt.Errorf("client: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		e := newError(resp)
+		return e.Temporary(), e
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return false, fmt.Errorf("client: decoding the response of %s %s: %w", method, req.URL.Path, err)
+	}
+	return false, nil
+}
+
+// wait is the pause before the next attempt: the backoff doubled on every attempt with some jitter so the clients
+// don't retry in lockstep, or the Retry-After of the server when it asks for longer
+func (c *Client) wait(attempt int, err error) time.Duration {
+	backoff := c.backoff << attempt
+	backoff += rand.N(backoff/2 + 1)
+	if e, ok := err.(*Error); ok && e.RetryAfter > backoff {
+		return e.RetryAfter
+	}
+	return backoff
+}
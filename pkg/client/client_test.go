@@ -0,0 +1,316 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/auth"
+	"tiny-ledger/internal/auth/authtest"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+
+	"github.com/gorilla/mux"
+)
+
+// newLedger is the real handler stack with bearer token auth
+func newLedger(t *testing.T) http.Handler {
+	t.Helper()
+	verifier, err := auth.NewVerifier(auth.Config{HMACSecret: authtest.Secret})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	router := mux.NewRouter()
+	router.Use(handlers.RequestIDMiddleware)
+	handlers.NewLedgerHandler(services.NewLedgerService(store.NewLedgerStore()), slog.New(slog.NewTextHandler(io.Discard, nil)),
+		handlers.WithAuth(verifier)).RegisterRoutes(router, handlers.APIPrefix)
+	return router
+}
+
+// newClient serves handler and returns a client of it acting as the subject, retries don't wait
+func newClient(t *testing.T, handler http.Handler, subject string, opts ...Option) *Client {
+	t.Helper()
+	ts := httptest.NewServer(handler)
+	t.Cleanup(ts.Close)
+
+	opts = append([]Option{WithAPIKey(authtest.Token(authtest.Secret, subject)), WithRetries(DefaultRetries, time.Millisecond)}, opts...)
+	c, err := New(ts.URL, opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return c
+}
+
+func TestNew(t *testing.T) {
+	for _, baseURL := range []string{"", "localhost:8080", "ftp://ledger", "http://"} {
+		if _, err := New(baseURL); err == nil {
+			t.Errorf("expected %q to be rejected", baseURL)
+		}
+	}
+	c, err := New("https://ledger.internal/")
+	if err != nil || c.baseURL.String() != "https://ledger.internal/v1" {
+		t.Errorf("expected the /v1 prefix, got %v %v", c.baseURL, err)
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, newLedger(t), "alice")
+
+	tx, err := c.RecordTransaction(ctx, "alice", TransactionInput{Type: Deposit, Amount: 100, Description: "salary"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tx.Type != Deposit || tx.Amount != 100 || tx.Description != "salary" || tx.Timestamp.IsZero() {
+		t.Errorf("unexpected transaction %+v", tx)
+	}
+
+	transfer, err := c.Transfer(ctx, "alice", TransferInput{ToUserID: "bob", Amount: 30, Description: "rent"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if transfer.Debit.Type != Withdrawal || transfer.Credit.Type != Deposit || transfer.Credit.Amount != 30 || transfer.Balance != 70 {
+		t.Errorf("unexpected transfer %+v", transfer)
+	}
+
+	balance, err := c.GetBalance(ctx, "alice")
+	if err != nil || balance.Balance != 70 || !balance.Exists {
+		t.Errorf("expected a balance of 70, got %+v %v", balance, err)
+	}
+
+	page, err := c.ListTransactions(ctx, "alice", ListOptions{Type: Withdrawal})
+	if err != nil || len(page.Transactions) != 1 || page.Transactions[0].Amount != 30 || page.NextCursor != "" {
+		t.Errorf("expected the withdrawal of the transfer, got %+v %v", page, err)
+	}
+}
+
+func TestRecordBatch(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, newLedger(t), "alice")
+
+	txs, err := c.RecordBatch(ctx, "alice", []TransactionInput{
+		{Type: Deposit, Amount: 100, ReferenceID: "import-1"},
+		{Type: Withdrawal, Amount: 40, ReferenceID: "import-2"},
+	})
+	if err != nil || len(txs) != 2 || txs[0].ReferenceID != "import-1" || txs[1].Amount != 40 {
+		t.Fatalf("expected both records in order, got %+v %v", txs, err)
+	}
+
+	var apiErr *Error
+	_, err = c.RecordBatch(ctx, "alice", []TransactionInput{{Type: Deposit, Amount: 5}, {Type: Withdrawal, Amount: 500}})
+	if !errors.Is(err, ErrInsufficientFunds) || !errors.As(err, &apiErr) || len(apiErr.Items) != 1 || apiErr.Items[0].Index != 1 {
+		t.Errorf("expected item 1 to be rejected, got %+v", err)
+	}
+	_, err = c.RecordBatch(ctx, "alice", []TransactionInput{{Type: Deposit, Amount: 5, ReferenceID: "import-1"}})
+	if !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected the reference to be taken, got %v", err)
+	}
+}
+
+func TestAllTransactions(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, newLedger(t), "alice")
+	for i := 1; i <= 7; i++ {
+		if _, err := c.RecordTransaction(ctx, "alice", TransactionInput{Type: Deposit, Amount: float64(i)}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// pages of 3 are read until the last one
+	var amounts []float64
+	for tx, err := range c.AllTransactions(ctx, "alice", ListOptions{Descending: true, Limit: 3}) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		amounts = append(amounts, tx.Amount)
+	}
+	if len(amounts) != 7 || amounts[0] != 7 || amounts[6] != 1 {
+		t.Errorf("expected the 7 deposits newest first, got %v", amounts)
+	}
+
+	// breaking out stops reading
+	read := 0
+	for range c.AllTransactions(ctx, "alice", ListOptions{Limit: 3}) {
+		if read++; read == 4 {
+			break
+		}
+	}
+	if read != 4 {
+		t.Errorf("expected to stop after 4, read %d", read)
+	}
+
+	// the error ends the iteration
+	var errs []error
+	for _, err := range c.AllTransactions(ctx, "bob", ListOptions{}) {
+		errs = append(errs, err)
+	}
+	if len(errs) != 1 || !errors.Is(errs[0], ErrForbidden) {
+		t.Errorf("expected a single forbidden error, got %v", errs)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, newLedger(t), "alice")
+
+	_, err := c.RecordTransaction(ctx, "alice", TransactionInput{Type: Withdrawal, Amount: 10})
+	var apiErr *Error
+	if !errors.Is(err, ErrInsufficientFunds) || !errors.As(err, &apiErr) {
+		t.Fatalf("expected insufficient funds, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.RequestID == "" || apiErr.Message == "" {
+		t.Errorf("unexpected error %+v", apiErr)
+	}
+	if errors.Is(err, ErrValidation) {
+		t.Errorf("expected only the kind of the error to match")
+	}
+
+	_, err = c.RecordTransaction(ctx, "alice", TransactionInput{Type: Deposit, Amount: -5})
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrValidation) || len(apiErr.Fields) != 1 || apiErr.Fields[0].Field != "amount" {
+		t.Errorf("expected a validation error of the amount, got %+v", err)
+	}
+
+	if _, err := c.GetBalance(ctx, "bob"); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected forbidden, got %v", err)
+	}
+
+	// the same key with another body
+	input := TransactionInput{Type: Deposit, Amount: 10, IdempotencyKey: "order-1"}
+	if _, err := c.RecordTransaction(ctx, "alice", input); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	input.Amount = 20
+	if _, err := c.RecordTransaction(ctx, "alice", input); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Errorf("expected the key to be reused, got %v", err)
+	}
+
+	anonymous, err := New(c.baseURL.Scheme + "://" + c.baseURL.Host)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := anonymous.GetBalance(ctx, "alice"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected unauthorized, got %v", err)
+	}
+}
+
+// flaky fails the first n requests with status, after passing them on to next when record is set: the server
+// recorded the request but the client never saw the response
+func flaky(next http.Handler, n int32, status int, record bool) (http.Handler, *atomic.Int32) {
+	var calls atomic.Int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) > n {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if record {
+			next.ServeHTTP(httptest.NewRecorder(), r)
+		}
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(status)
+	}), &calls
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("lost responses are recorded once", func(t *testing.T) {
+		handler, calls := flaky(newLedger(t), 2, http.StatusBadGateway, true)
+		c := newClient(t, handler, "alice")
+
+		tx, err := c.RecordTransaction(ctx, "alice", TransactionInput{Type: Deposit, Amount: 50})
+		if err != nil || tx.Amount != 50 {
+			t.Fatalf("expected the deposit on the third attempt, got %+v %v", tx, err)
+		}
+		if _, err := c.Transfer(ctx, "alice", TransferInput{ToUserID: "bob", Amount: 20}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if balance, _ := c.GetBalance(ctx, "alice"); balance.Balance != 30 || calls.Load() != 5 {
+			t.Errorf("expected a single deposit and transfer after 5 requests, got %v after %d", balance.Balance, calls.Load())
+		}
+	})
+
+	t.Run("batches with references", func(t *testing.T) {
+		handler, calls := flaky(newLedger(t), 1, http.StatusBadGateway, true)
+		c := newClient(t, handler, "alice")
+
+		// the lost attempt recorded the batch, the retry is told so
+		_, err := c.RecordBatch(ctx, "alice", []TransactionInput{{Type: Deposit, Amount: 5, ReferenceID: "import-1"}})
+		if !errors.Is(err, ErrDuplicate) || calls.Load() != 2 {
+			t.Errorf("expected a duplicate on the second attempt, got %v after %d", err, calls.Load())
+		}
+	})
+
+	t.Run("batches without references aren't retried", func(t *testing.T) {
+		handler, calls := flaky(newLedger(t), 1, http.StatusBadGateway, true)
+		c := newClient(t, handler, "alice")
+
+		if _, err := c.RecordBatch(ctx, "alice", []TransactionInput{{Type: Deposit, Amount: 5}}); err == nil || calls.Load() != 1 {
+			t.Errorf("expected a single attempt, got %v after %d", err, calls.Load())
+		}
+	})
+
+	t.Run("gives up", func(t *testing.T) {
+		handler, calls := flaky(newLedger(t), 10, http.StatusServiceUnavailable, false)
+		c := newClient(t, handler, "alice")
+
+		_, err := c.GetBalance(ctx, "alice")
+		var apiErr *Error
+		if !errors.As(err, &apiErr) || apiErr.Kind != "HTTP_503" || calls.Load() != DefaultRetries+1 {
+			t.Errorf("expected the last 503 after %d attempts, got %v after %d", DefaultRetries+1, err, calls.Load())
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		handler, calls := flaky(newLedger(t), 1, http.StatusTooManyRequests, false)
+		c := newClient(t, handler, "alice", WithRetries(0, 0))
+
+		var apiErr *Error
+		if _, err := c.GetBalance(ctx, "alice"); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || calls.Load() != 1 {
+			t.Errorf("expected a single attempt, got %v after %d", err, calls.Load())
+		}
+	})
+
+	t.Run("client errors aren't retried", func(t *testing.T) {
+		handler, calls := flaky(newLedger(t), 0, 0, false)
+		c := newClient(t, handler, "alice")
+
+		if _, err := c.RecordTransaction(ctx, "alice", TransactionInput{Type: Withdrawal, Amount: 1}); !errors.Is(err, ErrInsufficientFunds) || calls.Load() != 1 {
+			t.Errorf("expected a single attempt, got %v after %d", err, calls.Load())
+		}
+	})
+
+	t.Run("timeouts are retried", func(t *testing.T) {
+		var calls atomic.Int32
+		ledger := newLedger(t)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				<-r.Context().Done()
+				return
+			}
+			ledger.ServeHTTP(w, r)
+		})
+		c := newClient(t, handler, "alice", WithTimeout(50*time.Millisecond))
+
+		if _, err := c.GetBalance(ctx, "alice"); err != nil || calls.Load() != 2 {
+			t.Errorf("expected the second attempt to succeed, got %v after %d", err, calls.Load())
+		}
+	})
+
+	t.Run("the context ends the retries", func(t *testing.T) {
+		handler, calls := flaky(newLedger(t), 10, http.StatusServiceUnavailable, false)
+		c := newClient(t, handler, "alice", WithRetries(10, time.Hour))
+
+		ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+		defer cancel()
+		if _, err := c.GetBalance(ctx, "alice"); err == nil || calls.Load() != 1 {
+			t.Errorf("expected to give up while waiting, got %v after %d", err, calls.Load())
+		}
+	})
+}
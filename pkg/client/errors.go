@@ -0,0 +1,121 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// the error kinds of the server, an *Error is one of them with errors.Is:
+//
+//	if errors.Is(err, client.ErrInsufficientFunds) { ... }
+var (
+	ErrValidation           = errors.New("VALIDATION_FAILED")
+	ErrUnauthorized         = errors.New("UNAUTHORIZED")
+	ErrForbidden            = errors.New("FORBIDDEN")
+	ErrNotFound             = errors.New("NOT_FOUND")
+	ErrConflict             = errors.New("CONFLICT")
+	ErrPreconditionFailed   = errors.New("PRECONDITION_FAILED")
+	ErrDuplicate            = errors.New("DUPLICATE")
+	ErrInsufficientFunds    = errors.New("INSUFFICIENT_FUNDS")
+	ErrMinimumBalance       = errors.New("MINIMUM_BALANCE")
+	ErrIdempotencyKeyReused = errors.New("IDEMPOTENCY_KEY_REUSED")
+	ErrUnprocessable        = errors.New("UNPROCESSABLE")
+	ErrRateLimited          = errors.New("RATE_LIMITED")
+	ErrTimeout              = errors.New("TIMEOUT")
+	ErrInternal             = errors.New("INTERNAL")
+)
+
+var kinds = map[string]error{}
+
+func init() {
+	for _, sentinel := range []error{
+		ErrValidation, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict, ErrPreconditionFailed, ErrDuplicate,
+		ErrInsufficientFunds, ErrMinimumBalance, ErrIdempotencyKeyReused, ErrUnprocessable, ErrRateLimited,
+		ErrTimeout, ErrInternal,
+	} {
+		kinds[sentinel.Error()] = sentinel
+	}
+}
+
+// Error is an error response of the server. Kind is the stable machine readable kind (INSUFFICIENT_FUNDS,
+// VALIDATION_FAILED...), Code the finer rule when the server names one (e.g. not_positive)
+type Error struct {
+	StatusCode int
+	Kind       string
+	Code       string
+	Message    string
+	RequestID  string
+	Fields     []FieldError  // the rejected fields of a validation error
+	Items      []ItemError   // the rejected transactions of a batch
+	RetryAfter time.Duration // how long the server asked to wait, of a rate limited request
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code,omitempty"`
+	Message string `json:"message"`
+}
+
+// ItemError is a rejected transaction of a batch, Index is its position in the batch. Code is the rule it broke for
+// an invalid item (not_positive...) and the error kind otherwise (INSUFFICIENT_FUNDS...)
+type ItemError struct {
+	Index   int    `json:"index"`
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %s", e.Kind, e.Message)
+}
+
+// Is matches the sentinel error of the kind
+func (e *Error) Is(target error) bool {
+	sentinel, known := kinds[e.Kind]
+	return known && sentinel == target
+}
+
+// Temporary is whether the same request may succeed later: the server was overloaded, rate limited or timed out
+func (e *Error) Temporary() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// newError reads the error body of resp, a body that isn't the API's error shape (e.g. of a proxy) keeps the status
+func newError(resp *http.Response) *Error {
+	e := &Error{StatusCode: resp.StatusCode, Kind: fmt.Sprintf("HTTP_%d", resp.StatusCode), Message: http.StatusText(resp.StatusCode)}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		e.RetryAfter = time.Duration(seconds) * time.Second
+	}
+
+	var body struct {
+		Error     string `json:"error"`
+		Code      string `json:"code"`
+		RequestID string `json:"requestId"`
+		Details   struct {
+			Code    string       `json:"code"`
+			Message string       `json:"message"`
+			Fields  []FieldError `json:"fields"`
+			Items   []ItemError  `json:"items"`
+		} `json:"details"`
+	}
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if json.Unmarshal(raw, &body) != nil || body.Details.Code == "" {
+		return e
+	}
+	e.Kind, e.Code, e.Message, e.RequestID = body.Details.Code, body.Code, body.Details.Message, body.RequestID
+	e.Fields, e.Items = body.Details.Fields, body.Details.Items
+	if e.Message == "" {
+		e.Message = body.Error
+	}
+	return e
+}
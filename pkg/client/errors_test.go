@@ -0,0 +1,52 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func response(status int, header http.Header, body string) *http.Response {
+	return &http.Response{StatusCode: status, Header: header, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestNewError(t *testing.T) {
+	e := newError(response(http.StatusUnprocessableEntity, http.Header{}, `{"error":"insufficient funds","requestId":"req-1",
+		"details":{"code":"INSUFFICIENT_FUNDS","message":"insufficient funds"}}`))
+	if e.Kind != "INSUFFICIENT_FUNDS" || e.RequestID != "req-1" || e.Error() != "INSUFFICIENT_FUNDS: insufficient funds" {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if !errors.Is(e, ErrInsufficientFunds) || !errors.Is(fmt.Errorf("wrapped: %w", e), ErrInsufficientFunds) || errors.Is(e, ErrNotFound) {
+		t.Errorf("expected the error to match its kind only")
+	}
+	if e.Temporary() {
+		t.Errorf("expected a 422 not to be temporary")
+	}
+
+	// the body of a proxy
+	e = newError(response(http.StatusBadGateway, http.Header{}, "<html>bad gateway</html>"))
+	if e.Kind != "HTTP_502" || e.Message != "Bad Gateway" || !e.Temporary() {
+		t.Errorf("unexpected error %+v", e)
+	}
+
+	e = newError(response(http.StatusTooManyRequests, http.Header{"Retry-After": {"3"}}, `{"details":{"code":"RATE_LIMITED","message":"slow down"}}`))
+	if !errors.Is(e, ErrRateLimited) || e.RetryAfter != 3*time.Second || !e.Temporary() {
+		t.Errorf("unexpected error %+v", e)
+	}
+}
+
+func TestWait(t *testing.T) {
+	c := &Client{backoff: 100 * time.Millisecond}
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond} {
+		if wait := c.wait(attempt, errors.New("refused")); wait < expected || wait > expected*3/2 {
+			t.Errorf("expected about %v before attempt %d, got %v", expected, attempt+2, wait)
+		}
+	}
+	if wait := c.wait(0, &Error{RetryAfter: 5 * time.Second}); wait != 5*time.Second {
+		t.Errorf("expected the Retry-After of the server, got %v", wait)
+	}
+}
@@ -0,0 +1,42 @@
+package ledger
+
+import (
+	"errors"
+
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// the errors of the ledger, with errors.Is:
+//
+//	if errors.Is(err, ledger.ErrInsufficientFunds) { ... }
+var (
+	ErrInsufficientFunds   = store.ErrInsufficientFunds
+	ErrMinimumBalance      = store.ErrMinimumBalance
+	ErrUserNotFound        = store.ErrUserNotFound
+	ErrUserExists          = store.ErrUserExists
+	ErrDuplicateReference  = store.ErrDuplicateReference
+	ErrPossibleDuplicate   = store.ErrPossibleDuplicate
+	ErrTransactionNotFound = store.ErrTransactionNotFound
+)
+
+// ValidationError is an invalid input, Field names it and Code the rule it broke (e.g. not_positive)
+type ValidationError struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// translate turns the validation errors of the service into *ValidationError, the first one when there are several.
+// the sentinels are the store's own and go through as they are
+func translate(err error) error {
+	var validation *services.ValidationError
+	if errors.As(err, &validation) {
+		return &ValidationError{Field: validation.Field, Code: validation.Code, Message: err.Error()}
+	}
+	return err
+}
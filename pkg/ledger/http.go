@@ -0,0 +1,19 @@
+package ledger
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"tiny-ledger/internal/handlers"
+)
+
+// Mount serves the HTTP API of the ledger on m under prefix, e.g. /ledger/users/{userId}/balance, "" mounts it at
+// the root. the API is the one of the server without its auth, which is the caller's to put in front of m. a ledger
+// is mounted once, the Location headers point under the prefix it was mounted at
+func (l *Ledger) Mount(m *http.ServeMux, prefix string) {
+	r := mux.NewRouter()
+	r.Use(handlers.RequestIDMiddleware, handlers.RecoveryMiddleware(l.logger))
+	l.handler.RegisterAPIRoutes(r, prefix)
+	m.Handle(prefix+"/", r)
+}
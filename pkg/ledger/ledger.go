@@ -0,0 +1,201 @@
+// Package ledger embeds the ledger in another binary: the store, the business rules and, when wanted, the HTTP API
+// on a mux of the caller, without running the server. the types are the package's own, nothing of the internal
+// packages shows in its API:
+//
+//	l, err := ledger.New(ledger.WithMaxAmount(5000))
+//	tx, err := l.RecordTransaction(ctx, "alice", ledger.TransactionInput{Type: ledger.Deposit, Amount: 10})
+//	if errors.Is(err, ledger.ErrInsufficientFunds) { ... }
+//	l.Mount(mux, "/ledger")
+//
+// cmd/server is built on it
+package ledger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"tiny-ledger/internal/clock"
+	"tiny-ledger/internal/embedding"
+	"tiny-ledger/internal/handlers"
+	"tiny-ledger/internal/models"
+	"tiny-ledger/internal/services"
+	"tiny-ledger/internal/store"
+)
+
+// Ledger is a ledger of its own, safe for concurrent use
+type Ledger struct {
+	store   *store.LedgerStore
+	service services.LedgerService
+	handler *handlers.LedgerHandler
+	logger  *slog.Logger
+}
+
+// Clock is the time source of the timestamps, e.g. a fake one in tests
+type Clock interface {
+	Now() time.Time
+}
+
+// Option configures a ledger, the ones of this package are the public ones
+type Option func(*embedding.Settings)
+
+// WithMaxAmount caps the amount of a single deposit or withdrawal
+func WithMaxAmount(amount float64) Option {
+	return func(s *embedding.Settings) {
+		s.Config.MaxDepositAmount, s.Config.MaxWithdrawalAmount = amount, amount
+	}
+}
+
+// WithStrictAccounts requires the users to be created with CreateUser before they transact, otherwise the first
+// transaction opens the account
+func WithStrictAccounts() Option {
+	return func(s *embedding.Settings) {
+		s.Config.StrictAccounts = true
+	}
+}
+
+// WithCurrency sets the ISO 4217 code the ledger is kept in, USD by default
+func WithCurrency(code string) Option {
+	return func(s *embedding.Settings) {
+		s.Config.Currency = code
+	}
+}
+
+// WithClock replaces the wall clock
+func WithClock(c Clock) Option {
+	return func(s *embedding.Settings) {
+		s.Clock = c
+	}
+}
+
+// WithLogger is the logger of the HTTP handlers, slog.Default when not set
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *embedding.Settings) {
+		s.Logger = logger
+	}
+}
+
+// WithTracerProvider traces the operations of the ledger, no spans when not set
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(s *embedding.Settings) {
+		s.ServiceOptions = append(s.ServiceOptions, services.WithTracerProvider(provider))
+	}
+}
+
+// New builds a ledger, in memory unless an option of this module says otherwise
+func New(opts ...Option) (*Ledger, error) {
+	settings := embedding.Settings{Config: services.DefaultConfig(), Clock: clock.Real}
+	for _, opt := range opts {
+		opt(&settings)
+	}
+	if settings.Config.MaxDepositAmount <= 0 || settings.Config.MaxWithdrawalAmount <= 0 {
+		return nil, errors.New("the max amount must be positive")
+	}
+	if len(settings.Config.Currency) != 3 {
+		return nil, fmt.Errorf("invalid currency %q, expected an ISO 4217 code", settings.Config.Currency)
+	}
+
+	if settings.Logger == nil {
+		settings.Logger = slog.Default()
+	}
+
+	ledgerStore := settings.Store
+	if ledgerStore == nil {
+		ledgerStore = store.NewLedgerStore(store.WithClock(settings.Clock))
+	}
+	serviceOpts := append([]services.Option{services.WithConfig(settings.Config), services.WithClock(settings.Clock)}, settings.ServiceOptions...)
+	service := services.NewLedgerService(ledgerStore, serviceOpts...)
+	handlerOpts := append([]handlers.HandlerOption{handlers.WithClock(settings.Clock.Now)}, settings.HandlerOptions...)
+
+	l := &Ledger{
+		store:   ledgerStore,
+		service: service,
+		handler: handlers.NewLedgerHandler(service, settings.Logger, handlerOpts...),
+		logger:  settings.Logger,
+	}
+	settings.Built(embedding.Parts{Store: l.store, Service: l.service, Handler: l.handler})
+	return l, nil
+}
+
+// CreateUser opens the account of a user, ErrUserExists when it's already open
+func (l *Ledger) CreateUser(ctx context.Context, userID string) error {
+	return translate(l.service.WithContext(ctx).CreateUser(userID))
+}
+
+// RecordTransaction records a deposit or a withdrawal of the user
+func (l *Ledger) RecordTransaction(ctx context.Context, userID string, input TransactionInput) (Transaction, error) {
+	tx, err := l.service.WithContext(ctx).RecordTransactionInput(userID, services.TransactionInput{
+		Type:           models.TransactionType(input.Type),
+		Amount:         input.Amount,
+		Description:    input.Description,
+		ReferenceID:    input.ReferenceID,
+		AllowDuplicate: input.AllowDuplicate,
+	})
+	if err != nil {
+		return Transaction{}, translate(err)
+	}
+	return newTransaction(userID, tx), nil
+}
+
+// Balance is the current balance of the user, zero for a user without transactions
+func (l *Ledger) Balance(ctx context.Context, userID string) (float64, error) {
+	balance, err := l.service.WithContext(ctx).GetCurrentBalance(userID)
+	return balance, translate(err)
+}
+
+// History is a page of the history of the user, oldest first unless the query is descending. Next of the page is
+// the After of the next query, nil once the history is walked
+func (l *Ledger) History(ctx context.Context, userID string, query HistoryQuery) (HistoryPage, error) {
+	filter := services.HistoryFilter{StartTime: query.Start, EndTime: query.End, Descending: query.Descending}
+	if query.Type != "" {
+		txType := models.TransactionType(query.Type)
+		filter.Type = &txType
+	}
+	var after *services.HistoryCursor
+	if query.After != nil {
+		after = &services.HistoryCursor{Timestamp: query.After.Timestamp, ID: query.After.ID, Descending: query.After.Descending}
+	}
+
+	page, err := l.service.WithContext(ctx).GetTransactionHistoryAfter(userID, filter, after, query.Limit)
+	if err != nil {
+		return HistoryPage{}, translate(err)
+	}
+	history := HistoryPage{Transactions: make([]Transaction, len(page.Transactions))}
+	for i, tx := range page.Transactions {
+		history.Transactions[i] = newTransaction(userID, tx)
+	}
+	if page.NextCursor != nil {
+		history.Next = &Cursor{Timestamp: page.NextCursor.Timestamp, ID: page.NextCursor.ID, Descending: page.NextCursor.Descending}
+	}
+	return history, nil
+}
+
+// Transfer moves amount from one user to another atomically, a withdrawal of the sender and a deposit of the
+// recipient
+func (l *Ledger) Transfer(ctx context.Context, fromUserID, toUserID string, amount float64, description string) (Transfer, error) {
+	journal, err := l.service.WithContext(ctx).Transfer(fromUserID, toUserID, amount, description)
+	if err != nil {
+		return Transfer{}, translate(err)
+	}
+	transfer := Transfer{ID: journal.ID}
+	for _, entry := range journal.Entries {
+		if entry.UserID == fromUserID && entry.Transaction.Type == models.Withdrawal {
+			transfer.Debit = newTransaction(entry.UserID, entry.Transaction)
+		} else {
+			transfer.Credit = newTransaction(entry.UserID, entry.Transaction)
+		}
+	}
+	return transfer, nil
+}
+
+// Subscribe calls fn with every new record, in commit order on a single goroutine: a slow fn delays the events after
+// it but never the writes. when too many events are waiting the new ones are dropped
+func (l *Ledger) Subscribe(fn func(Event)) (unsubscribe func()) {
+	return l.service.Subscribe(func(event services.TransactionEvent) {
+		fn(Event{Transaction: newTransaction(event.UserID, event.Transaction), Balance: event.Balance})
+	})
+}
@@ -0,0 +1,162 @@
+package ledger_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"tiny-ledger/internal/clock/clocktest"
+	"tiny-ledger/pkg/ledger"
+)
+
+func newLedger(t *testing.T, opts ...ledger.Option) *ledger.Ledger {
+	t.Helper()
+	l, err := ledger.New(opts...)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return l
+}
+
+func TestRecordTransaction(t *testing.T) {
+	ctx := context.Background()
+	l := newLedger(t, ledger.WithClock(clocktest.NewFake(clocktest.Start)), ledger.WithMaxAmount(500))
+
+	tx, err := l.RecordTransaction(ctx, "alice", ledger.TransactionInput{Type: ledger.Deposit, Amount: 100, Description: "salary"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tx.UserID != "alice" || tx.Type != ledger.Deposit || tx.Amount != 100 || !tx.Timestamp.Equal(clocktest.Start) {
+		t.Errorf("unexpected transaction %+v", tx)
+	}
+
+	_, err = l.RecordTransaction(ctx, "alice", ledger.TransactionInput{Type: ledger.Withdrawal, Amount: 150})
+	if !errors.Is(err, ledger.ErrInsufficientFunds) {
+		t.Errorf("expected ErrInsufficientFunds, got %v", err)
+	}
+
+	var validation *ledger.ValidationError
+	_, err = l.RecordTransaction(ctx, "alice", ledger.TransactionInput{Type: ledger.Deposit, Amount: 600})
+	if !errors.As(err, &validation) || validation.Field != "amount" {
+		t.Errorf("expected a validation error of the amount, got %v", err)
+	}
+
+	if balance, err := l.Balance(ctx, "alice"); err != nil || balance != 100 {
+		t.Errorf("expected a balance of 100, got %v %v", balance, err)
+	}
+}
+
+func TestStrictAccounts(t *testing.T) {
+	ctx := context.Background()
+	l := newLedger(t, ledger.WithStrictAccounts())
+
+	if _, err := l.Balance(ctx, "bob"); !errors.Is(err, ledger.ErrUserNotFound) {
+		t.Errorf("expected ErrUserNotFound, got %v", err)
+	}
+	if err := l.CreateUser(ctx, "bob"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := l.CreateUser(ctx, "bob"); !errors.Is(err, ledger.ErrUserExists) {
+		t.Errorf("expected ErrUserExists, got %v", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	clock := clocktest.NewFake(clocktest.Start)
+	l := newLedger(t, ledger.WithClock(clock))
+
+	for i := range 5 {
+		clock.Advance(time.Minute)
+		l.RecordTransaction(ctx, "alice", ledger.TransactionInput{Type: ledger.Deposit, Amount: float64(i + 1)})
+	}
+	l.RecordTransaction(ctx, "alice", ledger.TransactionInput{Type: ledger.Withdrawal, Amount: 1})
+
+	var amounts []float64
+	query := ledger.HistoryQuery{Limit: 2, Type: ledger.Deposit, Descending: true}
+	for {
+		page, err := l.History(ctx, "alice", query)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, tx := range page.Transactions {
+			amounts = append(amounts, tx.Amount)
+		}
+		if page.Next == nil {
+			break
+		}
+		query.After = page.Next
+	}
+	if len(amounts) != 5 || amounts[0] != 5 || amounts[4] != 1 {
+		t.Errorf("expected the 5 deposits newest first, got %v", amounts)
+	}
+}
+
+func TestTransferAndSubscribe(t *testing.T) {
+	ctx := context.Background()
+	l := newLedger(t)
+
+	events := make(chan ledger.Event, 3)
+	defer l.Subscribe(func(event ledger.Event) { events <- event })()
+
+	l.RecordTransaction(ctx, "alice", ledger.TransactionInput{Type: ledger.Deposit, Amount: 50})
+	transfer, err := l.Transfer(ctx, "alice", "bob", 20, "lunch")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if transfer.Debit.UserID != "alice" || transfer.Credit.UserID != "bob" || *transfer.Credit.TransferID != transfer.ID {
+		t.Errorf("unexpected transfer %+v", transfer)
+	}
+
+	for _, expected := range []struct {
+		user    string
+		balance float64
+	}{{"alice", 50}, {"alice", 30}, {"bob", 20}} {
+		select {
+		case event := <-events:
+			if event.Transaction.UserID != expected.user || event.Balance != expected.balance {
+				t.Errorf("expected %s at %v, got %+v", expected.user, expected.balance, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no event")
+		}
+	}
+}
+
+func TestMount(t *testing.T) {
+	l := newLedger(t)
+	m := http.NewServeMux()
+	l.Mount(m, "/ledger")
+
+	req := httptest.NewRequest("POST", "/ledger/users/alice/transactions", strings.NewReader(`{"type": "deposit", "amount": 10}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	m.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated || !strings.HasPrefix(rr.Header().Get("Location"), "/ledger/users/alice/transactions/") {
+		t.Fatalf("unexpected response %d %v: %s", rr.Code, rr.Header(), rr.Body)
+	}
+
+	// the API and the library see the same ledger
+	if balance, _ := l.Balance(context.Background(), "alice"); balance != 10 {
+		t.Errorf("expected the deposit of the API in the balance, got %v", balance)
+	}
+	rr = httptest.NewRecorder()
+	m.ServeHTTP(rr, httptest.NewRequest("GET", "/ledger/users/alice/balance", nil))
+	var body struct{ Balance float64 }
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil || body.Balance != 10 {
+		t.Errorf("unexpected balance response %s", rr.Body)
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	for _, opt := range []ledger.Option{ledger.WithMaxAmount(0), ledger.WithCurrency("dollars")} {
+		if _, err := ledger.New(opt); err == nil {
+			t.Error("expected an error")
+		}
+	}
+}
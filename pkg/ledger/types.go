@@ -0,0 +1,96 @@
+package ledger
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"tiny-ledger/internal/models"
+)
+
+// TransactionType is Deposit or Withdrawal
+type TransactionType string
+
+const (
+	Deposit    TransactionType = "deposit"
+	Withdrawal TransactionType = "withdrawal"
+)
+
+type TransactionInput struct {
+	Type        TransactionType
+	Amount      float64
+	Description string
+	ReferenceID string // optional external reference, unique per user
+
+	// AllowDuplicate records an intentional repeat of a recent transaction
+	AllowDuplicate bool
+}
+
+type Transaction struct {
+	ID          uuid.UUID
+	UserID      string
+	Type        TransactionType
+	Amount      float64
+	Fee         float64 // charged on top of the amount of a withdrawal
+	Description string
+	ReferenceID string
+	Timestamp   time.Time
+
+	TransferID *uuid.UUID // the transfer the record is a leg of
+	ReversalOf *uuid.UUID // the transaction the record reverses
+	ReversedBy *uuid.UUID
+	Voided     bool // a voided record doesn't count in the balance
+}
+
+// Transfer is the two records of a transfer, Debit of the sender and Credit of the recipient
+type Transfer struct {
+	ID     uuid.UUID
+	Debit  Transaction
+	Credit Transaction
+}
+
+// HistoryQuery selects the records of a History page, the zero value is the first page of every record
+type HistoryQuery struct {
+	Start *time.Time // inclusive
+	End   *time.Time // inclusive
+	Type  TransactionType
+	Limit int // 50 when zero, at most 100
+
+	Descending bool    // newest first
+	After      *Cursor // the Next of the previous page
+}
+
+type HistoryPage struct {
+	Transactions []Transaction
+	Next         *Cursor // nil on the last page
+}
+
+// Cursor is a position in the history, it stays valid while records are added
+type Cursor struct {
+	Timestamp  time.Time
+	ID         uuid.UUID
+	Descending bool
+}
+
+// Event is a new record and the balance of its user right after it
+type Event struct {
+	Transaction Transaction
+	Balance     float64
+}
+
+func newTransaction(userID string, tx models.TransactionRecord) Transaction {
+	return Transaction{
+		ID:          tx.ID,
+		UserID:      userID,
+		Type:        TransactionType(tx.Type),
+		Amount:      tx.Amount,
+		Fee:         tx.Fee,
+		Description: tx.Description,
+		ReferenceID: tx.ReferenceID,
+		Timestamp:   tx.Timestamp,
+		TransferID:  tx.JournalID,
+		ReversalOf:  tx.ReversalOf,
+		ReversedBy:  tx.ReversedBy,
+		Voided:      tx.Voided,
+	}
+}
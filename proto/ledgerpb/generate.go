@@ -0,0 +1,5 @@
+// Package ledgerpb holds the stubs generated from proto/ledger.proto, needs protoc with protoc-gen-go and
+// protoc-gen-go-grpc on the PATH
+package ledgerpb
+
+//go:generate protoc -I .. --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative ../ledger.proto